@@ -0,0 +1,145 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 渠道密钥使用信封加密存储：每次加密生成随机数据密钥（DEK）加密渠道密钥，
+// DEK 再由主密钥（KEK）加密后与密文一同保存。主密钥来自环境变量或 KMS 挂载的密钥文件，
+// 未配置主密钥时渠道密钥保持明文，兼容旧部署
+const channelKeyCipherPrefix = "enc:v1:"
+
+var (
+	channelKeyKEK   []byte
+	channelKeyKEKId string
+)
+
+// initChannelKeyEncryption 读取 CHANNEL_KEY_ENCRYPTION_KEY 或 CHANNEL_KEY_ENCRYPTION_KEY_FILE。
+// 主密钥为 32 字节的 base64 时直接使用，否则取其 SHA-256
+func initChannelKeyEncryption() error {
+	material := strings.TrimSpace(os.Getenv("CHANNEL_KEY_ENCRYPTION_KEY"))
+	if path := strings.TrimSpace(os.Getenv("CHANNEL_KEY_ENCRYPTION_KEY_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CHANNEL_KEY_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		material = strings.TrimSpace(string(data))
+	}
+	if material == "" {
+		return nil
+	}
+	kek, err := base64.StdEncoding.DecodeString(material)
+	if err != nil || len(kek) != 32 {
+		sum := sha256.Sum256([]byte(material))
+		kek = sum[:]
+	}
+	id := sha256.Sum256(kek)
+	channelKeyKEK = kek
+	channelKeyKEKId = hex.EncodeToString(id[:4])
+	return nil
+}
+
+func ChannelKeyEncryptionEnabled() bool {
+	return len(channelKeyKEK) > 0
+}
+
+func IsEncryptedChannelKey(key string) bool {
+	return strings.HasPrefix(key, channelKeyCipherPrefix)
+}
+
+func aesGCMSeal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// EncryptChannelKey 加密渠道密钥，未配置主密钥或已加密时原样返回。
+// 格式：enc:v1:<主密钥标识>:<加密的 DEK>:<密文>
+func EncryptChannelKey(key string) (string, error) {
+	if !ChannelKeyEncryptionEnabled() || key == "" || IsEncryptedChannelKey(key) {
+		return key, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := aesGCMSeal(channelKeyKEK, dek)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := aesGCMSeal(dek, []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return channelKeyCipherPrefix + channelKeyKEKId + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptChannelKey 解密渠道密钥，明文（未加密的旧数据）原样返回
+func DecryptChannelKey(stored string) (string, error) {
+	if !IsEncryptedChannelKey(stored) {
+		return stored, nil
+	}
+	if !ChannelKeyEncryptionEnabled() {
+		return "", errors.New("channel key is encrypted but CHANNEL_KEY_ENCRYPTION_KEY is not configured")
+	}
+	parts := strings.Split(strings.TrimPrefix(stored, channelKeyCipherPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted channel key")
+	}
+	if parts[0] != channelKeyKEKId {
+		return "", fmt.Errorf("channel key was encrypted with another master key (%s)", parts[0])
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("invalid encrypted channel key")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("invalid encrypted channel key")
+	}
+	dek, err := aesGCMOpen(channelKeyKEK, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap channel data key: %w", err)
+	}
+	plain, err := aesGCMOpen(dek, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt channel key: %w", err)
+	}
+	return string(plain), nil
+}
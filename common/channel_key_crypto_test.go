@@ -0,0 +1,89 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func setChannelKeyKEK(t *testing.T, material string) {
+	t.Helper()
+	oldKEK, oldId := channelKeyKEK, channelKeyKEKId
+	t.Cleanup(func() {
+		channelKeyKEK, channelKeyKEKId = oldKEK, oldId
+	})
+	channelKeyKEK, channelKeyKEKId = nil, ""
+	t.Setenv("CHANNEL_KEY_ENCRYPTION_KEY_FILE", "")
+	t.Setenv("CHANNEL_KEY_ENCRYPTION_KEY", material)
+	if err := initChannelKeyEncryption(); err != nil {
+		t.Fatalf("failed to init channel key encryption: %v", err)
+	}
+}
+
+func TestChannelKeyEnvelopeRoundTrip(t *testing.T) {
+	setChannelKeyKEK(t, "test-master-key")
+	plain := "sk-abc\nsk-def"
+
+	stored, err := EncryptChannelKey(plain)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	if !IsEncryptedChannelKey(stored) || strings.Contains(stored, "sk-abc") {
+		t.Fatalf("expected encrypted envelope, got %q", stored)
+	}
+	if parts := strings.Split(strings.TrimPrefix(stored, channelKeyCipherPrefix), ":"); len(parts) != 3 || parts[0] != channelKeyKEKId {
+		t.Fatalf("unexpected envelope format %q", stored)
+	}
+	again, _ := EncryptChannelKey(plain)
+	if again == stored {
+		t.Fatal("expected a fresh data key and nonce per encryption")
+	}
+	if reencrypted, _ := EncryptChannelKey(stored); reencrypted != stored {
+		t.Fatal("expected already encrypted key to be returned unchanged")
+	}
+
+	decrypted, err := DecryptChannelKey(stored)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
+	}
+	if decrypted != plain {
+		t.Fatalf("decrypted %q, want %q", decrypted, plain)
+	}
+	if legacy, err := DecryptChannelKey("sk-plain"); err != nil || legacy != "sk-plain" {
+		t.Fatalf("expected plaintext key to pass through, got %q, %v", legacy, err)
+	}
+}
+
+func TestChannelKeyEnvelopeRejectsTampering(t *testing.T) {
+	setChannelKeyKEK(t, "test-master-key")
+	stored, err := EncryptChannelKey("sk-secret")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	tampered := stored[:len(stored)-2] + "AA"
+	if tampered == stored {
+		tampered = stored[:len(stored)-2] + "BB"
+	}
+	if _, err := DecryptChannelKey(tampered); err == nil {
+		t.Fatal("expected tampered ciphertext to fail authentication")
+	}
+	if _, err := DecryptChannelKey(channelKeyCipherPrefix + "bad"); err == nil {
+		t.Fatal("expected malformed envelope to be rejected")
+	}
+
+	setChannelKeyKEK(t, "another-master-key")
+	if _, err := DecryptChannelKey(stored); err == nil {
+		t.Fatal("expected key encrypted with another master key to be rejected")
+	}
+
+	setChannelKeyKEK(t, "")
+	if ChannelKeyEncryptionEnabled() {
+		t.Fatal("expected encryption to be disabled without a master key")
+	}
+	if plain, _ := EncryptChannelKey("sk-secret"); plain != "sk-secret" {
+		t.Fatal("expected keys to stay plaintext without a master key")
+	}
+	if _, err := DecryptChannelKey(stored); err == nil {
+		t.Fatal("expected encrypted key to fail without a master key")
+	}
+}
@@ -212,6 +212,8 @@ const (
 	TopUpStatusPending = "pending"
 	TopUpStatusSuccess = "success"
 	TopUpStatusExpired = "expired"
+	// 全额退款或拒付，部分退款的订单仍为 success 并记录已退金额
+	TopUpStatusRefunded = "refunded"
 )
 
 const (
@@ -233,3 +235,20 @@ const (
 	TicketPriorityHigh     = 3
 	TicketPriorityCritical = 4
 )
+
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2
+)
+
+const (
+	ProjectStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	ProjectStatusDisabled = 2
+)
+
+const (
+	OrgRoleOwner     = "owner"
+	OrgRoleAdmin     = "admin"
+	OrgRoleDeveloper = "developer"
+	OrgRoleViewer    = "viewer"
+)
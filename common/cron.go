@@ -0,0 +1,128 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule 标准 5 段 cron 表达式（分 时 日 月 周），支持 *、*/n、a-b、a-b/n 与逗号列表
+type CronSchedule struct {
+	minute  uint64
+	hour    uint64
+	day     uint64
+	month   uint64
+	weekday uint64
+	// 日与周同时被限定时按 cron 惯例任一匹配即可
+	dayRestricted     bool
+	weekdayRestricted bool
+}
+
+var cronFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron 表达式应包含 5 段（分 时 日 月 周）: %q", expr)
+	}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式第 %d 段无效: %w", i+1, err)
+		}
+		bits[i] = b
+	}
+	// 周日允许写作 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &CronSchedule{
+		minute:            bits[0],
+		hour:              bits[1],
+		day:               bits[2],
+		month:             bits[3],
+		weekday:           bits[4],
+		dayRestricted:     fields[2] != "*",
+		weekdayRestricted: fields[4] != "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("无效的步长 %q", part)
+			}
+			step = s
+			part = part[:idx]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("无效的取值 %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("无效的取值 %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		// 周字段允许 7 表示周日
+		upper := max
+		if max == 6 {
+			upper = 7
+		}
+		if lo < min || hi > upper || lo > hi {
+			return 0, fmt.Errorf("取值 %q 超出范围 %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Matches 判断 t 所在的分钟是否命中计划
+func (s *CronSchedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayMatch := s.day&(1<<uint(t.Day())) != 0
+	weekdayMatch := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.dayRestricted && s.weekdayRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
+
+// Next 返回 after 之后第一个命中计划的整分钟时间，五年内无匹配时返回零值
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.Matches(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())) {
+			if s.hour&(1<<uint(t.Hour())) == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected error", expr)
+		}
+	}
+	valid := []string{"* * * * *", "*/15 * * * *", "0 3 * * *", "0 0 1 * *", "30 8 * * 1-5", "0 0 * * 7", "0,30 9-17/2 * * *"}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) unexpected error: %v", expr, err)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	loc := time.UTC
+	base := time.Date(2026, 10, 19, 7, 47, 30, 0, loc)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 19, 7, 48, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 10, 19, 8, 0, 0, 0, loc)},
+		{"0 3 * * *", time.Date(2026, 10, 20, 3, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, loc)},
+		// 2026-10-19 是周一，下一个周日
+		{"0 0 * * 7", time.Date(2026, 10, 25, 0, 0, 0, 0, loc)},
+		// 日与周同时限定时任一命中即可
+		{"0 0 1 * 3", time.Date(2026, 10, 21, 0, 0, 0, 0, loc)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := schedule.Next(base); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package common
+
+import "strings"
+
+const RedactedValue = "[REDACTED]"
+
+// IsSensitiveFieldName 字段或配置项名称是否可能包含密钥，规则与选项接口隐藏 Token/Secret/Key 结尾的配置一致
+func IsSensitiveFieldName(name string) bool {
+	lower := strings.ToLower(name)
+	if i := strings.LastIndex(lower, "."); i >= 0 {
+		lower = lower[i+1:]
+	}
+	return strings.HasSuffix(lower, "key") ||
+		strings.HasSuffix(lower, "secret") ||
+		strings.HasSuffix(lower, "token") ||
+		strings.Contains(lower, "password") ||
+		strings.Contains(lower, "credential")
+}
+
+// RedactSensitiveFields 递归替换 JSON 对象中敏感字段的值，返回新对象
+func RedactSensitiveFields(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(value))
+		for k, item := range value {
+			if IsSensitiveFieldName(k) && !isEmptyValue(item) {
+				redacted[k] = RedactedValue
+				continue
+			}
+			redacted[k] = RedactSensitiveFields(item)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(value))
+		for i, item := range value {
+			redacted[i] = RedactSensitiveFields(item)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+func isEmptyValue(v any) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	default:
+		return false
+	}
+}
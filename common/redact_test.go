@@ -0,0 +1,69 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSensitiveFieldName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"key", true},
+		{"api_key", true},
+		{"AccessKey", true},
+		{"client_secret", true},
+		{"webhook_secret", true},
+		{"access_token", true},
+		{"password", true},
+		{"PasswordHash", true},
+		{"aws_credentials", true},
+		// 配置项名称按最后一段判断
+		{"stripe.ApiSecret", true},
+		{"oidc.client_id", false},
+		{"name", false},
+		{"keyword", false},
+		{"token_count", false},
+		{"quota", false},
+	}
+	for _, tt := range tests {
+		if got := IsSensitiveFieldName(tt.name); got != tt.want {
+			t.Errorf("IsSensitiveFieldName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactSensitiveFields(t *testing.T) {
+	input := map[string]any{
+		"name":     "channel",
+		"key":      "sk-secret",
+		"password": "p@ss",
+		"secret":   "",
+		"token":    nil,
+		"quota":    float64(100),
+		"settings": map[string]any{"api_key": "nested", "region": "us"},
+		"accounts": []any{map[string]any{"client_secret": "s1", "user": "a"}, "plain"},
+	}
+	want := map[string]any{
+		"name":     "channel",
+		"key":      RedactedValue,
+		"password": RedactedValue,
+		// 空值不替换，便于区分未设置与已设置
+		"secret":   "",
+		"token":    nil,
+		"quota":    float64(100),
+		"settings": map[string]any{"api_key": RedactedValue, "region": "us"},
+		"accounts": []any{map[string]any{"client_secret": RedactedValue, "user": "a"}, "plain"},
+	}
+	if got := RedactSensitiveFields(input); !reflect.DeepEqual(got, want) {
+		t.Fatalf("RedactSensitiveFields = %#v, want %#v", got, want)
+	}
+	// 返回新对象，不修改原值
+	if input["key"] != "sk-secret" || input["settings"].(map[string]any)["api_key"] != "nested" {
+		t.Fatalf("input was modified: %#v", input)
+	}
+	if got := RedactSensitiveFields("sk-secret"); got != "sk-secret" {
+		t.Fatalf("expected scalar to be returned as is, got %v", got)
+	}
+}
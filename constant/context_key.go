@@ -19,6 +19,14 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenProjectId         ContextKey = "token_project_id"
+	ContextKeyTokenOrgId             ContextKey = "token_org_id"
+	ContextKeyTokenMaxOutputTokens   ContextKey = "token_max_output_tokens"
+	ContextKeyTokenMaxInputTokens    ContextKey = "token_max_input_tokens"
+	ContextKeyTokenDisableTools      ContextKey = "token_disable_tools"
+	ContextKeyTokenDisableWebSearch  ContextKey = "token_disable_web_search"
+	ContextKeyDerivedTokenId         ContextKey = "derived_token_id"
+	ContextKeyDerivedTokenExpiresAt  ContextKey = "derived_token_expires_at"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -63,6 +71,23 @@ const (
 	// It is not returned to end users, but can be persisted into consume/error logs for debugging.
 	ContextKeyAdminRejectReason ContextKey = "admin_reject_reason"
 
+	// ContextKeyDLPAction / ContextKeyDLPFindings store the DLP policy action and per-detector hit counts of the request
+	ContextKeyDLPAction   ContextKey = "dlp_action"
+	ContextKeyDLPFindings ContextKey = "dlp_findings"
+
+	// ContextKeyPromptGuardResult stores the prompt guard decision (*service.PromptGuardResult) of the request
+	ContextKeyPromptGuardResult ContextKey = "prompt_guard_result"
+
+	// ContextKeyContentFilter stores the output content filter writer of the request, its result is logged as other.content_filter
+	ContextKeyContentFilter ContextKey = "content_filter"
+
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	/* admin audit related keys */
+	ContextKeyAuditStarted    ContextKey = "audit_started"
+	ContextKeyAuditTargetType ContextKey = "audit_target_type"
+	ContextKeyAuditTargetId   ContextKey = "audit_target_id"
+	ContextKeyAuditBefore     ContextKey = "audit_before"
+	ContextKeyAuditAfter      ContextKey = "audit_after"
 )
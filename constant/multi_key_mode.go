@@ -3,6 +3,8 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom    MultiKeyMode = "random"     // 随机
+	MultiKeyModePolling   MultiKeyMode = "polling"    // 轮询
+	MultiKeyModeLeastUsed MultiKeyMode = "least_used" // 当日消耗 token 最少的优先
+	MultiKeyModeFillFirst MultiKeyMode = "fill_first" // 按顺序用尽一个 Key 的限额后再使用下一个，适合免费额度
 )
@@ -0,0 +1,74 @@
+package constant
+
+// 管理后台细粒度权限，可组合为自定义角色分配给用户。
+// 超级管理员拥有全部权限；未分配自定义角色的管理员拥有全部管理权限
+const (
+	PermissionChannelsRead  = "channels:read"  // 查看渠道（不含密钥）
+	PermissionChannelsWrite = "channels:write" // 新增、编辑、删除、测试渠道
+
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write" // 创建、编辑、封禁、删除用户
+	PermissionUsersQuota = "users:quota" // 调整用户额度
+
+	PermissionBillingRead  = "billing:read"  // 充值、退款、账本与账单
+	PermissionBillingWrite = "billing:write" // 补单、退款、充值套餐、优惠码与汇率
+
+	PermissionSubscriptionsRead  = "subscriptions:read"
+	PermissionSubscriptionsWrite = "subscriptions:write"
+
+	PermissionRedemptionsRead   = "redemptions:read"
+	PermissionRedemptionsCreate = "redemptions:create"
+	PermissionRedemptionsWrite  = "redemptions:write"
+
+	PermissionLogsRead   = "logs:read" // 日志、统计、绘图与任务记录
+	PermissionLogsDelete = "logs:delete"
+
+	PermissionTasksManage = "tasks:manage" // 任务重新轮询、取消、退款
+
+	PermissionTicketsRead   = "tickets:read"
+	PermissionTicketsReply  = "tickets:reply"
+	PermissionTicketsManage = "tickets:manage" // 修改状态、删除工单
+
+	PermissionModelsRead  = "models:read" // 模型、供应商、分组与预填组
+	PermissionModelsWrite = "models:write"
+
+	PermissionDeploymentsManage   = "deployments:manage"
+	PermissionOrganizationsManage = "organizations:manage"
+
+	PermissionAuditRead = "audit:read" // 查看与导出管理审计日志
+)
+
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersQuota,
+	PermissionBillingRead,
+	PermissionBillingWrite,
+	PermissionSubscriptionsRead,
+	PermissionSubscriptionsWrite,
+	PermissionRedemptionsRead,
+	PermissionRedemptionsCreate,
+	PermissionRedemptionsWrite,
+	PermissionLogsRead,
+	PermissionLogsDelete,
+	PermissionTasksManage,
+	PermissionTicketsRead,
+	PermissionTicketsReply,
+	PermissionTicketsManage,
+	PermissionModelsRead,
+	PermissionModelsWrite,
+	PermissionDeploymentsManage,
+	PermissionOrganizationsManage,
+	PermissionAuditRead,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
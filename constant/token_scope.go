@@ -0,0 +1,35 @@
+package constant
+
+// 令牌作用域，限制令牌可调用的接口类别。令牌未设置作用域时可调用全部接口
+const (
+	TokenScopeChat       = "chat"       // 对话、补全、Responses、Claude Messages 与 Gemini 生成
+	TokenScopeEmbeddings = "embeddings" // 向量化
+	TokenScopeRerank     = "rerank"
+	TokenScopeImages     = "images"
+	TokenScopeAudio      = "audio" // 语音合成、转录与翻译
+	TokenScopeRealtime   = "realtime"
+	TokenScopeTasks      = "tasks" // 视频、Suno 等异步任务
+	TokenScopeMj         = "mj"    // Midjourney
+	TokenScopeModelsList = "models:list"
+)
+
+var AllTokenScopes = []string{
+	TokenScopeChat,
+	TokenScopeEmbeddings,
+	TokenScopeRerank,
+	TokenScopeImages,
+	TokenScopeAudio,
+	TokenScopeRealtime,
+	TokenScopeTasks,
+	TokenScopeMj,
+	TokenScopeModelsList,
+}
+
+func IsValidTokenScope(scope string) bool {
+	for _, s := range AllTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
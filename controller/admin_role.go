@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/gin-gonic/gin"
+)
+
+type AssignAdminRoleRequest struct {
+	UserId int `json:"user_id"`
+	RoleId int `json:"role_id"`
+}
+
+// GetAllPermissions 可分配的全部权限
+func GetAllPermissions(c *gin.Context) {
+	common.ApiSuccess(c, constant.AllPermissions)
+}
+
+func GetAdminRoles(c *gin.Context) {
+	roles, err := model.GetAllAdminRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, roles)
+}
+
+func CreateAdminRole(c *gin.Context) {
+	var role model.AdminRole
+	if err := c.ShouldBindJSON(&role); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := role.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role.Id = 0
+	if err := role.Insert(); err != nil {
+		common.ApiErrorMsg(c, "角色名称已存在")
+		return
+	}
+	model.AuditAfter(c, role)
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("创建管理角色 %s，权限: %s", role.Name, role.Permissions))
+	common.ApiSuccess(c, role)
+}
+
+func UpdateAdminRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	var role model.AdminRole
+	if err := c.ShouldBindJSON(&role); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := role.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	origin, err := model.GetAdminRoleById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "角色不存在")
+		return
+	}
+	model.AuditBefore(c, origin)
+	role.Id = id
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditAfter(c, role)
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("修改管理角色 %s，权限: %s", role.Name, role.Permissions))
+	common.ApiSuccess(c, role)
+}
+
+func DeleteAdminRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	if role, err := model.GetAdminRoleById(id); err == nil {
+		model.AuditBefore(c, role)
+	}
+	if err := model.DeleteAdminRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("删除管理角色 #%d", id))
+	common.ApiSuccess(c, nil)
+}
+
+// AssignAdminRole 为用户分配自定义角色，role_id 为 0 时取消分配
+func AssignAdminRole(c *gin.Context) {
+	var req AssignAdminRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId <= 0 || req.RoleId < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if user.Role >= common.RoleRootUser {
+		common.ApiErrorMsg(c, "无法为超级管理员分配角色")
+		return
+	}
+	model.AuditTarget(c, "user", user.Id)
+	model.AuditBefore(c, map[string]int{"admin_role_id": user.AdminRoleId})
+	if err := model.SetUserAdminRole(user.Id, req.RoleId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditAfter(c, map[string]int{"admin_role_id": req.RoleId})
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("为用户 %s 分配管理角色 #%d", user.Username, req.RoleId))
+	common.ApiSuccess(c, nil)
+}
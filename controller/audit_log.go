@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseAuditLogFilter(c *gin.Context) model.AuditLogFilter {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogFilter{
+		UserId:         userId,
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	logs, total, err := model.GetAuditLogs(parseAuditLogFilter(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ExportAuditLogs 按筛选条件流式导出审计日志
+func ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", service.LogExportFormatCSV)
+	if !service.IsValidLogExportFormat(format) {
+		common.ApiErrorMsg(c, "不支持的导出格式: "+format)
+		return
+	}
+	fileName := fmt.Sprintf("audit-logs-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Type", service.LogExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("Cache-Control", "no-cache")
+	rows, err := service.WriteAuditLogExport(c.Writer, format, parseAuditLogFilter(c), c.Writer.Flush)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("audit log export interrupted after %d rows: %s", rows, err.Error()))
+		_ = c.Error(err)
+	}
+}
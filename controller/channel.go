@@ -65,6 +65,7 @@ func clearChannelInfo(channel *model.Channel) {
 		channel.ChannelInfo.MultiKeyDisabledReason = nil
 		channel.ChannelInfo.MultiKeyDisabledTime = nil
 	}
+	channel.MaskBalanceAdminKey()
 }
 
 func GetAllChannels(c *gin.Context) {
@@ -216,7 +217,7 @@ func FetchUpstreamModels(c *gin.Context) {
 
 	// 对于 Ollama 渠道，使用特殊处理
 	if channel.Type == constant.ChannelTypeOllama {
-		key := strings.Split(channel.Key, "\n")[0]
+		key := channel.GetFirstKey()
 		models, err := ollama.FetchOllamaModels(baseURL, key)
 		if err != nil {
 			c.JSON(http.StatusOK, gin.H{
@@ -508,17 +509,31 @@ func GetChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	var keyUsage []model.ChannelKeyUsage
 	if channel != nil {
 		clearChannelInfo(channel)
+		if channel.ChannelInfo.IsMultiKey {
+			keyUsage = getChannelKeyUsages(channel.Id)
+		}
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    channel,
+		"success":   true,
+		"message":   "",
+		"data":      channel,
+		"key_usage": keyUsage,
 	})
 	return
 }
 
+// getChannelKeyUsages 多 Key 渠道各个 Key 的用量统计，用量按 Key 内容记录，需要读取完整的密钥
+func getChannelKeyUsages(channelId int) []model.ChannelKeyUsage {
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		return nil
+	}
+	return model.GetChannelKeyUsages(channel.Id, channel.GetKeys())
+}
+
 // GetChannelKey 获取渠道密钥（需要通过安全验证中间件）
 // 此函数依赖 SecureVerificationRequired 中间件，确保用户已通过安全验证
 func GetChannelKey(c *gin.Context) {
@@ -541,6 +556,12 @@ func GetChannelKey(c *gin.Context) {
 		return
 	}
 
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		common.ApiError(c, fmt.Errorf("解密渠道密钥失败: %v", err))
+		return
+	}
+
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
 
@@ -549,7 +570,7 @@ func GetChannelKey(c *gin.Context) {
 		"success": true,
 		"message": "获取成功",
 		"data": map[string]interface{}{
-			"key": channel.Key,
+			"key": plainKey,
 		},
 	})
 }
@@ -718,6 +739,10 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	// settings 中的管理密钥不会被请求体脱敏，审计记录使用隐藏密钥后的渠道
+	auditAfter := *addChannelRequest.Channel
+	auditAfter.MaskBalanceAdminKey()
+	model.AuditAfter(c, &auditAfter)
 
 	addChannelRequest.Channel.CreatedTime = common.GetTimestamp()
 	keys := make([]string, 0)
@@ -804,6 +829,9 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if originChannel, err := model.GetChannelById(id, true); err == nil {
+		model.AuditBefore(c, originChannel)
+	}
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -974,8 +1002,10 @@ func DeleteChannelBatch(c *gin.Context) {
 
 type PatchChannel struct {
 	model.Channel
-	MultiKeyMode *string `json:"multi_key_mode"`
-	KeyMode      *string `json:"key_mode"` // 多key模式下密钥覆盖或者追加
+	MultiKeyMode           *string                      `json:"multi_key_mode"`
+	MultiKeyBudget         *model.MultiKeyBudget        `json:"multi_key_budget"`
+	MultiKeyBudgetOverride map[int]model.MultiKeyBudget `json:"multi_key_budget_override"` // 为 nil 时保持不变
+	KeyMode                *string                      `json:"key_mode"`                  // 多key模式下密钥覆盖或者追加
 }
 
 func UpdateChannel(c *gin.Context) {
@@ -1004,6 +1034,15 @@ func UpdateChannel(c *gin.Context) {
 		return
 	}
 
+	auditBefore := *originChannel
+	auditBefore.MaskBalanceAdminKey()
+	model.AuditBefore(c, &auditBefore)
+	channel.KeepBalanceAdminKey(originChannel)
+	// settings 中的管理密钥不会被请求体脱敏，审计记录使用隐藏密钥后的渠道
+	auditAfter := channel.Channel
+	auditAfter.MaskBalanceAdminKey()
+	model.AuditAfter(c, &auditAfter)
+
 	// Always copy the original ChannelInfo so that fields like IsMultiKey and MultiKeySize are retained.
 	channel.ChannelInfo = originChannel.ChannelInfo
 
@@ -1011,6 +1050,12 @@ func UpdateChannel(c *gin.Context) {
 	if channel.MultiKeyMode != nil && *channel.MultiKeyMode != "" {
 		channel.ChannelInfo.MultiKeyMode = constant.MultiKeyMode(*channel.MultiKeyMode)
 	}
+	if channel.MultiKeyBudget != nil {
+		channel.ChannelInfo.MultiKeyBudget = *channel.MultiKeyBudget
+	}
+	if channel.MultiKeyBudgetOverride != nil {
+		channel.ChannelInfo.MultiKeyBudgetOverride = channel.MultiKeyBudgetOverride
+	}
 
 	// 处理多key模式下的密钥追加/覆盖逻辑
 	if channel.KeyMode != nil && channel.ChannelInfo.IsMultiKey {
@@ -1019,22 +1064,8 @@ func UpdateChannel(c *gin.Context) {
 			// 追加模式：将新密钥添加到现有密钥列表
 			if originChannel.Key != "" {
 				var newKeys []string
-				var existingKeys []string
-
-				// 解析现有密钥
-				if strings.HasPrefix(strings.TrimSpace(originChannel.Key), "[") {
-					// JSON数组格式
-					var arr []json.RawMessage
-					if err := json.Unmarshal([]byte(strings.TrimSpace(originChannel.Key)), &arr); err == nil {
-						existingKeys = make([]string, len(arr))
-						for i, v := range arr {
-							existingKeys[i] = string(v)
-						}
-					}
-				} else {
-					// 换行分隔格式
-					existingKeys = strings.Split(strings.Trim(originChannel.Key, "\n"), "\n")
-				}
+				// 解析现有密钥（JSON数组或换行分隔，加密存储时先解密）
+				existingKeys := originChannel.GetKeys()
 
 				// 处理 Vertex AI 的特殊情况
 				if channel.Type == constant.ChannelTypeVertexAi && channel.GetOtherSettings().VertexKeyType != dto.VertexKeyTypeAPIKey {
@@ -1370,11 +1401,12 @@ type MultiKeyStatusResponse struct {
 }
 
 type KeyStatus struct {
-	Index        int    `json:"index"`
-	Status       int    `json:"status"` // 1: enabled, 2: disabled
-	DisabledTime int64  `json:"disabled_time,omitempty"`
-	Reason       string `json:"reason,omitempty"`
-	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	Index        int                   `json:"index"`
+	Status       int                   `json:"status"` // 1: enabled, 2: disabled
+	DisabledTime int64                 `json:"disabled_time,omitempty"`
+	Reason       string                `json:"reason,omitempty"`
+	KeyPreview   string                `json:"key_preview"` // first 10 chars of key for identification
+	Usage        model.ChannelKeyUsage `json:"usage"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1410,6 +1442,7 @@ func ManageMultiKeys(c *gin.Context) {
 	switch request.Action {
 	case "get_key_status":
 		keys := channel.GetKeys()
+		usages := model.GetChannelKeyUsages(channel.Id, keys)
 
 		// Default pagination parameters
 		page := request.Page
@@ -1468,6 +1501,7 @@ func ManageMultiKeys(c *gin.Context) {
 				DisabledTime: disabledTime,
 				Reason:       reason,
 				KeyPreview:   keyPreview,
+				Usage:        usages[i],
 			})
 		}
 
@@ -1701,6 +1735,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newBudgetOverride = make(map[int]model.MultiKeyBudget)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1710,6 +1745,9 @@ func ManageMultiKeys(c *gin.Context) {
 			}
 
 			remainingKeys = append(remainingKeys, key)
+			if budget, exists := channel.ChannelInfo.MultiKeyBudgetOverride[i]; exists {
+				newBudgetOverride[newIndex] = budget
+			}
 
 			// 保留其他密钥的状态信息，重新索引
 			if channel.ChannelInfo.MultiKeyStatusList != nil {
@@ -1744,6 +1782,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyBudgetOverride = newBudgetOverride
 
 		err = channel.Update()
 		if err != nil {
@@ -1765,6 +1804,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var newBudgetOverride = make(map[int]model.MultiKeyBudget)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1780,6 +1820,9 @@ func ManageMultiKeys(c *gin.Context) {
 				deletedCount++
 			} else {
 				remainingKeys = append(remainingKeys, key)
+				if budget, exists := channel.ChannelInfo.MultiKeyBudgetOverride[i]; exists {
+					newBudgetOverride[newIndex] = budget
+				}
 				// 保留非自动禁用密钥的状态信息，重新索引
 				if status != 1 {
 					newStatusList[newIndex] = status
@@ -1812,6 +1855,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.MultiKeyBudgetOverride = newBudgetOverride
 
 		err = channel.Update()
 		if err != nil {
@@ -1883,7 +1927,7 @@ func OllamaPullModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	err = ollama.PullOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1952,7 +1996,7 @@ func OllamaPullModelStream(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 
 	// 创建进度回调函数
 	progressCallback := func(progress ollama.OllamaPullResponse) {
@@ -2028,7 +2072,7 @@ func OllamaDeleteModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	err = ollama.DeleteOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -2077,7 +2121,7 @@ func OllamaVersion(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	version, err := ollama.FetchOllamaVersion(baseURL, key)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
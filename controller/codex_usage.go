@@ -43,7 +43,12 @@ func GetCodexChannelUsage(c *gin.Context) {
 		return
 	}
 
-	oauthKey, err := codex.ParseOAuthKey(strings.TrimSpace(ch.Key))
+	plainKey, err := ch.GetPlainKey()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	oauthKey, err := codex.ParseOAuthKey(strings.TrimSpace(plainKey))
 	if err != nil {
 		common.SysError("failed to parse oauth key: " + err.Error())
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "解析凭证失败，请检查渠道配置"})
@@ -92,7 +97,7 @@ func GetCodexChannelUsage(c *gin.Context) {
 
 			encoded, encErr := common.Marshal(oauthKey)
 			if encErr == nil {
-				_ = model.DB.Model(&model.Channel{}).Where("id = ?", ch.Id).Update("key", string(encoded)).Error
+				_ = model.UpdateChannelKey(ch.Id, string(encoded))
 				model.InitChannelCache()
 				service.ResetProxyClientCache()
 			}
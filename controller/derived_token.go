@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateDerivedTokenRequest struct {
+	ExpiresIn int64    `json:"expires_in"` // 有效期秒数，默认 10 分钟
+	Models    []string `json:"models"`
+	Scopes    []string `json:"scopes"`
+	Quota     int      `json:"quota"` // 软上限，已用尽后拒绝新请求，但进行中的请求可能使消耗略超出
+}
+
+func derivedTokenError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": types.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    "derived_token_error",
+		},
+	})
+}
+
+// getDerivingParentToken 当前请求的令牌作为父令牌，派生令牌不能继续签发或吊销
+func getDerivingParentToken(c *gin.Context) (*model.Token, bool) {
+	if common.GetContextKeyString(c, constant.ContextKeyDerivedTokenId) != "" {
+		derivedTokenError(c, http.StatusForbidden, "派生令牌不能签发或吊销其他令牌")
+		return nil, false
+	}
+	token, err := model.GetTokenByKeyHash(c.GetString("token_key"), true)
+	if err != nil {
+		derivedTokenError(c, http.StatusUnauthorized, "无效的令牌")
+		return nil, false
+	}
+	return token, true
+}
+
+// CreateDerivedToken 使用当前令牌签发短期派生令牌，供浏览器、移动端等不可信环境直接调用
+func CreateDerivedToken(c *gin.Context) {
+	parent, ok := getDerivingParentToken(c)
+	if !ok {
+		return
+	}
+	var req CreateDerivedTokenRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil && !errors.Is(err, io.EOF) {
+		derivedTokenError(c, http.StatusBadRequest, "无效的请求")
+		return
+	}
+	claims := &model.DerivedTokenClaims{
+		Models: req.Models,
+		Scopes: req.Scopes,
+		Quota:  req.Quota,
+	}
+	key, err := model.IssueDerivedToken(parent, claims, req.ExpiresIn)
+	if err != nil {
+		derivedTokenError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":     "derived_token",
+		"token":      key,
+		"parent_id":  parent.Id,
+		"expires_at": claims.ExpiresAt,
+		"models":     claims.Models,
+		"scopes":     claims.Scopes,
+		"quota":      claims.Quota,
+	})
+}
+
+// RevokeDerivedTokens 使用父令牌吊销其签发的全部派生令牌
+func RevokeDerivedTokens(c *gin.Context) {
+	parent, ok := getDerivingParentToken(c)
+	if !ok {
+		return
+	}
+	if err := parent.RevokeDerivedTokens(); err != nil {
+		derivedTokenError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":     "derived_token.revoked",
+		"parent_id":  parent.Id,
+		"revoked_at": parent.DerivedRevokedAt,
+	})
+}
+
+// RevokeTokenDerivedTokens 在控制台吊销指定令牌签发的全部派生令牌
+func RevokeTokenDerivedTokens(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.RevokeDerivedTokens(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"revoked_at": token.DerivedRevokedAt,
+	})
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/gin-gonic/gin"
+)
+
+type DisplayCurrencyRequest struct {
+	Currency string `json:"currency"`
+}
+
+// GetSelfCurrency 当前展示货币与可选货币
+func GetSelfCurrency(c *gin.Context) {
+	common.ApiSuccess(c, gin.H{
+		"currency":   model.GetUserCurrencyInfo(c.GetInt("id")),
+		"currencies": model.GetEnabledCurrencies(),
+	})
+}
+
+// UpdateSelfCurrency 设置展示货币，留空恢复站点默认
+func UpdateSelfCurrency(c *gin.Context) {
+	var req DisplayCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	currency := model.NormalizeCurrency(req.Currency)
+	if currency != "" {
+		if _, ok := model.GetCurrencyInfo(currency); !ok {
+			common.ApiErrorMsg(c, "不支持的货币")
+			return
+		}
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setting := user.GetSetting()
+	setting.DisplayCurrency = currency
+	user.SetSetting(setting)
+	if err := user.Update(false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.GetUserCurrencyInfo(user.Id))
+}
+
+// ---- Admin APIs ----
+
+func AdminListExchangeRates(c *gin.Context) {
+	rates, err := model.GetAllExchangeRates()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, rates)
+}
+
+func AdminCreateExchangeRate(c *gin.Context) {
+	var rate model.ExchangeRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := rate.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rate.Id = 0
+	if err := rate.Insert(); err != nil {
+		common.ApiErrorMsg(c, "该货币已存在")
+		return
+	}
+	common.ApiSuccess(c, rate)
+}
+
+func AdminUpdateExchangeRate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	var rate model.ExchangeRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := rate.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rate.Id = id
+	if err := rate.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminDeleteExchangeRate(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	if err := model.DeleteExchangeRateById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// AdminRefreshExchangeRates 立即从汇率源更新非手动覆盖的币种
+func AdminRefreshExchangeRates(c *gin.Context) {
+	updated, err := service.RefreshExchangeRates(c.Request.Context())
+	if err != nil {
+		common.ApiErrorMsg(c, "更新汇率失败: "+err.Error())
+		return
+	}
+	common.ApiSuccess(c, gin.H{"updated": updated})
+}
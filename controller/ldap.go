@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"gorm.io/gorm"
+)
+
+// ldapAuthenticate 目录服务认证入口，测试中替换为桩实现
+var ldapAuthenticate = service.LDAPAuthenticate
+
+// authenticateLDAPUser 在密码登录时先尝试 LDAP 认证，成功后按 LDAP 信息创建或同步用户。
+// LDAP 中不存在该用户、密码错误、服务不可用，或用户尚未开通且不允许自动创建时返回 nil, nil，
+// 由调用方继续校验本地密码
+func authenticateLDAPUser(username string, password string) (*model.User, error) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled {
+		return nil, nil
+	}
+	identity, err := ldapAuthenticate(username, password)
+	if err != nil {
+		if !errors.Is(err, service.ErrLDAPUserNotFound) && !errors.Is(err, service.ErrLDAPInvalidCredentials) {
+			common.SysError("LDAP authentication failed: " + err.Error())
+		}
+		return nil, nil
+	}
+
+	group := system_setting.ResolveLDAPGroup(identity.Groups)
+	isAdmin, syncRole := system_setting.ResolveLDAPAdmin(identity.Groups)
+	user, err := model.GetUserByLdapId(identity.Username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !settings.AutoCreateUser || !common.RegisterEnabled {
+			return nil, nil
+		}
+		user = &model.User{
+			LdapId:      identity.Username,
+			Email:       identity.Email,
+			DisplayName: model.TruncateSsoField(identity.DisplayName, 20),
+			Group:       group,
+		}
+		if err := model.CreateLdapUser(user); err != nil {
+			return nil, err
+		}
+		if syncRole && isAdmin {
+			if err := model.UpdateSsoUserFields(user, map[string]any{"role": common.RoleAdminUser}); err != nil {
+				return nil, err
+			}
+		}
+		return model.GetUserById(user.Id, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 每次登录按 LDAP 同步分组、角色与基本信息
+	updates := map[string]any{}
+	if group != "" && group != user.Group {
+		updates["group"] = group
+	}
+	if syncRole && user.Role != common.RoleRootUser {
+		role := common.RoleCommonUser
+		if isAdmin {
+			role = common.RoleAdminUser
+		}
+		if role != user.Role {
+			updates["role"] = role
+		}
+	}
+	if identity.Email != "" && identity.Email != user.Email && len(identity.Email) <= 50 {
+		updates["email"] = identity.Email
+	}
+	if displayName := model.TruncateSsoField(identity.DisplayName, 20); displayName != "" && displayName != user.DisplayName {
+		updates["display_name"] = displayName
+	}
+	if err := model.UpdateSsoUserFields(user, updates); err != nil {
+		return nil, err
+	}
+	user, err = model.GetUserById(user.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != common.UserStatusEnabled {
+		return nil, errors.New("用户已被封禁")
+	}
+	return user, nil
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// setupLDAPTest 启用 LDAP 并用桩实现替换目录服务，结束后恢复全局设置
+func setupLDAPTest(t *testing.T, identity *service.LDAPIdentity, authErr error) *system_setting.LDAPSettings {
+	t.Helper()
+	settings := system_setting.GetLDAPSettings()
+	old := *settings
+	oldAuthenticate := ldapAuthenticate
+	oldRegisterEnabled := common.RegisterEnabled
+	t.Cleanup(func() {
+		*settings = old
+		ldapAuthenticate = oldAuthenticate
+		common.RegisterEnabled = oldRegisterEnabled
+	})
+	settings.Enabled = true
+	settings.AutoCreateUser = true
+	settings.GroupMappings = []system_setting.SSOGroupMapping{{IdPGroup: "engineering", Group: "vip"}}
+	settings.DefaultGroup = "default"
+	settings.AdminGroups = []string{"admins"}
+	common.RegisterEnabled = true
+	ldapAuthenticate = func(string, string) (*service.LDAPIdentity, error) {
+		return identity, authErr
+	}
+	return settings
+}
+
+func newLDAPIdentity() *service.LDAPIdentity {
+	name := "ldap_" + common.GetRandomString(8)
+	return &service.LDAPIdentity{
+		Username:    name,
+		DN:          "uid=" + name + ",ou=people,dc=example,dc=com",
+		Email:       name + "@example.com",
+		DisplayName: "LDAP User",
+	}
+}
+
+func TestAuthenticateLDAPUserFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		prepare func(settings *system_setting.LDAPSettings)
+	}{
+		{name: "ldap disabled", prepare: func(settings *system_setting.LDAPSettings) { settings.Enabled = false }},
+		{name: "user not found", err: service.ErrLDAPUserNotFound},
+		{name: "invalid credentials", err: service.ErrLDAPInvalidCredentials},
+		{name: "directory unavailable", err: errors.New("dial tcp: connection refused")},
+		{name: "auto create disabled", prepare: func(settings *system_setting.LDAPSettings) { settings.AutoCreateUser = false }},
+		{name: "registration disabled", prepare: func(*system_setting.LDAPSettings) { common.RegisterEnabled = false }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := newLDAPIdentity()
+			settings := setupLDAPTest(t, identity, tt.err)
+			if tt.prepare != nil {
+				tt.prepare(settings)
+			}
+			user, err := authenticateLDAPUser(identity.Username, "secret")
+			if err != nil || user != nil {
+				t.Fatalf("expected fallback to local password, got %v, %v", user, err)
+			}
+			// 回退时不应创建用户
+			if _, err := model.GetUserByLdapId(identity.Username); err == nil {
+				t.Fatal("expected no user to be created")
+			}
+		})
+	}
+}
+
+func TestAuthenticateLDAPUserAutoCreate(t *testing.T) {
+	identity := newLDAPIdentity()
+	identity.Groups = []string{"cn=Engineering,ou=groups,dc=example,dc=com", "cn=Admins,ou=groups,dc=example,dc=com"}
+	setupLDAPTest(t, identity, nil)
+
+	user, err := authenticateLDAPUser(identity.Username, "secret")
+	if err != nil || user == nil {
+		t.Fatalf("authenticateLDAPUser: %v, %v", user, err)
+	}
+	if user.LdapId != identity.Username || user.Email != identity.Email || user.DisplayName != identity.DisplayName {
+		t.Fatalf("unexpected user fields %+v", user)
+	}
+	if user.Group != "vip" || user.Role != common.RoleAdminUser {
+		t.Fatalf("expected vip admin, got group %q role %d", user.Group, user.Role)
+	}
+
+	// 再次登录复用同一用户
+	again, err := authenticateLDAPUser(identity.Username, "secret")
+	if err != nil || again == nil || again.Id != user.Id {
+		t.Fatalf("expected existing user to be reused, got %v, %v", again, err)
+	}
+}
+
+func TestAuthenticateLDAPUserSync(t *testing.T) {
+	identity := newLDAPIdentity()
+	settings := setupLDAPTest(t, identity, nil)
+	user, err := authenticateLDAPUser(identity.Username, "secret")
+	if err != nil || user == nil {
+		t.Fatalf("authenticateLDAPUser: %v, %v", user, err)
+	}
+	if user.Group != "default" || user.Role != common.RoleCommonUser {
+		t.Fatalf("expected default common user, got group %q role %d", user.Group, user.Role)
+	}
+
+	// 加入映射组与管理员组后下次登录同步
+	identity.Groups = []string{"cn=engineering", "cn=admins"}
+	identity.Email = "changed@example.com"
+	identity.DisplayName = "Changed"
+	user, err = authenticateLDAPUser(identity.Username, "secret")
+	if err != nil {
+		t.Fatalf("authenticateLDAPUser: %v", err)
+	}
+	if user.Group != "vip" || user.Role != common.RoleAdminUser || user.Email != "changed@example.com" || user.DisplayName != "Changed" {
+		t.Fatalf("expected synced fields, got %+v", user)
+	}
+
+	// 离开管理员组后降级
+	identity.Groups = []string{"cn=engineering"}
+	if user, err = authenticateLDAPUser(identity.Username, "secret"); err != nil || user.Role != common.RoleCommonUser {
+		t.Fatalf("expected role to be downgraded, got %v, %v", user, err)
+	}
+
+	// 未配置管理员组时不修改角色，超级管理员不受同步影响
+	settings.AdminGroups = nil
+	if err := model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("role", common.RoleAdminUser).Error; err != nil {
+		t.Fatalf("failed to update role: %v", err)
+	}
+	if user, err = authenticateLDAPUser(identity.Username, "secret"); err != nil || user.Role != common.RoleAdminUser {
+		t.Fatalf("expected role to be kept, got %v, %v", user, err)
+	}
+	settings.AdminGroups = []string{"admins"}
+	if err := model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("role", common.RoleRootUser).Error; err != nil {
+		t.Fatalf("failed to update role: %v", err)
+	}
+	if user, err = authenticateLDAPUser(identity.Username, "secret"); err != nil || user.Role != common.RoleRootUser {
+		t.Fatalf("expected root role to be kept, got %v, %v", user, err)
+	}
+
+	// 被封禁的用户无法通过 LDAP 登录
+	if err := model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("status", common.UserStatusDisabled).Error; err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	if _, err = authenticateLDAPUser(identity.Username, "secret"); err == nil {
+		t.Fatal("expected disabled user to be rejected")
+	}
+}
+
+func TestLoginFallsBackToLocalPassword(t *testing.T) {
+	settings := setupLDAPTest(t, nil, service.ErrLDAPUserNotFound)
+	settings.AutoCreateUser = false
+	oldPasswordLogin := common.PasswordLoginEnabled
+	common.PasswordLoginEnabled = true
+	t.Cleanup(func() { common.PasswordLoginEnabled = oldPasswordLogin })
+
+	hashed, err := common.Password2Hash("local-password")
+	if err != nil {
+		t.Fatalf("Password2Hash: %v", err)
+	}
+	user := createTestUser(t, 0)
+	if err := model.DB.Model(user).Update("password", hashed).Error; err != nil {
+		t.Fatalf("failed to update password: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret"))))
+	r.POST("/login", Login)
+	login := func(password string) bool {
+		body, _ := json.Marshal(LoginRequest{Username: user.Username, Password: password})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(string(body))))
+		var resp struct {
+			Success bool `json:"success"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+		}
+		return resp.Success
+	}
+
+	// LDAP 中不存在或尚未开通的用户继续使用本地密码
+	if !login("local-password") {
+		t.Fatal("expected local password login to succeed")
+	}
+	if login("wrong-password") {
+		t.Fatal("expected wrong local password to be rejected")
+	}
+	ldapAuthenticate = func(string, string) (*service.LDAPIdentity, error) {
+		return &service.LDAPIdentity{Username: user.Username}, nil
+	}
+	if !login("local-password") {
+		t.Fatal("expected unprovisioned ldap user to fall back to local password")
+	}
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseLedgerQuery(c *gin.Context) model.LedgerQueryParams {
+	accountId, _ := strconv.Atoi(c.Query("account_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.LedgerQueryParams{
+		AccountType:    c.Query("account_type"),
+		AccountId:      accountId,
+		Source:         c.Query("source"),
+		ReferenceId:    c.Query("reference_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+// GetLedgerEntries 管理员按账户、来源与时间查询额度账本
+func GetLedgerEntries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	entries, total, err := model.GetLedgerEntries(parseLedgerQuery(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(entries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfLedgerEntries 当前用户查询自己的额度账本
+func GetSelfLedgerEntries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	params := parseLedgerQuery(c)
+	params.AccountType = model.LedgerAccountUser
+	params.AccountId = c.GetInt("id")
+	entries, total, err := model.GetLedgerEntries(params, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(entries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ReconcileLedger 立即执行一次对账，返回余额与账本不一致的账户
+func ReconcileLedger(c *gin.Context) {
+	drifts, err := service.RunLedgerReconcile()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, drifts)
+}
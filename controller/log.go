@@ -26,6 +26,7 @@ func GetAllLogs(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillLogDisplayAmounts(logs, model.GetUserCurrencyInfo(c.GetInt("id")))
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(logs)
 	common.ApiSuccess(c, pageInfo)
@@ -47,6 +48,7 @@ func GetUserLogs(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillLogDisplayAmounts(logs, model.GetUserCurrencyInfo(c.GetInt("id")))
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(logs)
 	common.ApiSuccess(c, pageInfo)
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseLogExportFilter(c *gin.Context) model.LogExportFilter {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	return model.LogExportFilter{
+		LogType:        logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		Username:       c.Query("username"),
+		TokenName:      c.Query("token_name"),
+		Channel:        channel,
+		Group:          c.Query("group"),
+		RequestId:      c.Query("request_id"),
+	}
+}
+
+// streamLogExport 以流式响应导出日志，响应头发出后出错只能记录日志并中断
+func streamLogExport(c *gin.Context, filter model.LogExportFilter, admin bool) {
+	format := c.DefaultQuery("format", service.LogExportFormatCSV)
+	if !service.IsValidLogExportFormat(format) {
+		common.ApiErrorMsg(c, "不支持的导出格式: "+format)
+		return
+	}
+	fileName := fmt.Sprintf("logs-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Type", service.LogExportContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("Cache-Control", "no-cache")
+	rows, err := service.WriteLogExport(c.Writer, format, filter, admin, c.Writer.Flush)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("log export interrupted after %d rows: %s", rows, err.Error()))
+		_ = c.Error(err)
+	}
+}
+
+// ExportAllLogs 管理员按日志列表的筛选条件导出全部日志
+func ExportAllLogs(c *gin.Context) {
+	streamLogExport(c, parseLogExportFilter(c), true)
+}
+
+// ExportUserLogs 用户导出自己的日志
+func ExportUserLogs(c *gin.Context) {
+	filter := parseLogExportFilter(c)
+	filter.UserId = c.GetInt("id")
+	filter.Username = ""
+	filter.Channel = 0
+	streamLogExport(c, filter, false)
+}
+
+func GetLogExportRuns(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	runs, total, err := model.GetLogExportRuns(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(runs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RunLogExport 立即执行一次定时导出
+func RunLogExport(c *gin.Context) {
+	run, err := service.RunScheduledLogExport(c.Request.Context())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, run)
+}
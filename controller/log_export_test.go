@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestParseLogExportFilter(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?type=2&start_timestamp=100&end_timestamp=200&model_name=gpt-4o&username=bob&token_name=t1&channel=3&group=vip&request_id=req-1", nil)
+	got := parseLogExportFilter(c)
+	want := model.LogExportFilter{
+		LogType: 2, StartTimestamp: 100, EndTimestamp: 200, ModelName: "gpt-4o",
+		Username: "bob", TokenName: "t1", Channel: 3, Group: "vip", RequestId: "req-1",
+	}
+	if got != want {
+		t.Fatalf("parseLogExportFilter = %+v, want %+v", got, want)
+	}
+}
+
+func TestExportUserLogs(t *testing.T) {
+	if err := model.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.Log{}).Error; err != nil {
+		t.Fatalf("failed to reset logs: %v", err)
+	}
+	for _, log := range []*model.Log{
+		{UserId: 1, Username: "alice", Type: model.LogTypeConsume, ChannelId: 7, ModelName: "gpt-4o"},
+		{UserId: 2, Username: "bob", Type: model.LogTypeConsume, ChannelId: 7, ModelName: "gpt-4o"},
+	} {
+		if err := model.LOG_DB.Create(log).Error; err != nil {
+			t.Fatalf("failed to create log: %v", err)
+		}
+	}
+
+	// 用户导出忽略用户名与渠道条件，只导出自己的日志
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?username=bob&channel=7", nil)
+	c.Set("id", 1)
+	ExportUserLogs(c)
+
+	if ct := recorder.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	if cd := recorder.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="logs-`) {
+		t.Fatalf("unexpected content disposition %s", cd)
+	}
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	if len(records) != 2 || records[1][4] != "alice" || len(records[0]) != len(records[1]) {
+		t.Fatalf("unexpected export %v", records)
+	}
+	for _, column := range records[0] {
+		if column == "channel_id" || column == "ip" {
+			t.Fatalf("user export should not include %s", column)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/?format=xlsx", nil)
+	c.Set("id", 1)
+	ExportUserLogs(c)
+	if !strings.Contains(recorder.Body.String(), `"success":false`) {
+		t.Fatalf("expected unsupported format error, got %s", recorder.Body.String())
+	}
+}
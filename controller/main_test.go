@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用临时 SQLite 数据库运行 controller 包中依赖数据库的测试
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	dir, err := os.MkdirTemp("", "uniapi-controller-test")
+	if err != nil {
+		fmt.Println("failed to create test directory: " + err.Error())
+		os.Exit(1)
+	}
+	dsn := filepath.Join(dir, "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	model.DB = db
+	model.LOG_DB = db
+	if err = db.AutoMigrate(&model.User{}, &model.Task{}, &model.Log{}, &model.QuotaLedger{},
+		&model.Organization{}, &model.Project{}, &model.ScimGroup{}, &model.ScimGroupMember{},
+		&model.TwoFA{}, &model.Channel{}, &model.Token{}, &model.ExchangeRate{}); err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// createTestUser 创建一个带有指定额度的测试用户
+func createTestUser(t *testing.T, quota int) *model.User {
+	t.Helper()
+	user := &model.User{
+		Username: "test_" + common.GetRandomString(12),
+		AffCode:  common.GetRandomString(16),
+		Password: "password123",
+		Quota:    quota,
+		Status:   common.UserStatusEnabled,
+		Role:     common.RoleCommonUser,
+	}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func getTestUserQuota(t *testing.T, userId int) int {
+	t.Helper()
+	var user model.User
+	if err := model.DB.Select("quota").First(&user, "id = ?", userId).Error; err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	return user.Quota
+}
@@ -77,6 +77,11 @@ func UpdateMidjourneyTaskBulk() {
 				}
 				continue
 			}
+			midjourneyKey, err := midjourneyChannel.GetPlainKey()
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("GetPlainKey: %v", err))
+				continue
+			}
 			requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", *midjourneyChannel.BaseURL)
 
 			body, _ := json.Marshal(map[string]any{
@@ -93,7 +98,7 @@ func UpdateMidjourneyTaskBulk() {
 			// 使用带有超时的 context 创建新的请求
 			req = req.WithContext(ctx)
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+			req.Header.Set("mj-api-secret", midjourneyKey)
 			resp, err := service.GetHttpClient().Do(req)
 			if err != nil {
 				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
@@ -177,7 +182,7 @@ func UpdateMidjourneyTaskBulk() {
 					logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
 				} else {
 					if shouldReturnQuota {
-						err = model.IncreaseUserQuota(task.UserId, task.Quota, false)
+						err = task.RefundQuota(task.Quota)
 						if err != nil {
 							logger.LogError(ctx, "fail to increase user quota: "+err.Error())
 						}
@@ -25,7 +25,10 @@ func GetOptions(c *gin.Context) {
 			strings.HasSuffix(k, "Secret") ||
 			strings.HasSuffix(k, "Key") ||
 			strings.HasSuffix(k, "secret") ||
-			strings.HasSuffix(k, "api_key") {
+			strings.HasSuffix(k, "api_key") ||
+			strings.HasSuffix(k, "private_key") ||
+			strings.HasSuffix(k, "bearer_token") ||
+			strings.HasSuffix(k, "bind_password") {
 			continue
 		}
 		options = append(options, &model.Option{
@@ -68,6 +71,13 @@ func UpdateOption(c *gin.Context) {
 		option.Value = fmt.Sprintf("%v", option.Value)
 	}
 	switch option.Key {
+	case model.TokenHashSecretOptionKey:
+		// 修改后所有令牌将无法验证
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "令牌哈希盐不允许修改",
+		})
+		return
 	case "GitHubOAuthEnabled":
 		if option.Value == "true" && common.GitHubClientId == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -178,6 +188,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "VideoPrice":
+		err = ratio_setting.UpdateVideoPriceByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "视频价格设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "MjModeRatio":
+		err = setting.UpdateMjModeRatioByJSONString(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "MJ 模式倍率设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value.(string))
 		if err != nil {
@@ -242,6 +270,13 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	common.OptionMapRWMutex.RLock()
+	oldValue := common.OptionMap[option.Key]
+	common.OptionMapRWMutex.RUnlock()
+	// 以配置项名称为字段记录快照，Token/Secret/Key 结尾的配置会被脱敏
+	model.AuditTarget(c, "option", option.Key)
+	model.AuditBefore(c, map[string]string{option.Key: oldValue})
+	model.AuditAfter(c, map[string]string{option.Key: option.Value.(string)})
 	err = model.UpdateOption(option.Key, option.Value.(string))
 	if err != nil {
 		common.ApiError(c, err)
@@ -0,0 +1,491 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/i18n"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationRequest struct {
+	Name string `json:"name"`
+}
+
+type OrganizationMemberRequest struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type OrganizationTransferRequest struct {
+	Quota int `json:"quota"`
+}
+
+type AdminOrganizationSubscriptionRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+type AdminOrganizationRequest struct {
+	Status *int `json:"status"`
+	// 余额调整量，正数增加、负数扣减
+	QuotaDelta int `json:"quota_delta"`
+}
+
+// requireOrgRole 校验当前用户在组织中的角色不低于 required，站点管理员视为组织所有者
+func requireOrgRole(c *gin.Context, required string) (*model.Organization, string, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return nil, "", false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiErrorMsg(c, "组织不存在")
+		return nil, "", false
+	}
+	if c.GetInt("role") >= common.RoleAdminUser && model.UserHasPermission(c.GetInt("id"), c.GetInt("role"), constant.PermissionOrganizationsManage) {
+		return org, common.OrgRoleOwner, true
+	}
+	member, err := model.GetOrganizationMember(org.Id, c.GetInt("id"))
+	if err != nil || !model.OrgRoleAtLeast(member.Role, required) {
+		common.ApiErrorMsg(c, "无权执行此操作")
+		return nil, "", false
+	}
+	return org, member.Role, true
+}
+
+func validateOrganizationName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > 64 {
+		return errors.New("名称过长")
+	}
+	return nil
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateOrganizationName(req.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.CreateOrganization(strings.TrimSpace(req.Name), c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	org, role, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	org.Role = role
+	common.ApiSuccess(c, org)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateOrganizationName(req.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Name = strings.TrimSpace(req.Name)
+	if err := org.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+// TransferQuotaToOrganization 成员将个人余额转入组织钱包
+func TransferQuotaToOrganization(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	var req OrganizationTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	if err := model.TransferUserQuotaToOrganization(userId, org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("向组织 %s(#%d) 转入额度 %s", org.Name, org.Id, logger.LogQuota(req.Quota)))
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, role, ok := requireOrgRole(c, common.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 只有所有者可以授予管理员角色
+	if req.Role == common.OrgRoleAdmin && role != common.OrgRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以添加管理员")
+		return
+	}
+	userId := req.UserId
+	if userId == 0 && req.Username != "" {
+		id, err := model.GetUserIdByUsername(req.Username)
+		if err != nil {
+			common.ApiErrorMsg(c, "用户不存在")
+			return
+		}
+		userId = id
+	}
+	if userId == 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	member, err := model.AddOrganizationMember(org.Id, userId, req.Role)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, role, ok := requireOrgRole(c, common.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if role != common.OrgRoleOwner {
+		target, err := model.GetOrganizationMember(org.Id, userId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if req.Role == common.OrgRoleAdmin || target.Role == common.OrgRoleAdmin {
+			common.ApiErrorMsg(c, "只有组织所有者可以调整管理员")
+			return
+		}
+	}
+	if err := model.UpdateOrganizationMemberRole(org.Id, userId, req.Role); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func RemoveOrganizationMember(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	// 成员可以自行退出组织，移除他人需要管理员权限
+	required := common.OrgRoleAdmin
+	if userId == c.GetInt("id") {
+		required = common.OrgRoleViewer
+	}
+	org, role, ok := requireOrgRole(c, required)
+	if !ok {
+		return
+	}
+	if userId != c.GetInt("id") && role != common.OrgRoleOwner {
+		target, err := model.GetOrganizationMember(org.Id, userId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if target.Role == common.OrgRoleAdmin {
+			common.ApiErrorMsg(c, "只有组织所有者可以移除管理员")
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(org.Id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationProjects(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	projects, err := model.GetOrganizationProjects(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, projects)
+}
+
+// GetOrganizationSubscriptions 组织持有的订阅，项目令牌优先从有效订阅扣费
+func GetOrganizationSubscriptions(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	subs, err := model.GetAllOrganizationSubscriptions(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subs)
+}
+
+func CreateOrganizationProject(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	var project model.Project
+	if err := c.ShouldBindJSON(&project); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateOrganizationName(project.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if project.Budget < 0 {
+		common.ApiErrorMsg(c, "预算不能为负数")
+		return
+	}
+	cleanProject := model.Project{
+		OrgId:       org.Id,
+		Name:        strings.TrimSpace(project.Name),
+		Budget:      project.Budget,
+		ModelLimits: project.ModelLimits,
+	}
+	if err := model.CreateProject(&cleanProject); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, cleanProject)
+}
+
+func UpdateOrganizationProject(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	projectId, err := strconv.Atoi(c.Param("project_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	project, err := model.GetProjectById(projectId)
+	if err != nil || project.OrgId != org.Id {
+		common.ApiErrorMsg(c, "项目不存在")
+		return
+	}
+	var req model.Project
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateOrganizationName(req.Name); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Budget < 0 {
+		common.ApiErrorMsg(c, "预算不能为负数")
+		return
+	}
+	project.Name = strings.TrimSpace(req.Name)
+	project.Budget = req.Budget
+	project.ModelLimits = req.ModelLimits
+	if req.Status == common.ProjectStatusEnabled || req.Status == common.ProjectStatusDisabled {
+		project.Status = req.Status
+	}
+	if err := project.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, project)
+}
+
+func GetOrganizationLogs(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	projectId, _ := strconv.Atoi(c.Query("project_id"))
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	logs, total, err := model.GetOrganizationLogs(org.Id, projectId, logType, startTimestamp, endTimestamp, c.Query("model_name"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetOrganizationStat(c *gin.Context) {
+	org, _, ok := requireOrgRole(c, common.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	stats, err := model.SumOrganizationQuotaByProject(org.Id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"quota":      org.Quota,
+		"used_quota": org.UsedQuota,
+		"projects":   stats,
+	})
+}
+
+// ========== Admin endpoints ==========
+
+func GetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminUpdateOrganization 管理员启用/禁用组织或调整组织余额
+func AdminUpdateOrganization(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req AdminOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditTarget(c, "organization", org.Id)
+	model.AuditBefore(c, map[string]int{"status": org.Status, "quota": org.Quota})
+	if req.Status != nil {
+		if *req.Status != common.OrganizationStatusEnabled && *req.Status != common.OrganizationStatusDisabled {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+		org.Status = *req.Status
+		if err := org.Update(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if req.QuotaDelta != 0 {
+		if err := model.AdjustOrganizationQuota(org.Id, req.QuotaDelta, model.LedgerRef{
+			Source: model.LedgerSourceAdmin,
+			Remark: fmt.Sprintf("admin %s(#%d)", c.GetString("username"), c.GetInt("id")),
+		}); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(org.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员调整组织 %s(#%d) 余额 %s",
+			org.Name, org.Id, logger.LogQuota(req.QuotaDelta)))
+	}
+	model.AuditAfter(c, map[string]int{"status": org.Status, "quota": org.Quota + req.QuotaDelta})
+	common.ApiSuccess(c, nil)
+}
+
+// AdminBindOrganizationSubscription 管理员为组织开通订阅套餐
+func AdminBindOrganizationSubscription(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return
+	}
+	var req AdminOrganizationSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	model.AuditTarget(c, "organization", orgId)
+	if subscriptions, err := model.GetAllOrganizationSubscriptions(orgId); err == nil {
+		model.AuditBefore(c, map[string]any{"subscriptions": subscriptions})
+	}
+	if err := model.AdminBindOrganizationSubscription(orgId, req.PlanId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if subscriptions, err := model.GetAllOrganizationSubscriptions(orgId); err == nil {
+		model.AuditAfter(c, map[string]any{"subscriptions": subscriptions})
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+type PaymentPayRequest struct {
+	PaymentMethod string `json:"payment_method"`
+	Amount        int64  `json:"amount"`
+	ProductId     string `json:"product_id"`
+	PackageId     int    `json:"package_id"`
+	PromoCode     string `json:"promo_code"`
+	SuccessURL    string `json:"success_url,omitempty"`
+	CancelURL     string `json:"cancel_url,omitempty"`
+}
+
+type SubscriptionPaymentPayRequest struct {
+	PlanId        int    `json:"plan_id"`
+	PaymentMethod string `json:"payment_method"`
+}
+
+// getEnabledPaymentProvider 按支付方式查找已配置的支付渠道，易支付的子支付方式归到 epay
+func getEnabledPaymentProvider(method string) (string, payment.Provider, error) {
+	name, provider := payment.ResolvePaymentMethod(method)
+	if provider == nil {
+		return "", nil, errors.New("不支持的支付渠道")
+	}
+	if !provider.IsEnabled() {
+		return "", nil, errors.New("当前管理员未配置支付信息")
+	}
+	return name, provider, nil
+}
+
+// quoteTopUp 计算充值订单的数量与金额，渠道未提供定价时使用通用充值价格
+func quoteTopUp(provider payment.Provider, req *payment.TopUpQuoteRequest) (*payment.TopUpQuote, error) {
+	if pricer, ok := provider.(payment.TopUpPricer); ok {
+		return pricer.QuoteTopUp(req)
+	}
+	if req.Amount < getMinTopup() {
+		return nil, fmt.Errorf("充值数量不能小于 %d", getMinTopup())
+	}
+	payMoney := getPayMoney(req.Amount, req.User.Group)
+	if payMoney < 0.01 {
+		return nil, errors.New("充值金额过低")
+	}
+	// 订单中的 Amount 统一为美元数量，入账时再乘以 QuotaPerUnit
+	amount := req.Amount
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		dAmount := decimal.NewFromInt(amount)
+		dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+		amount = dAmount.Div(dQuotaPerUnit).IntPart()
+	}
+	return &payment.TopUpQuote{
+		Money:    payMoney,
+		Amount:   amount,
+		Quantity: req.Amount,
+		Title:    fmt.Sprintf("TUC%d", req.Amount),
+	}, nil
+}
+
+// startTopUpCheckout 先创建待支付订单再拉起支付，拉起失败时关闭订单
+func startTopUpCheckout(c *gin.Context, provider payment.Provider, topUp *model.TopUp, req *payment.CheckoutRequest) (*payment.CheckoutResult, error) {
+	topUp.CreateTime = time.Now().Unix()
+	topUp.Status = common.TopUpStatusPending
+	if topUp.Currency == "" {
+		topUp.Currency = model.NormalizeCurrency(req.Currency)
+	}
+	if err := topUp.Insert(); err != nil {
+		common.SysError("create topup order failed: " + err.Error())
+		return nil, errors.New("创建订单失败")
+	}
+	req.Kind = payment.OrderKindTopUp
+	req.TradeNo = topUp.TradeNo
+	result, err := provider.CreateCheckout(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("拉起%s支付失败: %v, 订单号: %s", provider.GetName(), err, topUp.TradeNo)
+		_ = model.ExpireTopUp(topUp.TradeNo)
+		return nil, errors.New("拉起支付失败")
+	}
+	if result.ProviderOrderId != "" {
+		_ = model.SetTopUpProviderOrderId(topUp.TradeNo, result.ProviderOrderId)
+	}
+	return result, nil
+}
+
+// prepareSubscriptionPurchase 校验套餐是否可购买
+func prepareSubscriptionPurchase(c *gin.Context, planId int) (*model.SubscriptionPlan, *model.User, bool) {
+	plan, err := model.GetSubscriptionPlanById(planId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	if !plan.Enabled {
+		common.ApiErrorMsg(c, "套餐未启用")
+		return nil, nil, false
+	}
+	if !plan.Purchasable {
+		common.ApiErrorMsg(c, "该套餐不支持直接购买，请使用兑换码")
+		return nil, nil, false
+	}
+	userId := c.GetInt("id")
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	if plan.MaxPurchasePerUser > 0 {
+		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
+		if err != nil {
+			common.ApiError(c, err)
+			return nil, nil, false
+		}
+		if count >= int64(plan.MaxPurchasePerUser) {
+			common.ApiErrorMsg(c, "已达到该套餐购买上限")
+			return nil, nil, false
+		}
+	}
+	return plan, user, true
+}
+
+// startSubscriptionCheckout 先创建待支付订阅订单再拉起支付，拉起失败时关闭订单
+func startSubscriptionCheckout(c *gin.Context, provider payment.Provider, order *model.SubscriptionOrder, req *payment.CheckoutRequest) (*payment.CheckoutResult, error) {
+	order.CreateTime = time.Now().Unix()
+	order.Status = common.TopUpStatusPending
+	if err := order.Insert(); err != nil {
+		common.SysError("create subscription order failed: " + err.Error())
+		return nil, errors.New("创建订单失败")
+	}
+	req.Kind = payment.OrderKindSubscription
+	req.TradeNo = order.TradeNo
+	if req.Title == "" {
+		req.Title = fmt.Sprintf("SUB:%s", req.Plan.Title)
+	}
+	if req.Money == 0 {
+		req.Money = order.Money
+	}
+	// 按其他货币原生定价时由渠道以该货币收款
+	if req.Currency == "" && req.Plan.Currency != "" && !strings.EqualFold(req.Plan.Currency, model.CurrencyUSD) {
+		req.Currency = req.Plan.Currency
+	}
+	result, err := provider.CreateCheckout(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("拉起%s支付失败: %v, 订单号: %s", provider.GetName(), err, order.TradeNo)
+		_ = model.ExpireSubscriptionOrder(order.TradeNo)
+		return nil, errors.New("拉起支付失败")
+	}
+	if result.ProviderOrderId != "" {
+		_ = model.SetSubscriptionOrderProviderOrderId(order.TradeNo, result.ProviderOrderId)
+	}
+	return result, nil
+}
+
+// RequestPaymentPay 通用充值下单接口，支持所有已配置的支付渠道
+func RequestPaymentPay(c *gin.Context) {
+	var req PaymentPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.SuccessURL != "" && common.ValidateRedirectURL(req.SuccessURL) != nil {
+		common.ApiErrorMsg(c, "支付成功重定向URL不在可信任域名列表中")
+		return
+	}
+	if req.CancelURL != "" && common.ValidateRedirectURL(req.CancelURL) != nil {
+		common.ApiErrorMsg(c, "支付取消重定向URL不在可信任域名列表中")
+		return
+	}
+	method, provider, err := getEnabledPaymentProvider(req.PaymentMethod)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pkg, amount, err := resolveTopUpPackage(req.PackageId, req.Amount, user.Group)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	quote, err := quoteTopUp(provider, &payment.TopUpQuoteRequest{
+		Amount:    amount,
+		ProductId: req.ProductId,
+		User:      user,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	offer, err := applyTopUpOffers(quote, user, amount, pkg, req.PromoCode)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 易支付订单记录子支付方式，其余记录渠道名
+	orderMethod := method
+	if method == payment.PaymentMethodEpay {
+		orderMethod = req.PaymentMethod
+	}
+	topUp := &model.TopUp{
+		UserId:        userId,
+		Amount:        quote.Amount,
+		Money:         quote.Money,
+		TradeNo:       fmt.Sprintf("USR%dNO%s%d", userId, common.GetRandomString(6), time.Now().Unix()),
+		PaymentMethod: orderMethod,
+	}
+	checkout := &payment.CheckoutRequest{
+		Title:      quote.Title,
+		Money:      quote.Money,
+		Currency:   quote.Currency,
+		Quantity:   quote.Quantity,
+		ProductId:  quote.ProductId,
+		PayType:    req.PaymentMethod,
+		User:       user,
+		SuccessURL: req.SuccessURL,
+		CancelURL:  req.CancelURL,
+	}
+	offer.applyTo(topUp, checkout)
+	result, err := startTopUpCheckout(c, provider, topUp, checkout)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"pay_link": result.PayLink,
+		"params":   result.Params,
+		"order_id": topUp.TradeNo,
+	})
+}
+
+// SubscriptionRequestPayment 通用订阅下单接口
+func SubscriptionRequestPayment(c *gin.Context) {
+	var req SubscriptionPaymentPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	method, provider, err := getEnabledPaymentProvider(req.PaymentMethod)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan, user, ok := prepareSubscriptionPurchase(c, req.PlanId)
+	if !ok {
+		return
+	}
+	plan = localizeSubscriptionPlan(plan, user.Id, method)
+	if plan.PriceAmount < 0.01 {
+		common.ApiErrorMsg(c, "套餐金额过低")
+		return
+	}
+	orderMethod := method
+	if method == payment.PaymentMethodEpay {
+		orderMethod = req.PaymentMethod
+	}
+	order := &model.SubscriptionOrder{
+		UserId:        user.Id,
+		PlanId:        plan.Id,
+		Money:         plan.PriceAmount,
+		Currency:      plan.Currency,
+		TradeNo:       fmt.Sprintf("SUBUSR%dNO%s%d", user.Id, common.GetRandomString(6), time.Now().Unix()),
+		PaymentMethod: orderMethod,
+	}
+	result, err := startSubscriptionCheckout(c, provider, order, &payment.CheckoutRequest{
+		Plan:    plan,
+		PayType: req.PaymentMethod,
+		User:    user,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"pay_link": result.PayLink,
+		"params":   result.Params,
+		"order_id": order.TradeNo,
+	})
+}
+
+// handlePaymentEvent 处理渠道无关的回调事件，重复回调幂等
+func handlePaymentEvent(method string, event *payment.WebhookEvent) error {
+	switch event.Type {
+	case payment.EventPaid:
+		if event.TradeNo == "" {
+			return fmt.Errorf("%w: 未提供支付单号", payment.ErrInvalidWebhook)
+		}
+		LockOrder(event.TradeNo)
+		defer UnlockOrder(event.TradeNo)
+		err := model.CompleteSubscriptionOrder(event.TradeNo, event.Payload, event.ProviderSubscriptionId)
+		if err == nil {
+			if event.ProviderOrderId != "" {
+				_ = model.SetSubscriptionOrderProviderOrderId(event.TradeNo, event.ProviderOrderId)
+			}
+			return nil
+		}
+		if !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+			return err
+		}
+		if model.GetTopUpByTradeNo(event.TradeNo) == nil {
+			// 非本系统创建的订单，忽略避免渠道无限重试
+			log.Printf("%s支付回调未找到订单: %s", method, event.TradeNo)
+			return nil
+		}
+		if err := model.CompleteTopUp(event.TradeNo, model.TopUpCompletion{
+			PaymentMethod: method,
+			CustomerId:    event.CustomerId,
+			CustomerEmail: event.CustomerEmail,
+		}); err != nil {
+			return err
+		}
+		if event.ProviderOrderId != "" {
+			_ = model.SetTopUpProviderOrderId(event.TradeNo, event.ProviderOrderId)
+		}
+		log.Printf("收到款项：%s, %.2f(%s), 支付方式: %s", event.TradeNo, event.Money, event.Currency, method)
+		return nil
+	case payment.EventExpired:
+		if event.TradeNo == "" {
+			return nil
+		}
+		LockOrder(event.TradeNo)
+		defer UnlockOrder(event.TradeNo)
+		err := model.ExpireSubscriptionOrder(event.TradeNo)
+		if err == nil || !errors.Is(err, model.ErrSubscriptionOrderNotFound) {
+			return err
+		}
+		return model.ExpireTopUp(event.TradeNo)
+	case payment.EventRenewalPaid:
+		LockOrder(event.RenewalTradeNo)
+		defer UnlockOrder(event.RenewalTradeNo)
+		sub, err := model.RenewUserSubscriptionByProvider(model.SubscriptionRenewal{
+			ProviderSubscriptionId: event.ProviderSubscriptionId,
+			TradeNo:                event.RenewalTradeNo,
+			PaymentMethod:          method,
+			Money:                  event.Money,
+			Currency:               event.Currency,
+			PeriodEnd:              event.PeriodEnd,
+			ProviderPayload:        event.Payload,
+		})
+		if err != nil {
+			if errors.Is(err, model.ErrUserSubscriptionNotFound) {
+				// 首期扣款可能早于支付完成回调到达，此时订阅尚未创建
+				return nil
+			}
+			return err
+		}
+		if sub != nil {
+			log.Printf("%s订阅续费成功：%s, 用户订阅: %d", method, event.ProviderSubscriptionId, sub.Id)
+		}
+		return nil
+	case payment.EventRenewalFailed:
+		sub, err := model.MarkSubscriptionRenewalFailed(event.ProviderSubscriptionId)
+		if err != nil {
+			if errors.Is(err, model.ErrUserSubscriptionNotFound) {
+				return nil
+			}
+			return err
+		}
+		service.NotifySubscriptionRenewalFailed(sub)
+		return nil
+	case payment.EventRefunded, payment.EventChargeback:
+		if event.TradeNo == "" {
+			return nil
+		}
+		LockOrder(event.TradeNo)
+		defer UnlockOrder(event.TradeNo)
+		req := model.PaymentRefundRequest{
+			TradeNo:          event.TradeNo,
+			TotalRefunded:    event.RefundedTotal,
+			RefundRatio:      event.RefundRatio,
+			Source:           model.PaymentRefundSourceProvider,
+			ProviderRefundId: event.RefundId,
+		}
+		if event.Type == payment.EventChargeback {
+			req.Source = model.PaymentRefundSourceChargeback
+			req.Money = event.Money
+			req.Reason = event.Payload
+		} else if req.TotalRefunded <= 0 && req.RefundRatio <= 0 {
+			if event.Money <= 0 {
+				return nil
+			}
+			req.Money = event.Money
+		}
+		refund, err := model.RecordPaymentRefund(req)
+		if err != nil {
+			if errors.Is(err, model.ErrPaymentOrderNotFound) {
+				log.Printf("%s退款回调未找到订单: %s", method, event.TradeNo)
+				return nil
+			}
+			return err
+		}
+		cancelRefundedSubscriptionRenewal(context.Background(), refund)
+		return nil
+	case payment.EventSubscriptionUpdated:
+		_, err := model.SyncSubscriptionRenewalState(event.ProviderSubscriptionId, event.CancelAtPeriodEnd, event.SubscriptionEnded)
+		if err != nil && !errors.Is(err, model.ErrUserSubscriptionNotFound) {
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+func handlePaymentWebhook(c *gin.Context, method string) {
+	provider := payment.GetProvider(method)
+	if provider == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	event, err := provider.VerifyWebhook(c)
+	if err != nil {
+		log.Printf("%s回调验证失败: %v", provider.GetName(), err)
+		provider.AckWebhook(c, err)
+		return
+	}
+	err = handlePaymentEvent(method, event)
+	if err != nil {
+		log.Printf("%s回调处理失败: %v, 订单号: %s", provider.GetName(), err, event.TradeNo)
+	}
+	provider.AckWebhook(c, err)
+}
+
+// PaymentWebhook 通用支付回调入口 /api/payment/:provider/webhook
+func PaymentWebhook(c *gin.Context) {
+	handlePaymentWebhook(c, c.Param("provider"))
+}
+
+// AdminQueryPaymentOrder 管理员向支付渠道查询订单状态，用于排查掉单
+func AdminQueryPaymentOrder(c *gin.Context) {
+	tradeNo := c.Query("trade_no")
+	if tradeNo == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	ref := &payment.OrderRef{TradeNo: tradeNo}
+	method := ""
+	if topUp := model.GetTopUpByTradeNo(tradeNo); topUp != nil {
+		method = topUp.PaymentMethod
+		ref.ProviderOrderId = topUp.ProviderOrderId
+		ref.Money = topUp.Money
+	} else if order := model.GetSubscriptionOrderByTradeNo(tradeNo); order != nil {
+		method = order.PaymentMethod
+		ref.ProviderOrderId = order.ProviderOrderId
+		ref.Money = order.Money
+	} else {
+		common.ApiErrorMsg(c, "订单不存在")
+		return
+	}
+	_, provider := payment.ResolvePaymentMethod(method)
+	if provider == nil {
+		common.ApiErrorMsg(c, "不支持的支付渠道")
+		return
+	}
+	status, err := provider.QueryOrder(c.Request.Context(), ref)
+	if err != nil {
+		if errors.Is(err, payment.ErrNotSupported) {
+			common.ApiErrorMsg(c, "该支付渠道不支持查询订单")
+			return
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, status)
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminRefundPaymentRequest struct {
+	TradeNo string `json:"trade_no"`
+	// 退款金额，不填或 0 表示退还全部剩余金额
+	Money  float64 `json:"money"`
+	Reason string  `json:"reason"`
+	// 仅在本地登记，不调用支付渠道（已在渠道后台退款或渠道不支持在线退款）
+	LocalOnly bool `json:"local_only"`
+}
+
+// cancelRefundedSubscriptionRenewal 退款作废订阅后，尽力停止渠道侧的自动续费
+func cancelRefundedSubscriptionRenewal(ctx context.Context, refund *model.PaymentRefund) {
+	if refund == nil || refund.UserSubscriptionId <= 0 {
+		return
+	}
+	sub, err := model.GetUserSubscriptionByIdForUser(refund.UserId, refund.UserSubscriptionId)
+	if err != nil || sub.Status != "cancelled" || sub.ProviderSubscriptionId == "" {
+		return
+	}
+	manager, ok := getSubscriptionManager(sub.PaymentMethod)
+	if !ok {
+		return
+	}
+	if err := manager.SetCancelAtPeriodEnd(ctx, sub.ProviderSubscriptionId, true); err != nil {
+		common.SysError(fmt.Sprintf("cancel refunded provider subscription %s failed: %s", sub.ProviderSubscriptionId, err.Error()))
+	}
+}
+
+// AdminRefundPaymentOrder 管理员对充值或订阅订单发起全额/部分退款
+func AdminRefundPaymentOrder(c *gin.Context) {
+	var req AdminRefundPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" || req.Money < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	info, err := model.GetPaymentOrderInfo(req.TradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditTarget(c, "payment_order", info.TradeNo)
+	model.AuditBefore(c, info)
+	refundable := info.RefundableMoney()
+	if refundable <= 0 {
+		common.ApiError(c, model.ErrPaymentOrderNotRefundable)
+		return
+	}
+	money := req.Money
+	if money <= 0 {
+		money = refundable
+	}
+	if money > refundable+0.005 {
+		common.ApiError(c, model.ErrRefundExceedsPaid)
+		return
+	}
+
+	source := model.PaymentRefundSourceManual
+	providerRefundId := ""
+	if !req.LocalOnly {
+		_, provider := payment.ResolvePaymentMethod(info.PaymentMethod)
+		if provider == nil {
+			common.ApiErrorMsg(c, "不支持的支付渠道，请在渠道后台退款后选择仅本地登记")
+			return
+		}
+		result, err := provider.Refund(c.Request.Context(), &payment.OrderRef{
+			TradeNo:         info.TradeNo,
+			ProviderOrderId: info.ProviderOrderId,
+			Money:           info.Money,
+		}, money, req.Reason)
+		if err != nil {
+			if errors.Is(err, payment.ErrNotSupported) {
+				common.ApiErrorMsg(c, "该支付渠道不支持在线退款，请在渠道后台退款后选择仅本地登记")
+				return
+			}
+			common.SysError(fmt.Sprintf("refund order %s via %s failed: %s", info.TradeNo, info.PaymentMethod, err.Error()))
+			common.ApiErrorMsg(c, "渠道退款失败: "+err.Error())
+			return
+		}
+		source = model.PaymentRefundSourceAdmin
+		providerRefundId = result.RefundId
+	}
+
+	refund, err := model.RecordPaymentRefund(model.PaymentRefundRequest{
+		TradeNo:          req.TradeNo,
+		Money:            money,
+		Source:           source,
+		ProviderRefundId: providerRefundId,
+		Reason:           req.Reason,
+		OperatorId:       c.GetInt("id"),
+	})
+	if err != nil {
+		if source == model.PaymentRefundSourceAdmin {
+			common.SysError(fmt.Sprintf("order %s refunded by provider (%s) but local record failed: %s", info.TradeNo, providerRefundId, err.Error()))
+		}
+		common.ApiError(c, err)
+		return
+	}
+	if updated, err := model.GetPaymentOrderInfo(req.TradeNo); err == nil {
+		model.AuditAfter(c, updated)
+	}
+	cancelRefundedSubscriptionRenewal(c.Request.Context(), refund)
+	common.ApiSuccess(c, refund)
+}
+
+// AdminGetPaymentRefunds 退款记录列表，可按订单号或用户筛选
+func AdminGetPaymentRefunds(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	refunds, total, err := model.GetPaymentRefunds(c.Query("trade_no"), userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(refunds)
+	common.ApiSuccess(c, pageInfo)
+}
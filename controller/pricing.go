@@ -17,7 +17,9 @@ func GetPricing(c *gin.Context) {
 		groupRatio[s] = f
 	}
 	var group string
+	currencyUserId := 0
 	if exists {
+		currencyUserId = userId.(int)
 		user, err := model.GetUserCache(userId.(int))
 		if err == nil {
 			group = user.Group
@@ -46,6 +48,8 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		// 价格以 USD 计，前端按 currency.rate 换算为用户展示货币
+		"currency": model.GetUserCurrencyInfo(currencyUserId),
 	})
 }
 
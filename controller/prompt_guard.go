@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/middleware"
+	"github.com/Zer0Echo/uniapi/relay"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/relay/helper"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	service.RegisterPromptGuardEngine(classifierPromptGuard{})
+}
+
+// applyPromptGuard 在选择渠道前执行提示词注入检测，可疑请求按策略拒绝、仅标记或改用更严格的分组
+func applyPromptGuard(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) *types.NewAPIError {
+	result := service.RunPromptGuard(c, info.UsingGroup, request)
+	if result == nil || !result.Flagged {
+		return nil
+	}
+	logger.LogWarn(c, fmt.Sprintf("prompt guard flagged request: engine=%s, score=%.3f, action=%s, reason=%s", result.Engine, result.Score, result.Action, result.Reason))
+	switch result.Action {
+	case operation_setting.PromptGuardActionBlock:
+		return types.NewErrorWithStatusCode(errors.New("请求疑似包含提示词注入或越狱内容，已被拦截"), types.ErrorCodePromptInjectionBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	case operation_setting.PromptGuardActionRoute:
+		policy, _ := operation_setting.GetPromptGuardPolicy(info.UsingGroup)
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:        c,
+			TokenGroup: policy.RouteGroup,
+			ModelName:  info.OriginModelName,
+			Retry:      common.GetPointer(0),
+		})
+		if err != nil || channel == nil {
+			return types.NewError(fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在", policy.RouteGroup, info.OriginModelName), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		}
+		if apiErr := middleware.SetupContextForSelectedChannel(c, channel, info.OriginModelName); apiErr != nil {
+			return apiErr
+		}
+		// 后续重试与计费都使用新的分组
+		info.TokenGroup = policy.RouteGroup
+		info.UsingGroup = policy.RouteGroup
+		common.SetContextKey(c, constant.ContextKeyUsingGroup, policy.RouteGroup)
+		result.RoutedGroup = policy.RouteGroup
+	}
+	return nil
+}
+
+// classifierPromptGuard 通过网关自身的渠道调用分类模型，调用不计费也不记录消费日志
+type classifierPromptGuard struct{}
+
+func (classifierPromptGuard) Name() string {
+	return operation_setting.PromptGuardEngineClassifier
+}
+
+func (classifierPromptGuard) Evaluate(c *gin.Context, group string, texts []string) (float64, string, error) {
+	settings := operation_setting.GetPromptGuardSetting()
+	if settings.ClassifierModel == "" {
+		return 0, "", errors.New("prompt guard classifier model is not configured")
+	}
+	if settings.ClassifierGroup != "" {
+		group = settings.ClassifierGroup
+	}
+	timeout := time.Duration(settings.ClassifierTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	cc, _ := gin.CreateTestContext(w)
+	cc.Request = (&http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: "/v1/chat/completions"},
+		Header: make(http.Header),
+	}).WithContext(ctx)
+	cc.Request.Header.Set("Content-Type", "application/json")
+	// 沿用原请求的用户与令牌信息，渠道信息随后覆盖
+	for key, value := range c.Keys {
+		cc.Set(key, value)
+	}
+	cc.Set(common.KeyRequestBody, nil)
+	cc.Set(common.KeyBodyStorage, nil)
+	common.SetContextKey(cc, constant.ContextKeyUsingGroup, group)
+
+	channel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+		Ctx:        cc,
+		TokenGroup: group,
+		ModelName:  settings.ClassifierModel,
+		Retry:      common.GetPointer(0),
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	if channel == nil {
+		return 0, "", fmt.Errorf("no available channel for classifier model %s in group %s", settings.ClassifierModel, group)
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(cc, channel, settings.ClassifierModel); apiErr != nil {
+		return 0, "", apiErr
+	}
+
+	request := &dto.GeneralOpenAIRequest{
+		Model: settings.ClassifierModel,
+		Messages: []dto.Message{
+			{Role: "system", Content: settings.ClassifierPrompt},
+			{Role: "user", Content: "<content>\n" + strings.Join(texts, "\n\n") + "\n</content>"},
+		},
+		MaxTokens:   256,
+		Temperature: common.GetPointer(0.0),
+	}
+	output, err := relayPromptGuardClassifier(cc, w, request)
+	if err != nil {
+		return 0, "", err
+	}
+	return service.ParsePromptGuardClassifierOutput(output)
+}
+
+func relayPromptGuardClassifier(c *gin.Context, w *httptest.ResponseRecorder, request *dto.GeneralOpenAIRequest) (string, error) {
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatOpenAI, request, nil)
+	if err != nil {
+		return "", err
+	}
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return "", err
+	}
+	adaptor := relay.GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return "", fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return "", err
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverride(jsonData, info.ParamOverride, relaycommon.BuildParamOverrideContext(info))
+		if err != nil {
+			return "", err
+		}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+	httpResp, _ := resp.(*http.Response)
+	if httpResp == nil {
+		return "", errors.New("classifier returned no response")
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return "", service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+	}
+	if _, apiErr := adaptor.DoResponse(c, httpResp, info); apiErr != nil {
+		return "", apiErr
+	}
+	var response dto.OpenAITextResponse
+	if err := common.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("classifier returned no choices")
+	}
+	return response.Choices[0].Message.StringContent(), nil
+}
@@ -124,6 +124,7 @@ func UpdateQuotaRecord(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgQuotaRecordNotFound)
 		return
 	}
+	model.AuditBefore(c, record)
 
 	newRemaining := record.Remaining
 	if req.Remaining != nil {
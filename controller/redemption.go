@@ -136,6 +136,9 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if redemption, err := model.GetRedemptionById(id); err == nil {
+		model.AuditBefore(c, redemption)
+	}
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		common.ApiError(c, err)
@@ -161,6 +164,7 @@ func UpdateRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditBefore(c, cleanRedemption)
 	if statusOnly == "" {
 		if valid, msg := validateExpiredTime(c, redemption.ExpiredTime); !valid {
 			c.JSON(http.StatusOK, gin.H{"success": false, "message": msg})
@@ -181,6 +185,7 @@ func UpdateRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditAfter(c, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -195,6 +200,7 @@ func DeleteInvalidRedemption(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditAfter(c, map[string]int64{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
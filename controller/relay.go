@@ -141,6 +141,18 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	// 输出检查需要看到 DLP 还原后的内容，先于 DLP 包装响应写入器
+	service.ApplyContentFilter(c, relayInfo)
+
+	if err := service.ApplyDLPPolicy(c, relayInfo.UsingGroup, request); err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeSensitiveDataDetected, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		return
+	}
+
+	if newAPIError = applyPromptGuard(c, relayInfo, request); newAPIError != nil {
+		return
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -149,6 +161,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	if err := service.CheckTokenRequestLimits(c, request, tokens); err != nil {
+		newAPIError = types.NewErrorWithStatusCode(err, types.ErrorCodeTokenRequestLimit, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+		return
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -217,6 +234,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 
 		if newAPIError == nil {
+			service.FlushContentFilter(c)
 			return
 		}
 
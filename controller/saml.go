@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ACS 由 IdP 跨站 POST 提交，SameSite=Strict 的会话 Cookie 在随后的重定向中不会携带，
+// 因此返回页面后由前端同站跳转，同时写入前端使用的本地用户信息
+var samlResultPage = template.Must(template.New("saml").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>SAML</title></head>
+<body>
+{{if .Error}}<p>{{.Error}}</p><p><a href="/login">返回登录</a></p>
+{{else}}<script>
+localStorage.setItem("user", {{.User}});
+window.location.replace("/console");
+</script>
+{{end}}</body></html>`))
+
+func renderSAMLResult(c *gin.Context, statusCode int, errMessage string, user string) {
+	c.Status(statusCode)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	if err := samlResultPage.Execute(c.Writer, gin.H{"Error": errMessage, "User": user}); err != nil {
+		common.SysError("failed to render SAML result page: " + err.Error())
+	}
+}
+
+// SAMLMetadata 返回 SP 元数据，供 IdP 配置使用
+func SAMLMetadata(c *gin.Context) {
+	data, err := service.GetSAMLMetadata()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", data)
+}
+
+// SAMLLogin 发起 SP 登录，跳转至 IdP
+func SAMLLogin(c *gin.Context) {
+	redirectURL, postForm, err := service.MakeSAMLLoginRequest()
+	if err != nil {
+		renderSAMLResult(c, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if redirectURL != "" {
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", postForm)
+}
+
+// SAMLAssertionConsumer 处理 IdP 返回的断言并登录
+func SAMLAssertionConsumer(c *gin.Context) {
+	identity, err := service.ParseSAMLResponse(c.Request)
+	if err != nil {
+		renderSAMLResult(c, http.StatusForbidden, err.Error(), "")
+		return
+	}
+	user, err := findOrCreateSAMLUser(identity)
+	if err != nil {
+		renderSAMLResult(c, http.StatusForbidden, err.Error(), "")
+		return
+	}
+	if user.Status != common.UserStatusEnabled {
+		renderSAMLResult(c, http.StatusForbidden, "用户已被封禁", "")
+		return
+	}
+	if err := saveLoginSession(user, c); err != nil {
+		renderSAMLResult(c, http.StatusInternalServerError, "无法保存会话信息，请重试", "")
+		return
+	}
+	data, err := common.Marshal(map[string]any{
+		"id":           user.Id,
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"role":         user.Role,
+		"status":       user.Status,
+		"group":        user.Group,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	renderSAMLResult(c, http.StatusOK, "", string(data))
+}
+
+func findOrCreateSAMLUser(identity *service.SAMLIdentity) (*model.User, error) {
+	user, err := model.GetUserBySsoId(identity.SsoId)
+	if err == nil {
+		updates := map[string]any{}
+		if identity.Email != "" && identity.Email != user.Email && len(identity.Email) <= 50 {
+			updates["email"] = identity.Email
+		}
+		if displayName := model.TruncateSsoField(identity.DisplayName, 20); displayName != "" && displayName != user.DisplayName {
+			updates["display_name"] = displayName
+		}
+		if err := model.UpdateSsoUserFields(user, updates); err != nil {
+			return nil, err
+		}
+		// 断言中没有组信息时保留现有分组，避免覆盖 SCIM 同步的结果
+		if len(identity.Groups) > 0 {
+			if err := model.SyncSsoUserGroup(user.Id, identity.Groups); err != nil {
+				return nil, err
+			}
+		}
+		return model.GetUserById(user.Id, false)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !common.RegisterEnabled {
+		return nil, errors.New("管理员关闭了新用户注册")
+	}
+	user = &model.User{
+		SsoId:       identity.SsoId,
+		Email:       identity.Email,
+		DisplayName: model.TruncateSsoField(identity.DisplayName, 20),
+		Group:       system_setting.ResolveSSOGroup(identity.Groups),
+	}
+	if err := model.CreateSsoUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
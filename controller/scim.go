@@ -0,0 +1,880 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SCIM 2.0 服务端，供 IdP 同步用户与组。用户的 userName 对应 SsoId，与 SAML 登录的用户标识一致；
+// 组成员变化后按 SAML 组映射重新计算成员的网关分组
+
+const scimMaxResults = 500
+
+var scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type scimStatusError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimStatusError) Error() string {
+	return e.detail
+}
+
+func newScimError(status int, scimType string, detail string) error {
+	return &scimStatusError{status: status, scimType: scimType, detail: detail}
+}
+
+func scimError(c *gin.Context, err error) {
+	var statusErr *scimStatusError
+	if !errors.As(err, &statusErr) {
+		statusErr = &scimStatusError{status: http.StatusInternalServerError, detail: err.Error()}
+	}
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(statusErr.status, dto.ScimError{
+		Schemas:  []string{dto.ScimSchemaError},
+		Status:   strconv.Itoa(statusErr.status),
+		ScimType: statusErr.scimType,
+		Detail:   statusErr.detail,
+	})
+}
+
+func scimJSON(c *gin.Context, status int, v any) {
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(status, v)
+}
+
+func scimLocation(resourceType string, id int) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%d", strings.TrimSuffix(system_setting.ServerAddress, "/"), resourceType, id)
+}
+
+func scimTime(timestamp int64) string {
+	if timestamp <= 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// parseScimFilter 仅支持 `<attr> eq "value"` 形式的过滤条件
+func parseScimFilter(filter string, attribute string) (string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", nil
+	}
+	matches := scimFilterPattern.FindStringSubmatch(filter)
+	if matches == nil || !strings.EqualFold(matches[1], attribute) {
+		return "", newScimError(http.StatusBadRequest, "invalidFilter", "only '"+attribute+" eq \"value\"' filter is supported")
+	}
+	value, err := strconv.Unquote(`"` + matches[2] + `"`)
+	if err != nil {
+		return "", newScimError(http.StatusBadRequest, "invalidFilter", "invalid filter value")
+	}
+	return value, nil
+}
+
+// parseScimPagination 解析从 1 开始的 startIndex 与 count
+func parseScimPagination(c *gin.Context) (startIndex int, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count = 100
+	if v := c.Query("count"); v != "" {
+		count, _ = strconv.Atoi(v)
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxResults {
+		count = scimMaxResults
+	}
+	return startIndex, count
+}
+
+func scimListResponse(startIndex int, total int64, resources []any) dto.ScimListResponse {
+	if resources == nil {
+		resources = []any{}
+	}
+	return dto.ScimListResponse{
+		Schemas:      []string{dto.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+func ScimServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{dto.ScimSchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxResults},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the SCIM bearer token configured in system settings",
+			"primary":     true,
+		}},
+	})
+}
+
+func ScimResourceTypes(c *gin.Context) {
+	resources := []any{
+		gin.H{
+			"schemas":  []string{dto.ScimSchemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   dto.ScimSchemaUser,
+		},
+		gin.H{
+			"schemas":  []string{dto.ScimSchemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   dto.ScimSchemaGroup,
+		},
+	}
+	scimJSON(c, http.StatusOK, scimListResponse(1, int64(len(resources)), resources))
+}
+
+// scimUserChange 记录 SCIM 请求中出现的用户字段，nil 表示未修改
+type scimUserChange struct {
+	UserName    *string
+	DisplayName *string
+	Email       *string
+	Active      *bool
+}
+
+func scimUserToResource(user *model.User) (dto.ScimUser, error) {
+	groups, err := model.GetScimGroupsByUserId(user.Id)
+	if err != nil {
+		return dto.ScimUser{}, err
+	}
+	active := user.Status == common.UserStatusEnabled
+	resource := dto.ScimUser{
+		Schemas:     []string{dto.ScimSchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		UserName:    user.SsoId,
+		Name:        &dto.ScimName{Formatted: user.DisplayName},
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &dto.ScimMeta{
+			ResourceType: "User",
+			Created:      scimTime(user.CreatedTime),
+			Location:     scimLocation("Users", user.Id),
+		},
+	}
+	if user.Email != "" {
+		resource.Emails = []dto.ScimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	for _, group := range groups {
+		resource.Groups = append(resource.Groups, dto.ScimMultiValue{
+			Value:   strconv.Itoa(group.Id),
+			Display: group.DisplayName,
+			Ref:     scimLocation("Groups", group.Id),
+		})
+	}
+	return resource, nil
+}
+
+func scimPrimaryEmail(emails []dto.ScimMultiValue) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func scimNameDisplay(name *dto.ScimName) string {
+	if name == nil {
+		return ""
+	}
+	if name.Formatted != "" {
+		return name.Formatted
+	}
+	return strings.TrimSpace(name.GivenName + " " + name.FamilyName)
+}
+
+// changeFromScimUser 将完整的用户资源（POST / PUT）转换为字段修改
+func changeFromScimUser(resource *dto.ScimUser) scimUserChange {
+	displayName := resource.DisplayName
+	if displayName == "" {
+		displayName = scimNameDisplay(resource.Name)
+	}
+	email := scimPrimaryEmail(resource.Emails)
+	active := resource.Active == nil || *resource.Active
+	return scimUserChange{
+		UserName:    &resource.UserName,
+		DisplayName: &displayName,
+		Email:       &email,
+		Active:      &active,
+	}
+}
+
+func scimString(raw json.RawMessage) (string, error) {
+	var value string
+	if err := common.Unmarshal(raw, &value); err != nil {
+		return "", newScimError(http.StatusBadRequest, "invalidValue", "value must be a string")
+	}
+	return value, nil
+}
+
+// scimBool 部分 IdP 会以字符串 "True"/"False" 传递布尔值
+func scimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := common.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var str string
+	if err := common.Unmarshal(raw, &str); err == nil {
+		if parsed, err := strconv.ParseBool(str); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, newScimError(http.StatusBadRequest, "invalidValue", "value must be a boolean")
+}
+
+// applyScimUserAttribute 应用 PATCH 中的单个属性，不支持的属性忽略
+func applyScimUserAttribute(change *scimUserChange, path string, raw json.RawMessage) error {
+	lowerPath := strings.ToLower(path)
+	switch {
+	case lowerPath == "active":
+		active, err := scimBool(raw)
+		if err != nil {
+			return err
+		}
+		change.Active = &active
+	case lowerPath == "username":
+		value, err := scimString(raw)
+		if err != nil {
+			return err
+		}
+		change.UserName = &value
+	case lowerPath == "displayname", lowerPath == "name.formatted":
+		value, err := scimString(raw)
+		if err != nil {
+			return err
+		}
+		change.DisplayName = &value
+	case lowerPath == "name":
+		var name dto.ScimName
+		if err := common.Unmarshal(raw, &name); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "invalid name")
+		}
+		if value := scimNameDisplay(&name); value != "" && change.DisplayName == nil {
+			change.DisplayName = &value
+		}
+	case lowerPath == "emails":
+		var emails []dto.ScimMultiValue
+		if err := common.Unmarshal(raw, &emails); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "invalid emails")
+		}
+		value := scimPrimaryEmail(emails)
+		change.Email = &value
+	case strings.HasPrefix(lowerPath, "emails["):
+		value, err := scimString(raw)
+		if err != nil {
+			return err
+		}
+		change.Email = &value
+	}
+	return nil
+}
+
+func changeFromScimPatch(req *dto.ScimPatchRequest) (scimUserChange, error) {
+	var change scimUserChange
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if op.Path != "" {
+				if err := applyScimUserAttribute(&change, op.Path, op.Value); err != nil {
+					return change, err
+				}
+				continue
+			}
+			var attributes map[string]json.RawMessage
+			if err := common.Unmarshal(op.Value, &attributes); err != nil {
+				return change, newScimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+			}
+			for path, raw := range attributes {
+				if err := applyScimUserAttribute(&change, path, raw); err != nil {
+					return change, err
+				}
+			}
+		case "remove":
+			if strings.HasPrefix(strings.ToLower(op.Path), "emails") {
+				empty := ""
+				change.Email = &empty
+			}
+		default:
+			return change, newScimError(http.StatusBadRequest, "invalidSyntax", "unsupported patch operation: "+op.Op)
+		}
+	}
+	return change, nil
+}
+
+// saveScimUserChange 校验并写入用户字段修改
+func saveScimUserChange(user *model.User, change scimUserChange) error {
+	updates := map[string]any{}
+	if change.UserName != nil && *change.UserName != user.SsoId {
+		userName := strings.TrimSpace(*change.UserName)
+		if userName == "" {
+			return newScimError(http.StatusBadRequest, "invalidValue", "userName is required")
+		}
+		if model.IsSsoIdAlreadyTaken(userName) {
+			return newScimError(http.StatusConflict, "uniqueness", "userName already exists")
+		}
+		updates["sso_id"] = userName
+	}
+	if change.DisplayName != nil {
+		if displayName := model.TruncateSsoField(*change.DisplayName, 20); displayName != "" && displayName != user.DisplayName {
+			updates["display_name"] = displayName
+		}
+	}
+	if change.Email != nil && *change.Email != user.Email && len(*change.Email) <= 50 {
+		updates["email"] = *change.Email
+	}
+	if change.Active != nil {
+		status := common.UserStatusDisabled
+		if *change.Active {
+			status = common.UserStatusEnabled
+		}
+		if status != user.Status {
+			if user.Role == common.RoleRootUser {
+				return newScimError(http.StatusBadRequest, "mutability", "root user cannot be disabled")
+			}
+			updates["status"] = status
+		}
+	}
+	return model.UpdateSsoUserFields(user, updates)
+}
+
+func getScimUser(c *gin.Context) (*model.User, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, newScimError(http.StatusNotFound, "", "user not found")
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil || user.SsoId == "" {
+		return nil, newScimError(http.StatusNotFound, "", "user not found")
+	}
+	return user, nil
+}
+
+func respondScimUser(c *gin.Context, status int, userId int) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	resource, err := scimUserToResource(user)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	scimJSON(c, status, resource)
+}
+
+func ScimListUsers(c *gin.Context) {
+	userName, err := parseScimFilter(c.Query("filter"), "userName")
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	startIndex, count := parseScimPagination(c)
+	users, total, err := model.GetSsoUsers(userName, startIndex-1, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resource, err := scimUserToResource(user)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+	scimJSON(c, http.StatusOK, scimListResponse(startIndex, total, resources))
+}
+
+func ScimGetUser(c *gin.Context) {
+	user, err := getScimUser(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimUser(c, http.StatusOK, user.Id)
+}
+
+func ScimCreateUser(c *gin.Context) {
+	var resource dto.ScimUser
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	resource.UserName = strings.TrimSpace(resource.UserName)
+	if resource.UserName == "" {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidValue", "userName is required"))
+		return
+	}
+	if model.IsSsoIdAlreadyTaken(resource.UserName) {
+		scimError(c, newScimError(http.StatusConflict, "uniqueness", "userName already exists"))
+		return
+	}
+	change := changeFromScimUser(&resource)
+	user := &model.User{
+		SsoId:       resource.UserName,
+		DisplayName: model.TruncateSsoField(*change.DisplayName, 20),
+		Email:       *change.Email,
+		Group:       system_setting.ResolveSSOGroup(nil),
+		Status:      common.UserStatusEnabled,
+	}
+	if !*change.Active {
+		user.Status = common.UserStatusDisabled
+	}
+	if err := model.CreateSsoUser(user); err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimUser(c, http.StatusCreated, user.Id)
+}
+
+func ScimReplaceUser(c *gin.Context) {
+	user, err := getScimUser(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var resource dto.ScimUser
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	if err := saveScimUserChange(user, changeFromScimUser(&resource)); err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimUser(c, http.StatusOK, user.Id)
+}
+
+func ScimPatchUser(c *gin.Context) {
+	user, err := getScimUser(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	change, err := changeFromScimPatch(&req)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := saveScimUserChange(user, change); err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimUser(c, http.StatusOK, user.Id)
+}
+
+func ScimDeleteUser(c *gin.Context) {
+	user, err := getScimUser(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if user.Role == common.RoleRootUser {
+		scimError(c, newScimError(http.StatusBadRequest, "mutability", "root user cannot be deleted"))
+		return
+	}
+	if err := user.Delete(); err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := model.RemoveUserFromScimGroups(user.Id); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func scimGroupToResource(group *model.ScimGroup) (dto.ScimGroup, error) {
+	memberIds, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return dto.ScimGroup{}, err
+	}
+	members := make([]dto.ScimMultiValue, 0, len(memberIds))
+	for _, id := range memberIds {
+		members = append(members, dto.ScimMultiValue{
+			Value: strconv.Itoa(id),
+			Ref:   scimLocation("Users", id),
+		})
+	}
+	return dto.ScimGroup{
+		Schemas:     []string{dto.ScimSchemaGroup},
+		Id:          strconv.Itoa(group.Id),
+		ExternalId:  group.ExternalId,
+		DisplayName: group.DisplayName,
+		Members:     members,
+		Meta: &dto.ScimMeta{
+			ResourceType: "Group",
+			Created:      scimTime(group.CreatedTime),
+			LastModified: scimTime(group.UpdatedTime),
+			Location:     scimLocation("Groups", group.Id),
+		},
+	}, nil
+}
+
+// scimMemberIds 解析成员列表中的用户 id，忽略不存在的用户
+func scimMemberIds(members []dto.ScimMultiValue) ([]int, error) {
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, newScimError(http.StatusBadRequest, "invalidValue", "invalid member: "+member.Value)
+		}
+		if id <= 0 {
+			continue
+		}
+		if _, err := model.GetUserById(id, false); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func getScimGroup(c *gin.Context) (*model.ScimGroup, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, newScimError(http.StatusNotFound, "", "group not found")
+	}
+	group, err := model.GetScimGroupById(id)
+	if err != nil {
+		return nil, newScimError(http.StatusNotFound, "", "group not found")
+	}
+	return group, nil
+}
+
+func respondScimGroup(c *gin.Context, status int, groupId int) {
+	group, err := model.GetScimGroupById(groupId)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	resource, err := scimGroupToResource(group)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if status == http.StatusCreated {
+		c.Header("Location", resource.Meta.Location)
+	}
+	scimJSON(c, status, resource)
+}
+
+// renameScimGroup 修改组名后，组映射可能随之变化，需要重新计算成员分组
+func renameScimGroup(group *model.ScimGroup, displayName string) error {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" {
+		return newScimError(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	if displayName == group.DisplayName {
+		return nil
+	}
+	if model.IsScimGroupNameTaken(displayName, group.Id) {
+		return newScimError(http.StatusConflict, "uniqueness", "displayName already exists")
+	}
+	group.DisplayName = displayName
+	if err := group.Update(); err != nil {
+		return err
+	}
+	memberIds, err := model.GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return err
+	}
+	return model.SyncScimUserGroups(memberIds)
+}
+
+func ScimListGroups(c *gin.Context) {
+	displayName, err := parseScimFilter(c.Query("filter"), "displayName")
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	startIndex, count := parseScimPagination(c)
+	groups, total, err := model.GetScimGroups(displayName, startIndex-1, count)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	resources := make([]any, 0, len(groups))
+	for _, group := range groups {
+		resource, err := scimGroupToResource(group)
+		if err != nil {
+			scimError(c, err)
+			return
+		}
+		resources = append(resources, resource)
+	}
+	scimJSON(c, http.StatusOK, scimListResponse(startIndex, total, resources))
+}
+
+func ScimGetGroup(c *gin.Context) {
+	group, err := getScimGroup(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimGroup(c, http.StatusOK, group.Id)
+}
+
+func ScimCreateGroup(c *gin.Context) {
+	var resource dto.ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	resource.DisplayName = strings.TrimSpace(resource.DisplayName)
+	if resource.DisplayName == "" {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidValue", "displayName is required"))
+		return
+	}
+	if model.IsScimGroupNameTaken(resource.DisplayName, 0) {
+		scimError(c, newScimError(http.StatusConflict, "uniqueness", "displayName already exists"))
+		return
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	group := &model.ScimGroup{
+		DisplayName: resource.DisplayName,
+		ExternalId:  resource.ExternalId,
+	}
+	if err := group.Insert(); err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := model.AddScimGroupMembers(group.Id, memberIds); err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimGroup(c, http.StatusCreated, group.Id)
+}
+
+func ScimReplaceGroup(c *gin.Context) {
+	group, err := getScimGroup(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var resource dto.ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &resource); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	memberIds, err := scimMemberIds(resource.Members)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if resource.ExternalId != group.ExternalId {
+		group.ExternalId = resource.ExternalId
+		if err := group.Update(); err != nil {
+			scimError(c, err)
+			return
+		}
+	}
+	if err := renameScimGroup(group, resource.DisplayName); err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := model.ReplaceScimGroupMembers(group.Id, memberIds); err != nil {
+		scimError(c, err)
+		return
+	}
+	respondScimGroup(c, http.StatusOK, group.Id)
+}
+
+// scimMemberPathValue 解析 `members[value eq "id"]` 形式的路径
+func scimMemberPathValue(path string) (string, bool) {
+	inner, ok := strings.CutPrefix(path, "members[")
+	if !ok {
+		return "", false
+	}
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return "", false
+	}
+	value, err := parseScimFilter(inner, "value")
+	return value, err == nil
+}
+
+func applyScimGroupOperation(group *model.ScimGroup, op dto.ScimPatchOperation) error {
+	opName := strings.ToLower(op.Op)
+	path := strings.TrimSpace(op.Path)
+	lowerPath := strings.ToLower(path)
+
+	if path == "" {
+		if opName == "remove" {
+			return newScimError(http.StatusBadRequest, "noTarget", "path is required for remove")
+		}
+		var attributes struct {
+			DisplayName *string              `json:"displayName"`
+			ExternalId  *string              `json:"externalId"`
+			Members     []dto.ScimMultiValue `json:"members"`
+		}
+		if err := common.Unmarshal(op.Value, &attributes); err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "value must be an object when path is omitted")
+		}
+		if attributes.ExternalId != nil {
+			group.ExternalId = *attributes.ExternalId
+			if err := group.Update(); err != nil {
+				return err
+			}
+		}
+		if attributes.DisplayName != nil {
+			if err := renameScimGroup(group, *attributes.DisplayName); err != nil {
+				return err
+			}
+		}
+		if attributes.Members != nil {
+			memberIds, err := scimMemberIds(attributes.Members)
+			if err != nil {
+				return err
+			}
+			if opName == "replace" {
+				return model.ReplaceScimGroupMembers(group.Id, memberIds)
+			}
+			return model.AddScimGroupMembers(group.Id, memberIds)
+		}
+		return nil
+	}
+
+	switch {
+	case lowerPath == "displayname":
+		value, err := scimString(op.Value)
+		if err != nil {
+			return err
+		}
+		return renameScimGroup(group, value)
+	case lowerPath == "externalid":
+		value := ""
+		if opName != "remove" {
+			var err error
+			if value, err = scimString(op.Value); err != nil {
+				return err
+			}
+		}
+		group.ExternalId = value
+		return group.Update()
+	case lowerPath == "members":
+		var members []dto.ScimMultiValue
+		if len(op.Value) > 0 {
+			if err := common.Unmarshal(op.Value, &members); err != nil {
+				return newScimError(http.StatusBadRequest, "invalidValue", "invalid members")
+			}
+		}
+		memberIds, err := scimMemberIds(members)
+		if err != nil {
+			return err
+		}
+		switch opName {
+		case "add":
+			return model.AddScimGroupMembers(group.Id, memberIds)
+		case "replace":
+			return model.ReplaceScimGroupMembers(group.Id, memberIds)
+		case "remove":
+			if len(op.Value) == 0 {
+				return model.ReplaceScimGroupMembers(group.Id, nil)
+			}
+			return model.RemoveScimGroupMembers(group.Id, memberIds)
+		}
+	case strings.HasPrefix(lowerPath, "members["):
+		value, ok := scimMemberPathValue(path)
+		if !ok || opName != "remove" {
+			return newScimError(http.StatusBadRequest, "invalidPath", "unsupported path: "+path)
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return newScimError(http.StatusBadRequest, "invalidValue", "invalid member: "+value)
+		}
+		return model.RemoveScimGroupMembers(group.Id, []int{id})
+	}
+	return newScimError(http.StatusBadRequest, "invalidPath", "unsupported path: "+path)
+}
+
+func ScimPatchGroup(c *gin.Context) {
+	group, err := getScimGroup(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "invalid request body"))
+		return
+	}
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace", "remove":
+		default:
+			scimError(c, newScimError(http.StatusBadRequest, "invalidSyntax", "unsupported patch operation: "+op.Op))
+			return
+		}
+		if err := applyScimGroupOperation(group, op); err != nil {
+			scimError(c, err)
+			return
+		}
+	}
+	respondScimGroup(c, http.StatusOK, group.Id)
+}
+
+func ScimDeleteGroup(c *gin.Context) {
+	group, err := getScimGroup(c)
+	if err != nil {
+		scimError(c, err)
+		return
+	}
+	if err := group.Delete(); err != nil {
+		scimError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
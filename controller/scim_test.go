@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+)
+
+func TestParseScimFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		attr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", filter: "  ", attr: "userName", want: ""},
+		{name: "eq", filter: `userName eq "alice@example.com"`, attr: "userName", want: "alice@example.com"},
+		{name: "case insensitive", filter: `USERNAME EQ "alice"`, attr: "userName", want: "alice"},
+		{name: "surrounding spaces", filter: `  displayName   eq   "Engineering Team"  `, attr: "displayName", want: "Engineering Team"},
+		{name: "escaped quote", filter: `displayName eq "R\"D"`, attr: "displayName", want: `R"D`},
+		{name: "empty value", filter: `userName eq ""`, attr: "userName", want: ""},
+		{name: "other attribute", filter: `email eq "alice"`, attr: "userName", wantErr: true},
+		{name: "unsupported operator", filter: `userName co "ali"`, attr: "userName", wantErr: true},
+		{name: "compound filter", filter: `userName eq "a" and active eq "true"`, attr: "userName", wantErr: true},
+		{name: "unquoted value", filter: `userName eq alice`, attr: "userName", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScimFilter(tt.filter, tt.attr)
+			if tt.wantErr {
+				var scimErr *scimStatusError
+				if !errors.As(err, &scimErr) || scimErr.status != http.StatusBadRequest || scimErr.scimType != "invalidFilter" {
+					t.Fatalf("expected invalidFilter error, got %v", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("parseScimFilter = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if value, ok := scimMemberPathValue(`members[value eq "42"]`); !ok || value != "42" {
+		t.Fatalf("unexpected member path value %q, %v", value, ok)
+	}
+	if _, ok := scimMemberPathValue(`members[display eq "42"]`); ok {
+		t.Fatal("expected member path with other attribute to be rejected")
+	}
+}
+
+func scimPatch(t *testing.T, ops ...dto.ScimPatchOperation) *dto.ScimPatchRequest {
+	t.Helper()
+	return &dto.ScimPatchRequest{Schemas: []string{dto.ScimSchemaPatchOp}, Operations: ops}
+}
+
+func TestChangeFromScimPatch(t *testing.T) {
+	str := func(v string) *string { return &v }
+	boolean := func(v bool) *bool { return &v }
+	tests := []struct {
+		name    string
+		req     *dto.ScimPatchRequest
+		want    scimUserChange
+		wantErr string
+	}{
+		{
+			name: "replace active as string",
+			req:  scimPatch(t, dto.ScimPatchOperation{Op: "Replace", Path: "active", Value: json.RawMessage(`"False"`)}),
+			want: scimUserChange{Active: boolean(false)},
+		},
+		{
+			name: "replace without path",
+			req: scimPatch(t, dto.ScimPatchOperation{Op: "replace", Value: json.RawMessage(
+				`{"active":true,"userName":"bob","displayName":"Bob","emails":[{"value":"b@example.com","primary":true}]}`)}),
+			want: scimUserChange{Active: boolean(true), UserName: str("bob"), DisplayName: str("Bob"), Email: str("b@example.com")},
+		},
+		{
+			name: "name does not override display name",
+			req: scimPatch(t,
+				dto.ScimPatchOperation{Op: "add", Path: "displayName", Value: json.RawMessage(`"Display"`)},
+				dto.ScimPatchOperation{Op: "add", Path: "name", Value: json.RawMessage(`{"givenName":"Given","familyName":"Family"}`)},
+			),
+			want: scimUserChange{DisplayName: str("Display")},
+		},
+		{
+			name: "filtered email path",
+			req:  scimPatch(t, dto.ScimPatchOperation{Op: "replace", Path: `emails[type eq "work"].value`, Value: json.RawMessage(`"w@example.com"`)}),
+			want: scimUserChange{Email: str("w@example.com")},
+		},
+		{
+			name: "remove emails",
+			req:  scimPatch(t, dto.ScimPatchOperation{Op: "remove", Path: "emails"}),
+			want: scimUserChange{Email: str("")},
+		},
+		{
+			name: "unknown attribute ignored",
+			req:  scimPatch(t, dto.ScimPatchOperation{Op: "replace", Path: "title", Value: json.RawMessage(`"Engineer"`)}),
+			want: scimUserChange{},
+		},
+		{
+			name:    "invalid boolean",
+			req:     scimPatch(t, dto.ScimPatchOperation{Op: "replace", Path: "active", Value: json.RawMessage(`"maybe"`)}),
+			wantErr: "invalidValue",
+		},
+		{
+			name:    "non object value without path",
+			req:     scimPatch(t, dto.ScimPatchOperation{Op: "replace", Value: json.RawMessage(`"bob"`)}),
+			wantErr: "invalidValue",
+		},
+		{
+			name:    "unsupported op",
+			req:     scimPatch(t, dto.ScimPatchOperation{Op: "move", Path: "active"}),
+			wantErr: "invalidSyntax",
+		},
+	}
+	deref := func(v any) any {
+		switch p := v.(type) {
+		case *string:
+			if p != nil {
+				return *p
+			}
+		case *bool:
+			if p != nil {
+				return *p
+			}
+		}
+		return nil
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := changeFromScimPatch(tt.req)
+			if tt.wantErr != "" {
+				var scimErr *scimStatusError
+				if !errors.As(err, &scimErr) || scimErr.scimType != tt.wantErr {
+					t.Fatalf("expected %s error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("changeFromScimPatch: %v", err)
+			}
+			pairs := [][2]any{
+				{got.UserName, tt.want.UserName},
+				{got.DisplayName, tt.want.DisplayName},
+				{got.Email, tt.want.Email},
+				{got.Active, tt.want.Active},
+			}
+			for _, pair := range pairs {
+				if deref(pair[0]) != deref(pair[1]) {
+					t.Fatalf("change = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func getTestUserGroup(t *testing.T, userId int) string {
+	t.Helper()
+	var user model.User
+	if err := model.DB.Select("group").First(&user, "id = ?", userId).Error; err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	return user.Group
+}
+
+func TestScimGroupPatchSyncsGatewayGroup(t *testing.T) {
+	settings := system_setting.GetSAMLSettings()
+	oldMappings, oldDefault := settings.GroupMappings, settings.DefaultGroup
+	t.Cleanup(func() { settings.GroupMappings, settings.DefaultGroup = oldMappings, oldDefault })
+	settings.GroupMappings = []system_setting.SSOGroupMapping{
+		{IdPGroup: "Admins", Group: "svip"},
+		{IdPGroup: "Engineering", Group: "vip"},
+	}
+	settings.DefaultGroup = "default"
+
+	alice := createTestUser(t, 0)
+	bob := createTestUser(t, 0)
+	engineering := &model.ScimGroup{DisplayName: "Engineering-" + common.GetRandomString(6)}
+	if err := engineering.Insert(); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	members := json.RawMessage(`[{"value":"` + strconv.Itoa(alice.Id) + `"},{"value":"` + strconv.Itoa(bob.Id) + `"},{"value":"999999"}]`)
+
+	// 组名尚未映射：成员落到默认分组
+	if err := applyScimGroupOperation(engineering, dto.ScimPatchOperation{Op: "add", Path: "members", Value: members}); err != nil {
+		t.Fatalf("add members: %v", err)
+	}
+	if ids, _ := model.GetScimGroupMemberIds(engineering.Id); len(ids) != 2 {
+		t.Fatalf("expected unknown member to be ignored, got %v", ids)
+	}
+	if group := getTestUserGroup(t, alice.Id); group != "default" {
+		t.Fatalf("expected default group, got %q", group)
+	}
+
+	// 改名后命中映射，所有成员重新计算分组
+	if err := applyScimGroupOperation(engineering, dto.ScimPatchOperation{Op: "replace", Path: "displayName", Value: json.RawMessage(`"Engineering"`)}); err != nil {
+		t.Fatalf("rename group: %v", err)
+	}
+	for _, user := range []*model.User{alice, bob} {
+		if group := getTestUserGroup(t, user.Id); group != "vip" {
+			t.Fatalf("expected user %d to be mapped to vip, got %q", user.Id, group)
+		}
+	}
+
+	// 先匹配的映射优先
+	admins := &model.ScimGroup{DisplayName: "Admins"}
+	if err := admins.Insert(); err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	if err := applyScimGroupOperation(admins, dto.ScimPatchOperation{Op: "add", Value: json.RawMessage(`{"members":[{"value":"` + strconv.Itoa(alice.Id) + `"}]}`)}); err != nil {
+		t.Fatalf("add members without path: %v", err)
+	}
+	if group := getTestUserGroup(t, alice.Id); group != "svip" {
+		t.Fatalf("expected first matching mapping to win, got %q", group)
+	}
+
+	// 移除成员后回退到剩余组的映射或默认分组
+	if err := applyScimGroupOperation(admins, dto.ScimPatchOperation{Op: "remove", Path: `members[value eq "` + strconv.Itoa(alice.Id) + `"]`}); err != nil {
+		t.Fatalf("remove member: %v", err)
+	}
+	if group := getTestUserGroup(t, alice.Id); group != "vip" {
+		t.Fatalf("expected vip after leaving admins, got %q", group)
+	}
+	if err := applyScimGroupOperation(engineering, dto.ScimPatchOperation{Op: "replace", Path: "members", Value: json.RawMessage(`[{"value":"` + strconv.Itoa(bob.Id) + `"}]`)}); err != nil {
+		t.Fatalf("replace members: %v", err)
+	}
+	if group := getTestUserGroup(t, alice.Id); group != "default" {
+		t.Fatalf("expected default group after removal, got %q", group)
+	}
+	if group := getTestUserGroup(t, bob.Id); group != "vip" {
+		t.Fatalf("expected remaining member to keep vip, got %q", group)
+	}
+
+	if err := applyScimGroupOperation(engineering, dto.ScimPatchOperation{Op: "add", Path: `members[value eq "1"]`}); err == nil {
+		t.Fatal("expected add with member filter path to be rejected")
+	}
+	if err := applyScimGroupOperation(engineering, dto.ScimPatchOperation{Op: "remove"}); err == nil {
+		t.Fatal("expected remove without path to be rejected")
+	}
+}
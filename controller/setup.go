@@ -8,6 +8,7 @@ import (
 	"github.com/Zer0Echo/uniapi/model"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Setup struct {
@@ -119,7 +120,13 @@ func PostSetup(c *gin.Context) {
 			AccessToken: nil,
 			Quota:       100000000,
 		}
-		err = model.DB.Create(&rootUser).Error
+		// 初始额度同时写入期初分录，账本从第一天起与余额一致
+		err = model.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&rootUser).Error; err != nil {
+				return err
+			}
+			return model.RecordUserLedger(tx, rootUser.Id, rootUser.Quota, model.LedgerRef{Source: model.LedgerSourceOpening})
+		})
 		if err != nil {
 			c.JSON(200, gin.H{
 				"success": false,
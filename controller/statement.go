@@ -0,0 +1,217 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/i18n"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvoiceInfoRequest struct {
+	Company string `json:"invoice_company"`
+	TaxId   string `json:"invoice_tax_id"`
+	Address string `json:"invoice_address"`
+	Email   string `json:"invoice_email"`
+}
+
+type StatementRegenerateRequest struct {
+	UserId int    `json:"user_id"`
+	Period string `json:"period"`
+	Notify bool   `json:"notify"`
+}
+
+// GetSelfInvoiceInfo 获取当前用户的开票信息
+func GetSelfInvoiceInfo(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setting := user.GetSetting()
+	common.ApiSuccess(c, InvoiceInfoRequest{
+		Company: setting.InvoiceCompany,
+		TaxId:   setting.InvoiceTaxId,
+		Address: setting.InvoiceAddress,
+		Email:   setting.InvoiceEmail,
+	})
+}
+
+// UpdateSelfInvoiceInfo 更新开票信息，之后生成的账单使用新信息
+func UpdateSelfInvoiceInfo(c *gin.Context) {
+	var req InvoiceInfoRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	req.Company = strings.TrimSpace(req.Company)
+	req.TaxId = strings.TrimSpace(req.TaxId)
+	req.Address = strings.TrimSpace(req.Address)
+	req.Email = strings.TrimSpace(req.Email)
+	if len(req.Company) > 255 || len(req.TaxId) > 64 || len(req.Address) > 255 {
+		common.ApiErrorMsg(c, "开票信息过长")
+		return
+	}
+	if req.Email != "" && !strings.Contains(req.Email, "@") {
+		common.ApiErrorI18n(c, i18n.MsgSettingEmailInvalid)
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setting := user.GetSetting()
+	setting.InvoiceCompany = req.Company
+	setting.InvoiceTaxId = req.TaxId
+	setting.InvoiceAddress = req.Address
+	setting.InvoiceEmail = req.Email
+	user.SetSetting(setting)
+	if err := user.Update(false); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUpdateFailed)
+		return
+	}
+	common.ApiSuccessI18n(c, i18n.MsgSettingSaved, nil)
+}
+
+func GetSelfStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	statements, total, err := model.GetUserStatements(c.GetInt("id"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfStatement 获取账单详情，包含按模型、令牌、项目的消费与支付明细
+func GetSelfStatement(c *gin.Context) {
+	statement, ok := getStatementParam(c)
+	if !ok {
+		return
+	}
+	if statement.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	respondStatementDetail(c, statement)
+}
+
+func DownloadSelfStatement(c *gin.Context) {
+	statement, ok := getStatementParam(c)
+	if !ok {
+		return
+	}
+	if statement.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	downloadStatement(c, statement)
+}
+
+func GetAllStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	statements, total, err := model.GetAllStatements(userId, c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetStatement(c *gin.Context) {
+	statement, ok := getStatementParam(c)
+	if !ok {
+		return
+	}
+	respondStatementDetail(c, statement)
+}
+
+func DownloadStatement(c *gin.Context) {
+	statement, ok := getStatementParam(c)
+	if !ok {
+		return
+	}
+	downloadStatement(c, statement)
+}
+
+// RegenerateStatement 管理员重新生成账单，未指定用户时为该周期内所有有消费或充值的用户生成
+func RegenerateStatement(c *gin.Context) {
+	var req StatementRegenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if req.Period == "" {
+		req.Period = model.PreviousStatementPeriod(time.Now())
+	}
+	if _, _, err := model.ParseStatementPeriod(req.Period); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.UserId != 0 {
+		statement, err := service.GenerateStatement(req.UserId, req.Period, req.Notify)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(req.UserId, model.LogTypeManage, fmt.Sprintf("管理员 %s(#%d) 重新生成 %s 账单",
+			c.GetString("username"), c.GetInt("id"), req.Period))
+		common.ApiSuccess(c, statement)
+		return
+	}
+	generated, err := service.GenerateStatementsForPeriod(req.Period, req.Notify, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"period": req.Period, "generated": generated})
+}
+
+func getStatementParam(c *gin.Context) (*model.Statement, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidId)
+		return nil, false
+	}
+	statement, err := model.GetStatementById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "账单不存在")
+		return nil, false
+	}
+	return statement, true
+}
+
+func respondStatementDetail(c *gin.Context, statement *model.Statement) {
+	totals := service.GetStatementTotals(statement)
+	common.ApiSuccess(c, gin.H{
+		"statement":  statement,
+		"detail":     statement.GetDetail(),
+		"paid_money": totals.PaidMoney,
+		"tax_rate":   totals.TaxRate,
+		"tax_amount": totals.TaxAmount,
+		"net_amount": totals.NetAmount,
+	})
+}
+
+func downloadStatement(c *gin.Context, statement *model.Statement) {
+	data, contentType, fileName, err := service.RenderStatement(statement, c.DefaultQuery("format", service.StatementFormatCSV))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Data(http.StatusOK, contentType, data)
+}
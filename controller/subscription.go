@@ -14,7 +14,39 @@ import (
 // ---- Shared types ----
 
 type SubscriptionPlanDTO struct {
-	Plan model.SubscriptionPlan `json:"plan"`
+	Plan       model.SubscriptionPlan  `json:"plan"`
+	LocalPrice *SubscriptionLocalPrice `json:"local_price,omitempty"`
+}
+
+// SubscriptionLocalPrice 套餐在用户展示货币下的价格，Native 为 false 时为按汇率换算的估算值
+type SubscriptionLocalPrice struct {
+	Currency string  `json:"currency"`
+	Symbol   string  `json:"symbol"`
+	Amount   float64 `json:"amount"`
+	Native   bool    `json:"native"`
+}
+
+func getSubscriptionLocalPrice(plan *model.SubscriptionPlan, currency *model.CurrencyInfo) *SubscriptionLocalPrice {
+	if price, ok := plan.GetCurrencyPrice(currency.Code); ok {
+		return &SubscriptionLocalPrice{Currency: price.Currency, Symbol: currency.Symbol, Amount: price.PriceAmount, Native: true}
+	}
+	if strings.EqualFold(plan.Currency, currency.Code) {
+		return &SubscriptionLocalPrice{Currency: currency.Code, Symbol: currency.Symbol, Amount: plan.PriceAmount, Native: true}
+	}
+	// 套餐默认货币不是 USD 时先换算为美元，未启用的货币按 USD 处理
+	usd := plan.PriceAmount
+	if base, ok := model.GetCurrencyInfo(plan.Currency); ok {
+		usd = base.ToUSD(plan.PriceAmount)
+	}
+	return &SubscriptionLocalPrice{Currency: currency.Code, Symbol: currency.Symbol, Amount: currency.FromUSD(usd)}
+}
+
+// localizeSubscriptionPlan 按用户展示货币选择套餐的原生定价，易支付仅支持默认货币
+func localizeSubscriptionPlan(plan *model.SubscriptionPlan, userId int, method string) *model.SubscriptionPlan {
+	if method != PaymentMethodStripe && method != PaymentMethodCreem {
+		return plan
+	}
+	return plan.ForCurrency(model.GetUserCurrencyInfo(userId).Code)
 }
 
 type BillingPreferenceRequest struct {
@@ -29,10 +61,12 @@ func GetSubscriptionPlans(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	currency := model.GetUserCurrencyInfo(c.GetInt("id"))
 	result := make([]SubscriptionPlanDTO, 0, len(plans))
 	for _, p := range plans {
 		result = append(result, SubscriptionPlanDTO{
-			Plan: p,
+			Plan:       p,
+			LocalPrice: getSubscriptionLocalPrice(&p, currency),
 		})
 	}
 	common.ApiSuccess(c, result)
@@ -54,6 +88,7 @@ func GetSubscriptionSelf(c *gin.Context) {
 	if err != nil {
 		activeSubscriptions = []model.SubscriptionSummary{}
 	}
+	model.FillSubscriptionAllowances(activeSubscriptions)
 
 	common.ApiSuccess(c, gin.H{
 		"billing_preference": pref,
@@ -156,7 +191,19 @@ func AdminCreateSubscriptionPlan(c *gin.Context) {
 		common.ApiErrorMsg(c, "自定义重置周期需大于0秒")
 		return
 	}
-	err := model.DB.Create(&req.Plan).Error
+	modelAllowances, err := model.NormalizeSubscriptionModelAllowances(req.Plan.ModelAllowances)
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	req.Plan.ModelAllowances = modelAllowances
+	currencyPrices, err := model.NormalizeSubscriptionCurrencyPrices(req.Plan.CurrencyPrices, req.Plan.Currency)
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	req.Plan.CurrencyPrices = currencyPrices
+	err = model.DB.Create(&req.Plan).Error
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -219,8 +266,20 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 		common.ApiErrorMsg(c, "自定义重置周期需大于0秒")
 		return
 	}
+	modelAllowances, err := model.NormalizeSubscriptionModelAllowances(req.Plan.ModelAllowances)
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	req.Plan.ModelAllowances = modelAllowances
+	currencyPrices, err := model.NormalizeSubscriptionCurrencyPrices(req.Plan.CurrencyPrices, req.Plan.Currency)
+	if err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+	req.Plan.CurrencyPrices = currencyPrices
 
-	err := model.DB.Transaction(func(tx *gorm.DB) error {
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
 		// update plan (allow zero values updates with map)
 		updateMap := map[string]interface{}{
 			"title":                      req.Plan.Title,
@@ -240,6 +299,8 @@ func AdminUpdateSubscriptionPlan(c *gin.Context) {
 			"upgrade_group":              req.Plan.UpgradeGroup,
 			"quota_reset_period":         req.Plan.QuotaResetPeriod,
 			"quota_reset_custom_seconds": req.Plan.QuotaResetCustomSeconds,
+			"model_allowances":           req.Plan.ModelAllowances,
+			"currency_prices":            req.Plan.CurrencyPrices,
 			"updated_at":                 common.GetTimestamp(),
 		}
 		if err := tx.Model(&model.SubscriptionPlan{}).Where("id = ?", id).Updates(updateMap).Error; err != nil {
@@ -289,6 +350,7 @@ func AdminBindSubscription(c *gin.Context) {
 		common.ApiErrorMsg(c, "参数错误")
 		return
 	}
+	model.AuditTarget(c, "user", req.UserId)
 	msg, err := model.AdminBindSubscription(req.UserId, req.PlanId, "")
 	if err != nil {
 		common.ApiError(c, err)
@@ -314,6 +376,7 @@ func AdminListUserSubscriptions(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.FillSubscriptionAllowances(subs)
 	common.ApiSuccess(c, subs)
 }
 
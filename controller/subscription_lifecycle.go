@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionPlanChangeRequest struct {
+	PlanId int `json:"plan_id"`
+}
+
+func getSelfSubscription(c *gin.Context) (*model.UserSubscription, bool) {
+	subId, _ := strconv.Atoi(c.Param("id"))
+	if subId <= 0 {
+		common.ApiErrorMsg(c, "无效的订阅ID")
+		return nil, false
+	}
+	sub, err := model.GetUserSubscriptionByIdForUser(c.GetInt("id"), subId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return sub, true
+}
+
+func getSubscriptionManager(method string) (payment.SubscriptionManager, bool) {
+	provider := payment.GetProvider(method)
+	if provider == nil {
+		return nil, false
+	}
+	manager, ok := provider.(payment.SubscriptionManager)
+	return manager, ok
+}
+
+// CancelSubscriptionRenewal stops auto-renew, the subscription stays usable until the period ends.
+func CancelSubscriptionRenewal(c *gin.Context) {
+	sub, ok := getSelfSubscription(c)
+	if !ok {
+		return
+	}
+	if sub.ProviderSubscriptionId == "" || !sub.AutoRenew {
+		common.ApiErrorMsg(c, "该订阅未开启自动续费")
+		return
+	}
+	manager, ok := getSubscriptionManager(sub.PaymentMethod)
+	if !ok {
+		common.ApiErrorMsg(c, "不支持的支付方式")
+		return
+	}
+	err := manager.SetCancelAtPeriodEnd(c.Request.Context(), sub.ProviderSubscriptionId, true)
+	if err != nil {
+		common.SysError(fmt.Sprintf("cancel provider subscription %s failed: %s", sub.ProviderSubscriptionId, err.Error()))
+		common.ApiErrorMsg(c, "取消自动续费失败，请稍后重试")
+		return
+	}
+	sub, err = model.SyncSubscriptionRenewalState(sub.ProviderSubscriptionId, true, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+// ResumeSubscriptionRenewal re-enables auto-renew for a subscription cancelled at period end.
+func ResumeSubscriptionRenewal(c *gin.Context) {
+	sub, ok := getSelfSubscription(c)
+	if !ok {
+		return
+	}
+	if sub.ProviderSubscriptionId == "" || !sub.CancelAtPeriodEnd {
+		common.ApiErrorMsg(c, "该订阅无需恢复自动续费")
+		return
+	}
+	if sub.Status != "active" || sub.EndTime <= common.GetTimestamp() {
+		common.ApiErrorMsg(c, "订阅已过期，请重新购买")
+		return
+	}
+	manager, ok := getSubscriptionManager(sub.PaymentMethod)
+	if !ok {
+		common.ApiErrorMsg(c, "该支付方式取消后无法恢复，请在到期后重新购买")
+		return
+	}
+	if err := manager.SetCancelAtPeriodEnd(c.Request.Context(), sub.ProviderSubscriptionId, false); err != nil {
+		if errors.Is(err, payment.ErrNotSupported) {
+			common.ApiErrorMsg(c, "该支付方式取消后无法恢复，请在到期后重新购买")
+			return
+		}
+		common.SysError(fmt.Sprintf("resume provider subscription %s failed: %s", sub.ProviderSubscriptionId, err.Error()))
+		common.ApiErrorMsg(c, "恢复自动续费失败，请稍后重试")
+		return
+	}
+	sub, err := model.SyncSubscriptionRenewalState(sub.ProviderSubscriptionId, false, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, sub)
+}
+
+// PreviewSubscriptionPlanChange returns the prorated price difference of switching plans.
+func PreviewSubscriptionPlanChange(c *gin.Context) {
+	sub, ok := getSelfSubscription(c)
+	if !ok {
+		return
+	}
+	planId, _ := strconv.Atoi(c.Query("plan_id"))
+	change, err := model.ChangeUserSubscriptionPlan(sub.UserId, sub.Id, planId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, change)
+}
+
+// ChangeSubscriptionPlan upgrades or downgrades a subscription, the price difference for the
+// remaining period is settled with the wallet balance.
+func ChangeSubscriptionPlan(c *gin.Context) {
+	if !operation_setting.GetSubscriptionSetting().PlanChangeEnabled {
+		common.ApiErrorMsg(c, "管理员未开启套餐变更")
+		return
+	}
+	sub, ok := getSelfSubscription(c)
+	if !ok {
+		return
+	}
+	var req SubscriptionPlanChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PlanId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	// 先校验并试算，避免支付渠道已变更而本地变更失败
+	if _, err := model.ChangeUserSubscriptionPlan(sub.UserId, sub.Id, req.PlanId, true); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if sub.AutoRenew && sub.ProviderSubscriptionId != "" {
+		plan, err := model.GetSubscriptionPlanById(req.PlanId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		manager, ok := getSubscriptionManager(sub.PaymentMethod)
+		if !ok {
+			common.ApiErrorMsg(c, "不支持的支付方式")
+			return
+		}
+		plan = localizeSubscriptionPlan(plan, sub.UserId, sub.PaymentMethod)
+		err = manager.ChangeSubscriptionPlan(c.Request.Context(), sub.ProviderSubscriptionId, plan)
+		if err != nil {
+			common.SysError(fmt.Sprintf("change provider subscription %s failed: %s", sub.ProviderSubscriptionId, err.Error()))
+			common.ApiErrorMsg(c, "变更自动续费套餐失败，请稍后重试")
+			return
+		}
+	}
+	change, err := model.ChangeUserSubscriptionPlan(sub.UserId, sub.Id, req.PlanId, false)
+	if err != nil {
+		if sub.AutoRenew && sub.ProviderSubscriptionId != "" {
+			common.SysError(fmt.Sprintf("provider subscription %s switched to plan %d but local change failed: %s",
+				sub.ProviderSubscriptionId, req.PlanId, err.Error()))
+		}
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, change)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
 	"github.com/Zer0Echo/uniapi/setting"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/gin-gonic/gin"
@@ -35,20 +36,12 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		return
 	}
 
-	plan, err := model.GetSubscriptionPlanById(req.PlanId)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
+	plan, user, ok := prepareSubscriptionPurchase(c, req.PlanId)
+	if !ok {
 		return
 	}
-	if !plan.Purchasable {
-		common.ApiErrorMsg(c, "该套餐不支持直接购买，请使用兑换码")
-		return
-	}
-	if plan.CreemProductId == "" {
+	localized := localizeSubscriptionPlan(plan, user.Id, PaymentMethodCreem)
+	if localized.CreemProductId == "" {
 		common.ApiErrorMsg(c, "该套餐未配置 CreemProductId")
 		return
 	}
@@ -57,76 +50,39 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		return
 	}
 
-	userId := c.GetInt("id")
-	user, err := model.GetUserById(userId, false)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	if user == nil {
-		common.ApiErrorMsg(c, "用户不存在")
-		return
-	}
-
-	if plan.MaxPurchasePerUser > 0 {
-		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
-		if err != nil {
-			common.ApiError(c, err)
-			return
-		}
-		if count >= int64(plan.MaxPurchasePerUser) {
-			common.ApiErrorMsg(c, "已达到该套餐购买上限")
-			return
-		}
-	}
-
 	reference := "sub-creem-ref-" + randstr.String(6)
 	referenceId := "sub_ref_" + common.Sha1([]byte(reference+time.Now().String()+user.Username))
 
-	// create pending order first
-	order := &model.SubscriptionOrder{
-		UserId:        userId,
-		PlanId:        plan.Id,
-		Money:         plan.PriceAmount,
-		TradeNo:       referenceId,
-		PaymentMethod: PaymentMethodCreem,
-		CreateTime:    time.Now().Unix(),
-		Status:        common.TopUpStatusPending,
-	}
-	if err := order.Insert(); err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
-		return
-	}
-
-	// Reuse Creem checkout generator by building a lightweight product reference.
 	currency := "USD"
-	switch operation_setting.GetGeneralSetting().QuotaDisplayType {
-	case operation_setting.QuotaDisplayTypeCNY:
+	if operation_setting.GetGeneralSetting().QuotaDisplayType == operation_setting.QuotaDisplayTypeCNY {
 		currency = "CNY"
-	case operation_setting.QuotaDisplayTypeUSD:
-		currency = "USD"
-	default:
-		currency = "USD"
 	}
-	product := &CreemProduct{
-		ProductId: plan.CreemProductId,
-		Name:      plan.Title,
-		Price:     plan.PriceAmount,
-		Currency:  currency,
-		Quota:     0,
+	if localized != plan {
+		currency = localized.Currency
 	}
-
-	checkoutUrl, err := genCreemLink(referenceId, product, user.Email, user.Username)
+	order := &model.SubscriptionOrder{
+		UserId:        user.Id,
+		PlanId:        localized.Id,
+		Money:         localized.PriceAmount,
+		Currency:      localized.Currency,
+		TradeNo:       referenceId,
+		PaymentMethod: PaymentMethodCreem,
+	}
+	result, err := startSubscriptionCheckout(c, payment.GetProvider(PaymentMethodCreem), order, &payment.CheckoutRequest{
+		Title:    localized.Title,
+		Currency: currency,
+		Plan:     localized,
+		User:     user,
+	})
 	if err != nil {
-		log.Printf("获取Creem支付链接失败: %v", err)
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
 		return
 	}
 
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"checkout_url": checkoutUrl,
+			"checkout_url": result.PayLink,
 			"order_id":     referenceId,
 		},
 	})
@@ -3,18 +3,15 @@ package controller
 import (
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 
 	"github.com/Calcium-Ion/go-epay/epay"
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/model"
-	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/payment"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/Zer0Echo/uniapi/setting/system_setting"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 )
 
 type SubscriptionEpayPayRequest struct {
@@ -29,17 +26,8 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		return
 	}
 
-	plan, err := model.GetSubscriptionPlanById(req.PlanId)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	if !plan.Enabled {
-		common.ApiErrorMsg(c, "套餐未启用")
-		return
-	}
-	if !plan.Purchasable {
-		common.ApiErrorMsg(c, "该套餐不支持直接购买，请使用兑换码")
+	plan, user, ok := prepareSubscriptionPurchase(c, req.PlanId)
+	if !ok {
 		return
 	}
 	if plan.PriceAmount < 0.01 {
@@ -50,166 +38,55 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		common.ApiErrorMsg(c, "支付方式不存在")
 		return
 	}
-
-	userId := c.GetInt("id")
-	if plan.MaxPurchasePerUser > 0 {
-		count, err := model.CountUserSubscriptionsByPlan(userId, plan.Id)
-		if err != nil {
-			common.ApiError(c, err)
-			return
-		}
-		if count >= int64(plan.MaxPurchasePerUser) {
-			common.ApiErrorMsg(c, "已达到该套餐购买上限")
-			return
-		}
-	}
-
-	callBackAddress := service.GetCallbackAddress()
-	returnUrl, err := url.Parse(callBackAddress + "/api/subscription/epay/return")
-	if err != nil {
-		common.ApiErrorMsg(c, "回调地址配置错误")
-		return
-	}
-	notifyUrl, err := url.Parse(callBackAddress + "/api/subscription/epay/notify")
-	if err != nil {
-		common.ApiErrorMsg(c, "回调地址配置错误")
+	provider := payment.GetProvider(payment.PaymentMethodEpay)
+	if !provider.IsEnabled() {
+		common.ApiErrorMsg(c, "当前管理员未配置支付信息")
 		return
 	}
 
 	tradeNo := fmt.Sprintf("%s%d", common.GetRandomString(6), time.Now().Unix())
-	tradeNo = fmt.Sprintf("SUBUSR%dNO%s", userId, tradeNo)
-
-	client := GetEpayClient()
-	if client == nil {
-		common.ApiErrorMsg(c, "当前管理员未配置支付信息")
-		return
-	}
+	tradeNo = fmt.Sprintf("SUBUSR%dNO%s", user.Id, tradeNo)
 
 	order := &model.SubscriptionOrder{
-		UserId:        userId,
+		UserId:        user.Id,
 		PlanId:        plan.Id,
 		Money:         plan.PriceAmount,
 		TradeNo:       tradeNo,
 		PaymentMethod: req.PaymentMethod,
-		CreateTime:    time.Now().Unix(),
-		Status:        common.TopUpStatusPending,
 	}
-	if err := order.Insert(); err != nil {
-		common.ApiErrorMsg(c, "创建订单失败")
-		return
-	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           req.PaymentMethod,
-		ServiceTradeNo: tradeNo,
-		Name:           fmt.Sprintf("SUB:%s", plan.Title),
-		Money:          strconv.FormatFloat(plan.PriceAmount, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
+	result, err := startSubscriptionCheckout(c, provider, order, &payment.CheckoutRequest{
+		Plan:    plan,
+		PayType: req.PaymentMethod,
+		User:    user,
 	})
 	if err != nil {
-		_ = model.ExpireSubscriptionOrder(tradeNo)
-		common.ApiErrorMsg(c, "拉起支付失败")
+		common.ApiErrorMsg(c, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "success", "data": params, "url": uri})
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": result.Params, "url": result.PayLink})
 }
 
 func SubscriptionEpayNotify(c *gin.Context) {
-	var params map[string]string
-
-	if c.Request.Method == "POST" {
-		// POST 请求：从 POST body 解析参数
-		if err := c.Request.ParseForm(); err != nil {
-			_, _ = c.Writer.Write([]byte("fail"))
-			return
-		}
-		params = lo.Reduce(lo.Keys(c.Request.PostForm), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.PostForm.Get(t)
-			return r
-		}, map[string]string{})
-	} else {
-		// GET 请求：从 URL Query 解析参数
-		params = lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.URL.Query().Get(t)
-			return r
-		}, map[string]string{})
-	}
-
-	if len(params) == 0 {
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	client := GetEpayClient()
-	if client == nil {
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-	verifyInfo, err := client.Verify(params)
-	if err != nil || !verifyInfo.VerifyStatus {
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	LockOrder(verifyInfo.ServiceTradeNo)
-	defer UnlockOrder(verifyInfo.ServiceTradeNo)
-
-	if err := model.CompleteSubscriptionOrder(verifyInfo.ServiceTradeNo, common.GetJsonString(verifyInfo)); err != nil {
-		_, _ = c.Writer.Write([]byte("fail"))
-		return
-	}
-
-	_, _ = c.Writer.Write([]byte("success"))
+	handlePaymentWebhook(c, payment.PaymentMethodEpay)
 }
 
 // SubscriptionEpayReturn handles browser return after payment.
 // It verifies the payload and completes the order, then redirects to console.
 func SubscriptionEpayReturn(c *gin.Context) {
-	var params map[string]string
-
-	if c.Request.Method == "POST" {
-		// POST 请求：从 POST body 解析参数
-		if err := c.Request.ParseForm(); err != nil {
-			c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=fail")
-			return
-		}
-		params = lo.Reduce(lo.Keys(c.Request.PostForm), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.PostForm.Get(t)
-			return r
-		}, map[string]string{})
-	} else {
-		// GET 请求：从 URL Query 解析参数
-		params = lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-			r[t] = c.Request.URL.Query().Get(t)
-			return r
-		}, map[string]string{})
-	}
-
-	if len(params) == 0 {
-		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=fail")
-		return
-	}
-
-	client := GetEpayClient()
-	if client == nil {
+	params, err := payment.ParseEpayParams(c)
+	if err != nil {
 		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=fail")
 		return
 	}
-	verifyInfo, err := client.Verify(params)
-	if err != nil || !verifyInfo.VerifyStatus {
+	verifyInfo, err := payment.VerifyEpayParams(params)
+	if err != nil {
 		c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=fail")
 		return
 	}
 	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
 		LockOrder(verifyInfo.ServiceTradeNo)
 		defer UnlockOrder(verifyInfo.ServiceTradeNo)
-		if err := model.CompleteSubscriptionOrder(verifyInfo.ServiceTradeNo, common.GetJsonString(verifyInfo)); err != nil {
+		if err := model.CompleteSubscriptionOrder(verifyInfo.ServiceTradeNo, common.GetJsonString(verifyInfo), ""); err != nil {
 			c.Redirect(http.StatusFound, system_setting.ServerAddress+"/console/subscription?pay=fail")
 			return
 		}
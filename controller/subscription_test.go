@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
+
+	"gorm.io/gorm"
+)
+
+func setupTestExchangeRates(t *testing.T) {
+	t.Helper()
+	if err := model.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.ExchangeRate{}).Error; err != nil {
+		t.Fatalf("failed to reset exchange rates: %v", err)
+	}
+	for _, r := range []*model.ExchangeRate{
+		{Currency: "EUR", Rate: 0.92, Manual: true, Enabled: true},
+		{Currency: "JPY", Rate: 150, Manual: true, Enabled: true},
+		{Currency: "GBP", Rate: 0.79, Manual: true, Enabled: false},
+	} {
+		if err := r.Insert(); err != nil {
+			t.Fatalf("failed to create exchange rate: %v", err)
+		}
+	}
+	t.Cleanup(model.InvalidateExchangeRateCache)
+}
+
+func TestGetSubscriptionLocalPrice(t *testing.T) {
+	setupTestExchangeRates(t)
+	eur, _ := model.GetCurrencyInfo("EUR")
+	jpy, _ := model.GetCurrencyInfo("JPY")
+	usd, _ := model.GetCurrencyInfo("USD")
+
+	usdPlan := &model.SubscriptionPlan{Currency: "USD", PriceAmount: 9.99, CurrencyPrices: `[{"currency":"EUR","price_amount":8.5}]`}
+	eurPlan := &model.SubscriptionPlan{Currency: "EUR", PriceAmount: 9.2}
+	gbpPlan := &model.SubscriptionPlan{Currency: "GBP", PriceAmount: 10}
+	tests := []struct {
+		name       string
+		plan       *model.SubscriptionPlan
+		currency   *model.CurrencyInfo
+		wantAmount float64
+		wantNative bool
+	}{
+		{name: "configured currency price", plan: usdPlan, currency: eur, wantAmount: 8.5, wantNative: true},
+		{name: "plan default currency", plan: usdPlan, currency: usd, wantAmount: 9.99, wantNative: true},
+		{name: "estimate from usd rounds to cents", plan: usdPlan, currency: jpy, wantAmount: 1498.5},
+		{name: "estimate converts non usd plan currency", plan: eurPlan, currency: jpy, wantAmount: 1500},
+		{name: "non usd plan to usd", plan: eurPlan, currency: usd, wantAmount: 10},
+		{name: "disabled plan currency treated as usd", plan: gbpPlan, currency: eur, wantAmount: 9.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getSubscriptionLocalPrice(tt.plan, tt.currency)
+			if got.Amount != tt.wantAmount || got.Native != tt.wantNative || got.Currency != tt.currency.Code {
+				t.Fatalf("unexpected local price %+v, want amount=%v native=%v", got, tt.wantAmount, tt.wantNative)
+			}
+		})
+	}
+}
+
+func TestLocalizeSubscriptionPlan(t *testing.T) {
+	setupTestExchangeRates(t)
+	plan := &model.SubscriptionPlan{
+		Currency:       "USD",
+		PriceAmount:    10,
+		StripePriceId:  "price_usd",
+		CurrencyPrices: `[{"currency":"EUR","price_amount":9.5,"stripe_price_id":"price_eur"}]`,
+	}
+	newUser := func(currency string) int {
+		user := createTestUser(t, 0)
+		user.SetSetting(dto.UserSetting{DisplayCurrency: currency})
+		if err := model.DB.Model(user).Update("setting", user.Setting).Error; err != nil {
+			t.Fatalf("failed to save user setting: %v", err)
+		}
+		return user.Id
+	}
+	eurUser := newUser("EUR")
+
+	if got := localizeSubscriptionPlan(plan, eurUser, PaymentMethodStripe); got.Currency != "EUR" || got.PriceAmount != 9.5 || got.StripePriceId != "price_eur" {
+		t.Fatalf("unexpected stripe plan %+v", got)
+	}
+	// 易支付只支持默认货币
+	if got := localizeSubscriptionPlan(plan, eurUser, payment.PaymentMethodEpay); got != plan {
+		t.Fatalf("expected epay to keep the default plan, got %+v", got)
+	}
+	// 未单独定价或已停用的展示货币使用套餐默认货币
+	for _, currency := range []string{"JPY", "GBP", ""} {
+		if got := localizeSubscriptionPlan(plan, newUser(currency), PaymentMethodCreem); got != plan {
+			t.Fatalf("expected default plan for %q, got %+v", currency, got)
+		}
+	}
+}
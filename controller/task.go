@@ -117,7 +117,11 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		return errors.New("adaptor not found")
 	}
 	proxy := channel.GetSetting().Proxy
-	resp, err := adaptor.FetchTask(*channel.BaseURL, channel.Key, map[string]any{
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		return err
+	}
+	resp, err := adaptor.FetchTask(*channel.BaseURL, plainKey, map[string]any{
 		"ids": taskIds,
 	}, proxy)
 	if err != nil {
@@ -151,37 +155,40 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			continue
 		}
 
+		// 以读取时的状态与额度为条件保存，被管理员并发取消或退款时不再重复退还
+		preStatus, preQuota := task.Status, task.Quota
 		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
 		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
 		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
 		task.StartTime = lo.If(responseItem.StartTime != 0, responseItem.StartTime).Else(task.StartTime)
 		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
+		shouldRefund := false
 		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
 			logger.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
 			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				logger.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, logger.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
+			// 已是失败状态的任务（如重新查询）此前已经退款
+			shouldRefund = preQuota != 0 && preStatus != model.TaskStatusFailure
 		}
 		if responseItem.Status == model.TaskStatusSuccess {
 			task.Progress = "100%"
 		}
 		task.Data = responseItem.Data
 
-		err = task.Update()
+		won, err := task.UpdateWithStatus(preStatus, preQuota)
 		if err != nil {
 			common.SysLog("UpdateMidjourneyTask task error: " + err.Error())
+			continue
+		}
+		if !won {
+			logger.LogWarn(ctx, fmt.Sprintf("任务 %s 已被并发修改，跳过本次更新", task.TaskID))
+			continue
+		}
+		if shouldRefund {
+			if err := task.RefundQuota(preQuota); err != nil {
+				logger.LogError(ctx, "fail to increase user quota: "+err.Error())
+			}
+			logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, logger.LogQuota(preQuota))
+			model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
 		}
 	}
 	return nil
@@ -0,0 +1,382 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量操作单次最多处理的任务数
+const taskAdminBulkLimit = 500
+
+const (
+	TaskAdminActionRepoll = "repoll"
+	TaskAdminActionCancel = "cancel"
+	TaskAdminActionRefund = "refund"
+)
+
+type TaskAdminCancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+type TaskAdminResultRequest struct {
+	Status   model.TaskStatus `json:"status"`
+	Url      string           `json:"url"`
+	Reason   string           `json:"reason"`
+	Progress string           `json:"progress"`
+}
+
+type TaskAdminBulkRequest struct {
+	Action         string                `json:"action"`
+	Platform       constant.TaskPlatform `json:"platform"`
+	ChannelId      int                   `json:"channel_id"`
+	Status         string                `json:"status"`
+	StartTimestamp int64                 `json:"start_timestamp"`
+	EndTimestamp   int64                 `json:"end_timestamp"`
+	Reason         string                `json:"reason"`
+}
+
+type TaskAdminBulkResult struct {
+	Total   int      `json:"total"`
+	Success int      `json:"success"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func getAdminTask(c *gin.Context) (*model.Task, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, errors.New("无效的任务 ID")
+	}
+	task, err := model.GetTaskById(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Platform == constant.TaskPlatformMidjourney {
+		return nil, errors.New("Midjourney 任务由绘图任务轮询维护，请在绘图日志中处理")
+	}
+	model.AuditTarget(c, "task", task.ID)
+	model.AuditBefore(c, taskAuditSnapshot(task))
+	return task, nil
+}
+
+// taskAuditSnapshot 审计记录只保留管理操作会改变的字段，不包含任务结果数据
+func taskAuditSnapshot(task *model.Task) map[string]any {
+	return map[string]any{
+		"status":      task.Status,
+		"progress":    task.Progress,
+		"quota":       task.Quota,
+		"fail_reason": task.FailReason,
+	}
+}
+
+func recordTaskManageLog(c *gin.Context, task *model.Task, content string) {
+	model.RecordLog(task.UserId, model.LogTypeManage, fmt.Sprintf("管理员 %s(#%d) %s，任务 %s（平台 %s，渠道 #%d）",
+		c.GetString("username"), c.GetInt("id"), content, task.TaskID, task.Platform, task.ChannelId))
+}
+
+func isTaskFinished(task *model.Task) bool {
+	return task.Status == model.TaskStatusSuccess || task.Status == model.TaskStatusFailure
+}
+
+// errTaskChanged 任务在读取后已被轮询或其他管理员修改
+var errTaskChanged = errors.New("任务状态已变化，请刷新后重试")
+
+// saveAdminTask 仅当任务的状态与额度仍是读取时的值才保存，之后才能退款或补扣，防止与轮询重复退还
+func saveAdminTask(task *model.Task, preStatus model.TaskStatus, preQuota int) error {
+	won, err := task.UpdateWithStatus(preStatus, preQuota)
+	if err != nil {
+		return err
+	}
+	if !won {
+		return errTaskChanged
+	}
+	return nil
+}
+
+// refundTaskQuota 退还任务已扣的额度，调用方需先通过 saveAdminTask 将任务置为失败或清零额度
+func refundTaskQuota(task *model.Task, quota int) (int, error) {
+	if quota <= 0 {
+		return 0, nil
+	}
+	if err := task.RefundQuota(quota); err != nil {
+		return 0, fmt.Errorf("任务已更新，但退还额度失败: %w", err)
+	}
+	return quota, nil
+}
+
+// repollTask 立即向渠道重新查询任务状态，沿用轮询的更新与退款逻辑
+func repollTask(ctx context.Context, task *model.Task) error {
+	if task.TaskID == "" {
+		return errors.New("任务没有上游任务 ID，无法重新查询")
+	}
+	taskM := map[string]*model.Task{task.TaskID: task}
+	switch task.Platform {
+	case constant.TaskPlatformSuno:
+		return updateSunoTaskAll(ctx, task.ChannelId, []string{task.TaskID}, taskM)
+	default:
+		ch, err := model.CacheGetChannel(task.ChannelId)
+		if err != nil {
+			return fmt.Errorf("获取渠道 #%d 失败: %w", task.ChannelId, err)
+		}
+		adaptor, err := newVideoTaskAdaptor(task.Platform, ch)
+		if err != nil {
+			return err
+		}
+		return updateVideoSingleTask(ctx, adaptor, ch, task.TaskID, taskM)
+	}
+}
+
+func adminRepollTask(c *gin.Context, task *model.Task) error {
+	preStatus, preQuota := task.Status, task.Quota
+	if err := repollTask(c.Request.Context(), task); err != nil {
+		return err
+	}
+	content := fmt.Sprintf("重新查询任务状态，%s -> %s", preStatus, task.Status)
+	if charged := chargeRepolledTask(c, task, preStatus, preQuota); charged > 0 {
+		content += "，补扣 " + logger.LogQuota(charged)
+	}
+	recordTaskManageLog(c, task, content)
+	return nil
+}
+
+// chargeRepolledTask 失败的任务退款时已退还 preQuota，重新查询后只要不再是失败状态就先补扣 preQuota：
+// 之后轮询失败会按常规流程再次退款，成功时的结算差额也是以 preQuota 已付为前提计算的。返回补扣的额度
+func chargeRepolledTask(ctx context.Context, task *model.Task, preStatus model.TaskStatus, preQuota int) int {
+	if preStatus != model.TaskStatusFailure || task.Status == model.TaskStatusFailure || preQuota <= 0 {
+		return 0
+	}
+	if err := task.ChargeQuota(preQuota); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("任务 %s 重新查询后补扣费失败: %s", task.TaskID, err.Error()))
+		return 0
+	}
+	return preQuota
+}
+
+func adminCancelTask(c *gin.Context, task *model.Task, reason string) error {
+	if isTaskFinished(task) {
+		return fmt.Errorf("任务已结束（%s），无法取消", task.Status)
+	}
+	preStatus, preQuota := task.Status, task.Quota
+	if reason == "" {
+		reason = "cancelled by admin"
+	}
+	task.Status = model.TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	if task.FinishTime == 0 {
+		task.FinishTime = time.Now().Unix()
+	}
+	if err := saveAdminTask(task, preStatus, preQuota); err != nil {
+		return err
+	}
+	quota, err := refundTaskQuota(task, preQuota)
+	if err != nil {
+		return err
+	}
+	recordTaskManageLog(c, task, fmt.Sprintf("取消任务（原状态 %s，原因：%s），退还 %s", preStatus, reason, logger.LogQuota(quota)))
+	return nil
+}
+
+func adminRefundTask(c *gin.Context, task *model.Task) error {
+	if task.Status == model.TaskStatusFailure {
+		return errors.New("失败的任务已自动退款")
+	}
+	if task.Quota <= 0 {
+		return errors.New("任务没有可退还的额度")
+	}
+	preStatus, preQuota := task.Status, task.Quota
+	// 额度清零后轮询失败时不会再次退还，成功时也不再按用量或按秒结算
+	task.Quota = 0
+	task.Properties.Refunded = true
+	if task.Properties.VideoPricing != nil {
+		task.Properties.VideoPricing.Settled = true
+	}
+	if err := saveAdminTask(task, preStatus, preQuota); err != nil {
+		return err
+	}
+	quota, err := refundTaskQuota(task, preQuota)
+	if err != nil {
+		return err
+	}
+	recordTaskManageLog(c, task, fmt.Sprintf("强制退款（状态 %s），退还 %s", task.Status, logger.LogQuota(quota)))
+	return nil
+}
+
+func adminTaskAction(c *gin.Context, action string, task *model.Task, reason string) error {
+	switch action {
+	case TaskAdminActionRepoll:
+		return adminRepollTask(c, task)
+	case TaskAdminActionCancel:
+		return adminCancelTask(c, task, reason)
+	case TaskAdminActionRefund:
+		return adminRefundTask(c, task)
+	default:
+		return fmt.Errorf("不支持的操作: %s", action)
+	}
+}
+
+func AdminRepollTask(c *gin.Context) {
+	task, err := getAdminTask(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := adminRepollTask(c, task); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditAfter(c, taskAuditSnapshot(task))
+	common.ApiSuccess(c, task)
+}
+
+func AdminCancelTask(c *gin.Context) {
+	var req TaskAdminCancelRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		common.ApiError(c, err)
+		return
+	}
+	task, err := getAdminTask(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := adminCancelTask(c, task, req.Reason); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditAfter(c, taskAuditSnapshot(task))
+	common.ApiSuccess(c, task)
+}
+
+func AdminRefundTask(c *gin.Context) {
+	task, err := getAdminTask(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := adminRefundTask(c, task); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditAfter(c, taskAuditSnapshot(task))
+	common.ApiSuccess(c, task)
+}
+
+// AdminSetTaskResult 手动设置任务结果，状态在成功与失败之间变化时同步退款或补扣
+func AdminSetTaskResult(c *gin.Context) {
+	var req TaskAdminResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status != model.TaskStatusSuccess && req.Status != model.TaskStatusFailure {
+		common.ApiErrorMsg(c, "状态只能设置为 SUCCESS 或 FAILURE")
+		return
+	}
+	task, err := getAdminTask(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	preStatus, preQuota := task.Status, task.Quota
+	task.Status = req.Status
+	task.Progress = "100%"
+	if req.Progress != "" {
+		task.Progress = req.Progress
+	}
+	if req.Status == model.TaskStatusSuccess {
+		task.FailReason = req.Url
+	} else {
+		task.FailReason = req.Reason
+	}
+	if task.FinishTime == 0 {
+		task.FinishTime = time.Now().Unix()
+	}
+	if err := saveAdminTask(task, preStatus, preQuota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	quotaChange := ""
+	if req.Status == model.TaskStatusFailure && preStatus != model.TaskStatusFailure {
+		quota, err := refundTaskQuota(task, preQuota)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		quotaChange = "，退还 " + logger.LogQuota(quota)
+	} else if req.Status == model.TaskStatusSuccess && preStatus == model.TaskStatusFailure && preQuota > 0 {
+		if err := task.ChargeQuota(preQuota); err != nil {
+			common.ApiError(c, fmt.Errorf("任务已更新，但补扣额度失败: %w", err))
+			return
+		}
+		quotaChange = "，补扣 " + logger.LogQuota(preQuota)
+	}
+	recordTaskManageLog(c, task, fmt.Sprintf("手动设置任务结果，%s -> %s，结果：%s%s", preStatus, task.Status, task.FailReason, quotaChange))
+	model.AuditAfter(c, taskAuditSnapshot(task))
+	common.ApiSuccess(c, task)
+}
+
+// AdminBulkTask 按平台、渠道与提交时间范围批量重新查询、取消或退款
+func AdminBulkTask(c *gin.Context) {
+	var req TaskAdminBulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	switch req.Action {
+	case TaskAdminActionRepoll, TaskAdminActionCancel, TaskAdminActionRefund:
+	default:
+		common.ApiErrorMsg(c, "不支持的操作: "+req.Action)
+		return
+	}
+	if req.Platform == "" && req.ChannelId == 0 && req.StartTimestamp == 0 && req.EndTimestamp == 0 {
+		common.ApiErrorMsg(c, "批量操作至少需要指定平台、渠道或时间范围之一")
+		return
+	}
+	if req.Platform == constant.TaskPlatformMidjourney {
+		common.ApiErrorMsg(c, "Midjourney 任务由绘图任务轮询维护，请在绘图日志中处理")
+		return
+	}
+	queryParams := model.SyncTaskQueryParams{
+		Platform:       req.Platform,
+		Status:         req.Status,
+		StartTimestamp: req.StartTimestamp,
+		EndTimestamp:   req.EndTimestamp,
+	}
+	if req.ChannelId != 0 {
+		queryParams.ChannelID = strconv.Itoa(req.ChannelId)
+	}
+	tasks := model.TaskGetAllTasks(0, taskAdminBulkLimit, queryParams)
+
+	result := TaskAdminBulkResult{}
+	for _, task := range tasks {
+		if task.Platform == constant.TaskPlatformMidjourney {
+			continue
+		}
+		// 批量操作跳过不适用的任务，而不是记为失败
+		if req.Action == TaskAdminActionCancel && isTaskFinished(task) {
+			continue
+		}
+		if req.Action == TaskAdminActionRefund && (task.Quota <= 0 || task.Status == model.TaskStatusFailure) {
+			continue
+		}
+		result.Total++
+		if err := adminTaskAction(c, req.Action, task, req.Reason); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", task.TaskID, err.Error()))
+			continue
+		}
+		result.Success++
+	}
+	common.ApiSuccess(c, result)
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/service"
+	"github.com/Zer0Echo/uniapi/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubTaskAdaptor 返回预设的上游任务结果
+type stubTaskAdaptor struct {
+	channel.TaskAdaptor
+	result *relaycommon.TaskInfo
+}
+
+func (a *stubTaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy string) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"model":"test-video-model"}`))}, nil
+}
+
+func (a *stubTaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	return a.result, nil
+}
+
+func newTestTask(t *testing.T, userId int, quota int, status model.TaskStatus) *model.Task {
+	t.Helper()
+	task := &model.Task{
+		Platform: constant.TaskPlatform("test"),
+		TaskID:   "task_" + t.Name(),
+		UserId:   userId,
+		Quota:    quota,
+		Status:   status,
+		Group:    "default",
+		Data:     []byte(`{"model":"test-video-model"}`),
+	}
+	if err := model.DB.Create(task).Error; err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	return task
+}
+
+// pollTestTask 模拟一次轮询，上游返回 result
+func pollTestTask(t *testing.T, task *model.Task, result *relaycommon.TaskInfo) {
+	t.Helper()
+	adaptor := &stubTaskAdaptor{result: result}
+	ch := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-test"}
+	err := updateVideoSingleTask(context.Background(), adaptor, ch, task.TaskID, map[string]*model.Task{task.TaskID: task})
+	if err != nil {
+		t.Fatalf("updateVideoSingleTask: %v", err)
+	}
+}
+
+func newTaskAdminContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	return c
+}
+
+func TestAdminRefundTaskSkipsRebillOnSuccess(t *testing.T) {
+	// 按 token 重新计费需要模型配置倍率
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{"test-video-model":1}`); err != nil {
+		t.Fatalf("failed to set model ratio: %v", err)
+	}
+	// 已预扣 100，用户剩余 900
+	user := createTestUser(t, 900)
+	task := newTestTask(t, user.Id, 100, model.TaskStatusInProgress)
+
+	if err := adminRefundTask(newTaskAdminContext(), task); err != nil {
+		t.Fatalf("adminRefundTask: %v", err)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after refund = %d, want 1000", got)
+	}
+
+	// 退款后任务成功，且上游返回了 token 用量，不应再按用量补扣
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%", TotalTokens: 5000})
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after success = %d, want 1000", got)
+	}
+	if task.Quota != 0 || !task.Properties.Refunded {
+		t.Fatalf("task quota = %d, refunded = %v", task.Quota, task.Properties.Refunded)
+	}
+}
+
+func TestRepollFailedTaskChargesWhenItResumes(t *testing.T) {
+	// 任务被误判失败，预扣的 100 已经退还
+	user := createTestUser(t, 1000)
+	task := newTestTask(t, user.Id, 100, model.TaskStatusFailure)
+
+	// 重新查询发现任务仍在进行中，应补扣 100
+	preStatus, preQuota := task.Status, task.Quota
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusInProgress})
+	chargeRepolledTask(context.Background(), task, preStatus, preQuota)
+	if got := getTestUserQuota(t, user.Id); got != 900 {
+		t.Fatalf("quota after repoll = %d, want 900", got)
+	}
+
+	// 之后轮询成功，不再重复扣费
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%"})
+	if got := getTestUserQuota(t, user.Id); got != 900 {
+		t.Fatalf("quota after success = %d, want 900", got)
+	}
+}
+
+func TestRepollFailedTaskRefundsAgainOnFailure(t *testing.T) {
+	user := createTestUser(t, 1000)
+	task := newTestTask(t, user.Id, 100, model.TaskStatusFailure)
+
+	preStatus, preQuota := task.Status, task.Quota
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusInProgress})
+	chargeRepolledTask(context.Background(), task, preStatus, preQuota)
+
+	// 恢复后再次失败，按常规流程退还
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusFailure, Reason: "upstream failed"})
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after failure = %d, want 1000", got)
+	}
+
+	// 仍为失败时重新查询不扣费
+	preStatus, preQuota = task.Status, task.Quota
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusFailure, Reason: "upstream failed"})
+	chargeRepolledTask(context.Background(), task, preStatus, preQuota)
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after repeated failure = %d, want 1000", got)
+	}
+}
+
+func TestAdminRefundAndPollerFailureRefundOnce(t *testing.T) {
+	user := createTestUser(t, 900)
+	task := newTestTask(t, user.Id, 100, model.TaskStatusInProgress)
+	// 轮询已读取任务，随后管理员强制退款
+	polled, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskById: %v", err)
+	}
+	if err := adminRefundTask(newTaskAdminContext(), task); err != nil {
+		t.Fatalf("adminRefundTask: %v", err)
+	}
+
+	// 轮询基于过期的读取结果发现上游失败，不应再次退还
+	pollTestTask(t, polled, &relaycommon.TaskInfo{Status: model.TaskStatusFailure, Reason: "upstream failed"})
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after stale poll = %d, want 1000", got)
+	}
+
+	// 下一轮轮询读取到最新的任务，额度已清零也不再退还
+	fresh, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskById: %v", err)
+	}
+	pollTestTask(t, fresh, &relaycommon.TaskInfo{Status: model.TaskStatusFailure, Reason: "upstream failed"})
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after failure = %d, want 1000", got)
+	}
+	if fresh, _ = model.GetTaskById(task.ID); fresh.Status != model.TaskStatusFailure {
+		t.Fatalf("task status = %s, want FAILURE", fresh.Status)
+	}
+}
+
+func TestAdminCancelAfterPollerFailureRefundsOnce(t *testing.T) {
+	user := createTestUser(t, 900)
+	task := newTestTask(t, user.Id, 100, model.TaskStatusInProgress)
+	stale, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskById: %v", err)
+	}
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusFailure, Reason: "upstream failed"})
+
+	// 管理员基于过期的读取结果取消任务，应提示刷新而不是再次退还
+	if err := adminCancelTask(newTaskAdminContext(), stale, ""); err != errTaskChanged {
+		t.Fatalf("adminCancelTask = %v, want errTaskChanged", err)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 1000 {
+		t.Fatalf("quota after cancel = %d, want 1000", got)
+	}
+}
+
+func TestRepollFailedSunoTaskChargesOnSuccess(t *testing.T) {
+	service.InitHttpClient()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/suno/fetch" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `{"code":"success","data":[{"task_id":"suno_repoll","status":"SUCCESS","finish_time":1700000000,"data":{"clips":[]}}]}`)
+	}))
+	t.Cleanup(server.Close)
+	ch := &model.Channel{Type: constant.ChannelTypeSunoAPI, Key: "sk-test", BaseURL: &server.URL, Name: "suno", Status: common.ChannelStatusEnabled}
+	if err := model.DB.Create(ch).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+
+	// 误判为失败的 Suno 任务已经退款
+	user := createTestUser(t, 1000)
+	task := &model.Task{Platform: constant.TaskPlatformSuno, TaskID: "suno_repoll", UserId: user.Id, ChannelId: ch.Id,
+		Quota: 100, Status: model.TaskStatusFailure, Progress: "100%", FailReason: "timeout"}
+	if err := model.DB.Create(task).Error; err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+
+	c := newTaskAdminContext()
+	c.Set("username", "admin")
+	if err := adminRepollTask(c, task); err != nil {
+		t.Fatalf("adminRepollTask: %v", err)
+	}
+	if task.Status != model.TaskStatusSuccess {
+		t.Fatalf("task status = %s, want SUCCESS", task.Status)
+	}
+	if got := getTestUserQuota(t, user.Id); got != 900 {
+		t.Fatalf("quota after repoll = %d, want 900", got)
+	}
+	var log model.Log
+	if err := model.LOG_DB.Where("user_id = ? AND type = ?", user.Id, model.LogTypeManage).Last(&log).Error; err != nil {
+		t.Fatalf("manage log not recorded: %v", err)
+	}
+	if !strings.Contains(log.Content, "补扣") {
+		t.Fatalf("expected manage log to mention the charge, got %q", log.Content)
+	}
+}
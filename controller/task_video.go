@@ -44,16 +44,10 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 		}
 		return fmt.Errorf("CacheGetChannel failed: %w", err)
 	}
-	adaptor := relay.GetTaskAdaptor(platform)
-	if adaptor == nil {
-		return fmt.Errorf("video adaptor not found")
-	}
-	info := &relaycommon.RelayInfo{}
-	info.ChannelMeta = &relaycommon.ChannelMeta{
-		ChannelBaseUrl: cacheGetChannel.GetBaseURL(),
+	adaptor, err := newVideoTaskAdaptor(platform, cacheGetChannel)
+	if err != nil {
+		return err
 	}
-	info.ApiKey = cacheGetChannel.Key
-	adaptor.Init(info)
 	for _, taskId := range taskIds {
 		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
 			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
@@ -62,6 +56,24 @@ func updateVideoTaskAll(ctx context.Context, platform constant.TaskPlatform, cha
 	return nil
 }
 
+func newVideoTaskAdaptor(platform constant.TaskPlatform, ch *model.Channel) (channel.TaskAdaptor, error) {
+	adaptor := relay.GetTaskAdaptor(platform)
+	if adaptor == nil {
+		return nil, fmt.Errorf("video adaptor not found")
+	}
+	info := &relaycommon.RelayInfo{}
+	info.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelBaseUrl: ch.GetBaseURL(),
+	}
+	plainKey, err := ch.GetPlainKey()
+	if err != nil {
+		return nil, err
+	}
+	info.ApiKey = plainKey
+	adaptor.Init(info)
+	return adaptor, nil
+}
+
 func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, channel *model.Channel, taskId string, taskM map[string]*model.Task) error {
 	baseURL := constant.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() != "" {
@@ -74,7 +86,10 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 		logger.LogError(ctx, fmt.Sprintf("Task %s not found in taskM", taskId))
 		return fmt.Errorf("task %s not found", taskId)
 	}
-	key := channel.Key
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return err
+	}
 
 	privateData := task.PrivateData
 	if privateData.Key != "" {
@@ -126,6 +141,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 
 	// 记录原本的状态，防止重复退款
 	shouldRefund := false
+	var settlement *taskQuotaSettlement
 	quota := task.Quota
 	preStatus := task.Status
 
@@ -149,8 +165,12 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 			task.FailReason = taskResult.Url
 		}
 
-		// 如果返回了 total_tokens 并且配置了模型倍率(非固定价格),则重新计费
-		if taskResult.TotalTokens > 0 {
+		// 配置了视频按秒计费的任务按实际时长、分辨率结算；否则如果返回了 total_tokens 并且配置了模型倍率(非固定价格),则重新计费
+		if task.Properties.VideoPricing != nil {
+			if preStatus != model.TaskStatusSuccess {
+				settlement = settleVideoTaskPricing(ctx, task, taskResult)
+			}
+		} else if taskResult.TotalTokens > 0 && !task.Properties.Refunded {
 			// 获取模型名称
 			var taskData map[string]interface{}
 			if err := json.Unmarshal(task.Data, &taskData); err == nil {
@@ -185,49 +205,28 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 							preConsumedQuota := task.Quota
 							quotaDelta := actualQuota - preConsumedQuota
 
-							if quotaDelta > 0 {
-								// 需要补扣费
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后补扣费：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
+							if quotaDelta != 0 {
+								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 按 tokens 结算差额：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
 									task.TaskID,
 									logger.LogQuota(quotaDelta),
 									logger.LogQuota(actualQuota),
 									logger.LogQuota(preConsumedQuota),
 									taskResult.TotalTokens,
 								))
-								if err := model.DecreaseUserQuota(task.UserId, quotaDelta); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("补扣费失败: %s", err.Error()))
-								} else {
-									model.UpdateUserUsedQuotaAndRequestCount(task.UserId, quotaDelta)
-									model.UpdateChannelUsedQuota(task.ChannelId, quotaDelta)
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
-
-									// 记录消费日志
-									logContent := fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
+								task.Quota = actualQuota // 更新任务记录的实际扣费额度
+								settlement = &taskQuotaSettlement{delta: quotaDelta, record: func() {
+									var logContent string
+									if quotaDelta > 0 {
+										logContent = fmt.Sprintf("视频任务成功补扣费，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，补扣费 %s",
+											modelRatio, finalGroupRatio, taskResult.TotalTokens,
+											logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
+									} else {
+										logContent = fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
+											modelRatio, finalGroupRatio, taskResult.TotalTokens,
+											logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(-quotaDelta))
+									}
 									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-								}
-							} else if quotaDelta < 0 {
-								// 需要退还多扣的费用
-								refundQuota := -quotaDelta
-								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费后返还：%s（实际消耗：%s，预扣费：%s，tokens：%d）",
-									task.TaskID,
-									logger.LogQuota(refundQuota),
-									logger.LogQuota(actualQuota),
-									logger.LogQuota(preConsumedQuota),
-									taskResult.TotalTokens,
-								))
-								if err := model.IncreaseUserQuota(task.UserId, refundQuota, false); err != nil {
-									logger.LogError(ctx, fmt.Sprintf("退还预扣费失败: %s", err.Error()))
-								} else {
-									task.Quota = actualQuota // 更新任务记录的实际扣费额度
-
-									// 记录退款日志
-									logContent := fmt.Sprintf("视频任务成功退还多扣费用，模型倍率 %.2f，分组倍率 %.2f，tokens %d，预扣费 %s，实际扣费 %s，退还 %s",
-										modelRatio, finalGroupRatio, taskResult.TotalTokens,
-										logger.LogQuota(preConsumedQuota), logger.LogQuota(actualQuota), logger.LogQuota(refundQuota))
-									model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-								}
+								}}
 							} else {
 								// quotaDelta == 0, 预扣费刚好准确
 								logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 预扣费准确（%s，tokens：%d）",
@@ -261,14 +260,24 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	if taskResult.Progress != "" {
 		task.Progress = taskResult.Progress
 	}
-	if err := task.Update(); err != nil {
+	// 管理员可能同时取消或退款，只有状态与额度未被修改时才保存并退款
+	won, err := task.UpdateWithStatus(preStatus, quota)
+	if err != nil {
 		common.SysLog("UpdateVideoTask task error: " + err.Error())
-		shouldRefund = false
+		return nil
+	}
+	if !won {
+		logger.LogWarn(ctx, fmt.Sprintf("Task %s was modified concurrently, skip this update", task.TaskID))
+		return nil
 	}
 
+	if settlement != nil {
+		// 结算结果已随任务保存，再调整额度，保存失败或被并发修改时不会重复结算
+		applyTaskQuotaSettlement(ctx, task, settlement)
+	}
 	if shouldRefund {
 		// 任务失败且之前状态不是失败才退还额度，防止重复退还
-		if err := model.IncreaseUserQuota(task.UserId, quota, false); err != nil {
+		if err := task.RefundQuota(quota); err != nil {
 			logger.LogWarn(ctx, "Failed to increase user quota: "+err.Error())
 		}
 		logContent := fmt.Sprintf("Video async task failed %s, refund %s", task.TaskID, logger.LogQuota(quota))
@@ -278,6 +287,104 @@ func updateVideoSingleTask(ctx context.Context, adaptor channel.TaskAdaptor, cha
 	return nil
 }
 
+// taskQuotaSettlement 任务成功后多退少补的差额，delta 为负数时退还；record 在额度调整成功后记录日志
+type taskQuotaSettlement struct {
+	delta  int
+	record func()
+}
+
+// applyTaskQuotaSettlement 按差额调整付款方、令牌剩余额度与用户、渠道的已用额度
+func applyTaskQuotaSettlement(ctx context.Context, task *model.Task, settlement *taskQuotaSettlement) {
+	delta := settlement.delta
+	var err error
+	if delta > 0 {
+		err = task.ChargeQuota(delta)
+	} else {
+		err = task.RefundQuota(-delta)
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("任务 %s 结算差额 %s 失败: %s", task.TaskID, logger.LogQuota(delta), err.Error()))
+		return
+	}
+	if err := task.AdjustTokenQuota(delta); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("任务 %s 修正令牌额度失败: %s", task.TaskID, err.Error()))
+	}
+	model.UpdateUserUsedQuota(task.UserId, delta)
+	model.UpdateChannelUsedQuota(task.ChannelId, delta)
+	if settlement.record != nil {
+		settlement.record()
+	}
+}
+
+// settleVideoTaskPricing 按上游返回的实际时长、分辨率与音频重新计价，更新任务的额度与结算标记，
+// 返回需要多退少补的差额，由调用方在任务保存成功后调整额度
+func settleVideoTaskPricing(ctx context.Context, task *model.Task, taskResult *relaycommon.TaskInfo) *taskQuotaSettlement {
+	estimated := task.Properties.VideoPricing
+	if estimated.Settled {
+		return nil
+	}
+	modelName := task.Properties.OriginModelName
+	if modelName == "" {
+		modelName = task.Properties.UpstreamModelName
+	}
+	videoPrice, ok := ratio_setting.GetVideoPrice(modelName)
+	if !ok {
+		logger.LogWarn(ctx, fmt.Sprintf("视频任务 %s 的模型 %s 未配置按秒价格，跳过结算", task.TaskID, modelName))
+		return nil
+	}
+	seconds := taskResult.Duration
+	if seconds <= 0 {
+		seconds = estimated.Seconds
+	}
+	resolution := taskResult.Resolution
+	if resolution == "" {
+		resolution = estimated.Resolution
+	}
+	audio := estimated.Audio
+	if taskResult.HasAudio != nil {
+		audio = *taskResult.HasAudio
+	}
+	actual, err := videoPrice.Calculate(seconds, resolution, audio)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("视频任务 %s 结算失败，保留预扣费：%s", task.TaskID, err.Error()))
+		return nil
+	}
+	actualQuota := actual.ToQuota(estimated.GroupRatio)
+	actual.PreConsumeQuota = task.Quota
+	actual.Settled = true
+
+	quotaDelta := actualQuota - task.Quota
+	task.Quota = actualQuota
+	task.Properties.VideoPricing = &actual
+	logger.LogInfo(ctx, fmt.Sprintf("视频任务 %s 按秒结算（%s，实际扣费 %s）", task.TaskID, actual.String(), logger.LogQuota(actualQuota)))
+	if quotaDelta == 0 {
+		return nil
+	}
+	return &taskQuotaSettlement{delta: quotaDelta, record: func() {
+		// 差额作为一条消费日志记录，退还时为负数，使用量统计与账单按差额修正
+		logContent := fmt.Sprintf("视频任务 %s 按秒结算，%s，预扣费 %s，实际扣费 %s，差额 %s",
+			task.TaskID, actual.String(), logger.LogQuota(actual.PreConsumeQuota), logger.LogQuota(actualQuota), logger.LogQuota(quotaDelta))
+		username := ""
+		if cache, err := model.GetUserCache(task.UserId); err == nil {
+			username = cache.Username
+		}
+		model.RecordTaskConsumeLog(task.UserId, username, task.PrivateData.OrgId, task.PrivateData.ProjectId, model.RecordConsumeLogParams{
+			ChannelId: task.ChannelId,
+			ModelName: modelName,
+			Quota:     quotaDelta,
+			Content:   logContent,
+			TokenId:   task.PrivateData.TokenId,
+			Group:     task.Group,
+			Other: map[string]interface{}{
+				"task_id":           task.TaskID,
+				"video_pricing":     actual,
+				"settlement":        true,
+				"pre_consume_quota": actual.PreConsumeQuota,
+			},
+		})
+	}}
+}
+
 func redactVideoResponseBody(body []byte) []byte {
 	var m map[string]any
 	if err := json.Unmarshal(body, &m); err != nil {
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/model"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/setting/ratio_setting"
+)
+
+// waitConsumeLog 消费日志异步写入，等待任务对应的日志出现
+func waitConsumeLog(t *testing.T, userId int, modelName string) *model.Log {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		var log model.Log
+		err := model.LOG_DB.Where("user_id = ? AND type = ? AND model_name = ?", userId, model.LogTypeConsume, modelName).
+			First(&log).Error
+		if err == nil {
+			return &log
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("consume log was not recorded")
+	return nil
+}
+
+// newSettlementTestTask 创建按秒计费的视频任务，预扣 10 秒的费用，令牌与渠道的已用额度按预扣费初始化
+func newSettlementTestTask(t *testing.T, modelName string) (*model.Task, *model.Token, *model.Channel, int) {
+	t.Helper()
+	if err := ratio_setting.UpdateVideoPriceByJSONString(`{"` + modelName + `":{"per_second":{"720p":0.1}}}`); err != nil {
+		t.Fatalf("failed to set video price: %v", err)
+	}
+	t.Cleanup(func() { _ = ratio_setting.UpdateVideoPriceByJSONString("{}") })
+
+	preConsumed := int(10 * 0.1 * common.QuotaPerUnit)
+	user := createTestUser(t, 0)
+	if err := model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("used_quota", preConsumed).Error; err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	token := &model.Token{UserId: user.Id, Name: "video", Key: common.GetRandomString(48), RemainQuota: 1000, UsedQuota: preConsumed}
+	if err := model.DB.Create(token).Error; err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	ch := &model.Channel{Type: constant.ChannelTypeOpenAI, Key: "sk-test", Name: "video", UsedQuota: int64(preConsumed)}
+	if err := model.DB.Create(ch).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	task := newTestTask(t, user.Id, preConsumed, model.TaskStatusInProgress)
+	task.ChannelId = ch.Id
+	task.PrivateData.TokenId = token.Id
+	task.Properties.OriginModelName = modelName
+	task.Properties.VideoPricing = &ratio_setting.VideoPriceBreakdown{Seconds: 10, Resolution: "720p", GroupRatio: 1}
+	if err := task.Update(); err != nil {
+		t.Fatalf("failed to update task: %v", err)
+	}
+	return task, token, ch, preConsumed
+}
+
+func TestSettleVideoTaskPricingRefundsShorterVideo(t *testing.T) {
+	const modelName = "test-video-per-second"
+	task, token, ch, preConsumed := newSettlementTestTask(t, modelName)
+
+	// 实际只生成了 5 秒，退还一半预扣费
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%", Duration: 5})
+
+	actualQuota := int(5 * 0.1 * common.QuotaPerUnit)
+	refund := preConsumed - actualQuota
+	saved, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskById: %v", err)
+	}
+	if saved.Quota != actualQuota || saved.Properties.VideoPricing == nil || !saved.Properties.VideoPricing.Settled {
+		t.Fatalf("expected task to be saved as settled at %d, got %d", actualQuota, saved.Quota)
+	}
+	if quota := getTestUserQuota(t, task.UserId); quota != refund {
+		t.Fatalf("expected refund %d, user quota %d", refund, quota)
+	}
+	// 退还时令牌剩余额度与用户、渠道的已用额度同样按差额修正
+	var user model.User
+	model.DB.First(&user, task.UserId)
+	if user.UsedQuota != actualQuota {
+		t.Fatalf("user used quota = %d, want %d", user.UsedQuota, actualQuota)
+	}
+	var savedChannel model.Channel
+	model.DB.First(&savedChannel, ch.Id)
+	if savedChannel.UsedQuota != int64(actualQuota) {
+		t.Fatalf("channel used quota = %d, want %d", savedChannel.UsedQuota, actualQuota)
+	}
+	var savedToken model.Token
+	model.DB.First(&savedToken, token.Id)
+	if savedToken.RemainQuota != 1000+refund || savedToken.UsedQuota != actualQuota {
+		t.Fatalf("token remain = %d, used = %d", savedToken.RemainQuota, savedToken.UsedQuota)
+	}
+
+	log := waitConsumeLog(t, task.UserId, modelName)
+	if log.Quota != actualQuota-preConsumed || log.TokenId != token.Id {
+		t.Fatalf("expected log quota to be the settlement delta %d, got %d", actualQuota-preConsumed, log.Quota)
+	}
+	other, err := common.StrToMap(log.Other)
+	if err != nil {
+		t.Fatalf("failed to parse log other: %v", err)
+	}
+	pricing, ok := other["video_pricing"].(map[string]interface{})
+	if !ok || pricing["seconds"] != float64(5) || pricing["resolution"] != "720p" || pricing["settled"] != true {
+		t.Fatalf("expected video pricing breakdown in log, got %v", other["video_pricing"])
+	}
+	if other["task_id"] != task.TaskID {
+		t.Fatalf("expected task id in log, got %v", other["task_id"])
+	}
+}
+
+func TestSettleVideoTaskPricingChargesLongerVideo(t *testing.T) {
+	task, token, _, preConsumed := newSettlementTestTask(t, "test-video-per-second-long")
+	if err := model.DB.Model(&model.User{}).Where("id = ?", task.UserId).Update("quota", preConsumed).Error; err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%", Duration: 12})
+
+	charge := int(12*0.1*common.QuotaPerUnit) - preConsumed
+	if quota := getTestUserQuota(t, task.UserId); quota != preConsumed-charge {
+		t.Fatalf("expected charge %d, user quota %d", charge, quota)
+	}
+	var savedToken model.Token
+	model.DB.First(&savedToken, token.Id)
+	if savedToken.RemainQuota != 1000-charge {
+		t.Fatalf("token remain = %d, want %d", savedToken.RemainQuota, 1000-charge)
+	}
+}
+
+func TestSettleVideoTaskPricingSkipsStaleTask(t *testing.T) {
+	task, _, _, preConsumed := newSettlementTestTask(t, "test-video-per-second-stale")
+	stale, err := model.GetTaskById(task.ID)
+	if err != nil {
+		t.Fatalf("GetTaskById: %v", err)
+	}
+	pollTestTask(t, task, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%", Duration: 5})
+	refund := preConsumed - int(5*0.1*common.QuotaPerUnit)
+
+	// 基于过期读取结果的轮询不会再次结算
+	pollTestTask(t, stale, &relaycommon.TaskInfo{Status: model.TaskStatusSuccess, Progress: "100%", Duration: 5})
+	if quota := getTestUserQuota(t, task.UserId); quota != refund {
+		t.Fatalf("expected a single refund %d, user quota %d", refund, quota)
+	}
+}
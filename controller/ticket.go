@@ -6,6 +6,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/i18n"
 	"github.com/Zer0Echo/uniapi/model"
 
@@ -147,7 +148,7 @@ func GetTicketMessages(c *gin.Context) {
 	}
 	userId := c.GetInt("id")
 	role := c.GetInt("role")
-	if ticket.UserId != userId && role < common.RoleAdminUser {
+	if ticket.UserId != userId && !model.UserHasPermission(userId, role, constant.PermissionTicketsRead) {
 		common.ApiErrorI18n(c, i18n.MsgTicketNoPermission)
 		return
 	}
@@ -1,12 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/i18n"
 	"github.com/Zer0Echo/uniapi/model"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
@@ -22,6 +24,7 @@ func GetAllTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.HideTokenKeys(tokens)
 	total, _ := model.CountUserTokens(userId)
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
@@ -41,6 +44,7 @@ func SearchTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.HideTokenKeys(tokens)
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
 	common.ApiSuccess(c, pageInfo)
@@ -59,6 +63,7 @@ func GetToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	token.HideKey()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -132,11 +137,17 @@ func GetTokenUsage(c *gin.Context) {
 			"unlimited_quota":      token.UnlimitedQuota,
 			"model_limits":         token.GetModelLimitsMap(),
 			"model_limits_enabled": token.ModelLimitsEnabled,
+			"scopes":               token.GetScopes(),
 			"expires_at":           expiredAt,
 		},
 	})
 }
 
+// GetTokenScopes 可为令牌配置的全部作用域
+func GetTokenScopes(c *gin.Context) {
+	common.ApiSuccess(c, constant.AllTokenScopes)
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -160,6 +171,14 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if err := validateTokenProject(c.GetInt("id"), token.ProjectId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := token.NormalizeRequestLimits(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -183,7 +202,6 @@ func AddToken(c *gin.Context) {
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
 		Name:               token.Name,
-		Key:                key,
 		CreatedTime:        common.GetTimestamp(),
 		AccessedTime:       common.GetTimestamp(),
 		ExpiredTime:        token.ExpiredTime,
@@ -194,22 +212,65 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ProjectId:          token.ProjectId,
+		Scopes:             token.Scopes,
+		MaxOutputTokens:    token.MaxOutputTokens,
+		MaxInputTokens:     token.MaxInputTokens,
+		DisableTools:       token.DisableTools,
+		DisableWebSearch:   token.DisableWebSearch,
+	}
+	if err := cleanToken.SetKey(key); err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
+		common.SysLog("failed to hash token key: " + err.Error())
+		return
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 密钥仅以哈希存储，明文只在创建时返回一次
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data": gin.H{
+			"id":         cleanToken.Id,
+			"key":        key,
+			"key_prefix": cleanToken.KeyPrefix,
+		},
 	})
 	return
 }
 
+// RegenerateTokenKey 重置令牌密钥并返回新的明文，旧密钥立即失效
+func RegenerateTokenKey(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.AuditBefore(c, map[string]string{"key_prefix": token.KeyPrefix})
+	key, err := token.RegenerateKey()
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
+		common.SysLog("failed to regenerate token key: " + err.Error())
+		return
+	}
+	model.AuditAfter(c, map[string]string{"key_prefix": token.KeyPrefix})
+	common.ApiSuccess(c, gin.H{
+		"id":         token.Id,
+		"key":        key,
+		"key_prefix": token.KeyPrefix,
+	})
+}
+
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt("id")
+	if token, err := model.GetTokenByIds(id, userId); err == nil {
+		model.AuditBefore(c, token)
+	}
 	err := model.DeleteTokenById(id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -251,6 +312,7 @@ func UpdateToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditBefore(c, cleanToken)
 	if token.Status == common.TokenStatusEnabled {
 		if cleanToken.Status == common.TokenStatusExpired && cleanToken.ExpiredTime <= common.GetTimestamp() && cleanToken.ExpiredTime != -1 {
 			common.ApiErrorI18n(c, i18n.MsgTokenExpiredCannotEnable)
@@ -274,12 +336,29 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		if err := token.NormalizeRequestLimits(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		cleanToken.Scopes = token.Scopes
+		cleanToken.MaxOutputTokens = token.MaxOutputTokens
+		cleanToken.MaxInputTokens = token.MaxInputTokens
+		cleanToken.DisableTools = token.DisableTools
+		cleanToken.DisableWebSearch = token.DisableWebSearch
+		if token.ProjectId != cleanToken.ProjectId {
+			if err := validateTokenProject(userId, token.ProjectId); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+			cleanToken.ProjectId = token.ProjectId
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditAfter(c, cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -309,3 +388,19 @@ func DeleteTokenBatch(c *gin.Context) {
 		"data":    count,
 	})
 }
+
+// validateTokenProject 校验用户可以在项目下创建令牌：项目启用且用户为所属组织的开发者及以上角色
+func validateTokenProject(userId int, projectId int) error {
+	if projectId == 0 {
+		return nil
+	}
+	project, err := model.GetProjectById(projectId)
+	if err != nil || project.Status != common.ProjectStatusEnabled {
+		return errors.New("项目不存在或已被禁用")
+	}
+	member, err := model.GetOrganizationMember(project.OrgId, userId)
+	if err != nil || !model.OrgRoleAtLeast(member.Role, common.OrgRoleDeveloper) {
+		return errors.New("无权在该项目下创建令牌")
+	}
+	return nil
+}
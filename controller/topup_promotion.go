@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/payment"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// topUpOffer 下单时在渠道报价上叠加的套餐赠送与优惠码折扣
+type topUpOffer struct {
+	PackageId     int
+	BonusQuota    int
+	PromoCode     string
+	DiscountMoney float64
+	DiscountRatio float64
+	// 减免占原支付金额的比例，优惠码在完成时超出上限时据此扣除额度
+	DiscountRate float64
+}
+
+func (o *topUpOffer) applyTo(topUp *model.TopUp, checkout *payment.CheckoutRequest) {
+	topUp.PackageId = o.PackageId
+	topUp.BonusQuota = o.BonusQuota
+	topUp.PromoCode = o.PromoCode
+	topUp.DiscountMoney = o.DiscountMoney
+	topUp.DiscountRate = o.DiscountRate
+	checkout.PromoCode = o.PromoCode
+	checkout.DiscountRatio = o.DiscountRatio
+}
+
+// resolveTopUpPackage 选择了充值套餐时按套餐数量下单
+func resolveTopUpPackage(packageId int, amount int64, group string) (*model.TopUpPackage, int64, error) {
+	if packageId <= 0 {
+		return nil, amount, nil
+	}
+	pkg, err := model.GetPurchasableTopUpPackage(packageId, group)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pkg, pkg.Amount, nil
+}
+
+// applyTopUpOffers 计算赠送档位与优惠码折扣。按单价计费的渠道折扣以比例交给渠道处理，
+// 其余渠道直接从 quote.Money 中扣减
+func applyTopUpOffers(quote *payment.TopUpQuote, user *model.User, amount int64, pkg *model.TopUpPackage, promoCode string) (*topUpOffer, error) {
+	offer := &topUpOffer{}
+	promoCode = strings.TrimSpace(promoCode)
+	if quote.FixedPrice {
+		if pkg != nil || promoCode != "" {
+			return nil, errors.New("该支付方式不支持充值套餐与优惠码")
+		}
+		return offer, nil
+	}
+	if pkg == nil {
+		pkg = model.GetTopUpBonusTier(amount, user.Group)
+	}
+	if pkg != nil {
+		offer.PackageId = pkg.Id
+		offer.BonusQuota = pkg.BonusQuota()
+	}
+	if promoCode == "" {
+		return offer, nil
+	}
+	payMoney := quote.PayMoney
+	if payMoney <= 0 {
+		payMoney = quote.Money
+	}
+	promo, discount, err := model.ValidatePromoCode(promoCode, user.Id, user.Group, payMoney)
+	if err != nil {
+		return nil, err
+	}
+	if payMoney-discount < 0.01 {
+		return nil, errors.New("优惠后支付金额过低")
+	}
+	offer.PromoCode = promo.Code
+	offer.DiscountMoney = discount
+	offer.DiscountRate = discount / payMoney
+	if quote.PayMoney > 0 {
+		offer.DiscountRatio = discount / payMoney
+	} else {
+		quote.Money = decimal.NewFromFloat(quote.Money).Sub(decimal.NewFromFloat(discount)).Round(2).InexactFloat64()
+	}
+	return offer, nil
+}
+
+type TopUpQuoteRequest struct {
+	PaymentMethod string `json:"payment_method"`
+	Amount        int64  `json:"amount"`
+	ProductId     string `json:"product_id"`
+	PackageId     int    `json:"package_id"`
+	PromoCode     string `json:"promo_code"`
+}
+
+// GetTopUpQuote 下单前预览支付金额、优惠码减免与赠送额度
+func GetTopUpQuote(c *gin.Context) {
+	var req TopUpQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	_, provider, err := getEnabledPaymentProvider(req.PaymentMethod)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pkg, amount, err := resolveTopUpPackage(req.PackageId, req.Amount, user.Group)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	quote, err := quoteTopUp(provider, &payment.TopUpQuoteRequest{Amount: amount, ProductId: req.ProductId, User: user})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	originalMoney := quote.PayMoney
+	if originalMoney <= 0 {
+		originalMoney = quote.Money
+	}
+	offer, err := applyTopUpOffers(quote, user, amount, pkg, req.PromoCode)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"amount":         amount,
+		"original_money": originalMoney,
+		"pay_money":      decimal.NewFromFloat(originalMoney).Sub(decimal.NewFromFloat(offer.DiscountMoney)).Round(2).InexactFloat64(),
+		"discount_money": offer.DiscountMoney,
+		"promo_code":     offer.PromoCode,
+		"package_id":     offer.PackageId,
+		"bonus_quota":    offer.BonusQuota,
+	})
+}
+
+// getTopUpPackagesForUser 充值页展示的套餐，获取失败时不影响充值页其他信息
+func getTopUpPackagesForUser(userId int) []*model.TopUpPackage {
+	group, err := model.GetUserGroup(userId, true)
+	if err != nil {
+		return []*model.TopUpPackage{}
+	}
+	packages, err := model.GetAvailableTopUpPackages(group)
+	if err != nil {
+		common.SysError("get topup packages failed: " + err.Error())
+		return []*model.TopUpPackage{}
+	}
+	return packages
+}
+
+func getFirstTopUpBonusInfo() gin.H {
+	ps := operation_setting.GetPaymentSetting()
+	return gin.H{
+		"rate": ps.FirstTopUpBonusRate,
+		"max":  ps.FirstTopUpBonusMax,
+	}
+}
+
+// ---- Admin APIs ----
+
+func validateTopUpPackage(pkg *model.TopUpPackage) error {
+	pkg.Name = strings.TrimSpace(pkg.Name)
+	if pkg.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if pkg.Amount <= 0 {
+		return errors.New("充值数量必须大于 0")
+	}
+	if pkg.BonusAmount < 0 {
+		return errors.New("赠送额度不能为负数")
+	}
+	return nil
+}
+
+func AdminListTopUpPackages(c *gin.Context) {
+	packages, err := model.GetAllTopUpPackages()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, packages)
+}
+
+func AdminCreateTopUpPackage(c *gin.Context) {
+	var pkg model.TopUpPackage
+	if err := c.ShouldBindJSON(&pkg); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := validateTopUpPackage(&pkg); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pkg.Id = 0
+	if err := pkg.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, pkg)
+}
+
+func AdminUpdateTopUpPackage(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	var pkg model.TopUpPackage
+	if err := c.ShouldBindJSON(&pkg); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := validateTopUpPackage(&pkg); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pkg.Id = id
+	if err := pkg.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminDeleteTopUpPackage(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	if err := model.DeleteTopUpPackageById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminListPromoCodes(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	codes, total, err := model.GetPromoCodes(c.Query("keyword"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(codes)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AdminCreatePromoCode(c *gin.Context) {
+	var promo model.PromoCode
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := promo.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	promo.Id = 0
+	promo.UsedCount = 0
+	if err := promo.Insert(); err != nil {
+		common.ApiErrorMsg(c, "优惠码已存在")
+		return
+	}
+	common.ApiSuccess(c, promo)
+}
+
+func AdminUpdatePromoCode(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	var promo model.PromoCode
+	if err := c.ShouldBindJSON(&promo); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if err := promo.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	promo.Id = id
+	if err := promo.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func AdminDeletePromoCode(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id <= 0 {
+		common.ApiErrorMsg(c, "无效的ID")
+		return
+	}
+	if err := model.DeletePromoCodeById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
@@ -50,7 +50,7 @@ func Login(c *gin.Context) {
 		Username: username,
 		Password: password,
 	}
-	err = user.ValidateAndFill()
+	ldapUser, err := authenticateLDAPUser(username, password)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": err.Error(),
@@ -58,6 +58,15 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
+	if ldapUser != nil {
+		user = *ldapUser
+	} else if err = user.ValidateAndFill(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
 
 	// 检查是否启用2FA
 	if model.IsTwoFAEnabled(user.Id) {
@@ -84,15 +93,20 @@ func Login(c *gin.Context) {
 	setupLogin(&user, c)
 }
 
-// setup session & cookies and then return user info
-func setupLogin(user *model.User, c *gin.Context) {
+// saveLoginSession 写入登录会话
+func saveLoginSession(user *model.User, c *gin.Context) error {
 	session := sessions.Default(c)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
-	err := session.Save()
+	return session.Save()
+}
+
+// setup session & cookies and then return user info
+func setupLogin(user *model.User, c *gin.Context) {
+	err := saveLoginSession(user, c)
 	if err != nil {
 		common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
 		return
@@ -191,6 +205,7 @@ func Register(c *gin.Context) {
 		return
 	}
 	// 生成默认令牌
+	var defaultToken gin.H
 	if constant.GenerateDefaultToken {
 		key, err := common.GenerateKey()
 		if err != nil {
@@ -202,7 +217,6 @@ func Register(c *gin.Context) {
 		token := model.Token{
 			UserId:             insertedUser.Id, // 使用插入后的用户ID
 			Name:               cleanUser.Username + "的初始令牌",
-			Key:                key,
 			CreatedTime:        common.GetTimestamp(),
 			AccessedTime:       common.GetTimestamp(),
 			ExpiredTime:        -1,     // 永不过期
@@ -213,15 +227,28 @@ func Register(c *gin.Context) {
 		if setting.DefaultUseAutoGroup {
 			token.Group = "auto"
 		}
+		if err := token.SetKey(key); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgCreateDefaultTokenErr)
+			return
+		}
 		if err := token.Insert(); err != nil {
 			common.ApiErrorI18n(c, i18n.MsgCreateDefaultTokenErr)
 			return
 		}
+		// 与创建令牌一致，明文只在此处返回一次
+		defaultToken = gin.H{
+			"id":         token.Id,
+			"key":        key,
+			"key_prefix": token.KeyPrefix,
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data": gin.H{
+			"default_token": defaultToken,
+		},
 	})
 	return
 }
@@ -474,6 +501,10 @@ func GetSelf(c *gin.Context) {
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
+		"admin_role_id":     user.AdminRoleId,
+	}
+	if adminPermissions, err := model.GetUserPermissions(user.Id, user.Role); err == nil {
+		responseData["admin_permissions"] = model.PermissionList(adminPermissions)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -629,6 +660,11 @@ func UpdateUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserCannotCreateHigherLevel)
 		return
 	}
+	model.AuditBefore(c, originUser)
+	if originUser.Quota != updatedUser.Quota && !model.UserHasPermission(c.GetInt("id"), myRole, constant.PermissionUsersQuota) {
+		common.ApiErrorMsg(c, "无权调整用户额度")
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -893,6 +929,8 @@ func ManageUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
+	model.AuditTarget(c, "user", user.Id)
+	model.AuditBefore(c, map[string]int{"role": user.Role, "status": user.Status})
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -940,6 +978,7 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.AuditAfter(c, map[string]any{"action": req.Action, "role": user.Role, "status": user.Status})
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1161,11 +1200,17 @@ func UpdateUserSetting(c *gin.Context) {
 	}
 
 	// 构建设置
+	currentSetting := user.GetSetting()
 	settings := dto.UserSetting{
 		NotifyType:            req.QuotaWarningType,
 		QuotaWarningThreshold: req.QuotaWarningThreshold,
 		AcceptUnsetRatioModel: req.AcceptUnsetModelRatioModel,
 		RecordIpLog:           req.RecordIpLog,
+		// 开票信息由单独的接口维护，这里保留原值
+		InvoiceCompany: currentSetting.InvoiceCompany,
+		InvoiceTaxId:   currentSetting.InvoiceTaxId,
+		InvoiceAddress: currentSetting.InvoiceAddress,
+		InvoiceEmail:   currentSetting.InvoiceEmail,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
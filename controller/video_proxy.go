@@ -132,7 +132,18 @@ func VideoProxy(c *gin.Context) {
 		req.Header.Set("x-goog-api-key", apiKey)
 	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
 		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
+		plainKey, err := channel.GetPlainKey()
+		if err != nil {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to decrypt channel key for task %s: %s", taskID, err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to load channel key",
+					"type":    "server_error",
+				},
+			})
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+plainKey)
 	default:
 		// Video URL is directly in task.FailReason
 		videoURL = task.FailReason
@@ -24,14 +24,25 @@ const (
 )
 
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	ClaudeBetaQuery       bool          `json:"claude_beta_query,omitempty"`      // Claude 渠道是否强制追加 ?beta=true
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion string                  `json:"azure_responses_version,omitempty"`
+	VertexKeyType         VertexKeyType           `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise  *bool                   `json:"openrouter_enterprise,omitempty"`
+	ClaudeBetaQuery       bool                    `json:"claude_beta_query,omitempty"`       // Claude 渠道是否强制追加 ?beta=true
+	AllowServiceTier      bool                    `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore          bool                    `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier bool                    `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType            AwsKeyType              `json:"aws_key_type,omitempty"`
+	Balance               *ChannelBalanceSettings `json:"balance,omitempty"` // 余额查询与告警设置
+}
+
+// ChannelBalanceSettings 渠道余额查询与告警设置，金额单位为美元
+type ChannelBalanceSettings struct {
+	AlertThreshold   float64 `json:"alert_threshold,omitempty"`   // 余额低于该值时通知管理员
+	DisableThreshold float64 `json:"disable_threshold,omitempty"` // 余额低于该值时自动禁用渠道（需开启自动禁用），默认为 0
+	MonthlyBudget    float64 `json:"monthly_budget,omitempty"`    // 只能查询用量的接口，余额为每月预算减去本月消耗
+	AdminKey         string  `json:"admin_key,omitempty"`         // 查询账单所需的管理密钥，AK/SK 格式为 ak|sk，与渠道密钥一样加密保存
+	AdminKeySet      bool    `json:"admin_key_set,omitempty"`     // 仅用于接口返回，表示已设置管理密钥
+	AccountId        string  `json:"account_id,omitempty"`        // 账户标识，如 xAI 的 team id
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -10,9 +10,12 @@ type Notify struct {
 const ContentValueParam = "{{value}}"
 
 const (
-	NotifyTypeQuotaExceed   = "quota_exceed"
-	NotifyTypeChannelUpdate = "channel_update"
-	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeQuotaExceed    = "quota_exceed"
+	NotifyTypeChannelUpdate  = "channel_update"
+	NotifyTypeChannelTest    = "channel_test"
+	NotifyTypeChannelBalance = "channel_balance"
+	NotifyTypeStatement      = "statement"
+	NotifyTypeSubscription   = "subscription"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
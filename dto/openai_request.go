@@ -477,6 +477,12 @@ func (m *Message) SetMediaContent(content []MediaContent) {
 	m.parsedContent = content
 }
 
+// SetContent 直接设置原始内容（字符串或内容块数组）并清除解析缓存
+func (m *Message) SetContent(content any) {
+	m.Content = content
+	m.parsedContent = nil
+}
+
 func (m *Message) IsStringContent() bool {
 	_, ok := m.Content.(string)
 	if ok {
@@ -15,6 +15,11 @@ type UserSetting struct {
 	SidebarModules        string  `json:"sidebar_modules,omitempty"`                // SidebarModules 左侧边栏模块配置
 	BillingPreference     string  `json:"billing_preference,omitempty"`             // BillingPreference 扣费策略（订阅/钱包）
 	Language              string  `json:"language,omitempty"`                       // Language 用户语言偏好 (zh, en)
+	InvoiceCompany        string  `json:"invoice_company,omitempty"`                // InvoiceCompany 发票抬头（公司名称）
+	InvoiceTaxId          string  `json:"invoice_tax_id,omitempty"`                 // InvoiceTaxId 纳税人识别号
+	InvoiceAddress        string  `json:"invoice_address,omitempty"`                // InvoiceAddress 发票地址
+	InvoiceEmail          string  `json:"invoice_email,omitempty"`                  // InvoiceEmail 接收账单的邮箱
+	DisplayCurrency       string  `json:"display_currency,omitempty"`               // DisplayCurrency 价格与日志的展示货币
 }
 
 var (
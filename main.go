@@ -114,6 +114,24 @@ func main() {
 	// Quota expiry task (expire redemption-based balance)
 	service.StartQuotaExpiryTask()
 
+	// Quota ledger opening balances and periodic reconciliation
+	service.StartLedgerReconcileTask()
+
+	// Monthly statement generation
+	service.StartStatementTask()
+
+	// Scheduled consume log export (local disk or S3-compatible storage)
+	service.StartLogExportTask()
+
+	// Exchange rate auto update for multi-currency display and pricing
+	service.StartExchangeRateTask()
+	service.StartAuditLogCleanupTask()
+
+	// Hash legacy plaintext token keys and encrypt channel keys at rest
+	if common.IsMasterNode {
+		gopool.Go(model.MigrateCredentialStorage)
+	}
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
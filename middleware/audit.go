@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditMaxRequestBytes  = 1 << 20
+	auditMaxResponseBytes = 16 << 10
+	auditMaxSnapshotBytes = 60 << 10 // MySQL TEXT 上限 64KB
+)
+
+// auditResponseWriter 保留响应体开头部分，用于判断管理操作是否成功
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *auditResponseWriter) capture(b []byte) {
+	if remain := auditMaxResponseBytes - w.body.Len(); remain > 0 {
+		if len(b) > remain {
+			b = b[:remain]
+		}
+		w.body.Write(b)
+	}
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func shouldAuditRequest(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if c.GetBool(string(constant.ContextKeyAuditStarted)) {
+		return false
+	}
+	return system_setting.GetAuditLogSetting().Enabled
+}
+
+// readAuditRequestBody 读取 JSON 请求体并脱敏，读取后恢复请求体供处理函数使用
+func readAuditRequestBody(c *gin.Context) any {
+	if !strings.Contains(c.ContentType(), "json") || c.Request.ContentLength <= 0 || c.Request.ContentLength > auditMaxRequestBytes {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var decoded any
+	if err := common.Unmarshal(body, &decoded); err != nil {
+		return nil
+	}
+	return common.RedactSensitiveFields(decoded)
+}
+
+// auditTargetType 由路由推断目标类型，例如 /api/channel/:id -> channel
+func auditTargetType(fullPath string) string {
+	path := strings.TrimPrefix(fullPath, "/api/")
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func auditSnapshotString(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := common.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	if len(data) > auditMaxSnapshotBytes {
+		return fmt.Sprintf(`{"truncated":true,"size":%d}`, len(data))
+	}
+	return string(data)
+}
+
+func parseAuditResponse(body []byte, status int) (bool, string) {
+	if status >= http.StatusBadRequest {
+		return false, http.StatusText(status)
+	}
+	var resp struct {
+		Success *bool  `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := common.Unmarshal(body, &resp); err != nil || resp.Success == nil {
+		return true, ""
+	}
+	message := []rune(resp.Message)
+	if len(message) > 255 {
+		message = message[:255]
+	}
+	return *resp.Success, string(message)
+}
+
+// auditAdminRequest 执行管理写操作并记录审计日志：操作人、IP、目标对象以及变更前后快照。
+// 处理函数可通过 model.AuditTarget / AuditBefore / AuditAfter 提供更准确的目标与快照
+func auditAdminRequest(c *gin.Context) {
+	common.SetContextKey(c, constant.ContextKeyAuditStarted, true)
+	requestBody := readAuditRequestBody(c)
+	writer := &auditResponseWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+	c.Writer = writer
+
+	c.Next()
+
+	c.Writer = writer.ResponseWriter
+	before, _ := common.GetContextKey(c, constant.ContextKeyAuditBefore)
+	after, ok := common.GetContextKey(c, constant.ContextKeyAuditAfter)
+	if !ok {
+		after = requestBody
+	}
+	targetType := common.GetContextKeyString(c, constant.ContextKeyAuditTargetType)
+	if targetType == "" {
+		targetType = auditTargetType(c.FullPath())
+	}
+	targetId := common.GetContextKeyString(c, constant.ContextKeyAuditTargetId)
+	if targetId == "" {
+		targetId = c.Param("id")
+	}
+	if targetId == "" {
+		if m, ok := after.(map[string]any); ok && m["id"] != nil {
+			targetId = fmt.Sprint(m["id"])
+		}
+	}
+	var diff string
+	if d := model.BuildAuditDiff(before, after); len(d) > 0 {
+		diff = auditSnapshotString(d)
+	}
+	success, message := parseAuditResponse(writer.body.Bytes(), writer.Status())
+	auditLog := &model.AuditLog{
+		UserId:     c.GetInt("id"),
+		Username:   c.GetString("username"),
+		Ip:         c.ClientIP(),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Action:     c.Request.Method + " " + c.FullPath(),
+		TargetType: targetType,
+		TargetId:   targetId,
+		Before:     auditSnapshotString(before),
+		After:      auditSnapshotString(after),
+		Diff:       diff,
+		StatusCode: writer.Status(),
+		Success:    success,
+		Message:    message,
+	}
+	gopool.Go(func() {
+		if err := model.RecordAuditLog(auditLog); err != nil {
+			common.SysError("failed to record audit log: " + err.Error())
+		}
+	})
+}
+
+// AuditRequest 为非管理接口中的敏感写操作（例如令牌的创建、修改与重置）记录审计日志，需放在用户鉴权之后
+func AuditRequest() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !shouldAuditRequest(c) {
+			c.Next()
+			return
+		}
+		auditAdminRequest(c)
+	}
+}
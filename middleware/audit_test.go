@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newAuditTestRouter 模拟已登录的管理员，处理函数提供变更前快照并按 success 参数返回结果
+func newAuditTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("id", 1)
+		c.Set("username", "admin")
+		c.Next()
+	}, AuditRequest())
+	r.Any("/api/channel/:id", handler)
+	return r
+}
+
+// waitAuditLog 审计记录异步写入，等待指定操作的记录出现
+func waitAuditLog(t *testing.T, action string) *model.AuditLog {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		logs, _, err := model.GetAuditLogs(model.AuditLogFilter{Action: action}, 0, 1)
+		if err != nil {
+			t.Fatalf("GetAuditLogs: %v", err)
+		}
+		if len(logs) > 0 {
+			return logs[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("audit log for %s not recorded", action)
+	return nil
+}
+
+func TestAuditRequestRecordsRedactedDiff(t *testing.T) {
+	var boundName string
+	r := newAuditTestRouter(func(c *gin.Context) {
+		// 中间件读取请求体后需恢复，处理函数仍能正常解析
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			t.Errorf("failed to bind request after audit: %v", err)
+		}
+		boundName = req.Name
+		model.AuditBefore(c, map[string]any{"name": "old", "key": "sk-old", "weight": 1})
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+	})
+	body := `{"name":"new","key":"sk-new","password":"p@ss","weight":1}`
+	req := httptest.NewRequest(http.MethodPut, "/api/channel/5", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if boundName != "new" {
+		t.Fatalf("expected handler to read request body, got %q", boundName)
+	}
+
+	log := waitAuditLog(t, "PUT /api/channel/:id")
+	if log.UserId != 1 || log.Username != "admin" || log.TargetType != "channel" || log.TargetId != "5" || !log.Success {
+		t.Fatalf("unexpected audit log %+v", log)
+	}
+	for _, secret := range []string{"sk-old", "sk-new", "p@ss"} {
+		if strings.Contains(log.Before+log.After+log.Diff, secret) {
+			t.Fatalf("audit log leaks %q: %+v", secret, log)
+		}
+	}
+	if !strings.Contains(log.After, common.RedactedValue) {
+		t.Fatalf("expected redacted request body, got %s", log.After)
+	}
+	// 只有发生变化的字段出现在差异中
+	if !strings.Contains(log.Diff, `"name":{"after":"new","before":"old"}`) || strings.Contains(log.Diff, "weight") || strings.Contains(log.Diff, `"key"`) {
+		t.Fatalf("unexpected diff %s", log.Diff)
+	}
+}
+
+func TestAuditRequestRecordsFailure(t *testing.T) {
+	r := newAuditTestRouter(func(c *gin.Context) {
+		model.AuditTarget(c, "redemption", 9)
+		model.AuditAfter(c, map[string]any{"status": 2})
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": "兑换码不存在"})
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/channel/3", nil))
+
+	log := waitAuditLog(t, "DELETE /api/channel/:id")
+	if log.Success || log.Message != "兑换码不存在" || log.TargetType != "redemption" || log.TargetId != "9" {
+		t.Fatalf("unexpected audit log %+v", log)
+	}
+	if log.After != `{"status":2}` || log.Diff != "" {
+		t.Fatalf("unexpected snapshots %+v", log)
+	}
+}
+
+func TestAuditRequestSkipsReadsAndDisabled(t *testing.T) {
+	setting := system_setting.GetAuditLogSetting()
+	enabled := setting.Enabled
+	t.Cleanup(func() { setting.Enabled = enabled })
+	r := newAuditTestRouter(func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/channel/1", nil))
+	setting.Enabled = false
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/channel/1", nil))
+	setting.Enabled = true
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/api/channel/1", nil))
+
+	// 等到最后一个请求写入后，之前的请求仍没有记录
+	waitAuditLog(t, "PATCH /api/channel/:id")
+	for _, action := range []string{"GET /api/channel/:id", "POST /api/channel/:id"} {
+		if logs, _, _ := model.GetAuditLogs(model.AuditLogFilter{Action: action}, 0, 1); len(logs) != 0 {
+			t.Fatalf("expected %s not to be audited", action)
+		}
+	}
+}
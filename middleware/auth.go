@@ -30,7 +30,8 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper 校验登录状态与角色等级；permitted 非空时改为按细粒度权限校验，忽略 minRole
+func authHelper(c *gin.Context, minRole int, permitted func(userId int, role int) bool) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -109,7 +110,20 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
-	if role.(int) < minRole {
+	if permitted != nil {
+		if !permitted(id.(int), role.(int)) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，权限不足",
+			})
+			c.Abort()
+			return
+		}
+		// 拥有自定义角色的普通用户在授权接口内按管理员等级处理，具体操作范围由权限限定
+		if role.(int) < common.RoleAdminUser {
+			role = common.RoleAdminUser
+		}
+	} else if role.(int) < minRole {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无权进行此操作，权限不足",
@@ -132,6 +146,11 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Set("user_group", session.Get("group"))
 	c.Set("use_access_token", useAccessToken)
 
+	// 管理接口的写操作记录审计日志
+	if (permitted != nil || minRole >= common.RoleAdminUser) && shouldAuditRequest(c) {
+		auditAdminRequest(c)
+		return
+	}
 	c.Next()
 }
 
@@ -148,19 +167,47 @@ func TryUserAuth() func(c *gin.Context) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleCommonUser)
+		authHelper(c, common.RoleCommonUser, nil)
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleAdminUser)
+		authHelper(c, common.RoleAdminUser, nil)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleRootUser)
+		authHelper(c, common.RoleRootUser, nil)
+	}
+}
+
+// PermissionAuth 要求拥有全部指定权限
+func PermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleAdminUser, func(userId int, role int) bool {
+			return model.UserHasPermission(userId, role, permissions...)
+		})
+	}
+}
+
+// AnyPermissionAuth 拥有任一指定权限即可，用于分组列表等多个管理页面共用的接口
+func AnyPermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleAdminUser, func(userId int, role int) bool {
+			granted, err := model.GetUserPermissions(userId, role)
+			if err != nil {
+				common.SysError("failed to get user permissions: " + err.Error())
+				return false
+			}
+			for _, p := range permissions {
+				if granted[p] {
+					return true
+				}
+			}
+			return false
+		})
 	}
 }
 
@@ -276,12 +323,22 @@ func TokenAuth() func(c *gin.Context) {
 			key = strings.TrimPrefix(key, "sk-")
 			parts = strings.Split(key, "-")
 			key = parts[0]
-		} else {
+		} else if !model.IsDerivedTokenKey(key) {
 			key = strings.TrimPrefix(key, "sk-")
 			parts = strings.Split(key, "-")
 			key = parts[0]
 		}
-		token, err := model.ValidateUserToken(key)
+		var (
+			token   *model.Token
+			derived *model.DerivedTokenClaims
+			err     error
+		)
+		if model.IsDerivedTokenKey(key) {
+			// 派生令牌以父令牌身份通过后续校验，并在此基础上进一步收窄权限
+			token, derived, err = model.ValidateDerivedToken(key)
+		} else {
+			token, err = model.ValidateUserToken(key)
+		}
 		if token != nil {
 			id := c.GetInt("id")
 			if id == 0 {
@@ -309,6 +366,15 @@ func TokenAuth() func(c *gin.Context) {
 			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
 		}
 
+		if scope := tokenScopeForRequest(c); scope != "" && (!token.HasScope(scope) || (derived != nil && !derived.HasScope(scope))) {
+			message := fmt.Sprintf("该令牌无权调用此接口，需要作用域 %s", scope)
+			if scope == tokenScopeUnmapped {
+				message = "该令牌设置了作用域，无权调用此接口"
+			}
+			abortWithOpenAiMessage(c, http.StatusForbidden, message, types.ErrorCodeAccessDenied)
+			return
+		}
+
 		userCache, err := model.GetUserCache(token.UserId)
 		if err != nil {
 			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
@@ -345,6 +411,9 @@ func TokenAuth() func(c *gin.Context) {
 		if err != nil {
 			return
 		}
+		if derived != nil {
+			setupContextForDerivedToken(c, derived)
+		}
 		c.Next()
 	}
 }
@@ -369,6 +438,16 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenMaxOutputTokens, token.MaxOutputTokens)
+	common.SetContextKey(c, constant.ContextKeyTokenMaxInputTokens, token.MaxInputTokens)
+	common.SetContextKey(c, constant.ContextKeyTokenDisableTools, token.DisableTools)
+	common.SetContextKey(c, constant.ContextKeyTokenDisableWebSearch, token.DisableWebSearch)
+	if token.ProjectId != 0 {
+		if err := setupContextForProject(c, token); err != nil {
+			abortWithOpenAiMessage(c, http.StatusForbidden, err.Error())
+			return err
+		}
+	}
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -379,3 +458,61 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	return nil
 }
+
+// setupContextForDerivedToken 记录派生令牌信息，并将模型白名单收窄为派生令牌声明的模型
+func setupContextForDerivedToken(c *gin.Context, claims *model.DerivedTokenClaims) {
+	common.SetContextKey(c, constant.ContextKeyDerivedTokenId, claims.Jti)
+	common.SetContextKey(c, constant.ContextKeyDerivedTokenExpiresAt, claims.ExpiresAt)
+	if len(claims.Models) == 0 {
+		return
+	}
+	limits := make(map[string]bool, len(claims.Models))
+	current, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	limited := common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled)
+	for _, name := range claims.Models {
+		if !limited || current[name] {
+			limits[name] = true
+		}
+	}
+	c.Set("token_model_limit_enabled", true)
+	c.Set("token_model_limit", limits)
+}
+
+// setupContextForProject 校验项目令牌的项目、组织与成员状态，并合并项目的模型白名单
+func setupContextForProject(c *gin.Context, token *model.Token) error {
+	project, err := model.CacheGetProjectById(token.ProjectId)
+	if err != nil {
+		return fmt.Errorf("令牌所属项目不存在")
+	}
+	if project.Status != common.ProjectStatusEnabled {
+		return fmt.Errorf("令牌所属项目已被禁用")
+	}
+	org, err := model.CacheGetOrganizationById(project.OrgId)
+	if err != nil || org.Status != common.OrganizationStatusEnabled {
+		return fmt.Errorf("令牌所属组织不可用")
+	}
+	member, err := model.CacheGetOrganizationMember(org.Id, token.UserId)
+	if err != nil || !model.OrgRoleAtLeast(member.Role, common.OrgRoleDeveloper) {
+		return fmt.Errorf("令牌创建者已不是该组织的开发者")
+	}
+	if project.RemainBudget() == 0 {
+		return fmt.Errorf("项目预算已用尽")
+	}
+	projectLimits := project.GetModelLimitsMap()
+	if len(projectLimits) > 0 {
+		if token.ModelLimitsEnabled {
+			// 令牌与项目同时限制模型时取交集
+			tokenLimits := token.GetModelLimitsMap()
+			for name := range projectLimits {
+				if !tokenLimits[name] {
+					delete(projectLimits, name)
+				}
+			}
+		}
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", projectLimits)
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenOrgId, org.Id)
+	common.SetContextKey(c, constant.ContextKeyTokenProjectId, project.Id)
+	return nil
+}
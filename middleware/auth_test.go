@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newAuthTestRouter 登录接口写入会话，受保护接口返回授权后写入上下文的角色
+func newAuthTestRouter(minRole int, permitted func(userId int, role int) bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret"))))
+	r.GET("/login", func(c *gin.Context) {
+		role, _ := strconv.Atoi(c.Query("role"))
+		session := sessions.Default(c)
+		session.Set("id", 7)
+		session.Set("username", "tester")
+		session.Set("role", role)
+		session.Set("status", common.UserStatusEnabled)
+		session.Set("group", "default")
+		_ = session.Save()
+	})
+	r.GET("/protected", func(c *gin.Context) {
+		authHelper(c, minRole, permitted)
+	}, func(c *gin.Context) {
+		c.String(http.StatusOK, strconv.Itoa(c.GetInt("role")))
+	})
+	return r
+}
+
+func TestAuthHelperPermissionRole(t *testing.T) {
+	allow := func(int, int) bool { return true }
+	deny := func(int, int) bool { return false }
+	tests := []struct {
+		name      string
+		role      int
+		minRole   int
+		permitted func(int, int) bool
+		wantRole  int
+		wantAllow bool
+	}{
+		{name: "root passes permission check", role: common.RoleRootUser, minRole: common.RoleAdminUser, permitted: allow, wantRole: common.RoleRootUser, wantAllow: true},
+		{name: "admin passes permission check", role: common.RoleAdminUser, minRole: common.RoleAdminUser, permitted: allow, wantRole: common.RoleAdminUser, wantAllow: true},
+		{name: "common user with role is raised to admin level", role: common.RoleCommonUser, minRole: common.RoleAdminUser, permitted: allow, wantRole: common.RoleAdminUser, wantAllow: true},
+		{name: "common user without permission is denied", role: common.RoleCommonUser, minRole: common.RoleAdminUser, permitted: deny},
+		{name: "admin without permission is denied", role: common.RoleAdminUser, minRole: common.RoleAdminUser, permitted: deny},
+		{name: "role check without permissions", role: common.RoleAdminUser, minRole: common.RoleAdminUser, wantRole: common.RoleAdminUser, wantAllow: true},
+		{name: "common user fails role check", role: common.RoleCommonUser, minRole: common.RoleAdminUser},
+		{name: "common user passes user check", role: common.RoleCommonUser, minRole: common.RoleCommonUser, wantRole: common.RoleCommonUser, wantAllow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newAuthTestRouter(tt.minRole, tt.permitted)
+			login := httptest.NewRecorder()
+			router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/login?role="+strconv.Itoa(tt.role), nil))
+
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("New-Api-User", "7")
+			for _, cookie := range login.Result().Cookies() {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if !tt.wantAllow {
+				if !strings.Contains(body, "权限不足") {
+					t.Fatalf("expected request to be denied, got %d %s", w.Code, body)
+				}
+				return
+			}
+			if body != strconv.Itoa(tt.wantRole) {
+				t.Fatalf("role in context = %s, want %d", body, tt.wantRole)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/logger"
 	"github.com/Zer0Echo/uniapi/model"
 	relayconstant "github.com/Zer0Echo/uniapi/relay/constant"
 	"github.com/Zer0Echo/uniapi/service"
@@ -51,6 +52,13 @@ func Distribute() func(c *gin.Context) {
 				return
 			}
 		} else {
+			// 订阅套餐中该模型的额度已用尽且配置为降级时，在选择渠道前改用降级模型
+			if shouldSelectChannel && modelRequest.Model != "" {
+				if downgradeModel := getSubscriptionDowngradeModel(c, modelRequest.Model); downgradeModel != "" {
+					logger.LogInfo(c, fmt.Sprintf("subscription allowance of model %s exhausted, downgrade to %s", modelRequest.Model, downgradeModel))
+					modelRequest.Model = downgradeModel
+				}
+			}
 			// Select a channel for the user
 			// check token model mapping
 			modelLimitEnable := common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled)
@@ -150,7 +158,25 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
-		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+		if apiErr := SetupContextForSelectedChannel(c, channel, modelRequest.Model); apiErr != nil && apiErr.GetErrorCode() == types.ErrorCodeChannelKeysUnavailable {
+			// 多 Key 渠道的 Key 均在冷却或超出限额，该渠道已被标记跳过，重新选择一次渠道
+			if !ok && shouldSelectChannel {
+				retryChannel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+					Ctx:        c,
+					ModelName:  modelRequest.Model,
+					TokenGroup: common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+					Retry:      common.GetPointer(0),
+				})
+				if err == nil && retryChannel != nil && retryChannel.Id != channel.Id {
+					channel = retryChannel
+					apiErr = SetupContextForSelectedChannel(c, channel, modelRequest.Model)
+				}
+			}
+			if apiErr != nil {
+				abortWithOpenAiMessage(c, apiErr.StatusCode, apiErr.Error(), apiErr.GetErrorCode())
+				return
+			}
+		}
 		c.Next()
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
@@ -336,6 +362,25 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	return &modelRequest, shouldSelectChannel, nil
 }
 
+// getSubscriptionDowngradeModel 仅在优先使用订阅计费时生效，项目令牌始终从组织钱包扣费，不受订阅影响
+func getSubscriptionDowngradeModel(c *gin.Context, modelName string) string {
+	if common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId) != 0 {
+		return ""
+	}
+	userSetting, _ := common.GetContextKeyType[dto.UserSetting](c, constant.ContextKeyUserSetting)
+	switch common.NormalizeBillingPreference(userSetting.BillingPreference) {
+	case "subscription_first", "subscription_only":
+	default:
+		return ""
+	}
+	downgradeModel, err := model.GetSubscriptionModelDowngrade(c.GetInt("id"), modelName)
+	if err != nil {
+		logger.LogWarn(c, "failed to check subscription model allowance: "+err.Error())
+		return ""
+	}
+	return downgradeModel
+}
+
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) *types.NewAPIError {
 	c.Set("original_model", modelName) // for retry
 	if channel == nil {
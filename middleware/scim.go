@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScimAuth 校验 IdP 调用 SCIM 接口时携带的 Bearer Token
+func ScimAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		if !settings.Enabled || settings.BearerToken == "" {
+			abortWithScimMessage(c, http.StatusNotFound, "SCIM is not enabled")
+			return
+		}
+		token, ok := strings.CutPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(settings.BearerToken)) != 1 {
+			abortWithScimMessage(c, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/constant"
+	relayconstant "github.com/Zer0Echo/uniapi/relay/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenScopeUnmapped 未归入任何作用域的接口，设置了作用域的令牌默认无权调用
+const tokenScopeUnmapped = "unmapped"
+
+// tokenScopeForRequest 按请求路径与中转模式确定所需的令牌作用域，返回空字符串表示该接口不受作用域限制；
+// 新增的中转接口未在此映射时返回 tokenScopeUnmapped，避免受限令牌绕过作用域
+func tokenScopeForRequest(c *gin.Context) string {
+	path := c.Request.URL.Path
+	// 令牌查询自身额度与派生令牌的接口不属于中转调用
+	if strings.HasPrefix(path, "/dashboard/") || strings.HasPrefix(path, "/v1/dashboard/") || strings.HasPrefix(path, "/v1/tokens/") {
+		return ""
+	}
+	if c.Request.Method == http.MethodGet &&
+		(strings.HasPrefix(path, "/v1/models") || strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1beta/openai/models")) {
+		return constant.TokenScopeModelsList
+	}
+	switch {
+	case strings.Contains(path, "/mj/"):
+		return constant.TokenScopeMj
+	case strings.HasPrefix(path, "/suno/"), strings.HasPrefix(path, "/v1/video"),
+		strings.HasPrefix(path, "/kling/"), strings.HasPrefix(path, "/jimeng"):
+		return constant.TokenScopeTasks
+	case strings.HasPrefix(path, "/v1/messages"):
+		return constant.TokenScopeChat
+	}
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions, relayconstant.RelayModeModerations,
+		relayconstant.RelayModeResponses, relayconstant.RelayModeResponsesCompact:
+		return constant.TokenScopeChat
+	case relayconstant.RelayModeGemini:
+		// 与 geminiRelayHandler 一致，路径包含 embed 的为向量化请求
+		if strings.Contains(path, "embed") {
+			return constant.TokenScopeEmbeddings
+		}
+		return constant.TokenScopeChat
+	case relayconstant.RelayModeEmbeddings:
+		return constant.TokenScopeEmbeddings
+	case relayconstant.RelayModeRerank:
+		return constant.TokenScopeRerank
+	case relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeImagesEdits, relayconstant.RelayModeEdits:
+		return constant.TokenScopeImages
+	case relayconstant.RelayModeAudioSpeech, relayconstant.RelayModeAudioTranscription, relayconstant.RelayModeAudioTranslation:
+		return constant.TokenScopeAudio
+	case relayconstant.RelayModeRealtime:
+		return constant.TokenScopeRealtime
+	}
+	return tokenScopeUnmapped
+}
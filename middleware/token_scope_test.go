@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenScopeForRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{http.MethodGet, "/v1/models", constant.TokenScopeModelsList},
+		{http.MethodGet, "/v1/models/gpt-4o", constant.TokenScopeModelsList},
+		{http.MethodGet, "/v1beta/models", constant.TokenScopeModelsList},
+		{http.MethodGet, "/v1beta/openai/models", constant.TokenScopeModelsList},
+		{http.MethodPost, "/v1/chat/completions", constant.TokenScopeChat},
+		{http.MethodPost, "/v1/completions", constant.TokenScopeChat},
+		{http.MethodPost, "/v1/moderations", constant.TokenScopeChat},
+		{http.MethodPost, "/v1/responses", constant.TokenScopeChat},
+		{http.MethodPost, "/v1/responses/compact", constant.TokenScopeChat},
+		{http.MethodPost, "/v1/messages", constant.TokenScopeChat},
+		{http.MethodPost, "/v1beta/models/gemini-2.0-flash:generateContent", constant.TokenScopeChat},
+		{http.MethodPost, "/v1beta/models/text-embedding-004:embedContent", constant.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1/embeddings", constant.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1/engines/text-embedding-ada-002/embeddings", constant.TokenScopeEmbeddings},
+		{http.MethodPost, "/v1/rerank", constant.TokenScopeRerank},
+		{http.MethodPost, "/v1/images/generations", constant.TokenScopeImages},
+		{http.MethodPost, "/v1/images/edits", constant.TokenScopeImages},
+		{http.MethodPost, "/v1/edits", constant.TokenScopeImages},
+		{http.MethodPost, "/v1/audio/speech", constant.TokenScopeAudio},
+		{http.MethodPost, "/v1/audio/transcriptions", constant.TokenScopeAudio},
+		{http.MethodPost, "/v1/audio/translations", constant.TokenScopeAudio},
+		{http.MethodGet, "/v1/realtime", constant.TokenScopeRealtime},
+		{http.MethodPost, "/mj/submit/imagine", constant.TokenScopeMj},
+		{http.MethodGet, "/mj/task/abc/fetch", constant.TokenScopeMj},
+		{http.MethodGet, "/mj/image/abc", constant.TokenScopeMj},
+		{http.MethodPost, "/fast/mj/submit/imagine", constant.TokenScopeMj},
+		{http.MethodPost, "/suno/submit/music", constant.TokenScopeTasks},
+		{http.MethodGet, "/suno/fetch/abc", constant.TokenScopeTasks},
+		{http.MethodPost, "/v1/video/generations", constant.TokenScopeTasks},
+		{http.MethodGet, "/v1/video/generations/abc", constant.TokenScopeTasks},
+		{http.MethodPost, "/v1/videos", constant.TokenScopeTasks},
+		{http.MethodGet, "/v1/videos/abc/content", constant.TokenScopeTasks},
+		// 可灵查询任务时不改写路径
+		{http.MethodGet, "/kling/v1/videos/text2video/abc", constant.TokenScopeTasks},
+		{http.MethodGet, "/kling/v1/videos/image2video/abc", constant.TokenScopeTasks},
+		{http.MethodPost, "/jimeng/", constant.TokenScopeTasks},
+		// 不属于中转调用的接口不受作用域限制
+		{http.MethodGet, "/v1/dashboard/billing/usage", ""},
+		{http.MethodGet, "/dashboard/billing/subscription", ""},
+		{http.MethodPost, "/v1/tokens/derived", ""},
+		// 未映射的中转接口默认拒绝设置了作用域的令牌
+		{http.MethodGet, "/v1/files", tokenScopeUnmapped},
+		{http.MethodPost, "/v1/fine-tunes", tokenScopeUnmapped},
+		{http.MethodPost, "/v1/images/variations", tokenScopeUnmapped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(tt.method, tt.path, nil)
+			if got := tokenScopeForRequest(c); got != tt.want {
+				t.Fatalf("tokenScopeForRequest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
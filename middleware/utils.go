@@ -2,8 +2,10 @@ package middleware
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
 	"github.com/Zer0Echo/uniapi/logger"
 	"github.com/Zer0Echo/uniapi/types"
 	"github.com/gin-gonic/gin"
@@ -35,3 +37,14 @@ func abortWithMidjourneyMessage(c *gin.Context, statusCode int, code int, descri
 	c.Abort()
 	logger.LogError(c.Request.Context(), description)
 }
+
+func abortWithScimMessage(c *gin.Context, statusCode int, detail string) {
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(statusCode, dto.ScimError{
+		Schemas: []string{dto.ScimSchemaError},
+		Status:  strconv.Itoa(statusCode),
+		Detail:  detail,
+	})
+	c.Abort()
+	logger.LogError(c.Request.Context(), "scim | "+detail)
+}
@@ -0,0 +1,303 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/pkg/cachex"
+
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+// AdminRole 由细粒度权限组合的自定义管理角色，通过 users.admin_role_id 分配给用户。
+// 分配了自定义角色的用户仅拥有该角色的权限（管理员亦然），便于客服等只读或部分管理场景
+type AdminRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	Permissions string `json:"permissions" gorm:"type:text"` // JSON 数组
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+const (
+	adminRoleCacheTTL           = time.Minute
+	userAdminRoleCacheNamespace = "new-api:user_admin_role:v1"
+	userAdminRoleCacheCapacity  = 10_000
+)
+
+var (
+	adminRoleCacheLock     sync.RWMutex
+	adminRoleCache         map[int]map[string]bool
+	adminRoleCacheLoadedAt time.Time
+
+	// 每个管理请求都要校验权限，缓存用户分配的角色 id，避免逐次查询用户表
+	userAdminRoleCache     *cachex.HybridCache[int]
+	userAdminRoleCacheOnce sync.Once
+)
+
+func getUserAdminRoleCache() *cachex.HybridCache[int] {
+	userAdminRoleCacheOnce.Do(func() {
+		userAdminRoleCache = cachex.NewHybridCache[int](cachex.HybridCacheConfig[int]{
+			Namespace: cachex.Namespace(userAdminRoleCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.IntCodec{},
+			Memory: func() *hot.HotCache[string, int] {
+				return hot.NewHotCache[string, int](hot.LRU, userAdminRoleCacheCapacity).
+					WithTTL(adminRoleCacheTTL).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return userAdminRoleCache
+}
+
+// getUserAdminRoleId 用户分配的自定义角色 id，0 表示未分配
+func getUserAdminRoleId(userId int) (int, error) {
+	cache := getUserAdminRoleCache()
+	key := strconv.Itoa(userId)
+	if roleId, found, err := cache.Get(key); err == nil && found {
+		return roleId, nil
+	}
+	var roleId int
+	if err := DB.Model(&User{}).Select("admin_role_id").Where("id = ?", userId).Scan(&roleId).Error; err != nil {
+		return 0, err
+	}
+	if err := cache.SetWithTTL(key, roleId, adminRoleCacheTTL); err != nil {
+		common.SysError("failed to cache user admin role: " + err.Error())
+	}
+	return roleId, nil
+}
+
+func invalidateUserAdminRoleCache(userIds ...int) {
+	if len(userIds) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(userIds))
+	for _, id := range userIds {
+		keys = append(keys, strconv.Itoa(id))
+	}
+	if _, err := getUserAdminRoleCache().DeleteMany(keys); err != nil {
+		common.SysError("failed to invalidate user admin role cache: " + err.Error())
+	}
+}
+
+func (r *AdminRole) GetPermissionList() []string {
+	if r.Permissions == "" {
+		return []string{}
+	}
+	var permissions []string
+	if err := common.Unmarshal([]byte(r.Permissions), &permissions); err != nil {
+		common.SysLog(fmt.Sprintf("failed to parse permissions of admin role %d: %s", r.Id, err.Error()))
+		return []string{}
+	}
+	return permissions
+}
+
+// Validate 校验名称与权限并去重
+func (r *AdminRole) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("角色名称不能为空")
+	}
+	if len(r.Name) > 64 {
+		return errors.New("角色名称过长")
+	}
+	permissions := r.GetPermissionList()
+	seen := make(map[string]struct{}, len(permissions))
+	normalized := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if !constant.IsValidPermission(p) {
+			return fmt.Errorf("未知权限: %s", p)
+		}
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		normalized = append(normalized, p)
+	}
+	r.Permissions = common.GetJsonString(normalized)
+	return nil
+}
+
+func GetAllAdminRoles() ([]*AdminRole, error) {
+	var roles []*AdminRole
+	err := DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetAdminRoleById(id int) (*AdminRole, error) {
+	var role AdminRole
+	if err := DB.First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *AdminRole) Insert() error {
+	now := common.GetTimestamp()
+	r.CreatedTime = now
+	r.UpdatedTime = now
+	if err := DB.Create(r).Error; err != nil {
+		return err
+	}
+	invalidateAdminRoleCache()
+	return nil
+}
+
+func (r *AdminRole) Update() error {
+	r.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(&AdminRole{}).Where("id = ?", r.Id).Updates(map[string]interface{}{
+		"name":         r.Name,
+		"description":  r.Description,
+		"permissions":  r.Permissions,
+		"updated_time": r.UpdatedTime,
+	}).Error
+	if err != nil {
+		return err
+	}
+	invalidateAdminRoleCache()
+	return nil
+}
+
+// DeleteAdminRoleById 删除角色并解除其与用户的关联
+func DeleteAdminRoleById(id int) error {
+	var userIds []int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("admin_role_id = ?", id).Pluck("id", &userIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("admin_role_id = ?", id).Update("admin_role_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&AdminRole{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateUserAdminRoleCache(userIds...)
+	invalidateAdminRoleCache()
+	return nil
+}
+
+// SetUserAdminRole 为用户分配自定义角色，roleId 为 0 时取消分配
+func SetUserAdminRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetAdminRoleById(roleId); err != nil {
+			return errors.New("角色不存在")
+		}
+	}
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("admin_role_id", roleId).Error; err != nil {
+		return err
+	}
+	invalidateUserAdminRoleCache(userId)
+	return nil
+}
+
+func invalidateAdminRoleCache() {
+	adminRoleCacheLock.Lock()
+	adminRoleCache = nil
+	adminRoleCacheLock.Unlock()
+}
+
+// getAdminRolePermissions 角色权限集合，多节点部署下缓存最多延迟 adminRoleCacheTTL 生效。
+// 返回的集合为共享缓存，调用方不得修改
+func getAdminRolePermissions(roleId int) (map[string]bool, error) {
+	adminRoleCacheLock.RLock()
+	if adminRoleCache != nil && time.Since(adminRoleCacheLoadedAt) < adminRoleCacheTTL {
+		permissions := adminRoleCache[roleId]
+		adminRoleCacheLock.RUnlock()
+		return permissions, nil
+	}
+	adminRoleCacheLock.RUnlock()
+
+	roles, err := GetAllAdminRoles()
+	if err != nil {
+		return nil, err
+	}
+	cache := make(map[int]map[string]bool, len(roles))
+	for _, role := range roles {
+		set := make(map[string]bool)
+		for _, p := range role.GetPermissionList() {
+			set[p] = true
+		}
+		cache[role.Id] = set
+	}
+	adminRoleCacheLock.Lock()
+	adminRoleCache = cache
+	adminRoleCacheLoadedAt = time.Now()
+	adminRoleCacheLock.Unlock()
+	return cache[roleId], nil
+}
+
+func allPermissionSet() map[string]bool {
+	set := make(map[string]bool, len(constant.AllPermissions))
+	for _, p := range constant.AllPermissions {
+		set[p] = true
+	}
+	return set
+}
+
+// GetUserPermissions 计算用户的管理权限：超级管理员拥有全部权限，
+// 分配了自定义角色的用户使用角色权限，未分配角色的管理员沿用全部管理权限
+func GetUserPermissions(userId int, role int) (map[string]bool, error) {
+	if role >= common.RoleRootUser {
+		return allPermissionSet(), nil
+	}
+	adminRoleId, err := getUserAdminRoleId(userId)
+	if err != nil {
+		return nil, err
+	}
+	if adminRoleId > 0 {
+		permissions, err := getAdminRolePermissions(adminRoleId)
+		if err != nil {
+			return nil, err
+		}
+		if permissions == nil {
+			permissions = map[string]bool{}
+		}
+		return permissions, nil
+	}
+	if role >= common.RoleAdminUser {
+		return allPermissionSet(), nil
+	}
+	return map[string]bool{}, nil
+}
+
+// UserHasPermission 检查用户是否拥有指定的全部权限
+func UserHasPermission(userId int, role int, permissions ...string) bool {
+	granted, err := GetUserPermissions(userId, role)
+	if err != nil {
+		common.SysError("failed to get user permissions: " + err.Error())
+		return false
+	}
+	for _, p := range permissions {
+		if !granted[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// PermissionList 权限集合转为有序列表
+func PermissionList(set map[string]bool) []string {
+	list := make([]string, 0, len(set))
+	for _, p := range constant.AllPermissions {
+		if set[p] {
+			list = append(list, p)
+		}
+	}
+	return list
+}
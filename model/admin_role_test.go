@@ -0,0 +1,117 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+)
+
+func createTestAdminRole(t *testing.T, permissions ...string) *AdminRole {
+	t.Helper()
+	role := &AdminRole{Name: "role_" + common.GetRandomString(8), Permissions: common.GetJsonString(permissions)}
+	if err := role.Validate(); err != nil {
+		t.Fatalf("invalid role: %v", err)
+	}
+	if err := role.Insert(); err != nil {
+		t.Fatalf("failed to create role: %v", err)
+	}
+	return role
+}
+
+func createTestRoleUser(t *testing.T, role int, adminRoleId int) *User {
+	t.Helper()
+	user := createLedgerTestUser(t, 0)
+	if err := DB.Model(user).Updates(map[string]interface{}{"role": role, "admin_role_id": adminRoleId}).Error; err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	user.Role = role
+	return user
+}
+
+func TestGetUserPermissions(t *testing.T) {
+	support := createTestAdminRole(t, constant.PermissionUsersRead, constant.PermissionTicketsReply)
+	all := PermissionList(allPermissionSet())
+
+	tests := []struct {
+		name        string
+		role        int
+		adminRoleId int
+		want        []string
+	}{
+		{name: "root gets everything", role: common.RoleRootUser, want: all},
+		{name: "root ignores assigned role", role: common.RoleRootUser, adminRoleId: support.Id, want: all},
+		{name: "admin without role gets everything", role: common.RoleAdminUser, want: all},
+		{name: "admin with role is limited to the role", role: common.RoleAdminUser, adminRoleId: support.Id, want: []string{constant.PermissionUsersRead, constant.PermissionTicketsReply}},
+		{name: "common user with role gets the role", role: common.RoleCommonUser, adminRoleId: support.Id, want: []string{constant.PermissionUsersRead, constant.PermissionTicketsReply}},
+		{name: "common user without role gets nothing", role: common.RoleCommonUser, want: []string{}},
+		{name: "deleted role grants nothing", role: common.RoleAdminUser, adminRoleId: 999999, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createTestRoleUser(t, tt.role, tt.adminRoleId)
+			granted, err := GetUserPermissions(user.Id, user.Role)
+			if err != nil {
+				t.Fatalf("GetUserPermissions: %v", err)
+			}
+			got := PermissionList(granted)
+			if len(got) != len(tt.want) {
+				t.Fatalf("permissions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("permissions = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUserPermissionsCacheInvalidation(t *testing.T) {
+	support := createTestAdminRole(t, constant.PermissionUsersRead)
+	billing := createTestAdminRole(t, constant.PermissionBillingRead)
+	user := createTestRoleUser(t, common.RoleCommonUser, 0)
+
+	if UserHasPermission(user.Id, user.Role, constant.PermissionUsersRead) {
+		t.Fatal("expected user without role to have no permissions")
+	}
+	// 分配角色后立即生效，不受缓存影响
+	if err := SetUserAdminRole(user.Id, support.Id); err != nil {
+		t.Fatalf("SetUserAdminRole: %v", err)
+	}
+	if !UserHasPermission(user.Id, user.Role, constant.PermissionUsersRead) {
+		t.Fatal("expected assigned role to take effect")
+	}
+	// 角色分配已缓存，绕过 SetUserAdminRole 的直接修改在缓存过期前不生效
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("admin_role_id", billing.Id).Error; err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	if !UserHasPermission(user.Id, user.Role, constant.PermissionUsersRead) {
+		t.Fatal("expected role assignment to be served from cache")
+	}
+	if err := SetUserAdminRole(user.Id, billing.Id); err != nil {
+		t.Fatalf("SetUserAdminRole: %v", err)
+	}
+	if UserHasPermission(user.Id, user.Role, constant.PermissionUsersRead) || !UserHasPermission(user.Id, user.Role, constant.PermissionBillingRead) {
+		t.Fatal("expected reassigned role to take effect")
+	}
+
+	billing.Permissions = common.GetJsonString([]string{constant.PermissionBillingRead, constant.PermissionBillingWrite})
+	if err := billing.Update(); err != nil {
+		t.Fatalf("failed to update role: %v", err)
+	}
+	if !UserHasPermission(user.Id, user.Role, constant.PermissionBillingRead, constant.PermissionBillingWrite) {
+		t.Fatal("expected role update to take effect")
+	}
+
+	// 删除角色后用户失去权限
+	if err := DeleteAdminRoleById(billing.Id); err != nil {
+		t.Fatalf("DeleteAdminRoleById: %v", err)
+	}
+	if UserHasPermission(user.Id, user.Role, constant.PermissionBillingRead) {
+		t.Fatal("expected permissions to be revoked with the role")
+	}
+	if roleId, err := getUserAdminRoleId(user.Id); err != nil || roleId != 0 {
+		t.Fatalf("expected role assignment to be cleared, got %d, %v", roleId, err)
+	}
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AuditLog 管理操作审计记录，与消费日志分开存储和清理。
+// Before / After 为变更前后的 JSON 快照（敏感字段已脱敏），Diff 仅包含发生变化的顶层字段
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Username   string `json:"username" gorm:"type:varchar(64);default:''"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Method     string `json:"method" gorm:"type:varchar(8)"`
+	Path       string `json:"path" gorm:"type:varchar(255)"`
+	Action     string `json:"action" gorm:"type:varchar(255);index"` // 请求方法与路由，例如 PUT /api/channel/
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index"`
+	Before     string `json:"before" gorm:"type:text"`
+	After      string `json:"after" gorm:"type:text"`
+	Diff       string `json:"diff" gorm:"type:text"`
+	StatusCode int    `json:"status_code"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message" gorm:"type:varchar(255);default:''"`
+}
+
+type AuditLogFilter struct {
+	UserId         int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+const auditLogBatchSize = 1000
+
+// NormalizeAuditValue 将快照转为脱敏后的 JSON 值，设置时立即拷贝，避免后续修改影响快照
+func NormalizeAuditValue(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded any
+	if err := common.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	return common.RedactSensitiveFields(decoded)
+}
+
+// AuditTarget 指定本次管理操作的目标对象，未指定时按路由推断
+func AuditTarget(c *gin.Context, targetType string, targetId any) {
+	common.SetContextKey(c, constant.ContextKeyAuditTargetType, targetType)
+	common.SetContextKey(c, constant.ContextKeyAuditTargetId, fmt.Sprint(targetId))
+}
+
+// AuditBefore 记录变更前快照
+func AuditBefore(c *gin.Context, v any) {
+	common.SetContextKey(c, constant.ContextKeyAuditBefore, NormalizeAuditValue(v))
+}
+
+// AuditAfter 记录变更后快照，未记录时使用脱敏后的请求体
+func AuditAfter(c *gin.Context, v any) {
+	common.SetContextKey(c, constant.ContextKeyAuditAfter, NormalizeAuditValue(v))
+}
+
+// BuildAuditDiff 比较两个快照的顶层字段，返回 {字段: {before, after}}
+func BuildAuditDiff(before any, after any) map[string]any {
+	beforeMap, _ := before.(map[string]any)
+	afterMap, _ := after.(map[string]any)
+	if beforeMap == nil || afterMap == nil {
+		return nil
+	}
+	keys := make(map[string]struct{}, len(beforeMap)+len(afterMap))
+	for k := range beforeMap {
+		keys[k] = struct{}{}
+	}
+	for k := range afterMap {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	diff := make(map[string]any)
+	for _, k := range sorted {
+		b, bok := beforeMap[k]
+		a, aok := afterMap[k]
+		// 部分更新请求只包含修改的字段，after 中缺失的字段视为未变更
+		if !aok {
+			continue
+		}
+		if bok && reflect.DeepEqual(a, b) {
+			continue
+		}
+		diff[k] = map[string]any{"before": b, "after": a}
+	}
+	return diff
+}
+
+func RecordAuditLog(log *AuditLog) error {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(log).Error
+}
+
+func (f *AuditLogFilter) query() *gorm.DB {
+	tx := DB.Model(&AuditLog{})
+	if f.UserId != 0 {
+		tx = tx.Where("user_id = ?", f.UserId)
+	}
+	if f.Action != "" {
+		tx = tx.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		tx = tx.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetId != "" {
+		tx = tx.Where("target_id = ?", f.TargetId)
+	}
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", f.EndTimestamp)
+	}
+	return tx
+}
+
+func GetAuditLogs(filter AuditLogFilter, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	if err = filter.query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = filter.query().Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// StreamAuditLogs 按 id 升序分批读取审计记录，用于导出
+func StreamAuditLogs(filter AuditLogFilter, fn func(logs []*AuditLog) error) error {
+	lastId := 0
+	for {
+		var logs []*AuditLog
+		if err := filter.query().Where("id > ?", lastId).Order("id asc").Limit(auditLogBatchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < auditLogBatchSize {
+			return nil
+		}
+	}
+}
+
+// DeleteAuditLogsBefore 清理早于指定时间的审计记录
+func DeleteAuditLogsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&AuditLog{})
+	return result.RowsAffected, result.Error
+}
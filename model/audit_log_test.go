@@ -0,0 +1,46 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func TestNormalizeAuditValue(t *testing.T) {
+	token := &Token{Id: 3, Name: "prod", Key: "sk-plain"}
+	normalized, ok := NormalizeAuditValue(token).(map[string]any)
+	if !ok {
+		t.Fatalf("expected object snapshot, got %T", NormalizeAuditValue(token))
+	}
+	if normalized["key"] != common.RedactedValue || normalized["name"] != "prod" {
+		t.Fatalf("unexpected snapshot %v", normalized)
+	}
+	// 快照在设置时拷贝，之后的修改不影响快照
+	token.Name = "changed"
+	if normalized["name"] != "prod" {
+		t.Fatal("expected snapshot to be copied")
+	}
+	if NormalizeAuditValue(nil) != nil {
+		t.Fatal("expected nil snapshot")
+	}
+}
+
+func TestBuildAuditDiff(t *testing.T) {
+	before := map[string]any{"name": "old", "quota": float64(1), "status": float64(1), "key": common.RedactedValue}
+	after := map[string]any{"name": "new", "quota": float64(1), "key": common.RedactedValue, "group": "vip"}
+	want := map[string]any{
+		"name":  map[string]any{"before": "old", "after": "new"},
+		"group": map[string]any{"before": nil, "after": "vip"},
+	}
+	// after 中缺失的字段视为未变更，脱敏后相同的密钥不出现在差异中
+	if got := BuildAuditDiff(before, after); !reflect.DeepEqual(got, want) {
+		t.Fatalf("BuildAuditDiff = %v, want %v", got, want)
+	}
+	if got := BuildAuditDiff(nil, after); got != nil {
+		t.Fatalf("expected no diff without before snapshot, got %v", got)
+	}
+	if got := BuildAuditDiff(before, []any{"x"}); got != nil {
+		t.Fatalf("expected no diff for non-object snapshot, got %v", got)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/constant"
@@ -58,13 +60,15 @@ type Channel struct {
 }
 
 type ChannelInfo struct {
-	IsMultiKey             bool                  `json:"is_multi_key"`                        // 是否多Key模式
-	MultiKeySize           int                   `json:"multi_key_size"`                      // 多Key模式下的Key数量
-	MultiKeyStatusList     map[int]int           `json:"multi_key_status_list"`               // key状态列表，key index -> status
-	MultiKeyDisabledReason map[int]string        `json:"multi_key_disabled_reason,omitempty"` // key禁用原因列表，key index -> reason
-	MultiKeyDisabledTime   map[int]int64         `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
-	MultiKeyPollingIndex   int                   `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
-	MultiKeyMode           constant.MultiKeyMode `json:"multi_key_mode"`
+	IsMultiKey             bool                   `json:"is_multi_key"`                        // 是否多Key模式
+	MultiKeySize           int                    `json:"multi_key_size"`                      // 多Key模式下的Key数量
+	MultiKeyStatusList     map[int]int            `json:"multi_key_status_list"`               // key状态列表，key index -> status
+	MultiKeyDisabledReason map[int]string         `json:"multi_key_disabled_reason,omitempty"` // key禁用原因列表，key index -> reason
+	MultiKeyDisabledTime   map[int]int64          `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
+	MultiKeyPollingIndex   int                    `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
+	MultiKeyMode           constant.MultiKeyMode  `json:"multi_key_mode"`
+	MultiKeyBudget         MultiKeyBudget         `json:"multi_key_budget"`                    // 每个 Key 的默认限额
+	MultiKeyBudgetOverride map[int]MultiKeyBudget `json:"multi_key_budget_override,omitempty"` // 按 Key 下标覆盖限额
 }
 
 // Value implements driver.Valuer interface
@@ -78,6 +82,38 @@ func (c *ChannelInfo) Scan(value interface{}) error {
 	return common.Unmarshal(bytesValue, c)
 }
 
+// BeforeSave 渠道密钥落库前加密，已加密或未配置主密钥时不做处理
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	if err := channel.encryptBalanceAdminKey(tx); err != nil {
+		return err
+	}
+	if channel.Key == "" || common.IsEncryptedChannelKey(channel.Key) || !common.ChannelKeyEncryptionEnabled() {
+		return nil
+	}
+	encrypted, err := common.EncryptChannelKey(channel.Key)
+	if err != nil {
+		return err
+	}
+	tx.Statement.SetColumn("key", encrypted)
+	return nil
+}
+
+// UpdateChannelKey 直接更新渠道密钥列（如 OAuth 凭证刷新），按需加密后写入
+func UpdateChannelKey(id int, key string) error {
+	stored, err := common.EncryptChannelKey(key)
+	if err != nil {
+		return err
+	}
+	return DB.Session(&gorm.Session{SkipHooks: true}).Model(&Channel{}).Where("id = ?", id).Update("key", stored).Error
+}
+
+// GetPlainKey 解密后的完整密钥字符串，仅在需要直接使用密钥时调用，避免明文长期驻留内存。
+// 渠道密钥的解密统一经过这里（GetKeys / GetNextEnabledKey 也由此解密），各调用方按次解密而不缓存明文：
+// 渠道缓存、任务轮询等路径持有的 Channel 可能长期驻留内存或被序列化，AES-GCM 解密开销可以忽略
+func (channel *Channel) GetPlainKey() (string, error) {
+	return common.DecryptChannelKey(channel.Key)
+}
+
 func (channel *Channel) GetKeys() []string {
 	if channel.Key == "" {
 		return []string{}
@@ -85,7 +121,25 @@ func (channel *Channel) GetKeys() []string {
 	if len(channel.Keys) > 0 {
 		return channel.Keys
 	}
-	trimmed := strings.TrimSpace(channel.Key)
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to decrypt channel key: channel_id=%d, error=%v", channel.Id, err))
+		return []string{}
+	}
+	return parseChannelKeys(plainKey)
+}
+
+// GetFirstKey 多密钥渠道的第一个密钥，用于管理操作
+func (channel *Channel) GetFirstKey() string {
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+func parseChannelKeys(plainKey string) []string {
+	trimmed := strings.TrimSpace(plainKey)
 	// If the key starts with '[', try to parse it as a JSON array (e.g., for Vertex AI scenarios)
 	if strings.HasPrefix(trimmed, "[") {
 		var arr []json.RawMessage
@@ -98,14 +152,18 @@ func (channel *Channel) GetKeys() []string {
 		}
 	}
 	// Otherwise, fall back to splitting by newline
-	keys := strings.Split(strings.Trim(channel.Key, "\n"), "\n")
+	keys := strings.Split(strings.Trim(plainKey, "\n"), "\n")
 	return keys
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
-		return channel.Key, 0, nil
+		plainKey, err := channel.GetPlainKey()
+		if err != nil {
+			return "", 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+		}
+		return plainKey, 0, nil
 	}
 
 	// Obtain all keys (split by \n)
@@ -145,48 +203,83 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 过滤冷却中或超出限额的 Key
+	now := time.Now()
+	usages := GetChannelKeyUsages(channel.Id, keys)
+	availableIdx := make([]int, 0, len(enabledIdx))
+	var recoverAt int64
+	for _, idx := range enabledIdx {
+		until := usages[idx].unavailableUntil(channel.ChannelInfo.GetKeyBudget(idx), now)
+		if until == 0 {
+			availableIdx = append(availableIdx, idx)
+		} else if recoverAt == 0 || until < recoverAt {
+			recoverAt = until
+		}
+	}
+	if len(availableIdx) == 0 {
+		markChannelKeysUnavailable(channel.Id, recoverAt)
+		return "", 0, types.NewErrorWithStatusCode(fmt.Errorf("all keys of channel #%d are rate limited or over budget", channel.Id), types.ErrorCodeChannelKeysUnavailable, http.StatusTooManyRequests)
+	}
+	available := make(map[int]bool, len(availableIdx))
+	for _, idx := range availableIdx {
+		available[idx] = true
+	}
+
+	selectedIdx := availableIdx[0]
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
-		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
+		// Randomly pick one available key
+		selectedIdx = availableIdx[rand.Intn(len(availableIdx))]
 	case constant.MultiKeyModePolling:
-		// Use channel-specific lock to ensure thread-safe polling
-
-		channelInfo, err := CacheGetChannelInfo(channel.Id)
-		if err != nil {
-			return "", 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
-		}
-		//println("before polling index:", channel.ChannelInfo.MultiKeyPollingIndex)
-		defer func() {
-			if common.DebugEnabled {
-				println(fmt.Sprintf("channel %d polling index: %d", channel.Id, channel.ChannelInfo.MultiKeyPollingIndex))
-			}
-			if !common.MemoryCacheEnabled {
-				_ = channel.SaveChannelInfo()
-			} else {
-				// CacheUpdateChannel(channel)
+		// 启用 Redis 时轮询位置在多个节点间共享
+		start, shared := nextChannelKeyPollingIndex(channel.Id, len(keys))
+		if !shared {
+			// Use channel-specific lock to ensure thread-safe polling
+			channelInfo, err := CacheGetChannelInfo(channel.Id)
+			if err != nil {
+				return "", 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 			}
-		}()
-		// Start from the saved polling index and look for the next enabled key
-		start := channelInfo.MultiKeyPollingIndex
+			start = channelInfo.MultiKeyPollingIndex
+			defer func() {
+				if common.DebugEnabled {
+					println(fmt.Sprintf("channel %d polling index: %d", channel.Id, channel.ChannelInfo.MultiKeyPollingIndex))
+				}
+				if !common.MemoryCacheEnabled {
+					_ = channel.SaveChannelInfo()
+				}
+			}()
+		}
 		if start < 0 || start >= len(keys) {
 			start = 0
 		}
+		// Start from the polling index and look for the next available key
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
-				// update polling index for next call (point to the next position)
-				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
-				return keys[idx], idx, nil
+			if available[idx] {
+				selectedIdx = idx
+				break
 			}
 		}
-		// Fallback – should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		if !shared {
+			// update polling index for next call (point to the next position)
+			channel.ChannelInfo.MultiKeyPollingIndex = (selectedIdx + 1) % len(keys)
+		}
+	case constant.MultiKeyModeLeastUsed:
+		// 按当日消耗的 token 数分摊，相同时选择请求数更少的 Key
+		for _, idx := range availableIdx[1:] {
+			current, candidate := usages[selectedIdx], usages[idx]
+			if candidate.DailyTokens < current.DailyTokens ||
+				(candidate.DailyTokens == current.DailyTokens && candidate.DailyRequests < current.DailyRequests) {
+				selectedIdx = idx
+			}
+		}
+	case constant.MultiKeyModeFillFirst:
+		// 按顺序用尽一个 Key 的限额后再使用下一个
 	default:
-		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		// Unknown mode, default to first available key
 	}
+	recordChannelKeyUsage(channel.Id, keys[selectedIdx], 1, 0, 0)
+	return keys[selectedIdx], selectedIdx, nil
 }
 
 func (channel *Channel) SaveChannelInfo() error {
@@ -458,30 +551,13 @@ func (channel *Channel) Insert() error {
 func (channel *Channel) Update() error {
 	// If this is a multi-key channel, recalculate MultiKeySize based on the current key list to avoid inconsistency after editing keys
 	if channel.ChannelInfo.IsMultiKey {
-		var keyStr string
+		var keys []string
 		if channel.Key != "" {
-			keyStr = channel.Key
+			keys = channel.GetKeys()
 		} else {
 			// If key is not provided, read the existing key from the database
 			if existing, err := GetChannelById(channel.Id, true); err == nil {
-				keyStr = existing.Key
-			}
-		}
-		// Parse the key list (supports newline separation or JSON array)
-		keys := []string{}
-		if keyStr != "" {
-			trimmed := strings.TrimSpace(keyStr)
-			if strings.HasPrefix(trimmed, "[") {
-				var arr []json.RawMessage
-				if err := common.Unmarshal([]byte(trimmed), &arr); err == nil {
-					keys = make([]string, len(arr))
-					for i, v := range arr {
-						keys[i] = string(v)
-					}
-				}
-			}
-			if len(keys) == 0 { // fallback to newline split
-				keys = strings.Split(strings.Trim(keyStr, "\n"), "\n")
+				keys = existing.GetKeys()
 			}
 		}
 		channel.ChannelInfo.MultiKeySize = len(keys)
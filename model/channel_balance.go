@@ -0,0 +1,166 @@
+package model
+
+import (
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+
+	"gorm.io/gorm"
+)
+
+// channelBalanceHistoryRetention 余额历史保留天数
+const channelBalanceHistoryRetention = 90
+
+// ChannelBalanceHistory 渠道余额历史，每次查询余额成功后记录，用于估算消耗速度
+type ChannelBalanceHistory struct {
+	Id        int     `json:"id"`
+	ChannelId int     `json:"channel_id" gorm:"index:idx_channel_balance_time,priority:1"`
+	Balance   float64 `json:"balance"` // in USD
+	CreatedAt int64   `json:"created_at" gorm:"bigint;index:idx_channel_balance_time,priority:2"`
+}
+
+// ChannelBalanceForecast 按余额历史估算的消耗速度，BurnRate 为每天消耗的美元，
+// ExhaustTime 为预计余额耗尽的时间，无法估算时为 0
+type ChannelBalanceForecast struct {
+	BurnRate    float64 `json:"burn_rate"`
+	ExhaustTime int64   `json:"exhaust_time"`
+}
+
+// RecordChannelBalance 记录渠道余额，同时清理过期的历史
+func RecordChannelBalance(channelId int, balance float64) {
+	now := common.GetTimestamp()
+	err := DB.Create(&ChannelBalanceHistory{
+		ChannelId: channelId,
+		Balance:   balance,
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		common.SysError("failed to record channel balance: " + err.Error())
+		return
+	}
+	expired := now - int64(channelBalanceHistoryRetention*24*time.Hour/time.Second)
+	DB.Where("channel_id = ? AND created_at < ?", channelId, expired).Delete(&ChannelBalanceHistory{})
+}
+
+// GetChannelBalanceHistory 按时间顺序返回 startTime 之后的余额历史
+func GetChannelBalanceHistory(channelId int, startTime int64) ([]*ChannelBalanceHistory, error) {
+	var history []*ChannelBalanceHistory
+	err := DB.Where("channel_id = ? AND created_at >= ?", channelId, startTime).
+		Order("created_at asc").Find(&history).Error
+	return history, err
+}
+
+// ForecastChannelBalance 只累计相邻记录间余额的下降，充值造成的上涨不会抵消消耗；
+// 记录跨度不足一小时时不做估算
+func ForecastChannelBalance(history []*ChannelBalanceHistory) ChannelBalanceForecast {
+	var forecast ChannelBalanceForecast
+	if len(history) < 2 {
+		return forecast
+	}
+	first, last := history[0], history[len(history)-1]
+	span := last.CreatedAt - first.CreatedAt
+	if span < int64(time.Hour/time.Second) {
+		return forecast
+	}
+	var consumed float64
+	for i := 1; i < len(history); i++ {
+		if drop := history[i-1].Balance - history[i].Balance; drop > 0 {
+			consumed += drop
+		}
+	}
+	forecast.BurnRate = consumed / float64(span) * 86400
+	if forecast.BurnRate > 0 && last.Balance > 0 {
+		forecast.ExhaustTime = last.CreatedAt + int64(last.Balance/forecast.BurnRate*86400)
+	}
+	return forecast
+}
+
+// updateBalanceAdminKey 修改 settings.balance 中的管理密钥字段，保留 settings 中的其他字段；
+// fn 返回 false 时不做修改
+func (channel *Channel) updateBalanceAdminKey(fn func(balance map[string]any) bool) (bool, error) {
+	if channel.OtherSettings == "" {
+		return false, nil
+	}
+	var settings map[string]any
+	if err := common.UnmarshalJsonStr(channel.OtherSettings, &settings); err != nil {
+		return false, nil
+	}
+	balance, ok := settings["balance"].(map[string]any)
+	if !ok || !fn(balance) {
+		return false, nil
+	}
+	data, err := common.Marshal(settings)
+	if err != nil {
+		return false, err
+	}
+	channel.OtherSettings = string(data)
+	return true, nil
+}
+
+// encryptBalanceAdminKey 余额查询的管理密钥与渠道密钥一样加密落库
+func (channel *Channel) encryptBalanceAdminKey(tx *gorm.DB) error {
+	var encryptErr error
+	changed, err := channel.updateBalanceAdminKey(func(balance map[string]any) bool {
+		key, _ := balance["admin_key"].(string)
+		_, keySet := balance["admin_key_set"]
+		if !keySet && (key == "" || common.IsEncryptedChannelKey(key) || !common.ChannelKeyEncryptionEnabled()) {
+			return false
+		}
+		delete(balance, "admin_key_set")
+		if key != "" {
+			balance["admin_key"], encryptErr = common.EncryptChannelKey(key)
+		}
+		return encryptErr == nil
+	})
+	if encryptErr != nil {
+		return encryptErr
+	}
+	if err != nil {
+		return err
+	}
+	if changed {
+		tx.Statement.SetColumn("settings", channel.OtherSettings)
+	}
+	return nil
+}
+
+// MaskBalanceAdminKey 接口返回渠道前隐藏管理密钥，仅保留是否已设置
+func (channel *Channel) MaskBalanceAdminKey() {
+	_, _ = channel.updateBalanceAdminKey(func(balance map[string]any) bool {
+		key, _ := balance["admin_key"].(string)
+		if key == "" {
+			return false
+		}
+		delete(balance, "admin_key")
+		balance["admin_key_set"] = true
+		return true
+	})
+}
+
+// KeepBalanceAdminKey 编辑渠道时未重新填写管理密钥则沿用原值
+func (channel *Channel) KeepBalanceAdminKey(origin *Channel) {
+	var originKey string
+	_, _ = origin.updateBalanceAdminKey(func(balance map[string]any) bool {
+		originKey, _ = balance["admin_key"].(string)
+		return false
+	})
+	_, _ = channel.updateBalanceAdminKey(func(balance map[string]any) bool {
+		key, _ := balance["admin_key"].(string)
+		keySet, _ := balance["admin_key_set"].(bool)
+		if key != "" || !keySet {
+			return false
+		}
+		delete(balance, "admin_key_set")
+		balance["admin_key"] = originKey
+		return true
+	})
+}
+
+// GetBalanceAdminKey 解密后的余额查询管理密钥
+func (channel *Channel) GetBalanceAdminKey() (string, error) {
+	settings := channel.GetOtherSettings()
+	if settings.Balance == nil {
+		return "", nil
+	}
+	return common.DecryptChannelKey(settings.Balance.AdminKey)
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func balanceHistory(points ...[2]float64) []*ChannelBalanceHistory {
+	history := make([]*ChannelBalanceHistory, len(points))
+	for i, p := range points {
+		history[i] = &ChannelBalanceHistory{ChannelId: 1, CreatedAt: int64(p[0]), Balance: p[1]}
+	}
+	return history
+}
+
+func TestForecastChannelBalance(t *testing.T) {
+	const day = 86400
+	tests := []struct {
+		name    string
+		history []*ChannelBalanceHistory
+		want    ChannelBalanceForecast
+	}{
+		{name: "no history"},
+		{name: "single record", history: balanceHistory([2]float64{0, 100})},
+		// 跨度不足一小时不做估算
+		{name: "span too short", history: balanceHistory([2]float64{0, 100}, [2]float64{3599, 50})},
+		{name: "steady burn", history: balanceHistory([2]float64{0, 100}, [2]float64{day / 2, 90}, [2]float64{day, 80}), want: ChannelBalanceForecast{BurnRate: 20, ExhaustTime: day + 4*day}},
+		{name: "hourly burn", history: balanceHistory([2]float64{0, 10}, [2]float64{3600, 9}), want: ChannelBalanceForecast{BurnRate: 24, ExhaustTime: 3600 + 9*3600}},
+		// 充值带来的上涨不抵消消耗
+		{name: "top up ignored", history: balanceHistory([2]float64{0, 100}, [2]float64{day / 2, 70}, [2]float64{day / 2, 170}, [2]float64{day, 160}), want: ChannelBalanceForecast{BurnRate: 40, ExhaustTime: day + 4*day}},
+		{name: "no consumption", history: balanceHistory([2]float64{0, 100}, [2]float64{day, 100})},
+		{name: "only top up", history: balanceHistory([2]float64{0, 100}, [2]float64{day, 150})},
+		// 余额已耗尽时不估算耗尽时间
+		{name: "already exhausted", history: balanceHistory([2]float64{0, 10}, [2]float64{day, 0}), want: ChannelBalanceForecast{BurnRate: 10}},
+		{name: "negative balance", history: balanceHistory([2]float64{0, 10}, [2]float64{day, -5}), want: ChannelBalanceForecast{BurnRate: 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForecastChannelBalance(tt.history); got != tt.want {
+				t.Fatalf("ForecastChannelBalance = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordChannelBalance(t *testing.T) {
+	resetTables(t, &ChannelBalanceHistory{})
+	now := common.GetTimestamp()
+	// 超过保留天数的历史在记录新余额时清理
+	old := []*ChannelBalanceHistory{
+		{ChannelId: 1, Balance: 300, CreatedAt: now - (channelBalanceHistoryRetention+1)*86400},
+		{ChannelId: 1, Balance: 200, CreatedAt: now - 86400},
+		{ChannelId: 2, Balance: 500, CreatedAt: now - (channelBalanceHistoryRetention+1)*86400},
+	}
+	if err := DB.Create(&old).Error; err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	RecordChannelBalance(1, 150)
+
+	history, err := GetChannelBalanceHistory(1, 0)
+	if err != nil {
+		t.Fatalf("GetChannelBalanceHistory: %v", err)
+	}
+	if len(history) != 2 || history[0].Balance != 200 || history[1].Balance != 150 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if history, _ = GetChannelBalanceHistory(1, now-3600); len(history) != 1 || history[0].Balance != 150 {
+		t.Fatalf("expected history to be filtered by start time, got %+v", history)
+	}
+	// 只清理当前渠道的历史
+	if history, _ = GetChannelBalanceHistory(2, 0); len(history) != 1 {
+		t.Fatalf("expected other channel history to be kept, got %+v", history)
+	}
+}
@@ -69,7 +69,10 @@ func InitChannelCache() {
 	//channelsIDM = newChannelId2channel
 	for i, channel := range newChannelId2channel {
 		if channel.ChannelInfo.IsMultiKey {
-			channel.Keys = channel.GetKeys()
+			// 加密存储的密钥每次使用时解密，不在缓存中保留明文
+			if !common.IsEncryptedChannelKey(channel.Key) {
+				channel.Keys = channel.GetKeys()
+			}
 			if channel.ChannelInfo.MultiKeyMode == constant.MultiKeyModePolling {
 				if oldChannel, ok := channelsIDM[i]; ok {
 					// 存在旧的渠道，如果是多key且轮询，保留轮询索引信息
@@ -115,6 +118,9 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	// 跳过所有 Key 都在冷却或超出限额的多 Key 渠道
+	channels = filterKeysUnavailableChannels(channels)
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -0,0 +1,317 @@
+package model
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+const (
+	defaultChannelKeyCooldownSeconds = 60
+	maxChannelKeyCooldownSeconds     = 3600
+)
+
+// MultiKeyBudget 多 Key 渠道中单个 Key 的限额，0 表示不限制
+type MultiKeyBudget struct {
+	RPM        int `json:"rpm"`
+	TPM        int `json:"tpm"`
+	DailyQuota int `json:"daily_quota"` // 每日消耗额度上限
+	// 上游返回 429 且没有 Retry-After 时的冷却时间，默认 60 秒
+	CooldownSeconds int `json:"cooldown_seconds"`
+}
+
+// ChannelKeyUsage 单个 Key 的用量统计，启用 Redis 时在多个节点间共享
+type ChannelKeyUsage struct {
+	Index          int   `json:"index"`
+	MinuteRequests int64 `json:"minute_requests"`
+	MinuteTokens   int64 `json:"minute_tokens"`
+	DailyRequests  int64 `json:"daily_requests"`
+	DailyTokens    int64 `json:"daily_tokens"`
+	DailyQuota     int64 `json:"daily_quota"`
+	TotalRequests  int64 `json:"total_requests"`
+	TotalTokens    int64 `json:"total_tokens"`
+	TotalQuota     int64 `json:"total_quota"`
+	LastUsedTime   int64 `json:"last_used_time"`
+	CooldownUntil  int64 `json:"cooldown_until,omitempty"`
+}
+
+// GetKeyBudget 返回 Key 生效的限额，MultiKeyBudgetOverride 优先
+func (info *ChannelInfo) GetKeyBudget(index int) MultiKeyBudget {
+	if budget, ok := info.MultiKeyBudgetOverride[index]; ok {
+		return budget
+	}
+	return info.MultiKeyBudget
+}
+
+// unavailableUntil Key 因冷却或超出限额不可用时，返回预计恢复的时间
+func (usage ChannelKeyUsage) unavailableUntil(budget MultiKeyBudget, now time.Time) int64 {
+	var until int64
+	if usage.CooldownUntil > now.Unix() {
+		until = usage.CooldownUntil
+	}
+	if (budget.RPM > 0 && usage.MinuteRequests >= int64(budget.RPM)) || (budget.TPM > 0 && usage.MinuteTokens >= int64(budget.TPM)) {
+		until = max(until, now.Truncate(time.Minute).Add(time.Minute).Unix())
+	}
+	if budget.DailyQuota > 0 && usage.DailyQuota >= int64(budget.DailyQuota) {
+		year, month, day := now.Date()
+		until = max(until, time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Unix())
+	}
+	return until
+}
+
+// channelKeyHash 用量按 Key 内容而不是下标记录，删除或调整 Key 后统计不会错位
+func channelKeyHash(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+func channelKeyUsageKeys(channelId int, now time.Time) (minuteKey, dayKey, totalKey, cooldownKey string) {
+	prefix := fmt.Sprintf("channel_key_usage:%d", channelId)
+	return fmt.Sprintf("%s:m:%d", prefix, now.Unix()/60), prefix + ":d:" + now.Format("20060102"), prefix + ":total", prefix + ":cooldown"
+}
+
+type channelKeyCounters struct {
+	mu             sync.Mutex
+	minute         int64
+	minuteRequests int64
+	minuteTokens   int64
+	day            string
+	dailyRequests  int64
+	dailyTokens    int64
+	dailyQuota     int64
+	totalRequests  int64
+	totalTokens    int64
+	totalQuota     int64
+	lastUsed       int64
+	cooldownUntil  int64
+}
+
+// roll 进入新的分钟或自然日时清零对应计数，调用方需持有锁
+func (c *channelKeyCounters) roll(now time.Time) {
+	if minute := now.Unix() / 60; c.minute != minute {
+		c.minute, c.minuteRequests, c.minuteTokens = minute, 0, 0
+	}
+	if day := now.Format("20060102"); c.day != day {
+		c.day, c.dailyRequests, c.dailyTokens, c.dailyQuota = day, 0, 0, 0
+	}
+}
+
+var channelKeyUsageMem sync.Map // "channelId:keyHash" -> *channelKeyCounters
+
+func getChannelKeyCounters(channelId int, hash string) *channelKeyCounters {
+	v, _ := channelKeyUsageMem.LoadOrStore(fmt.Sprintf("%d:%s", channelId, hash), &channelKeyCounters{})
+	return v.(*channelKeyCounters)
+}
+
+// GetChannelKeyUsages 返回渠道各个 Key 的用量，顺序与 keys 一致
+func GetChannelKeyUsages(channelId int, keys []string) []ChannelKeyUsage {
+	now := time.Now()
+	usages := make([]ChannelKeyUsage, len(keys))
+	if common.RedisEnabled {
+		ctx := context.Background()
+		minuteKey, dayKey, totalKey, cooldownKey := channelKeyUsageKeys(channelId, now)
+		pipe := common.RDB.Pipeline()
+		minuteCmd := pipe.HGetAll(ctx, minuteKey)
+		dayCmd := pipe.HGetAll(ctx, dayKey)
+		totalCmd := pipe.HGetAll(ctx, totalKey)
+		cooldownCmd := pipe.HGetAll(ctx, cooldownKey)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("failed to get channel key usage: channel_id=%d, error=%v", channelId, err))
+		}
+		minute, day, total, cooldown := minuteCmd.Val(), dayCmd.Val(), totalCmd.Val(), cooldownCmd.Val()
+		field := func(values map[string]string, name string) int64 {
+			n, _ := strconv.ParseInt(values[name], 10, 64)
+			return n
+		}
+		for i, key := range keys {
+			hash := channelKeyHash(key)
+			usages[i] = ChannelKeyUsage{
+				Index:          i,
+				MinuteRequests: field(minute, hash+":req"),
+				MinuteTokens:   field(minute, hash+":tok"),
+				DailyRequests:  field(day, hash+":req"),
+				DailyTokens:    field(day, hash+":tok"),
+				DailyQuota:     field(day, hash+":quota"),
+				TotalRequests:  field(total, hash+":req"),
+				TotalTokens:    field(total, hash+":tok"),
+				TotalQuota:     field(total, hash+":quota"),
+				LastUsedTime:   field(total, hash+":last"),
+				CooldownUntil:  field(cooldown, hash),
+			}
+		}
+	} else {
+		for i, key := range keys {
+			counters := getChannelKeyCounters(channelId, channelKeyHash(key))
+			counters.mu.Lock()
+			counters.roll(now)
+			usages[i] = ChannelKeyUsage{
+				Index:          i,
+				MinuteRequests: counters.minuteRequests,
+				MinuteTokens:   counters.minuteTokens,
+				DailyRequests:  counters.dailyRequests,
+				DailyTokens:    counters.dailyTokens,
+				DailyQuota:     counters.dailyQuota,
+				TotalRequests:  counters.totalRequests,
+				TotalTokens:    counters.totalTokens,
+				TotalQuota:     counters.totalQuota,
+				LastUsedTime:   counters.lastUsed,
+				CooldownUntil:  counters.cooldownUntil,
+			}
+			counters.mu.Unlock()
+		}
+	}
+	for i := range usages {
+		if usages[i].CooldownUntil <= now.Unix() {
+			usages[i].CooldownUntil = 0
+		}
+	}
+	return usages
+}
+
+// recordChannelKeyUsage 累加 Key 的请求数、token 数与消耗额度
+func recordChannelKeyUsage(channelId int, key string, requests int64, tokens int64, quota int64) {
+	now := time.Now()
+	hash := channelKeyHash(key)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		minuteKey, dayKey, totalKey, _ := channelKeyUsageKeys(channelId, now)
+		pipe := common.RDB.TxPipeline()
+		if requests != 0 {
+			pipe.HIncrBy(ctx, minuteKey, hash+":req", requests)
+			pipe.HIncrBy(ctx, dayKey, hash+":req", requests)
+			pipe.HIncrBy(ctx, totalKey, hash+":req", requests)
+			pipe.HSet(ctx, totalKey, hash+":last", now.Unix())
+		}
+		if tokens != 0 {
+			pipe.HIncrBy(ctx, minuteKey, hash+":tok", tokens)
+			pipe.HIncrBy(ctx, dayKey, hash+":tok", tokens)
+			pipe.HIncrBy(ctx, totalKey, hash+":tok", tokens)
+		}
+		if quota != 0 {
+			pipe.HIncrBy(ctx, dayKey, hash+":quota", quota)
+			pipe.HIncrBy(ctx, totalKey, hash+":quota", quota)
+		}
+		pipe.Expire(ctx, minuteKey, 2*time.Minute)
+		pipe.Expire(ctx, dayKey, 48*time.Hour)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("failed to record channel key usage: channel_id=%d, error=%v", channelId, err))
+		}
+		return
+	}
+	counters := getChannelKeyCounters(channelId, hash)
+	counters.mu.Lock()
+	defer counters.mu.Unlock()
+	counters.roll(now)
+	counters.minuteRequests += requests
+	counters.dailyRequests += requests
+	counters.totalRequests += requests
+	counters.minuteTokens += tokens
+	counters.dailyTokens += tokens
+	counters.totalTokens += tokens
+	counters.dailyQuota += quota
+	counters.totalQuota += quota
+	if requests != 0 {
+		counters.lastUsed = now.Unix()
+	}
+}
+
+// RecordChannelKeyConsume 记录请求完成后 Key 消耗的 token 与额度
+func RecordChannelKeyConsume(channelId int, key string, tokens int, quota int) {
+	if key == "" {
+		return
+	}
+	recordChannelKeyUsage(channelId, key, 0, int64(tokens), int64(quota))
+}
+
+// CoolDownChannelKey 上游限流时暂停使用该 Key，seconds <= 0 时使用渠道配置的冷却时间
+func CoolDownChannelKey(channelId int, key string, seconds int) {
+	if key == "" {
+		return
+	}
+	if seconds <= 0 {
+		seconds = defaultChannelKeyCooldownSeconds
+		if info, err := CacheGetChannelInfo(channelId); err == nil && info.MultiKeyBudget.CooldownSeconds > 0 {
+			seconds = info.MultiKeyBudget.CooldownSeconds
+		}
+	}
+	seconds = min(seconds, maxChannelKeyCooldownSeconds)
+	until := time.Now().Unix() + int64(seconds)
+	hash := channelKeyHash(key)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		_, _, _, cooldownKey := channelKeyUsageKeys(channelId, time.Now())
+		pipe := common.RDB.TxPipeline()
+		pipe.HSet(ctx, cooldownKey, hash, until)
+		pipe.Expire(ctx, cooldownKey, maxChannelKeyCooldownSeconds*time.Second)
+		if _, err := pipe.Exec(ctx); err != nil {
+			common.SysError(fmt.Sprintf("failed to cool down channel key: channel_id=%d, error=%v", channelId, err))
+		}
+	} else {
+		counters := getChannelKeyCounters(channelId, hash)
+		counters.mu.Lock()
+		counters.cooldownUntil = until
+		counters.mu.Unlock()
+	}
+}
+
+// nextChannelKeyPollingIndex 通过 Redis 在多个节点间共享轮询位置
+func nextChannelKeyPollingIndex(channelId int, size int) (int, bool) {
+	if !common.RedisEnabled || size <= 0 {
+		return 0, false
+	}
+	n, err := common.RDB.Incr(context.Background(), fmt.Sprintf("channel_key_polling:%d", channelId)).Result()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get channel key polling index: channel_id=%d, error=%v", channelId, err))
+		return 0, false
+	}
+	return int((n - 1) % int64(size)), true
+}
+
+var channelKeysUnavailable sync.Map // channelId -> 预计恢复时间
+
+// markChannelKeysUnavailable 渠道所有 Key 暂不可用时，在恢复前选择渠道会跳过该渠道；until 为 0 时清除标记
+func markChannelKeysUnavailable(channelId int, until int64) {
+	if until <= 0 {
+		channelKeysUnavailable.Delete(channelId)
+		return
+	}
+	channelKeysUnavailable.Store(channelId, until)
+}
+
+func isChannelKeysUnavailable(channelId int) bool {
+	v, ok := channelKeysUnavailable.Load(channelId)
+	if !ok {
+		return false
+	}
+	if v.(int64) <= time.Now().Unix() {
+		channelKeysUnavailable.Delete(channelId)
+		return false
+	}
+	return true
+}
+
+// filterKeysUnavailableChannels 过滤所有 Key 暂不可用的渠道，全部不可用时保持原样
+func filterKeysUnavailableChannels(channels []int) []int {
+	var filtered []int
+	for i, channelId := range channels {
+		if isChannelKeysUnavailable(channelId) {
+			if filtered == nil {
+				filtered = append(make([]int, 0, len(channels)), channels[:i]...)
+			}
+			continue
+		}
+		if filtered != nil {
+			filtered = append(filtered, channelId)
+		}
+	}
+	if filtered == nil || len(filtered) == 0 {
+		return channels
+	}
+	return filtered
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/types"
+)
+
+// newMultiKeyTestChannel 构造不落库的多 Key 渠道，各测试使用不同的渠道 ID 以隔离内存中的用量
+func newMultiKeyTestChannel(id int, mode constant.MultiKeyMode, budget MultiKeyBudget) *Channel {
+	return &Channel{
+		Id:  id,
+		Key: "key-a\nkey-b\nkey-c",
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:     true,
+			MultiKeySize:   3,
+			MultiKeyMode:   mode,
+			MultiKeyBudget: budget,
+		},
+	}
+}
+
+func nextTestKey(t *testing.T, channel *Channel) string {
+	t.Helper()
+	key, _, err := channel.GetNextEnabledKey()
+	if err != nil {
+		t.Fatalf("GetNextEnabledKey: %v", err)
+	}
+	return key
+}
+
+func TestChannelKeyUnavailableUntil(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 4, 30, 0, time.Local)
+	nextMinute := time.Date(2026, 3, 10, 15, 5, 0, 0, time.Local).Unix()
+	nextDay := time.Date(2026, 3, 11, 0, 0, 0, 0, time.Local).Unix()
+	tests := []struct {
+		name   string
+		usage  ChannelKeyUsage
+		budget MultiKeyBudget
+		want   int64
+	}{
+		{name: "no budget", usage: ChannelKeyUsage{MinuteRequests: 100, DailyQuota: 100}},
+		{name: "under rpm", usage: ChannelKeyUsage{MinuteRequests: 2}, budget: MultiKeyBudget{RPM: 3}},
+		{name: "rpm reached", usage: ChannelKeyUsage{MinuteRequests: 3}, budget: MultiKeyBudget{RPM: 3}, want: nextMinute},
+		{name: "tpm reached", usage: ChannelKeyUsage{MinuteTokens: 1000}, budget: MultiKeyBudget{TPM: 1000}, want: nextMinute},
+		{name: "daily quota reached", usage: ChannelKeyUsage{DailyQuota: 500}, budget: MultiKeyBudget{DailyQuota: 500}, want: nextDay},
+		{name: "cooldown", usage: ChannelKeyUsage{CooldownUntil: now.Unix() + 10}, want: now.Unix() + 10},
+		{name: "cooldown expired", usage: ChannelKeyUsage{CooldownUntil: now.Unix()}},
+		// 同时受多个限制时取最晚的恢复时间
+		{name: "latest wins", usage: ChannelKeyUsage{MinuteRequests: 3, DailyQuota: 500, CooldownUntil: now.Unix() + 10}, budget: MultiKeyBudget{RPM: 3, DailyQuota: 500}, want: nextDay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.unavailableUntil(tt.budget, now); got != tt.want {
+				t.Fatalf("unavailableUntil = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNextEnabledKeyFillFirst(t *testing.T) {
+	channel := newMultiKeyTestChannel(910001, constant.MultiKeyModeFillFirst, MultiKeyBudget{DailyQuota: 100})
+	// key-c 单独覆盖为不限额
+	channel.ChannelInfo.MultiKeyBudgetOverride = map[int]MultiKeyBudget{2: {}}
+
+	for i := 0; i < 3; i++ {
+		if key := nextTestKey(t, channel); key != "key-a" {
+			t.Fatalf("expected key-a before it reaches its budget, got %s", key)
+		}
+	}
+	RecordChannelKeyConsume(channel.Id, "key-a", 10, 100)
+	if key := nextTestKey(t, channel); key != "key-b" {
+		t.Fatalf("expected key-b after key-a is exhausted, got %s", key)
+	}
+	// 上游限流的 Key 冷却期间被跳过
+	CoolDownChannelKey(channel.Id, "key-b", 30)
+	if key := nextTestKey(t, channel); key != "key-c" {
+		t.Fatalf("expected key-c while key-b cools down, got %s", key)
+	}
+
+	usages := GetChannelKeyUsages(channel.Id, channel.GetKeys())
+	if usages[0].DailyRequests != 3 || usages[0].DailyTokens != 10 || usages[0].DailyQuota != 100 || usages[0].TotalQuota != 100 {
+		t.Fatalf("unexpected key-a usage %+v", usages[0])
+	}
+	if usages[1].DailyRequests != 1 || usages[1].CooldownUntil <= time.Now().Unix() {
+		t.Fatalf("unexpected key-b usage %+v", usages[1])
+	}
+
+	// 全部 Key 不可用时返回 429，并在恢复前跳过该渠道
+	RecordChannelKeyConsume(channel.Id, "key-b", 0, 100)
+	channel.ChannelInfo.MultiKeyStatusList = map[int]int{2: common.ChannelStatusManuallyDisabled}
+	t.Cleanup(func() { markChannelKeysUnavailable(channel.Id, 0) })
+	_, _, err := channel.GetNextEnabledKey()
+	if err == nil || err.GetErrorCode() != types.ErrorCodeChannelKeysUnavailable || err.StatusCode != 429 {
+		t.Fatalf("expected keys unavailable error, got %v", err)
+	}
+	if !isChannelKeysUnavailable(channel.Id) {
+		t.Fatal("expected channel to be marked unavailable")
+	}
+	if got := filterKeysUnavailableChannels([]int{1, channel.Id, 2}); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("expected unavailable channel to be filtered, got %v", got)
+	}
+	// 全部渠道都不可用时保持原样
+	if got := filterKeysUnavailableChannels([]int{channel.Id}); len(got) != 1 {
+		t.Fatalf("expected channels to be kept, got %v", got)
+	}
+}
+
+func TestGetNextEnabledKeyLeastUsed(t *testing.T) {
+	channel := newMultiKeyTestChannel(910002, constant.MultiKeyModeLeastUsed, MultiKeyBudget{})
+	RecordChannelKeyConsume(channel.Id, "key-a", 500, 0)
+	RecordChannelKeyConsume(channel.Id, "key-b", 100, 0)
+	RecordChannelKeyConsume(channel.Id, "key-c", 100, 0)
+
+	// token 数相同时选择请求数更少的 Key，仍相同时按顺序
+	got := []string{nextTestKey(t, channel), nextTestKey(t, channel), nextTestKey(t, channel)}
+	if got[0] != "key-b" || got[1] != "key-c" || got[2] != "key-b" {
+		t.Fatalf("unexpected selection order %v", got)
+	}
+	RecordChannelKeyConsume(channel.Id, "key-b", 450, 0)
+	RecordChannelKeyConsume(channel.Id, "key-c", 300, 0)
+	if key := nextTestKey(t, channel); key != "key-c" {
+		t.Fatalf("expected key-c with the fewest tokens, got %s", key)
+	}
+	// 禁用的 Key 不参与选择
+	channel.ChannelInfo.MultiKeyStatusList = map[int]int{2: common.ChannelStatusAutoDisabled}
+	if key := nextTestKey(t, channel); key != "key-a" {
+		t.Fatalf("expected key-a once key-c is disabled, got %s", key)
+	}
+}
@@ -0,0 +1,305 @@
+package model
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 派生令牌是由父令牌签发的短期令牌，格式为 ek_<base64url(声明)>.<base64url(签名)>，
+// 签名与过期时间无需查库即可校验。父令牌被禁用、删除、重置密钥或主动吊销后，其派生令牌随之失效
+const (
+	DerivedTokenKeyPrefix = "ek_"
+
+	DerivedTokenDefaultTTL = 10 * 60
+	DerivedTokenMaxTTL     = 24 * 60 * 60
+)
+
+type DerivedTokenClaims struct {
+	Jti       string   `json:"jti"`
+	ParentId  int      `json:"pid"`
+	UserId    int      `json:"uid"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	Models    []string `json:"models,omitempty"` // 为空时沿用父令牌的模型限制
+	Scopes    []string `json:"scopes,omitempty"` // 为空时沿用父令牌的作用域
+	Quota     int      `json:"quota,omitempty"`  // 派生令牌可消耗的额度上限（软上限），0 表示仅受父令牌额度限制
+}
+
+var (
+	derivedTokenUsage       sync.Map // jti -> *derivedTokenUsageEntry，未启用 Redis 时使用
+	derivedTokenCleanupOnce sync.Once
+)
+
+type derivedTokenUsageEntry struct {
+	mu        sync.Mutex
+	used      int
+	expiresAt int64
+}
+
+func IsDerivedTokenKey(key string) bool {
+	return strings.HasPrefix(key, DerivedTokenKeyPrefix)
+}
+
+func derivedTokenSigningKey() ([]byte, error) {
+	secret, err := getTokenHashSecret()
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte("derived_token"))
+	return h.Sum(nil), nil
+}
+
+func signDerivedToken(payload string) (string, error) {
+	key, err := derivedTokenSigningKey()
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// HasScope 派生令牌未指定作用域时不额外限制
+func (claims *DerivedTokenClaims) HasScope(scope string) bool {
+	return len(claims.Scopes) == 0 || slices.Contains(claims.Scopes, scope)
+}
+
+// NarrowTo 校验派生令牌的权限不超过父令牌：有效期、模型、作用域与额度
+func (claims *DerivedTokenClaims) NarrowTo(parent *Token) error {
+	if parent.ExpiredTime != -1 && claims.ExpiresAt > parent.ExpiredTime {
+		claims.ExpiresAt = parent.ExpiredTime
+	}
+	if parent.ModelLimitsEnabled {
+		parentModels := parent.GetModelLimitsMap()
+		if len(claims.Models) == 0 {
+			claims.Models = parent.GetModelLimits()
+		}
+		for _, m := range claims.Models {
+			if !parentModels[m] {
+				return fmt.Errorf("父令牌无权访问模型 %s", m)
+			}
+		}
+	}
+	for _, scope := range claims.Scopes {
+		if !constant.IsValidTokenScope(scope) {
+			return fmt.Errorf("无效的令牌作用域: %s", scope)
+		}
+		if !parent.HasScope(scope) {
+			return fmt.Errorf("父令牌没有作用域 %s", scope)
+		}
+	}
+	if claims.Quota < 0 {
+		return errors.New("派生令牌额度不能为负数")
+	}
+	if !parent.UnlimitedQuota && claims.Quota > parent.RemainQuota {
+		return errors.New("派生令牌额度不能超过父令牌剩余额度")
+	}
+	return nil
+}
+
+// IssueDerivedToken 为父令牌签发派生令牌，ttl 为有效期秒数
+func IssueDerivedToken(parent *Token, claims *DerivedTokenClaims, ttl int64) (string, error) {
+	if ttl <= 0 {
+		ttl = DerivedTokenDefaultTTL
+	}
+	if ttl > DerivedTokenMaxTTL {
+		return "", fmt.Errorf("派生令牌有效期不能超过 %d 秒", DerivedTokenMaxTTL)
+	}
+	now := common.GetTimestamp()
+	claims.Jti = common.GetRandomString(16)
+	claims.ParentId = parent.Id
+	claims.UserId = parent.UserId
+	claims.IssuedAt = now
+	claims.ExpiresAt = now + ttl
+	if err := claims.NarrowTo(parent); err != nil {
+		return "", err
+	}
+	data, err := common.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature, err := signDerivedToken(payload)
+	if err != nil {
+		return "", err
+	}
+	return DerivedTokenKeyPrefix + payload + "." + signature, nil
+}
+
+// ParseDerivedToken 校验派生令牌签名与有效期，不访问数据库
+func ParseDerivedToken(key string) (*DerivedTokenClaims, error) {
+	payload, signature, ok := strings.Cut(strings.TrimPrefix(key, DerivedTokenKeyPrefix), ".")
+	if !ok || payload == "" || signature == "" {
+		return nil, errors.New("无效的令牌")
+	}
+	expected, err := signDerivedToken(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errors.New("无效的令牌")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	var claims DerivedTokenClaims
+	if err := common.Unmarshal(data, &claims); err != nil {
+		return nil, errors.New("无效的令牌")
+	}
+	if claims.ExpiresAt <= common.GetTimestamp() {
+		return nil, errors.New("该令牌已过期")
+	}
+	return &claims, nil
+}
+
+// ValidateDerivedToken 校验派生令牌并返回其父令牌，父令牌不可用或已吊销派生令牌时拒绝。
+// 派生令牌额度是软上限：仅在请求开始时比较已结算的消耗，预扣费只作用于父令牌，
+// 额度将尽时放行的请求与并发中的请求都可能使实际消耗超出上限，超出部分仍由父令牌额度兜底
+func ValidateDerivedToken(key string) (*Token, *DerivedTokenClaims, error) {
+	claims, err := ParseDerivedToken(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := getDerivedTokenParent(claims.ParentId)
+	if err != nil || parent.UserId != claims.UserId {
+		return nil, nil, errors.New("派生令牌的父令牌不存在")
+	}
+	if parent.Status != common.TokenStatusEnabled {
+		return nil, nil, errors.New("派生令牌的父令牌不可用")
+	}
+	if parent.ExpiredTime != -1 && parent.ExpiredTime < common.GetTimestamp() {
+		return nil, nil, errors.New("派生令牌的父令牌已过期")
+	}
+	if !parent.UnlimitedQuota && parent.RemainQuota <= 0 {
+		return nil, nil, errors.New("派生令牌的父令牌额度已用尽")
+	}
+	if claims.IssuedAt <= parent.DerivedRevokedAt {
+		return nil, nil, errors.New("该令牌已被吊销")
+	}
+	if claims.Quota > 0 && GetDerivedTokenUsedQuota(claims.Jti) >= claims.Quota {
+		return nil, nil, errors.New("该令牌额度已用尽")
+	}
+	return parent, claims, nil
+}
+
+// getDerivedTokenParent 按 id 读取父令牌，启用 Redis 时通过 id -> 密钥哈希映射复用令牌缓存
+func getDerivedTokenParent(id int) (*Token, error) {
+	cacheKey := fmt.Sprintf("token_id:%d", id)
+	if common.RedisEnabled {
+		if keyHash, err := common.RedisGet(cacheKey); err == nil && keyHash != "" {
+			if token, err := cacheGetTokenByKey(keyHash); err == nil {
+				token.Id = id
+				return token, nil
+			}
+		}
+	}
+	token, err := GetTokenById(id)
+	if err != nil {
+		return nil, err
+	}
+	if common.RedisEnabled {
+		if err := common.RedisSet(cacheKey, token.Key, time.Duration(common.RedisKeyCacheSeconds())*time.Second); err != nil {
+			common.SysLog("failed to cache token id: " + err.Error())
+		}
+	}
+	return token, nil
+}
+
+// RevokeDerivedTokens 吊销父令牌此前签发的全部派生令牌
+func (token *Token) RevokeDerivedTokens() (err error) {
+	defer func() {
+		if shouldUpdateRedis(true, err) {
+			gopool.Go(func() {
+				if err := cacheSetToken(*token); err != nil {
+					common.SysLog("failed to update token cache: " + err.Error())
+				}
+			})
+		}
+	}()
+	token.DerivedRevokedAt = common.GetTimestamp()
+	return DB.Model(token).Select("derived_revoked_at").Updates(token).Error
+}
+
+func derivedTokenUsageKey(jti string) string {
+	return "derived_token_used:" + jti
+}
+
+// GetDerivedTokenUsedQuota 派生令牌已消耗的额度
+func GetDerivedTokenUsedQuota(jti string) int {
+	if common.RedisEnabled {
+		used, err := common.RDB.Get(context.Background(), derivedTokenUsageKey(jti)).Int()
+		if err != nil {
+			return 0
+		}
+		return used
+	}
+	if v, ok := derivedTokenUsage.Load(jti); ok {
+		entry := v.(*derivedTokenUsageEntry)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		return entry.used
+	}
+	return 0
+}
+
+// addDerivedTokenUsage 累加派生令牌消耗，记录保留至令牌过期
+func addDerivedTokenUsage(jti string, expiresAt int64, quota int) error {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		pipe.IncrBy(ctx, derivedTokenUsageKey(jti), int64(quota))
+		pipe.ExpireAt(ctx, derivedTokenUsageKey(jti), time.Unix(expiresAt, 0))
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	derivedTokenCleanupOnce.Do(startDerivedTokenUsageCleanup)
+	v, _ := derivedTokenUsage.LoadOrStore(jti, &derivedTokenUsageEntry{expiresAt: expiresAt})
+	entry := v.(*derivedTokenUsageEntry)
+	entry.mu.Lock()
+	entry.used += quota
+	entry.mu.Unlock()
+	return nil
+}
+
+func startDerivedTokenUsageCleanup() {
+	gopool.Go(func() {
+		for {
+			time.Sleep(10 * time.Minute)
+			now := common.GetTimestamp()
+			derivedTokenUsage.Range(func(key, value any) bool {
+				if value.(*derivedTokenUsageEntry).expiresAt < now {
+					derivedTokenUsage.Delete(key)
+				}
+				return true
+			})
+		}
+	})
+}
+
+// recordDerivedTokenUsage 请求由派生令牌发起时，将本次消耗计入派生令牌额度
+func recordDerivedTokenUsage(c *gin.Context, quota int) {
+	jti := common.GetContextKeyString(c, constant.ContextKeyDerivedTokenId)
+	if jti == "" || quota <= 0 {
+		return
+	}
+	expiresAt, _ := common.GetContextKeyType[int64](c, constant.ContextKeyDerivedTokenExpiresAt)
+	if err := addDerivedTokenUsage(jti, expiresAt, quota); err != nil {
+		common.SysLog("failed to record derived token usage: " + err.Error())
+	}
+}
@@ -0,0 +1,261 @@
+package model
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+)
+
+func createDerivedTestParent(t *testing.T) *Token {
+	t.Helper()
+	token := &Token{
+		UserId:         1,
+		Name:           "parent",
+		ExpiredTime:    -1,
+		UnlimitedQuota: true,
+		Status:         common.TokenStatusEnabled,
+	}
+	if err := token.SetKey(common.GetRandomString(48)); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if err := token.Insert(); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	return token
+}
+
+// signTestDerivedToken 直接签名声明，用于构造过期等无法通过签发得到的令牌
+func signTestDerivedToken(t *testing.T, claims *DerivedTokenClaims) string {
+	t.Helper()
+	data, err := common.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to marshal claims: %v", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature, err := signDerivedToken(payload)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return DerivedTokenKeyPrefix + payload + "." + signature
+}
+
+func TestParseDerivedToken(t *testing.T) {
+	parent := createDerivedTestParent(t)
+	key, err := IssueDerivedToken(parent, &DerivedTokenClaims{Models: []string{"gpt-4o"}}, 60)
+	if err != nil {
+		t.Fatalf("IssueDerivedToken: %v", err)
+	}
+	if !IsDerivedTokenKey(key) || IsDerivedTokenKey("sk-"+key) {
+		t.Fatalf("unexpected derived token prefix %q", key)
+	}
+	claims, err := ParseDerivedToken(key)
+	if err != nil {
+		t.Fatalf("ParseDerivedToken: %v", err)
+	}
+	if claims.ParentId != parent.Id || claims.UserId != parent.UserId || len(claims.Jti) != 16 {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != 60 || len(claims.Models) != 1 || claims.Models[0] != "gpt-4o" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	payload, signature, _ := strings.Cut(strings.TrimPrefix(key, DerivedTokenKeyPrefix), ".")
+	forged := &DerivedTokenClaims{Jti: claims.Jti, ParentId: parent.Id, UserId: parent.UserId, IssuedAt: claims.IssuedAt, ExpiresAt: claims.ExpiresAt}
+	forgedData, _ := common.Marshal(forged)
+	malformedSignature, _ := signDerivedToken("!!")
+	now := common.GetTimestamp()
+	invalid := map[string]string{
+		"missing signature":  DerivedTokenKeyPrefix + payload,
+		"empty payload":      DerivedTokenKeyPrefix + "." + signature,
+		"tampered payload":   DerivedTokenKeyPrefix + base64.RawURLEncoding.EncodeToString(forgedData) + "." + signature,
+		"tampered signature": DerivedTokenKeyPrefix + payload + "." + signature[1:] + "A",
+		"malformed payload":  DerivedTokenKeyPrefix + "!!." + malformedSignature,
+		"expired":            signTestDerivedToken(t, &DerivedTokenClaims{Jti: "expired", ParentId: parent.Id, IssuedAt: now - 120, ExpiresAt: now - 1}),
+		"expires now":        signTestDerivedToken(t, &DerivedTokenClaims{Jti: "now", ParentId: parent.Id, IssuedAt: now - 60, ExpiresAt: now}),
+	}
+	for name, key := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseDerivedToken(key); err == nil {
+				t.Fatal("expected token to be rejected")
+			}
+		})
+	}
+}
+
+func TestIssueDerivedTokenTTL(t *testing.T) {
+	parent := createDerivedTestParent(t)
+	claims := &DerivedTokenClaims{}
+	if _, err := IssueDerivedToken(parent, claims, 0); err != nil {
+		t.Fatalf("IssueDerivedToken: %v", err)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != DerivedTokenDefaultTTL {
+		t.Fatalf("expected default ttl, got %d", claims.ExpiresAt-claims.IssuedAt)
+	}
+	if _, err := IssueDerivedToken(parent, &DerivedTokenClaims{}, DerivedTokenMaxTTL+1); err == nil {
+		t.Fatal("expected ttl above maximum to be rejected")
+	}
+}
+
+func TestDerivedTokenNarrowTo(t *testing.T) {
+	now := common.GetTimestamp()
+	limited := &Token{
+		ExpiredTime:        now + 300,
+		RemainQuota:        1000,
+		ModelLimitsEnabled: true,
+		ModelLimits:        "gpt-4o,gpt-4o-mini",
+		Scopes:             constant.TokenScopeChat + "," + constant.TokenScopeEmbeddings,
+	}
+	unlimited := &Token{ExpiredTime: -1, UnlimitedQuota: true}
+
+	tests := []struct {
+		name       string
+		parent     *Token
+		claims     DerivedTokenClaims
+		wantErr    bool
+		wantExp    int64
+		wantModels []string
+	}{
+		{name: "expiry capped to parent", parent: limited, claims: DerivedTokenClaims{ExpiresAt: now + 3600}, wantExp: now + 300, wantModels: []string{"gpt-4o", "gpt-4o-mini"}},
+		{name: "shorter expiry kept", parent: limited, claims: DerivedTokenClaims{ExpiresAt: now + 60}, wantExp: now + 60, wantModels: []string{"gpt-4o", "gpt-4o-mini"}},
+		{name: "never expiring parent", parent: unlimited, claims: DerivedTokenClaims{ExpiresAt: now + 3600}, wantExp: now + 3600},
+		{name: "model subset", parent: limited, claims: DerivedTokenClaims{ExpiresAt: now + 60, Models: []string{"gpt-4o-mini"}}, wantExp: now + 60, wantModels: []string{"gpt-4o-mini"}},
+		{name: "model outside parent", parent: limited, claims: DerivedTokenClaims{Models: []string{"o3"}}, wantErr: true},
+		{name: "any model without parent limits", parent: unlimited, claims: DerivedTokenClaims{ExpiresAt: now + 60, Models: []string{"o3"}}, wantExp: now + 60, wantModels: []string{"o3"}},
+		{name: "scope subset", parent: limited, claims: DerivedTokenClaims{ExpiresAt: now + 60, Scopes: []string{constant.TokenScopeChat}}, wantExp: now + 60, wantModels: []string{"gpt-4o", "gpt-4o-mini"}},
+		{name: "scope outside parent", parent: limited, claims: DerivedTokenClaims{Scopes: []string{constant.TokenScopeImages}}, wantErr: true},
+		{name: "unknown scope", parent: unlimited, claims: DerivedTokenClaims{Scopes: []string{"admin"}}, wantErr: true},
+		{name: "quota within parent", parent: limited, claims: DerivedTokenClaims{ExpiresAt: now + 60, Quota: 1000}, wantExp: now + 60, wantModels: []string{"gpt-4o", "gpt-4o-mini"}},
+		{name: "quota above parent", parent: limited, claims: DerivedTokenClaims{Quota: 1001}, wantErr: true},
+		{name: "quota with unlimited parent", parent: unlimited, claims: DerivedTokenClaims{ExpiresAt: now + 60, Quota: 1 << 30}, wantExp: now + 60},
+		{name: "negative quota", parent: unlimited, claims: DerivedTokenClaims{Quota: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := tt.claims
+			err := claims.NarrowTo(tt.parent)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected claims to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NarrowTo: %v", err)
+			}
+			if claims.ExpiresAt != tt.wantExp {
+				t.Fatalf("expires at %d, want %d", claims.ExpiresAt, tt.wantExp)
+			}
+			if strings.Join(claims.Models, ",") != strings.Join(tt.wantModels, ",") {
+				t.Fatalf("models = %v, want %v", claims.Models, tt.wantModels)
+			}
+		})
+	}
+
+	claims := &DerivedTokenClaims{}
+	if !claims.HasScope(constant.TokenScopeImages) {
+		t.Fatal("expected claims without scopes to allow every scope")
+	}
+	claims.Scopes = []string{constant.TokenScopeChat}
+	if !claims.HasScope(constant.TokenScopeChat) || claims.HasScope(constant.TokenScopeImages) {
+		t.Fatal("expected claims scopes to be enforced")
+	}
+}
+
+func TestValidateDerivedToken(t *testing.T) {
+	issue := func(t *testing.T, parent *Token, claims *DerivedTokenClaims) string {
+		t.Helper()
+		key, err := IssueDerivedToken(parent, claims, 60)
+		if err != nil {
+			t.Fatalf("IssueDerivedToken: %v", err)
+		}
+		return key
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		parent := createDerivedTestParent(t)
+		token, claims, err := ValidateDerivedToken(issue(t, parent, &DerivedTokenClaims{}))
+		if err != nil || token.Id != parent.Id || claims.ParentId != parent.Id {
+			t.Fatalf("ValidateDerivedToken: %v, %v, %v", token, claims, err)
+		}
+	})
+
+	// 父令牌状态变化后派生令牌随之失效
+	parentChanges := map[string]func(parent *Token){
+		"parent disabled": func(parent *Token) { parent.Status = common.TokenStatusDisabled },
+		"parent expired":  func(parent *Token) { parent.ExpiredTime = common.GetTimestamp() - 1 },
+		"parent quota exhausted": func(parent *Token) {
+			parent.UnlimitedQuota = false
+			parent.RemainQuota = 0
+		},
+		"parent belongs to another user": func(parent *Token) { parent.UserId = 2 },
+	}
+	for name, change := range parentChanges {
+		t.Run(name, func(t *testing.T) {
+			parent := createDerivedTestParent(t)
+			key := issue(t, parent, &DerivedTokenClaims{})
+			change(parent)
+			if err := DB.Model(parent).Select("status", "expired_time", "unlimited_quota", "remain_quota", "user_id").Updates(parent).Error; err != nil {
+				t.Fatalf("failed to update parent: %v", err)
+			}
+			if _, _, err := ValidateDerivedToken(key); err == nil {
+				t.Fatal("expected derived token to be rejected")
+			}
+		})
+	}
+
+	t.Run("parent deleted", func(t *testing.T) {
+		parent := createDerivedTestParent(t)
+		key := issue(t, parent, &DerivedTokenClaims{})
+		if err := DB.Delete(parent).Error; err != nil {
+			t.Fatalf("failed to delete parent: %v", err)
+		}
+		if _, _, err := ValidateDerivedToken(key); err == nil {
+			t.Fatal("expected derived token to be rejected")
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		parent := createDerivedTestParent(t)
+		revoked := issue(t, parent, &DerivedTokenClaims{})
+		if err := parent.RevokeDerivedTokens(); err != nil {
+			t.Fatalf("RevokeDerivedTokens: %v", err)
+		}
+		if _, _, err := ValidateDerivedToken(revoked); err == nil {
+			t.Fatal("expected revoked token to be rejected")
+		}
+		// 吊销时间之后签发的令牌不受影响
+		now := common.GetTimestamp()
+		later := signTestDerivedToken(t, &DerivedTokenClaims{Jti: common.GetRandomString(16), ParentId: parent.Id, UserId: parent.UserId, IssuedAt: now + 1, ExpiresAt: now + 60})
+		if _, _, err := ValidateDerivedToken(later); err != nil {
+			t.Fatalf("expected token issued after revocation to be valid: %v", err)
+		}
+	})
+
+	t.Run("quota soft cap", func(t *testing.T) {
+		parent := createDerivedTestParent(t)
+		key := issue(t, parent, &DerivedTokenClaims{Quota: 100})
+		_, claims, err := ValidateDerivedToken(key)
+		if err != nil {
+			t.Fatalf("ValidateDerivedToken: %v", err)
+		}
+		if err := addDerivedTokenUsage(claims.Jti, claims.ExpiresAt, 99); err != nil {
+			t.Fatalf("addDerivedTokenUsage: %v", err)
+		}
+		if _, _, err := ValidateDerivedToken(key); err != nil {
+			t.Fatalf("expected token below its quota to be valid: %v", err)
+		}
+		// 额度未用尽时放行的请求可以超出上限，之后的请求被拒绝
+		if err := addDerivedTokenUsage(claims.Jti, claims.ExpiresAt, 50); err != nil {
+			t.Fatalf("addDerivedTokenUsage: %v", err)
+		}
+		if used := GetDerivedTokenUsedQuota(claims.Jti); used != 149 {
+			t.Fatalf("used quota = %d, want 149", used)
+		}
+		if _, _, err := ValidateDerivedToken(key); err == nil {
+			t.Fatal("expected exhausted token to be rejected")
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+)
+
+const CurrencyUSD = "USD"
+
+// ExchangeRate 货币汇率，Rate 表示 1 USD = Rate 单位该货币。
+// 手动覆盖（Manual）的汇率不会被自动更新
+type ExchangeRate struct {
+	Id        int     `json:"id"`
+	Currency  string  `json:"currency" gorm:"type:varchar(8);uniqueIndex"`
+	Symbol    string  `json:"symbol" gorm:"type:varchar(8);default:''"`
+	Rate      float64 `json:"rate"`
+	Manual    bool    `json:"manual"`
+	Enabled   bool    `json:"enabled"`
+	Source    string  `json:"source" gorm:"type:varchar(255);default:''"` // 最近一次更新来源，手动设置时为 manual
+	UpdatedAt int64   `json:"updated_at" gorm:"bigint"`
+}
+
+// CurrencyInfo 展示货币
+type CurrencyInfo struct {
+	Code   string  `json:"code"`
+	Symbol string  `json:"symbol"`
+	Rate   float64 `json:"rate"` // 1 USD = Rate
+}
+
+// FromUSD 美元金额换算为该货币，保留两位小数
+func (c *CurrencyInfo) FromUSD(usd float64) float64 {
+	return decimal.NewFromFloat(usd).Mul(decimal.NewFromFloat(c.Rate)).Round(2).InexactFloat64()
+}
+
+// ToUSD 该货币金额换算为美元，作为中间值不做舍入
+func (c *CurrencyInfo) ToUSD(amount float64) float64 {
+	return decimal.NewFromFloat(amount).Div(decimal.NewFromFloat(c.Rate)).InexactFloat64()
+}
+
+// QuotaToAmount 额度换算为该货币金额，单次调用金额很小，保留六位小数
+func (c *CurrencyInfo) QuotaToAmount(quota int) float64 {
+	return decimal.NewFromInt(int64(quota)).
+		Div(decimal.NewFromFloat(common.QuotaPerUnit)).
+		Mul(decimal.NewFromFloat(c.Rate)).
+		Round(6).InexactFloat64()
+}
+
+var defaultCurrencySymbols = map[string]string{
+	"USD": "$",
+	"CNY": "¥",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"KRW": "₩",
+	"HKD": "HK$",
+	"TWD": "NT$",
+	"SGD": "S$",
+	"AUD": "A$",
+	"CAD": "C$",
+	"INR": "₹",
+	"RUB": "₽",
+	"BRL": "R$",
+}
+
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func currencySymbol(code string, symbol string) string {
+	if symbol != "" {
+		return symbol
+	}
+	if s, ok := defaultCurrencySymbols[code]; ok {
+		return s
+	}
+	return code
+}
+
+var (
+	exchangeRateCacheLock     sync.RWMutex
+	exchangeRateCache         map[string]*ExchangeRate
+	exchangeRateCacheLoadedAt time.Time
+)
+
+// getCachedExchangeRates 各节点每分钟从数据库刷新一次，自动更新只在主节点执行
+func getCachedExchangeRates() map[string]*ExchangeRate {
+	exchangeRateCacheLock.RLock()
+	if exchangeRateCache != nil && time.Since(exchangeRateCacheLoadedAt) < time.Minute {
+		defer exchangeRateCacheLock.RUnlock()
+		return exchangeRateCache
+	}
+	exchangeRateCacheLock.RUnlock()
+
+	exchangeRateCacheLock.Lock()
+	defer exchangeRateCacheLock.Unlock()
+	if exchangeRateCache != nil && time.Since(exchangeRateCacheLoadedAt) < time.Minute {
+		return exchangeRateCache
+	}
+	var rates []*ExchangeRate
+	if err := DB.Find(&rates).Error; err != nil {
+		common.SysError("load exchange rates failed: " + err.Error())
+		if exchangeRateCache == nil {
+			return map[string]*ExchangeRate{}
+		}
+		return exchangeRateCache
+	}
+	cache := make(map[string]*ExchangeRate, len(rates))
+	for _, r := range rates {
+		cache[r.Currency] = r
+	}
+	exchangeRateCache = cache
+	exchangeRateCacheLoadedAt = time.Now()
+	return cache
+}
+
+func InvalidateExchangeRateCache() {
+	exchangeRateCacheLock.Lock()
+	exchangeRateCache = nil
+	exchangeRateCacheLock.Unlock()
+}
+
+// GetCurrencyInfo 查询已启用的货币，人民币未配置时使用充值设置中的美元汇率
+func GetCurrencyInfo(code string) (*CurrencyInfo, bool) {
+	code = NormalizeCurrency(code)
+	if code == "" {
+		return nil, false
+	}
+	if r, ok := getCachedExchangeRates()[code]; ok {
+		if !r.Enabled || r.Rate <= 0 {
+			return nil, false
+		}
+		return &CurrencyInfo{Code: code, Symbol: currencySymbol(code, r.Symbol), Rate: r.Rate}, true
+	}
+	switch code {
+	case CurrencyUSD:
+		return &CurrencyInfo{Code: CurrencyUSD, Symbol: "$", Rate: 1}, true
+	case "CNY":
+		return &CurrencyInfo{Code: "CNY", Symbol: "¥", Rate: operation_setting.USDExchangeRate}, true
+	}
+	return nil, false
+}
+
+// DefaultCurrencyInfo 站点额度展示类型对应的货币，用户未选择展示货币时使用
+func DefaultCurrencyInfo() *CurrencyInfo {
+	switch operation_setting.GetQuotaDisplayType() {
+	case operation_setting.QuotaDisplayTypeCNY:
+		if info, ok := GetCurrencyInfo("CNY"); ok {
+			return info
+		}
+	case operation_setting.QuotaDisplayTypeCustom:
+		return &CurrencyInfo{
+			Code:   operation_setting.QuotaDisplayTypeCustom,
+			Symbol: operation_setting.GetCurrencySymbol(),
+			Rate:   operation_setting.GetUsdToCurrencyRate(operation_setting.USDExchangeRate),
+		}
+	}
+	return &CurrencyInfo{Code: CurrencyUSD, Symbol: "$", Rate: 1}
+}
+
+// GetUserCurrencyInfo 用户选择的展示货币，未选择或已停用时回退到站点默认
+func GetUserCurrencyInfo(userId int) *CurrencyInfo {
+	if userId > 0 {
+		if setting, err := GetUserSetting(userId, false); err == nil && setting.DisplayCurrency != "" {
+			if info, ok := GetCurrencyInfo(setting.DisplayCurrency); ok {
+				return info
+			}
+		}
+	}
+	return DefaultCurrencyInfo()
+}
+
+// GetEnabledCurrencies 用户可选的展示货币
+func GetEnabledCurrencies() []*CurrencyInfo {
+	rates := getCachedExchangeRates()
+	currencies := make([]*CurrencyInfo, 0, len(rates)+2)
+	for _, code := range []string{CurrencyUSD, "CNY"} {
+		if _, configured := rates[code]; !configured {
+			info, _ := GetCurrencyInfo(code)
+			currencies = append(currencies, info)
+		}
+	}
+	for code, r := range rates {
+		if !r.Enabled || r.Rate <= 0 {
+			continue
+		}
+		currencies = append(currencies, &CurrencyInfo{Code: code, Symbol: currencySymbol(code, r.Symbol), Rate: r.Rate})
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].Code < currencies[j].Code
+	})
+	return currencies
+}
+
+func GetAllExchangeRates() ([]*ExchangeRate, error) {
+	var rates []*ExchangeRate
+	err := DB.Order("currency asc").Find(&rates).Error
+	return rates, err
+}
+
+func (r *ExchangeRate) Validate() error {
+	r.Currency = NormalizeCurrency(r.Currency)
+	if len(r.Currency) != 3 {
+		return errors.New("货币代码需为 3 位 ISO 4217 代码")
+	}
+	if r.Currency == CurrencyUSD {
+		return errors.New("USD 为基准货币，无需配置")
+	}
+	if r.Rate < 0 {
+		return errors.New("汇率不能为负数")
+	}
+	if r.Manual && r.Rate <= 0 {
+		return errors.New("手动汇率必须大于 0")
+	}
+	r.Symbol = strings.TrimSpace(r.Symbol)
+	return nil
+}
+
+func (r *ExchangeRate) Insert() error {
+	r.UpdatedAt = common.GetTimestamp()
+	if r.Manual {
+		r.Source = "manual"
+	}
+	err := DB.Create(r).Error
+	InvalidateExchangeRateCache()
+	return err
+}
+
+func (r *ExchangeRate) Update() error {
+	updates := map[string]interface{}{
+		"currency":   r.Currency,
+		"symbol":     r.Symbol,
+		"manual":     r.Manual,
+		"enabled":    r.Enabled,
+		"updated_at": common.GetTimestamp(),
+	}
+	// 自动更新的币种保留最近一次拉取的汇率，除非显式提供
+	if r.Manual || r.Rate > 0 {
+		updates["rate"] = r.Rate
+	}
+	if r.Manual {
+		updates["source"] = "manual"
+	}
+	err := DB.Model(&ExchangeRate{}).Where("id = ?", r.Id).Updates(updates).Error
+	InvalidateExchangeRateCache()
+	return err
+}
+
+func DeleteExchangeRateById(id int) error {
+	err := DB.Where("id = ?", id).Delete(&ExchangeRate{}).Error
+	InvalidateExchangeRateCache()
+	return err
+}
+
+// UpdateFetchedExchangeRates 用汇率源的数据更新已配置且非手动覆盖的币种，返回更新数量
+func UpdateFetchedExchangeRates(rates map[string]float64, source string) (int, error) {
+	var configured []*ExchangeRate
+	if err := DB.Where("manual = ?", false).Find(&configured).Error; err != nil {
+		return 0, err
+	}
+	now := common.GetTimestamp()
+	updated := 0
+	for _, r := range configured {
+		rate, ok := rates[r.Currency]
+		if !ok || rate <= 0 {
+			continue
+		}
+		err := DB.Model(&ExchangeRate{}).Where("id = ? AND manual = ?", r.Id, false).Updates(map[string]interface{}{
+			"rate":       rate,
+			"source":     source,
+			"updated_at": now,
+		}).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	InvalidateExchangeRateCache()
+	return updated, nil
+}
+
+// FillLogDisplayAmounts 将日志额度换算为指定货币金额
+func FillLogDisplayAmounts(logs []*Log, currency *CurrencyInfo) {
+	for _, l := range logs {
+		if l.Quota == 0 {
+			continue
+		}
+		l.DisplayAmount = currency.QuotaToAmount(l.Quota)
+		l.DisplayCurrency = currency.Code
+	}
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+)
+
+func createTestExchangeRate(t *testing.T, currency string, rate float64, enabled bool) {
+	t.Helper()
+	r := &ExchangeRate{Currency: currency, Rate: rate, Manual: true, Enabled: enabled}
+	if err := r.Insert(); err != nil {
+		t.Fatalf("failed to create exchange rate: %v", err)
+	}
+}
+
+func TestCurrencyConversionRounding(t *testing.T) {
+	eur := &CurrencyInfo{Code: "EUR", Rate: 0.92}
+	jpy := &CurrencyInfo{Code: "JPY", Rate: 151.37}
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		// 0.1 * 0.92 直接相乘会得到 0.09200000000000001
+		{name: "from usd removes float noise", got: eur.FromUSD(0.1), want: 0.09},
+		{name: "from usd rounds to cents", got: eur.FromUSD(9.99), want: 9.19},
+		{name: "from usd large rate", got: jpy.FromUSD(19.99), want: 3025.89},
+		{name: "to usd", got: eur.ToUSD(9.2), want: 10},
+		{name: "quota to amount", got: eur.QuotaToAmount(int(common.QuotaPerUnit)), want: 0.92},
+		{name: "quota to amount keeps small values", got: eur.QuotaToAmount(7), want: 0.000013},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Fatalf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCurrencyInfo(t *testing.T) {
+	resetTables(t, &ExchangeRate{})
+	createTestExchangeRate(t, "EUR", 0.92, true)
+	createTestExchangeRate(t, "GBP", 0.79, false)
+	t.Cleanup(InvalidateExchangeRateCache)
+
+	if info, ok := GetCurrencyInfo(" eur "); !ok || info.Code != "EUR" || info.Symbol != "€" || info.Rate != 0.92 {
+		t.Fatalf("unexpected EUR info %+v, %v", info, ok)
+	}
+	// 停用与未配置的货币不可用，USD 与 CNY 未配置时使用内置汇率
+	if _, ok := GetCurrencyInfo("GBP"); ok {
+		t.Fatal("expected disabled currency to be unavailable")
+	}
+	if _, ok := GetCurrencyInfo("CHF"); ok {
+		t.Fatal("expected unconfigured currency to be unavailable")
+	}
+	if info, ok := GetCurrencyInfo("USD"); !ok || info.Rate != 1 {
+		t.Fatalf("unexpected USD info %+v, %v", info, ok)
+	}
+	if info, ok := GetCurrencyInfo("CNY"); !ok || info.Rate != operation_setting.USDExchangeRate {
+		t.Fatalf("unexpected CNY info %+v, %v", info, ok)
+	}
+}
+
+func TestGetUserCurrencyInfoFallback(t *testing.T) {
+	resetTables(t, &ExchangeRate{})
+	createTestExchangeRate(t, "EUR", 0.92, true)
+	createTestExchangeRate(t, "GBP", 0.79, false)
+	t.Cleanup(InvalidateExchangeRateCache)
+
+	newUser := func(currency string) int {
+		user := createLedgerTestUser(t, 0)
+		user.SetSetting(dto.UserSetting{DisplayCurrency: currency})
+		if err := DB.Model(user).Update("setting", user.Setting).Error; err != nil {
+			t.Fatalf("failed to save user setting: %v", err)
+		}
+		return user.Id
+	}
+	if info := GetUserCurrencyInfo(newUser("EUR")); info.Code != "EUR" {
+		t.Fatalf("expected EUR, got %s", info.Code)
+	}
+	// 所选货币停用后回退到站点默认货币
+	if info := GetUserCurrencyInfo(newUser("GBP")); info.Code != CurrencyUSD {
+		t.Fatalf("expected fallback to USD, got %s", info.Code)
+	}
+	if info := GetUserCurrencyInfo(0); info.Code != CurrencyUSD {
+		t.Fatalf("expected USD for anonymous user, got %s", info.Code)
+	}
+}
+
+func TestFillLogDisplayAmounts(t *testing.T) {
+	logs := []*Log{{Quota: int(common.QuotaPerUnit) / 2}, {Quota: 0}}
+	FillLogDisplayAmounts(logs, &CurrencyInfo{Code: "EUR", Rate: 0.92})
+	if logs[0].DisplayAmount != 0.46 || logs[0].DisplayCurrency != "EUR" {
+		t.Fatalf("unexpected display amount %v %s", logs[0].DisplayAmount, logs[0].DisplayCurrency)
+	}
+	if logs[1].DisplayCurrency != "" {
+		t.Fatal("expected zero quota log to be skipped")
+	}
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// GetUserByLdapId 按 LDAP 用户名查找已关联的用户，用户已被删除时返回 ErrSsoUserDeleted
+func GetUserByLdapId(ldapId string) (*User, error) {
+	if ldapId == "" {
+		return nil, errors.New("ldap id 为空！")
+	}
+	var user User
+	err := DB.Where("ldap_id = ?", ldapId).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if DB.Unscoped().Where("ldap_id = ?", ldapId).Find(&User{}).RowsAffected > 0 {
+		return nil, ErrSsoUserDeleted
+	}
+	return nil, err
+}
+
+// CreateLdapUser 首次通过 LDAP 登录时创建用户，user.LdapId 必须已设置
+func CreateLdapUser(user *User) error {
+	if user.LdapId == "" {
+		return errors.New("ldap id 为空！")
+	}
+	return createExternalUser(user, user.LdapId, "ldap_")
+}
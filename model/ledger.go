@@ -0,0 +1,305 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"gorm.io/gorm"
+)
+
+// 账本账户类型
+const (
+	LedgerAccountUser         = "user"
+	LedgerAccountOrganization = "org"
+)
+
+// 额度变动来源
+const (
+	LedgerSourceOpening      = "opening"      // 启用账本时的期初余额
+	LedgerSourceSignup       = "signup"       // 新用户注册赠送
+	LedgerSourceConsume      = "consume"      // 请求预扣费与结算
+	LedgerSourceRefund       = "refund"       // 请求失败或任务失败退款
+	LedgerSourceTopUp        = "topup"        // 在线充值
+	LedgerSourceRedemption   = "redemption"   // 兑换码
+	LedgerSourceCheckin      = "checkin"      // 签到奖励
+	LedgerSourceAffiliate    = "affiliate"    // 邀请奖励与邀请额度划转
+	LedgerSourceAdmin        = "admin"        // 管理员调整
+	LedgerSourceExpiry       = "expiry"       // 额度过期扣除
+	LedgerSourceTransfer     = "transfer"     // 用户与组织之间划转
+	LedgerSourceSubscription = "subscription" // 订阅套餐变更补差价或退差价
+	LedgerSourceTopUpRefund  = "topup_refund" // 充值订单退款或拒付扣回额度
+	LedgerSourceOther        = "other"        // 未标注来源的变动
+)
+
+// 对方账户，每条分录记录资金从哪里来、到哪里去
+const (
+	LedgerCounterRevenue = "system:revenue"   // 消费收入
+	LedgerCounterPayment = "external:payment" // 外部支付渠道
+	LedgerCounterPromo   = "system:promotion" // 赠送（注册、签到、邀请、兑换码）
+	LedgerCounterAdmin   = "system:admin"
+	LedgerCounterExpiry  = "system:expiry"
+	LedgerCounterOpening = "system:opening"
+	LedgerCounterUnknown = "system:unknown"
+)
+
+var ErrLedgerDuplicate = errors.New("ledger entry with the same idempotency key already exists")
+
+// QuotaLedger 额度账本分录，只追加不修改。
+// 每条分录记录一个账户的余额变动及其对方账户，账户余额等于其所有分录金额之和。
+type QuotaLedger struct {
+	Id             int64   `json:"id"`
+	AccountType    string  `json:"account_type" gorm:"type:varchar(16);index:idx_ledger_account,priority:1"`
+	AccountId      int     `json:"account_id" gorm:"index:idx_ledger_account,priority:2"`
+	CounterAccount string  `json:"counter_account" gorm:"type:varchar(64)"`
+	Amount         int     `json:"amount"`
+	Source         string  `json:"source" gorm:"type:varchar(32);index"`
+	ReferenceId    string  `json:"reference_id" gorm:"type:varchar(128);index"`
+	IdempotencyKey *string `json:"idempotency_key,omitempty" gorm:"type:varchar(128);uniqueIndex"`
+	// 批量更新模式下余额延迟写入，此时不记录变动前后余额
+	BalanceBefore *int   `json:"balance_before"`
+	BalanceAfter  *int   `json:"balance_after"`
+	Remark        string `json:"remark" gorm:"type:varchar(255)"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// LedgerRef 描述一次额度变动的来源，随额度操作一起传入
+type LedgerRef struct {
+	Source         string
+	CounterAccount string
+	ReferenceId    string
+	IdempotencyKey string
+	Remark         string
+}
+
+func firstLedgerRef(refs []LedgerRef) LedgerRef {
+	if len(refs) > 0 {
+		return refs[0]
+	}
+	return LedgerRef{Source: LedgerSourceOther}
+}
+
+func (ref LedgerRef) counter() string {
+	if ref.CounterAccount != "" {
+		return ref.CounterAccount
+	}
+	switch ref.Source {
+	case LedgerSourceConsume, LedgerSourceRefund, LedgerSourceSubscription:
+		return LedgerCounterRevenue
+	case LedgerSourceTopUp, LedgerSourceTopUpRefund:
+		return LedgerCounterPayment
+	case LedgerSourceSignup, LedgerSourceCheckin, LedgerSourceAffiliate, LedgerSourceRedemption:
+		return LedgerCounterPromo
+	case LedgerSourceAdmin:
+		return LedgerCounterAdmin
+	case LedgerSourceExpiry:
+		return LedgerCounterExpiry
+	case LedgerSourceOpening:
+		return LedgerCounterOpening
+	default:
+		return LedgerCounterUnknown
+	}
+}
+
+func LedgerAccount(accountType string, accountId int) string {
+	return fmt.Sprintf("%s:%d", accountType, accountId)
+}
+
+func newLedgerEntry(accountType string, accountId int, amount int, ref LedgerRef) *QuotaLedger {
+	entry := &QuotaLedger{
+		AccountType:    accountType,
+		AccountId:      accountId,
+		CounterAccount: ref.counter(),
+		Amount:         amount,
+		Source:         ref.Source,
+		ReferenceId:    ref.ReferenceId,
+		Remark:         ref.Remark,
+		CreatedAt:      common.GetTimestamp(),
+	}
+	if entry.Source == "" {
+		entry.Source = LedgerSourceOther
+	}
+	if ref.IdempotencyKey != "" {
+		key := ref.IdempotencyKey
+		entry.IdempotencyKey = &key
+	}
+	return entry
+}
+
+func checkLedgerIdempotency(tx *gorm.DB, ref LedgerRef) error {
+	if ref.IdempotencyKey == "" {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&QuotaLedger{}).Where("idempotency_key = ?", ref.IdempotencyKey).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrLedgerDuplicate
+	}
+	return nil
+}
+
+// recordLedgerWithBalance 在余额已更新的事务中写入分录，并读取变动后的余额
+func recordLedgerWithBalance(tx *gorm.DB, accountType string, accountId int, amount int, ref LedgerRef) error {
+	if amount == 0 {
+		return nil
+	}
+	if err := checkLedgerIdempotency(tx, ref); err != nil {
+		return err
+	}
+	var balance int
+	var err error
+	switch accountType {
+	case LedgerAccountOrganization:
+		err = tx.Model(&Organization{}).Where("id = ?", accountId).Select("quota").Scan(&balance).Error
+	default:
+		err = tx.Model(&User{}).Where("id = ?", accountId).Select("quota").Scan(&balance).Error
+	}
+	if err != nil {
+		return err
+	}
+	entry := newLedgerEntry(accountType, accountId, amount, ref)
+	before := balance - amount
+	entry.BalanceBefore = &before
+	entry.BalanceAfter = &balance
+	return tx.Create(entry).Error
+}
+
+// RecordUserLedger 在修改 users.quota 的同一事务中调用，记录用户额度变动
+func RecordUserLedger(tx *gorm.DB, userId int, amount int, ref LedgerRef) error {
+	return recordLedgerWithBalance(tx, LedgerAccountUser, userId, amount, ref)
+}
+
+// RecordOrganizationLedger 在修改 organizations.quota 的同一事务中调用，记录组织额度变动
+func RecordOrganizationLedger(tx *gorm.DB, orgId int, amount int, ref LedgerRef) error {
+	return recordLedgerWithBalance(tx, LedgerAccountOrganization, orgId, amount, ref)
+}
+
+// recordDeferredUserLedger 批量更新模式下余额稍后才写入数据库，分录立即写入但不记录余额；
+// 返回错误时调用方不应再累计余额变动
+func recordDeferredUserLedger(userId int, amount int, ref LedgerRef) error {
+	if amount == 0 {
+		return nil
+	}
+	if err := checkLedgerIdempotency(DB, ref); err != nil {
+		return err
+	}
+	if err := DB.Create(newLedgerEntry(LedgerAccountUser, userId, amount, ref)).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to record quota ledger (user=%d, amount=%d, source=%s): %s", userId, amount, ref.Source, err.Error()))
+		return err
+	}
+	return nil
+}
+
+type LedgerQueryParams struct {
+	AccountType    string
+	AccountId      int
+	Source         string
+	ReferenceId    string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func GetLedgerEntries(params LedgerQueryParams, startIdx int, num int) (entries []*QuotaLedger, total int64, err error) {
+	tx := DB.Model(&QuotaLedger{})
+	if params.AccountType != "" {
+		tx = tx.Where("account_type = ?", params.AccountType)
+	}
+	if params.AccountId != 0 {
+		tx = tx.Where("account_id = ?", params.AccountId)
+	}
+	if params.Source != "" {
+		tx = tx.Where("source = ?", params.Source)
+	}
+	if params.ReferenceId != "" {
+		tx = tx.Where("reference_id = ?", params.ReferenceId)
+	}
+	if params.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", params.StartTimestamp)
+	}
+	if params.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", params.EndTimestamp)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&entries).Error
+	return entries, total, err
+}
+
+// getTopUpLedgerQuota 返回各充值订单实际入账的额度
+func getTopUpLedgerQuota(userId int, tradeNos []string) (map[string]int, error) {
+	result := make(map[string]int, len(tradeNos))
+	if len(tradeNos) == 0 {
+		return result, nil
+	}
+	var rows []struct {
+		ReferenceId string
+		Total       int
+	}
+	err := DB.Model(&QuotaLedger{}).Select("reference_id, SUM(amount) AS total").
+		Where("account_type = ? AND account_id = ? AND source = ? AND reference_id IN ?", LedgerAccountUser, userId, LedgerSourceTopUp, tradeNos).
+		Group("reference_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		result[row.ReferenceId] = row.Total
+	}
+	return result, nil
+}
+
+// EnsureLedgerOpeningBalances 为尚无任何分录的用户与组织写入期初余额，使账本余额与当前余额一致。
+// 在数据库迁移时同步执行，必须早于开始处理请求，否则先产生分录的账户会被跳过
+func EnsureLedgerOpeningBalances() error {
+	now := common.GetTimestamp()
+	err := DB.Exec(`INSERT INTO quota_ledgers (account_type, account_id, counter_account, amount, source, reference_id, balance_before, balance_after, remark, created_at)
+SELECT ?, users.id, ?, users.quota, ?, '', 0, users.quota, '', ?
+FROM users WHERE users.quota <> 0 AND NOT EXISTS (
+	SELECT 1 FROM quota_ledgers WHERE quota_ledgers.account_type = ? AND quota_ledgers.account_id = users.id)`,
+		LedgerAccountUser, LedgerCounterOpening, LedgerSourceOpening, now, LedgerAccountUser).Error
+	if err != nil {
+		return err
+	}
+	return DB.Exec(`INSERT INTO quota_ledgers (account_type, account_id, counter_account, amount, source, reference_id, balance_before, balance_after, remark, created_at)
+SELECT ?, organizations.id, ?, organizations.quota, ?, '', 0, organizations.quota, '', ?
+FROM organizations WHERE organizations.quota <> 0 AND NOT EXISTS (
+	SELECT 1 FROM quota_ledgers WHERE quota_ledgers.account_type = ? AND quota_ledgers.account_id = organizations.id)`,
+		LedgerAccountOrganization, LedgerCounterOpening, LedgerSourceOpening, now, LedgerAccountOrganization).Error
+}
+
+// LedgerDrift 账本余额与账户当前余额不一致的记录
+type LedgerDrift struct {
+	AccountType   string `json:"account_type"`
+	AccountId     int    `json:"account_id"`
+	Balance       int    `json:"balance"`
+	LedgerBalance int    `json:"ledger_balance"`
+	Drift         int    `json:"drift"`
+}
+
+// ReconcileLedger 校验每个账户的当前余额是否等于其账本分录之和，返回存在差异的账户
+func ReconcileLedger() ([]LedgerDrift, error) {
+	drifts := make([]LedgerDrift, 0)
+	for _, account := range []struct {
+		accountType string
+		table       string
+	}{
+		{LedgerAccountUser, "users"},
+		{LedgerAccountOrganization, "organizations"},
+	} {
+		var rows []LedgerDrift
+		err := DB.Raw(fmt.Sprintf(`SELECT ? AS account_type, t.id AS account_id, t.quota AS balance, COALESCE(l.total, 0) AS ledger_balance
+FROM %s t LEFT JOIN (SELECT account_id, SUM(amount) AS total FROM quota_ledgers WHERE account_type = ? GROUP BY account_id) l
+ON l.account_id = t.id
+WHERE t.quota <> COALESCE(l.total, 0)`, account.table), account.accountType, account.accountType).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rows[i].Drift = rows[i].Balance - rows[i].LedgerBalance
+		}
+		drifts = append(drifts, rows...)
+	}
+	return drifts, nil
+}
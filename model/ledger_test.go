@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func createLedgerTestUser(t *testing.T, quota int) *User {
+	t.Helper()
+	user := &User{
+		Username: "ledger_" + common.GetRandomString(12),
+		AffCode:  common.GetRandomString(16),
+		Quota:    quota,
+		Status:   common.UserStatusEnabled,
+	}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func TestEnsureLedgerOpeningBalances(t *testing.T) {
+	withOpening := createLedgerTestUser(t, 500)
+	withEntries := createLedgerTestUser(t, 0)
+	if err := IncreaseUserQuota(withEntries.Id, 300, true, LedgerRef{Source: LedgerSourceTopUp}); err != nil {
+		t.Fatalf("IncreaseUserQuota: %v", err)
+	}
+	if err := EnsureLedgerOpeningBalances(); err != nil {
+		t.Fatalf("EnsureLedgerOpeningBalances: %v", err)
+	}
+	// 重复执行不应重复写入期初余额
+	if err := EnsureLedgerOpeningBalances(); err != nil {
+		t.Fatalf("EnsureLedgerOpeningBalances: %v", err)
+	}
+	drifts, err := ReconcileLedger()
+	if err != nil {
+		t.Fatalf("ReconcileLedger: %v", err)
+	}
+	for _, drift := range drifts {
+		if drift.AccountType == LedgerAccountUser && (drift.AccountId == withOpening.Id || drift.AccountId == withEntries.Id) {
+			t.Fatalf("unexpected drift: %+v", drift)
+		}
+	}
+}
+
+func TestDeferredLedgerDuplicateSkipsBalance(t *testing.T) {
+	common.BatchUpdateEnabled = true
+	defer func() { common.BatchUpdateEnabled = false }()
+	user := createLedgerTestUser(t, 0)
+	ref := LedgerRef{Source: LedgerSourceTopUp, ReferenceId: "trade_dup", IdempotencyKey: "topup:trade_dup:" + user.Username}
+
+	if err := IncreaseUserQuota(user.Id, 100, false, ref); err != nil {
+		t.Fatalf("first IncreaseUserQuota: %v", err)
+	}
+	if err := IncreaseUserQuota(user.Id, 100, false, ref); !errors.Is(err, ErrLedgerDuplicate) {
+		t.Fatalf("second IncreaseUserQuota err = %v, want ErrLedgerDuplicate", err)
+	}
+
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Lock()
+	pending := batchUpdateStores[BatchUpdateTypeUserQuota][user.Id]
+	delete(batchUpdateStores[BatchUpdateTypeUserQuota], user.Id)
+	batchUpdateLocks[BatchUpdateTypeUserQuota].Unlock()
+	if pending != 100 {
+		t.Fatalf("pending balance delta = %d, want 100", pending)
+	}
+}
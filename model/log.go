@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/types"
 
 	"github.com/gin-gonic/gin"
@@ -34,7 +35,12 @@ type Log struct {
 	Group            string `json:"group" gorm:"index"`
 	Ip               string `json:"ip" gorm:"index;default:''"`
 	RequestId        string `json:"request_id,omitempty" gorm:"type:varchar(64);index:idx_logs_request_id;default:''"`
+	OrgId            int    `json:"org_id,omitempty" gorm:"default:0;index"`
+	ProjectId        int    `json:"project_id,omitempty" gorm:"default:0;index"`
 	Other            string `json:"other"`
+	// 按查看者展示货币换算的额度金额，不落库
+	DisplayAmount   float64 `json:"display_amount,omitempty" gorm:"-:all"`
+	DisplayCurrency string  `json:"display_currency,omitempty" gorm:"-:all"`
 }
 
 // don't use iota, avoid change log type value
@@ -94,6 +100,8 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	requestId := c.GetString(common.RequestIdKey)
 	clientIP := c.ClientIP()
 	otherStr := common.MapToJsonStr(other)
+	orgId := common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId)
+	projectId := common.GetContextKeyInt(c, constant.ContextKeyTokenProjectId)
 
 	gopool.Go(func() {
 		needRecordIp := false
@@ -124,6 +132,8 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 			}(),
 			RequestId: requestId,
 			Other:     otherStr,
+			OrgId:     orgId,
+			ProjectId: projectId,
 		}
 		if err := LOG_DB.Create(log).Error; err != nil {
 			common.SysLog("failed to record error log: " + err.Error())
@@ -147,15 +157,40 @@ type RecordConsumeLogParams struct {
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	// 派生令牌额度按实际消耗累计，不受消费日志开关影响
+	recordDerivedTokenUsage(c, params.Quota)
 	if !common.LogConsumeEnabled {
 		return
 	}
 	// Extract values from gin.Context before async (Context unsafe after request ends)
-	username := c.GetString("username")
-	requestId := c.GetString(common.RequestIdKey)
-	clientIP := c.ClientIP()
-	otherStr := common.MapToJsonStr(params.Other)
+	recordConsumeLog(userId, consumeLogSource{
+		username:  c.GetString("username"),
+		requestId: c.GetString(common.RequestIdKey),
+		clientIP:  c.ClientIP(),
+		orgId:     common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId),
+		projectId: common.GetContextKeyInt(c, constant.ContextKeyTokenProjectId),
+	}, params)
+}
+
+// RecordTaskConsumeLog 异步任务轮询时没有原请求，由调用方直接提供用户名与扣费的组织、项目
+func RecordTaskConsumeLog(userId int, username string, orgId int, projectId int, params RecordConsumeLogParams) {
+	if !common.LogConsumeEnabled {
+		return
+	}
+	recordConsumeLog(userId, consumeLogSource{username: username, orgId: orgId, projectId: projectId}, params)
+}
 
+// consumeLogSource 消费日志中来自请求上下文的字段
+type consumeLogSource struct {
+	username  string
+	requestId string
+	clientIP  string
+	orgId     int
+	projectId int
+}
+
+func recordConsumeLog(userId int, source consumeLogSource, params RecordConsumeLogParams) {
+	otherStr := common.MapToJsonStr(params.Other)
 	gopool.Go(func() {
 		needRecordIp := false
 		if settingMap, err := GetUserSetting(userId, false); err == nil {
@@ -163,7 +198,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		}
 		log := &Log{
 			UserId:           userId,
-			Username:         username,
+			Username:         source.username,
 			CreatedAt:        common.GetTimestamp(),
 			Type:             LogTypeConsume,
 			Content:          params.Content,
@@ -179,18 +214,20 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			Group:            params.Group,
 			Ip: func() string {
 				if needRecordIp {
-					return clientIP
+					return source.clientIP
 				}
 				return ""
 			}(),
-			RequestId: requestId,
+			RequestId: source.requestId,
 			Other:     otherStr,
+			OrgId:     source.orgId,
+			ProjectId: source.projectId,
 		}
 		if err := LOG_DB.Create(log).Error; err != nil {
 			common.SysLog("failed to record log: " + err.Error())
 		}
 		if common.DataExportEnabled {
-			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
+			LogQuotaData(userId, source.username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
 		}
 	})
 }
@@ -310,6 +347,67 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	return logs, total, err
 }
 
+// GetOrganizationLogs 查询组织成员通过项目令牌产生的日志，projectId 为 0 时查询整个组织
+func GetOrganizationLogs(orgId int, projectId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, startIdx int, num int) (logs []*Log, total int64, err error) {
+	tx := LOG_DB.Where("logs.org_id = ?", orgId)
+	if projectId != 0 {
+		tx = tx.Where("logs.project_id = ?", projectId)
+	}
+	if logType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", logType)
+	}
+	if modelName != "" {
+		modelNamePattern, err := sanitizeLikePattern(modelName)
+		if err != nil {
+			return nil, 0, err
+		}
+		tx = tx.Where("logs.model_name LIKE ? ESCAPE '!'", modelNamePattern)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", endTimestamp)
+	}
+	err = tx.Model(&Log{}).Limit(logSearchCountLimit).Count(&total).Error
+	if err != nil {
+		common.SysError("failed to count organization logs: " + err.Error())
+		return nil, 0, errors.New("查询日志失败")
+	}
+	err = tx.Order("logs.id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	if err != nil {
+		common.SysError("failed to search organization logs: " + err.Error())
+		return nil, 0, errors.New("查询日志失败")
+	}
+	formatUserLogs(logs, startIdx)
+	return logs, total, err
+}
+
+type ProjectQuotaStat struct {
+	ProjectId int `json:"project_id"`
+	Quota     int `json:"quota"`
+	Count     int `json:"count"`
+	Tokens    int `json:"tokens"`
+}
+
+// SumOrganizationQuotaByProject 按项目汇总组织在时间范围内的消费
+func SumOrganizationQuotaByProject(orgId int, startTimestamp int64, endTimestamp int64) (stats []ProjectQuotaStat, err error) {
+	tx := LOG_DB.Table("logs").
+		Select("project_id, sum(quota) quota, count(*) count, sum(prompt_tokens) + sum(completion_tokens) tokens").
+		Where("org_id = ? AND type = ?", orgId, LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if err = tx.Group("project_id").Scan(&stats).Error; err != nil {
+		common.SysError("failed to query organization stat: " + err.Error())
+		return nil, errors.New("查询统计数据失败")
+	}
+	return stats, nil
+}
+
 type Stat struct {
 	Quota int `json:"quota"`
 	Rpm   int `json:"rpm"`
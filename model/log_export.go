@@ -0,0 +1,130 @@
+package model
+
+import (
+	"github.com/Zer0Echo/uniapi/types"
+
+	"gorm.io/gorm"
+)
+
+// 导出日志时每批读取的条数
+const logExportBatchSize = 1000
+
+// LogExportFilter 导出日志的筛选条件，与日志列表接口一致。UserId 不为 0 时仅导出该用户的日志
+type LogExportFilter struct {
+	UserId         int
+	LogType        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+	Group          string
+	RequestId      string
+}
+
+func (f *LogExportFilter) query() (*gorm.DB, error) {
+	tx := LOG_DB.Model(&Log{})
+	if f.UserId != 0 {
+		tx = tx.Where("logs.user_id = ?", f.UserId)
+	}
+	if f.LogType != LogTypeUnknown {
+		tx = tx.Where("logs.type = ?", f.LogType)
+	}
+	if f.ModelName != "" {
+		if f.UserId != 0 {
+			modelNamePattern, err := sanitizeLikePattern(f.ModelName)
+			if err != nil {
+				return nil, err
+			}
+			tx = tx.Where("logs.model_name LIKE ? ESCAPE '!'", modelNamePattern)
+		} else {
+			tx = tx.Where("logs.model_name like ?", f.ModelName)
+		}
+	}
+	if f.Username != "" {
+		tx = tx.Where("logs.username = ?", f.Username)
+	}
+	if f.TokenName != "" {
+		tx = tx.Where("logs.token_name = ?", f.TokenName)
+	}
+	if f.RequestId != "" {
+		tx = tx.Where("logs.request_id = ?", f.RequestId)
+	}
+	if f.StartTimestamp != 0 {
+		tx = tx.Where("logs.created_at >= ?", f.StartTimestamp)
+	}
+	if f.EndTimestamp != 0 {
+		tx = tx.Where("logs.created_at <= ?", f.EndTimestamp)
+	}
+	if f.Channel != 0 {
+		tx = tx.Where("logs.channel_id = ?", f.Channel)
+	}
+	if f.Group != "" {
+		tx = tx.Where("logs."+logGroupCol+" = ?", f.Group)
+	}
+	return tx, nil
+}
+
+// StreamLogs 按 id 升序分批读取符合条件的全部日志并交给 fn 处理，使用 id 游标而不是 offset 分页，
+// 导出大量日志时不会越翻越慢。withChannelName 为 true 时填充渠道名称
+func StreamLogs(filter LogExportFilter, withChannelName bool, fn func(logs []*Log) error) error {
+	lastId := 0
+	channelNames := make(map[int]string)
+	for {
+		tx, err := filter.query()
+		if err != nil {
+			return err
+		}
+		var logs []*Log
+		if err := tx.Where("logs.id > ?", lastId).Order("logs.id asc").Limit(logExportBatchSize).Find(&logs).Error; err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+		if withChannelName {
+			if err := fillLogChannelNames(logs, channelNames); err != nil {
+				return err
+			}
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < logExportBatchSize {
+			return nil
+		}
+	}
+}
+
+// fillLogChannelNames 填充渠道名称，cache 在多个批次间复用
+func fillLogChannelNames(logs []*Log, cache map[int]string) error {
+	missing := types.NewSet[int]()
+	for _, log := range logs {
+		if log.ChannelId != 0 {
+			if _, ok := cache[log.ChannelId]; !ok {
+				missing.Add(log.ChannelId)
+			}
+		}
+	}
+	if missing.Len() > 0 {
+		var channels []struct {
+			Id   int    `gorm:"column:id"`
+			Name string `gorm:"column:name"`
+		}
+		if err := DB.Table("channels").Select("id, name").Where("id IN ?", missing.Items()).Find(&channels).Error; err != nil {
+			return err
+		}
+		for _, id := range missing.Items() {
+			cache[id] = ""
+		}
+		for _, channel := range channels {
+			cache[channel.Id] = channel.Name
+		}
+	}
+	for _, log := range logs {
+		log.ChannelName = cache[log.ChannelId]
+	}
+	return nil
+}
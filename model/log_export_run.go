@@ -0,0 +1,47 @@
+package model
+
+import "github.com/Zer0Echo/uniapi/common"
+
+const (
+	LogExportRunStatusSuccess = "success"
+	LogExportRunStatusFailed  = "failed"
+)
+
+// LogExportRun 定时导出的执行记录，下一次导出从最近一次成功导出的结束时间继续
+type LogExportRun struct {
+	Id             int    `json:"id"`
+	StartTimestamp int64  `json:"start_timestamp" gorm:"bigint"`
+	EndTimestamp   int64  `json:"end_timestamp" gorm:"bigint"`
+	Format         string `json:"format" gorm:"type:varchar(16)"`
+	Target         string `json:"target" gorm:"type:varchar(16)"`
+	Location       string `json:"location" gorm:"type:varchar(512)"`
+	Rows           int    `json:"rows"`
+	Status         string `json:"status" gorm:"type:varchar(16);index"`
+	Error          string `json:"error" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (run *LogExportRun) Insert() error {
+	if run.CreatedAt == 0 {
+		run.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(run).Error
+}
+
+// GetLastSuccessfulLogExportRun 返回最近一次成功的导出，尚未导出过时返回 nil
+func GetLastSuccessfulLogExportRun() (*LogExportRun, error) {
+	var runs []*LogExportRun
+	err := DB.Where("status = ?", LogExportRunStatusSuccess).Order("end_timestamp desc").Limit(1).Find(&runs).Error
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return runs[0], nil
+}
+
+func GetLogExportRuns(startIdx int, num int) (runs []*LogExportRun, total int64, err error) {
+	if err = DB.Model(&LogExportRun{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&runs).Error
+	return runs, total, err
+}
@@ -0,0 +1,115 @@
+package model
+
+import "testing"
+
+func streamTestLogIds(t *testing.T, filter LogExportFilter) []int {
+	t.Helper()
+	var ids []int
+	err := StreamLogs(filter, false, func(logs []*Log) error {
+		for _, log := range logs {
+			ids = append(ids, log.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLogs: %v", err)
+	}
+	return ids
+}
+
+func TestStreamLogsFilter(t *testing.T) {
+	resetTables(t, &Log{}, &Channel{})
+	channel := &Channel{Name: "export-channel", Key: "sk-test"}
+	if err := DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	logs := []*Log{
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, CreatedAt: 100, ModelName: "gpt_4", TokenName: "t1", ChannelId: channel.Id, Group: "default", RequestId: "req-1"},
+		{UserId: 1, Username: "alice", Type: LogTypeConsume, CreatedAt: 200, ModelName: "gpt-4o", TokenName: "t2", Group: "vip"},
+		{UserId: 1, Username: "alice", Type: LogTypeTopup, CreatedAt: 300},
+		{UserId: 2, Username: "bob", Type: LogTypeConsume, CreatedAt: 400, ModelName: "gpt-4", ChannelId: channel.Id},
+	}
+	for _, log := range logs {
+		if err := LOG_DB.Create(log).Error; err != nil {
+			t.Fatalf("failed to create log: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter LogExportFilter
+		want   []*Log
+	}{
+		{name: "no filter", filter: LogExportFilter{}, want: logs},
+		{name: "user", filter: LogExportFilter{UserId: 2}, want: logs[3:]},
+		{name: "type", filter: LogExportFilter{LogType: LogTypeTopup}, want: logs[2:3]},
+		{name: "time range", filter: LogExportFilter{StartTimestamp: 150, EndTimestamp: 300}, want: logs[1:3]},
+		{name: "username", filter: LogExportFilter{Username: "bob"}, want: logs[3:]},
+		{name: "token name", filter: LogExportFilter{TokenName: "t2"}, want: logs[1:2]},
+		{name: "channel", filter: LogExportFilter{Channel: channel.Id}, want: []*Log{logs[0], logs[3]}},
+		{name: "group", filter: LogExportFilter{Group: "vip"}, want: logs[1:2]},
+		{name: "request id", filter: LogExportFilter{RequestId: "req-1"}, want: logs[:1]},
+		// 管理员按原样使用 LIKE，_ 为通配符
+		{name: "admin model name wildcard", filter: LogExportFilter{ModelName: "gpt_4"}, want: []*Log{logs[0], logs[3]}},
+		// 用户导出时转义 _，只匹配字面值
+		{name: "user model name escaped", filter: LogExportFilter{UserId: 1, ModelName: "gpt_4"}, want: logs[:1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := streamTestLogIds(t, tt.filter)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got ids %v, want %d logs", got, len(tt.want))
+			}
+			for i, log := range tt.want {
+				if got[i] != log.Id {
+					t.Fatalf("got ids %v, want id %d at %d", got, log.Id, i)
+				}
+			}
+		})
+	}
+
+	if err := StreamLogs(LogExportFilter{UserId: 1, ModelName: "%%"}, false, func([]*Log) error { return nil }); err == nil {
+		t.Fatal("expected invalid user model name pattern to be rejected")
+	}
+
+	var channelNames []string
+	err := StreamLogs(LogExportFilter{UserId: 2}, true, func(logs []*Log) error {
+		for _, log := range logs {
+			channelNames = append(channelNames, log.ChannelName)
+		}
+		return nil
+	})
+	if err != nil || len(channelNames) != 1 || channelNames[0] != "export-channel" {
+		t.Fatalf("unexpected channel names %v, %v", channelNames, err)
+	}
+}
+
+func TestStreamLogsBatches(t *testing.T) {
+	resetTables(t, &Log{})
+	logs := make([]*Log, logExportBatchSize+5)
+	for i := range logs {
+		logs[i] = &Log{UserId: 1, Type: LogTypeConsume, CreatedAt: int64(i + 1)}
+	}
+	if err := LOG_DB.CreateInBatches(logs, 200).Error; err != nil {
+		t.Fatalf("failed to create logs: %v", err)
+	}
+
+	var batches []int
+	lastId := 0
+	err := StreamLogs(LogExportFilter{}, false, func(batch []*Log) error {
+		batches = append(batches, len(batch))
+		for _, log := range batch {
+			if log.Id <= lastId {
+				t.Fatalf("logs out of order: %d after %d", log.Id, lastId)
+			}
+			lastId = log.Id
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLogs: %v", err)
+	}
+	if len(batches) != 2 || batches[0] != logExportBatchSize || batches[1] != 5 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+}
@@ -203,8 +203,10 @@ func InitDB() (err error) {
 			//_, _ = sqlDB.Exec("ALTER TABLE channels MODIFY model_mapping TEXT;") // TODO: delete this line when most users have upgraded
 		}
 		common.SysLog("database migration started")
-		err = migrateDB()
-		return err
+		if err = migrateDB(); err != nil {
+			return err
+		}
+		return EnsureLedgerOpeningBalances()
 	} else {
 		common.FatalLog(err)
 	}
@@ -252,6 +254,7 @@ func InitLogDB() (err error) {
 func migrateDB() error {
 	// Migrate price_amount column from float/double to decimal for existing tables
 	migrateSubscriptionPlanPriceAmount()
+	migratePaymentRefundProviderId()
 
 	err := DB.AutoMigrate(
 		&Channel{},
@@ -281,6 +284,22 @@ func migrateDB() error {
 		&QuotaRecord{},
 		&Ticket{},
 		&TicketMessage{},
+		&Organization{},
+		&OrganizationMember{},
+		&Project{},
+		&QuotaLedger{},
+		&Statement{},
+		&LogExportRun{},
+		&SubscriptionAllowanceUsage{},
+		&PaymentRefund{},
+		&TopUpPackage{},
+		&PromoCode{},
+		&ExchangeRate{},
+		&AdminRole{},
+		&AuditLog{},
+		&ScimGroup{},
+		&ScimGroupMember{},
+		&ChannelBalanceHistory{},
 	)
 	if err != nil {
 		return err
@@ -332,6 +351,22 @@ func migrateDBFast() error {
 		{&QuotaRecord{}, "QuotaRecord"},
 		{&Ticket{}, "Ticket"},
 		{&TicketMessage{}, "TicketMessage"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&Project{}, "Project"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&Statement{}, "Statement"},
+		{&LogExportRun{}, "LogExportRun"},
+		{&SubscriptionAllowanceUsage{}, "SubscriptionAllowanceUsage"},
+		{&PaymentRefund{}, "PaymentRefund"},
+		{&TopUpPackage{}, "TopUpPackage"},
+		{&PromoCode{}, "PromoCode"},
+		{&ExchangeRate{}, "ExchangeRate"},
+		{&AdminRole{}, "AdminRole"},
+		{&AuditLog{}, "AuditLog"},
+		{&ScimGroup{}, "ScimGroup"},
+		{&ScimGroupMember{}, "ScimGroupMember"},
+		{&ChannelBalanceHistory{}, "ChannelBalanceHistory"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -407,6 +442,8 @@ func ensureSubscriptionPlanTableSQLite() error {
 ` + "`total_amount`" + ` bigint NOT NULL DEFAULT 0,
 ` + "`quota_reset_period`" + ` varchar(16) DEFAULT 'never',
 ` + "`quota_reset_custom_seconds`" + ` bigint DEFAULT 0,
+` + "`model_allowances`" + ` text,
+` + "`currency_prices`" + ` text,
 ` + "`created_at`" + ` bigint,
 ` + "`updated_at`" + ` bigint,
 PRIMARY KEY (` + "`id`" + `)
@@ -441,6 +478,8 @@ PRIMARY KEY (` + "`id`" + `)
 		{Name: "total_amount", DDL: "`total_amount` bigint NOT NULL DEFAULT 0"},
 		{Name: "quota_reset_period", DDL: "`quota_reset_period` varchar(16) DEFAULT 'never'"},
 		{Name: "quota_reset_custom_seconds", DDL: "`quota_reset_custom_seconds` bigint DEFAULT 0"},
+		{Name: "model_allowances", DDL: "`model_allowances` text"},
+		{Name: "currency_prices", DDL: "`currency_prices` text"},
 		{Name: "created_at", DDL: "`created_at` bigint"},
 		{Name: "updated_at", DDL: "`updated_at` bigint"},
 	}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用临时 SQLite 数据库运行 model 包的测试，不依赖 Redis
+func TestMain(m *testing.M) {
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	dir, err := os.MkdirTemp("", "uniapi-model-test")
+	if err != nil {
+		fmt.Println("failed to create test directory: " + err.Error())
+		os.Exit(1)
+	}
+	dsn := filepath.Join(dir, "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	DB = db
+	LOG_DB = db
+	initCol()
+	if err = migrateDB(); err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	if err = migrateLOGDB(); err != nil {
+		fmt.Println("failed to migrate test log database: " + err.Error())
+		os.Exit(1)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// resetTables 清空测试用到的表，保证测试之间互不影响
+func resetTables(t *testing.T, models ...any) {
+	t.Helper()
+	for _, m := range models {
+		if err := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(m).Error; err != nil {
+			t.Fatalf("failed to reset table: %v", err)
+		}
+	}
+}
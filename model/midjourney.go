@@ -1,5 +1,13 @@
 package model
 
+import (
+	"encoding/json"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"gorm.io/gorm"
+)
+
 type Midjourney struct {
 	Id          int    `json:"id"`
 	Code        int    `json:"code"`
@@ -23,6 +31,9 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	// 通过项目令牌提交的任务从组织钱包扣费，失败退款同样退回组织钱包
+	OrgId     int `json:"org_id,omitempty"`
+	ProjectId int `json:"project_id,omitempty"`
 }
 
 // TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
@@ -148,25 +159,63 @@ func UpdateProgress(id int, progress string) error {
 func (midjourney *Midjourney) Insert() error {
 	var err error
 	err = DB.Create(midjourney).Error
+	if err == nil {
+		midjourney.insertTask()
+	}
 	return err
 }
 
 func (midjourney *Midjourney) Update() error {
 	var err error
 	err = DB.Save(midjourney).Error
+	if err == nil {
+		midjourney.syncTask()
+	}
 	return err
 }
 
+// RefundQuota 将额度退还给任务的付款方（组织钱包或用户钱包）
+func (midjourney *Midjourney) RefundQuota(quota int) error {
+	ref := LedgerRef{Source: LedgerSourceRefund, ReferenceId: midjourney.MjId}
+	if midjourney.OrgId != 0 {
+		if err := RefundOrganizationQuota(midjourney.OrgId, quota, ref); err != nil {
+			return err
+		}
+		return UpdateProjectUsedQuota(midjourney.ProjectId, -quota)
+	}
+	return IncreaseUserQuota(midjourney.UserId, quota, false, ref)
+}
+
 func MjBulkUpdate(mjIds []string, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
+	err := DB.Model(&Midjourney{}).
 		Where("mj_id in (?)", mjIds).
 		Updates(params).Error
+	if err != nil {
+		return err
+	}
+	return syncMjTasks(DB.Where("mj_id in (?)", mjIds))
 }
 
 func MjBulkUpdateByTaskIds(taskIDs []int, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
+	err := DB.Model(&Midjourney{}).
 		Where("id in (?)", taskIDs).
 		Updates(params).Error
+	if err != nil {
+		return err
+	}
+	return syncMjTasks(DB.Where("id in (?)", taskIDs))
+}
+
+// syncMjTasks 批量更新后重新读取 MJ 任务并同步到通用任务表，与单条更新保持一致
+func syncMjTasks(query *gorm.DB) error {
+	var tasks []*Midjourney
+	if err := query.Find(&tasks).Error; err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		task.syncTask()
+	}
+	return nil
 }
 
 // CountAllTasks returns total midjourney tasks for admin query
@@ -205,3 +254,97 @@ func CountAllUserTask(userId int, queryParams TaskQueryParams) int64 {
 	_ = query.Count(&total).Error
 	return total
 }
+
+// insertTask 为新提交的 MJ 任务在通用任务表中创建对应记录，使其与其他平台的任务一起出现在任务列表中
+func (midjourney *Midjourney) insertTask() {
+	if midjourney.MjId == "" {
+		return
+	}
+	task := midjourney.toTask()
+	if err := DB.Create(task).Error; err != nil {
+		common.SysLog("failed to sync midjourney task: " + err.Error())
+	}
+}
+
+// syncTask 按 platform + task_id 直接更新通用任务表中的状态字段，只有未更新到记录时才查询并补建。
+// 输入与付款方在提交后不再变化，不更新 properties、private_data，避免覆盖管理员退款等标记
+func (midjourney *Midjourney) syncTask() {
+	if midjourney.MjId == "" {
+		return
+	}
+	task := midjourney.toTask()
+	result := DB.Model(&Task{}).Where("platform = ? and task_id = ?", task.Platform, task.TaskID).Updates(map[string]any{
+		"action":      task.Action,
+		"quota":       task.Quota,
+		"progress":    task.Progress,
+		"status":      task.Status,
+		"fail_reason": task.FailReason,
+		"submit_time": task.SubmitTime,
+		"start_time":  task.StartTime,
+		"finish_time": task.FinishTime,
+		"data":        task.Data,
+	})
+	if result.Error != nil {
+		common.SysLog("failed to sync midjourney task: " + result.Error.Error())
+		return
+	}
+	if result.RowsAffected > 0 {
+		return
+	}
+	// MySQL 在值未变化时也返回 0 行，需确认记录确实不存在再补建
+	var count int64
+	if err := DB.Model(&Task{}).Where("platform = ? and task_id = ?", task.Platform, task.TaskID).Count(&count).Error; err != nil {
+		common.SysLog("failed to sync midjourney task: " + err.Error())
+		return
+	}
+	if count == 0 {
+		midjourney.insertTask()
+	}
+}
+
+// toTask 将 MJ 任务转换为通用任务表记录
+func (midjourney *Midjourney) toTask() *Task {
+	task := &Task{
+		Platform:  constant.TaskPlatformMidjourney,
+		TaskID:    midjourney.MjId,
+		UserId:    midjourney.UserId,
+		ChannelId: midjourney.ChannelId,
+	}
+	task.PrivateData.OrgId = midjourney.OrgId
+	task.PrivateData.ProjectId = midjourney.ProjectId
+	task.Action = midjourney.Action
+	task.Quota = midjourney.Quota
+	task.Progress = midjourney.Progress
+	task.Properties.Input = midjourney.Prompt
+	// MJ 时间为毫秒，任务表使用秒
+	task.SubmitTime = midjourney.SubmitTime / 1000
+	task.StartTime = midjourney.StartTime / 1000
+	task.FinishTime = midjourney.FinishTime / 1000
+
+	task.Status = TaskStatus(midjourney.Status)
+	task.FailReason = midjourney.FailReason
+	switch {
+	case midjourney.Status == "" && midjourney.FailReason != "":
+		task.Status = TaskStatusFailure
+		task.Progress = "100%"
+	case midjourney.Status == "":
+		task.Status = TaskStatusSubmitted
+	case midjourney.Status == TaskStatusSuccess:
+		// 与视频任务一致，成功时 fail_reason 存放结果链接
+		task.FailReason = midjourney.ImageUrl
+		if midjourney.VideoUrl != "" {
+			task.FailReason = midjourney.VideoUrl
+		}
+	}
+
+	data, _ := json.Marshal(map[string]any{
+		"prompt_en":   midjourney.PromptEn,
+		"description": midjourney.Description,
+		"image_url":   midjourney.ImageUrl,
+		"video_url":   midjourney.VideoUrl,
+		"video_urls":  json.RawMessage(common.GetStringIfEmpty(midjourney.VideoUrls, "null")),
+		"buttons":     json.RawMessage(common.GetStringIfEmpty(midjourney.Buttons, "null")),
+	})
+	task.Data = data
+	return task
+}
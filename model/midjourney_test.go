@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/constant"
+)
+
+func getSyncedMjTask(t *testing.T, mjId string) *Task {
+	t.Helper()
+	var task Task
+	if err := DB.Where("platform = ? and task_id = ?", constant.TaskPlatformMidjourney, mjId).First(&task).Error; err != nil {
+		t.Fatalf("failed to load synced task: %v", err)
+	}
+	return &task
+}
+
+func TestMjBulkUpdateSyncsTasks(t *testing.T) {
+	resetTables(t, &Midjourney{}, &Task{})
+	byMjId := &Midjourney{UserId: 1, MjId: "mj-bulk-1", Action: constant.MjActionImagine, Status: "IN_PROGRESS", Progress: "50%", SubmitTime: 1_700_000_000_000}
+	byTaskId := &Midjourney{UserId: 1, MjId: "mj-bulk-2", Action: constant.MjActionImagine, Status: "IN_PROGRESS", Progress: "10%"}
+	for _, mj := range []*Midjourney{byMjId, byTaskId} {
+		if err := mj.Insert(); err != nil {
+			t.Fatalf("failed to insert midjourney task: %v", err)
+		}
+	}
+
+	if err := MjBulkUpdate([]string{byMjId.MjId}, map[string]any{
+		"fail_reason": "channel not found",
+		"status":      "FAILURE",
+		"progress":    "100%",
+	}); err != nil {
+		t.Fatalf("MjBulkUpdate: %v", err)
+	}
+	task := getSyncedMjTask(t, byMjId.MjId)
+	if task.Status != TaskStatusFailure || task.Progress != "100%" || task.FailReason != "channel not found" {
+		t.Fatalf("unexpected synced task: status=%s progress=%s reason=%s", task.Status, task.Progress, task.FailReason)
+	}
+	if task.SubmitTime != 1_700_000_000 {
+		t.Fatalf("expected submit time in seconds, got %d", task.SubmitTime)
+	}
+
+	if err := MjBulkUpdateByTaskIds([]int{byTaskId.Id}, map[string]any{
+		"status":   "FAILURE",
+		"progress": "100%",
+	}); err != nil {
+		t.Fatalf("MjBulkUpdateByTaskIds: %v", err)
+	}
+	task = getSyncedMjTask(t, byTaskId.MjId)
+	if task.Status != TaskStatusFailure || task.Progress != "100%" {
+		t.Fatalf("unexpected synced task: status=%s progress=%s", task.Status, task.Progress)
+	}
+
+	var count int64
+	DB.Model(&Task{}).Where("platform = ?", constant.TaskPlatformMidjourney).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected one synced task per midjourney task, got %d", count)
+	}
+}
+
+func TestMidjourneyUpdateSyncsTask(t *testing.T) {
+	resetTables(t, &Midjourney{}, &Task{})
+	mj := &Midjourney{UserId: 1, MjId: "mj-update-1", Action: constant.MjActionImagine, Prompt: "cat", Progress: "0%"}
+	if err := mj.Insert(); err != nil {
+		t.Fatalf("failed to insert midjourney task: %v", err)
+	}
+	task := getSyncedMjTask(t, mj.MjId)
+	if task.Status != TaskStatusSubmitted || task.Properties.Input != "cat" {
+		t.Fatalf("unexpected inserted task: status=%s input=%s", task.Status, task.Properties.Input)
+	}
+	// 管理员退款标记不应被后续同步覆盖
+	task.Properties.Refunded = true
+	if err := DB.Save(task).Error; err != nil {
+		t.Fatalf("failed to mark task refunded: %v", err)
+	}
+
+	mj.Status = TaskStatusSuccess
+	mj.Progress = "100%"
+	mj.ImageUrl = "https://example.com/cat.png"
+	for i := 0; i < 2; i++ {
+		if err := mj.Update(); err != nil {
+			t.Fatalf("failed to update midjourney task: %v", err)
+		}
+	}
+	task = getSyncedMjTask(t, mj.MjId)
+	if task.Status != TaskStatusSuccess || task.Progress != "100%" || task.FailReason != mj.ImageUrl {
+		t.Fatalf("unexpected synced task: status=%s progress=%s reason=%s", task.Status, task.Progress, task.FailReason)
+	}
+	if !task.Properties.Refunded {
+		t.Fatal("expected refunded flag to be preserved")
+	}
+
+	// 同步前已存在的 MJ 任务在更新时补建记录
+	legacy := &Midjourney{UserId: 1, MjId: "mj-update-legacy", Action: constant.MjActionImagine}
+	if err := DB.Create(legacy).Error; err != nil {
+		t.Fatalf("failed to create legacy midjourney task: %v", err)
+	}
+	legacy.Status = "IN_PROGRESS"
+	if err := legacy.Update(); err != nil {
+		t.Fatalf("failed to update legacy midjourney task: %v", err)
+	}
+	if task := getSyncedMjTask(t, legacy.MjId); task.Status != "IN_PROGRESS" {
+		t.Fatalf("unexpected legacy task status %s", task.Status)
+	}
+
+	var count int64
+	DB.Model(&Task{}).Where("platform = ?", constant.TaskPlatformMidjourney).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected one synced task per midjourney task, got %d", count)
+	}
+}
@@ -0,0 +1,416 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"gorm.io/gorm"
+)
+
+// Organization 组织，拥有共享钱包，成员通过项目令牌调用时从组织钱包扣费
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	// 当前用户在组织中的角色，仅用于接口返回
+	Role string `json:"role,omitempty" gorm:"-:all"`
+}
+
+// OrganizationMember 组织成员及其角色
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_member_user,priority:1"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user,priority:2;index"`
+	Role        string `json:"role" gorm:"type:varchar(16)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"`
+}
+
+// Project 组织下的项目，令牌归属于项目，按项目设置预算与可用模型
+type Project struct {
+	Id    int    `json:"id"`
+	OrgId int    `json:"org_id" gorm:"index"`
+	Name  string `json:"name" gorm:"type:varchar(64)"`
+	// 项目预算（额度），0 表示不限制，仅受组织余额约束
+	Budget      int    `json:"budget" gorm:"default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	ModelLimits string `json:"model_limits" gorm:"type:varchar(1024);default:''"`
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+var orgRoleLevel = map[string]int{
+	common.OrgRoleViewer:    1,
+	common.OrgRoleDeveloper: 2,
+	common.OrgRoleAdmin:     3,
+	common.OrgRoleOwner:     4,
+}
+
+func IsValidOrgRole(role string) bool {
+	_, ok := orgRoleLevel[role]
+	return ok
+}
+
+// OrgRoleAtLeast 判断 role 的权限是否不低于 required
+func OrgRoleAtLeast(role string, required string) bool {
+	return orgRoleLevel[role] >= orgRoleLevel[required]
+}
+
+// CreateOrganization 创建组织并将创建者设为所有者
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	now := common.GetTimestamp()
+	org := &Organization{
+		Name:        name,
+		OwnerId:     ownerId,
+		Status:      common.OrganizationStatusEnabled,
+		CreatedTime: now,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        common.OrgRoleOwner,
+			CreatedTime: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	org.Role = common.OrgRoleOwner
+	return org, nil
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("组织 ID 为空")
+	}
+	var org Organization
+	if err := DB.First(&org, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	if err = DB.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户加入的所有组织，并填充用户在其中的角色
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return []*Organization{}, nil
+	}
+	roles := make(map[int]string, len(members))
+	orgIds := make([]int, 0, len(members))
+	for _, m := range members {
+		roles[m.OrgId] = m.Role
+		orgIds = append(orgIds, m.OrgId)
+	}
+	var orgs []*Organization
+	if err := DB.Where("id in (?)", orgIds).Order("id desc").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		org.Role = roles[org.Id]
+	}
+	return orgs, nil
+}
+
+func (org *Organization) Update() error {
+	if err := DB.Model(org).Select("name", "status").Updates(org).Error; err != nil {
+		return err
+	}
+	invalidateOrganizationCache(org.Id)
+	return nil
+}
+
+// RefundOrganizationQuota 退还组织钱包中已消费的额度
+func RefundOrganizationQuota(orgId int, quota int, refs ...LedgerRef) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota + ?", quota),
+			"used_quota": gorm.Expr("used_quota - ?", quota),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return RecordOrganizationLedger(tx, orgId, quota, firstLedgerRef(refs))
+	})
+}
+
+// ConsumeOrganizationQuota 从组织钱包扣除额度并计入已用额度
+func ConsumeOrganizationQuota(orgId int, quota int, refs ...LedgerRef) error {
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return RecordOrganizationLedger(tx, orgId, -quota, firstLedgerRef(refs))
+	})
+}
+
+// AdjustOrganizationQuota 管理员直接调整组织余额，不计入已用额度
+func AdjustOrganizationQuota(orgId int, delta int, refs ...LedgerRef) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return RecordOrganizationLedger(tx, orgId, delta, firstLedgerRef(refs))
+	})
+}
+
+// TransferUserQuotaToOrganization 成员将个人余额转入组织钱包
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户余额不足")
+		}
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+			return err
+		}
+		// 划转的两条分录互为对方账户
+		err := RecordUserLedger(tx, userId, -quota, LedgerRef{
+			Source:         LedgerSourceTransfer,
+			CounterAccount: LedgerAccount(LedgerAccountOrganization, orgId),
+		})
+		if err != nil {
+			return err
+		}
+		return RecordOrganizationLedger(tx, orgId, quota, LedgerRef{
+			Source:         LedgerSourceTransfer,
+			CounterAccount: LedgerAccount(LedgerAccountUser, userId),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+		common.SysLog("failed to decrease user quota cache: " + err.Error())
+	}
+	return nil
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	if err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("org_id = ?", orgId).Order("id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if username, err := GetUsernameById(m.UserId, false); err == nil {
+			m.Username = username
+		}
+	}
+	return members, nil
+}
+
+func AddOrganizationMember(orgId int, userId int, role string) (*OrganizationMember, error) {
+	if !IsValidOrgRole(role) || role == common.OrgRoleOwner {
+		return nil, errors.New("无效的成员角色")
+	}
+	if _, err := GetOrganizationMember(orgId, userId); err == nil {
+		return nil, errors.New("用户已是组织成员")
+	}
+	member := &OrganizationMember{
+		OrgId:       orgId,
+		UserId:      userId,
+		Role:        role,
+		CreatedTime: common.GetTimestamp(),
+	}
+	if err := DB.Create(member).Error; err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func UpdateOrganizationMemberRole(orgId int, userId int, role string) error {
+	if !IsValidOrgRole(role) || role == common.OrgRoleOwner {
+		return errors.New("无效的成员角色")
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == common.OrgRoleOwner {
+		return errors.New("不能修改组织所有者的角色")
+	}
+	if err := DB.Model(member).Update("role", role).Error; err != nil {
+		return err
+	}
+	invalidateOrganizationMemberCache(orgId, userId)
+	return nil
+}
+
+func RemoveOrganizationMember(orgId int, userId int) error {
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == common.OrgRoleOwner {
+		return errors.New("不能移除组织所有者")
+	}
+	if err := DB.Delete(member).Error; err != nil {
+		return err
+	}
+	invalidateOrganizationMemberCache(orgId, userId)
+	return nil
+}
+
+func CreateProject(project *Project) error {
+	project.Status = common.ProjectStatusEnabled
+	project.CreatedTime = common.GetTimestamp()
+	return DB.Create(project).Error
+}
+
+func GetProjectById(id int) (*Project, error) {
+	if id == 0 {
+		return nil, errors.New("项目 ID 为空")
+	}
+	var project Project
+	if err := DB.First(&project, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func GetOrganizationProjects(orgId int) ([]*Project, error) {
+	var projects []*Project
+	err := DB.Where("org_id = ?", orgId).Order("id desc").Find(&projects).Error
+	return projects, err
+}
+
+func (project *Project) Update() error {
+	if err := DB.Model(project).Select("name", "budget", "model_limits", "status").Updates(project).Error; err != nil {
+		return err
+	}
+	invalidateProjectCache(project.Id)
+	return nil
+}
+
+func (project *Project) GetModelLimitsMap() map[string]bool {
+	limits := make(map[string]bool)
+	for _, name := range strings.Split(project.ModelLimits, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			limits[name] = true
+		}
+	}
+	return limits
+}
+
+// RemainBudget 返回项目剩余预算，未设置预算时返回 -1
+func (project *Project) RemainBudget() int {
+	if project.Budget <= 0 {
+		return -1
+	}
+	return max(project.Budget-project.UsedQuota, 0)
+}
+
+// UpdateProjectUsedQuota 累加项目已用额度，delta 为负数时表示退还
+func UpdateProjectUsedQuota(projectId int, delta int) error {
+	if projectId == 0 || delta == 0 {
+		return nil
+	}
+	return DB.Model(&Project{}).Where("id = ?", projectId).
+		Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+}
+
+// ErrProjectBudgetExceeded 项目剩余预算不足以预留本次请求的额度
+var ErrProjectBudgetExceeded = errors.New("project budget exceeded")
+
+// ReserveProjectBudget 在预算内原子地预留项目额度，预算不足时返回 ErrProjectBudgetExceeded，
+// 并发请求不会同时通过检查而超出预算
+func ReserveProjectBudget(projectId int, quota int) error {
+	if projectId == 0 || quota <= 0 {
+		return nil
+	}
+	result := DB.Model(&Project{}).
+		Where("id = ? AND (budget <= 0 OR used_quota + ? <= budget)", projectId, quota).
+		Update("used_quota", gorm.Expr("used_quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProjectBudgetExceeded
+	}
+	return nil
+}
+
+// ConsumeProjectBudget 结算时累加项目已用额度，超出剩余预算的部分不计入，返回实际计入的额度
+func ConsumeProjectBudget(projectId int, quota int) (int, error) {
+	if projectId == 0 || quota <= 0 {
+		return quota, nil
+	}
+	for i := 0; i < 3; i++ {
+		project, err := GetProjectById(projectId)
+		if err != nil {
+			return 0, err
+		}
+		charge := quota
+		if project.Budget > 0 {
+			charge = min(quota, max(project.Budget-project.UsedQuota, 0))
+		}
+		if charge == 0 {
+			return 0, nil
+		}
+		// 以读取时的已用额度为条件更新，被并发修改时重新读取
+		result := DB.Model(&Project{}).Where("id = ? AND used_quota = ?", projectId, project.UsedQuota).
+			Update("used_quota", gorm.Expr("used_quota + ?", charge))
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return charge, nil
+		}
+	}
+	return 0, errors.New("项目已用额度更新冲突，请稍后重试")
+}
+
+func CountProjectTokens(projectId int) (int64, error) {
+	var count int64
+	err := DB.Model(&Token{}).Where("project_id = ?", projectId).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/pkg/cachex"
+	"github.com/samber/hot"
+)
+
+// 项目令牌每次请求都要校验项目、组织与成员状态，这里缓存这三类查询；
+// 项目已用额度以缓存为准可能略有滞后，扣费时会重新读取数据库校验项目预算
+
+const (
+	organizationCacheNamespace       = "new-api:organization:v1"
+	organizationMemberCacheNamespace = "new-api:organization_member:v1"
+	projectCacheNamespace            = "new-api:project:v1"
+)
+
+var (
+	organizationCacheOnce       sync.Once
+	organizationMemberCacheOnce sync.Once
+	projectCacheOnce            sync.Once
+
+	organizationCache       *cachex.HybridCache[Organization]
+	organizationMemberCache *cachex.HybridCache[OrganizationMember]
+	projectCache            *cachex.HybridCache[Project]
+)
+
+func organizationCacheTTL() time.Duration {
+	ttlSeconds := common.GetEnvOrDefault("ORGANIZATION_CACHE_TTL", 60)
+	if ttlSeconds <= 0 {
+		ttlSeconds = 60
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+func organizationCacheCapacity() int {
+	capacity := common.GetEnvOrDefault("ORGANIZATION_CACHE_CAP", 10000)
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return capacity
+}
+
+func newOrganizationHybridCache[V any](namespace string) *cachex.HybridCache[V] {
+	ttl := organizationCacheTTL()
+	return cachex.NewHybridCache[V](cachex.HybridCacheConfig[V]{
+		Namespace: cachex.Namespace(namespace),
+		Redis:     common.RDB,
+		RedisEnabled: func() bool {
+			return common.RedisEnabled && common.RDB != nil
+		},
+		RedisCodec: cachex.JSONCodec[V]{},
+		Memory: func() *hot.HotCache[string, V] {
+			return hot.NewHotCache[string, V](hot.LRU, organizationCacheCapacity()).
+				WithTTL(ttl).
+				WithJanitor().
+				Build()
+		},
+	})
+}
+
+func getOrganizationCache() *cachex.HybridCache[Organization] {
+	organizationCacheOnce.Do(func() {
+		organizationCache = newOrganizationHybridCache[Organization](organizationCacheNamespace)
+	})
+	return organizationCache
+}
+
+func getOrganizationMemberCache() *cachex.HybridCache[OrganizationMember] {
+	organizationMemberCacheOnce.Do(func() {
+		organizationMemberCache = newOrganizationHybridCache[OrganizationMember](organizationMemberCacheNamespace)
+	})
+	return organizationMemberCache
+}
+
+func getProjectCache() *cachex.HybridCache[Project] {
+	projectCacheOnce.Do(func() {
+		projectCache = newOrganizationHybridCache[Project](projectCacheNamespace)
+	})
+	return projectCache
+}
+
+func organizationMemberCacheKey(orgId int, userId int) string {
+	return fmt.Sprintf("%d:%d", orgId, userId)
+}
+
+// CacheGetOrganizationById 优先从缓存读取组织
+func CacheGetOrganizationById(id int) (*Organization, error) {
+	key := strconv.Itoa(id)
+	if cached, found, err := getOrganizationCache().Get(key); err == nil && found {
+		return &cached, nil
+	}
+	org, err := GetOrganizationById(id)
+	if err != nil {
+		return nil, err
+	}
+	_ = getOrganizationCache().SetWithTTL(key, *org, organizationCacheTTL())
+	return org, nil
+}
+
+// CacheGetOrganizationMember 优先从缓存读取组织成员
+func CacheGetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	key := organizationMemberCacheKey(orgId, userId)
+	if cached, found, err := getOrganizationMemberCache().Get(key); err == nil && found {
+		return &cached, nil
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	_ = getOrganizationMemberCache().SetWithTTL(key, *member, organizationCacheTTL())
+	return member, nil
+}
+
+// CacheGetProjectById 优先从缓存读取项目
+func CacheGetProjectById(id int) (*Project, error) {
+	key := strconv.Itoa(id)
+	if cached, found, err := getProjectCache().Get(key); err == nil && found {
+		return &cached, nil
+	}
+	project, err := GetProjectById(id)
+	if err != nil {
+		return nil, err
+	}
+	_ = getProjectCache().SetWithTTL(key, *project, organizationCacheTTL())
+	return project, nil
+}
+
+func invalidateOrganizationCache(id int) {
+	_, _ = getOrganizationCache().DeleteMany([]string{strconv.Itoa(id)})
+}
+
+func invalidateOrganizationMemberCache(orgId int, userId int) {
+	_, _ = getOrganizationMemberCache().DeleteMany([]string{organizationMemberCacheKey(orgId, userId)})
+}
+
+func invalidateProjectCache(id int) {
+	_, _ = getProjectCache().DeleteMany([]string{strconv.Itoa(id)})
+}
@@ -0,0 +1,178 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func createTestOrganization(t *testing.T, quota int, budget int) (*Organization, *Project) {
+	t.Helper()
+	org := &Organization{Name: "org", Quota: quota, Status: 1}
+	if err := DB.Create(org).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	project := &Project{OrgId: org.Id, Name: "project", Budget: budget, Status: 1}
+	if err := DB.Create(project).Error; err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	return org, project
+}
+
+func getTestOrganization(t *testing.T, id int) *Organization {
+	t.Helper()
+	org, err := GetOrganizationById(id)
+	if err != nil {
+		t.Fatalf("GetOrganizationById: %v", err)
+	}
+	return org
+}
+
+func getTestProjectUsedQuota(t *testing.T, id int) int {
+	t.Helper()
+	project, err := GetProjectById(id)
+	if err != nil {
+		t.Fatalf("GetProjectById: %v", err)
+	}
+	return project.UsedQuota
+}
+
+func TestConsumeAndRefundOrganizationQuota(t *testing.T) {
+	resetTables(t, &Organization{}, &Project{}, &QuotaLedger{})
+	org, _ := createTestOrganization(t, 1000, 0)
+
+	if err := ConsumeOrganizationQuota(org.Id, 300, LedgerRef{Source: LedgerSourceConsume, ReferenceId: "req-1"}); err != nil {
+		t.Fatalf("ConsumeOrganizationQuota: %v", err)
+	}
+	if err := RefundOrganizationQuota(org.Id, 100, LedgerRef{Source: LedgerSourceRefund, ReferenceId: "req-1"}); err != nil {
+		t.Fatalf("RefundOrganizationQuota: %v", err)
+	}
+	if got := getTestOrganization(t, org.Id); got.Quota != 800 || got.UsedQuota != 200 {
+		t.Fatalf("unexpected organization quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+	if err := ConsumeOrganizationQuota(org.Id, -1); err == nil {
+		t.Fatal("expected negative quota to be rejected")
+	}
+
+	// 每次变动都记录组织账户的分录及变动后余额
+	var ledgers []QuotaLedger
+	if err := DB.Where("account_type = ? AND account_id = ?", LedgerAccountOrganization, org.Id).Order("id").Find(&ledgers).Error; err != nil {
+		t.Fatalf("failed to load ledger: %v", err)
+	}
+	if len(ledgers) != 2 || ledgers[0].Amount != -300 || ledgers[1].Amount != 100 {
+		t.Fatalf("unexpected ledger %+v", ledgers)
+	}
+	if ledgers[1].Source != LedgerSourceRefund || ledgers[1].BalanceAfter == nil || *ledgers[1].BalanceAfter != 800 {
+		t.Fatalf("unexpected refund ledger %+v", ledgers[1])
+	}
+}
+
+func TestTransferUserQuotaToOrganization(t *testing.T) {
+	resetTables(t, &Organization{}, &Project{}, &QuotaLedger{})
+	org, _ := createTestOrganization(t, 0, 0)
+	user := createLedgerTestUser(t, 500)
+
+	if err := TransferUserQuotaToOrganization(user.Id, org.Id, 600); err == nil {
+		t.Fatal("expected transfer exceeding user quota to fail")
+	}
+	if err := TransferUserQuotaToOrganization(user.Id, org.Id, 200); err != nil {
+		t.Fatalf("TransferUserQuotaToOrganization: %v", err)
+	}
+	if got := getTestOrganization(t, org.Id); got.Quota != 200 || got.UsedQuota != 0 {
+		t.Fatalf("unexpected organization quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+	if quota, _ := GetUserQuota(user.Id, true); quota != 300 {
+		t.Fatalf("expected user quota 300, got %d", quota)
+	}
+}
+
+func TestReserveProjectBudget(t *testing.T) {
+	resetTables(t, &Organization{}, &Project{})
+	_, project := createTestOrganization(t, 1000, 100)
+
+	if err := ReserveProjectBudget(project.Id, 60); err != nil {
+		t.Fatalf("ReserveProjectBudget: %v", err)
+	}
+	// 超出剩余预算的预留被拒绝且不改变已用额度
+	if err := ReserveProjectBudget(project.Id, 50); !errors.Is(err, ErrProjectBudgetExceeded) {
+		t.Fatalf("ReserveProjectBudget err = %v, want ErrProjectBudgetExceeded", err)
+	}
+	if err := ReserveProjectBudget(project.Id, 40); err != nil {
+		t.Fatalf("ReserveProjectBudget up to budget: %v", err)
+	}
+	if used := getTestProjectUsedQuota(t, project.Id); used != 100 {
+		t.Fatalf("expected used quota 100, got %d", used)
+	}
+
+	// 预算为 0 表示不限制
+	_, unlimited := createTestOrganization(t, 1000, 0)
+	if err := ReserveProjectBudget(unlimited.Id, 5000); err != nil {
+		t.Fatalf("ReserveProjectBudget unlimited: %v", err)
+	}
+	if used := getTestProjectUsedQuota(t, unlimited.Id); used != 5000 {
+		t.Fatalf("expected used quota 5000, got %d", used)
+	}
+}
+
+func TestConsumeProjectBudget(t *testing.T) {
+	resetTables(t, &Organization{}, &Project{})
+	_, project := createTestOrganization(t, 1000, 100)
+
+	if charged, err := ConsumeProjectBudget(project.Id, 70); err != nil || charged != 70 {
+		t.Fatalf("ConsumeProjectBudget = %d, %v, want 70", charged, err)
+	}
+	// 结算补扣超出预算时只计入剩余部分
+	if charged, err := ConsumeProjectBudget(project.Id, 50); err != nil || charged != 30 {
+		t.Fatalf("ConsumeProjectBudget = %d, %v, want 30", charged, err)
+	}
+	if charged, err := ConsumeProjectBudget(project.Id, 10); err != nil || charged != 0 {
+		t.Fatalf("ConsumeProjectBudget = %d, %v, want 0", charged, err)
+	}
+	if used := getTestProjectUsedQuota(t, project.Id); used != 100 {
+		t.Fatalf("expected used quota 100, got %d", used)
+	}
+
+	_, unlimited := createTestOrganization(t, 1000, 0)
+	if charged, err := ConsumeProjectBudget(unlimited.Id, 5000); err != nil || charged != 5000 {
+		t.Fatalf("ConsumeProjectBudget unlimited = %d, %v, want 5000", charged, err)
+	}
+}
+
+func TestMidjourneyRefundQuota(t *testing.T) {
+	resetTables(t, &Organization{}, &Project{}, &QuotaLedger{})
+	org, project := createTestOrganization(t, 1000, 0)
+	if err := ConsumeOrganizationQuota(org.Id, 300); err != nil {
+		t.Fatalf("ConsumeOrganizationQuota: %v", err)
+	}
+	if err := UpdateProjectUsedQuota(project.Id, 300); err != nil {
+		t.Fatalf("UpdateProjectUsedQuota: %v", err)
+	}
+	user := createLedgerTestUser(t, 0)
+
+	// 组织项目提交的任务退还到组织钱包和项目，不进入个人钱包
+	orgTask := &Midjourney{UserId: user.Id, OrgId: org.Id, ProjectId: project.Id, MjId: "mj-refund-org"}
+	if err := orgTask.RefundQuota(300); err != nil {
+		t.Fatalf("RefundQuota: %v", err)
+	}
+	if got := getTestOrganization(t, org.Id); got.Quota != 1000 || got.UsedQuota != 0 {
+		t.Fatalf("unexpected organization quota=%d used=%d", got.Quota, got.UsedQuota)
+	}
+	if used := getTestProjectUsedQuota(t, project.Id); used != 0 {
+		t.Fatalf("expected project used quota 0, got %d", used)
+	}
+	if quota, _ := GetUserQuota(user.Id, true); quota != 0 {
+		t.Fatalf("expected user quota untouched, got %d", quota)
+	}
+
+	userTask := &Midjourney{UserId: user.Id, MjId: "mj-refund-user"}
+	if err := userTask.RefundQuota(200); err != nil {
+		t.Fatalf("RefundQuota: %v", err)
+	}
+	if quota, _ := GetUserQuota(user.Id, true); quota != 200 {
+		t.Fatalf("expected user quota 200, got %d", quota)
+	}
+	var count int64
+	DB.Model(&QuotaLedger{}).Where("source = ? AND reference_id = ?", LedgerSourceRefund, "mj-refund-org").Count(&count)
+	if count != 1 {
+		t.Fatalf("expected one organization refund ledger, got %d", count)
+	}
+}
@@ -0,0 +1,417 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPaymentOrderNotFound      = errors.New("订单不存在")
+	ErrPaymentOrderNotRefundable = errors.New("订单未支付或已全额退款")
+	ErrRefundExceedsPaid         = errors.New("退款金额超过可退金额")
+)
+
+// 退款来源
+const (
+	PaymentRefundSourceAdmin      = "admin"      // 管理员发起，已调用支付渠道退款
+	PaymentRefundSourceManual     = "manual"     // 管理员仅在本地登记（渠道后台已线下退款）
+	PaymentRefundSourceProvider   = "provider"   // 支付渠道回调通知的退款
+	PaymentRefundSourceChargeback = "chargeback" // 拒付
+)
+
+const (
+	PaymentOrderTypeTopUp        = "topup"
+	PaymentOrderTypeSubscription = "subscription"
+)
+
+// 金额比较容差，金额以两位小数结算
+const refundMoneyEpsilon = 0.005
+
+// PaymentRefund 充值与订阅订单的退款记录，每次退款（含拒付）一条
+type PaymentRefund struct {
+	Id            int     `json:"id"`
+	TradeNo       string  `json:"trade_no" gorm:"type:varchar(255);index;uniqueIndex:idx_payment_refund_provider_refund,priority:1"`
+	OrderType     string  `json:"order_type" gorm:"type:varchar(16)"`
+	UserId        int     `json:"user_id" gorm:"index"`
+	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50)"`
+	Money         float64 `json:"money"`
+	// 实际扣回的额度，以及已被消耗而无法扣回的额度
+	Quota          int `json:"quota"`
+	QuotaShortfall int `json:"quota_shortfall"`
+	// 订阅订单退款时作废的用户订阅
+	UserSubscriptionId int    `json:"user_subscription_id" gorm:"default:0"`
+	Source             string `json:"source" gorm:"type:varchar(16);index"`
+	// 渠道退款单号，与支付单号唯一，并发的重复回调只会登记一次；未提供时为 NULL，不参与唯一约束
+	ProviderRefundId *string `json:"provider_refund_id" gorm:"type:varchar(128);uniqueIndex:idx_payment_refund_provider_refund,priority:2"`
+	Reason           string  `json:"reason" gorm:"type:varchar(255)"`
+	OperatorId       int     `json:"operator_id" gorm:"default:0"`
+	CreatedAt        int64   `json:"created_at" gorm:"bigint;index"`
+}
+
+// PaymentOrderInfo 退款前查询的订单概要，订阅订单优先（订阅订单同时镜像为充值记录）
+type PaymentOrderInfo struct {
+	OrderType          string  `json:"order_type"`
+	TradeNo            string  `json:"trade_no"`
+	UserId             int     `json:"user_id"`
+	PaymentMethod      string  `json:"payment_method"`
+	ProviderOrderId    string  `json:"provider_order_id"`
+	Money              float64 `json:"money"`
+	RefundedMoney      float64 `json:"refunded_money"`
+	Status             string  `json:"status"`
+	UserSubscriptionId int     `json:"user_subscription_id"`
+}
+
+func (o *PaymentOrderInfo) RefundableMoney() float64 {
+	if o.Status != common.TopUpStatusSuccess {
+		return 0
+	}
+	remaining := o.Money - o.RefundedMoney
+	if remaining < refundMoneyEpsilon {
+		return 0
+	}
+	return remaining
+}
+
+func GetPaymentOrderInfo(tradeNo string) (*PaymentOrderInfo, error) {
+	if order := GetSubscriptionOrderByTradeNo(tradeNo); order != nil {
+		return &PaymentOrderInfo{
+			OrderType:          PaymentOrderTypeSubscription,
+			TradeNo:            order.TradeNo,
+			UserId:             order.UserId,
+			PaymentMethod:      order.PaymentMethod,
+			ProviderOrderId:    order.ProviderOrderId,
+			Money:              order.Money,
+			RefundedMoney:      order.RefundedMoney,
+			Status:             order.Status,
+			UserSubscriptionId: order.UserSubscriptionId,
+		}, nil
+	}
+	if topUp := GetTopUpByTradeNo(tradeNo); topUp != nil {
+		return &PaymentOrderInfo{
+			OrderType:       PaymentOrderTypeTopUp,
+			TradeNo:         topUp.TradeNo,
+			UserId:          topUp.UserId,
+			PaymentMethod:   topUp.PaymentMethod,
+			ProviderOrderId: topUp.ProviderOrderId,
+			Money:           topUp.Money,
+			RefundedMoney:   topUp.RefundedMoney,
+			Status:          topUp.Status,
+		}, nil
+	}
+	return nil, ErrPaymentOrderNotFound
+}
+
+// PaymentRefundRequest 登记一次退款
+type PaymentRefundRequest struct {
+	TradeNo string
+	// 本次退款金额，<= 0 表示退还全部剩余金额
+	Money float64
+	// 渠道回调中的累计退款金额，> 0 时本次退款金额为其与已退金额之差，重复回调自然幂等
+	TotalRefunded float64
+	// 渠道按比例给出退款时使用：退款回调为累计退款比例，拒付为本次拒付比例，按订单金额换算
+	RefundRatio      float64
+	Source           string
+	ProviderRefundId string
+	Reason           string
+	OperatorId       int
+}
+
+// fromProvider 渠道回调的退款以渠道为准，超出部分截断而不是报错，避免渠道反复重试
+func (req *PaymentRefundRequest) fromProvider() bool {
+	return req.Source == PaymentRefundSourceProvider || req.Source == PaymentRefundSourceChargeback
+}
+
+// refundMoney 计算本次退款金额，返回 0 表示无需处理
+func (req *PaymentRefundRequest) refundMoney(status string, paid float64, refunded float64) (float64, error) {
+	if status != common.TopUpStatusSuccess {
+		if req.fromProvider() && status == common.TopUpStatusRefunded {
+			return 0, nil
+		}
+		return 0, ErrPaymentOrderNotRefundable
+	}
+	remaining := paid - refunded
+	totalRefunded, requested := req.TotalRefunded, req.Money
+	if req.RefundRatio > 0 {
+		if req.Source == PaymentRefundSourceChargeback {
+			requested = paid * req.RefundRatio
+		} else {
+			totalRefunded = paid * req.RefundRatio
+		}
+	}
+	var money float64
+	switch {
+	case totalRefunded > 0:
+		money = totalRefunded - refunded
+		if money < refundMoneyEpsilon {
+			return 0, nil
+		}
+	case requested <= 0:
+		money = remaining
+	default:
+		money = requested
+	}
+	if money > remaining+refundMoneyEpsilon {
+		if !req.fromProvider() {
+			return 0, ErrRefundExceedsPaid
+		}
+		money = remaining
+	}
+	if money < refundMoneyEpsilon {
+		if req.fromProvider() {
+			return 0, nil
+		}
+		return 0, ErrPaymentOrderNotRefundable
+	}
+	return money, nil
+}
+
+// RecordPaymentRefund 登记退款并扣回额度：
+// - 充值订单按退款比例扣回入账额度，余额不足时只扣到 0，差额记为无法扣回
+// - 订阅订单全额退款或拒付时立即作废对应的用户订阅
+// 支付渠道侧的退款需由调用方先完成。返回 nil 表示本次无需处理（如重复回调）。
+func RecordPaymentRefund(req PaymentRefundRequest) (*PaymentRefund, error) {
+	if req.TradeNo == "" {
+		return nil, errors.New("未提供支付单号")
+	}
+	if req.ProviderRefundId != "" {
+		var count int64
+		if err := DB.Model(&PaymentRefund{}).Where("trade_no = ? AND provider_refund_id = ?", req.TradeNo, req.ProviderRefundId).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, nil
+		}
+	}
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+
+	var refund *PaymentRefund
+	var fullyRefunded bool
+	var cacheGroup string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		refund = nil
+		var order SubscriptionOrder
+		query := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", req.TradeNo).Limit(1).Find(&order)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected > 0 {
+			var err error
+			refund, fullyRefunded, cacheGroup, err = refundSubscriptionOrderTx(tx, &order, &req)
+			return err
+		}
+		var topUp TopUp
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", req.TradeNo).First(&topUp).Error; err != nil {
+			return ErrPaymentOrderNotFound
+		}
+		var err error
+		refund, fullyRefunded, err = refundTopUpTx(tx, &topUp, &req)
+		return err
+	})
+	if err != nil {
+		if isPaymentRefundDuplicate(&req, err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if refund == nil {
+		return nil, nil
+	}
+	if refund.Quota > 0 {
+		_ = cacheDecrUserQuota(refund.UserId, int64(refund.Quota))
+	}
+	if cacheGroup != "" {
+		_ = UpdateUserGroupCache(refund.UserId, cacheGroup)
+	}
+
+	action := "退款"
+	if refund.Source == PaymentRefundSourceChargeback {
+		action = "拒付"
+	}
+	msg := fmt.Sprintf("订单 %s %s %.2f，支付方式: %s", refund.TradeNo, action, refund.Money, refund.PaymentMethod)
+	if refund.OrderType == PaymentOrderTypeTopUp {
+		msg += fmt.Sprintf("，扣回额度: %s", logger.FormatQuota(refund.Quota))
+		if refund.QuotaShortfall > 0 {
+			msg += fmt.Sprintf("，已消耗无法扣回: %s", logger.FormatQuota(refund.QuotaShortfall))
+		}
+	} else if refund.UserSubscriptionId > 0 && (fullyRefunded || refund.Source == PaymentRefundSourceChargeback) {
+		msg += fmt.Sprintf("，订阅 #%d 已作废", refund.UserSubscriptionId)
+	}
+	if refund.Reason != "" {
+		msg += "，原因: " + refund.Reason
+	}
+	RecordLog(refund.UserId, LogTypeRefund, msg)
+	return refund, nil
+}
+
+func newPaymentRefund(req *PaymentRefundRequest, orderType string, userId int, paymentMethod string, money float64) *PaymentRefund {
+	refund := &PaymentRefund{
+		TradeNo:       req.TradeNo,
+		OrderType:     orderType,
+		UserId:        userId,
+		PaymentMethod: paymentMethod,
+		Money:         money,
+		Source:        req.Source,
+		Reason:        req.Reason,
+		OperatorId:    req.OperatorId,
+		CreatedAt:     common.GetTimestamp(),
+	}
+	if req.ProviderRefundId != "" {
+		providerRefundId := req.ProviderRefundId
+		refund.ProviderRefundId = &providerRefundId
+	}
+	return refund
+}
+
+// isPaymentRefundDuplicate 并发的重复回调在唯一索引上冲突，视为已登记
+func isPaymentRefundDuplicate(req *PaymentRefundRequest, err error) bool {
+	if req.ProviderRefundId == "" || err == nil {
+		return false
+	}
+	var count int64
+	if DB.Model(&PaymentRefund{}).Where("trade_no = ? AND provider_refund_id = ?", req.TradeNo, req.ProviderRefundId).Count(&count).Error != nil {
+		return false
+	}
+	return count > 0
+}
+
+// migratePaymentRefundProviderId 旧版本未提供渠道退款单号时存为空串，建唯一索引前改为 NULL
+func migratePaymentRefundProviderId() {
+	if !DB.Migrator().HasTable(&PaymentRefund{}) || DB.Migrator().HasIndex(&PaymentRefund{}, "idx_payment_refund_provider_refund") {
+		return
+	}
+	if err := DB.Model(&PaymentRefund{}).Where("provider_refund_id = ?", "").Update("provider_refund_id", nil).Error; err != nil {
+		common.SysError("failed to migrate payment refund provider ids: " + err.Error())
+	}
+}
+
+func refundTopUpTx(tx *gorm.DB, topUp *TopUp, req *PaymentRefundRequest) (*PaymentRefund, bool, error) {
+	money, err := req.refundMoney(topUp.Status, topUp.Money, topUp.RefundedMoney)
+	if err != nil || money == 0 {
+		return nil, false, err
+	}
+	refund := newPaymentRefund(req, PaymentOrderTypeTopUp, topUp.UserId, topUp.PaymentMethod, money)
+
+	// 按退款比例扣回入账额度，已消耗的部分无法扣回
+	target := 0
+	if topUp.Money > 0 {
+		target = int(decimal.NewFromInt(int64(topUpCreditQuota(topUp))).
+			Mul(decimal.NewFromFloat(money)).
+			Div(decimal.NewFromFloat(topUp.Money)).IntPart())
+	}
+	var balance int
+	if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Select("quota").Scan(&balance).Error; err != nil {
+		return nil, false, err
+	}
+	claw := target
+	if claw > balance {
+		claw = balance
+	}
+	if claw < 0 {
+		claw = 0
+	}
+	refund.Quota = claw
+	refund.QuotaShortfall = target - claw
+	if claw > 0 {
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", claw)).Error; err != nil {
+			return nil, false, err
+		}
+	}
+
+	topUp.RefundedMoney += money
+	fullyRefunded := topUp.Money-topUp.RefundedMoney < refundMoneyEpsilon
+	if fullyRefunded {
+		topUp.Status = common.TopUpStatusRefunded
+	}
+	if err := tx.Save(topUp).Error; err != nil {
+		return nil, false, err
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, false, err
+	}
+	if err := RecordUserLedger(tx, topUp.UserId, -claw, LedgerRef{
+		Source:         LedgerSourceTopUpRefund,
+		ReferenceId:    topUp.TradeNo,
+		IdempotencyKey: fmt.Sprintf("topup_refund:%d", refund.Id),
+		Remark:         refund.Source,
+	}); err != nil {
+		return nil, false, err
+	}
+	return refund, fullyRefunded, nil
+}
+
+func refundSubscriptionOrderTx(tx *gorm.DB, order *SubscriptionOrder, req *PaymentRefundRequest) (*PaymentRefund, bool, string, error) {
+	money, err := req.refundMoney(order.Status, order.Money, order.RefundedMoney)
+	if err != nil || money == 0 {
+		return nil, false, "", err
+	}
+	refund := newPaymentRefund(req, PaymentOrderTypeSubscription, order.UserId, order.PaymentMethod, money)
+	refund.UserSubscriptionId = order.UserSubscriptionId
+
+	order.RefundedMoney += money
+	fullyRefunded := order.Money-order.RefundedMoney < refundMoneyEpsilon
+	if fullyRefunded {
+		order.Status = common.TopUpStatusRefunded
+	}
+	if err := tx.Save(order).Error; err != nil {
+		return nil, false, "", err
+	}
+	// 同步订阅订单镜像的充值记录
+	if err := tx.Model(&TopUp{}).Where("trade_no = ?", order.TradeNo).Updates(map[string]interface{}{
+		"refunded_money": order.RefundedMoney,
+		"status":         order.Status,
+	}).Error; err != nil {
+		return nil, false, "", err
+	}
+
+	cacheGroup := ""
+	if order.UserSubscriptionId > 0 && (fullyRefunded || req.Source == PaymentRefundSourceChargeback) {
+		var sub UserSubscription
+		query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", order.UserSubscriptionId).Limit(1).Find(&sub)
+		if query.Error != nil {
+			return nil, false, "", query.Error
+		}
+		if query.RowsAffected > 0 && sub.Status != "cancelled" {
+			now := common.GetTimestamp()
+			if err := tx.Model(&sub).Updates(map[string]interface{}{
+				"status":               "cancelled",
+				"end_time":             now,
+				"auto_renew":           false,
+				"cancel_at_period_end": true,
+				"grace_end_time":       0,
+			}).Error; err != nil {
+				return nil, false, "", err
+			}
+			cacheGroup, err = downgradeUserGroupForSubscriptionTx(tx, &sub, now)
+			if err != nil {
+				return nil, false, "", err
+			}
+		}
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, false, "", err
+	}
+	return refund, fullyRefunded, cacheGroup, nil
+}
+
+func GetPaymentRefunds(tradeNo string, userId int, pageInfo *common.PageInfo) (refunds []*PaymentRefund, total int64, err error) {
+	tx := DB.Model(&PaymentRefund{})
+	if tradeNo != "" {
+		tx = tx.Where("trade_no = ?", tradeNo)
+	}
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&refunds).Error
+	return refunds, total, err
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"gorm.io/gorm"
+)
+
+func TestRefundMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      PaymentRefundRequest
+		status   string
+		paid     float64
+		refunded float64
+		want     float64
+		wantErr  error
+	}{
+		{name: "admin full refund", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin}, status: common.TopUpStatusSuccess, paid: 10, want: 10},
+		{name: "admin remaining after partial", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 6},
+		{name: "admin partial", req: PaymentRefundRequest{Source: PaymentRefundSourceManual, Money: 3}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 3},
+		{name: "admin exceeds remaining", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin, Money: 7}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, wantErr: ErrRefundExceedsPaid},
+		{name: "admin within epsilon", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin, Money: 6.004}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 6.004},
+		{name: "admin pending order", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin}, status: common.TopUpStatusPending, paid: 10, wantErr: ErrPaymentOrderNotRefundable},
+		{name: "admin already refunded", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin}, status: common.TopUpStatusRefunded, paid: 10, refunded: 10, wantErr: ErrPaymentOrderNotRefundable},
+		{name: "admin nothing left", req: PaymentRefundRequest{Source: PaymentRefundSourceAdmin}, status: common.TopUpStatusSuccess, paid: 10, refunded: 9.998, wantErr: ErrPaymentOrderNotRefundable},
+		{name: "provider cumulative total", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, TotalRefunded: 7}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 3},
+		{name: "provider repeated total", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, TotalRefunded: 4}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 0},
+		{name: "provider total capped", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, TotalRefunded: 12}, status: common.TopUpStatusSuccess, paid: 10, refunded: 4, want: 6},
+		{name: "provider cumulative ratio", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, RefundRatio: 0.5}, status: common.TopUpStatusSuccess, paid: 10, refunded: 2, want: 3},
+		{name: "provider already refunded order", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, TotalRefunded: 10}, status: common.TopUpStatusRefunded, paid: 10, refunded: 10, want: 0},
+		{name: "provider pending order", req: PaymentRefundRequest{Source: PaymentRefundSourceProvider, TotalRefunded: 10}, status: common.TopUpStatusPending, paid: 10, wantErr: ErrPaymentOrderNotRefundable},
+		{name: "chargeback ratio is per dispute", req: PaymentRefundRequest{Source: PaymentRefundSourceChargeback, RefundRatio: 0.5}, status: common.TopUpStatusSuccess, paid: 10, refunded: 2, want: 5},
+		{name: "chargeback capped", req: PaymentRefundRequest{Source: PaymentRefundSourceChargeback, RefundRatio: 1}, status: common.TopUpStatusSuccess, paid: 10, refunded: 2, want: 8},
+		{name: "chargeback nothing left", req: PaymentRefundRequest{Source: PaymentRefundSourceChargeback}, status: common.TopUpStatusSuccess, paid: 10, refunded: 10, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.refundMoney(tt.status, tt.paid, tt.refunded)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("money = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentRefundProviderRefundIdUnique(t *testing.T) {
+	resetTables(t, &PaymentRefund{})
+	providerRefundId := "re_unique"
+	first := &PaymentRefund{TradeNo: "refund_unique", Source: PaymentRefundSourceProvider, ProviderRefundId: &providerRefundId}
+	if err := DB.Create(first).Error; err != nil {
+		t.Fatalf("failed to create refund: %v", err)
+	}
+	duplicate := &PaymentRefund{TradeNo: "refund_unique", Source: PaymentRefundSourceProvider, ProviderRefundId: &providerRefundId}
+	if err := DB.Create(duplicate).Error; err == nil {
+		t.Fatal("expected duplicate provider refund id to be rejected")
+	}
+	otherTrade := &PaymentRefund{TradeNo: "refund_unique_other", Source: PaymentRefundSourceProvider, ProviderRefundId: &providerRefundId}
+	if err := DB.Create(otherTrade).Error; err != nil {
+		t.Fatalf("expected the same refund id on another order to be allowed: %v", err)
+	}
+	// 未提供渠道退款单号的多次退款不受唯一约束限制
+	for i := 0; i < 2; i++ {
+		if err := DB.Create(&PaymentRefund{TradeNo: "refund_unique", Source: PaymentRefundSourceAdmin}).Error; err != nil {
+			t.Fatalf("expected refunds without provider id to be allowed: %v", err)
+		}
+	}
+}
+
+func TestRecordPaymentRefundConcurrentDuplicate(t *testing.T) {
+	resetTables(t, &PaymentRefund{})
+	user := createLedgerTestUser(t, 0)
+	topUp := &TopUp{
+		UserId:        user.Id,
+		Amount:        10,
+		Money:         10,
+		TradeNo:       "refund_dup_" + common.GetRandomString(8),
+		PaymentMethod: "stripe",
+		Status:        common.TopUpStatusSuccess,
+	}
+	if err := DB.Create(topUp).Error; err != nil {
+		t.Fatalf("failed to create top up: %v", err)
+	}
+	credited := topUpCreditQuota(topUp)
+	if err := DB.Model(user).Update("quota", credited).Error; err != nil {
+		t.Fatalf("failed to set quota: %v", err)
+	}
+
+	req := PaymentRefundRequest{TradeNo: topUp.TradeNo, TotalRefunded: 5, Source: PaymentRefundSourceProvider, ProviderRefundId: "re_dup"}
+	refund, err := RecordPaymentRefund(req)
+	if err != nil || refund == nil {
+		t.Fatalf("failed to record refund: %v", err)
+	}
+	if refund.ProviderRefundId == nil || *refund.ProviderRefundId != "re_dup" {
+		t.Fatalf("unexpected provider refund id %v", refund.ProviderRefundId)
+	}
+
+	// 并发回调越过了预检查，在唯一索引上冲突，整个事务回滚
+	var stored TopUp
+	if err := DB.First(&stored, topUp.Id).Error; err != nil {
+		t.Fatalf("failed to reload top up: %v", err)
+	}
+	stored.RefundedMoney = 0
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		_, _, err := refundTopUpTx(tx, &stored, &req)
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected duplicate refund insert to fail")
+	}
+	if !isPaymentRefundDuplicate(&req, err) {
+		t.Fatalf("expected conflict to be recognized as duplicate: %v", err)
+	}
+	var quota int
+	DB.Model(&User{}).Where("id = ?", user.Id).Select("quota").Scan(&quota)
+	if want := credited - refund.Quota; quota != want {
+		t.Fatalf("quota = %d, want %d", quota, want)
+	}
+	var count int64
+	DB.Model(&PaymentRefund{}).Where("trade_no = ?", topUp.TradeNo).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected a single refund record, got %d", count)
+	}
+}
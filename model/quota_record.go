@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/Zer0Echo/uniapi/common"
@@ -158,6 +159,13 @@ func expireSingleRecord(record *QuotaRecord) error {
 		if err != nil {
 			return err
 		}
+		err = RecordUserLedger(tx, fresh.UserId, -expiredAmount, LedgerRef{
+			Source:      LedgerSourceExpiry,
+			ReferenceId: strconv.Itoa(fresh.Id),
+		})
+		if err != nil {
+			return err
+		}
 
 		// Mark record as expired
 		err = tx.Model(&fresh).Updates(map[string]interface{}{
@@ -219,6 +227,10 @@ func ExpireQuotaRecordsForUser(tx *gorm.DB, userId int) (expiredAmount int, err
 		if err != nil {
 			return expiredAmount, err
 		}
+		err = RecordUserLedger(tx, userId, -expiredAmount, LedgerRef{Source: LedgerSourceExpiry})
+		if err != nil {
+			return expiredAmount, err
+		}
 		RecordLog(userId, LogTypeSystem,
 			fmt.Sprintf("兑换码额度过期，扣除 %s", logger.LogQuota(expiredAmount)))
 	}
@@ -313,6 +325,14 @@ func UpdateQuotaRecordAdmin(id int, newRemaining int, newExpiredTime int64) erro
 			if err != nil {
 				return err
 			}
+			err = RecordUserLedger(tx, record.UserId, delta, LedgerRef{
+				Source:      LedgerSourceAdmin,
+				ReferenceId: strconv.Itoa(record.Id),
+				Remark:      "quota record adjustment",
+			})
+			if err != nil {
+				return err
+			}
 			if delta > 0 {
 				cacheIncrUserQuota(record.UserId, int64(delta))
 			} else {
@@ -174,6 +174,14 @@ func Redeem(key string, userId int) (*RedeemResult, error) {
 			if err != nil {
 				return err
 			}
+			err = RecordUserLedger(tx, userId, redemption.Quota, LedgerRef{
+				Source:         LedgerSourceRedemption,
+				ReferenceId:    strconv.Itoa(redemption.Id),
+				IdempotencyKey: "redemption:" + strconv.Itoa(redemption.Id),
+			})
+			if err != nil {
+				return err
+			}
 			// Create QuotaRecord if ValidityPeriod > 0 (expiring balance)
 			if redemption.ValidityPeriod > 0 {
 				quotaRecord := &QuotaRecord{
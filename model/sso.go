@@ -0,0 +1,303 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"gorm.io/gorm"
+)
+
+// SSO 用户通过 SsoId 关联身份提供方中的账号，SAML 登录使用 NameID（或配置的用户名属性），SCIM 使用 userName，二者应保持一致
+
+var ErrSsoUserDeleted = errors.New("该 SSO 账号对应的用户已被删除")
+
+// ScimGroup 由 SCIM 同步的身份提供方组，成员的网关分组按 SAML 组映射计算
+type ScimGroup struct {
+	Id          int    `json:"id"`
+	DisplayName string `json:"display_name" gorm:"type:varchar(128);uniqueIndex"`
+	ExternalId  string `json:"external_id" gorm:"type:varchar(128);index"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+type ScimGroupMember struct {
+	Id      int `json:"id"`
+	GroupId int `json:"group_id" gorm:"uniqueIndex:idx_scim_group_member"`
+	UserId  int `json:"user_id" gorm:"uniqueIndex:idx_scim_group_member;index"`
+}
+
+// GetUserBySsoId 按 SsoId 查找用户，用户已被删除时返回 ErrSsoUserDeleted
+func GetUserBySsoId(ssoId string) (*User, error) {
+	if ssoId == "" {
+		return nil, errors.New("sso id 为空！")
+	}
+	var user User
+	err := DB.Where("sso_id = ?", ssoId).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if DB.Unscoped().Where("sso_id = ?", ssoId).Find(&User{}).RowsAffected > 0 {
+		return nil, ErrSsoUserDeleted
+	}
+	return nil, err
+}
+
+func IsSsoIdAlreadyTaken(ssoId string) bool {
+	return DB.Where("sso_id = ?", ssoId).Find(&User{}).RowsAffected > 0
+}
+
+// GetSsoUsers 分页查询 SSO 用户，ssoId 非空时精确匹配
+func GetSsoUsers(ssoId string, startIdx int, num int) ([]*User, int64, error) {
+	var users []*User
+	var total int64
+	query := DB.Model(&User{}).Where("sso_id <> ''")
+	if ssoId != "" {
+		query = query.Where("sso_id = ?", ssoId)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Omit("password").Order("id asc").Limit(num).Offset(startIdx).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// TruncateSsoField 身份提供方的字段长度不受网关限制，写入前按用户表校验规则截断
+func TruncateSsoField(value string, maxLen int) string {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) <= maxLen {
+		return value
+	}
+	return string([]rune(value)[:maxLen])
+}
+
+// externalUsername 优先使用外部身份源的用户名，超长、含空白或已被占用时使用 <prefix><id>
+func externalUsername(candidate string, prefix string) string {
+	if candidate != "" && len(candidate) <= 20 && !strings.ContainsAny(candidate, " \t\r\n") {
+		if exist, err := CheckUserExistOrDeleted(candidate, ""); err == nil && !exist {
+			return candidate
+		}
+	}
+	return prefix + strconv.Itoa(GetMaxUserId()+1)
+}
+
+// CreateSsoUser 创建 SSO 用户，user.SsoId 必须已设置
+func CreateSsoUser(user *User) error {
+	if user.SsoId == "" {
+		return errors.New("sso id 为空！")
+	}
+	return createExternalUser(user, user.SsoId, "sso_")
+}
+
+// createExternalUser 创建由外部身份源管理的用户，这类用户没有本地密码
+func createExternalUser(user *User, externalName string, prefix string) error {
+	user.Username = externalUsername(externalName, prefix)
+	if user.DisplayName == "" {
+		user.DisplayName = TruncateSsoField(externalName, 20)
+	}
+	if len(user.Email) > 50 {
+		user.Email = ""
+	}
+	user.Role = common.RoleCommonUser
+	if user.Status == 0 {
+		user.Status = common.UserStatusEnabled
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		return user.InsertWithTx(tx, 0)
+	}); err != nil {
+		return err
+	}
+	user.FinalizeOAuthUserCreation(0)
+	return nil
+}
+
+// UpdateSsoUserFields 更新 SSO 同步的用户字段并刷新缓存
+func UpdateSsoUserFields(user *User, updates map[string]any) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := DB.Model(user).Updates(updates).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(user.Id)
+}
+
+func GetScimGroupById(id int) (*ScimGroup, error) {
+	var group ScimGroup
+	if err := DB.First(&group, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func IsScimGroupNameTaken(displayName string, excludeId int) bool {
+	return DB.Where("display_name = ? AND id <> ?", displayName, excludeId).Find(&ScimGroup{}).RowsAffected > 0
+}
+
+// GetScimGroups 按 displayName 过滤分页查询，displayName 为空时不过滤
+func GetScimGroups(displayName string, startIdx int, num int) ([]*ScimGroup, int64, error) {
+	var groups []*ScimGroup
+	var total int64
+	query := DB.Model(&ScimGroup{})
+	if displayName != "" {
+		query = query.Where("display_name = ?", displayName)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("id asc").Limit(num).Offset(startIdx).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (group *ScimGroup) Insert() error {
+	now := common.GetTimestamp()
+	group.CreatedTime = now
+	group.UpdatedTime = now
+	return DB.Create(group).Error
+}
+
+func (group *ScimGroup) Update() error {
+	group.UpdatedTime = common.GetTimestamp()
+	return DB.Model(group).Select("display_name", "external_id", "updated_time").Updates(group).Error
+}
+
+// Delete 删除组及其成员关系，并重新计算原成员的分组
+func (group *ScimGroup) Delete() error {
+	userIds, err := GetScimGroupMemberIds(group.Id)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", group.Id).Delete(&ScimGroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		return err
+	}
+	return SyncScimUserGroups(userIds)
+}
+
+func GetScimGroupMemberIds(groupId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&ScimGroupMember{}).Where("group_id = ?", groupId).Order("user_id asc").Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// GetScimGroupsByUserId 用户所属的 SCIM 组
+func GetScimGroupsByUserId(userId int) ([]*ScimGroup, error) {
+	var groups []*ScimGroup
+	err := DB.Where("id IN (?)", DB.Model(&ScimGroupMember{}).Select("group_id").Where("user_id = ?", userId)).
+		Order("id asc").Find(&groups).Error
+	return groups, err
+}
+
+// AddScimGroupMembers 添加组成员，已存在的成员忽略
+func AddScimGroupMembers(groupId int, userIds []int) error {
+	existing, err := GetScimGroupMemberIds(groupId)
+	if err != nil {
+		return err
+	}
+	exists := make(map[int]bool, len(existing))
+	for _, id := range existing {
+		exists[id] = true
+	}
+	var added []int
+	for _, userId := range userIds {
+		if exists[userId] {
+			continue
+		}
+		exists[userId] = true
+		if err := DB.Create(&ScimGroupMember{GroupId: groupId, UserId: userId}).Error; err != nil {
+			return err
+		}
+		added = append(added, userId)
+	}
+	return SyncScimUserGroups(added)
+}
+
+func RemoveScimGroupMembers(groupId int, userIds []int) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	if err := DB.Where("group_id = ? AND user_id IN ?", groupId, userIds).Delete(&ScimGroupMember{}).Error; err != nil {
+		return err
+	}
+	return SyncScimUserGroups(userIds)
+}
+
+// ReplaceScimGroupMembers 以给定成员替换组的全部成员
+func ReplaceScimGroupMembers(groupId int, userIds []int) error {
+	existing, err := GetScimGroupMemberIds(groupId)
+	if err != nil {
+		return err
+	}
+	keep := make(map[int]bool, len(userIds))
+	for _, id := range userIds {
+		keep[id] = true
+	}
+	var removed []int
+	for _, id := range existing {
+		if !keep[id] {
+			removed = append(removed, id)
+		}
+	}
+	if err := RemoveScimGroupMembers(groupId, removed); err != nil {
+		return err
+	}
+	return AddScimGroupMembers(groupId, userIds)
+}
+
+// RemoveUserFromScimGroups 用户被删除时清理其组成员关系
+func RemoveUserFromScimGroups(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&ScimGroupMember{}).Error
+}
+
+// SyncScimUserGroups 按用户所属的 SCIM 组重新计算网关分组，没有匹配的映射时保持不变
+func SyncScimUserGroups(userIds []int) error {
+	for _, userId := range userIds {
+		groups, err := GetScimGroupsByUserId(userId)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(groups))
+		for _, group := range groups {
+			names = append(names, group.DisplayName)
+		}
+		if err := SyncSsoUserGroup(userId, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncSsoUserGroup 按身份提供方的组设置用户分组
+func SyncSsoUserGroup(userId int, idpGroups []string) error {
+	group := system_setting.ResolveSSOGroup(idpGroups)
+	if group == "" {
+		return nil
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Group == group {
+		return nil
+	}
+	return UpdateSsoUserFields(user, map[string]any{"group": group})
+}
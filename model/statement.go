@@ -0,0 +1,339 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"gorm.io/gorm/clause"
+)
+
+// StatementPeriodLayout 账单周期格式，按自然月出账
+const StatementPeriodLayout = "2006-01"
+
+// Statement 用户某个自然月的账单，汇总消费、充值与订阅购买，可重复生成
+type Statement struct {
+	Id                int     `json:"id"`
+	UserId            int     `json:"user_id" gorm:"uniqueIndex:idx_statement_user_period,priority:1"`
+	Period            string  `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_statement_user_period,priority:2;index"`
+	StartTime         int64   `json:"start_time" gorm:"bigint"`
+	EndTime           int64   `json:"end_time" gorm:"bigint"`
+	RequestCount      int     `json:"request_count"`
+	TokensUsed        int     `json:"tokens_used"`
+	ConsumedQuota     int     `json:"consumed_quota"`
+	OrganizationQuota int     `json:"organization_quota"` // 其中由组织钱包支付的额度
+	TopUpQuota        int     `json:"topup_quota"`
+	TopUpMoney        float64 `json:"topup_money"`
+	SubscriptionMoney float64 `json:"subscription_money"`
+	// 生成时的开票信息快照，来自用户设置
+	Company   string `json:"company" gorm:"type:varchar(255)"`
+	TaxId     string `json:"tax_id" gorm:"type:varchar(64)"`
+	Address   string `json:"address" gorm:"type:varchar(255)"`
+	Detail    string `json:"-" gorm:"type:text"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// StatementUsageLine 按模型、令牌或项目汇总的消费
+type StatementUsageLine struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Tokens   int    `json:"tokens"`
+	Quota    int    `json:"quota"`
+}
+
+// StatementPaymentLine 账单周期内完成的充值或订阅订单
+type StatementPaymentLine struct {
+	TradeNo       string  `json:"trade_no"`
+	Title         string  `json:"title"`
+	PaymentMethod string  `json:"payment_method"`
+	Money         float64 `json:"money"`
+	Quota         int     `json:"quota"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+type StatementDetail struct {
+	Models        []StatementUsageLine   `json:"models"`
+	Tokens        []StatementUsageLine   `json:"tokens"`
+	Projects      []StatementUsageLine   `json:"projects"`
+	TopUps        []StatementPaymentLine `json:"topups"`
+	Subscriptions []StatementPaymentLine `json:"subscriptions"`
+}
+
+func (s *Statement) GetDetail() StatementDetail {
+	var detail StatementDetail
+	if s.Detail != "" {
+		if err := json.Unmarshal([]byte(s.Detail), &detail); err != nil {
+			common.SysLog(fmt.Sprintf("failed to unmarshal statement detail (id=%d): %s", s.Id, err.Error()))
+		}
+	}
+	return detail
+}
+
+// ParseStatementPeriod 解析账单周期，返回该月起止时间戳（闭区间）
+func ParseStatementPeriod(period string) (start int64, end int64, err error) {
+	t, err := time.ParseInLocation(StatementPeriodLayout, period, time.Local)
+	if err != nil {
+		return 0, 0, errors.New("账单周期格式应为 YYYY-MM")
+	}
+	return t.Unix(), t.AddDate(0, 1, 0).Unix() - 1, nil
+}
+
+// PreviousStatementPeriod 返回 now 所在月份的上一个账单周期
+func PreviousStatementPeriod(now time.Time) string {
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return firstOfMonth.AddDate(0, -1, 0).Format(StatementPeriodLayout)
+}
+
+func aggregateStatementLogs(userId int, start int64, end int64, groupColumn string) ([]StatementUsageLine, error) {
+	var lines []StatementUsageLine
+	err := LOG_DB.Model(&Log{}).
+		Select(groupColumn+" AS name, COUNT(*) AS requests, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS tokens, COALESCE(SUM(quota), 0) AS quota").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at <= ?", userId, LogTypeConsume, start, end).
+		Group(groupColumn).Order("quota desc").
+		Scan(&lines).Error
+	return lines, err
+}
+
+// aggregateStatementModels 优先使用数据看板的按小时汇总，日志被清理后仍可出账
+func aggregateStatementModels(userId int, start int64, end int64) ([]StatementUsageLine, error) {
+	if !common.DataExportEnabled {
+		return aggregateStatementLogs(userId, start, end, "model_name")
+	}
+	var lines []StatementUsageLine
+	err := DB.Model(&QuotaData{}).
+		Select("model_name AS name, COALESCE(SUM(count), 0) AS requests, COALESCE(SUM(token_used), 0) AS tokens, COALESCE(SUM(quota), 0) AS quota").
+		Where("user_id = ? AND created_at >= ? AND created_at <= ?", userId, start, end).
+		Group("model_name").Order("quota desc").
+		Scan(&lines).Error
+	return lines, err
+}
+
+func aggregateStatementProjects(userId int, start int64, end int64) ([]StatementUsageLine, int, error) {
+	var rows []struct {
+		ProjectId int
+		Requests  int
+		Tokens    int
+		Quota     int
+	}
+	err := LOG_DB.Model(&Log{}).
+		Select("project_id, COUNT(*) AS requests, COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS tokens, COALESCE(SUM(quota), 0) AS quota").
+		Where("user_id = ? AND type = ? AND created_at >= ? AND created_at <= ? AND org_id <> 0", userId, LogTypeConsume, start, end).
+		Group("project_id").Order("quota desc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	lines := make([]StatementUsageLine, 0, len(rows))
+	orgQuota := 0
+	for _, row := range rows {
+		name := fmt.Sprintf("#%d", row.ProjectId)
+		if project, err := GetProjectById(row.ProjectId); err == nil {
+			name = fmt.Sprintf("%s (#%d)", project.Name, project.Id)
+		}
+		lines = append(lines, StatementUsageLine{Name: name, Requests: row.Requests, Tokens: row.Tokens, Quota: row.Quota})
+		orgQuota += row.Quota
+	}
+	return lines, orgQuota, nil
+}
+
+// collectStatementPayments 汇总周期内完成的充值与订阅订单。订阅订单会同步写入一条同单号的充值记录，这里按单号去重
+func collectStatementPayments(userId int, start int64, end int64) (topUps []StatementPaymentLine, subscriptions []StatementPaymentLine, err error) {
+	var orders []SubscriptionOrder
+	err = DB.Where("user_id = ? AND status = ? AND complete_time >= ? AND complete_time <= ?",
+		userId, common.TopUpStatusSuccess, start, end).Order("complete_time").Find(&orders).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	orderTradeNos := make(map[string]bool, len(orders))
+	planIds := make([]int, 0, len(orders))
+	for _, order := range orders {
+		orderTradeNos[order.TradeNo] = true
+		planIds = append(planIds, order.PlanId)
+	}
+	titles, err := GetSubscriptionPlanTitlesByIds(planIds)
+	if err != nil {
+		return nil, nil, err
+	}
+	subscriptions = make([]StatementPaymentLine, 0, len(orders))
+	for _, order := range orders {
+		subscriptions = append(subscriptions, StatementPaymentLine{
+			TradeNo:       order.TradeNo,
+			Title:         titles[order.PlanId],
+			PaymentMethod: order.PaymentMethod,
+			Money:         order.Money,
+			CompleteTime:  order.CompleteTime,
+		})
+	}
+
+	var records []TopUp
+	err = DB.Where("user_id = ? AND status = ? AND complete_time >= ? AND complete_time <= ?",
+		userId, common.TopUpStatusSuccess, start, end).Order("complete_time").Find(&records).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	// 不同支付方式的 Amount 含义不同，到账额度以账本中该订单的入账分录为准
+	tradeNos := make([]string, 0, len(records))
+	for _, record := range records {
+		tradeNos = append(tradeNos, record.TradeNo)
+	}
+	credited, err := getTopUpLedgerQuota(userId, tradeNos)
+	if err != nil {
+		return nil, nil, err
+	}
+	topUps = make([]StatementPaymentLine, 0, len(records))
+	for _, record := range records {
+		if orderTradeNos[record.TradeNo] {
+			continue
+		}
+		topUps = append(topUps, StatementPaymentLine{
+			TradeNo:       record.TradeNo,
+			PaymentMethod: record.PaymentMethod,
+			Money:         record.Money,
+			Quota:         credited[record.TradeNo],
+			CompleteTime:  record.CompleteTime,
+		})
+	}
+	return topUps, subscriptions, nil
+}
+
+// GenerateStatement 生成（或重新生成）用户指定周期的账单
+func GenerateStatement(userId int, period string) (*Statement, error) {
+	start, end, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	setting := user.GetSetting()
+
+	var detail StatementDetail
+	if detail.Models, err = aggregateStatementModels(userId, start, end); err != nil {
+		return nil, err
+	}
+	if detail.Tokens, err = aggregateStatementLogs(userId, start, end, "token_name"); err != nil {
+		return nil, err
+	}
+	var orgQuota int
+	if detail.Projects, orgQuota, err = aggregateStatementProjects(userId, start, end); err != nil {
+		return nil, err
+	}
+	if detail.TopUps, detail.Subscriptions, err = collectStatementPayments(userId, start, end); err != nil {
+		return nil, err
+	}
+	detailBytes, err := json.Marshal(detail)
+	if err != nil {
+		return nil, err
+	}
+
+	now := common.GetTimestamp()
+	statement := &Statement{
+		UserId:            userId,
+		Period:            period,
+		StartTime:         start,
+		EndTime:           end,
+		OrganizationQuota: orgQuota,
+		Company:           setting.InvoiceCompany,
+		TaxId:             setting.InvoiceTaxId,
+		Address:           setting.InvoiceAddress,
+		Detail:            string(detailBytes),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	for _, line := range detail.Models {
+		statement.RequestCount += line.Requests
+		statement.TokensUsed += line.Tokens
+		statement.ConsumedQuota += line.Quota
+	}
+	for _, line := range detail.TopUps {
+		statement.TopUpQuota += line.Quota
+		statement.TopUpMoney += line.Money
+	}
+	for _, line := range detail.Subscriptions {
+		statement.SubscriptionMoney += line.Money
+	}
+
+	err = DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"start_time", "end_time", "request_count", "tokens_used", "consumed_quota", "organization_quota",
+			"top_up_quota", "top_up_money", "subscription_money", "company", "tax_id", "address", "detail", "updated_at",
+		}),
+	}).Create(statement).Error
+	if err != nil {
+		return nil, err
+	}
+	return GetUserStatementByPeriod(userId, period)
+}
+
+func GetUserStatementByPeriod(userId int, period string) (*Statement, error) {
+	var statement Statement
+	if err := DB.Where("user_id = ? AND period = ?", userId, period).First(&statement).Error; err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+func GetStatementById(id int) (*Statement, error) {
+	var statement Statement
+	if err := DB.First(&statement, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+func GetUserStatements(userId int, startIdx int, num int) (statements []*Statement, total int64, err error) {
+	tx := DB.Model(&Statement{}).Where("user_id = ?", userId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("period desc").Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, total, err
+}
+
+func GetAllStatements(userId int, period string, startIdx int, num int) (statements []*Statement, total int64, err error) {
+	tx := DB.Model(&Statement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("period desc, id desc").Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, total, err
+}
+
+// GetStatementUserIds 返回周期内有消费或充值记录、需要出账的用户
+func GetStatementUserIds(start int64, end int64) ([]int, error) {
+	var consumeUserIds []int
+	err := LOG_DB.Model(&Log{}).Distinct("user_id").
+		Where("type = ? AND created_at >= ? AND created_at <= ?", LogTypeConsume, start, end).
+		Pluck("user_id", &consumeUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	var topUpUserIds []int
+	err = DB.Model(&TopUp{}).Distinct("user_id").
+		Where("status = ? AND complete_time >= ? AND complete_time <= ?", common.TopUpStatusSuccess, start, end).
+		Pluck("user_id", &topUpUserIds).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool, len(consumeUserIds)+len(topUpUserIds))
+	userIds := make([]int, 0, len(consumeUserIds)+len(topUpUserIds))
+	for _, id := range append(consumeUserIds, topUpUserIds...) {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		userIds = append(userIds, id)
+	}
+	return userIds, nil
+}
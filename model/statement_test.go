@@ -0,0 +1,116 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func createStatementTestLog(t *testing.T, userId int, createdAt int64, modelName string, tokenName string, quota int, projectId int) {
+	t.Helper()
+	log := &Log{
+		UserId:           userId,
+		CreatedAt:        createdAt,
+		Type:             LogTypeConsume,
+		ModelName:        modelName,
+		TokenName:        tokenName,
+		Quota:            quota,
+		PromptTokens:     10,
+		CompletionTokens: 5,
+		ProjectId:        projectId,
+	}
+	if projectId != 0 {
+		log.OrgId = 1
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		t.Fatalf("failed to create log: %v", err)
+	}
+}
+
+func TestGenerateStatementAggregates(t *testing.T) {
+	// 按消费日志汇总，不依赖数据看板的按小时汇总
+	dataExportEnabled := common.DataExportEnabled
+	common.DataExportEnabled = false
+	t.Cleanup(func() { common.DataExportEnabled = dataExportEnabled })
+
+	user := createLedgerTestUser(t, 0)
+	start, end, err := ParseStatementPeriod("2026-03")
+	if err != nil {
+		t.Fatalf("failed to parse period: %v", err)
+	}
+	mid := start + 86400
+
+	project := &Project{OrgId: 1, Name: "研发项目"}
+	if err := DB.Create(project).Error; err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	createStatementTestLog(t, user.Id, mid, "gpt-4o", "default", 300, 0)
+	createStatementTestLog(t, user.Id, mid, "gpt-4o", "ci", 200, project.Id)
+	createStatementTestLog(t, user.Id, mid, "claude", "default", 100, 0)
+	// 周期外的日志不计入
+	createStatementTestLog(t, user.Id, end+1, "gpt-4o", "default", 999, 0)
+
+	topUp := &TopUp{UserId: user.Id, Amount: 5, Money: 36, TradeNo: "stmt_" + common.GetRandomString(12),
+		PaymentMethod: "alipay", Status: common.TopUpStatusSuccess, CompleteTime: mid}
+	if err := topUp.Insert(); err != nil {
+		t.Fatalf("failed to create topup: %v", err)
+	}
+	if err := RecordUserLedger(DB, user.Id, 2500, topUpLedgerRef(topUp)); err != nil {
+		t.Fatalf("failed to record ledger: %v", err)
+	}
+	// 订阅订单会同步写入同单号的充值记录，只应计入订阅
+	subTradeNo := "stmt_sub_" + common.GetRandomString(12)
+	order := &SubscriptionOrder{UserId: user.Id, PlanId: 0, Money: 20, TradeNo: subTradeNo,
+		PaymentMethod: "stripe", Status: common.TopUpStatusSuccess, CompleteTime: mid}
+	if err := DB.Create(order).Error; err != nil {
+		t.Fatalf("failed to create subscription order: %v", err)
+	}
+	mirror := &TopUp{UserId: user.Id, Money: 20, TradeNo: subTradeNo, PaymentMethod: "stripe",
+		Status: common.TopUpStatusSuccess, CompleteTime: mid}
+	if err := mirror.Insert(); err != nil {
+		t.Fatalf("failed to create mirror topup: %v", err)
+	}
+
+	statement, err := GenerateStatement(user.Id, "2026-03")
+	if err != nil {
+		t.Fatalf("failed to generate statement: %v", err)
+	}
+	if statement.RequestCount != 3 || statement.TokensUsed != 45 || statement.ConsumedQuota != 600 {
+		t.Fatalf("unexpected usage totals: requests=%d tokens=%d quota=%d",
+			statement.RequestCount, statement.TokensUsed, statement.ConsumedQuota)
+	}
+	if statement.OrganizationQuota != 200 {
+		t.Fatalf("organization quota = %d, want 200", statement.OrganizationQuota)
+	}
+	if statement.TopUpQuota != 2500 || statement.TopUpMoney != 36 || statement.SubscriptionMoney != 20 {
+		t.Fatalf("unexpected payment totals: topup quota=%d money=%v subscription=%v",
+			statement.TopUpQuota, statement.TopUpMoney, statement.SubscriptionMoney)
+	}
+
+	detail := statement.GetDetail()
+	if len(detail.Models) != 2 || detail.Models[0].Name != "gpt-4o" || detail.Models[0].Quota != 500 {
+		t.Fatalf("unexpected model lines: %+v", detail.Models)
+	}
+	if len(detail.Tokens) != 2 {
+		t.Fatalf("unexpected token lines: %+v", detail.Tokens)
+	}
+	if len(detail.Projects) != 1 || detail.Projects[0].Name != fmt.Sprintf("研发项目 (#%d)", project.Id) {
+		t.Fatalf("unexpected project lines: %+v", detail.Projects)
+	}
+	if len(detail.TopUps) != 1 || len(detail.Subscriptions) != 1 {
+		t.Fatalf("expected subscription mirror topup to be deduplicated, got topups=%d subscriptions=%d",
+			len(detail.TopUps), len(detail.Subscriptions))
+	}
+
+	// 重新生成时覆盖同一周期的账单
+	createStatementTestLog(t, user.Id, mid, "claude", "default", 50, 0)
+	regenerated, err := GenerateStatement(user.Id, "2026-03")
+	if err != nil {
+		t.Fatalf("failed to regenerate statement: %v", err)
+	}
+	if regenerated.Id != statement.Id || regenerated.ConsumedQuota != 650 {
+		t.Fatalf("expected statement %d to be updated to 650, got id=%d quota=%d",
+			statement.Id, regenerated.Id, regenerated.ConsumedQuota)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/pkg/cachex"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/samber/hot"
 	"gorm.io/gorm"
 )
@@ -176,6 +177,12 @@ type SubscriptionPlan struct {
 	QuotaResetPeriod        string `json:"quota_reset_period" gorm:"type:varchar(16);default:'never'"`
 	QuotaResetCustomSeconds int64  `json:"quota_reset_custom_seconds" gorm:"type:bigint;default:0"`
 
+	// Per-model allowances (JSON array of SubscriptionModelAllowance, empty = all models share TotalAmount)
+	ModelAllowances string `json:"model_allowances" gorm:"type:text"`
+
+	// Native prices in other currencies (JSON array of SubscriptionCurrencyPrice, empty = Currency only)
+	CurrencyPrices string `json:"currency_prices" gorm:"type:text"`
+
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
 }
@@ -198,6 +205,8 @@ type SubscriptionOrder struct {
 	UserId int     `json:"user_id" gorm:"index"`
 	PlanId int     `json:"plan_id" gorm:"index"`
 	Money  float64 `json:"money"`
+	// 支付货币，空表示套餐默认货币
+	Currency string `json:"currency" gorm:"type:varchar(8);default:''"`
 
 	TradeNo       string `json:"trade_no" gorm:"unique;type:varchar(255);index"`
 	PaymentMethod string `json:"payment_method" gorm:"type:varchar(50)"`
@@ -206,6 +215,11 @@ type SubscriptionOrder struct {
 	CompleteTime  int64  `json:"complete_time"`
 
 	ProviderPayload string `json:"provider_payload" gorm:"type:text"`
+	// 支付渠道侧的订单号（Stripe Checkout Session、PayPal Order 等），用于查单与退款
+	ProviderOrderId string `json:"provider_order_id" gorm:"type:varchar(128);default:''"`
+	// 订单开通或续期的用户订阅，退款时据此作废订阅
+	UserSubscriptionId int     `json:"user_subscription_id" gorm:"default:0;index"`
+	RefundedMoney      float64 `json:"refunded_money" gorm:"default:0"`
 }
 
 func (o *SubscriptionOrder) Insert() error {
@@ -219,6 +233,11 @@ func (o *SubscriptionOrder) Update() error {
 	return DB.Save(o).Error
 }
 
+// SetSubscriptionOrderProviderOrderId 记录支付渠道侧订单号
+func SetSubscriptionOrderProviderOrderId(tradeNo string, providerOrderId string) error {
+	return DB.Model(&SubscriptionOrder{}).Where("trade_no = ?", tradeNo).Update("provider_order_id", providerOrderId).Error
+}
+
 func GetSubscriptionOrderByTradeNo(tradeNo string) *SubscriptionOrder {
 	if tradeNo == "" {
 		return nil
@@ -235,6 +254,8 @@ type UserSubscription struct {
 	Id     int `json:"id"`
 	UserId int `json:"user_id" gorm:"index;index:idx_user_sub_active,priority:1"`
 	PlanId int `json:"plan_id" gorm:"index"`
+	// 组织持有的订阅 UserId 为 0，由组织成员通过项目令牌使用
+	OrgId int `json:"org_id" gorm:"index;default:0"`
 
 	AmountTotal int64 `json:"amount_total" gorm:"type:bigint;not null;default:0"`
 	AmountUsed  int64 `json:"amount_used" gorm:"type:bigint;not null;default:0"`
@@ -251,6 +272,15 @@ type UserSubscription struct {
 	UpgradeGroup  string `json:"upgrade_group" gorm:"type:varchar(64);default:''"`
 	PrevUserGroup string `json:"prev_user_group" gorm:"type:varchar(64);default:''"`
 
+	// Recurring billing (Stripe / Creem subscriptions)
+	AutoRenew              bool   `json:"auto_renew" gorm:"default:false"`
+	CancelAtPeriodEnd      bool   `json:"cancel_at_period_end" gorm:"default:false"`
+	PaymentMethod          string `json:"payment_method" gorm:"type:varchar(50);default:''"`
+	ProviderSubscriptionId string `json:"provider_subscription_id" gorm:"type:varchar(128);default:'';index"`
+	RenewalFailedCount     int    `json:"renewal_failed_count" gorm:"default:0"`
+	// Upgrade group is kept until this time after an auto-renew subscription expires
+	GraceEndTime int64 `json:"grace_end_time" gorm:"type:bigint;default:0;index"`
+
 	CreatedAt int64 `json:"created_at" gorm:"bigint"`
 	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
 }
@@ -268,7 +298,8 @@ func (s *UserSubscription) BeforeUpdate(tx *gorm.DB) error {
 }
 
 type SubscriptionSummary struct {
-	Subscription *UserSubscription `json:"subscription"`
+	Subscription *UserSubscription             `json:"subscription"`
+	Allowances   []SubscriptionAllowanceStatus `json:"allowances,omitempty"`
 }
 
 func calcPlanEndTime(start time.Time, plan *SubscriptionPlan) (int64, error) {
@@ -310,7 +341,11 @@ func calcNextResetTime(base time.Time, plan *SubscriptionPlan, endUnix int64) in
 	if plan == nil {
 		return 0
 	}
-	period := NormalizeResetPeriod(plan.QuotaResetPeriod)
+	return calcNextResetTimeByPeriod(base, plan.QuotaResetPeriod, plan.QuotaResetCustomSeconds, endUnix)
+}
+
+func calcNextResetTimeByPeriod(base time.Time, period string, customSeconds int64, endUnix int64) int64 {
+	period = NormalizeResetPeriod(period)
 	if period == SubscriptionResetNever {
 		return 0
 	}
@@ -334,10 +369,10 @@ func calcNextResetTime(base time.Time, plan *SubscriptionPlan, endUnix int64) in
 		next = time.Date(base.Year(), base.Month(), 1, 0, 0, 0, 0, base.Location()).
 			AddDate(0, 1, 0)
 	case SubscriptionResetCustom:
-		if plan.QuotaResetCustomSeconds <= 0 {
+		if customSeconds <= 0 {
 			return 0
 		}
-		next = base.Add(time.Duration(plan.QuotaResetCustomSeconds) * time.Second)
+		next = base.Add(time.Duration(customSeconds) * time.Second)
 	default:
 		return 0
 	}
@@ -416,8 +451,8 @@ func downgradeUserGroupForSubscriptionTx(tx *gorm.DB, sub *UserSubscription, now
 		return "", nil
 	}
 	var activeSub UserSubscription
-	activeQuery := tx.Where("user_id = ? AND status = ? AND end_time > ? AND id <> ? AND upgrade_group <> ''",
-		sub.UserId, "active", now, sub.Id).
+	activeQuery := tx.Where("user_id = ? AND id <> ? AND upgrade_group <> '' AND ((status = ? AND end_time > ?) OR (status = ? AND grace_end_time > ?))",
+		sub.UserId, sub.Id, "active", now, "expired", now).
 		Order("end_time desc, id desc").
 		Limit(1).
 		Find(&activeSub)
@@ -506,7 +541,9 @@ func CreateUserSubscriptionFromPlanTx(tx *gorm.DB, userId int, plan *Subscriptio
 }
 
 // Complete a subscription order (idempotent). Creates a UserSubscription snapshot from the plan.
-func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
+// providerSubscriptionId is set when the order was paid through a recurring provider subscription,
+// the created UserSubscription is then renewed automatically by provider webhooks.
+func CompleteSubscriptionOrder(tradeNo string, providerPayload string, providerSubscriptionId string) error {
 	if tradeNo == "" {
 		return errors.New("tradeNo is empty")
 	}
@@ -538,13 +575,24 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 			// still allow completion for already purchased orders
 		}
 		upgradeGroup = strings.TrimSpace(plan.UpgradeGroup)
-		_, err = CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
+		sub, err := CreateUserSubscriptionFromPlanTx(tx, order.UserId, plan, "order")
 		if err != nil {
 			return err
 		}
+		providerSubscriptionId = strings.TrimSpace(providerSubscriptionId)
+		if providerSubscriptionId != "" {
+			if err := tx.Model(sub).Updates(map[string]interface{}{
+				"auto_renew":               true,
+				"payment_method":           order.PaymentMethod,
+				"provider_subscription_id": providerSubscriptionId,
+			}).Error; err != nil {
+				return err
+			}
+		}
 		if err := upsertSubscriptionTopUpTx(tx, &order); err != nil {
 			return err
 		}
+		order.UserSubscriptionId = sub.Id
 		order.Status = common.TopUpStatusSuccess
 		order.CompleteTime = common.GetTimestamp()
 		if providerPayload != "" {
@@ -651,6 +699,100 @@ func AdminBindSubscription(userId int, planId int, sourceNote string) (string, e
 	return "", nil
 }
 
+// CreateOrganizationSubscriptionFromPlanTx 为组织创建订阅，组织没有分组，套餐的升级分组不生效
+func CreateOrganizationSubscriptionFromPlanTx(tx *gorm.DB, orgId int, plan *SubscriptionPlan, source string) (*UserSubscription, error) {
+	if plan == nil || plan.Id == 0 {
+		return nil, errors.New("invalid plan")
+	}
+	if orgId <= 0 {
+		return nil, errors.New("invalid org id")
+	}
+	if plan.MaxPurchasePerUser > 0 {
+		var count int64
+		if err := tx.Model(&UserSubscription{}).
+			Where("org_id = ? AND plan_id = ?", orgId, plan.Id).
+			Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= int64(plan.MaxPurchasePerUser) {
+			return nil, errors.New("已达到该套餐购买上限")
+		}
+	}
+	now := time.Unix(GetDBTimestamp(), 0)
+	endUnix, err := calcPlanEndTime(now, plan)
+	if err != nil {
+		return nil, err
+	}
+	nextReset := calcNextResetTime(now, plan, endUnix)
+	lastReset := int64(0)
+	if nextReset > 0 {
+		lastReset = now.Unix()
+	}
+	sub := &UserSubscription{
+		OrgId:         orgId,
+		PlanId:        plan.Id,
+		AmountTotal:   plan.TotalAmount,
+		StartTime:     now.Unix(),
+		EndTime:       endUnix,
+		Status:        "active",
+		Source:        source,
+		LastResetTime: lastReset,
+		NextResetTime: nextReset,
+	}
+	if err := tx.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// AdminBindOrganizationSubscription 管理员为组织开通订阅
+func AdminBindOrganizationSubscription(orgId int, planId int) error {
+	if orgId <= 0 || planId <= 0 {
+		return errors.New("invalid orgId or planId")
+	}
+	plan, err := GetSubscriptionPlanById(planId)
+	if err != nil {
+		return err
+	}
+	if _, err := GetOrganizationById(orgId); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		_, err := CreateOrganizationSubscriptionFromPlanTx(tx, orgId, plan, "admin")
+		return err
+	})
+}
+
+// GetAllOrganizationSubscriptions 返回组织的全部订阅
+func GetAllOrganizationSubscriptions(orgId int) ([]SubscriptionSummary, error) {
+	if orgId <= 0 {
+		return nil, errors.New("invalid orgId")
+	}
+	var subs []UserSubscription
+	err := DB.Where("org_id = ?", orgId).
+		Order("end_time desc, id desc").
+		Find(&subs).Error
+	if err != nil {
+		return nil, err
+	}
+	return buildSubscriptionSummaries(subs), nil
+}
+
+// HasActiveOrganizationSubscription 组织是否持有有效订阅
+func HasActiveOrganizationSubscription(orgId int) (bool, error) {
+	if orgId <= 0 {
+		return false, errors.New("invalid orgId")
+	}
+	now := common.GetTimestamp()
+	var count int64
+	if err := DB.Model(&UserSubscription{}).
+		Where("org_id = ? AND status = ? AND end_time > ?", orgId, "active", now).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 // GetAllActiveUserSubscriptions returns all active subscriptions for a user.
 func GetAllActiveUserSubscriptions(userId int) ([]SubscriptionSummary, error) {
 	if userId <= 0 {
@@ -844,6 +986,10 @@ type SubscriptionPreConsumeResult struct {
 	AmountTotal        int64
 	AmountUsedBefore   int64
 	AmountUsedAfter    int64
+	// 命中模型额度时填充，此时 PreConsumed 为 0，不占用订阅总额度
+	AllowanceModel    string
+	AllowanceMetric   string
+	AllowanceConsumed int64
 }
 
 // ExpireDueSubscriptions marks expired subscriptions and handles group downgrade.
@@ -862,6 +1008,7 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 	if len(subs) == 0 {
 		return 0, nil
 	}
+	graceSeconds := operation_setting.GetSubscriptionSetting().GracePeriodSeconds()
 	expiredCount := 0
 	userIds := make(map[int]struct{}, len(subs))
 	for _, sub := range subs {
@@ -872,6 +1019,21 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 	for userId := range userIds {
 		cacheGroup := ""
 		err := DB.Transaction(func(tx *gorm.DB) error {
+			// Auto-renew subscriptions keep the upgraded group during the grace period,
+			// a late renewal webhook reactivates them without the user noticing.
+			if graceSeconds > 0 {
+				res := tx.Model(&UserSubscription{}).
+					Where("user_id = ? AND status = ? AND end_time > 0 AND end_time <= ? AND auto_renew = ?", userId, "active", now, true).
+					Updates(map[string]interface{}{
+						"status":         "expired",
+						"grace_end_time": gorm.Expr("end_time + ?", graceSeconds),
+						"updated_at":     common.GetTimestamp(),
+					})
+				if res.Error != nil {
+					return res.Error
+				}
+				expiredCount += int(res.RowsAffected)
+			}
 			res := tx.Model(&UserSubscription{}).
 				Where("user_id = ? AND status = ? AND end_time > 0 AND end_time <= ?", userId, "active", now).
 				Updates(map[string]interface{}{
@@ -883,44 +1045,11 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 			}
 			expiredCount += int(res.RowsAffected)
 
-			// If there's an active upgraded subscription, keep current group.
-			var activeSub UserSubscription
-			activeQuery := tx.Where("user_id = ? AND status = ? AND end_time > ? AND upgrade_group <> ''",
-				userId, "active", now).
-				Order("end_time desc, id desc").
-				Limit(1).
-				Find(&activeSub)
-			if activeQuery.Error == nil && activeQuery.RowsAffected > 0 {
-				return nil
-			}
-
-			// No active upgraded subscription, downgrade to previous group if needed.
-			var lastExpired UserSubscription
-			expiredQuery := tx.Where("user_id = ? AND status = ? AND upgrade_group <> ''",
-				userId, "expired").
-				Order("end_time desc, id desc").
-				Limit(1).
-				Find(&lastExpired)
-			if expiredQuery.Error != nil || expiredQuery.RowsAffected == 0 {
-				return nil
-			}
-			upgradeGroup := strings.TrimSpace(lastExpired.UpgradeGroup)
-			prevGroup := strings.TrimSpace(lastExpired.PrevUserGroup)
-			if upgradeGroup == "" || prevGroup == "" {
-				return nil
-			}
-			currentGroup, err := getUserGroupByIdTx(tx, userId)
+			group, err := restoreUserGroupAfterExpiryTx(tx, userId, now)
 			if err != nil {
 				return err
 			}
-			if currentGroup != upgradeGroup || currentGroup == prevGroup {
-				return nil
-			}
-			if err := tx.Model(&User{}).Where("id = ?", userId).
-				Update("group", prevGroup).Error; err != nil {
-				return err
-			}
-			cacheGroup = prevGroup
+			cacheGroup = group
 			return nil
 		})
 		if err != nil {
@@ -930,9 +1059,63 @@ func ExpireDueSubscriptions(limit int) (int, error) {
 			_ = UpdateUserGroupCache(userId, cacheGroup)
 		}
 	}
+	// 组织订阅不升级分组，也不会自动续费，直接标记过期
+	res := DB.Model(&UserSubscription{}).
+		Where("user_id = 0 AND org_id > 0 AND status = ? AND end_time > 0 AND end_time <= ?", "active", now).
+		Updates(map[string]interface{}{
+			"status":     "expired",
+			"updated_at": common.GetTimestamp(),
+		})
+	if res.Error != nil {
+		return expiredCount, res.Error
+	}
+	expiredCount += int(res.RowsAffected)
 	return expiredCount, nil
 }
 
+// restoreUserGroupAfterExpiryTx moves the user back to the group they had before the latest
+// expired upgraded subscription, unless another subscription still holds an upgraded group.
+func restoreUserGroupAfterExpiryTx(tx *gorm.DB, userId int, now int64) (string, error) {
+	// If there's an active upgraded subscription (or one still in grace), keep current group.
+	var activeSub UserSubscription
+	activeQuery := tx.Where("user_id = ? AND upgrade_group <> '' AND ((status = ? AND end_time > ?) OR (status = ? AND grace_end_time > ?))",
+		userId, "active", now, "expired", now).
+		Order("end_time desc, id desc").
+		Limit(1).
+		Find(&activeSub)
+	if activeQuery.Error == nil && activeQuery.RowsAffected > 0 {
+		return "", nil
+	}
+
+	// No active upgraded subscription, downgrade to previous group if needed.
+	var lastExpired UserSubscription
+	expiredQuery := tx.Where("user_id = ? AND status = ? AND upgrade_group <> ''",
+		userId, "expired").
+		Order("end_time desc, id desc").
+		Limit(1).
+		Find(&lastExpired)
+	if expiredQuery.Error != nil || expiredQuery.RowsAffected == 0 {
+		return "", nil
+	}
+	upgradeGroup := strings.TrimSpace(lastExpired.UpgradeGroup)
+	prevGroup := strings.TrimSpace(lastExpired.PrevUserGroup)
+	if upgradeGroup == "" || prevGroup == "" {
+		return "", nil
+	}
+	currentGroup, err := getUserGroupByIdTx(tx, userId)
+	if err != nil {
+		return "", err
+	}
+	if currentGroup != upgradeGroup || currentGroup == prevGroup {
+		return "", nil
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).
+		Update("group", prevGroup).Error; err != nil {
+		return "", err
+	}
+	return prevGroup, nil
+}
+
 // SubscriptionPreConsumeRecord stores idempotent pre-consume operations per request.
 type SubscriptionPreConsumeRecord struct {
 	Id                 int    `json:"id"`
@@ -940,6 +1123,8 @@ type SubscriptionPreConsumeRecord struct {
 	UserId             int    `json:"user_id" gorm:"index"`
 	UserSubscriptionId int    `json:"user_subscription_id" gorm:"index"`
 	PreConsumed        int64  `json:"pre_consumed" gorm:"type:bigint;not null;default:0"`
+	AllowanceModel     string `json:"allowance_model" gorm:"type:varchar(128);default:''"`
+	AllowanceConsumed  int64  `json:"allowance_consumed" gorm:"type:bigint;not null;default:0"`
 	Status             string `json:"status" gorm:"type:varchar(32);index"` // consumed/refunded
 	CreatedAt          int64  `json:"created_at" gorm:"bigint"`
 	UpdatedAt          int64  `json:"updated_at" gorm:"bigint;index"`
@@ -994,10 +1179,25 @@ func maybeResetUserSubscriptionWithPlanTx(tx *gorm.DB, sub *UserSubscription, pl
 }
 
 // PreConsumeUserSubscription pre-consumes from any active subscription total quota.
-func PreConsumeUserSubscription(requestId string, userId int, modelName string, quotaType int, amount int64) (*SubscriptionPreConsumeResult, error) {
+// Models matching a plan's model allowance are metered against that allowance instead
+// (1 per request, or estimatedTokens for token-metered allowances).
+func PreConsumeUserSubscription(requestId string, userId int, modelName string, quotaType int, amount int64, estimatedTokens int64) (*SubscriptionPreConsumeResult, error) {
 	if userId <= 0 {
 		return nil, errors.New("invalid userId")
 	}
+	return preConsumeSubscription(requestId, userId, "user_id", userId, modelName, amount, estimatedTokens)
+}
+
+// PreConsumeOrganizationSubscription 从组织持有的订阅预扣额度，userId 为发起请求的成员
+func PreConsumeOrganizationSubscription(requestId string, orgId int, userId int, modelName string, amount int64, estimatedTokens int64) (*SubscriptionPreConsumeResult, error) {
+	if orgId <= 0 {
+		return nil, errors.New("invalid orgId")
+	}
+	return preConsumeSubscription(requestId, userId, "org_id", orgId, modelName, amount, estimatedTokens)
+}
+
+// preConsumeSubscription 按 ownerColumn（user_id 或 org_id）选择订阅并预扣
+func preConsumeSubscription(requestId string, userId int, ownerColumn string, ownerId int, modelName string, amount int64, estimatedTokens int64) (*SubscriptionPreConsumeResult, error) {
 	if strings.TrimSpace(requestId) == "" {
 		return nil, errors.New("requestId is empty")
 	}
@@ -1027,12 +1227,21 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 			returnValue.AmountTotal = sub.AmountTotal
 			returnValue.AmountUsedBefore = sub.AmountUsed
 			returnValue.AmountUsedAfter = sub.AmountUsed
+			if existing.AllowanceModel != "" {
+				returnValue.AllowanceModel = existing.AllowanceModel
+				returnValue.AllowanceConsumed = existing.AllowanceConsumed
+				if plan, err := getSubscriptionPlanByIdTx(tx, sub.PlanId); err == nil {
+					if allowance := plan.MatchModelAllowance(modelName); allowance != nil {
+						returnValue.AllowanceMetric = allowance.Metric
+					}
+				}
+			}
 			return nil
 		}
 
 		var subs []UserSubscription
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").
-			Where("user_id = ? AND status = ? AND end_time > ?", userId, "active", now).
+			Where(ownerColumn+" = ? AND status = ? AND end_time > ?", ownerId, "active", now).
 			Order("end_time asc, id asc").
 			Find(&subs).Error; err != nil {
 			return errors.New("no active subscription")
@@ -1040,12 +1249,53 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 		if len(subs) == 0 {
 			return errors.New("no active subscription")
 		}
+		var exhausted *SubscriptionModelAllowance
 		for _, candidate := range subs {
 			sub := candidate
 			plan, err := getSubscriptionPlanByIdTx(tx, sub.PlanId)
 			if err != nil {
 				return err
 			}
+			if allowance := plan.MatchModelAllowance(modelName); allowance != nil {
+				need := int64(1)
+				if allowance.Metric == SubscriptionAllowanceMetricTokens {
+					need = max(estimatedTokens, 1)
+				}
+				usage, err := getAllowanceUsageTx(tx, &sub, allowance, now)
+				if err != nil {
+					return err
+				}
+				// 额度未用尽即可使用，按 token 计量时本次请求允许超出剩余额度
+				if allowance.Limit > 0 && usage.Used >= allowance.Limit {
+					if exhausted == nil {
+						exhausted = allowance
+					}
+					continue
+				}
+				record := &SubscriptionPreConsumeRecord{
+					RequestId:          requestId,
+					UserId:             userId,
+					UserSubscriptionId: sub.Id,
+					AllowanceModel:     allowance.Model,
+					AllowanceConsumed:  need,
+					Status:             "consumed",
+				}
+				if err := tx.Create(record).Error; err != nil {
+					return err
+				}
+				usage.Used += need
+				if err := tx.Save(usage).Error; err != nil {
+					return err
+				}
+				returnValue.UserSubscriptionId = sub.Id
+				returnValue.AmountTotal = sub.AmountTotal
+				returnValue.AmountUsedBefore = sub.AmountUsed
+				returnValue.AmountUsedAfter = sub.AmountUsed
+				returnValue.AllowanceModel = allowance.Model
+				returnValue.AllowanceMetric = allowance.Metric
+				returnValue.AllowanceConsumed = need
+				return nil
+			}
 			if err := maybeResetUserSubscriptionWithPlanTx(tx, &sub, plan, now); err != nil {
 				return err
 			}
@@ -1089,6 +1339,12 @@ func PreConsumeUserSubscription(requestId string, userId int, modelName string,
 			returnValue.AmountUsedAfter = sub.AmountUsed
 			return nil
 		}
+		if exhausted != nil {
+			if exhausted.Overflow == SubscriptionOverflowWallet {
+				return fmt.Errorf("subscription quota insufficient, model allowance %s exhausted", exhausted.Model)
+			}
+			return fmt.Errorf("%w: %s", ErrSubscriptionAllowanceExhausted, exhausted.Model)
+		}
 		return fmt.Errorf("subscription quota insufficient, need=%d", amount)
 	})
 	if err != nil {
@@ -1111,6 +1367,11 @@ func RefundSubscriptionPreConsume(requestId string) error {
 		if record.Status == "refunded" {
 			return nil
 		}
+		if record.AllowanceConsumed > 0 {
+			if err := adjustAllowanceUsageTx(tx, record.UserSubscriptionId, record.AllowanceModel, -record.AllowanceConsumed, record.CreatedAt); err != nil {
+				return err
+			}
+		}
 		if record.PreConsumed <= 0 {
 			record.Status = "refunded"
 			return tx.Save(&record).Error
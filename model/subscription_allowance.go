@@ -0,0 +1,414 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Subscription model allowance metric
+const (
+	SubscriptionAllowanceMetricRequests = "requests"
+	SubscriptionAllowanceMetricTokens   = "tokens"
+)
+
+// Subscription model allowance overflow behavior
+const (
+	SubscriptionOverflowWallet    = "wallet"    // 按用户计费偏好回退到钱包
+	SubscriptionOverflowBlock     = "block"     // 直接拒绝请求
+	SubscriptionOverflowDowngrade = "downgrade" // 改用 DowngradeModel
+)
+
+var ErrSubscriptionAllowanceExhausted = errors.New("subscription model allowance exhausted")
+
+// SubscriptionModelAllowance 套餐内单个模型（或模型通配）的额度。
+// 命中额度的模型只按额度计量，不占用套餐总额度；未命中任何额度的模型仍从总额度扣减。
+type SubscriptionModelAllowance struct {
+	Model              string `json:"model"`  // 模型名，支持 * 通配，如 claude-*opus*
+	Metric             string `json:"metric"` // requests 按请求次数，tokens 按输入+输出 token 数
+	Limit              int64  `json:"limit"`  // 0 = 不限
+	ResetPeriod        string `json:"reset_period"`
+	ResetCustomSeconds int64  `json:"reset_custom_seconds"`
+	Overflow           string `json:"overflow"` // wallet / block / downgrade
+	DowngradeModel     string `json:"downgrade_model"`
+}
+
+// ParseSubscriptionModelAllowances 解析并规范化套餐的模型额度配置
+func ParseSubscriptionModelAllowances(raw string) ([]SubscriptionModelAllowance, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var allowances []SubscriptionModelAllowance
+	if err := common.UnmarshalJsonStr(raw, &allowances); err != nil {
+		return nil, err
+	}
+	for i := range allowances {
+		a := &allowances[i]
+		a.Model = strings.TrimSpace(a.Model)
+		a.DowngradeModel = strings.TrimSpace(a.DowngradeModel)
+		if a.Metric != SubscriptionAllowanceMetricTokens {
+			a.Metric = SubscriptionAllowanceMetricRequests
+		}
+		a.ResetPeriod = NormalizeResetPeriod(a.ResetPeriod)
+		switch a.Overflow {
+		case SubscriptionOverflowBlock, SubscriptionOverflowDowngrade:
+		default:
+			a.Overflow = SubscriptionOverflowWallet
+		}
+	}
+	return allowances, nil
+}
+
+// NormalizeSubscriptionModelAllowances 校验模型额度配置，返回规范化后的 JSON
+func NormalizeSubscriptionModelAllowances(raw string) (string, error) {
+	allowances, err := ParseSubscriptionModelAllowances(raw)
+	if err != nil {
+		return "", fmt.Errorf("模型额度配置格式错误: %w", err)
+	}
+	if len(allowances) == 0 {
+		return "", nil
+	}
+	seen := make(map[string]struct{}, len(allowances))
+	for _, a := range allowances {
+		if a.Model == "" {
+			return "", errors.New("模型额度的模型名不能为空")
+		}
+		if len(a.Model) > 128 {
+			return "", fmt.Errorf("模型名过长: %s", a.Model)
+		}
+		if _, ok := seen[a.Model]; ok {
+			return "", fmt.Errorf("模型额度重复: %s", a.Model)
+		}
+		seen[a.Model] = struct{}{}
+		if a.Limit < 0 {
+			return "", fmt.Errorf("模型 %s 的额度不能为负数", a.Model)
+		}
+		if a.ResetPeriod == SubscriptionResetCustom && a.ResetCustomSeconds <= 0 {
+			return "", fmt.Errorf("模型 %s 的自定义重置周期需大于0秒", a.Model)
+		}
+		if a.Overflow == SubscriptionOverflowDowngrade {
+			if a.DowngradeModel == "" {
+				return "", fmt.Errorf("模型 %s 未设置降级模型", a.Model)
+			}
+			if matchModelPattern(a.Model, a.DowngradeModel) {
+				return "", fmt.Errorf("模型 %s 的降级模型不能匹配自身", a.Model)
+			}
+		}
+	}
+	return common.GetJsonString(allowances), nil
+}
+
+// GetModelAllowances 返回套餐的模型额度配置，配置无效时视为未配置
+func (p *SubscriptionPlan) GetModelAllowances() []SubscriptionModelAllowance {
+	allowances, err := ParseSubscriptionModelAllowances(p.ModelAllowances)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid model allowances of subscription plan %d: %s", p.Id, err.Error()))
+		return nil
+	}
+	return allowances
+}
+
+// MatchModelAllowance 返回模型命中的额度，精确匹配优先，其次按配置顺序匹配通配
+func (p *SubscriptionPlan) MatchModelAllowance(modelName string) *SubscriptionModelAllowance {
+	allowances := p.GetModelAllowances()
+	for i := range allowances {
+		if allowances[i].Model == modelName {
+			return &allowances[i]
+		}
+	}
+	for i := range allowances {
+		if strings.Contains(allowances[i].Model, "*") && matchModelPattern(allowances[i].Model, modelName) {
+			return &allowances[i]
+		}
+	}
+	return nil
+}
+
+func matchModelPattern(pattern string, name string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == name
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(name, part)
+		if idx < 0 {
+			return false
+		}
+		name = name[idx+len(part):]
+	}
+	return strings.HasSuffix(name, parts[len(parts)-1])
+}
+
+// SubscriptionAllowanceUsage 用户订阅下单个模型额度的用量，按额度自身的重置周期清零
+type SubscriptionAllowanceUsage struct {
+	Id                 int    `json:"id"`
+	UserSubscriptionId int    `json:"user_subscription_id" gorm:"uniqueIndex:idx_sub_allowance_model,priority:1"`
+	Model              string `json:"model" gorm:"type:varchar(128);uniqueIndex:idx_sub_allowance_model,priority:2"`
+	Used               int64  `json:"used" gorm:"type:bigint;not null;default:0"`
+	LastResetTime      int64  `json:"last_reset_time" gorm:"type:bigint;default:0"`
+	NextResetTime      int64  `json:"next_reset_time" gorm:"type:bigint;default:0"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt          int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (u *SubscriptionAllowanceUsage) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	return nil
+}
+
+func (u *SubscriptionAllowanceUsage) BeforeUpdate(tx *gorm.DB) error {
+	u.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// advanceResetWindow 将用量的重置窗口推进到 now 所在的周期，返回是否跨过了重置时间
+func (u *SubscriptionAllowanceUsage) advanceResetWindow(sub *UserSubscription, allowance *SubscriptionModelAllowance, now int64) bool {
+	if NormalizeResetPeriod(allowance.ResetPeriod) == SubscriptionResetNever {
+		return false
+	}
+	if u.NextResetTime > now {
+		return false
+	}
+	baseUnix := u.LastResetTime
+	if baseUnix <= 0 {
+		baseUnix = sub.StartTime
+	}
+	base := time.Unix(baseUnix, 0)
+	next := calcNextResetTimeByPeriod(base, allowance.ResetPeriod, allowance.ResetCustomSeconds, sub.EndTime)
+	advanced := false
+	for next > 0 && next <= now {
+		advanced = true
+		base = time.Unix(next, 0)
+		next = calcNextResetTimeByPeriod(base, allowance.ResetPeriod, allowance.ResetCustomSeconds, sub.EndTime)
+	}
+	u.LastResetTime = base.Unix()
+	u.NextResetTime = next
+	return advanced
+}
+
+func lockAllowanceUsageTx(tx *gorm.DB, userSubscriptionId int, model string) (*SubscriptionAllowanceUsage, bool, error) {
+	var usage SubscriptionAllowanceUsage
+	query := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("user_subscription_id = ? AND model = ?", userSubscriptionId, model).
+		Limit(1).Find(&usage)
+	if query.Error != nil {
+		return nil, false, query.Error
+	}
+	return &usage, query.RowsAffected > 0, nil
+}
+
+// createAllowanceUsageTx 创建当前周期的用量记录，记录已存在时忽略
+func createAllowanceUsageTx(tx *gorm.DB, sub *UserSubscription, allowance *SubscriptionModelAllowance, now int64) error {
+	usage := SubscriptionAllowanceUsage{
+		UserSubscriptionId: sub.Id,
+		Model:              allowance.Model,
+		LastResetTime:      sub.StartTime,
+	}
+	usage.advanceResetWindow(sub, allowance, now)
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error
+}
+
+// getAllowanceUsageTx 锁定并返回当前周期的用量记录，不存在时创建。
+// 同一模型的首次并发请求会同时创建，冲突时忽略插入并重新读取已创建的记录
+func getAllowanceUsageTx(tx *gorm.DB, sub *UserSubscription, allowance *SubscriptionModelAllowance, now int64) (*SubscriptionAllowanceUsage, error) {
+	usage, found, err := lockAllowanceUsageTx(tx, sub.Id, allowance.Model)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if err := createAllowanceUsageTx(tx, sub, allowance, now); err != nil {
+			return nil, err
+		}
+		usage, found, err = lockAllowanceUsageTx(tx, sub.Id, allowance.Model)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("allowance usage of subscription %d model %s not found", sub.Id, allowance.Model)
+		}
+	}
+	lastResetTime, nextResetTime := usage.LastResetTime, usage.NextResetTime
+	if usage.advanceResetWindow(sub, allowance, now) {
+		usage.Used = 0
+	} else if usage.LastResetTime == lastResetTime && usage.NextResetTime == nextResetTime {
+		return usage, nil
+	}
+	if err := tx.Save(usage).Error; err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// adjustAllowanceUsageTx 调整用量，since 之后已发生过重置的不再调整（预扣属于上一个周期）
+func adjustAllowanceUsageTx(tx *gorm.DB, userSubscriptionId int, model string, delta int64, since int64) error {
+	if delta == 0 || model == "" {
+		return nil
+	}
+	usage, found, err := lockAllowanceUsageTx(tx, userSubscriptionId, model)
+	if err != nil || !found {
+		return err
+	}
+	if usage.LastResetTime > since {
+		return nil
+	}
+	usage.Used += delta
+	if usage.Used < 0 {
+		usage.Used = 0
+	}
+	return tx.Save(usage).Error
+}
+
+// SettleSubscriptionAllowance 按实际用量结算按 token 计量的模型额度，actual 为实际消耗的 token 数
+func SettleSubscriptionAllowance(requestId string, actual int64) error {
+	if strings.TrimSpace(requestId) == "" {
+		return errors.New("requestId is empty")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var record SubscriptionPreConsumeRecord
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("request_id = ?", requestId).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Status == "refunded" || record.AllowanceModel == "" {
+			return nil
+		}
+		if actual < 0 {
+			actual = 0
+		}
+		delta := actual - record.AllowanceConsumed
+		if delta == 0 {
+			return nil
+		}
+		if err := adjustAllowanceUsageTx(tx, record.UserSubscriptionId, record.AllowanceModel, delta, record.CreatedAt); err != nil {
+			return err
+		}
+		record.AllowanceConsumed = actual
+		return tx.Save(&record).Error
+	})
+}
+
+// SubscriptionAllowanceStatus 订阅下单个模型额度的当前用量
+type SubscriptionAllowanceStatus struct {
+	SubscriptionModelAllowance
+	Used          int64 `json:"used"`
+	Remaining     int64 `json:"remaining"` // -1 = 不限
+	NextResetTime int64 `json:"next_reset_time"`
+}
+
+// GetSubscriptionAllowanceStatuses 返回订阅套餐中各模型额度的用量，只读，不写回重置结果
+func GetSubscriptionAllowanceStatuses(sub *UserSubscription, plan *SubscriptionPlan) ([]SubscriptionAllowanceStatus, error) {
+	allowances := plan.GetModelAllowances()
+	if len(allowances) == 0 {
+		return nil, nil
+	}
+	var usages []SubscriptionAllowanceUsage
+	if err := DB.Where("user_subscription_id = ?", sub.Id).Find(&usages).Error; err != nil {
+		return nil, err
+	}
+	usageByModel := make(map[string]SubscriptionAllowanceUsage, len(usages))
+	for _, u := range usages {
+		usageByModel[u.Model] = u
+	}
+	now := common.GetTimestamp()
+	statuses := make([]SubscriptionAllowanceStatus, 0, len(allowances))
+	for i := range allowances {
+		allowance := &allowances[i]
+		usage, ok := usageByModel[allowance.Model]
+		if !ok {
+			usage = SubscriptionAllowanceUsage{LastResetTime: sub.StartTime}
+		}
+		if usage.advanceResetWindow(sub, allowance, now) {
+			usage.Used = 0
+		}
+		status := SubscriptionAllowanceStatus{
+			SubscriptionModelAllowance: *allowance,
+			Used:                       usage.Used,
+			Remaining:                  -1,
+			NextResetTime:              usage.NextResetTime,
+		}
+		if allowance.Limit > 0 {
+			status.Remaining = max(allowance.Limit-usage.Used, 0)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// FillSubscriptionAllowances 为订阅摘要填充模型额度用量
+func FillSubscriptionAllowances(summaries []SubscriptionSummary) {
+	for i := range summaries {
+		sub := summaries[i].Subscription
+		if sub == nil {
+			continue
+		}
+		plan, err := getSubscriptionPlanByIdTx(nil, sub.PlanId)
+		if err != nil {
+			continue
+		}
+		statuses, err := GetSubscriptionAllowanceStatuses(sub, plan)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to get allowances of subscription %d: %s", sub.Id, err.Error()))
+			continue
+		}
+		summaries[i].Allowances = statuses
+	}
+}
+
+// GetSubscriptionModelDowngrade 当用户所有可用订阅都无法承担该模型且命中的额度配置为降级时，返回降级后的模型名
+func GetSubscriptionModelDowngrade(userId int, modelName string) (string, error) {
+	if userId <= 0 || modelName == "" {
+		return "", nil
+	}
+	now := common.GetTimestamp()
+	var subs []UserSubscription
+	if err := DB.Where("user_id = ? AND status = ? AND end_time > ?", userId, "active", now).
+		Order("end_time asc, id asc").
+		Find(&subs).Error; err != nil {
+		return "", err
+	}
+	var exhausted *SubscriptionModelAllowance
+	for i := range subs {
+		sub := &subs[i]
+		plan, err := getSubscriptionPlanByIdTx(nil, sub.PlanId)
+		if err != nil {
+			return "", err
+		}
+		allowance := plan.MatchModelAllowance(modelName)
+		if allowance == nil {
+			if sub.AmountTotal <= 0 || sub.AmountUsed < sub.AmountTotal || (sub.NextResetTime > 0 && sub.NextResetTime <= now) {
+				return "", nil
+			}
+			continue
+		}
+		if allowance.Limit <= 0 {
+			return "", nil
+		}
+		var usage SubscriptionAllowanceUsage
+		query := DB.Where("user_subscription_id = ? AND model = ?", sub.Id, allowance.Model).Limit(1).Find(&usage)
+		if query.Error != nil {
+			return "", query.Error
+		}
+		if query.RowsAffected == 0 || usage.advanceResetWindow(sub, allowance, now) || usage.Used < allowance.Limit {
+			return "", nil
+		}
+		if exhausted == nil {
+			exhausted = allowance
+		}
+	}
+	if exhausted == nil || exhausted.Overflow != SubscriptionOverflowDowngrade {
+		return "", nil
+	}
+	return exhausted.DowngradeModel, nil
+}
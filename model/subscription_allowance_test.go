@@ -0,0 +1,114 @@
+package model
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestAllowanceUsagePeriodRollover(t *testing.T) {
+	const hour = int64(3600)
+	start := int64(1_000_000)
+	sub := &UserSubscription{Id: 9001, StartTime: start, EndTime: start + 100*hour}
+	allowance := &SubscriptionModelAllowance{
+		Model:              "claude-*",
+		Metric:             SubscriptionAllowanceMetricRequests,
+		Limit:              100,
+		ResetPeriod:        SubscriptionResetCustom,
+		ResetCustomSeconds: hour,
+	}
+	resetTables(t, &SubscriptionAllowanceUsage{})
+
+	getUsage := func(now int64) *SubscriptionAllowanceUsage {
+		t.Helper()
+		var usage *SubscriptionAllowanceUsage
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			usage, err = getAllowanceUsageTx(tx, sub, allowance, now)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("getAllowanceUsageTx: %v", err)
+		}
+		return usage
+	}
+
+	// 首次使用时创建当前周期的记录
+	created := getUsage(start + hour/2)
+	if created.Id == 0 || created.Used != 0 || created.LastResetTime != start || created.NextResetTime != start+hour {
+		t.Fatalf("unexpected created usage: %+v", created)
+	}
+	if err := DB.Model(created).Update("used", 80).Error; err != nil {
+		t.Fatalf("failed to update usage: %v", err)
+	}
+
+	// 同一周期内不重置
+	same := getUsage(start + hour - 1)
+	if same.Id != created.Id || same.Used != 80 {
+		t.Fatalf("expected usage to be kept within the period, got %+v", same)
+	}
+
+	// 跨过多个周期后重置到 now 所在的周期
+	rolled := getUsage(start + 5*hour + hour/2)
+	if rolled.Id != created.Id || rolled.Used != 0 {
+		t.Fatalf("expected usage to reset, got %+v", rolled)
+	}
+	if rolled.LastResetTime != start+5*hour || rolled.NextResetTime != start+6*hour {
+		t.Fatalf("unexpected window after rollover: last=%d next=%d", rolled.LastResetTime, rolled.NextResetTime)
+	}
+	var stored SubscriptionAllowanceUsage
+	if err := DB.First(&stored, created.Id).Error; err != nil {
+		t.Fatalf("failed to reload usage: %v", err)
+	}
+	if stored.Used != 0 || stored.LastResetTime != start+5*hour {
+		t.Fatalf("expected rollover to be persisted, got %+v", stored)
+	}
+	var count int64
+	DB.Model(&SubscriptionAllowanceUsage{}).Where("user_subscription_id = ?", sub.Id).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected a single usage row, got %d", count)
+	}
+
+	// 上一个周期的预扣在重置后不再回补到新周期
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		return adjustAllowanceUsageTx(tx, sub.Id, allowance.Model, -10, start+4*hour)
+	}); err != nil {
+		t.Fatalf("adjustAllowanceUsageTx: %v", err)
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		return adjustAllowanceUsageTx(tx, sub.Id, allowance.Model, 3, start+5*hour+1)
+	}); err != nil {
+		t.Fatalf("adjustAllowanceUsageTx: %v", err)
+	}
+	if err := DB.First(&stored, created.Id).Error; err != nil {
+		t.Fatalf("failed to reload usage: %v", err)
+	}
+	if stored.Used != 3 {
+		t.Fatalf("expected only current-period adjustment to apply, got used=%d", stored.Used)
+	}
+}
+
+func TestCreateAllowanceUsageIgnoresConflict(t *testing.T) {
+	sub := &UserSubscription{Id: 9002, StartTime: 1_000_000, EndTime: 2_000_000}
+	allowance := &SubscriptionModelAllowance{Model: "gpt-4o", ResetPeriod: SubscriptionResetNever}
+	resetTables(t, &SubscriptionAllowanceUsage{})
+
+	// 并发请求先行创建了记录：后来的插入不报错，也不覆盖已有用量
+	existing := SubscriptionAllowanceUsage{UserSubscriptionId: sub.Id, Model: allowance.Model, Used: 7, LastResetTime: sub.StartTime}
+	if err := DB.Create(&existing).Error; err != nil {
+		t.Fatalf("failed to create usage: %v", err)
+	}
+	if err := DB.Transaction(func(tx *gorm.DB) error {
+		return createAllowanceUsageTx(tx, sub, allowance, sub.StartTime+10)
+	}); err != nil {
+		t.Fatalf("expected conflicting create to be ignored, got %v", err)
+	}
+
+	var usages []SubscriptionAllowanceUsage
+	if err := DB.Where("user_subscription_id = ?", sub.Id).Find(&usages).Error; err != nil {
+		t.Fatalf("failed to load usages: %v", err)
+	}
+	if len(usages) != 1 || usages[0].Id != existing.Id || usages[0].Used != 7 {
+		t.Fatalf("expected the existing usage to be kept, got %+v", usages)
+	}
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+// SubscriptionCurrencyPrice 套餐在某一货币下的原生定价。
+// Stripe 与 Creem 需为该货币单独配置价格或产品，未配置时沿用套餐默认的价格 ID / 产品 ID
+type SubscriptionCurrencyPrice struct {
+	Currency       string  `json:"currency"`
+	PriceAmount    float64 `json:"price_amount"`
+	StripePriceId  string  `json:"stripe_price_id,omitempty"`
+	CreemProductId string  `json:"creem_product_id,omitempty"`
+}
+
+func ParseSubscriptionCurrencyPrices(raw string) ([]SubscriptionCurrencyPrice, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	var prices []SubscriptionCurrencyPrice
+	if err := common.Unmarshal([]byte(raw), &prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// NormalizeSubscriptionCurrencyPrices 校验并规范化套餐的多币种定价
+func NormalizeSubscriptionCurrencyPrices(raw string, baseCurrency string) (string, error) {
+	prices, err := ParseSubscriptionCurrencyPrices(raw)
+	if err != nil {
+		return "", fmt.Errorf("多币种定价格式错误: %w", err)
+	}
+	if len(prices) == 0 {
+		return "", nil
+	}
+	baseCurrency = NormalizeCurrency(baseCurrency)
+	seen := make(map[string]struct{}, len(prices))
+	for i := range prices {
+		p := &prices[i]
+		p.Currency = NormalizeCurrency(p.Currency)
+		p.StripePriceId = strings.TrimSpace(p.StripePriceId)
+		p.CreemProductId = strings.TrimSpace(p.CreemProductId)
+		if len(p.Currency) != 3 {
+			return "", errors.New("货币代码需为 3 位 ISO 4217 代码")
+		}
+		if p.Currency == baseCurrency {
+			return "", fmt.Errorf("%s 为套餐默认货币，无需重复配置", p.Currency)
+		}
+		if _, ok := seen[p.Currency]; ok {
+			return "", fmt.Errorf("货币重复: %s", p.Currency)
+		}
+		seen[p.Currency] = struct{}{}
+		if p.PriceAmount < 0.01 || p.PriceAmount > 999999 {
+			return "", fmt.Errorf("%s 价格无效", p.Currency)
+		}
+	}
+	return common.GetJsonString(prices), nil
+}
+
+// GetCurrencyPrice 套餐在指定货币下的原生定价
+func (p *SubscriptionPlan) GetCurrencyPrice(currency string) (*SubscriptionCurrencyPrice, bool) {
+	currency = NormalizeCurrency(currency)
+	if currency == "" {
+		return nil, false
+	}
+	prices, err := ParseSubscriptionCurrencyPrices(p.CurrencyPrices)
+	if err != nil {
+		return nil, false
+	}
+	for i := range prices {
+		if prices[i].Currency == currency {
+			return &prices[i], true
+		}
+	}
+	return nil, false
+}
+
+// ForCurrency 返回按指定货币定价的套餐副本，未配置该货币时返回原套餐
+func (p *SubscriptionPlan) ForCurrency(currency string) *SubscriptionPlan {
+	price, ok := p.GetCurrencyPrice(currency)
+	if !ok {
+		return p
+	}
+	localized := *p
+	localized.Currency = price.Currency
+	localized.PriceAmount = price.PriceAmount
+	if price.StripePriceId != "" {
+		localized.StripePriceId = price.StripePriceId
+	}
+	if price.CreemProductId != "" {
+		localized.CreemProductId = price.CreemProductId
+	}
+	return &localized
+}
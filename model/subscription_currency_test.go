@@ -0,0 +1,70 @@
+package model
+
+import "testing"
+
+func TestNormalizeSubscriptionCurrencyPrices(t *testing.T) {
+	got, err := NormalizeSubscriptionCurrencyPrices(`[{"currency":" eur ","price_amount":9.5,"stripe_price_id":" price_eur "}]`, "USD")
+	if err != nil {
+		t.Fatalf("NormalizeSubscriptionCurrencyPrices: %v", err)
+	}
+	prices, _ := ParseSubscriptionCurrencyPrices(got)
+	if len(prices) != 1 || prices[0].Currency != "EUR" || prices[0].StripePriceId != "price_eur" {
+		t.Fatalf("unexpected normalized prices %+v", prices)
+	}
+	if got, err := NormalizeSubscriptionCurrencyPrices(" ", "USD"); err != nil || got != "" {
+		t.Fatalf("expected empty prices, got %q, %v", got, err)
+	}
+
+	invalid := map[string]string{
+		"bad json":         `{`,
+		"bad code":         `[{"currency":"EURO","price_amount":9}]`,
+		"base currency":    `[{"currency":"usd","price_amount":9}]`,
+		"duplicate":        `[{"currency":"EUR","price_amount":9},{"currency":"eur","price_amount":8}]`,
+		"price too low":    `[{"currency":"EUR","price_amount":0.001}]`,
+		"price too high":   `[{"currency":"EUR","price_amount":1000000}]`,
+		"negative price":   `[{"currency":"EUR","price_amount":-1}]`,
+		"missing currency": `[{"price_amount":9}]`,
+	}
+	for name, raw := range invalid {
+		if _, err := NormalizeSubscriptionCurrencyPrices(raw, "USD"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestSubscriptionPlanForCurrency(t *testing.T) {
+	plan := &SubscriptionPlan{
+		Id:             1,
+		Currency:       "USD",
+		PriceAmount:    10,
+		StripePriceId:  "price_usd",
+		CreemProductId: "prod_usd",
+		CurrencyPrices: `[{"currency":"EUR","price_amount":9.5,"stripe_price_id":"price_eur"},{"currency":"JPY","price_amount":1500}]`,
+	}
+
+	eur := plan.ForCurrency("eur")
+	if eur == plan || eur.Currency != "EUR" || eur.PriceAmount != 9.5 || eur.StripePriceId != "price_eur" {
+		t.Fatalf("unexpected EUR plan %+v", eur)
+	}
+	// 未单独配置 Creem 产品时沿用默认产品
+	if eur.CreemProductId != "prod_usd" {
+		t.Fatalf("expected default creem product, got %s", eur.CreemProductId)
+	}
+	if jpy := plan.ForCurrency("JPY"); jpy.PriceAmount != 1500 || jpy.StripePriceId != "price_usd" {
+		t.Fatalf("unexpected JPY plan %+v", jpy)
+	}
+	// 未配置的货币与空货币返回原套餐，且不修改原套餐
+	for _, currency := range []string{"GBP", "", "USD"} {
+		if got := plan.ForCurrency(currency); got != plan {
+			t.Fatalf("ForCurrency(%q) should return the default plan", currency)
+		}
+	}
+	if plan.Currency != "USD" || plan.PriceAmount != 10 {
+		t.Fatalf("default plan modified: %+v", plan)
+	}
+
+	broken := &SubscriptionPlan{Currency: "USD", PriceAmount: 10, CurrencyPrices: "not json"}
+	if got := broken.ForCurrency("EUR"); got != broken {
+		t.Fatal("expected invalid currency prices to fall back to the default plan")
+	}
+}
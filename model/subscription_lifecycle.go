@@ -0,0 +1,476 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"gorm.io/gorm"
+)
+
+var ErrUserSubscriptionNotFound = errors.New("subscription not found")
+
+// 续费回调的新周期结束时间与当前结束时间相差不超过该值时，视为首期账单（已由下单流程处理）
+const subscriptionRenewalTolerance = int64(12 * 3600)
+
+// GetUserSubscriptionByIdForUser returns a subscription owned by the given user.
+func GetUserSubscriptionByIdForUser(userId int, userSubscriptionId int) (*UserSubscription, error) {
+	if userId <= 0 || userSubscriptionId <= 0 {
+		return nil, errors.New("invalid args")
+	}
+	var sub UserSubscription
+	if err := DB.Where("id = ? AND user_id = ?", userSubscriptionId, userId).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GetUserSubscriptionByProviderId returns the latest subscription bound to a provider subscription.
+func GetUserSubscriptionByProviderId(providerSubscriptionId string) (*UserSubscription, error) {
+	providerSubscriptionId = strings.TrimSpace(providerSubscriptionId)
+	if providerSubscriptionId == "" {
+		return nil, ErrUserSubscriptionNotFound
+	}
+	var sub UserSubscription
+	query := DB.Where("provider_subscription_id = ?", providerSubscriptionId).
+		Order("id desc").
+		Limit(1).
+		Find(&sub)
+	if query.Error != nil {
+		return nil, query.Error
+	}
+	if query.RowsAffected == 0 {
+		return nil, ErrUserSubscriptionNotFound
+	}
+	return &sub, nil
+}
+
+// SubscriptionRenewal describes a successful recurring payment reported by a provider webhook.
+type SubscriptionRenewal struct {
+	ProviderSubscriptionId string
+	TradeNo                string  // provider invoice / transaction id, used for idempotency
+	PaymentMethod          string  // stripe / creem
+	Money                  float64 // 0 = plan price
+	Currency               string  // currency reported by provider, empty = plan currency
+	PeriodEnd              int64   // new period end reported by provider, 0 = extend by plan duration
+	ProviderPayload        string
+}
+
+// RenewUserSubscriptionByProvider extends an auto-renew subscription for a new billing period (idempotent).
+// Returns nil subscription when the payment was already processed or belongs to the first period.
+func RenewUserSubscriptionByProvider(renewal SubscriptionRenewal) (*UserSubscription, error) {
+	if strings.TrimSpace(renewal.ProviderSubscriptionId) == "" || strings.TrimSpace(renewal.TradeNo) == "" {
+		return nil, errors.New("invalid renewal args")
+	}
+	var renewed *UserSubscription
+	var planTitle string
+	var money float64
+	cacheGroup := ""
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&SubscriptionOrder{}).Where("trade_no = ?", renewal.TradeNo).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return nil
+		}
+		var sub UserSubscription
+		query := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("provider_subscription_id = ?", renewal.ProviderSubscriptionId).
+			Order("id desc").
+			Limit(1).
+			Find(&sub)
+		if query.Error != nil {
+			return query.Error
+		}
+		if query.RowsAffected == 0 {
+			return ErrUserSubscriptionNotFound
+		}
+		if sub.Status == "cancelled" {
+			return errors.New("subscription has been cancelled")
+		}
+		plan, err := getSubscriptionPlanByIdTx(tx, sub.PlanId)
+		if err != nil {
+			return err
+		}
+		now := GetDBTimestamp()
+		start := sub.EndTime
+		if start < now {
+			start = now
+		}
+		newEnd := renewal.PeriodEnd
+		if newEnd <= 0 {
+			newEnd, err = calcPlanEndTime(time.Unix(start, 0), plan)
+			if err != nil {
+				return err
+			}
+		}
+		if sub.Status == "active" && newEnd <= sub.EndTime+subscriptionRenewalTolerance {
+			return nil
+		}
+		if start >= newEnd {
+			start = now
+		}
+		nextReset := calcNextResetTime(time.Unix(start, 0), plan, newEnd)
+		lastReset := int64(0)
+		if nextReset > 0 {
+			lastReset = start
+		}
+
+		upgradeGroup := strings.TrimSpace(plan.UpgradeGroup)
+		prevGroup := sub.PrevUserGroup
+		if upgradeGroup != "" {
+			currentGroup, err := getUserGroupByIdTx(tx, sub.UserId)
+			if err != nil {
+				return err
+			}
+			if currentGroup != upgradeGroup {
+				if prevGroup == "" {
+					prevGroup = currentGroup
+				}
+				if err := tx.Model(&User{}).Where("id = ?", sub.UserId).
+					Update("group", upgradeGroup).Error; err != nil {
+					return err
+				}
+				cacheGroup = upgradeGroup
+			}
+		}
+
+		if err := tx.Model(&sub).Updates(map[string]interface{}{
+			"amount_total":         plan.TotalAmount,
+			"amount_used":          0,
+			"start_time":           start,
+			"end_time":             newEnd,
+			"status":               "active",
+			"last_reset_time":      lastReset,
+			"next_reset_time":      nextReset,
+			"upgrade_group":        upgradeGroup,
+			"prev_user_group":      prevGroup,
+			"auto_renew":           true,
+			"renewal_failed_count": 0,
+			"grace_end_time":       0,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_subscription_id = ?", sub.Id).Delete(&SubscriptionAllowanceUsage{}).Error; err != nil {
+			return err
+		}
+
+		money = renewal.Money
+		if money <= 0 {
+			money = plan.PriceAmount
+		}
+		paymentMethod := renewal.PaymentMethod
+		if paymentMethod == "" {
+			paymentMethod = sub.PaymentMethod
+		}
+		order := SubscriptionOrder{
+			UserId:             sub.UserId,
+			PlanId:             plan.Id,
+			Money:              money,
+			Currency:           renewal.Currency,
+			TradeNo:            renewal.TradeNo,
+			PaymentMethod:      paymentMethod,
+			UserSubscriptionId: sub.Id,
+			Status:             common.TopUpStatusSuccess,
+			CreateTime:         common.GetTimestamp(),
+			CompleteTime:       common.GetTimestamp(),
+			ProviderPayload:    renewal.ProviderPayload,
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if err := upsertSubscriptionTopUpTx(tx, &order); err != nil {
+			return err
+		}
+		planTitle = plan.Title
+		renewed = &sub
+		renewed.EndTime = newEnd
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if renewed == nil {
+		return nil, nil
+	}
+	if cacheGroup != "" {
+		_ = UpdateUserGroupCache(renewed.UserId, cacheGroup)
+	}
+	RecordLog(renewed.UserId, LogTypeTopup, fmt.Sprintf("订阅自动续费成功，套餐: %s，支付金额: %.2f，有效期至: %s",
+		planTitle, money, time.Unix(renewed.EndTime, 0).Format("2006-01-02 15:04:05")))
+	return renewed, nil
+}
+
+// MarkSubscriptionRenewalFailed records a failed recurring payment and returns the affected subscription.
+func MarkSubscriptionRenewalFailed(providerSubscriptionId string) (*UserSubscription, error) {
+	sub, err := GetUserSubscriptionByProviderId(providerSubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	if err := DB.Model(sub).Update("renewal_failed_count", gorm.Expr("renewal_failed_count + ?", 1)).Error; err != nil {
+		return nil, err
+	}
+	sub.RenewalFailedCount++
+	return sub, nil
+}
+
+// SyncSubscriptionRenewalState mirrors the provider side cancel state.
+// ended=true means the provider subscription is terminated and will never renew again.
+func SyncSubscriptionRenewalState(providerSubscriptionId string, cancelAtPeriodEnd bool, ended bool) (*UserSubscription, error) {
+	sub, err := GetUserSubscriptionByProviderId(providerSubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"auto_renew":           !cancelAtPeriodEnd && !ended,
+		"cancel_at_period_end": cancelAtPeriodEnd && !ended,
+	}
+	// A terminated subscription no longer waits for a late renewal, end the grace period now.
+	now := common.GetTimestamp()
+	if ended && sub.Status == "expired" && sub.GraceEndTime > now {
+		updates["grace_end_time"] = now
+	}
+	if err := DB.Model(sub).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	sub.AutoRenew = !cancelAtPeriodEnd && !ended
+	sub.CancelAtPeriodEnd = cancelAtPeriodEnd && !ended
+	return sub, nil
+}
+
+// DowngradeGraceEndedSubscriptions restores user groups for expired subscriptions whose grace period ended.
+func DowngradeGraceEndedSubscriptions(limit int) (int, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	now := GetDBTimestamp()
+	var subs []UserSubscription
+	if err := DB.Where("status = ? AND grace_end_time > 0 AND grace_end_time <= ?", "expired", now).
+		Order("grace_end_time asc, id asc").
+		Limit(limit).
+		Find(&subs).Error; err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, sub := range subs {
+		cacheGroup := ""
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&UserSubscription{}).
+				Where("id = ? AND status = ? AND grace_end_time > 0 AND grace_end_time <= ?", sub.Id, "expired", now).
+				Update("grace_end_time", 0)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return nil
+			}
+			count++
+			group, err := restoreUserGroupAfterExpiryTx(tx, sub.UserId, now)
+			if err != nil {
+				return err
+			}
+			cacheGroup = group
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if cacheGroup != "" {
+			_ = UpdateUserGroupCache(sub.UserId, cacheGroup)
+		}
+	}
+	return count, nil
+}
+
+// SubscriptionPlanChange is the result (or preview) of switching a subscription to another plan.
+type SubscriptionPlanChange struct {
+	SubscriptionId int     `json:"subscription_id"`
+	FromPlanId     int     `json:"from_plan_id"`
+	ToPlanId       int     `json:"to_plan_id"`
+	RemainingRatio float64 `json:"remaining_ratio"`
+	Currency       string  `json:"currency"`       // ProratedMoney 的币种，即套餐币种
+	ProratedMoney  float64 `json:"prorated_money"` // >0 补差价，<0 退差价
+	QuotaDelta     int     `json:"quota_delta"`    // 钱包额度变动，负数为扣除
+}
+
+func calcSubscriptionPlanChange(sub *UserSubscription, from *SubscriptionPlan, to *SubscriptionPlan, now int64) (*SubscriptionPlanChange, error) {
+	currency := NormalizeCurrency(from.Currency)
+	if currency == "" {
+		currency = CurrencyUSD
+	}
+	toCurrency := NormalizeCurrency(to.Currency)
+	if toCurrency == "" {
+		toCurrency = CurrencyUSD
+	}
+	if currency != toCurrency {
+		return nil, errors.New("套餐币种不一致，无法变更")
+	}
+	// 钱包额度按美元计，差价需按汇率换算
+	info, ok := GetCurrencyInfo(currency)
+	if !ok {
+		return nil, fmt.Errorf("套餐币种 %s 未配置汇率，无法变更", currency)
+	}
+	ratio := 0.0
+	if sub.EndTime > sub.StartTime && sub.EndTime > now {
+		ratio = float64(sub.EndTime-now) / float64(sub.EndTime-sub.StartTime)
+	}
+	ratio = math.Max(0, math.Min(1, ratio))
+	money := (to.PriceAmount - from.PriceAmount) * ratio
+	return &SubscriptionPlanChange{
+		SubscriptionId: sub.Id,
+		FromPlanId:     from.Id,
+		ToPlanId:       to.Id,
+		RemainingRatio: ratio,
+		Currency:       currency,
+		ProratedMoney:  money,
+		QuotaDelta:     -int(math.Round(money / info.Rate * common.QuotaPerUnit)),
+	}, nil
+}
+
+// ChangeUserSubscriptionPlan switches an active subscription to another plan keeping its end time.
+// The price difference for the remaining period is charged from or credited to the user wallet.
+// With dryRun only the proration is calculated.
+func ChangeUserSubscriptionPlan(userId int, userSubscriptionId int, planId int, dryRun bool) (*SubscriptionPlanChange, error) {
+	if userId <= 0 || userSubscriptionId <= 0 || planId <= 0 {
+		return nil, errors.New("invalid args")
+	}
+	var change *SubscriptionPlanChange
+	var fromTitle, toTitle string
+	cacheGroup := ""
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var sub UserSubscription
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ? AND user_id = ?", userSubscriptionId, userId).
+			First(&sub).Error; err != nil {
+			return ErrUserSubscriptionNotFound
+		}
+		now := GetDBTimestamp()
+		if sub.Status != "active" || sub.EndTime <= now {
+			return errors.New("订阅未生效或已过期")
+		}
+		if sub.PlanId == planId {
+			return errors.New("已是该套餐")
+		}
+		from, err := getSubscriptionPlanByIdTx(tx, sub.PlanId)
+		if err != nil {
+			return err
+		}
+		to, err := getSubscriptionPlanByIdTx(tx, planId)
+		if err != nil {
+			return err
+		}
+		if !to.Enabled || !to.Purchasable {
+			return errors.New("目标套餐不可购买")
+		}
+		if to.MaxPurchasePerUser > 0 {
+			var count int64
+			if err := tx.Model(&UserSubscription{}).
+				Where("user_id = ? AND plan_id = ?", userId, to.Id).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count >= int64(to.MaxPurchasePerUser) {
+				return errors.New("已达到该套餐购买上限")
+			}
+		}
+		change, err = calcSubscriptionPlanChange(&sub, from, to, now)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		fromTitle, toTitle = from.Title, to.Title
+
+		if change.QuotaDelta != 0 {
+			query := tx.Model(&User{}).Where("id = ?", userId)
+			if change.QuotaDelta < 0 {
+				query = query.Where("quota >= ?", -change.QuotaDelta)
+			}
+			res := query.Update("quota", gorm.Expr("quota + ?", change.QuotaDelta))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return fmt.Errorf("钱包余额不足，需补差价 %s", logger.FormatQuota(-change.QuotaDelta))
+			}
+			if err := RecordUserLedger(tx, userId, change.QuotaDelta, LedgerRef{
+				Source:      LedgerSourceSubscription,
+				ReferenceId: fmt.Sprintf("subscription-%d", sub.Id),
+				Remark:      fmt.Sprintf("套餐变更 %s -> %s", from.Title, to.Title),
+			}); err != nil {
+				return err
+			}
+		}
+
+		// 分组随套餐切换，原分组保留为订阅前的分组
+		upgradeGroup := strings.TrimSpace(to.UpgradeGroup)
+		prevGroup := sub.PrevUserGroup
+		if upgradeGroup == "" {
+			cacheGroup, err = downgradeUserGroupForSubscriptionTx(tx, &sub, now)
+			if err != nil {
+				return err
+			}
+		} else {
+			currentGroup, err := getUserGroupByIdTx(tx, userId)
+			if err != nil {
+				return err
+			}
+			if currentGroup != upgradeGroup {
+				if sub.UpgradeGroup == "" || currentGroup != sub.UpgradeGroup {
+					prevGroup = currentGroup
+				}
+				if err := tx.Model(&User{}).Where("id = ?", userId).Update("group", upgradeGroup).Error; err != nil {
+					return err
+				}
+				cacheGroup = upgradeGroup
+			}
+		}
+
+		lastReset := sub.LastResetTime
+		if lastReset <= 0 {
+			lastReset = sub.StartTime
+		}
+		nextReset := calcNextResetTime(time.Unix(lastReset, 0), to, sub.EndTime)
+		if nextReset > 0 && sub.LastResetTime <= 0 {
+			sub.LastResetTime = lastReset
+		}
+		return tx.Model(&sub).Updates(map[string]interface{}{
+			"plan_id":         to.Id,
+			"amount_total":    to.TotalAmount,
+			"upgrade_group":   upgradeGroup,
+			"prev_user_group": prevGroup,
+			"last_reset_time": sub.LastResetTime,
+			"next_reset_time": nextReset,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return change, nil
+	}
+	if change.QuotaDelta < 0 {
+		if err := cacheDecrUserQuota(userId, int64(-change.QuotaDelta)); err != nil {
+			common.SysLog("failed to decrease user quota cache: " + err.Error())
+		}
+	} else if change.QuotaDelta > 0 {
+		if err := cacheIncrUserQuota(userId, int64(change.QuotaDelta)); err != nil {
+			common.SysLog("failed to increase user quota cache: " + err.Error())
+		}
+	}
+	if cacheGroup != "" {
+		_ = UpdateUserGroupCache(userId, cacheGroup)
+	}
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("订阅套餐变更: %s -> %s，剩余周期 %.0f%%，折算差价: %.2f，钱包额度变动: %d",
+		fromTitle, toTitle, change.RemainingRatio*100, change.ProratedMoney, change.QuotaDelta))
+	return change, nil
+}
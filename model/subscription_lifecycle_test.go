@@ -0,0 +1,76 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func TestCalcSubscriptionPlanChange(t *testing.T) {
+	resetTables(t, &ExchangeRate{})
+	if err := DB.Create(&ExchangeRate{Currency: "EUR", Rate: 0.5, Enabled: true}).Error; err != nil {
+		t.Fatalf("failed to create exchange rate: %v", err)
+	}
+	InvalidateExchangeRateCache()
+	t.Cleanup(func() {
+		resetTables(t, &ExchangeRate{})
+		InvalidateExchangeRateCache()
+	})
+
+	sub := &UserSubscription{Id: 1, StartTime: 1000, EndTime: 2000}
+	tests := []struct {
+		name       string
+		currency   string
+		fromPrice  float64
+		toPrice    float64
+		now        int64
+		wantRatio  float64
+		wantMoney  float64
+		wantQuota  int
+		wantErr    bool
+		toCurrency string
+	}{
+		{name: "usd upgrade half period", currency: "USD", fromPrice: 10, toPrice: 30, now: 1500,
+			wantRatio: 0.5, wantMoney: 10, wantQuota: -int(10 * common.QuotaPerUnit)},
+		{name: "usd downgrade refunds", currency: "USD", fromPrice: 30, toPrice: 10, now: 1750,
+			wantRatio: 0.25, wantMoney: -5, wantQuota: int(5 * common.QuotaPerUnit)},
+		{name: "empty currency treated as usd", currency: "", fromPrice: 0, toPrice: 4, now: 1000,
+			wantRatio: 1, wantMoney: 4, wantQuota: -int(4 * common.QuotaPerUnit)},
+		{name: "non usd converted by exchange rate", currency: "eur", fromPrice: 10, toPrice: 20, now: 1500,
+			wantRatio: 0.5, wantMoney: 5, wantQuota: -int(10 * common.QuotaPerUnit)},
+		{name: "expired period has no proration", currency: "USD", fromPrice: 10, toPrice: 30, now: 3000,
+			wantRatio: 0, wantMoney: 0, wantQuota: 0},
+		{name: "unknown currency refused", currency: "XYZ", fromPrice: 10, toPrice: 30, now: 1500, wantErr: true},
+		{name: "mismatched currency refused", currency: "USD", toCurrency: "EUR", fromPrice: 10, toPrice: 30, now: 1500, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toCurrency := tt.toCurrency
+			if toCurrency == "" {
+				toCurrency = tt.currency
+			}
+			from := &SubscriptionPlan{Id: 1, Currency: tt.currency, PriceAmount: tt.fromPrice}
+			to := &SubscriptionPlan{Id: 2, Currency: toCurrency, PriceAmount: tt.toPrice}
+			change, err := calcSubscriptionPlanChange(sub, from, to, tt.now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(change.RemainingRatio-tt.wantRatio) > 1e-9 {
+				t.Errorf("ratio = %v, want %v", change.RemainingRatio, tt.wantRatio)
+			}
+			if math.Abs(change.ProratedMoney-tt.wantMoney) > 1e-9 {
+				t.Errorf("money = %v, want %v", change.ProratedMoney, tt.wantMoney)
+			}
+			if change.QuotaDelta != tt.wantQuota {
+				t.Errorf("quota delta = %d, want %d", change.QuotaDelta, tt.wantQuota)
+			}
+		})
+	}
+}
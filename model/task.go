@@ -8,6 +8,7 @@ import (
 	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/dto"
 	commonRelay "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/setting/ratio_setting"
 )
 
 type TaskStatus string
@@ -77,6 +78,10 @@ type Properties struct {
 	Input             string `json:"input"`
 	UpstreamModelName string `json:"upstream_model_name,omitempty"`
 	OriginModelName   string `json:"origin_model_name,omitempty"`
+	// 视频按秒计费明细，提交时为预估值，结算后为实际值
+	VideoPricing *ratio_setting.VideoPriceBreakdown `json:"video_pricing,omitempty"`
+	// 管理员已强制退款，任务之后成功也不再按实际用量补扣
+	Refunded bool `json:"refunded,omitempty"`
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -97,6 +102,11 @@ func (m Properties) Value() (driver.Value, error) {
 
 type TaskPrivateData struct {
 	Key string `json:"key,omitempty"`
+	// 通过项目令牌提交的任务从组织钱包扣费，退款与补扣同样作用于组织钱包
+	OrgId     int `json:"org_id,omitempty"`
+	ProjectId int `json:"project_id,omitempty"`
+	// 提交任务所用的令牌，结算差额时同步修正令牌剩余额度
+	TokenId int `json:"token_id,omitempty"`
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -141,6 +151,13 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 			properties.OriginModelName = relayInfo.OriginModelName
 		}
 	}
+	if relayInfo != nil && !relayInfo.IsPlayground {
+		privateData.TokenId = relayInfo.TokenId
+	}
+	if relayInfo != nil && relayInfo.OrgId != 0 {
+		privateData.OrgId = relayInfo.OrgId
+		privateData.ProjectId = relayInfo.ProjectId
+	}
 
 	t := &Task{
 		UserId:      relayInfo.UserId,
@@ -247,13 +264,60 @@ func GetAllUnFinishSyncTasks(limit int) []*Task {
 	var tasks []*Task
 	var err error
 	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).Limit(limit).Order("id").Find(&tasks).Error
+	// MJ 任务由 MJ 轮询负责更新，这里只同步其结果
+	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).
+		Where("platform != ?", constant.TaskPlatformMidjourney).Limit(limit).Order("id").Find(&tasks).Error
 	if err != nil {
 		return nil
 	}
 	return tasks
 }
 
+// RefundQuota 将额度退还给任务的付款方（组织钱包或用户钱包）
+func (t *Task) RefundQuota(quota int) error {
+	if t.PrivateData.OrgId != 0 {
+		if err := RefundOrganizationQuota(t.PrivateData.OrgId, quota, LedgerRef{Source: LedgerSourceRefund, ReferenceId: t.TaskID}); err != nil {
+			return err
+		}
+		return UpdateProjectUsedQuota(t.PrivateData.ProjectId, -quota)
+	}
+	return IncreaseUserQuota(t.UserId, quota, false, LedgerRef{Source: LedgerSourceRefund, ReferenceId: t.TaskID})
+}
+
+// ChargeQuota 向任务的付款方补扣额度
+func (t *Task) ChargeQuota(quota int) error {
+	if t.PrivateData.OrgId != 0 {
+		if err := ConsumeOrganizationQuota(t.PrivateData.OrgId, quota, LedgerRef{Source: LedgerSourceConsume, ReferenceId: t.TaskID}); err != nil {
+			return err
+		}
+		return UpdateProjectUsedQuota(t.PrivateData.ProjectId, quota)
+	}
+	return DecreaseUserQuota(t.UserId, quota, LedgerRef{Source: LedgerSourceConsume, ReferenceId: t.TaskID})
+}
+
+// AdjustTokenQuota 按结算差额修正提交任务所用令牌的剩余额度，delta 为负数时退还
+func (t *Task) AdjustTokenQuota(delta int) error {
+	if t.PrivateData.TokenId == 0 || delta == 0 {
+		return nil
+	}
+	token, err := GetTokenById(t.PrivateData.TokenId)
+	if err != nil {
+		return err
+	}
+	if delta > 0 {
+		return DecreaseTokenQuota(token.Id, token.Key, delta)
+	}
+	return IncreaseTokenQuota(token.Id, token.Key, -delta)
+}
+
+func GetTaskById(id int64) (*Task, error) {
+	var task Task
+	if err := DB.First(&task, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -313,6 +377,16 @@ func (Task *Task) Update() error {
 	return err
 }
 
+// UpdateWithStatus 仅当任务的状态与额度仍是读取时的值才保存，返回是否由本次调用完成更新。
+// 后台轮询与管理员操作可能同时处理同一任务，调用方只在更新成功后退款或补扣，避免重复退还
+func (t *Task) UpdateWithStatus(fromStatus TaskStatus, fromQuota int) (bool, error) {
+	result := DB.Model(t).Where("status = ? AND quota = ?", fromStatus, fromQuota).Select("*").Updates(t)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
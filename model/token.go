@@ -3,9 +3,11 @@ package model
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -14,7 +16,8 @@ import (
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index;index:idx_token_user_status,priority:1"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"` // 密钥哈希，旧版未迁移的令牌为明文
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);index;default:''"`
 	Status             int            `json:"status" gorm:"default:1;index:idx_token_user_status,priority:2"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -28,6 +31,13 @@ type Token struct {
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	ProjectId          int            `json:"project_id" gorm:"default:0;index"`
+	Scopes             string         `json:"scopes" gorm:"type:varchar(255);default:''"` // 逗号分隔的作用域，为空表示不限制
+	MaxOutputTokens    int            `json:"max_output_tokens" gorm:"default:0"`         // 单次请求 max_tokens 上限，0 表示不限制
+	MaxInputTokens     int            `json:"max_input_tokens" gorm:"default:0"`          // 单次请求预估输入 tokens 上限，0 表示不限制，依赖 token 统计（CountToken）
+	DisableTools       bool           `json:"disable_tools"`                              // 禁止请求携带工具（函数调用）
+	DisableWebSearch   bool           `json:"disable_web_search"`                         // 禁止联网搜索
+	DerivedRevokedAt   int64          `json:"derived_revoked_at" gorm:"bigint;default:0"` // 此时间及之前签发的派生令牌均已失效
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -141,11 +151,24 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		baseQuery = baseQuery.Where("name LIKE ? ESCAPE '!'", keywordPattern)
 	}
 	if token != "" {
-		tokenPattern, err := sanitizeLikePattern(token)
-		if err != nil {
-			return nil, 0, err
+		// 密钥以哈希存储：完整密钥精确匹配，否则按前缀搜索
+		tokenFuzzy := strings.Contains(token, "%")
+		if len(token) == tokenKeyLength && !tokenFuzzy {
+			keyHash, err := HashTokenKey(token)
+			if err != nil {
+				return nil, 0, err
+			}
+			baseQuery = baseQuery.Where(commonKeyCol+" = ?", keyHash)
+		} else {
+			if !tokenFuzzy {
+				token = tokenKeyPrefix(token)
+			}
+			tokenPattern, err := sanitizeLikePattern(token)
+			if err != nil {
+				return nil, 0, err
+			}
+			baseQuery = baseQuery.Where("key_prefix LIKE ? ESCAPE '!'", tokenPattern)
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -240,7 +263,22 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
-func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
+// GetTokenByKey 按用户提供的明文密钥查询令牌
+func GetTokenByKey(key string, fromDB bool) (*Token, error) {
+	keyHash, err := HashTokenKey(key)
+	if err != nil {
+		return nil, err
+	}
+	token, err := GetTokenByKeyHash(keyHash, fromDB)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return token, err
+	}
+	// 尚未迁移的旧令牌仍以明文存储
+	return migrateLegacyTokenKey(key, keyHash)
+}
+
+// GetTokenByKeyHash 按存储的密钥哈希查询令牌，用于请求上下文中已认证的令牌
+func GetTokenByKeyHash(key string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) && token != nil {
@@ -283,7 +321,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "project_id",
+		"scopes", "max_output_tokens", "max_input_tokens", "disable_tools", "disable_web_search").Updates(token).Error
 	return err
 }
 
@@ -337,6 +376,52 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+func (token *Token) GetScopes() []string {
+	scopes := make([]string, 0)
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// HasScope 令牌未设置作用域时视为拥有全部作用域
+func (token *Token) HasScope(scope string) bool {
+	scopes := token.GetScopes()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeRequestLimits 校验作用域与请求限制，并将作用域整理为去重后的逗号分隔格式
+func (token *Token) NormalizeRequestLimits() error {
+	scopes := make([]string, 0)
+	for _, scope := range token.GetScopes() {
+		if !constant.IsValidTokenScope(scope) {
+			return fmt.Errorf("无效的令牌作用域: %s", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	token.Scopes = strings.Join(scopes, ",")
+	if len(token.Scopes) > 255 {
+		return errors.New("令牌作用域过长")
+	}
+	if token.MaxOutputTokens < 0 || token.MaxInputTokens < 0 {
+		return errors.New("令牌 tokens 上限不能为负数")
+	}
+	return nil
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
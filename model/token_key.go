@@ -0,0 +1,232 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// 令牌以加盐哈希存储：Key 列保存 HMAC-SHA256(盐, 明文) 的前 48 位十六进制，
+// KeyPrefix 保存明文前 8 位用于识别。明文仅在创建或重置时返回一次
+const (
+	tokenKeyLength       = 48
+	tokenKeyPrefixLength = 8
+	tokenKeyHashLength   = 48
+
+	TokenHashSecretOptionKey = "TokenHashSecret"
+)
+
+var (
+	tokenHashSecret     string
+	tokenHashSecretLock sync.Mutex
+)
+
+// getTokenHashSecret 优先使用环境变量 TOKEN_HASH_SECRET，否则使用首次启动时生成并保存在数据库中的盐，
+// 多节点共享同一条记录
+func getTokenHashSecret() (string, error) {
+	tokenHashSecretLock.Lock()
+	defer tokenHashSecretLock.Unlock()
+	if tokenHashSecret != "" {
+		return tokenHashSecret, nil
+	}
+	if secret := strings.TrimSpace(os.Getenv("TOKEN_HASH_SECRET")); secret != "" {
+		tokenHashSecret = secret
+		return tokenHashSecret, nil
+	}
+	option := Option{Key: TokenHashSecretOptionKey}
+	err := DB.Where(&Option{Key: TokenHashSecretOptionKey}).Attrs(Option{Value: common.GetRandomString(64)}).FirstOrCreate(&option).Error
+	if err != nil {
+		// 其他节点可能同时创建，重新读取一次
+		if err = DB.Where(&Option{Key: TokenHashSecretOptionKey}).First(&option).Error; err != nil {
+			return "", fmt.Errorf("failed to load token hash secret: %w", err)
+		}
+	}
+	if option.Value == "" {
+		return "", errors.New("token hash secret is empty")
+	}
+	tokenHashSecret = option.Value
+	return tokenHashSecret, nil
+}
+
+// HashTokenKey 计算令牌明文的存储哈希
+func HashTokenKey(key string) (string, error) {
+	secret, err := getTokenHashSecret()
+	if err != nil {
+		return "", err
+	}
+	return common.GenerateHMACWithKey([]byte(secret), key)[:tokenKeyHashLength], nil
+}
+
+func tokenKeyPrefix(key string) string {
+	if len(key) <= tokenKeyPrefixLength {
+		return key
+	}
+	return key[:tokenKeyPrefixLength]
+}
+
+// SetKey 设置令牌明文，仅保存哈希与前缀
+func (token *Token) SetKey(key string) error {
+	keyHash, err := HashTokenKey(key)
+	if err != nil {
+		return err
+	}
+	token.Key = keyHash
+	token.KeyPrefix = tokenKeyPrefix(key)
+	return nil
+}
+
+// IsKeyHashed 旧版令牌在迁移前仍以明文存储，KeyPrefix 为空
+func (token *Token) IsKeyHashed() bool {
+	return token.KeyPrefix != ""
+}
+
+// HideKey 返回给前端前隐藏密钥哈希，只展示前缀
+func (token *Token) HideKey() {
+	if token.IsKeyHashed() {
+		token.Key = ""
+	}
+}
+
+func HideTokenKeys(tokens []*Token) {
+	for _, token := range tokens {
+		token.HideKey()
+	}
+}
+
+// RegenerateKey 重置令牌密钥，返回新的明文，旧密钥立即失效
+func (token *Token) RegenerateKey() (string, error) {
+	key, err := common.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	oldKey := token.Key
+	if err := token.SetKey(key); err != nil {
+		return "", err
+	}
+	// 重置密钥同时吊销此前签发的派生令牌
+	token.DerivedRevokedAt = common.GetTimestamp()
+	if err := DB.Model(token).Select("key", "key_prefix", "derived_revoked_at").Updates(token).Error; err != nil {
+		return "", err
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheDeleteToken(oldKey); err != nil {
+				common.SysLog("failed to delete token cache: " + err.Error())
+			}
+		})
+	}
+	return key, nil
+}
+
+// migrateLegacyTokenKey 旧版明文令牌在首次使用时迁移为哈希存储
+func migrateLegacyTokenKey(key string, keyHash string) (*Token, error) {
+	var token Token
+	if err := DB.Where(commonKeyCol+" = ? AND key_prefix = ?", key, "").First(&token).Error; err != nil {
+		return nil, err
+	}
+	err := DB.Model(&Token{}).Where("id = ? AND key_prefix = ?", token.Id, "").Updates(map[string]interface{}{
+		"key":        keyHash,
+		"key_prefix": tokenKeyPrefix(key),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	token.Key = keyHash
+	token.KeyPrefix = tokenKeyPrefix(key)
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			_ = cacheDeleteToken(key)
+			if err := cacheSetToken(token); err != nil {
+				common.SysLog("failed to update token cache: " + err.Error())
+			}
+		})
+	}
+	return &token, nil
+}
+
+// MigrateLegacyTokenKeys 将所有明文存储的令牌批量迁移为哈希，返回迁移数量
+func MigrateLegacyTokenKeys() (int, error) {
+	migrated := 0
+	lastId := 0
+	for {
+		var tokens []Token
+		err := DB.Unscoped().Select("id", "key").Where("key_prefix = ? AND id > ?", "", lastId).
+			Order("id asc").Limit(500).Find(&tokens).Error
+		if err != nil {
+			return migrated, err
+		}
+		if len(tokens) == 0 {
+			return migrated, nil
+		}
+		for _, t := range tokens {
+			lastId = t.Id
+			if t.Key == "" {
+				continue
+			}
+			keyHash, err := HashTokenKey(t.Key)
+			if err != nil {
+				return migrated, err
+			}
+			result := DB.Unscoped().Model(&Token{}).Where("id = ? AND key_prefix = ?", t.Id, "").Updates(map[string]interface{}{
+				"key":        keyHash,
+				"key_prefix": tokenKeyPrefix(t.Key),
+			})
+			if result.Error != nil {
+				return migrated, result.Error
+			}
+			if result.RowsAffected > 0 {
+				migrated++
+				if common.RedisEnabled {
+					_ = cacheDeleteToken(t.Key)
+				}
+			}
+		}
+	}
+}
+
+// EncryptPlainChannelKeys 配置主密钥后将明文存储的渠道密钥加密，返回加密数量
+func EncryptPlainChannelKeys() (int, error) {
+	if !common.ChannelKeyEncryptionEnabled() {
+		return 0, nil
+	}
+	var channels []Channel
+	if err := DB.Select("id", "key").Where(commonKeyCol+" NOT LIKE ?", "enc:v1:%").Find(&channels).Error; err != nil {
+		return 0, err
+	}
+	encrypted := 0
+	for _, ch := range channels {
+		if ch.Key == "" {
+			continue
+		}
+		cipherKey, err := common.EncryptChannelKey(ch.Key)
+		if err != nil {
+			return encrypted, err
+		}
+		err = DB.Session(&gorm.Session{SkipHooks: true}).Model(&Channel{}).Where("id = ?", ch.Id).Update("key", cipherKey).Error
+		if err != nil {
+			return encrypted, err
+		}
+		encrypted++
+	}
+	return encrypted, nil
+}
+
+// MigrateCredentialStorage 启动时迁移旧版明文令牌与渠道密钥，仅在主节点执行
+func MigrateCredentialStorage() {
+	if n, err := MigrateLegacyTokenKeys(); err != nil {
+		common.SysError("failed to migrate legacy token keys: " + err.Error())
+	} else if n > 0 {
+		common.SysLog(fmt.Sprintf("migrated %d legacy token keys to hashed storage", n))
+	}
+	if n, err := EncryptPlainChannelKeys(); err != nil {
+		common.SysError("failed to encrypt channel keys: " + err.Error())
+	} else if n > 0 {
+		common.SysLog(fmt.Sprintf("encrypted %d channel keys at rest", n))
+	}
+}
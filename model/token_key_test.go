@@ -0,0 +1,124 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func createLegacyTestToken(t *testing.T, key string) *Token {
+	t.Helper()
+	token := &Token{
+		UserId:         1,
+		Key:            key,
+		Name:           "legacy",
+		ExpiredTime:    -1,
+		UnlimitedQuota: true,
+		Status:         common.TokenStatusEnabled,
+	}
+	if err := token.Insert(); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	return token
+}
+
+func TestHashTokenKey(t *testing.T) {
+	key := common.GetRandomString(48)
+	hash, err := HashTokenKey(key)
+	if err != nil {
+		t.Fatalf("failed to hash key: %v", err)
+	}
+	if len(hash) != tokenKeyHashLength || hash == key[:tokenKeyHashLength] {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	secret, _ := getTokenHashSecret()
+	if want := common.GenerateHMACWithKey([]byte(secret), key)[:tokenKeyHashLength]; hash != want {
+		t.Fatalf("hash = %s, want HMAC-SHA256 prefix %s", hash, want)
+	}
+	again, _ := HashTokenKey(key)
+	if again != hash {
+		t.Fatal("expected hashing to be deterministic")
+	}
+	other, _ := HashTokenKey(key + "x")
+	if other == hash {
+		t.Fatal("expected different keys to hash differently")
+	}
+
+	var token Token
+	if err := token.SetKey(key); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if token.Key != hash || token.KeyPrefix != key[:tokenKeyPrefixLength] || !token.IsKeyHashed() {
+		t.Fatalf("unexpected stored key %q prefix %q", token.Key, token.KeyPrefix)
+	}
+	token.HideKey()
+	if token.Key != "" {
+		t.Fatal("expected HideKey to clear the hash")
+	}
+}
+
+func TestGetTokenByKeyMigratesLegacyToken(t *testing.T) {
+	key := common.GetRandomString(48)
+	legacy := createLegacyTestToken(t, key)
+
+	token, err := GetTokenByKey(key, true)
+	if err != nil {
+		t.Fatalf("failed to look up legacy token: %v", err)
+	}
+	if token.Id != legacy.Id {
+		t.Fatalf("got token %d, want %d", token.Id, legacy.Id)
+	}
+	hash, _ := HashTokenKey(key)
+	var stored Token
+	if err := DB.First(&stored, legacy.Id).Error; err != nil {
+		t.Fatalf("failed to reload token: %v", err)
+	}
+	if stored.Key != hash || stored.KeyPrefix != key[:tokenKeyPrefixLength] {
+		t.Fatalf("expected token to be migrated, got key %q prefix %q", stored.Key, stored.KeyPrefix)
+	}
+	// 迁移后按哈希查询，明文不再出现在数据库中
+	if token, err = GetTokenByKey(key, true); err != nil || token.Id != legacy.Id {
+		t.Fatalf("failed to look up migrated token: %v", err)
+	}
+}
+
+func TestMigrateLegacyTokenKeys(t *testing.T) {
+	keys := []string{common.GetRandomString(48), common.GetRandomString(48)}
+	ids := make([]int, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, createLegacyTestToken(t, key).Id)
+	}
+	hashed := &Token{UserId: 1, Name: "hashed", ExpiredTime: -1}
+	if err := hashed.SetKey(common.GetRandomString(48)); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+	if err := hashed.Insert(); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	hashedKey := hashed.Key
+
+	migrated, err := MigrateLegacyTokenKeys()
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if migrated < len(keys) {
+		t.Fatalf("migrated %d tokens, want at least %d", migrated, len(keys))
+	}
+	for i, id := range ids {
+		var stored Token
+		if err := DB.First(&stored, id).Error; err != nil {
+			t.Fatalf("failed to reload token: %v", err)
+		}
+		hash, _ := HashTokenKey(keys[i])
+		if stored.Key != hash || stored.KeyPrefix != keys[i][:tokenKeyPrefixLength] {
+			t.Fatalf("token %d not migrated: key %q prefix %q", id, stored.Key, stored.KeyPrefix)
+		}
+	}
+	var stored Token
+	if err := DB.First(&stored, hashed.Id).Error; err != nil || stored.Key != hashedKey {
+		t.Fatal("expected already hashed token to be left unchanged")
+	}
+	if again, err := MigrateLegacyTokenKeys(); err != nil || again != 0 {
+		t.Fatalf("expected second migration to be a no-op, got %d, %v", again, err)
+	}
+}
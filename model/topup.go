@@ -16,11 +16,25 @@ type TopUp struct {
 	UserId        int     `json:"user_id" gorm:"index"`
 	Amount        int64   `json:"amount"`
 	Money         float64 `json:"money"`
+	Currency      string  `json:"currency" gorm:"type:varchar(8);default:''"` // 支付货币，空表示渠道默认货币
 	TradeNo       string  `json:"trade_no" gorm:"unique;type:varchar(255);index"`
 	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50)"`
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	// 支付渠道侧的订单号（Stripe Checkout Session、PayPal Order 等），用于查单与退款
+	ProviderOrderId string  `json:"provider_order_id" gorm:"type:varchar(128);default:''"`
+	RefundedMoney   float64 `json:"refunded_money" gorm:"default:0"`
+	// 下单时使用的充值套餐与优惠码，DiscountMoney 为优惠码减免的支付金额，DiscountRate 为减免占原支付金额的比例
+	PackageId     int     `json:"package_id" gorm:"default:0"`
+	PromoCode     string  `json:"promo_code" gorm:"type:varchar(64);default:'';index"`
+	DiscountMoney float64 `json:"discount_money" gorm:"default:0"`
+	DiscountRate  float64 `json:"discount_rate" gorm:"default:0"`
+	// 完成时优惠码已超出使用上限，按实付比例扣除的基础额度
+	PromoForfeitQuota int `json:"promo_forfeit_quota" gorm:"default:0"`
+	// 在基础额度之外赠送的额度：套餐档位赠送（下单时确定）与首充赠送（完成时确定）
+	BonusQuota           int `json:"bonus_quota" gorm:"default:0"`
+	FirstTopUpBonusQuota int `json:"first_topup_bonus_quota" gorm:"default:0"`
 }
 
 func (topUp *TopUp) Insert() error {
@@ -55,53 +69,119 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
-	if referenceId == "" {
+// TopUpCompletion 支付渠道回调中附带的客户信息
+type TopUpCompletion struct {
+	PaymentMethod string // 订单未记录支付方式时补充
+	CustomerId    string // Stripe customer
+	CustomerEmail string // 用户未绑定邮箱时使用支付邮箱
+}
+
+// topUpQuotaToAdd 计算订单应充值的额度：
+// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
+// - Creem 订单：Amount 为产品配置的充值额度
+// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
+func topUpQuotaToAdd(topUp *TopUp) int {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case "creem":
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
+	}
+}
+
+// CompleteTopUp 支付成功后完成充值订单（幂等）
+func CompleteTopUp(tradeNo string, completion TopUpCompletion) error {
+	if tradeNo == "" {
 		return errors.New("未提供支付单号")
 	}
 
-	var quota float64
+	var quota int
 	topUp := &TopUp{}
+	completed := false
 
 	refCol := "`trade_no`"
 	if common.UsingPostgreSQL {
 		refCol = `"trade_no"`
 	}
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error
 		if err != nil {
 			return errors.New("充值订单不存在")
 		}
-
+		if topUp.Status == common.TopUpStatusSuccess {
+			return nil
+		}
 		if topUp.Status != common.TopUpStatusPending {
 			return errors.New("充值订单状态错误")
 		}
+		if topUp.PaymentMethod == "" {
+			topUp.PaymentMethod = completion.PaymentMethod
+		}
+		if topUpQuotaToAdd(topUp) <= 0 {
+			return errors.New("无效的充值额度")
+		}
+		if err := settleTopUpOffersTx(tx, topUp); err != nil {
+			return err
+		}
+		quota = topUpCreditQuota(topUp)
 
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
+		if err := tx.Save(topUp).Error; err != nil {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
-		if err != nil {
+		updateFields := map[string]interface{}{
+			"quota": gorm.Expr("quota + ?", quota),
+		}
+		if completion.CustomerId != "" {
+			updateFields["stripe_customer"] = completion.CustomerId
+		}
+		// 如果用户邮箱为空，则更新为支付时使用的邮箱
+		if completion.CustomerEmail != "" {
+			var user User
+			if err := tx.Select("email").Where("id = ?", topUp.UserId).First(&user).Error; err != nil {
+				return err
+			}
+			if user.Email == "" {
+				updateFields["email"] = completion.CustomerEmail
+			}
+		}
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error; err != nil {
 			return err
 		}
-
-		return nil
+		completed = true
+		return RecordUserLedger(tx, topUp.UserId, quota, topUpLedgerRef(topUp))
 	})
 
 	if err != nil {
 		common.SysError("topup failed: " + err.Error())
 		return errors.New("充值失败，请稍后重试")
 	}
+	if completed {
+		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%.2f，支付方式: %s%s",
+			logger.FormatQuota(quota), topUp.Money, topUp.PaymentMethod, topUpOfferRemark(topUp)))
+	}
+	return nil
+}
 
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+// ExpireTopUp 支付超时或取消，关闭待支付订单
+func ExpireTopUp(tradeNo string) error {
+	return DB.Model(&TopUp{}).
+		Where("trade_no = ? AND status = ?", tradeNo, common.TopUpStatusPending).
+		Updates(map[string]interface{}{
+			"status":        common.TopUpStatusExpired,
+			"complete_time": common.GetTimestamp(),
+		}).Error
+}
 
-	return nil
+// SetTopUpProviderOrderId 记录支付渠道侧订单号
+func SetTopUpProviderOrderId(tradeNo string, providerOrderId string) error {
+	return DB.Model(&TopUp{}).Where("trade_no = ?", tradeNo).Update("provider_order_id", providerOrderId).Error
 }
 
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
@@ -266,20 +346,13 @@ func ManualCompleteTopUp(tradeNo string) error {
 			return errors.New("订单状态不是待支付，无法补单")
 		}
 
-		// 计算应充值额度：
-		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
-		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
-		} else {
-			dAmount := decimal.NewFromInt(topUp.Amount)
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
-		}
-		if quotaToAdd <= 0 {
+		if topUpQuotaToAdd(topUp) <= 0 {
 			return errors.New("无效的充值额度")
 		}
+		if err := settleTopUpOffersTx(tx, topUp); err != nil {
+			return err
+		}
+		quotaToAdd = topUpCreditQuota(topUp)
 
 		// 标记完成
 		topUp.CompleteTime = common.GetTimestamp()
@@ -292,6 +365,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
 			return err
 		}
+		if err := RecordUserLedger(tx, topUp.UserId, quotaToAdd, topUpLedgerRef(topUp)); err != nil {
+			return err
+		}
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
@@ -306,73 +382,11 @@ func ManualCompleteTopUp(tradeNo string) error {
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
 	return nil
 }
-func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
-	}
-
-	var quota int64
-	topUp := &TopUp{}
-
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
+func topUpLedgerRef(topUp *TopUp) LedgerRef {
+	return LedgerRef{
+		Source:         LedgerSourceTopUp,
+		ReferenceId:    topUp.TradeNo,
+		IdempotencyKey: "topup:" + topUp.TradeNo,
+		Remark:         topUp.PaymentMethod,
 	}
-
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
-		if err != nil {
-			return errors.New("充值订单不存在")
-		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
-		}
-
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
-			return err
-		}
-
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
-		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
-		updateFields := map[string]interface{}{
-			"quota": gorm.Expr("quota + ?", quota),
-		}
-
-		// 如果有客户邮箱，尝试更新用户邮箱（仅当用户邮箱为空时）
-		if customerEmail != "" {
-			// 先检查用户当前邮箱是否为空
-			var user User
-			err = tx.Where("id = ?", topUp.UserId).First(&user).Error
-			if err != nil {
-				return err
-			}
-
-			// 如果用户邮箱为空，则更新为支付时使用的邮箱
-			if user.Email == "" {
-				updateFields["email"] = customerEmail
-			}
-		}
-
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		common.SysError("creem topup failed: " + err.Error())
-		return errors.New("充值失败，请稍后重试")
-	}
-
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
-
-	return nil
 }
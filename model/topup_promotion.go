@@ -0,0 +1,442 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTopUpPackageNotFound = errors.New("充值套餐不存在或已下架")
+	ErrPromoCodeInvalid     = errors.New("优惠码无效")
+	ErrPromoCodeExpired     = errors.New("优惠码不在有效期内")
+	ErrPromoCodeUsedUp      = errors.New("优惠码已被领完")
+	ErrPromoCodeUserLimit   = errors.New("已达到该优惠码的使用次数上限")
+	ErrPromoCodeGroup       = errors.New("当前分组不可使用该优惠码")
+	ErrPromoCodeMinMoney    = errors.New("未达到优惠码的最低支付金额")
+)
+
+// 优惠码折扣类型
+const (
+	PromoDiscountPercent = "percent" // 按比例折扣，DiscountValue 为减免的百分比
+	PromoDiscountFixed   = "fixed"   // 固定减免，DiscountValue 为减免金额
+)
+
+// TopUpPackage 充值套餐，同时作为赠送档位：充值数量达到 Amount 即额外赠送 BonusAmount，
+// 自定义数量按不超过该数量的最高档位赠送
+type TopUpPackage struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"type:varchar(128)"`
+	Description   string  `json:"description" gorm:"type:varchar(255);default:''"`
+	Amount        int64   `json:"amount" gorm:"index"`                                // 充值数量，与下单请求的 amount 单位一致
+	BonusAmount   float64 `json:"bonus_amount"`                                       // 赠送额度（美元）
+	AllowedGroups string  `json:"allowed_groups" gorm:"type:varchar(255);default:''"` // 可购买的分组，逗号分隔，空表示不限
+	Enabled       bool    `json:"enabled"`
+	SortOrder     int     `json:"sort_order" gorm:"default:0"`
+	CreatedAt     int64   `json:"created_at" gorm:"bigint"`
+	UpdatedAt     int64   `json:"updated_at" gorm:"bigint"`
+}
+
+func (p *TopUpPackage) BonusQuota() int {
+	if p == nil || p.BonusAmount <= 0 {
+		return 0
+	}
+	return int(decimal.NewFromFloat(p.BonusAmount).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).IntPart())
+}
+
+// PromoCode 充值优惠码，下单时抵扣支付金额，与兑换码（直接兑换额度）相互独立
+type PromoCode struct {
+	Id            int     `json:"id"`
+	Code          string  `json:"code" gorm:"type:varchar(64);uniqueIndex"`
+	Name          string  `json:"name" gorm:"type:varchar(128);default:''"`
+	DiscountType  string  `json:"discount_type" gorm:"type:varchar(16)"`
+	DiscountValue float64 `json:"discount_value"`
+	MinMoney      float64 `json:"min_money" gorm:"default:0"`                         // 最低支付金额，0 表示不限
+	StartTime     int64   `json:"start_time" gorm:"bigint;default:0"`                 // 0 表示立即生效
+	EndTime       int64   `json:"end_time" gorm:"bigint;default:0"`                   // 0 表示不过期
+	MaxUses       int     `json:"max_uses" gorm:"default:0"`                          // 总使用次数，0 表示不限
+	UsedCount     int     `json:"used_count" gorm:"default:0"`                        // 已完成支付的订单数
+	PerUserLimit  int     `json:"per_user_limit" gorm:"default:0"`                    // 每个用户可用次数，0 表示不限
+	AllowedGroups string  `json:"allowed_groups" gorm:"type:varchar(255);default:''"` // 可使用的分组，逗号分隔，空表示不限
+	Enabled       bool    `json:"enabled"`
+	CreatedAt     int64   `json:"created_at" gorm:"bigint"`
+	UpdatedAt     int64   `json:"updated_at" gorm:"bigint"`
+}
+
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate 校验管理员提交的优惠码配置
+func (p *PromoCode) Validate() error {
+	p.Code = NormalizePromoCode(p.Code)
+	if p.Code == "" || len(p.Code) > 64 {
+		return errors.New("优惠码长度需在 1-64 之间")
+	}
+	switch p.DiscountType {
+	case PromoDiscountPercent:
+		if p.DiscountValue <= 0 || p.DiscountValue >= 100 {
+			return errors.New("折扣百分比需在 0-100 之间")
+		}
+	case PromoDiscountFixed:
+		if p.DiscountValue <= 0 {
+			return errors.New("减免金额必须大于 0")
+		}
+	default:
+		return errors.New("不支持的折扣类型")
+	}
+	if p.MinMoney < 0 || p.MaxUses < 0 || p.PerUserLimit < 0 {
+		return errors.New("参数不能为负数")
+	}
+	if p.EndTime > 0 && p.EndTime <= p.StartTime {
+		return errors.New("结束时间必须晚于开始时间")
+	}
+	p.AllowedGroups = normalizeGroupList(p.AllowedGroups)
+	return nil
+}
+
+// Discount 计算支付金额 money 可减免的金额，保留两位小数
+func (p *PromoCode) Discount(money float64) float64 {
+	dMoney := decimal.NewFromFloat(money)
+	var discount decimal.Decimal
+	if p.DiscountType == PromoDiscountPercent {
+		discount = dMoney.Mul(decimal.NewFromFloat(p.DiscountValue)).Div(decimal.NewFromInt(100))
+	} else {
+		discount = decimal.NewFromFloat(p.DiscountValue)
+	}
+	if discount.GreaterThan(dMoney) {
+		discount = dMoney
+	}
+	return discount.Round(2).InexactFloat64()
+}
+
+func normalizeGroupList(groups string) string {
+	parts := strings.Split(groups, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// groupListAllows 逗号分隔的分组列表为空时不限分组
+func groupListAllows(groups string, group string) bool {
+	if strings.TrimSpace(groups) == "" {
+		return true
+	}
+	for _, g := range strings.Split(groups, ",") {
+		if strings.TrimSpace(g) == group {
+			return true
+		}
+	}
+	return false
+}
+
+// ---- 充值套餐 ----
+
+func GetAllTopUpPackages() ([]*TopUpPackage, error) {
+	var packages []*TopUpPackage
+	err := DB.Order("sort_order desc, amount asc, id asc").Find(&packages).Error
+	return packages, err
+}
+
+// GetAvailableTopUpPackages 用户所在分组可购买的套餐
+func GetAvailableTopUpPackages(group string) ([]*TopUpPackage, error) {
+	var packages []*TopUpPackage
+	if err := DB.Where("enabled = ?", true).Order("sort_order desc, amount asc, id asc").Find(&packages).Error; err != nil {
+		return nil, err
+	}
+	available := make([]*TopUpPackage, 0, len(packages))
+	for _, p := range packages {
+		if groupListAllows(p.AllowedGroups, group) {
+			available = append(available, p)
+		}
+	}
+	return available, nil
+}
+
+func GetTopUpPackageById(id int) (*TopUpPackage, error) {
+	var p TopUpPackage
+	if err := DB.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *TopUpPackage) Insert() error {
+	now := common.GetTimestamp()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return DB.Create(p).Error
+}
+
+func (p *TopUpPackage) Update() error {
+	return DB.Model(&TopUpPackage{}).Where("id = ?", p.Id).Updates(map[string]interface{}{
+		"name":           p.Name,
+		"description":    p.Description,
+		"amount":         p.Amount,
+		"bonus_amount":   p.BonusAmount,
+		"allowed_groups": normalizeGroupList(p.AllowedGroups),
+		"enabled":        p.Enabled,
+		"sort_order":     p.SortOrder,
+		"updated_at":     common.GetTimestamp(),
+	}).Error
+}
+
+func DeleteTopUpPackageById(id int) error {
+	return DB.Where("id = ?", id).Delete(&TopUpPackage{}).Error
+}
+
+// GetPurchasableTopUpPackage 下单时校验套餐可用
+func GetPurchasableTopUpPackage(id int, group string) (*TopUpPackage, error) {
+	p, err := GetTopUpPackageById(id)
+	if err != nil || !p.Enabled || !groupListAllows(p.AllowedGroups, group) {
+		return nil, ErrTopUpPackageNotFound
+	}
+	return p, nil
+}
+
+// GetTopUpBonusTier 充值数量对应的赠送档位，没有可用档位时返回 nil
+func GetTopUpBonusTier(amount int64, group string) *TopUpPackage {
+	packages, err := GetAvailableTopUpPackages(group)
+	if err != nil {
+		return nil
+	}
+	var tier *TopUpPackage
+	for _, p := range packages {
+		if p.Amount <= amount && p.BonusAmount > 0 && (tier == nil || p.Amount > tier.Amount) {
+			tier = p
+		}
+	}
+	return tier
+}
+
+// ---- 优惠码 ----
+
+func GetPromoCodes(keyword string, pageInfo *common.PageInfo) (codes []*PromoCode, total int64, err error) {
+	tx := DB.Model(&PromoCode{})
+	if keyword = strings.TrimSpace(keyword); keyword != "" {
+		tx = tx.Where("code LIKE ? OR name LIKE ?", "%"+NormalizePromoCode(keyword)+"%", "%"+keyword+"%")
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&codes).Error
+	return codes, total, err
+}
+
+func GetPromoCodeById(id int) (*PromoCode, error) {
+	var p PromoCode
+	if err := DB.Where("id = ?", id).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *PromoCode) Insert() error {
+	now := common.GetTimestamp()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return DB.Create(p).Error
+}
+
+// Update 不修改已使用次数
+func (p *PromoCode) Update() error {
+	return DB.Model(&PromoCode{}).Where("id = ?", p.Id).Updates(map[string]interface{}{
+		"code":           p.Code,
+		"name":           p.Name,
+		"discount_type":  p.DiscountType,
+		"discount_value": p.DiscountValue,
+		"min_money":      p.MinMoney,
+		"start_time":     p.StartTime,
+		"end_time":       p.EndTime,
+		"max_uses":       p.MaxUses,
+		"per_user_limit": p.PerUserLimit,
+		"allowed_groups": p.AllowedGroups,
+		"enabled":        p.Enabled,
+		"updated_at":     common.GetTimestamp(),
+	}).Error
+}
+
+func DeletePromoCodeById(id int) error {
+	return DB.Where("id = ?", id).Delete(&PromoCode{}).Error
+}
+
+// promoCodeReserveSeconds 待支付订单占用优惠码次数的时长，超时未支付的订单不再占用，
+// 之后才完成支付的订单在入账时重新校验次数
+const promoCodeReserveSeconds = 30 * 60
+
+// countPromoCodeOrders 统计占用优惠码次数的订单：已完成、已退款以及未超过占用时长的待支付订单。
+// userId 为 0 时只统计待支付订单（已完成次数记录在 used_count 中）
+func countPromoCodeOrders(code string, userId int) (int64, error) {
+	reserveSince := common.GetTimestamp() - promoCodeReserveSeconds
+	tx := DB.Model(&TopUp{}).Where("promo_code = ?", code)
+	if userId == 0 {
+		tx = tx.Where("status = ? AND create_time >= ?", common.TopUpStatusPending, reserveSince)
+	} else {
+		tx = tx.Where("user_id = ?", userId).
+			Where("status IN ? OR (status = ? AND create_time >= ?)",
+				[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded}, common.TopUpStatusPending, reserveSince)
+	}
+	var count int64
+	err := tx.Count(&count).Error
+	return count, err
+}
+
+// ValidatePromoCode 校验优惠码对该用户与支付金额是否可用，返回可减免的金额。
+// 待支付订单在占用时长内计入总次数与每人次数，完成支付时再按 used_count 原子校验
+func ValidatePromoCode(code string, userId int, group string, money float64) (*PromoCode, float64, error) {
+	code = NormalizePromoCode(code)
+	if code == "" {
+		return nil, 0, ErrPromoCodeInvalid
+	}
+	var promo PromoCode
+	if err := DB.Where("code = ?", code).First(&promo).Error; err != nil {
+		return nil, 0, ErrPromoCodeInvalid
+	}
+	if !promo.Enabled {
+		return nil, 0, ErrPromoCodeInvalid
+	}
+	now := common.GetTimestamp()
+	if (promo.StartTime > 0 && now < promo.StartTime) || (promo.EndTime > 0 && now >= promo.EndTime) {
+		return nil, 0, ErrPromoCodeExpired
+	}
+	if promo.MaxUses > 0 {
+		pending, err := countPromoCodeOrders(promo.Code, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(promo.UsedCount)+pending >= int64(promo.MaxUses) {
+			return nil, 0, ErrPromoCodeUsedUp
+		}
+	}
+	if !groupListAllows(promo.AllowedGroups, group) {
+		return nil, 0, ErrPromoCodeGroup
+	}
+	if promo.MinMoney > 0 && money < promo.MinMoney {
+		return nil, 0, ErrPromoCodeMinMoney
+	}
+	if promo.PerUserLimit > 0 {
+		used, err := countPromoCodeOrders(promo.Code, userId)
+		if err != nil {
+			return nil, 0, err
+		}
+		if used >= int64(promo.PerUserLimit) {
+			return nil, 0, ErrPromoCodeUserLimit
+		}
+	}
+	return &promo, promo.Discount(money), nil
+}
+
+// ---- 订单入账 ----
+
+// topUpCreditQuota 订单实际入账额度：基础额度 + 套餐赠送 + 首充赠送 - 超限优惠码扣除
+func topUpCreditQuota(topUp *TopUp) int {
+	return topUpQuotaToAdd(topUp) + topUp.BonusQuota + topUp.FirstTopUpBonusQuota - topUp.PromoForfeitQuota
+}
+
+// settleTopUpOffersTx 订单完成时结算优惠：累加优惠码使用次数并计算首充赠送，需在保存订单前调用
+func settleTopUpOffersTx(tx *gorm.DB, topUp *TopUp) error {
+	if topUp.PromoCode != "" {
+		if err := settlePromoCodeTx(tx, topUp); err != nil {
+			return err
+		}
+	}
+	bonus, err := firstTopUpBonusTx(tx, topUp)
+	if err != nil {
+		return err
+	}
+	topUp.FirstTopUpBonusQuota = bonus
+	return nil
+}
+
+// settlePromoCodeTx 按 used_count 条件更新原子占用一次优惠码，并重新校验每人次数。
+// 超出上限时订单已按折扣价支付，取消折扣：按减免比例扣除基础额度，仅按实付金额入账
+func settlePromoCodeTx(tx *gorm.DB, topUp *TopUp) error {
+	var promo PromoCode
+	if err := tx.Where("code = ?", topUp.PromoCode).First(&promo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	exceeded := false
+	if promo.PerUserLimit > 0 {
+		var used int64
+		err := tx.Model(&TopUp{}).
+			Where("user_id = ? AND promo_code = ? AND id <> ? AND status IN ?", topUp.UserId, promo.Code, topUp.Id,
+				[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded}).
+			Count(&used).Error
+		if err != nil {
+			return err
+		}
+		exceeded = used >= int64(promo.PerUserLimit)
+	}
+	if !exceeded {
+		result := tx.Model(&PromoCode{}).
+			Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", promo.Id).
+			Update("used_count", gorm.Expr("used_count + ?", 1))
+		if result.Error != nil {
+			return result.Error
+		}
+		exceeded = result.RowsAffected == 0
+	}
+	if exceeded {
+		topUp.PromoForfeitQuota = int(decimal.NewFromInt(int64(topUpQuotaToAdd(topUp))).
+			Mul(decimal.NewFromFloat(topUp.DiscountRate)).IntPart())
+	}
+	return nil
+}
+
+// firstTopUpBonusTx 用户此前没有任何已完成的充值（含订阅订单）时按比例赠送
+func firstTopUpBonusTx(tx *gorm.DB, topUp *TopUp) (int, error) {
+	ps := operation_setting.GetPaymentSetting()
+	if ps.FirstTopUpBonusRate <= 0 {
+		return 0, nil
+	}
+	var count int64
+	err := tx.Model(&TopUp{}).
+		Where("user_id = ? AND id <> ? AND status IN ?", topUp.UserId, topUp.Id,
+			[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded}).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return 0, err
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	bonus := decimal.NewFromInt(int64(topUpQuotaToAdd(topUp))).Mul(decimal.NewFromFloat(ps.FirstTopUpBonusRate))
+	if ps.FirstTopUpBonusMax > 0 {
+		if max := decimal.NewFromFloat(ps.FirstTopUpBonusMax).Mul(dQuotaPerUnit); bonus.GreaterThan(max) {
+			bonus = max
+		}
+	}
+	return int(bonus.IntPart()), nil
+}
+
+// topUpOfferRemark 充值日志中的优惠说明
+func topUpOfferRemark(topUp *TopUp) string {
+	var parts []string
+	if topUp.PromoForfeitQuota > 0 {
+		parts = append(parts, fmt.Sprintf("优惠码 %s 已超出使用上限，扣除减免部分 %s", topUp.PromoCode, logger.FormatQuota(topUp.PromoForfeitQuota)))
+	} else if topUp.PromoCode != "" {
+		parts = append(parts, fmt.Sprintf("优惠码 %s 减免 %.2f", topUp.PromoCode, topUp.DiscountMoney))
+	}
+	if topUp.BonusQuota > 0 {
+		parts = append(parts, "套餐赠送 "+logger.FormatQuota(topUp.BonusQuota))
+	}
+	if topUp.FirstTopUpBonusQuota > 0 {
+		parts = append(parts, "首充赠送 "+logger.FormatQuota(topUp.FirstTopUpBonusQuota))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "，" + strings.Join(parts, "，")
+}
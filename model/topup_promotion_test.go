@@ -0,0 +1,136 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
+func createPromoTestTopUp(t *testing.T, userId int, code string, status string) *TopUp {
+	t.Helper()
+	topUp := &TopUp{
+		UserId:        userId,
+		Amount:        10,
+		Money:         9,
+		TradeNo:       "promo_" + common.GetRandomString(16),
+		PaymentMethod: "alipay",
+		CreateTime:    common.GetTimestamp(),
+		Status:        status,
+		PromoCode:     code,
+		DiscountMoney: 1,
+		DiscountRate:  0.1,
+	}
+	if err := topUp.Insert(); err != nil {
+		t.Fatalf("failed to create topup: %v", err)
+	}
+	return topUp
+}
+
+func createPromoTestCode(t *testing.T, maxUses int, perUserLimit int) *PromoCode {
+	t.Helper()
+	promo := &PromoCode{
+		Code:          "T" + common.GetRandomString(12),
+		DiscountType:  PromoDiscountFixed,
+		DiscountValue: 1,
+		MaxUses:       maxUses,
+		PerUserLimit:  perUserLimit,
+		Enabled:       true,
+	}
+	if err := promo.Validate(); err != nil {
+		t.Fatalf("invalid promo code: %v", err)
+	}
+	if err := promo.Insert(); err != nil {
+		t.Fatalf("failed to create promo code: %v", err)
+	}
+	return promo
+}
+
+func TestValidatePromoCodeCountsPendingOrders(t *testing.T) {
+	promo := createPromoTestCode(t, 1, 0)
+	first := createLedgerTestUser(t, 0)
+	second := createLedgerTestUser(t, 0)
+
+	if _, _, err := ValidatePromoCode(promo.Code, first.Id, "default", 10); err != nil {
+		t.Fatalf("expected promo code to be available, got %v", err)
+	}
+	createPromoTestTopUp(t, first.Id, promo.Code, common.TopUpStatusPending)
+	if _, _, err := ValidatePromoCode(promo.Code, second.Id, "default", 10); !errors.Is(err, ErrPromoCodeUsedUp) {
+		t.Fatalf("expected pending order to reserve the last use, got %v", err)
+	}
+
+	stale := createPromoTestCode(t, 1, 0)
+	order := createPromoTestTopUp(t, first.Id, stale.Code, common.TopUpStatusPending)
+	DB.Model(order).Update("create_time", common.GetTimestamp()-promoCodeReserveSeconds-1)
+	if _, _, err := ValidatePromoCode(stale.Code, second.Id, "default", 10); err != nil {
+		t.Fatalf("expected stale pending order to release the reservation, got %v", err)
+	}
+}
+
+func TestValidatePromoCodePerUserLimitCountsPendingOrders(t *testing.T) {
+	promo := createPromoTestCode(t, 0, 1)
+	user := createLedgerTestUser(t, 0)
+	other := createLedgerTestUser(t, 0)
+
+	createPromoTestTopUp(t, user.Id, promo.Code, common.TopUpStatusPending)
+	if _, _, err := ValidatePromoCode(promo.Code, user.Id, "default", 10); !errors.Is(err, ErrPromoCodeUserLimit) {
+		t.Fatalf("expected pending order to count toward per-user limit, got %v", err)
+	}
+	if _, _, err := ValidatePromoCode(promo.Code, other.Id, "default", 10); err != nil {
+		t.Fatalf("expected other user to be unaffected, got %v", err)
+	}
+}
+
+func TestCompleteTopUpDropsDiscountOverMaxUses(t *testing.T) {
+	promo := createPromoTestCode(t, 1, 0)
+	first := createLedgerTestUser(t, 0)
+	second := createLedgerTestUser(t, 0)
+	firstOrder := createPromoTestTopUp(t, first.Id, promo.Code, common.TopUpStatusPending)
+	secondOrder := createPromoTestTopUp(t, second.Id, promo.Code, common.TopUpStatusPending)
+
+	if err := CompleteTopUp(firstOrder.TradeNo, TopUpCompletion{}); err != nil {
+		t.Fatalf("failed to complete first order: %v", err)
+	}
+	if err := CompleteTopUp(secondOrder.TradeNo, TopUpCompletion{}); err != nil {
+		t.Fatalf("failed to complete second order: %v", err)
+	}
+
+	updated, err := GetPromoCodeById(promo.Id)
+	if err != nil {
+		t.Fatalf("failed to load promo code: %v", err)
+	}
+	if updated.UsedCount != 1 {
+		t.Fatalf("expected used_count 1, got %d", updated.UsedCount)
+	}
+	fullQuota := int(10 * common.QuotaPerUnit)
+	if quota, _ := GetUserQuota(first.Id, true); quota != fullQuota {
+		t.Fatalf("expected first user to receive %d, got %d", fullQuota, quota)
+	}
+	forfeit := int(float64(fullQuota) * 0.1)
+	if quota, _ := GetUserQuota(second.Id, true); quota != fullQuota-forfeit {
+		t.Fatalf("expected second user to receive %d, got %d", fullQuota-forfeit, quota)
+	}
+	if order := GetTopUpByTradeNo(secondOrder.TradeNo); order.PromoForfeitQuota != forfeit {
+		t.Fatalf("expected forfeit %d recorded on order, got %d", forfeit, order.PromoForfeitQuota)
+	}
+}
+
+func TestCompleteTopUpDropsDiscountOverPerUserLimit(t *testing.T) {
+	promo := createPromoTestCode(t, 0, 1)
+	user := createLedgerTestUser(t, 0)
+	firstOrder := createPromoTestTopUp(t, user.Id, promo.Code, common.TopUpStatusPending)
+	secondOrder := createPromoTestTopUp(t, user.Id, promo.Code, common.TopUpStatusPending)
+
+	if err := CompleteTopUp(firstOrder.TradeNo, TopUpCompletion{}); err != nil {
+		t.Fatalf("failed to complete first order: %v", err)
+	}
+	if err := CompleteTopUp(secondOrder.TradeNo, TopUpCompletion{}); err != nil {
+		t.Fatalf("failed to complete second order: %v", err)
+	}
+	if order := GetTopUpByTradeNo(firstOrder.TradeNo); order.PromoForfeitQuota != 0 {
+		t.Fatalf("expected first order to keep its discount, got forfeit %d", order.PromoForfeitQuota)
+	}
+	if order := GetTopUpByTradeNo(secondOrder.TradeNo); order.PromoForfeitQuota == 0 {
+		t.Fatal("expected second order to drop its discount")
+	}
+}
@@ -48,6 +48,9 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	AdminRoleId      int            `json:"admin_role_id" gorm:"type:int;default:0;index"`         // 自定义管理角色，0 表示未分配
+	SsoId            string         `json:"sso_id" gorm:"column:sso_id;type:varchar(256);index"`   // SAML NameID 或 SCIM userName
+	LdapId           string         `json:"ldap_id" gorm:"column:ldap_id;type:varchar(256);index"` // LDAP 用户名属性的值
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -330,6 +333,9 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if err := RecordUserLedger(tx, user.Id, quota, LedgerRef{Source: LedgerSourceAffiliate, Remark: "aff quota transfer"}); err != nil {
+		return err
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -354,9 +360,14 @@ func (user *User) Insert(inviterId int) error {
 		user.SetSetting(defaultSetting)
 	}
 
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return RecordUserLedger(tx, user.Id, user.Quota, signupLedgerRef(user.Id))
+	})
+	if err != nil {
+		return err
 	}
 
 	// 用户创建成功后，根据角色初始化边栏配置
@@ -379,7 +390,11 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, LedgerRef{
+				Source:         LedgerSourceAffiliate,
+				ReferenceId:    strconv.Itoa(inviterId),
+				IdempotencyKey: fmt.Sprintf("invitee:%d", user.Id),
+			})
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -391,6 +406,13 @@ func (user *User) Insert(inviterId int) error {
 	return nil
 }
 
+func signupLedgerRef(userId int) LedgerRef {
+	return LedgerRef{
+		Source:         LedgerSourceSignup,
+		IdempotencyKey: fmt.Sprintf("signup:%d", userId),
+	}
+}
+
 // InsertWithTx inserts a new user within an existing transaction.
 // This is used for OAuth registration where user creation and binding need to be atomic.
 // Post-creation tasks (sidebar config, logs, inviter rewards) are handled after the transaction commits.
@@ -416,7 +438,7 @@ func (user *User) InsertWithTx(tx *gorm.DB, inviterId int) error {
 		return result.Error
 	}
 
-	return nil
+	return RecordUserLedger(tx, user.Id, user.Quota, signupLedgerRef(user.Id))
 }
 
 // FinalizeOAuthUserCreation performs post-transaction tasks for OAuth user creation.
@@ -440,7 +462,11 @@ func (user *User) FinalizeOAuthUserCreation(inviterId int) {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, LedgerRef{
+				Source:         LedgerSourceAffiliate,
+				ReferenceId:    strconv.Itoa(inviterId),
+				IdempotencyKey: fmt.Sprintf("invitee:%d", user.Id),
+			})
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -489,8 +515,15 @@ func (user *User) Edit(updatePassword bool) error {
 		updates["password"] = newUser.Password
 	}
 
-	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		tx.First(&user, user.Id)
+		oldQuota := user.Quota
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return RecordUserLedger(tx, user.Id, newUser.Quota-oldQuota, LedgerRef{Source: LedgerSourceAdmin, Remark: "edit user"})
+	})
+	if err != nil {
 		return err
 	}
 
@@ -792,59 +825,76 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
-func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+func IncreaseUserQuota(id int, quota int, db bool, refs ...LedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	ref := firstLedgerRef(refs)
+	if !db && common.BatchUpdateEnabled {
+		// 分录写入成功后才累计余额，幂等键重复时不会重复入账
+		if err := recordDeferredUserLedger(id, quota, ref); err != nil {
+			return err
+		}
+		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+	} else if err := increaseUserQuota(id, quota, ref); err != nil {
+		return err
+	}
 	gopool.Go(func() {
 		err := cacheIncrUserQuota(id, int64(quota))
 		if err != nil {
 			common.SysLog("failed to increase user quota: " + err.Error())
 		}
 	})
-	if !db && common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
-		return nil
-	}
-	return increaseUserQuota(id, quota)
+	return nil
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+func increaseUserQuota(id int, quota int, ref LedgerRef) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+			return err
+		}
+		return RecordUserLedger(tx, id, quota, ref)
+	})
+}
+
+func batchUpdateUserQuota(id int, delta int) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", delta)).Error
 }
 
-func DecreaseUserQuota(id int, quota int) (err error) {
+func DecreaseUserQuota(id int, quota int, refs ...LedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
+	ref := firstLedgerRef(refs)
+	if common.BatchUpdateEnabled {
+		if err := recordDeferredUserLedger(id, -quota, ref); err != nil {
+			return err
+		}
+		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+	} else if err := decreaseUserQuota(id, quota, ref); err != nil {
+		return err
+	}
 	gopool.Go(func() {
 		err := cacheDecrUserQuota(id, int64(quota))
 		if err != nil {
 			common.SysLog("failed to decrease user quota: " + err.Error())
 		}
 	})
-	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
-		return nil
-	}
-	return decreaseUserQuota(id, quota)
+	return nil
 }
 
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+func decreaseUserQuota(id int, quota int, ref LedgerRef) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error; err != nil {
+			return err
+		}
+		return RecordUserLedger(tx, id, -quota, ref)
+	})
 }
 
 // DecreaseUserQuotaWithRecords decreases user quota with FIFO consumption of expiring records.
 // This bypasses batch updates since FIFO ordering cannot be deferred.
-func DecreaseUserQuotaWithRecords(id int, quota int) (err error) {
+func DecreaseUserQuotaWithRecords(id int, quota int, refs ...LedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -870,18 +920,21 @@ func DecreaseUserQuotaWithRecords(id int, quota int) (err error) {
 		// 3. Decrease user.Quota
 		err = tx.Model(&User{}).Where("id = ?", id).
 			Update("quota", gorm.Expr("quota - ?", quota)).Error
-		return err
+		if err != nil {
+			return err
+		}
+		return RecordUserLedger(tx, id, -quota, firstLedgerRef(refs))
 	})
 }
 
-func DeltaUpdateUserQuota(id int, delta int) (err error) {
+func DeltaUpdateUserQuota(id int, delta int, refs ...LedgerRef) (err error) {
 	if delta == 0 {
 		return nil
 	}
 	if delta > 0 {
-		return IncreaseUserQuota(id, delta, false)
+		return IncreaseUserQuota(id, delta, false, refs...)
 	} else {
-		return DecreaseUserQuota(id, -delta)
+		return DecreaseUserQuota(id, -delta, refs...)
 	}
 }
 
@@ -904,6 +957,15 @@ func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
 	updateUserUsedQuotaAndRequestCount(id, quota, 1)
 }
 
+// UpdateUserUsedQuota 只修正已用额度而不计入请求次数，用于异步任务的结算差额
+func UpdateUserUsedQuota(id int, quota int) {
+	if common.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
+		return
+	}
+	updateUserUsedQuota(id, quota)
+}
+
 func updateUserUsedQuotaAndRequestCount(id int, quota int, count int) {
 	err := DB.Model(&User{}).Where("id = ?", id).Updates(
 		map[string]interface{}{
@@ -968,6 +1030,14 @@ func GetUsernameById(id int, fromDB bool) (username string, err error) {
 	return username, nil
 }
 
+func GetUserIdByUsername(username string) (int, error) {
+	var user User
+	if err := DB.Select("id").Where("username = ?", username).First(&user).Error; err != nil {
+		return 0, err
+	}
+	return user.Id, nil
+}
+
 func IsLinuxDOIdAlreadyTaken(linuxDOId string) bool {
 	var user User
 	err := DB.Unscoped().Where("linux_do_id = ?", linuxDOId).First(&user).Error
@@ -0,0 +1,406 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PaymentMethodCreem   = "creem"
+	CreemSignatureHeader = "creem-signature"
+)
+
+func init() {
+	Register(PaymentMethodCreem, &CreemProvider{})
+}
+
+// CreemProvider implements Creem checkout, top-ups are sold as preconfigured products.
+type CreemProvider struct{}
+
+type CreemProduct struct {
+	ProductId string  `json:"productId"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Currency  string  `json:"currency"`
+	Quota     int64   `json:"quota"`
+}
+
+// 新的Creem Webhook结构体，匹配实际的webhook数据格式
+type CreemWebhookEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	CreatedAt int64  `json:"created_at"`
+	Object    struct {
+		Id        string `json:"id"`
+		Object    string `json:"object"`
+		RequestId string `json:"request_id"`
+		Order     struct {
+			Object      string `json:"object"`
+			Id          string `json:"id"`
+			Customer    string `json:"customer"`
+			Product     string `json:"product"`
+			Amount      int    `json:"amount"`
+			Currency    string `json:"currency"`
+			SubTotal    int    `json:"sub_total"`
+			TaxAmount   int    `json:"tax_amount"`
+			AmountDue   int    `json:"amount_due"`
+			AmountPaid  int    `json:"amount_paid"`
+			Status      string `json:"status"`
+			Type        string `json:"type"`
+			Transaction string `json:"transaction"`
+			CreatedAt   string `json:"created_at"`
+			UpdatedAt   string `json:"updated_at"`
+			Mode        string `json:"mode"`
+		} `json:"order"`
+		Product struct {
+			Id                string  `json:"id"`
+			Object            string  `json:"object"`
+			Name              string  `json:"name"`
+			Description       string  `json:"description"`
+			Price             int     `json:"price"`
+			Currency          string  `json:"currency"`
+			BillingType       string  `json:"billing_type"`
+			BillingPeriod     string  `json:"billing_period"`
+			Status            string  `json:"status"`
+			TaxMode           string  `json:"tax_mode"`
+			TaxCategory       string  `json:"tax_category"`
+			DefaultSuccessUrl *string `json:"default_success_url"`
+			CreatedAt         string  `json:"created_at"`
+			UpdatedAt         string  `json:"updated_at"`
+			Mode              string  `json:"mode"`
+		} `json:"product"`
+		Units    int `json:"units"`
+		Customer struct {
+			Id        string `json:"id"`
+			Object    string `json:"object"`
+			Email     string `json:"email"`
+			Name      string `json:"name"`
+			Country   string `json:"country"`
+			CreatedAt string `json:"created_at"`
+			UpdatedAt string `json:"updated_at"`
+			Mode      string `json:"mode"`
+		} `json:"customer"`
+		Status   string            `json:"status"`
+		Metadata map[string]string `json:"metadata"`
+		Mode     string            `json:"mode"`
+		// checkout.completed 事件中为关联的订阅，订阅事件中 Object 本身即为订阅
+		Subscription         CreemSubscriptionRef `json:"subscription"`
+		LastTransactionId    string               `json:"last_transaction_id"`
+		CurrentPeriodEndDate string               `json:"current_period_end_date"`
+	} `json:"object"`
+}
+
+// CreemSubscriptionRef 订阅字段可能是订阅 ID 字符串或展开的订阅对象
+type CreemSubscriptionRef struct {
+	Id string
+}
+
+func (r *CreemSubscriptionRef) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		r.Id = id
+		return nil
+	}
+	var obj struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	r.Id = obj.Id
+	return nil
+}
+
+type creemCheckoutRequest struct {
+	ProductId string `json:"product_id"`
+	RequestId string `json:"request_id"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type creemCheckoutResponse struct {
+	CheckoutUrl string `json:"checkout_url"`
+	Id          string `json:"id"`
+}
+
+func (p *CreemProvider) GetName() string {
+	return "Creem"
+}
+
+func (p *CreemProvider) IsEnabled() bool {
+	return setting.CreemApiKey != "" && (setting.CreemWebhookSecret != "" || setting.CreemTestMode)
+}
+
+func creemApiBase() string {
+	if setting.CreemTestMode {
+		return "https://test-api.creem.io/v1"
+	}
+	return "https://api.creem.io/v1"
+}
+
+// GetCreemProducts 解析管理员配置的 Creem 产品列表
+func GetCreemProducts() ([]CreemProduct, error) {
+	var products []CreemProduct
+	if err := json.Unmarshal([]byte(setting.CreemProducts), &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (p *CreemProvider) QuoteTopUp(req *TopUpQuoteRequest) (*TopUpQuote, error) {
+	if req.ProductId == "" {
+		return nil, errors.New("请选择产品")
+	}
+	products, err := GetCreemProducts()
+	if err != nil {
+		log.Println("解析Creem产品列表失败", err)
+		return nil, errors.New("产品配置错误")
+	}
+	for _, product := range products {
+		if product.ProductId == req.ProductId {
+			// Creem 订单的 Amount 直接为充值额度
+			return &TopUpQuote{
+				Money:      product.Price,
+				Amount:     product.Quota,
+				Quantity:   1,
+				ProductId:  product.ProductId,
+				Title:      product.Name,
+				Currency:   product.Currency,
+				FixedPrice: true,
+			}, nil
+		}
+	}
+	return nil, errors.New("产品不存在")
+}
+
+// doCreemRequest 调用 Creem API 并返回响应 body
+func doCreemRequest(apiUrl string, body any) ([]byte, error) {
+	if setting.CreemApiKey == "" {
+		return nil, fmt.Errorf("未配置Creem API密钥")
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求数据失败: %v", err)
+	}
+	req, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Creem API http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return respBody, nil
+}
+
+func (p *CreemProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error) {
+	productId := req.ProductId
+	quota := int64(0)
+	if req.Kind == OrderKindSubscription {
+		if req.Plan == nil || req.Plan.CreemProductId == "" {
+			return nil, errors.New("该套餐未配置 CreemProductId")
+		}
+		productId = req.Plan.CreemProductId
+	}
+	if productId == "" {
+		return nil, errors.New("请选择产品")
+	}
+	if req.Kind == OrderKindTopUp {
+		quote, err := p.QuoteTopUp(&TopUpQuoteRequest{ProductId: productId})
+		if err != nil {
+			return nil, err
+		}
+		quota = quote.Amount
+	}
+
+	// 构建请求数据，用户邮箱会在支付页面预填充
+	requestData := creemCheckoutRequest{
+		ProductId: productId,
+		RequestId: req.TradeNo, // 这个作为订单ID传递给Creem
+		Metadata: map[string]string{
+			"username":     req.User.Username,
+			"reference_id": req.TradeNo,
+			"product_name": req.Title,
+			"quota":        fmt.Sprintf("%d", quota),
+		},
+	}
+	requestData.Customer.Email = req.User.Email
+
+	apiUrl := creemApiBase() + "/checkouts"
+	log.Printf("发送Creem支付请求 - URL: %s, 产品ID: %s, 订单号: %s", apiUrl, productId, req.TradeNo)
+	body, err := doCreemRequest(apiUrl, requestData)
+	if err != nil {
+		return nil, err
+	}
+	var checkoutResp creemCheckoutResponse
+	if err := json.Unmarshal(body, &checkoutResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if checkoutResp.CheckoutUrl == "" {
+		return nil, fmt.Errorf("Creem API resp no checkout url ")
+	}
+	log.Printf("Creem 支付链接创建成功 - 订单号: %s, 支付链接: %s", req.TradeNo, checkoutResp.CheckoutUrl)
+	return &CheckoutResult{PayLink: checkoutResp.CheckoutUrl, ProviderOrderId: checkoutResp.Id}, nil
+}
+
+// 生成HMAC-SHA256签名
+func generateCreemSignature(payload string, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 验证Creem webhook签名
+func verifyCreemSignature(payload string, signature string, secret string) bool {
+	if secret == "" {
+		log.Printf("Creem webhook secret not set")
+		if setting.CreemTestMode {
+			log.Printf("Skip Creem webhook sign verify in test mode")
+			return true
+		}
+		return false
+	}
+
+	expectedSignature := generateCreemSignature(payload, secret)
+	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+}
+
+func (p *CreemProvider) VerifyWebhook(c *gin.Context) (*WebhookEvent, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	signature := c.GetHeader(CreemSignatureHeader)
+	if setting.CreemTestMode {
+		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
+	} else if signature == "" {
+		return nil, fmt.Errorf("%w: Creem Webhook缺少签名头", ErrInvalidWebhook)
+	}
+	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
+		return nil, fmt.Errorf("%w: Creem Webhook签名验证失败", ErrInvalidWebhook)
+	}
+
+	var event CreemWebhookEvent
+	if err := json.Unmarshal(bodyBytes, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", event.EventType, event.Id)
+
+	switch event.EventType {
+	case "checkout.completed":
+		if event.Object.Order.Status != "paid" {
+			log.Printf("订单状态不是已支付: %s, 跳过处理", event.Object.Order.Status)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		// 引用ID是创建订单时传递的request_id
+		if event.Object.RequestId == "" {
+			return nil, fmt.Errorf("%w: Creem Webhook缺少request_id字段", ErrInvalidWebhook)
+		}
+		return &WebhookEvent{
+			Type:                   EventPaid,
+			TradeNo:                event.Object.RequestId,
+			ProviderOrderId:        event.Object.Order.Id,
+			CustomerEmail:          event.Object.Customer.Email,
+			Money:                  float64(event.Object.Order.AmountPaid) / 100,
+			Currency:               event.Object.Order.Currency,
+			ProviderSubscriptionId: event.Object.Subscription.Id,
+			Payload:                common.GetJsonString(event),
+		}, nil
+	case "subscription.paid":
+		// 首期由 checkout.completed 创建订阅，后续周期在此续期
+		if event.Object.Id == "" || event.Object.LastTransactionId == "" {
+			log.Printf("Creem订阅续费事件缺少订阅ID或交易ID: %s", event.Id)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		periodEnd := int64(0)
+		if t, err := time.Parse(time.RFC3339, event.Object.CurrentPeriodEndDate); err == nil {
+			periodEnd = t.Unix()
+		}
+		return &WebhookEvent{
+			Type:                   EventRenewalPaid,
+			ProviderSubscriptionId: event.Object.Id,
+			RenewalTradeNo:         event.Object.LastTransactionId,
+			PeriodEnd:              periodEnd,
+			Payload:                common.GetJsonString(event),
+		}, nil
+	case "subscription.canceled", "subscription.expired":
+		return &WebhookEvent{
+			Type:                   EventSubscriptionUpdated,
+			ProviderSubscriptionId: event.Object.Id,
+			CancelAtPeriodEnd:      true,
+			SubscriptionEnded:      event.EventType == "subscription.expired" || event.Object.Status == "canceled",
+		}, nil
+	default:
+		log.Printf("忽略Creem Webhook事件类型: %s", event.EventType)
+		return &WebhookEvent{Type: EventIgnored}, nil
+	}
+}
+
+func (p *CreemProvider) AckWebhook(c *gin.Context, err error) {
+	ackWebhookStatus(c, err, http.StatusUnauthorized)
+}
+
+func (p *CreemProvider) QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *CreemProvider) Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
+
+// creemSubscriptionAction 调用 Creem 订阅管理接口，如 cancel、upgrade
+func creemSubscriptionAction(providerSubscriptionId string, action string, body any) error {
+	apiUrl := creemApiBase() + "/subscriptions/" + url.PathEscape(providerSubscriptionId) + "/" + action
+	_, err := doCreemRequest(apiUrl, body)
+	return err
+}
+
+// SetCancelAtPeriodEnd Creem 取消后无法恢复
+func (p *CreemProvider) SetCancelAtPeriodEnd(ctx context.Context, providerSubscriptionId string, cancel bool) error {
+	if !cancel {
+		return ErrNotSupported
+	}
+	return creemSubscriptionAction(providerSubscriptionId, "cancel", map[string]any{})
+}
+
+// ChangeSubscriptionPlan 切换订阅产品，差价已在钱包中结算，Creem 侧不按比例计费
+func (p *CreemProvider) ChangeSubscriptionPlan(ctx context.Context, providerSubscriptionId string, plan *model.SubscriptionPlan) error {
+	if plan.CreemProductId == "" {
+		return errors.New("目标套餐未配置 CreemProductId")
+	}
+	return creemSubscriptionAction(providerSubscriptionId, "upgrade", map[string]any{
+		"product_id":      plan.CreemProductId,
+		"update_behavior": "proration-none",
+	})
+}
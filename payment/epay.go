@@ -0,0 +1,169 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const PaymentMethodEpay = "epay"
+
+func init() {
+	Register(PaymentMethodEpay, &EpayProvider{})
+}
+
+// EpayProvider implements 易支付. Orders store the sub payment type (alipay, wxpay...) as payment method.
+type EpayProvider struct{}
+
+// NewEpayClient returns nil when epay is not configured
+func NewEpayClient() *epay.Client {
+	if operation_setting.PayAddress == "" || operation_setting.EpayId == "" || operation_setting.EpayKey == "" {
+		return nil
+	}
+	withUrl, err := epay.NewClient(&epay.Config{
+		PartnerID: operation_setting.EpayId,
+		Key:       operation_setting.EpayKey,
+	}, operation_setting.PayAddress)
+	if err != nil {
+		return nil
+	}
+	return withUrl
+}
+
+func callbackAddress() string {
+	if operation_setting.CustomCallbackAddress == "" {
+		return system_setting.ServerAddress
+	}
+	return operation_setting.CustomCallbackAddress
+}
+
+func (p *EpayProvider) GetName() string {
+	return "易支付"
+}
+
+func (p *EpayProvider) IsEnabled() bool {
+	return operation_setting.PayAddress != "" && operation_setting.EpayId != "" && operation_setting.EpayKey != ""
+}
+
+func (p *EpayProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error) {
+	client := NewEpayClient()
+	if client == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	if !operation_setting.ContainsPayMethod(req.PayType) {
+		return nil, errors.New("支付方式不存在")
+	}
+	// 沿用原有的回调地址，已在易支付后台配置的白名单无需修改
+	var notifyUrl, returnUrl *url.URL
+	var err error
+	if req.Kind == OrderKindSubscription {
+		notifyUrl, err = url.Parse(callbackAddress() + "/api/subscription/epay/notify")
+		if err == nil {
+			returnUrl, err = url.Parse(callbackAddress() + "/api/subscription/epay/return")
+		}
+	} else {
+		notifyUrl, err = url.Parse(callbackAddress() + "/api/user/epay/notify")
+		if err == nil {
+			returnUrl, err = url.Parse(system_setting.ServerAddress + "/console/log")
+		}
+	}
+	if err != nil {
+		return nil, errors.New("回调地址配置错误")
+	}
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           req.PayType,
+		ServiceTradeNo: req.TradeNo,
+		Name:           req.Title,
+		Money:          strconv.FormatFloat(req.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutResult{PayLink: uri, Params: params}, nil
+}
+
+// ParseEpayParams 易支付回调参数可能在 POST body 或 URL Query 中
+func ParseEpayParams(c *gin.Context) (map[string]string, error) {
+	if c.Request.Method == "POST" {
+		if err := c.Request.ParseForm(); err != nil {
+			return nil, err
+		}
+		return lo.Reduce(lo.Keys(c.Request.PostForm), func(r map[string]string, t string, i int) map[string]string {
+			r[t] = c.Request.PostForm.Get(t)
+			return r
+		}, map[string]string{}), nil
+	}
+	return lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
+		r[t] = c.Request.URL.Query().Get(t)
+		return r
+	}, map[string]string{}), nil
+}
+
+// VerifyEpayParams 校验易支付回调签名
+func VerifyEpayParams(params map[string]string) (*epay.VerifyRes, error) {
+	if len(params) == 0 {
+		return nil, errors.New("易支付回调参数为空")
+	}
+	client := NewEpayClient()
+	if client == nil {
+		return nil, errors.New("易支付回调失败 未找到配置信息")
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, errors.New("易支付回调签名验证失败")
+	}
+	return verifyInfo, nil
+}
+
+func (p *EpayProvider) VerifyWebhook(c *gin.Context) (*WebhookEvent, error) {
+	params, err := ParseEpayParams(c)
+	if err != nil {
+		return nil, err
+	}
+	verifyInfo, err := VerifyEpayParams(params)
+	if err != nil {
+		return nil, err
+	}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		return nil, fmt.Errorf("易支付异常回调: %s", verifyInfo.TradeStatus)
+	}
+	money, _ := strconv.ParseFloat(verifyInfo.Money, 64)
+	return &WebhookEvent{
+		Type:            EventPaid,
+		TradeNo:         verifyInfo.ServiceTradeNo,
+		ProviderOrderId: verifyInfo.TradeNo,
+		Money:           money,
+		Payload:         common.GetJsonString(verifyInfo),
+	}, nil
+}
+
+func (p *EpayProvider) AckWebhook(c *gin.Context, err error) {
+	if err != nil {
+		_, _ = c.Writer.Write([]byte("fail"))
+		return
+	}
+	_, _ = c.Writer.Write([]byte("success"))
+}
+
+func (p *EpayProvider) QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *EpayProvider) Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
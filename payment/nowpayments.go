@@ -0,0 +1,210 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PaymentMethodNowPayments   = "nowpayments"
+	NowPaymentsSignatureHeader = "x-nowpayments-sig"
+)
+
+func init() {
+	Register(PaymentMethodNowPayments, &NowPaymentsProvider{})
+}
+
+// NowPaymentsProvider implements crypto payments through NOWPayments hosted invoices.
+// The price is fixed in fiat and the buyer picks the coin on the invoice page.
+type NowPaymentsProvider struct{}
+
+func (p *NowPaymentsProvider) GetName() string {
+	return "Crypto (NOWPayments)"
+}
+
+func (p *NowPaymentsProvider) IsEnabled() bool {
+	return setting.NowPaymentsApiKey != "" && setting.NowPaymentsIpnSecret != ""
+}
+
+func nowPaymentsApiBase() string {
+	if setting.NowPaymentsSandbox {
+		return "https://api-sandbox.nowpayments.io/v1"
+	}
+	return "https://api.nowpayments.io/v1"
+}
+
+func nowPaymentsRequest(ctx context.Context, method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, nowPaymentsApiBase()+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", setting.NowPaymentsApiKey)
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("NOWPayments API http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+func (p *NowPaymentsProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error) {
+	if !p.IsEnabled() {
+		return nil, errors.New("NOWPayments 未配置")
+	}
+	successURL := req.SuccessURL
+	if successURL == "" {
+		successURL = system_setting.ServerAddress + "/console/log"
+	}
+	cancelURL := req.CancelURL
+	if cancelURL == "" {
+		cancelURL = system_setting.ServerAddress + "/console/topup"
+	}
+	currency := req.Currency
+	if currency == "" {
+		currency = setting.NowPaymentsPriceCurrency
+	}
+	body := map[string]any{
+		"price_amount":      req.Money,
+		"price_currency":    strings.ToLower(currency),
+		"order_id":          req.TradeNo,
+		"order_description": req.Title,
+		"ipn_callback_url":  callbackAddress() + "/api/payment/" + PaymentMethodNowPayments + "/webhook",
+		"success_url":       successURL,
+		"cancel_url":        cancelURL,
+	}
+	var invoice struct {
+		Id         json.Number `json:"id"`
+		InvoiceUrl string      `json:"invoice_url"`
+	}
+	if err := nowPaymentsRequest(ctx, "POST", "/invoice", body, &invoice); err != nil {
+		return nil, err
+	}
+	if invoice.InvoiceUrl == "" {
+		return nil, errors.New("NOWPayments 未返回支付链接")
+	}
+	return &CheckoutResult{PayLink: invoice.InvoiceUrl, ProviderOrderId: invoice.Id.String()}, nil
+}
+
+// sortedJSON 按 key 排序重新序列化，NOWPayments 对排序后的 JSON 做 HMAC-SHA512 签名
+func sortedJSON(payload []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+	// encoding/json 序列化 map 时 key 有序
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(data); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+type nowPaymentsIpn struct {
+	PaymentId     json.Number `json:"payment_id"`
+	InvoiceId     json.Number `json:"invoice_id"`
+	PaymentStatus string      `json:"payment_status"`
+	PriceAmount   json.Number `json:"price_amount"`
+	PriceCurrency string      `json:"price_currency"`
+	PayCurrency   string      `json:"pay_currency"`
+	OrderId       string      `json:"order_id"`
+}
+
+func (p *NowPaymentsProvider) VerifyWebhook(c *gin.Context) (*WebhookEvent, error) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if setting.NowPaymentsIpnSecret == "" {
+		return nil, fmt.Errorf("%w: NOWPayments ipn secret not set", ErrInvalidWebhook)
+	}
+	sorted, err := sortedJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	h := hmac.New(sha512.New, []byte(setting.NowPaymentsIpnSecret))
+	h.Write(sorted)
+	expected := hex.EncodeToString(h.Sum(nil))
+	if !hmac.Equal([]byte(strings.ToLower(c.GetHeader(NowPaymentsSignatureHeader))), []byte(expected)) {
+		return nil, fmt.Errorf("%w: NOWPayments签名验证失败", ErrInvalidWebhook)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var ipn nowPaymentsIpn
+	if err := decoder.Decode(&ipn); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if ipn.OrderId == "" {
+		return &WebhookEvent{Type: EventIgnored}, nil
+	}
+	money, _ := strconv.ParseFloat(ipn.PriceAmount.String(), 64)
+	event := &WebhookEvent{
+		TradeNo:         ipn.OrderId,
+		ProviderOrderId: ipn.InvoiceId.String(),
+		Money:           money,
+		Currency:        strings.ToUpper(ipn.PriceCurrency),
+		Payload:         string(payload),
+	}
+	switch ipn.PaymentStatus {
+	case "finished":
+		event.Type = EventPaid
+	case "expired", "failed":
+		event.Type = EventExpired
+	default:
+		// waiting、confirming、partially_paid 等中间状态
+		event.Type = EventIgnored
+	}
+	return event, nil
+}
+
+func (p *NowPaymentsProvider) AckWebhook(c *gin.Context, err error) {
+	ackWebhookStatus(c, err, http.StatusBadRequest)
+}
+
+func (p *NowPaymentsProvider) QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund 链上付款无法原路退回，需要人工处理
+func (p *NowPaymentsProvider) Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error) {
+	return nil, ErrNotSupported
+}
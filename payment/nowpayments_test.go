@@ -0,0 +1,133 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSortedJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		wantErr bool
+	}{
+		{name: "top level keys", payload: `{"b":1,"a":2,"c":3}`, want: `{"a":2,"b":1,"c":3}`},
+		{name: "nested keys", payload: `{"z":{"y":1,"x":{"d":1,"c":2}},"a":null}`, want: `{"a":null,"z":{"x":{"c":2,"d":1},"y":1}}`},
+		{name: "array order kept", payload: `{"list":[3,1,{"b":1,"a":2}]}`, want: `{"list":[3,1,{"a":2,"b":1}]}`},
+		{name: "numbers kept verbatim", payload: `{"price_amount":10.50,"payment_id":5077125051123456789,"fee":1e-8}`, want: `{"fee":1e-8,"payment_id":5077125051123456789,"price_amount":10.50}`},
+		{name: "html not escaped", payload: `{"order_description":"a<b>&c"}`, want: `{"order_description":"a<b>&c"}`},
+		{name: "unicode kept", payload: `{"title":"充值 10 美元"}`, want: `{"title":"充值 10 美元"}`},
+		{name: "whitespace removed", payload: "{\n  \"b\" : true,\n  \"a\" : false\n}", want: `{"a":false,"b":true}`},
+		{name: "invalid json", payload: `{"a":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sortedJSON([]byte(tt.payload))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %s", got)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("sortedJSON = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func hmacSHA512Hex(secret string, data []byte) string {
+	h := hmac.New(sha512.New, []byte(secret))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signNowPaymentsTest 按 NOWPayments 规则对排序后的 JSON 签名
+func signNowPaymentsTest(t *testing.T, secret string, payload string) string {
+	t.Helper()
+	sorted, err := sortedJSON([]byte(payload))
+	if err != nil {
+		t.Fatalf("sortedJSON: %v", err)
+	}
+	return hmacSHA512Hex(secret, sorted)
+}
+
+func TestNowPaymentsVerifyWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldSecret := setting.NowPaymentsIpnSecret
+	t.Cleanup(func() { setting.NowPaymentsIpnSecret = oldSecret })
+	setting.NowPaymentsIpnSecret = "ipn-secret"
+
+	ipn := func(status string) string {
+		return `{"payment_status":"` + status + `","order_id":"ORDER1","price_currency":"usd","price_amount":10.5,"pay_currency":"btc","invoice_id":4522625843,"payment_id":5077125051}`
+	}
+	tests := []struct {
+		name      string
+		payload   string
+		signature string // 为空时按 payload 正确签名
+		wantType  string
+		wantErr   bool
+	}{
+		{name: "finished", payload: ipn("finished"), wantType: EventPaid},
+		{name: "expired", payload: ipn("expired"), wantType: EventExpired},
+		{name: "failed", payload: ipn("failed"), wantType: EventExpired},
+		{name: "waiting", payload: ipn("waiting"), wantType: EventIgnored},
+		{name: "partially paid", payload: ipn("partially_paid"), wantType: EventIgnored},
+		{name: "missing order id", payload: `{"payment_status":"finished","price_amount":10.5}`, wantType: EventIgnored},
+		{name: "uppercase signature", payload: ipn("finished"), signature: strings.ToUpper(signNowPaymentsTest(t, "ipn-secret", ipn("finished"))), wantType: EventPaid},
+		{name: "signature over unsorted payload", payload: ipn("finished"), signature: hmacSHA512Hex("ipn-secret", []byte(ipn("finished"))), wantErr: true},
+		{name: "other secret", payload: ipn("finished"), signature: signNowPaymentsTest(t, "other-secret", ipn("finished")), wantErr: true},
+		{name: "tampered payload", payload: strings.Replace(ipn("finished"), "10.5", "1050", 1), signature: signNowPaymentsTest(t, "ipn-secret", ipn("finished")), wantErr: true},
+		{name: "invalid json", payload: `{"order_id":`, signature: "00", wantErr: true},
+	}
+	provider := &NowPaymentsProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := tt.signature
+			if signature == "" {
+				signature = signNowPaymentsTest(t, "ipn-secret", tt.payload)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/nowpayments/webhook", strings.NewReader(tt.payload))
+			c.Request.Header.Set(NowPaymentsSignatureHeader, signature)
+			event, err := provider.VerifyWebhook(c)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidWebhook) {
+					t.Fatalf("expected invalid webhook error, got %v, %v", event, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyWebhook: %v", err)
+			}
+			if event.Type != tt.wantType {
+				t.Fatalf("event type = %s, want %s", event.Type, tt.wantType)
+			}
+			if event.Type == EventIgnored {
+				return
+			}
+			if event.TradeNo != "ORDER1" || event.ProviderOrderId != "4522625843" || event.Money != 10.5 || event.Currency != "USD" || event.Payload != tt.payload {
+				t.Fatalf("unexpected event %+v", event)
+			}
+		})
+	}
+
+	// 未配置 IPN 密钥时拒绝所有回调
+	setting.NowPaymentsIpnSecret = ""
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/nowpayments/webhook", strings.NewReader(ipn("finished")))
+	c.Request.Header.Set(NowPaymentsSignatureHeader, signNowPaymentsTest(t, "", ipn("finished")))
+	if _, err := provider.VerifyWebhook(c); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected webhook to be rejected without secret, got %v", err)
+	}
+}
@@ -0,0 +1,469 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/gin-gonic/gin"
+)
+
+const PaymentMethodPayPal = "paypal"
+
+func init() {
+	Register(PaymentMethodPayPal, &PayPalProvider{})
+}
+
+// PayPalProvider implements PayPal Orders v2. Subscriptions are paid as one-off orders,
+// PayPal does not renew them automatically.
+type PayPalProvider struct {
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type paypalLink struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+}
+
+type paypalCapture struct {
+	Id       string       `json:"id"`
+	Status   string       `json:"status"`
+	Amount   paypalAmount `json:"amount"`
+	CustomId string       `json:"custom_id"`
+}
+
+type paypalOrder struct {
+	Id            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		CustomId string       `json:"custom_id"`
+		Amount   paypalAmount `json:"amount"`
+		Payments struct {
+			Captures []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+	Payer struct {
+		PayerId      string `json:"payer_id"`
+		EmailAddress string `json:"email_address"`
+	} `json:"payer"`
+	Links []paypalLink `json:"links"`
+}
+
+func (o *paypalOrder) customId() string {
+	if len(o.PurchaseUnits) == 0 {
+		return ""
+	}
+	return o.PurchaseUnits[0].CustomId
+}
+
+func (o *paypalOrder) capture() *paypalCapture {
+	if len(o.PurchaseUnits) == 0 || len(o.PurchaseUnits[0].Payments.Captures) == 0 {
+		return nil
+	}
+	return &o.PurchaseUnits[0].Payments.Captures[0]
+}
+
+type paypalWebhookEvent struct {
+	Id           string          `json:"id"`
+	EventType    string          `json:"event_type"`
+	ResourceType string          `json:"resource_type"`
+	Resource     json.RawMessage `json:"resource"`
+}
+
+func (p *PayPalProvider) GetName() string {
+	return "PayPal"
+}
+
+func (p *PayPalProvider) IsEnabled() bool {
+	return setting.PayPalClientId != "" && setting.PayPalClientSecret != "" && setting.PayPalWebhookId != ""
+}
+
+// paypalApiBaseOverride 非空时替换 PayPal API 地址，供测试指向本地服务
+var paypalApiBaseOverride string
+
+func paypalApiBase() string {
+	if paypalApiBaseOverride != "" {
+		return paypalApiBaseOverride
+	}
+	if setting.PayPalSandbox {
+		return "https://api-m.sandbox.paypal.com"
+	}
+	return "https://api-m.paypal.com"
+}
+
+func paypalCurrency() string {
+	if setting.PayPalCurrency == "" {
+		return "USD"
+	}
+	return strings.ToUpper(setting.PayPalCurrency)
+}
+
+// getAccessToken 获取并缓存 OAuth2 access token
+func (p *PayPalProvider) getAccessToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.accessToken != "" && time.Now().Before(p.expiresAt) {
+		return p.accessToken, nil
+	}
+	req, err := http.NewRequest("POST", paypalApiBase()+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(setting.PayPalClientId, setting.PayPalClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("PayPal oauth http status %d: %s", resp.StatusCode, string(body))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	p.accessToken = token.AccessToken
+	// 提前一分钟过期，避免请求途中失效
+	p.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn-60) * time.Second)
+	return p.accessToken, nil
+}
+
+// doRequest 调用 PayPal REST API，out 为空时忽略响应内容
+func (p *PayPalProvider) doRequest(ctx context.Context, method string, path string, body any, out any) (int, error) {
+	token, err := p.getAccessToken()
+	if err != nil {
+		return 0, err
+	}
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, paypalApiBase()+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("PayPal API http status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (p *PayPalProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error) {
+	if !p.IsEnabled() {
+		return nil, errors.New("PayPal 未配置")
+	}
+	successURL := req.SuccessURL
+	if successURL == "" {
+		successURL = system_setting.ServerAddress + "/console/log"
+	}
+	cancelURL := req.CancelURL
+	if cancelURL == "" {
+		cancelURL = system_setting.ServerAddress + "/console/topup"
+	}
+	currency := req.Currency
+	if currency == "" {
+		currency = paypalCurrency()
+	}
+	body := map[string]any{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]any{
+			{
+				"reference_id": req.TradeNo,
+				"custom_id":    req.TradeNo,
+				"invoice_id":   req.TradeNo,
+				"description":  req.Title,
+				"amount": paypalAmount{
+					CurrencyCode: currency,
+					Value:        strconv.FormatFloat(req.Money, 'f', 2, 64),
+				},
+			},
+		},
+		"application_context": map[string]any{
+			"return_url":          successURL,
+			"cancel_url":          cancelURL,
+			"user_action":         "PAY_NOW",
+			"shipping_preference": "NO_SHIPPING",
+		},
+	}
+	var order paypalOrder
+	if _, err := p.doRequest(ctx, "POST", "/v2/checkout/orders", body, &order); err != nil {
+		return nil, err
+	}
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			return &CheckoutResult{PayLink: link.Href, ProviderOrderId: order.Id}, nil
+		}
+	}
+	return nil, errors.New("PayPal 未返回支付链接")
+}
+
+// verifySignature 使用 PayPal 接口校验 webhook 签名
+func (p *PayPalProvider) verifySignature(c *gin.Context, payload []byte) error {
+	body := map[string]any{
+		"auth_algo":         c.GetHeader("PAYPAL-AUTH-ALGO"),
+		"cert_url":          c.GetHeader("PAYPAL-CERT-URL"),
+		"transmission_id":   c.GetHeader("PAYPAL-TRANSMISSION-ID"),
+		"transmission_sig":  c.GetHeader("PAYPAL-TRANSMISSION-SIG"),
+		"transmission_time": c.GetHeader("PAYPAL-TRANSMISSION-TIME"),
+		"webhook_id":        setting.PayPalWebhookId,
+		"webhook_event":     json.RawMessage(payload),
+	}
+	var result struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if _, err := p.doRequest(c.Request.Context(), "POST", "/v1/notifications/verify-webhook-signature", body, &result); err != nil {
+		return err
+	}
+	if result.VerificationStatus != "SUCCESS" {
+		return fmt.Errorf("%w: PayPal webhook签名验证失败", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+func (p *PayPalProvider) VerifyWebhook(c *gin.Context) (*WebhookEvent, error) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if setting.PayPalWebhookId == "" {
+		return nil, fmt.Errorf("%w: PayPal webhook id not set", ErrInvalidWebhook)
+	}
+	if err := p.verifySignature(c, payload); err != nil {
+		return nil, err
+	}
+	var event paypalWebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	switch event.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		// 买家确认后需要主动扣款，扣款成功后直接入账
+		var order paypalOrder
+		if err := json.Unmarshal(event.Resource, &order); err != nil {
+			return nil, err
+		}
+		var captured paypalOrder
+		status, err := p.doRequest(c.Request.Context(), "POST", "/v2/checkout/orders/"+url.PathEscape(order.Id)+"/capture", map[string]any{}, &captured)
+		if err != nil {
+			if status == http.StatusUnprocessableEntity {
+				// 订单已扣款，由 PAYMENT.CAPTURE.COMPLETED 入账
+				log.Printf("PayPal订单扣款失败，等待扣款回调: %s, %s", order.Id, err.Error())
+				return &WebhookEvent{Type: EventIgnored}, nil
+			}
+			return nil, err
+		}
+		capture := captured.capture()
+		if captured.Status != "COMPLETED" || capture == nil || capture.Status != "COMPLETED" {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		money, _ := strconv.ParseFloat(capture.Amount.Value, 64)
+		tradeNo := captured.customId()
+		if tradeNo == "" {
+			tradeNo = order.customId()
+		}
+		return &WebhookEvent{
+			Type:            EventPaid,
+			TradeNo:         tradeNo,
+			ProviderOrderId: captured.Id,
+			CustomerEmail:   captured.Payer.EmailAddress,
+			Money:           money,
+			Currency:        capture.Amount.CurrencyCode,
+			Payload:         common.GetJsonString(captured),
+		}, nil
+	case "PAYMENT.CAPTURE.COMPLETED":
+		var capture struct {
+			paypalCapture
+			SupplementaryData struct {
+				RelatedIds struct {
+					OrderId string `json:"order_id"`
+				} `json:"related_ids"`
+			} `json:"supplementary_data"`
+		}
+		if err := json.Unmarshal(event.Resource, &capture); err != nil {
+			return nil, err
+		}
+		if capture.CustomId == "" {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		money, _ := strconv.ParseFloat(capture.Amount.Value, 64)
+		return &WebhookEvent{
+			Type:            EventPaid,
+			TradeNo:         capture.CustomId,
+			ProviderOrderId: capture.SupplementaryData.RelatedIds.OrderId,
+			Money:           money,
+			Currency:        capture.Amount.CurrencyCode,
+			Payload:         string(event.Resource),
+		}, nil
+	case "PAYMENT.CAPTURE.REFUNDED":
+		var refund struct {
+			Id                     string       `json:"id"`
+			CustomId               string       `json:"custom_id"`
+			Amount                 paypalAmount `json:"amount"`
+			SellerPayableBreakdown struct {
+				TotalRefundedAmount paypalAmount `json:"total_refunded_amount"`
+			} `json:"seller_payable_breakdown"`
+		}
+		if err := json.Unmarshal(event.Resource, &refund); err != nil {
+			return nil, err
+		}
+		if refund.CustomId == "" {
+			log.Printf("PayPal退款未找到对应订单: %s", refund.Id)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		result := &WebhookEvent{
+			Type:     EventRefunded,
+			TradeNo:  refund.CustomId,
+			RefundId: refund.Id,
+			Currency: refund.Amount.CurrencyCode,
+		}
+		// 优先使用累计退款金额，缺失时按本次退款金额处理
+		if total, err := strconv.ParseFloat(refund.SellerPayableBreakdown.TotalRefundedAmount.Value, 64); err == nil && total > 0 {
+			result.RefundedTotal = total
+		} else {
+			result.Money, _ = strconv.ParseFloat(refund.Amount.Value, 64)
+		}
+		return result, nil
+	case "CHECKOUT.ORDER.VOIDED":
+		var order paypalOrder
+		if err := json.Unmarshal(event.Resource, &order); err != nil {
+			return nil, err
+		}
+		return &WebhookEvent{
+			Type:            EventExpired,
+			TradeNo:         order.customId(),
+			ProviderOrderId: order.Id,
+		}, nil
+	default:
+		return &WebhookEvent{Type: EventIgnored}, nil
+	}
+}
+
+func (p *PayPalProvider) AckWebhook(c *gin.Context, err error) {
+	ackWebhookStatus(c, err, http.StatusBadRequest)
+}
+
+func (p *PayPalProvider) getOrder(ctx context.Context, providerOrderId string) (*paypalOrder, error) {
+	if providerOrderId == "" {
+		return nil, errors.New("订单缺少 PayPal 订单号")
+	}
+	var order paypalOrder
+	if _, err := p.doRequest(ctx, "GET", "/v2/checkout/orders/"+url.PathEscape(providerOrderId), nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (p *PayPalProvider) QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error) {
+	paypalOrder, err := p.getOrder(ctx, order.ProviderOrderId)
+	if err != nil {
+		return nil, err
+	}
+	result := &OrderStatus{
+		Status:          OrderStatusPending,
+		ProviderOrderId: paypalOrder.Id,
+	}
+	if len(paypalOrder.PurchaseUnits) > 0 {
+		result.Money, _ = strconv.ParseFloat(paypalOrder.PurchaseUnits[0].Amount.Value, 64)
+		result.Currency = paypalOrder.PurchaseUnits[0].Amount.CurrencyCode
+	}
+	switch paypalOrder.Status {
+	case "COMPLETED":
+		result.Status = OrderStatusPaid
+		if capture := paypalOrder.capture(); capture != nil &&
+			(capture.Status == "REFUNDED" || capture.Status == "PARTIALLY_REFUNDED") {
+			result.Status = OrderStatusRefunded
+		}
+	case "VOIDED":
+		result.Status = OrderStatusExpired
+	}
+	return result, nil
+}
+
+func (p *PayPalProvider) Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error) {
+	paypalOrder, err := p.getOrder(ctx, order.ProviderOrderId)
+	if err != nil {
+		return nil, err
+	}
+	capture := paypalOrder.capture()
+	if capture == nil {
+		return nil, errors.New("未找到 PayPal 扣款记录")
+	}
+	body := map[string]any{
+		"custom_id":  order.TradeNo,
+		"invoice_id": order.TradeNo + "-refund-" + strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if money > 0 {
+		body["amount"] = paypalAmount{
+			CurrencyCode: capture.Amount.CurrencyCode,
+			Value:        strconv.FormatFloat(money, 'f', 2, 64),
+		}
+	}
+	if reason != "" {
+		body["note_to_payer"] = reason
+	}
+	var result struct {
+		Id     string       `json:"id"`
+		Status string       `json:"status"`
+		Amount paypalAmount `json:"amount"`
+	}
+	if _, err := p.doRequest(ctx, "POST", "/v2/payments/captures/"+url.PathEscape(capture.Id)+"/refund", body, &result); err != nil {
+		return nil, err
+	}
+	refunded, _ := strconv.ParseFloat(result.Amount.Value, 64)
+	return &RefundResult{
+		RefundId: result.Id,
+		Status:   strings.ToLower(result.Status),
+		Money:    refunded,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/gin-gonic/gin"
+)
+
+// newPayPalTestServer 模拟 PayPal 的鉴权、签名校验与扣款接口
+func newPayPalTestServer(t *testing.T, verification string, captureStatus int, captureBody string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/oauth2/token":
+			if id, secret, ok := r.BasicAuth(); !ok || id != "client-id" || secret != "client-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = io.WriteString(w, `{"access_token":"access-token","expires_in":3600}`)
+		case r.Header.Get("Authorization") != "Bearer access-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v1/notifications/verify-webhook-signature":
+			var body map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["webhook_id"] != "webhook-id" || body["transmission_id"] != "transmission" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = io.WriteString(w, `{"verification_status":"`+verification+`"}`)
+		case r.URL.Path == "/v2/checkout/orders/ORDER-1/capture":
+			w.WriteHeader(captureStatus)
+			_, _ = io.WriteString(w, captureBody)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	oldBase := paypalApiBaseOverride
+	oldId, oldSecret, oldWebhookId := setting.PayPalClientId, setting.PayPalClientSecret, setting.PayPalWebhookId
+	t.Cleanup(func() {
+		paypalApiBaseOverride = oldBase
+		setting.PayPalClientId, setting.PayPalClientSecret, setting.PayPalWebhookId = oldId, oldSecret, oldWebhookId
+	})
+	paypalApiBaseOverride = server.URL
+	setting.PayPalClientId, setting.PayPalClientSecret, setting.PayPalWebhookId = "client-id", "client-secret", "webhook-id"
+}
+
+func verifyPayPalTestWebhook(t *testing.T, payload string) (*WebhookEvent, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/payment/paypal/webhook", strings.NewReader(payload))
+	c.Request.Header.Set("PAYPAL-TRANSMISSION-ID", "transmission")
+	return (&PayPalProvider{}).VerifyWebhook(c)
+}
+
+const paypalCapturedOrder = `{"id":"ORDER-1","status":"COMPLETED","payer":{"email_address":"buyer@example.com"},
+	"purchase_units":[{"custom_id":"TRADE-1","amount":{"currency_code":"USD","value":"10.00"},
+	"payments":{"captures":[{"id":"CAPTURE-1","status":"COMPLETED","amount":{"currency_code":"USD","value":"10.00"},"custom_id":"TRADE-1"}]}}]}`
+
+func TestPayPalVerifyWebhook(t *testing.T) {
+	tests := []struct {
+		name          string
+		payload       string
+		captureStatus int
+		captureBody   string
+		want          WebhookEvent
+	}{
+		{
+			name:          "order approved and captured",
+			payload:       `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER-1","purchase_units":[{"custom_id":"TRADE-1"}]}}`,
+			captureStatus: http.StatusCreated,
+			captureBody:   paypalCapturedOrder,
+			want:          WebhookEvent{Type: EventPaid, TradeNo: "TRADE-1", ProviderOrderId: "ORDER-1", CustomerEmail: "buyer@example.com", Money: 10, Currency: "USD"},
+		},
+		{
+			name:          "trade no taken from approved order",
+			payload:       `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER-1","purchase_units":[{"custom_id":"TRADE-1"}]}}`,
+			captureStatus: http.StatusCreated,
+			captureBody:   strings.ReplaceAll(paypalCapturedOrder, `"custom_id":"TRADE-1",`, ""),
+			want:          WebhookEvent{Type: EventPaid, TradeNo: "TRADE-1", ProviderOrderId: "ORDER-1", CustomerEmail: "buyer@example.com", Money: 10, Currency: "USD"},
+		},
+		{
+			name:          "capture pending",
+			payload:       `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER-1"}}`,
+			captureStatus: http.StatusCreated,
+			captureBody:   strings.Replace(paypalCapturedOrder, `"id":"CAPTURE-1","status":"COMPLETED"`, `"id":"CAPTURE-1","status":"PENDING"`, 1),
+			want:          WebhookEvent{Type: EventIgnored},
+		},
+		{
+			// 已扣款的订单由 PAYMENT.CAPTURE.COMPLETED 入账
+			name:          "order already captured",
+			payload:       `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER-1"}}`,
+			captureStatus: http.StatusUnprocessableEntity,
+			captureBody:   `{"name":"UNPROCESSABLE_ENTITY","details":[{"issue":"ORDER_ALREADY_CAPTURED"}]}`,
+			want:          WebhookEvent{Type: EventIgnored},
+		},
+		{
+			name:    "capture completed",
+			payload: `{"event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAPTURE-1","status":"COMPLETED","custom_id":"TRADE-1","amount":{"currency_code":"EUR","value":"12.34"},"supplementary_data":{"related_ids":{"order_id":"ORDER-1"}}}}`,
+			want:    WebhookEvent{Type: EventPaid, TradeNo: "TRADE-1", ProviderOrderId: "ORDER-1", Money: 12.34, Currency: "EUR"},
+		},
+		{
+			name:    "capture without custom id",
+			payload: `{"event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAPTURE-1","amount":{"currency_code":"USD","value":"1.00"}}}`,
+			want:    WebhookEvent{Type: EventIgnored},
+		},
+		{
+			name:    "refund with total refunded",
+			payload: `{"event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REFUND-2","custom_id":"TRADE-1","amount":{"currency_code":"USD","value":"3.00"},"seller_payable_breakdown":{"total_refunded_amount":{"currency_code":"USD","value":"5.00"}}}}`,
+			want:    WebhookEvent{Type: EventRefunded, TradeNo: "TRADE-1", RefundId: "REFUND-2", RefundedTotal: 5, Currency: "USD"},
+		},
+		{
+			name:    "refund without total refunded",
+			payload: `{"event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REFUND-1","custom_id":"TRADE-1","amount":{"currency_code":"USD","value":"3.00"}}}`,
+			want:    WebhookEvent{Type: EventRefunded, TradeNo: "TRADE-1", RefundId: "REFUND-1", Money: 3, Currency: "USD"},
+		},
+		{
+			name:    "refund without custom id",
+			payload: `{"event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REFUND-1","amount":{"currency_code":"USD","value":"3.00"}}}`,
+			want:    WebhookEvent{Type: EventIgnored},
+		},
+		{
+			name:    "order voided",
+			payload: `{"event_type":"CHECKOUT.ORDER.VOIDED","resource":{"id":"ORDER-1","purchase_units":[{"custom_id":"TRADE-1"}]}}`,
+			want:    WebhookEvent{Type: EventExpired, TradeNo: "TRADE-1", ProviderOrderId: "ORDER-1"},
+		},
+		{
+			name:    "unknown event",
+			payload: `{"event_type":"CUSTOMER.DISPUTE.CREATED","resource":{}}`,
+			want:    WebhookEvent{Type: EventIgnored},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newPayPalTestServer(t, "SUCCESS", tt.captureStatus, tt.captureBody)
+			event, err := verifyPayPalTestWebhook(t, tt.payload)
+			if err != nil {
+				t.Fatalf("VerifyWebhook: %v", err)
+			}
+			got := *event
+			got.Payload = ""
+			if got != tt.want {
+				t.Fatalf("event = %+v, want %+v", got, tt.want)
+			}
+			if event.Type == EventPaid && event.Payload == "" {
+				t.Fatal("expected paid event to keep the provider payload")
+			}
+		})
+	}
+}
+
+func TestPayPalVerifyWebhookRejected(t *testing.T) {
+	payload := `{"event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"custom_id":"TRADE-1","amount":{"currency_code":"USD","value":"1.00"}}}`
+
+	newPayPalTestServer(t, "FAILURE", 0, "")
+	if _, err := verifyPayPalTestWebhook(t, payload); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected failed verification to be rejected, got %v", err)
+	}
+
+	setting.PayPalWebhookId = ""
+	if _, err := verifyPayPalTestWebhook(t, payload); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected webhook to be rejected without webhook id, got %v", err)
+	}
+
+	// 签名接口异常时返回错误，不按成功处理
+	setting.PayPalWebhookId = "webhook-id"
+	setting.PayPalClientSecret = "wrong-secret"
+	if event, err := verifyPayPalTestWebhook(t, payload); err == nil {
+		t.Fatalf("expected verification error, got %+v", event)
+	}
+}
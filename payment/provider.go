@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrNotSupported   = errors.New("payment provider does not support this operation")
+	ErrInvalidWebhook = errors.New("invalid payment webhook")
+)
+
+// Provider defines the interface for payment providers.
+// Top-up and subscription orders are both created and completed through it.
+type Provider interface {
+	// GetName returns the display name of the provider (e.g., "Stripe", "PayPal")
+	GetName() string
+
+	// IsEnabled returns whether the provider is configured
+	IsEnabled() bool
+
+	// CreateCheckout creates a payment on the provider side and returns where to send the user
+	CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error)
+
+	// VerifyWebhook verifies the callback signature and converts it into a provider independent event
+	VerifyWebhook(c *gin.Context) (*WebhookEvent, error)
+
+	// AckWebhook writes the response the provider expects for a handled (err == nil) or failed callback
+	AckWebhook(c *gin.Context, err error)
+
+	// QueryOrder fetches the payment status from the provider
+	QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error)
+
+	// Refund refunds a paid order, money <= 0 means a full refund
+	Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error)
+}
+
+// SubscriptionManager is implemented by providers that bill subscriptions on a recurring basis.
+type SubscriptionManager interface {
+	// SetCancelAtPeriodEnd cancels (or resumes) auto-renew at the end of the current period
+	SetCancelAtPeriodEnd(ctx context.Context, providerSubscriptionId string, cancel bool) error
+
+	// ChangeSubscriptionPlan switches the recurring price, the difference is settled locally
+	ChangeSubscriptionPlan(ctx context.Context, providerSubscriptionId string, plan *model.SubscriptionPlan) error
+}
+
+// TopUpPricer is implemented by providers with their own top-up pricing (e.g. Stripe unit price,
+// Creem products). Others use the generic top-up price.
+type TopUpPricer interface {
+	QuoteTopUp(req *TopUpQuoteRequest) (*TopUpQuote, error)
+}
+
+// ackWebhookStatus responds with HTTP status codes, providers retry on non-2xx responses
+func ackWebhookStatus(c *gin.Context, err error, invalidStatus int) {
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case errors.Is(err, ErrInvalidWebhook):
+		c.AbortWithStatus(invalidStatus)
+	default:
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,53 @@
+package payment
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+)
+
+var (
+	providers = make(map[string]Provider)
+	mu        sync.RWMutex
+)
+
+// Register registers a payment provider with the given payment method name
+func Register(name string, provider Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[name] = provider
+}
+
+// GetProvider returns the payment provider for the given payment method name
+func GetProvider(name string) Provider {
+	mu.RLock()
+	defer mu.RUnlock()
+	return providers[name]
+}
+
+// GetEnabledProviderNames returns the names of all configured providers
+func GetEnabledProviderNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name, provider := range providers {
+		if provider.IsEnabled() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolvePaymentMethod maps a payment method stored on an order to its provider.
+// Epay orders store the sub payment type (alipay, wxpay...) instead of the provider name.
+func ResolvePaymentMethod(method string) (string, Provider) {
+	if provider := GetProvider(method); provider != nil {
+		return method, provider
+	}
+	if operation_setting.ContainsPayMethod(method) {
+		return PaymentMethodEpay, GetProvider(PaymentMethodEpay)
+	}
+	return method, nil
+}
@@ -0,0 +1,510 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/charge"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/coupon"
+	"github.com/stripe/stripe-go/v81/invoice"
+	"github.com/stripe/stripe-go/v81/refund"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+const PaymentMethodStripe = "stripe"
+
+func init() {
+	Register(PaymentMethodStripe, &StripeProvider{})
+}
+
+// StripeProvider implements Stripe Checkout, top-ups are billed as quantity * StripePriceId and
+// subscriptions as recurring Stripe subscriptions.
+type StripeProvider struct{}
+
+func (p *StripeProvider) GetName() string {
+	return "Stripe"
+}
+
+func (p *StripeProvider) IsEnabled() bool {
+	return setting.StripeApiSecret != "" && setting.StripeWebhookSecret != ""
+}
+
+func stripeKeyValid() bool {
+	return strings.HasPrefix(setting.StripeApiSecret, "sk_") || strings.HasPrefix(setting.StripeApiSecret, "rk_")
+}
+
+// StripeChargedAmount 订单记录的美元数量，入账时按此数量 * QuotaPerUnit 充值
+func StripeChargedAmount(count float64, group string) float64 {
+	topUpGroupRatio := common.GetTopupGroupRatio(group)
+	if topUpGroupRatio == 0 {
+		topUpGroupRatio = 1
+	}
+	return count * topUpGroupRatio
+}
+
+// StripePayMoney 用户实际支付的金额
+func StripePayMoney(amount float64, group string) float64 {
+	originalAmount := amount
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		amount = amount / common.QuotaPerUnit
+	}
+	// Using float64 for monetary calculations is acceptable here due to the small amounts involved
+	topupGroupRatio := common.GetTopupGroupRatio(group)
+	if topupGroupRatio == 0 {
+		topupGroupRatio = 1
+	}
+	// apply optional preset discount by the original request amount (if configured), default 1.0
+	discount := 1.0
+	if ds, ok := operation_setting.GetPaymentSetting().AmountDiscount[int(originalAmount)]; ok {
+		if ds > 0 {
+			discount = ds
+		}
+	}
+	payMoney := amount * setting.StripeUnitPrice * topupGroupRatio * discount
+	return payMoney
+}
+
+func StripeMinTopUp() int64 {
+	minTopup := setting.StripeMinTopUp
+	if operation_setting.GetQuotaDisplayType() == operation_setting.QuotaDisplayTypeTokens {
+		minTopup = minTopup * int(common.QuotaPerUnit)
+	}
+	return int64(minTopup)
+}
+
+func (p *StripeProvider) QuoteTopUp(req *TopUpQuoteRequest) (*TopUpQuote, error) {
+	if req.Amount < StripeMinTopUp() {
+		return nil, fmt.Errorf("充值数量不能小于 %d", StripeMinTopUp())
+	}
+	if req.Amount > 10000 {
+		return nil, errors.New("充值数量不能大于 10000")
+	}
+	return &TopUpQuote{
+		Money:    StripeChargedAmount(float64(req.Amount), req.User.Group),
+		Amount:   req.Amount,
+		Quantity: req.Amount,
+		PayMoney: StripePayMoney(float64(req.Amount), req.User.Group),
+		Currency: stripeTopUpCurrency(req.User.Id),
+	}, nil
+}
+
+// stripeTopUpCurrency 用户展示货币在充值价格的 currency_options 中时以该货币收款，否则使用价格默认货币
+func stripeTopUpCurrency(userId int) string {
+	currency := model.GetUserCurrencyInfo(userId).Code
+	for _, c := range strings.Split(setting.StripeCurrencies, ",") {
+		if model.NormalizeCurrency(c) == currency && currency != model.CurrencyUSD {
+			return currency
+		}
+	}
+	return ""
+}
+
+func (p *StripeProvider) CreateCheckout(ctx context.Context, req *CheckoutRequest) (*CheckoutResult, error) {
+	if !stripeKeyValid() {
+		return nil, errors.New("Stripe 未配置或密钥无效")
+	}
+	stripe.Key = setting.StripeApiSecret
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(req.TradeNo),
+	}
+	if req.Kind == OrderKindSubscription {
+		if req.Plan == nil || req.Plan.StripePriceId == "" {
+			return nil, errors.New("该套餐未配置 StripePriceId")
+		}
+		params.SuccessURL = stripe.String(system_setting.ServerAddress + "/console/topup")
+		params.CancelURL = stripe.String(system_setting.ServerAddress + "/console/topup")
+		params.LineItems = []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(req.Plan.StripePriceId),
+				Quantity: stripe.Int64(1),
+			},
+		}
+		params.Mode = stripe.String(string(stripe.CheckoutSessionModeSubscription))
+	} else {
+		// Use custom URLs if provided, otherwise use defaults
+		successURL := req.SuccessURL
+		if successURL == "" {
+			successURL = system_setting.ServerAddress + "/console/log"
+		}
+		cancelURL := req.CancelURL
+		if cancelURL == "" {
+			cancelURL = system_setting.ServerAddress + "/console/topup"
+		}
+		params.SuccessURL = stripe.String(successURL)
+		params.CancelURL = stripe.String(cancelURL)
+		params.LineItems = []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(setting.StripePriceId),
+				Quantity: stripe.Int64(req.Quantity),
+			},
+		}
+		params.Mode = stripe.String(string(stripe.CheckoutSessionModePayment))
+		if req.DiscountRatio > 0 {
+			// Stripe 按价格 ID 计费，优惠码折扣通过一次性优惠券实现，与 Stripe 自带的促销码互斥
+			couponId, err := createStripeDiscountCoupon(req)
+			if err != nil {
+				return nil, err
+			}
+			params.Discounts = []*stripe.CheckoutSessionDiscountParams{{Coupon: stripe.String(couponId)}}
+		} else {
+			params.AllowPromotionCodes = stripe.Bool(setting.StripePromotionCodesEnabled)
+		}
+	}
+
+	user := req.User
+	if user.StripeCustomer == "" {
+		if user.Email != "" {
+			params.CustomerEmail = stripe.String(user.Email)
+		}
+		params.CustomerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
+	} else {
+		params.Customer = stripe.String(user.StripeCustomer)
+	}
+
+	if req.Currency != "" {
+		// 价格需配置对应的 currency_options 或本身即为该货币
+		params.Currency = stripe.String(strings.ToLower(req.Currency))
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutResult{PayLink: result.URL, ProviderOrderId: result.ID}, nil
+}
+
+func createStripeDiscountCoupon(req *CheckoutRequest) (string, error) {
+	percentOff := math.Round(req.DiscountRatio*10000) / 100
+	if percentOff <= 0 || percentOff >= 100 {
+		return "", errors.New("无效的优惠折扣")
+	}
+	params := &stripe.CouponParams{
+		Name:           stripe.String(req.PromoCode),
+		PercentOff:     stripe.Float64(percentOff),
+		Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+		MaxRedemptions: stripe.Int64(1),
+		RedeemBy:       stripe.Int64(time.Now().Add(24 * time.Hour).Unix()),
+	}
+	params.AddMetadata("trade_no", req.TradeNo)
+	result, err := coupon.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+func (p *StripeProvider) VerifyWebhook(c *gin.Context) (*WebhookEvent, error) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	signature := c.GetHeader("Stripe-Signature")
+	event, err := webhook.ConstructEventWithOptions(payload, signature, setting.StripeWebhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted, stripe.EventTypeCheckoutSessionExpired:
+		var checkout stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &checkout); err != nil {
+			return nil, err
+		}
+		result := &WebhookEvent{
+			Type:            EventPaid,
+			TradeNo:         checkout.ClientReferenceID,
+			ProviderOrderId: checkout.ID,
+			Money:           float64(checkout.AmountTotal) / 100,
+			Currency:        strings.ToUpper(string(checkout.Currency)),
+		}
+		if checkout.Customer != nil {
+			result.CustomerId = checkout.Customer.ID
+		}
+		// Checkout sessions in subscription mode carry the recurring Stripe subscription id
+		if checkout.Subscription != nil {
+			result.ProviderSubscriptionId = checkout.Subscription.ID
+		}
+		if event.Type == stripe.EventTypeCheckoutSessionExpired {
+			if checkout.Status != stripe.CheckoutSessionStatusExpired {
+				log.Println("错误的Stripe Checkout过期状态:", checkout.Status, ",", checkout.ClientReferenceID)
+				return &WebhookEvent{Type: EventIgnored}, nil
+			}
+			result.Type = EventExpired
+		} else if checkout.Status != stripe.CheckoutSessionStatusComplete {
+			log.Println("错误的Stripe Checkout完成状态:", checkout.Status, ",", checkout.ClientReferenceID)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		result.Payload = common.GetJsonString(map[string]any{
+			"customer":     result.CustomerId,
+			"amount_total": checkout.AmountTotal,
+			"currency":     result.Currency,
+			"event_type":   string(event.Type),
+		})
+		return result, nil
+	case stripe.EventTypeInvoicePaid, stripe.EventTypeInvoicePaymentFailed:
+		var inv stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+			return nil, err
+		}
+		if inv.Subscription == nil {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		result := &WebhookEvent{
+			ProviderSubscriptionId: inv.Subscription.ID,
+			RenewalTradeNo:         inv.ID,
+			Money:                  float64(inv.AmountPaid) / 100,
+			Currency:               strings.ToUpper(string(inv.Currency)),
+		}
+		if event.Type == stripe.EventTypeInvoicePaymentFailed {
+			if inv.BillingReason == stripe.InvoiceBillingReasonSubscriptionCreate {
+				return &WebhookEvent{Type: EventIgnored}, nil
+			}
+			result.Type = EventRenewalFailed
+			return result, nil
+		}
+		// 首期账单由 checkout.session.completed 处理
+		if inv.BillingReason != stripe.InvoiceBillingReasonSubscriptionCycle {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		if inv.Lines != nil && len(inv.Lines.Data) > 0 && inv.Lines.Data[0].Period != nil {
+			result.PeriodEnd = inv.Lines.Data[0].Period.End
+		}
+		result.Type = EventRenewalPaid
+		result.Payload = common.GetJsonString(map[string]any{
+			"invoice":      inv.ID,
+			"subscription": inv.Subscription.ID,
+			"amount_paid":  inv.AmountPaid,
+			"currency":     result.Currency,
+			"event_type":   string(event.Type),
+		})
+		return result, nil
+	case stripe.EventTypeCustomerSubscriptionUpdated, stripe.EventTypeCustomerSubscriptionDeleted:
+		var providerSub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &providerSub); err != nil {
+			return nil, err
+		}
+		return &WebhookEvent{
+			Type:                   EventSubscriptionUpdated,
+			ProviderSubscriptionId: providerSub.ID,
+			CancelAtPeriodEnd:      providerSub.CancelAtPeriodEnd,
+			SubscriptionEnded:      event.Type == stripe.EventTypeCustomerSubscriptionDeleted || providerSub.Status == stripe.SubscriptionStatusCanceled,
+		}, nil
+	case stripe.EventTypeChargeRefunded:
+		var ch stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+			return nil, err
+		}
+		tradeNo, err := stripeResolveTradeNo(&ch)
+		if err != nil {
+			return nil, err
+		}
+		if tradeNo == "" {
+			log.Println("Stripe退款未找到对应订单:", ch.ID)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		if ch.Amount <= 0 {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		result := &WebhookEvent{
+			Type:        EventRefunded,
+			TradeNo:     tradeNo,
+			RefundRatio: float64(ch.AmountRefunded) / float64(ch.Amount),
+			Currency:    strings.ToUpper(string(ch.Currency)),
+		}
+		if ch.Refunds != nil && len(ch.Refunds.Data) > 0 {
+			result.RefundId = ch.Refunds.Data[0].ID
+		}
+		return result, nil
+	case stripe.EventTypeChargeDisputeCreated:
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return nil, err
+		}
+		if dispute.Charge == nil {
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		stripe.Key = setting.StripeApiSecret
+		ch, err := charge.Get(dispute.Charge.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		tradeNo, err := stripeResolveTradeNo(ch)
+		if err != nil {
+			return nil, err
+		}
+		if tradeNo == "" || ch.Amount <= 0 {
+			log.Println("Stripe拒付未找到对应订单:", dispute.ID)
+			return &WebhookEvent{Type: EventIgnored}, nil
+		}
+		return &WebhookEvent{
+			Type:        EventChargeback,
+			TradeNo:     tradeNo,
+			RefundId:    dispute.ID,
+			RefundRatio: float64(dispute.Amount) / float64(ch.Amount),
+			Currency:    strings.ToUpper(string(dispute.Currency)),
+			Payload:     string(dispute.Reason),
+		}, nil
+	default:
+		return &WebhookEvent{Type: EventIgnored}, nil
+	}
+}
+
+// stripeResolveTradeNo 根据扣款找到本地订单号：
+// 续费扣款的订单号为发票 ID，其余通过 Checkout Session 的 client_reference_id 查找
+func stripeResolveTradeNo(ch *stripe.Charge) (string, error) {
+	if ch.Invoice != nil && ch.Invoice.ID != "" && model.GetSubscriptionOrderByTradeNo(ch.Invoice.ID) != nil {
+		return ch.Invoice.ID, nil
+	}
+	stripe.Key = setting.StripeApiSecret
+	params := &stripe.CheckoutSessionListParams{}
+	if ch.Invoice != nil && ch.Invoice.ID != "" {
+		// 订阅首期扣款，经发票找到订阅再找到创建订阅的 Checkout Session
+		inv, err := invoice.Get(ch.Invoice.ID, nil)
+		if err != nil {
+			return "", err
+		}
+		if inv.Subscription == nil {
+			return "", nil
+		}
+		params.Subscription = stripe.String(inv.Subscription.ID)
+	} else if ch.PaymentIntent != nil && ch.PaymentIntent.ID != "" {
+		params.PaymentIntent = stripe.String(ch.PaymentIntent.ID)
+	} else {
+		return "", nil
+	}
+	params.Limit = stripe.Int64(1)
+	iter := session.List(params)
+	if iter.Next() {
+		return iter.CheckoutSession().ClientReferenceID, nil
+	}
+	return "", iter.Err()
+}
+
+func (p *StripeProvider) AckWebhook(c *gin.Context, err error) {
+	ackWebhookStatus(c, err, http.StatusBadRequest)
+}
+
+func (p *StripeProvider) QueryOrder(ctx context.Context, order *OrderRef) (*OrderStatus, error) {
+	if order.ProviderOrderId == "" {
+		return nil, errors.New("订单缺少 Stripe Checkout Session ID")
+	}
+	stripe.Key = setting.StripeApiSecret
+	checkout, err := session.Get(order.ProviderOrderId, nil)
+	if err != nil {
+		return nil, err
+	}
+	status := OrderStatusPending
+	switch {
+	case checkout.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid:
+		status = OrderStatusPaid
+	case checkout.Status == stripe.CheckoutSessionStatusExpired:
+		status = OrderStatusExpired
+	}
+	return &OrderStatus{
+		Status:          status,
+		Money:           float64(checkout.AmountTotal) / 100,
+		Currency:        strings.ToUpper(string(checkout.Currency)),
+		ProviderOrderId: checkout.ID,
+	}, nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, order *OrderRef, money float64, reason string) (*RefundResult, error) {
+	if order.ProviderOrderId == "" {
+		return nil, errors.New("订单缺少 Stripe Checkout Session ID")
+	}
+	stripe.Key = setting.StripeApiSecret
+	checkout, err := session.Get(order.ProviderOrderId, nil)
+	if err != nil {
+		return nil, err
+	}
+	paymentIntentId := ""
+	if checkout.PaymentIntent != nil {
+		paymentIntentId = checkout.PaymentIntent.ID
+	} else if checkout.Invoice != nil {
+		// 订阅模式的付款记录在首期发票上
+		inv, err := invoice.Get(checkout.Invoice.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		if inv.PaymentIntent != nil {
+			paymentIntentId = inv.PaymentIntent.ID
+		}
+	}
+	if paymentIntentId == "" {
+		return nil, errors.New("未找到 Stripe 付款记录")
+	}
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentIntentId),
+	}
+	// 订单金额与 Stripe 实际收款不一定相同（按单价计费），部分退款按比例换算
+	if money > 0 && order.Money > 0 && money < order.Money {
+		params.Amount = stripe.Int64(int64(float64(checkout.AmountTotal)*money/order.Money + 0.5))
+	}
+	params.AddMetadata("trade_no", order.TradeNo)
+	if reason != "" {
+		params.AddMetadata("reason", reason)
+	}
+	result, err := refund.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &RefundResult{
+		RefundId: result.ID,
+		Status:   string(result.Status),
+		Money:    float64(result.Amount) / 100,
+	}, nil
+}
+
+// SetCancelAtPeriodEnd 取消或恢复 Stripe 订阅的自动续费
+func (p *StripeProvider) SetCancelAtPeriodEnd(ctx context.Context, providerSubscriptionId string, cancel bool) error {
+	stripe.Key = setting.StripeApiSecret
+	_, err := subscription.Update(providerSubscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(cancel),
+	})
+	return err
+}
+
+// ChangeSubscriptionPlan 变更 Stripe 订阅价格，差价已在钱包中结算，Stripe 侧不再按比例计费
+func (p *StripeProvider) ChangeSubscriptionPlan(ctx context.Context, providerSubscriptionId string, plan *model.SubscriptionPlan) error {
+	if plan.StripePriceId == "" {
+		return errors.New("目标套餐未配置 StripePriceId")
+	}
+	stripe.Key = setting.StripeApiSecret
+	providerSub, err := subscription.Get(providerSubscriptionId, nil)
+	if err != nil {
+		return err
+	}
+	if providerSub.Items == nil || len(providerSub.Items.Data) == 0 {
+		return errors.New("Stripe 订阅没有订阅项")
+	}
+	_, err = subscription.Update(providerSubscriptionId, &stripe.SubscriptionParams{
+		Items: []*stripe.SubscriptionItemsParams{
+			{
+				ID:    stripe.String(providerSub.Items.Data[0].ID),
+				Price: stripe.String(plan.StripePriceId),
+			},
+		},
+		ProrationBehavior: stripe.String("none"),
+	})
+	return err
+}
@@ -0,0 +1,132 @@
+package payment
+
+import "github.com/Zer0Echo/uniapi/model"
+
+// 订单类型
+const (
+	OrderKindTopUp        = "topup"
+	OrderKindSubscription = "subscription"
+)
+
+// CheckoutRequest 创建支付所需的信息
+type CheckoutRequest struct {
+	Kind     string
+	TradeNo  string
+	Title    string
+	Money    float64
+	Currency string
+
+	// 充值订单
+	Quantity  int64  // Stripe 按单价计费的数量
+	ProductId string // Creem 产品
+
+	// 订阅订单
+	Plan *model.SubscriptionPlan
+
+	// 优惠码折扣占支付金额的比例，仅用于按单价计费的渠道（Stripe），其余渠道的折扣已体现在 Money 中
+	DiscountRatio float64
+	PromoCode     string
+
+	PayType string // 易支付子支付方式（alipay、wxpay 等）
+	User    *model.User
+
+	SuccessURL string
+	CancelURL  string
+}
+
+// CheckoutResult 拉起支付的结果
+type CheckoutResult struct {
+	PayLink         string            // 跳转地址
+	Params          map[string]string // 需要表单提交的参数（易支付）
+	ProviderOrderId string
+}
+
+// 回调事件类型
+const (
+	EventPaid                = "paid"                 // 订单支付成功
+	EventExpired             = "expired"              // 订单超时或取消
+	EventRenewalPaid         = "renewal_paid"         // 订阅周期续费成功
+	EventRenewalFailed       = "renewal_failed"       // 订阅周期续费扣款失败
+	EventSubscriptionUpdated = "subscription_updated" // 订阅在渠道侧被取消或恢复
+	EventRefunded            = "refunded"             // 渠道侧退款（含后台手动退款）
+	EventChargeback          = "chargeback"           // 拒付
+	EventIgnored             = "ignored"
+)
+
+// WebhookEvent 渠道无关的回调事件
+type WebhookEvent struct {
+	Type            string
+	TradeNo         string
+	ProviderOrderId string
+
+	CustomerId    string
+	CustomerEmail string
+
+	Money    float64
+	Currency string
+
+	// 订阅相关
+	ProviderSubscriptionId string
+	RenewalTradeNo         string // 续费扣款的渠道流水号
+	PeriodEnd              int64
+	CancelAtPeriodEnd      bool
+	SubscriptionEnded      bool
+
+	// 退款与拒付：RefundedTotal 为累计退款金额，拒付金额记在 Money。
+	// 渠道结算金额与订单金额不一致时（如 Stripe 按单价计费）改用 RefundRatio，
+	// 退款时为累计退款占支付金额的比例，拒付时为本次拒付的比例
+	RefundId      string
+	RefundedTotal float64
+	RefundRatio   float64
+
+	Payload string
+}
+
+// OrderRef 查单、退款时使用的本地订单信息
+type OrderRef struct {
+	TradeNo         string
+	ProviderOrderId string
+	Money           float64
+	Currency        string
+}
+
+// 渠道侧订单状态
+const (
+	OrderStatusPending  = "pending"
+	OrderStatusPaid     = "paid"
+	OrderStatusExpired  = "expired"
+	OrderStatusRefunded = "refunded"
+)
+
+type OrderStatus struct {
+	Status          string  `json:"status"`
+	Money           float64 `json:"money"`
+	Currency        string  `json:"currency"`
+	ProviderOrderId string  `json:"provider_order_id"`
+}
+
+type RefundResult struct {
+	RefundId string  `json:"refund_id"`
+	Status   string  `json:"status"`
+	Money    float64 `json:"money"`
+}
+
+type TopUpQuoteRequest struct {
+	Amount    int64
+	ProductId string
+	User      *model.User
+}
+
+// TopUpQuote 充值报价，Amount 为写入订单的数量，其含义由各渠道的入账规则决定
+type TopUpQuote struct {
+	Money     float64
+	Amount    int64
+	Quantity  int64
+	ProductId string
+	Title     string
+	Currency  string
+	// 用户实际支付金额，仅在与 Money 含义不同时（Stripe 订单的 Money 为入账数量）设置
+	PayMoney float64
+	// 渠道侧固定价格（Creem 产品），不支持优惠码与赠送档位
+	FixedPrice bool
+}
@@ -0,0 +1,94 @@
+package ali
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+// queryAccountBalanceResponse https://help.aliyun.com/document_detail/87997.html
+type queryAccountBalanceResponse struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+	Success bool   `json:"Success"`
+	Data    struct {
+		AvailableAmount string `json:"AvailableAmount"`
+		Currency        string `json:"Currency"`
+	} `json:"Data"`
+}
+
+// FetchBalance 百炼 API Key 无法查询余额，通过费用中心 OpenAPI 查询账户可用额度，需要配置 AK|SK 格式的管理密钥
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	if req.AdminKey == "" {
+		return nil, errors.New("查询阿里云余额需要配置 AccessKeyId|AccessKeySecret 格式的管理密钥")
+	}
+	accessKey, secretKey, err := channel.SplitAccessKey(req.AdminKey)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("Action", "QueryAccountBalance")
+	query.Set("Version", "2017-12-14")
+	query.Set("Format", "JSON")
+	query.Set("AccessKeyId", accessKey)
+	query.Set("SignatureMethod", "HMAC-SHA1")
+	query.Set("SignatureVersion", "1.0")
+	query.Set("SignatureNonce", common.GetUUID())
+	query.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	query.Set("Signature", signRPCQuery("GET", query, secretKey))
+	body, err := channel.DoBalanceRequest(req, "GET", "https://business.aliyuncs.com/?"+canonicalizeQuery(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	response := queryAccountBalanceResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("code: %s, message: %s", response.Code, response.Message)
+	}
+	balance, err := strconv.ParseFloat(strings.ReplaceAll(response.Data.AvailableAmount, ",", ""), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: balance, Currency: response.Data.Currency}, nil
+}
+
+// signRPCQuery 阿里云 RPC 风格 OpenAPI 签名
+func signRPCQuery(method string, query url.Values, secretKey string) string {
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(canonicalizeQuery(query))
+	h := hmac.New(sha1.New, []byte(secretKey+"&"))
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func canonicalizeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, percentEncode(k)+"="+percentEncode(query.Get(k)))
+	}
+	return strings.Join(parts, "&")
+}
+
+// percentEncode 阿里云要求的 URL 编码：空格为 %20，* 为 %2A，~ 不编码
+func percentEncode(value string) string {
+	encoded := url.QueryEscape(value)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	return strings.ReplaceAll(encoded, "%7E", "~")
+}
@@ -0,0 +1,83 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/service"
+)
+
+// BalanceFetcher 支持查询上游账户余额或用量的适配器实现此接口
+type BalanceFetcher interface {
+	FetchBalance(req *BalanceRequest) (*Balance, error)
+}
+
+// BalanceRequest 查询余额所需的渠道信息，密钥均为明文
+type BalanceRequest struct {
+	ChannelType int
+	BaseURL     string
+	Key         string
+	AdminKey    string // 管理密钥，用于官方用量接口或需要 AK/SK 签名的账单接口
+	AccountId   string
+	Proxy       string
+}
+
+// Balance 上游返回的金额，Currency 为空时表示美元。
+// UsageOnly 为 true 时 Amount 为本月已消耗的金额，由调用方结合每月预算计算余额
+type Balance struct {
+	Amount    float64
+	Currency  string
+	UsageOnly bool
+}
+
+// DoBalanceRequest 通过渠道代理请求余额接口，非 200 响应视为失败
+func DoBalanceRequest(req *BalanceRequest, method string, url string, headers http.Header) ([]byte, error) {
+	httpReq, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k := range headers {
+		httpReq.Header.Set(k, headers.Get(k))
+	}
+	return DoBalanceHttpRequest(req, httpReq)
+}
+
+// DoBalanceHttpRequest 发送已构造好的余额请求，用于需要签名的接口
+func DoBalanceHttpRequest(req *BalanceRequest, httpReq *http.Request) ([]byte, error) {
+	client, err := service.NewProxyHttpClient(req.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// BearerAuthHeader Authorization: Bearer 认证头
+func BearerAuthHeader(token string) http.Header {
+	h := http.Header{}
+	h.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return h
+}
+
+// SplitAccessKey 解析 ak|sk 格式的管理密钥
+func SplitAccessKey(key string) (string, string, error) {
+	parts := strings.Split(key, "|")
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return "", "", errors.New("管理密钥格式应为 AccessKey|SecretKey")
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
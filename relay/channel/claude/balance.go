@@ -0,0 +1,74 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+// costReportResponse https://docs.anthropic.com/en/api/admin-api/usage-cost/get-cost-report
+type costReportResponse struct {
+	Data []struct {
+		Results []struct {
+			Currency string `json:"currency"`
+			Amount   string `json:"amount"` // 最小货币单位（美分）
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool    `json:"has_more"`
+	NextPage *string `json:"next_page"`
+}
+
+// FetchBalance Anthropic 没有余额接口，使用 Admin API 的费用报告查询本月消耗，需要配置管理密钥
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	if req.AdminKey == "" {
+		return nil, errors.New("查询 Anthropic 用量需要配置 Admin API 密钥")
+	}
+	headers := http.Header{}
+	headers.Set("x-api-key", req.AdminKey)
+	headers.Set("anthropic-version", "2023-06-01")
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	var cents float64
+	page := ""
+	for {
+		query := url.Values{}
+		query.Set("starting_at", start)
+		query.Set("bucket_width", "1d")
+		query.Set("limit", "31")
+		if page != "" {
+			query.Set("page", page)
+		}
+		body, err := channel.DoBalanceRequest(req, "GET", fmt.Sprintf("%s/v1/organizations/cost_report?%s", req.BaseURL, query.Encode()), headers)
+		if err != nil {
+			return nil, err
+		}
+		response := costReportResponse{}
+		if err = common.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		for _, bucket := range response.Data {
+			for _, result := range bucket.Results {
+				if result.Currency != "" && !strings.EqualFold(result.Currency, "USD") {
+					return nil, fmt.Errorf("unsupported currency: %s", result.Currency)
+				}
+				amount, err := strconv.ParseFloat(result.Amount, 64)
+				if err != nil {
+					return nil, err
+				}
+				cents += amount
+			}
+		}
+		if !response.HasMore || response.NextPage == nil || *response.NextPage == "" {
+			break
+		}
+		page = *response.NextPage
+	}
+	return &channel.Balance{Amount: cents / 100, UsageOnly: true}, nil
+}
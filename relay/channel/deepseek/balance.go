@@ -0,0 +1,44 @@
+package deepseek
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+type balanceResponse struct {
+	IsAvailable  bool `json:"is_available"`
+	BalanceInfos []struct {
+		Currency        string `json:"currency"`
+		TotalBalance    string `json:"total_balance"`
+		GrantedBalance  string `json:"granted_balance"`
+		ToppedUpBalance string `json:"topped_up_balance"`
+	} `json:"balance_infos"`
+}
+
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	body, err := channel.DoBalanceRequest(req, "GET", "https://api.deepseek.com/user/balance", channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := balanceResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	// 优先使用人民币余额，账户只有美元余额时使用美元
+	for _, currency := range []string{"CNY", "USD"} {
+		for _, info := range response.BalanceInfos {
+			if info.Currency != currency {
+				continue
+			}
+			balance, err := strconv.ParseFloat(info.TotalBalance, 64)
+			if err != nil {
+				return nil, err
+			}
+			return &channel.Balance{Amount: balance, Currency: currency}, nil
+		}
+	}
+	return nil, errors.New("currency CNY or USD not found")
+}
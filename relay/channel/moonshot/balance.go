@@ -0,0 +1,34 @@
+package moonshot
+
+import (
+	"fmt"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+type balanceResponse struct {
+	Code int `json:"code"`
+	Data struct {
+		AvailableBalance float64 `json:"available_balance"`
+		VoucherBalance   float64 `json:"voucher_balance"`
+		CashBalance      float64 `json:"cash_balance"`
+	} `json:"data"`
+	Scode  string `json:"scode"`
+	Status bool   `json:"status"`
+}
+
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	body, err := channel.DoBalanceRequest(req, "GET", "https://api.moonshot.cn/v1/users/me/balance", channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := balanceResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if !response.Status || response.Code != 0 {
+		return nil, fmt.Errorf("failed to update moonshot balance, status: %v, code: %d, scode: %s", response.Status, response.Code, response.Scode)
+	}
+	return &channel.Balance{Amount: response.Data.AvailableBalance, Currency: "CNY"}, nil
+}
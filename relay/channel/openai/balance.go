@@ -0,0 +1,190 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+// https://github.com/songquanpeng/one-api/issues/79
+
+type subscriptionResponse struct {
+	HasPaymentMethod bool    `json:"has_payment_method"`
+	HardLimitUSD     float64 `json:"hard_limit_usd"`
+}
+
+type usageResponse struct {
+	TotalUsage float64 `json:"total_usage"` // unit: 0.01 dollar
+}
+
+type creditGrantsResponse struct {
+	TotalAvailable float64 `json:"total_available"`
+	TotalRemaining float64 `json:"total_remaining"`
+}
+
+type aiProxyUserOverviewResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	ErrorCode int    `json:"error_code"`
+	Data      struct {
+		TotalPoints float64 `json:"totalPoints"`
+	} `json:"data"`
+}
+
+type openRouterCreditResponse struct {
+	Data struct {
+		TotalCredits float64 `json:"total_credits"`
+		TotalUsage   float64 `json:"total_usage"`
+	} `json:"data"`
+}
+
+// organizationCostsResponse https://platform.openai.com/docs/api-reference/usage/costs
+type organizationCostsResponse struct {
+	Data []struct {
+		Results []struct {
+			Amount struct {
+				Value    float64 `json:"value"`
+				Currency string  `json:"currency"`
+			} `json:"amount"`
+		} `json:"results"`
+	} `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	switch req.ChannelType {
+	case constant.ChannelTypeOpenAI:
+		// 配置了管理密钥时使用官方组织费用接口
+		if req.AdminKey != "" {
+			return fetchOrganizationCosts(req)
+		}
+		return fetchDashboardBalance(req)
+	case constant.ChannelTypeCustom:
+		return fetchDashboardBalance(req)
+	case constant.ChannelTypeAIProxy:
+		return fetchAIProxyBalance(req)
+	case constant.ChannelTypeAPI2GPT:
+		return fetchCreditGrants(req, "https://api.api2gpt.com/dashboard/billing/credit_grants", true)
+	case constant.ChannelTypeAIGC2D:
+		return fetchCreditGrants(req, "https://api.aigc2d.com/dashboard/billing/credit_grants", false)
+	case constant.ChannelTypeOpenRouter:
+		return fetchOpenRouterBalance(req)
+	}
+	return nil, errors.New("尚未实现")
+}
+
+// fetchDashboardBalance 旧版 dashboard 接口，余额为订阅额度减去本月用量
+func fetchDashboardBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	url := fmt.Sprintf("%s/v1/dashboard/billing/subscription", req.BaseURL)
+	body, err := channel.DoBalanceRequest(req, "GET", url, channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	subscription := subscriptionResponse{}
+	if err = common.Unmarshal(body, &subscription); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	startDate := fmt.Sprintf("%s-01", now.Format("2006-01"))
+	endDate := now.Format("2006-01-02")
+	if !subscription.HasPaymentMethod {
+		startDate = now.AddDate(0, 0, -100).Format("2006-01-02")
+	}
+	url = fmt.Sprintf("%s/v1/dashboard/billing/usage?start_date=%s&end_date=%s", req.BaseURL, startDate, endDate)
+	body, err = channel.DoBalanceRequest(req, "GET", url, channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	usage := usageResponse{}
+	if err = common.Unmarshal(body, &usage); err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: subscription.HardLimitUSD - usage.TotalUsage/100}, nil
+}
+
+// fetchOrganizationCosts 官方组织费用接口只能查询消耗，返回本月消耗的金额
+func fetchOrganizationCosts(req *channel.BalanceRequest) (*channel.Balance, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Unix()
+	var total float64
+	page := ""
+	for {
+		url := fmt.Sprintf("%s/v1/organization/costs?start_time=%d&bucket_width=1d&limit=31", req.BaseURL, start)
+		if page != "" {
+			url += "&page=" + page
+		}
+		body, err := channel.DoBalanceRequest(req, "GET", url, channel.BearerAuthHeader(req.AdminKey))
+		if err != nil {
+			return nil, err
+		}
+		response := organizationCostsResponse{}
+		if err = common.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		for _, bucket := range response.Data {
+			for _, result := range bucket.Results {
+				if result.Amount.Currency != "" && !strings.EqualFold(result.Amount.Currency, "usd") {
+					return nil, fmt.Errorf("unsupported currency: %s", result.Amount.Currency)
+				}
+				total += result.Amount.Value
+			}
+		}
+		if !response.HasMore || response.NextPage == "" {
+			break
+		}
+		page = response.NextPage
+	}
+	return &channel.Balance{Amount: total, UsageOnly: true}, nil
+}
+
+func fetchAIProxyBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	headers := http.Header{}
+	headers.Set("Api-Key", req.Key)
+	body, err := channel.DoBalanceRequest(req, "GET", "https://aiproxy.io/api/report/getUserOverview", headers)
+	if err != nil {
+		return nil, err
+	}
+	response := aiProxyUserOverviewResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("code: %d, message: %s", response.ErrorCode, response.Message)
+	}
+	return &channel.Balance{Amount: response.Data.TotalPoints}, nil
+}
+
+// fetchCreditGrants credit_grants 接口，API2GPT 使用 total_remaining，其余使用 total_available
+func fetchCreditGrants(req *channel.BalanceRequest, url string, remaining bool) (*channel.Balance, error) {
+	body, err := channel.DoBalanceRequest(req, "GET", url, channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := creditGrantsResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if remaining {
+		return &channel.Balance{Amount: response.TotalRemaining}, nil
+	}
+	return &channel.Balance{Amount: response.TotalAvailable}, nil
+}
+
+func fetchOpenRouterBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	body, err := channel.DoBalanceRequest(req, "GET", "https://openrouter.ai/api/v1/credits", channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := openRouterCreditResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: response.Data.TotalCredits - response.Data.TotalUsage}, nil
+}
@@ -0,0 +1,39 @@
+package siliconflow
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+type userInfoResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  bool   `json:"status"`
+	Data    struct {
+		Balance       string `json:"balance"`
+		ChargeBalance string `json:"chargeBalance"`
+		TotalBalance  string `json:"totalBalance"`
+	} `json:"data"`
+}
+
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	body, err := channel.DoBalanceRequest(req, "GET", "https://api.siliconflow.cn/v1/user/info", channel.BearerAuthHeader(req.Key))
+	if err != nil {
+		return nil, err
+	}
+	response := userInfoResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.Code != 20000 {
+		return nil, fmt.Errorf("code: %d, message: %s", response.Code, response.Message)
+	}
+	balance, err := strconv.ParseFloat(response.Data.TotalBalance, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: balance, Currency: "CNY"}, nil
+}
@@ -0,0 +1,103 @@
+package volcengine
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+const (
+	billingHost    = "open.volcengineapi.com"
+	billingRegion  = "cn-north-1"
+	billingService = "billing"
+)
+
+// queryBalanceAcctResponse https://www.volcengine.com/docs/6269/1124085
+type queryBalanceAcctResponse struct {
+	ResponseMetadata struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	} `json:"ResponseMetadata"`
+	Result struct {
+		AvailableBalance string `json:"AvailableBalance"`
+	} `json:"Result"`
+}
+
+// FetchBalance 方舟 API Key 无法查询余额，通过费用中心 OpenAPI 查询账户可用余额，需要配置 AK|SK 格式的管理密钥
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	if req.AdminKey == "" {
+		return nil, errors.New("查询火山引擎余额需要配置 AccessKey|SecretKey 格式的管理密钥")
+	}
+	accessKey, secretKey, err := channel.SplitAccessKey(req.AdminKey)
+	if err != nil {
+		return nil, err
+	}
+	payload := []byte("{}")
+	httpReq, err := http.NewRequest(http.MethodPost, "https://"+billingHost+"/?Action=QueryBalanceAcct&Version=2022-01-01", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	signBillingRequest(httpReq, payload, accessKey, secretKey, time.Now().UTC())
+	body, err := channel.DoBalanceHttpRequest(req, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	response := queryBalanceAcctResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.ResponseMetadata.Error != nil {
+		return nil, fmt.Errorf("code: %s, message: %s", response.ResponseMetadata.Error.Code, response.ResponseMetadata.Error.Message)
+	}
+	balance, err := strconv.ParseFloat(response.Result.AvailableBalance, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: balance, Currency: "CNY"}, nil
+}
+
+// signBillingRequest 火山引擎 OpenAPI HMAC-SHA256 签名，查询参数需按字典序排列
+func signBillingRequest(req *http.Request, payload []byte, accessKey, secretKey string, now time.Time) {
+	xDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	hexPayloadHash := hex.EncodeToString(payloadHash[:])
+	req.Header.Set("Host", billingHost)
+	req.Header.Set("X-Date", xDate)
+	req.Header.Set("X-Content-Sha256", hexPayloadHash)
+
+	signedHeaders := "content-type;host;x-content-sha256;x-date"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-content-sha256:%s\nx-date:%s\n",
+		req.Header.Get("Content-Type"), billingHost, hexPayloadHash, xDate)
+	canonicalRequest := fmt.Sprintf("%s\n/\n%s\n%s\n%s\n%s",
+		req.Method, req.URL.Query().Encode(), canonicalHeaders, signedHeaders, hexPayloadHash)
+	hashedCanonicalRequest := sha256.Sum256([]byte(canonicalRequest))
+
+	credentialScope := fmt.Sprintf("%s/%s/%s/request", shortDate, billingRegion, billingService)
+	stringToSign := fmt.Sprintf("HMAC-SHA256\n%s\n%s\n%s", xDate, credentialScope, hex.EncodeToString(hashedCanonicalRequest[:]))
+	kDate := hmacSHA256([]byte(secretKey), shortDate)
+	kRegion := hmacSHA256(kDate, billingRegion)
+	kService := hmacSHA256(kRegion, billingService)
+	kSigning := hmacSHA256(kService, "request")
+	signature := hex.EncodeToString(hmacSHA256(kSigning, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, credentialScope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
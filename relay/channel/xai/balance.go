@@ -0,0 +1,39 @@
+package xai
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/relay/channel"
+)
+
+// prepaidBalanceResponse https://docs.x.ai/docs/management-api
+type prepaidBalanceResponse struct {
+	Total struct {
+		Val string `json:"val"` // 美分，预付余额为负数
+	} `json:"total"`
+}
+
+// FetchBalance 通过 Management API 查询团队的预付余额，需要配置管理密钥和 team id
+func (a *Adaptor) FetchBalance(req *channel.BalanceRequest) (*channel.Balance, error) {
+	if req.AdminKey == "" || req.AccountId == "" {
+		return nil, errors.New("查询 xAI 余额需要配置 Management API 密钥和 team id")
+	}
+	requestURL := fmt.Sprintf("https://management-api.x.ai/v1/billing/teams/%s/prepaid/balance", url.PathEscape(req.AccountId))
+	body, err := channel.DoBalanceRequest(req, "GET", requestURL, channel.BearerAuthHeader(req.AdminKey))
+	if err != nil {
+		return nil, err
+	}
+	response := prepaidBalanceResponse{}
+	if err = common.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	cents, err := strconv.ParseFloat(response.Total.Val, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &channel.Balance{Amount: -cents / 100}, nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -121,6 +122,9 @@ type RelayInfo struct {
 	// Billing 是计费会话，封装了预扣费/结算/退款的统一生命周期。
 	// 免费模型和按次计费（MJ/Task）时为 nil。
 	Billing BillingSettler
+	// OrgId / ProjectId 非 0 时表示使用项目令牌，计费从组织钱包扣除
+	OrgId     int
+	ProjectId int
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
 	// "" or "wallet" => wallet; "subscription" => subscription
 	BillingSource string
@@ -133,6 +137,13 @@ type RelayInfo struct {
 	// SubscriptionPlanId / SubscriptionPlanTitle are used for logging/UI display.
 	SubscriptionPlanId    int
 	SubscriptionPlanTitle string
+	// SubscriptionAllowanceModel / SubscriptionAllowanceMetric are set when the request is metered
+	// against a per-model allowance of the plan instead of the subscription total amount.
+	SubscriptionAllowanceModel    string
+	SubscriptionAllowanceMetric   string
+	SubscriptionAllowanceConsumed int64
+	// UsageTotalTokens is the actual prompt+completion tokens, set before settlement.
+	UsageTotalTokens int
 	// RequestId is used for idempotent pre-consume/refund
 	RequestId string
 	// SubscriptionAmountTotal / SubscriptionAmountUsedAfterPreConsume are used to compute remaining in logs.
@@ -449,6 +460,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrgId:          common.GetContextKeyInt(c, constant.ContextKeyTokenOrgId),
+		ProjectId:      common.GetContextKeyInt(c, constant.ContextKeyTokenProjectId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -630,6 +643,42 @@ func (t *TaskSubmitReq) HasImage() bool {
 	return len(t.Images) > 0
 }
 
+// VideoSeconds 返回请求的视频时长（秒），兼容 seconds、duration 与 metadata.duration
+func (t *TaskSubmitReq) VideoSeconds() float64 {
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(t.Seconds), 64); err == nil && seconds > 0 {
+		return seconds
+	}
+	if t.Duration > 0 {
+		return float64(t.Duration)
+	}
+	switch v := t.Metadata["duration"].(type) {
+	case float64:
+		return v
+	case string:
+		seconds, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return seconds
+	}
+	return 0
+}
+
+// VideoResolution 返回请求的视频分辨率，优先使用 metadata.resolution
+func (t *TaskSubmitReq) VideoResolution() string {
+	if v, ok := t.Metadata["resolution"].(string); ok && v != "" {
+		return v
+	}
+	return t.Size
+}
+
+// VideoAudio 返回请求是否生成音频
+func (t *TaskSubmitReq) VideoAudio() bool {
+	for _, key := range []string{"generate_audio", "audio", "with_audio"} {
+		if v, ok := t.Metadata[key].(bool); ok {
+			return v
+		}
+	}
+	return false
+}
+
 func (t *TaskSubmitReq) UnmarshalJSON(data []byte) error {
 	type Alias TaskSubmitReq
 	aux := &struct {
@@ -686,6 +735,10 @@ type TaskInfo struct {
 	Progress         string `json:"progress,omitempty"`
 	CompletionTokens int    `json:"completion_tokens,omitempty"` // 用于按倍率计费
 	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	// 以下字段用于视频按秒计费结算，上游未返回时留空
+	Duration   float64 `json:"duration,omitempty"`
+	Resolution string  `json:"resolution,omitempty"`
+	HasAudio   *bool   `json:"has_audio,omitempty"`
 }
 
 func FailTaskInfo(reason string) *TaskInfo {
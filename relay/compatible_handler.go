@@ -421,8 +421,10 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		service.RecordChannelKeyConsume(relayInfo, totalTokens, quota)
 	}
 
+	relayInfo.UsageTotalTokens = totalTokens
 	if err := service.SettleBilling(ctx, relayInfo, quota); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
@@ -455,6 +457,9 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["cache_creation_tokens"] = cachedCreationTokens
 		other["cache_creation_ratio"] = cachedCreationRatio
 	}
+	if usage.CompletionTokenDetails.ReasoningTokens != 0 {
+		other["reasoning_tokens"] = usage.CompletionTokenDetails.ReasoningTokens
+	}
 	if !dWebSearchQuota.IsZero() {
 		if relayInfo.ResponsesUsageInfo != nil {
 			if webSearchTool, exists := relayInfo.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; exists {
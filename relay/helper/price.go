@@ -6,6 +6,7 @@ import (
 	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/logger"
 	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/setting"
 	"github.com/Zer0Echo/uniapi/setting/operation_setting"
 	"github.com/Zer0Echo/uniapi/setting/ratio_setting"
 	"github.com/Zer0Echo/uniapi/types"
@@ -162,6 +163,38 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 	return priceData
 }
 
+// MjModelPrice 返回 MJ 操作的单价与实际使用的速度模式倍率：模型价格中配置了 mj_<action>_<mode> 时直接使用该价格，
+// 否则使用 mj_<action> 的价格（未配置时取默认价格）乘以速度模式倍率
+func MjModelPrice(modelName string, mode string) (float64, float64) {
+	if mode != "" {
+		if price, ok := ratio_setting.GetModelPrice(modelName+"_"+mode, false); ok {
+			return price, 1
+		}
+	}
+	modelPrice, ok := ratio_setting.GetModelPrice(modelName, false)
+	if !ok {
+		modelPrice, ok = ratio_setting.GetDefaultModelPriceMap()[modelName]
+		if !ok {
+			modelPrice = 0.1
+		}
+	}
+	modeRatio := setting.GetMjModeRatio(mode)
+	return modelPrice * modeRatio, modeRatio
+}
+
+// MjPriceHelper MJ 按次计费，价格见 MjModelPrice
+func MjPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, mode string) types.PerCallPriceData {
+	groupRatioInfo := HandleGroupRatio(c, info)
+
+	modelPrice, _ := MjModelPrice(info.OriginModelName, mode)
+	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
+	return types.PerCallPriceData{
+		ModelPrice:     modelPrice,
+		Quota:          quota,
+		GroupRatioInfo: groupRatioInfo,
+	}
+}
+
 func ContainPriceOrRatio(modelName string) bool {
 	_, ok := ratio_setting.GetModelPrice(modelName, false)
 	if ok {
@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/setting/ratio_setting"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMjPriceHelper(t *testing.T) {
+	oldModelPrice := ratio_setting.ModelPrice2JSONString()
+	oldGroupRatio := ratio_setting.GroupRatio2JSONString()
+	oldModeRatio := setting.MjModeRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelPriceByJSONString(oldModelPrice)
+		_ = ratio_setting.UpdateGroupRatioByJSONString(oldGroupRatio)
+		_ = setting.UpdateMjModeRatioByJSONString(oldModeRatio)
+	})
+	if err := ratio_setting.UpdateModelPriceByJSONString(`{"mj_imagine":0.2,"mj_imagine_relax":0.03}`); err != nil {
+		t.Fatalf("failed to set model price: %v", err)
+	}
+	if err := ratio_setting.UpdateGroupRatioByJSONString(`{"default":1,"vip":2}`); err != nil {
+		t.Fatalf("failed to set group ratio: %v", err)
+	}
+	if err := setting.UpdateMjModeRatioByJSONString(`{"relax":0.5,"fast":1,"turbo":2}`); err != nil {
+		t.Fatalf("failed to set mode ratio: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		model         string
+		mode          string
+		group         string
+		wantPrice     float64
+		wantModeRatio float64
+	}{
+		{name: "model price", model: "mj_imagine", group: "default", wantPrice: 0.2, wantModeRatio: 1},
+		{name: "default model price fallback", model: "mj_upscale", group: "default", wantPrice: 0.05, wantModeRatio: 1},
+		{name: "unknown model default", model: "mj_unknown", group: "default", wantPrice: 0.1, wantModeRatio: 1},
+		{name: "turbo mode ratio", model: "mj_imagine", mode: "turbo", group: "default", wantPrice: 0.4, wantModeRatio: 2},
+		{name: "mode price skips ratio", model: "mj_imagine", mode: "relax", group: "default", wantPrice: 0.03, wantModeRatio: 1},
+		{name: "relax ratio on default price", model: "mj_upscale", mode: "relax", group: "default", wantPrice: 0.025, wantModeRatio: 0.5},
+		{name: "unconfigured mode", model: "mj_imagine", mode: "slow", group: "default", wantPrice: 0.2, wantModeRatio: 1},
+		{name: "group ratio applies to quota", model: "mj_imagine", mode: "turbo", group: "vip", wantPrice: 0.4, wantModeRatio: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, modeRatio := MjModelPrice(tt.model, tt.mode); modeRatio != tt.wantModeRatio {
+				t.Fatalf("mode ratio = %v, want %v", modeRatio, tt.wantModeRatio)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			info := &relaycommon.RelayInfo{OriginModelName: tt.model, UserGroup: tt.group, UsingGroup: tt.group}
+			priceData := MjPriceHelper(c, info, tt.mode)
+			if math.Abs(priceData.ModelPrice-tt.wantPrice) > 1e-9 {
+				t.Fatalf("model price = %v, want %v", priceData.ModelPrice, tt.wantPrice)
+			}
+			groupRatio := map[string]float64{"default": 1, "vip": 2}[tt.group]
+			if want := int(tt.wantPrice * common.QuotaPerUnit * groupRatio); priceData.Quota != want {
+				t.Fatalf("quota = %d, want %d", priceData.Quota, want)
+			}
+		})
+	}
+}
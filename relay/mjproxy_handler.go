@@ -186,9 +186,9 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 	}
 	modelName := service.CoverActionToModelName(constant.MjActionSwapFace)
 
-	priceData := helper.ModelPriceHelperPerCall(c, info)
+	priceData := helper.MjPriceHelper(c, info, setting.ParseMjMode(c.Param("mode"), ""))
 
-	userQuota, err := model.GetUserQuota(info.UserId, false)
+	userQuota, err := service.GetPayerQuota(info)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -252,6 +252,8 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		OrgId:       info.OrgId,
+		ProjectId:   info.ProjectId,
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
@@ -283,8 +285,12 @@ func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 	if channel.Status != common.ChannelStatusEnabled {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
 	}
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "get_channel_info_failed")
+	}
 	c.Set("channel_id", originTask.ChannelId)
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", plainKey))
 
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	fullRequestURL := fmt.Sprintf("%s%s", channel.GetBaseURL(), requestURL)
@@ -457,9 +463,13 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			if channel.Status != common.ChannelStatusEnabled {
 				return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
 			}
+			plainKey, err := channel.GetPlainKey()
+			if err != nil {
+				return service.MidjourneyErrorWrapper(constant.MjRequestError, "get_channel_info_failed")
+			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", plainKey))
 			log.Printf("检测到此操作为放大、变换、重绘，获取原channel信息: %s,%s", strconv.Itoa(originTask.ChannelId), channel.GetBaseURL())
 		}
 		midjRequest.Prompt = originTask.Prompt
@@ -487,9 +497,10 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 
 	modelName := service.CoverActionToModelName(midjRequest.Action)
 
-	priceData := helper.ModelPriceHelperPerCall(c, relayInfo)
+	mjMode := setting.ParseMjMode(c.Param("mode"), midjRequest.Prompt)
+	priceData := helper.MjPriceHelper(c, relayInfo, mjMode)
 
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := service.GetPayerQuota(relayInfo)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -519,6 +530,11 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
 			other := service.GenerateMjOtherInfo(relayInfo, priceData)
+			if mjMode != "" {
+				logContent = fmt.Sprintf("%s，模式 %s", logContent, mjMode)
+				other["mj_mode"] = mjMode
+				_, other["mj_mode_ratio"] = helper.MjModelPrice(modelName, mjMode)
+			}
 			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
 				ChannelId: relayInfo.ChannelId,
 				ModelName: modelName,
@@ -559,6 +575,8 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		OrgId:       relayInfo.OrgId,
+		ProjectId:   relayInfo.ProjectId,
 	}
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
@@ -599,9 +617,12 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			responseBody = []byte(newBody)
 		}
 	}
-	if midjResponse.Code == 1 && midjRequest.Action == "UPLOAD" {
+	if midjResponse.Code == 1 && midjRequest.Action == constant.MjActionUpload {
 		midjourneyTask.Progress = "100%"
 		midjourneyTask.Status = "SUCCESS"
+		if urls, ok := midjResponse.Properties.([]string); ok && len(urls) > 0 {
+			midjourneyTask.ImageUrl = urls[0]
+		}
 	}
 	err = midjourneyTask.Insert()
 	if err != nil {
@@ -180,12 +180,28 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
 	}
-	userQuota, err := model.GetUserQuota(info.UserId, false)
+	userQuota, err := service.GetPayerQuota(info)
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 		return
 	}
 	quota := int(ratio * common.QuotaPerUnit)
+
+	// 视频按秒计费：按请求的时长、分辨率与音频开关预扣，任务完成后按实际输出结算
+	var videoPricing *ratio_setting.VideoPriceBreakdown
+	if videoPrice, ok := ratio_setting.GetVideoPrice(modelName); ok {
+		videoPricing, err = estimateVideoPrice(c, info, videoPrice)
+		if err != nil {
+			taskErr = service.TaskErrorWrapperLocal(err, "invalid_video_pricing", http.StatusBadRequest)
+			return
+		}
+		finalGroupRatio := groupRatio
+		if hasUserGroupRatio {
+			finalGroupRatio = userGroupRatio
+		}
+		quota = videoPricing.ToQuota(finalGroupRatio)
+		videoPricing.PreConsumeQuota = quota
+	}
 	if userQuota-quota < 0 {
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
@@ -226,7 +242,9 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				//}
 				logContent := fmt.Sprintf("操作 %s", info.Action)
 				// FIXME: 临时修补，支持任务仅按次计费
-				if common.StringsContains(constant.TaskPricePatches, modelName) {
+				if videoPricing != nil {
+					logContent = fmt.Sprintf("%s，按秒预扣（%s）", logContent, videoPricing.String())
+				} else if common.StringsContains(constant.TaskPricePatches, modelName) {
 					logContent = fmt.Sprintf("%s，按次计费", logContent)
 				} else {
 					if len(info.PriceData.OtherRatios) > 0 {
@@ -250,6 +268,9 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
 				}
+				if videoPricing != nil {
+					other["video_pricing"] = videoPricing
+				}
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
 					ChannelId: info.ChannelId,
 					ModelName: modelName,
@@ -277,6 +298,7 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	task.Quota = quota
 	task.Data = taskData
 	task.Action = info.Action
+	task.Properties.VideoPricing = videoPricing
 	err = task.Insert()
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
@@ -285,6 +307,26 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	return nil
 }
 
+// estimateVideoPrice 根据请求参数预估视频价格，请求未携带的参数使用配置中的默认值
+func estimateVideoPrice(c *gin.Context, info *relaycommon.RelayInfo, videoPrice ratio_setting.VideoPrice) (*ratio_setting.VideoPriceBreakdown, error) {
+	var seconds float64
+	var resolution string
+	var audio bool
+	if req, err := relaycommon.GetTaskRequest(c); err == nil {
+		seconds = req.VideoSeconds()
+		resolution = req.VideoResolution()
+		audio = req.VideoAudio()
+	}
+	if seconds <= 0 {
+		seconds = info.PriceData.OtherRatios["seconds"]
+	}
+	breakdown, err := videoPrice.Calculate(seconds, resolution, audio)
+	if err != nil {
+		return nil, err
+	}
+	return &breakdown, nil
+}
+
 var fetchRespBuilders = map[int]func(c *gin.Context) (respBody []byte, taskResp *dto.TaskError){
 	relayconstant.RelayModeSunoFetchByID:  sunoFetchByIDRespBodyBuilder,
 	relayconstant.RelayModeSunoFetch:      sunoFetchRespBodyBuilder,
@@ -400,7 +442,11 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		if adaptor == nil {
 			return
 		}
-		resp, err2 := adaptor.FetchTask(baseURL, channelModel.Key, map[string]any{
+		plainKey, err2 := channelModel.GetPlainKey()
+		if err2 != nil {
+			return
+		}
+		resp, err2 := adaptor.FetchTask(baseURL, plainKey, map[string]any{
 			"task_id": originTask.TaskID,
 			"action":  originTask.Action,
 		}, proxy)
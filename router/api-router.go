@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/Zer0Echo/uniapi/constant"
 	"github.com/Zer0Echo/uniapi/controller"
 	"github.com/Zer0Echo/uniapi/middleware"
 
@@ -22,7 +23,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(constant.PermissionChannelsRead), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/user-agreement", controller.GetUserAgreement)
 		apiRouter.GET("/privacy-policy", controller.GetPrivacyPolicy)
@@ -43,10 +44,15 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/telegram/bind", middleware.CriticalRateLimit(), controller.TelegramBind)
 		// Standard OAuth providers (GitHub, Discord, OIDC, LinuxDO) - unified route
 		apiRouter.GET("/oauth/:provider", middleware.CriticalRateLimit(), controller.HandleOAuth)
+		apiRouter.GET("/saml/metadata", controller.SAMLMetadata)
+		apiRouter.GET("/saml/login", middleware.CriticalRateLimit(), controller.SAMLLogin)
+		apiRouter.POST("/saml/acs", middleware.CriticalRateLimit(), controller.SAMLAssertionConsumer)
 		apiRouter.GET("/ratio_config", middleware.CriticalRateLimit(), controller.GetRatioConfig)
 
 		apiRouter.POST("/stripe/webhook", controller.StripeWebhook)
 		apiRouter.POST("/creem/webhook", controller.CreemWebhook)
+		apiRouter.POST("/payment/:provider/webhook", controller.PaymentWebhook)
+		apiRouter.GET("/payment/:provider/webhook", controller.PaymentWebhook)
 
 		// Universal secure verification routes
 		apiRouter.POST("/verify", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.UniversalVerify)
@@ -88,6 +94,8 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.RequestStripePay)
 				selfRoute.POST("/stripe/amount", controller.RequestStripeAmount)
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
+				selfRoute.POST("/payment/pay", middleware.CriticalRateLimit(), controller.RequestPaymentPay)
+				selfRoute.POST("/topup/quote", controller.GetTopUpQuote)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
 
@@ -109,25 +117,45 @@ func SetApiRouter(router *gin.Engine) {
 				// Quota records (expiring balance)
 				selfRoute.GET("/self/quota_records", controller.GetSelfQuotaRecords)
 				selfRoute.GET("/self/quota_summary", controller.GetSelfQuotaSummary)
+				selfRoute.GET("/self/ledger", controller.GetSelfLedgerEntries)
+
+				// Invoices and monthly statements
+				selfRoute.GET("/self/invoice_info", controller.GetSelfInvoiceInfo)
+				selfRoute.PUT("/self/invoice_info", controller.UpdateSelfInvoiceInfo)
+				selfRoute.GET("/self/statements", controller.GetSelfStatements)
+				selfRoute.GET("/self/statements/:id", controller.GetSelfStatement)
+				selfRoute.GET("/self/statements/:id/download", controller.DownloadSelfStatement)
+
+				// Display currency
+				selfRoute.GET("/self/currency", controller.GetSelfCurrency)
+				selfRoute.PUT("/self/currency", controller.UpdateSelfCurrency)
 			}
 
-			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminReadRoute := userRoute.Group("/")
+			adminReadRoute.Use(middleware.PermissionAuth(constant.PermissionUsersRead))
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
-				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
-
-				// Admin 2FA routes
-				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
-				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminReadRoute.GET("/", controller.GetAllUsers)
+				adminReadRoute.GET("/search", controller.SearchUsers)
+				adminReadRoute.GET("/:id", controller.GetUser)
+				adminReadRoute.GET("/2fa/stats", controller.Admin2FAStats)
+			}
+			adminWriteRoute := userRoute.Group("/")
+			adminWriteRoute.Use(middleware.PermissionAuth(constant.PermissionUsersWrite))
+			{
+				adminWriteRoute.POST("/", controller.CreateUser)
+				adminWriteRoute.POST("/manage", controller.ManageUser)
+				adminWriteRoute.PUT("/", controller.UpdateUser)
+				adminWriteRoute.DELETE("/:id", controller.DeleteUser)
+				adminWriteRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminWriteRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+			}
+			adminTopUpRoute := userRoute.Group("/topup")
+			{
+				adminTopUpRoute.GET("", middleware.PermissionAuth(constant.PermissionBillingRead), controller.GetAllTopUps)
+				adminTopUpRoute.GET("/query", middleware.PermissionAuth(constant.PermissionBillingRead), controller.AdminQueryPaymentOrder)
+				adminTopUpRoute.GET("/refunds", middleware.PermissionAuth(constant.PermissionBillingRead), controller.AdminGetPaymentRefunds)
+				adminTopUpRoute.POST("/complete", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminCompleteTopUp)
+				adminTopUpRoute.POST("/refund", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminRefundPaymentOrder)
 			}
 		}
 
@@ -138,21 +166,30 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.GET("/plans", controller.GetSubscriptionPlans)
 			subscriptionRoute.GET("/self", controller.GetSubscriptionSelf)
 			subscriptionRoute.PUT("/self/preference", controller.UpdateSubscriptionPreference)
+			subscriptionRoute.POST("/self/:id/cancel", middleware.CriticalRateLimit(), controller.CancelSubscriptionRenewal)
+			subscriptionRoute.POST("/self/:id/resume", middleware.CriticalRateLimit(), controller.ResumeSubscriptionRenewal)
+			subscriptionRoute.GET("/self/:id/change", controller.PreviewSubscriptionPlanChange)
+			subscriptionRoute.POST("/self/:id/change", middleware.CriticalRateLimit(), controller.ChangeSubscriptionPlan)
 			subscriptionRoute.POST("/epay/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestEpay)
 			subscriptionRoute.POST("/stripe/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestStripePay)
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
+			subscriptionRoute.POST("/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestPayment)
+		}
+		subscriptionAdminReadRoute := apiRouter.Group("/subscription/admin")
+		subscriptionAdminReadRoute.Use(middleware.PermissionAuth(constant.PermissionSubscriptionsRead))
+		{
+			subscriptionAdminReadRoute.GET("/plans", controller.AdminListSubscriptionPlans)
+			subscriptionAdminReadRoute.GET("/users/:id/subscriptions", controller.AdminListUserSubscriptions)
 		}
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
-		subscriptionAdminRoute.Use(middleware.AdminAuth())
+		subscriptionAdminRoute.Use(middleware.PermissionAuth(constant.PermissionSubscriptionsWrite))
 		{
-			subscriptionAdminRoute.GET("/plans", controller.AdminListSubscriptionPlans)
 			subscriptionAdminRoute.POST("/plans", controller.AdminCreateSubscriptionPlan)
 			subscriptionAdminRoute.PUT("/plans/:id", controller.AdminUpdateSubscriptionPlan)
 			subscriptionAdminRoute.PATCH("/plans/:id", controller.AdminUpdateSubscriptionPlanStatus)
 			subscriptionAdminRoute.POST("/bind", controller.AdminBindSubscription)
 
 			// User subscription management (admin)
-			subscriptionAdminRoute.GET("/users/:id/subscriptions", controller.AdminListUserSubscriptions)
 			subscriptionAdminRoute.POST("/users/:id/subscriptions", controller.AdminCreateUserSubscription)
 			subscriptionAdminRoute.POST("/user_subscriptions/:id/invalidate", controller.AdminInvalidateUserSubscription)
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
@@ -174,6 +211,18 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 
+		// Fine-grained admin roles (root only)
+		adminRoleRoute := apiRouter.Group("/admin_role")
+		adminRoleRoute.Use(middleware.RootAuth())
+		{
+			adminRoleRoute.GET("/", controller.GetAdminRoles)
+			adminRoleRoute.GET("/permissions", controller.GetAllPermissions)
+			adminRoleRoute.POST("/", controller.CreateAdminRole)
+			adminRoleRoute.POST("/assign", controller.AssignAdminRole)
+			adminRoleRoute.PUT("/:id", controller.UpdateAdminRole)
+			adminRoleRoute.DELETE("/:id", controller.DeleteAdminRole)
+		}
+
 		// Custom OAuth provider management (admin only)
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
 		customOAuthRoute.Use(middleware.RootAuth())
@@ -198,15 +247,25 @@ func SetApiRouter(router *gin.Engine) {
 			ratioSyncRoute.GET("/channels", controller.GetSyncableChannels)
 			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
 		}
+		channelReadRoute := apiRouter.Group("/channel")
+		channelReadRoute.Use(middleware.PermissionAuth(constant.PermissionChannelsRead))
+		{
+			channelReadRoute.GET("/", controller.GetAllChannels)
+			channelReadRoute.GET("/search", controller.SearchChannels)
+			channelReadRoute.GET("/models", controller.ChannelListModels)
+			channelReadRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelReadRoute.GET("/:id", controller.GetChannel)
+			channelReadRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
+			channelReadRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
+			channelReadRoute.GET("/:id/balance_history", controller.GetChannelBalanceHistory)
+			channelReadRoute.GET("/ollama/version/:id", controller.OllamaVersion)
+			channelReadRoute.GET("/tag/models", controller.GetTagModels)
+		}
+		// 查看渠道密钥仅限超级管理员
+		apiRouter.POST("/channel/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
+		channelRoute.Use(middleware.PermissionAuth(constant.PermissionChannelsWrite))
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
@@ -220,32 +279,31 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
 			channelRoute.POST("/batch", controller.DeleteChannelBatch)
 			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
 			channelRoute.POST("/fetch_models", controller.FetchModels)
 			channelRoute.POST("/codex/oauth/start", controller.StartCodexOAuth)
 			channelRoute.POST("/codex/oauth/complete", controller.CompleteCodexOAuth)
 			channelRoute.POST("/:id/codex/oauth/start", controller.StartCodexOAuthForChannel)
 			channelRoute.POST("/:id/codex/oauth/complete", controller.CompleteCodexOAuthForChannel)
 			channelRoute.POST("/:id/codex/refresh", controller.RefreshCodexChannelCredential)
-			channelRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
 			channelRoute.POST("/ollama/pull", controller.OllamaPullModel)
 			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
 			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
-			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
 			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
-			channelRoute.GET("/tag/models", controller.GetTagModels)
 			channelRoute.POST("/copy/:id", controller.CopyChannel)
 			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
 		}
 		tokenRoute := apiRouter.Group("/token")
-		tokenRoute.Use(middleware.UserAuth())
+		tokenRoute.Use(middleware.UserAuth(), middleware.AuditRequest())
 		{
 			tokenRoute.GET("/", controller.GetAllTokens)
 			tokenRoute.GET("/search", middleware.SearchRateLimit(), controller.SearchTokens)
+			tokenRoute.GET("/scopes", controller.GetTokenScopes)
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.POST("/:id/regenerate", middleware.CriticalRateLimit(), controller.RegenerateTokenKey)
+			tokenRoute.POST("/:id/revoke_derived", controller.RevokeTokenDerivedTokens)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
@@ -260,39 +318,82 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionRedemptionsRead), controller.GetRedemption)
+			redemptionRoute.POST("/", middleware.PermissionAuth(constant.PermissionRedemptionsCreate), controller.AddRedemption)
+			redemptionRoute.PUT("/", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.UpdateRedemption)
+			redemptionRoute.DELETE("/invalid", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.DeleteInvalidRedemption)
+			redemptionRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionRedemptionsWrite), controller.DeleteRedemption)
+		}
+		topUpPackageRoute := apiRouter.Group("/topup_package")
+		{
+			topUpPackageRoute.GET("/", middleware.PermissionAuth(constant.PermissionBillingRead), controller.AdminListTopUpPackages)
+			topUpPackageRoute.POST("/", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminCreateTopUpPackage)
+			topUpPackageRoute.PUT("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminUpdateTopUpPackage)
+			topUpPackageRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminDeleteTopUpPackage)
+		}
+		promoCodeRoute := apiRouter.Group("/promo_code")
+		{
+			promoCodeRoute.GET("/", middleware.PermissionAuth(constant.PermissionBillingRead), controller.AdminListPromoCodes)
+			promoCodeRoute.POST("/", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminCreatePromoCode)
+			promoCodeRoute.PUT("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminUpdatePromoCode)
+			promoCodeRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminDeletePromoCode)
+		}
+		exchangeRateRoute := apiRouter.Group("/exchange_rate")
+		{
+			exchangeRateRoute.GET("/", middleware.PermissionAuth(constant.PermissionBillingRead), controller.AdminListExchangeRates)
+			exchangeRateRoute.POST("/", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminCreateExchangeRate)
+			exchangeRateRoute.POST("/refresh", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminRefreshExchangeRates)
+			exchangeRateRoute.PUT("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminUpdateExchangeRate)
+			exchangeRateRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.AdminDeleteExchangeRate)
 		}
 		quotaRecordRoute := apiRouter.Group("/quota_record")
-		quotaRecordRoute.Use(middleware.AdminAuth())
 		{
-			quotaRecordRoute.GET("/user/:id", controller.GetUserQuotaRecords)
-			quotaRecordRoute.GET("/user/:id/summary", controller.GetUserQuotaSummary)
-			quotaRecordRoute.PUT("/:id", controller.UpdateQuotaRecord)
+			quotaRecordRoute.GET("/user/:id", middleware.PermissionAuth(constant.PermissionUsersRead), controller.GetUserQuotaRecords)
+			quotaRecordRoute.GET("/user/:id/summary", middleware.PermissionAuth(constant.PermissionUsersRead), controller.GetUserQuotaSummary)
+			quotaRecordRoute.PUT("/:id", middleware.PermissionAuth(constant.PermissionUsersQuota), controller.UpdateQuotaRecord)
+		}
+		ledgerRoute := apiRouter.Group("/ledger")
+		{
+			ledgerRoute.GET("/", middleware.PermissionAuth(constant.PermissionBillingRead), controller.GetLedgerEntries)
+			ledgerRoute.POST("/reconcile", middleware.RootAuth(), controller.ReconcileLedger)
+		}
+		statementRoute := apiRouter.Group("/statement")
+		{
+			statementRoute.GET("/", middleware.PermissionAuth(constant.PermissionBillingRead), controller.GetAllStatements)
+			statementRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionBillingRead), controller.GetStatement)
+			statementRoute.GET("/:id/download", middleware.PermissionAuth(constant.PermissionBillingRead), controller.DownloadStatement)
+			statementRoute.POST("/regenerate", middleware.PermissionAuth(constant.PermissionBillingWrite), controller.RegenerateStatement)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(constant.PermissionLogsDelete), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/channel_affinity_usage_cache", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetChannelAffinityUsageCacheStats)
+		logRoute.GET("/search", middleware.PermissionAuth(constant.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.ExportUserLogs)
+		logRoute.GET("/export", middleware.PermissionAuth(constant.PermissionLogsRead), controller.ExportAllLogs)
+		logRoute.GET("/export/runs", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetLogExportRuns)
+		logRoute.POST("/export/run", middleware.RootAuth(), controller.RunLogExport)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
 
+		auditLogRoute := apiRouter.Group("/audit_log")
+		auditLogRoute.Use(middleware.PermissionAuth(constant.PermissionAuditRead))
+		{
+			auditLogRoute.GET("/", controller.GetAuditLogs)
+			auditLogRoute.GET("/export", controller.ExportAuditLogs)
+		}
+
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		dashboardRoute := apiRouter.Group("/dashboard")
-		dashboardRoute.GET("/overview", middleware.AdminAuth(), controller.GetDashboardOverview)
+		dashboardRoute.GET("/overview", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetDashboardOverview)
 		dashboardRoute.GET("/overview/self", middleware.UserAuth(), controller.GetDashboardOverviewSelf)
 
 		logRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
@@ -300,58 +401,60 @@ func SetApiRouter(router *gin.Engine) {
 			logRoute.GET("/token", middleware.TokenAuthReadOnly(), controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.AnyPermissionAuth(constant.PermissionChannelsRead, constant.PermissionUsersRead, constant.PermissionModelsRead, constant.PermissionSubscriptionsRead, constant.PermissionRedemptionsRead))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
 		{
-			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
-			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
-			prefillGroupRoute.PUT("/", controller.UpdatePrefillGroup)
-			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
+			prefillGroupRoute.GET("/", middleware.AnyPermissionAuth(constant.PermissionChannelsRead, constant.PermissionModelsRead), controller.GetPrefillGroups)
+			prefillGroupRoute.POST("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.CreatePrefillGroup)
+			prefillGroupRoute.PUT("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.UpdatePrefillGroup)
+			prefillGroupRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.DeletePrefillGroup)
 		}
 
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(constant.PermissionLogsRead), controller.GetAllTask)
+			taskRoute.POST("/bulk", middleware.PermissionAuth(constant.PermissionTasksManage), controller.AdminBulkTask)
+			taskRoute.POST("/:id/repoll", middleware.PermissionAuth(constant.PermissionTasksManage), controller.AdminRepollTask)
+			taskRoute.POST("/:id/cancel", middleware.PermissionAuth(constant.PermissionTasksManage), controller.AdminCancelTask)
+			taskRoute.POST("/:id/refund", middleware.PermissionAuth(constant.PermissionTasksManage), controller.AdminRefundTask)
+			taskRoute.POST("/:id/result", middleware.PermissionAuth(constant.PermissionTasksManage), controller.AdminSetTaskResult)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
 		{
-			vendorRoute.GET("/", controller.GetAllVendors)
-			vendorRoute.GET("/search", controller.SearchVendors)
-			vendorRoute.GET("/:id", controller.GetVendorMeta)
-			vendorRoute.POST("/", controller.CreateVendorMeta)
-			vendorRoute.PUT("/", controller.UpdateVendorMeta)
-			vendorRoute.DELETE("/:id", controller.DeleteVendorMeta)
+			vendorRoute.GET("/", middleware.PermissionAuth(constant.PermissionModelsRead), controller.GetAllVendors)
+			vendorRoute.GET("/search", middleware.PermissionAuth(constant.PermissionModelsRead), controller.SearchVendors)
+			vendorRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionModelsRead), controller.GetVendorMeta)
+			vendorRoute.POST("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.CreateVendorMeta)
+			vendorRoute.PUT("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.UpdateVendorMeta)
+			vendorRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.DeleteVendorMeta)
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
 		{
-			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
-			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
-			modelsRoute.GET("/missing", controller.GetMissingModels)
-			modelsRoute.GET("/", controller.GetAllModelsMeta)
-			modelsRoute.GET("/search", controller.SearchModelsMeta)
-			modelsRoute.GET("/:id", controller.GetModelMeta)
-			modelsRoute.POST("/", controller.CreateModelMeta)
-			modelsRoute.PUT("/", controller.UpdateModelMeta)
-			modelsRoute.DELETE("/:id", controller.DeleteModelMeta)
+			modelsRoute.GET("/sync_upstream/preview", middleware.PermissionAuth(constant.PermissionModelsRead), controller.SyncUpstreamPreview)
+			modelsRoute.POST("/sync_upstream", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.SyncUpstreamModels)
+			modelsRoute.GET("/missing", middleware.PermissionAuth(constant.PermissionModelsRead), controller.GetMissingModels)
+			modelsRoute.GET("/", middleware.PermissionAuth(constant.PermissionModelsRead), controller.GetAllModelsMeta)
+			modelsRoute.GET("/search", middleware.PermissionAuth(constant.PermissionModelsRead), controller.SearchModelsMeta)
+			modelsRoute.GET("/:id", middleware.PermissionAuth(constant.PermissionModelsRead), controller.GetModelMeta)
+			modelsRoute.POST("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.CreateModelMeta)
+			modelsRoute.PUT("/", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.UpdateModelMeta)
+			modelsRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionModelsWrite), controller.DeleteModelMeta)
 		}
 
 		// Deployments (model deployment management)
 		deploymentsRoute := apiRouter.Group("/deployments")
-		deploymentsRoute.Use(middleware.AdminAuth())
+		deploymentsRoute.Use(middleware.PermissionAuth(constant.PermissionDeploymentsManage))
 		{
 			deploymentsRoute.GET("/settings", controller.GetModelDeploymentSettings)
 			deploymentsRoute.POST("/settings/test-connection", controller.TestIoNetConnection)
@@ -375,6 +478,36 @@ func SetApiRouter(router *gin.Engine) {
 			deploymentsRoute.DELETE("/:id", controller.DeleteDeployment)
 		}
 
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationAdminRoute := organizationRoute.Group("/admin")
+			organizationAdminRoute.Use(middleware.PermissionAuth(constant.PermissionOrganizationsManage))
+			{
+				organizationAdminRoute.GET("/", controller.GetAllOrganizations)
+				organizationAdminRoute.PUT("/:id", controller.AdminUpdateOrganization)
+				organizationAdminRoute.POST("/:id/subscriptions", controller.AdminBindOrganizationSubscription)
+			}
+			organizationUserRoute := organizationRoute.Group("/")
+			organizationUserRoute.Use(middleware.UserAuth())
+			{
+				organizationUserRoute.GET("/self", controller.GetSelfOrganizations)
+				organizationUserRoute.POST("/", controller.CreateOrganization)
+				organizationUserRoute.GET("/:id", controller.GetOrganization)
+				organizationUserRoute.PUT("/:id", controller.UpdateOrganization)
+				organizationUserRoute.POST("/:id/transfer", controller.TransferQuotaToOrganization)
+				organizationUserRoute.GET("/:id/members", controller.GetOrganizationMembers)
+				organizationUserRoute.POST("/:id/members", controller.AddOrganizationMember)
+				organizationUserRoute.PUT("/:id/members/:user_id", controller.UpdateOrganizationMember)
+				organizationUserRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+				organizationUserRoute.GET("/:id/subscriptions", controller.GetOrganizationSubscriptions)
+				organizationUserRoute.GET("/:id/projects", controller.GetOrganizationProjects)
+				organizationUserRoute.POST("/:id/projects", controller.CreateOrganizationProject)
+				organizationUserRoute.PUT("/:id/projects/:project_id", controller.UpdateOrganizationProject)
+				organizationUserRoute.GET("/:id/logs", controller.GetOrganizationLogs)
+				organizationUserRoute.GET("/:id/stat", controller.GetOrganizationStat)
+			}
+		}
+
 		ticketRoute := apiRouter.Group("/ticket")
 		{
 			ticketUserRoute := ticketRoute.Group("/")
@@ -388,13 +521,12 @@ func SetApiRouter(router *gin.Engine) {
 				ticketUserRoute.POST("/:id/messages", controller.AddTicketMessage)
 			}
 			ticketAdminRoute := ticketRoute.Group("/")
-			ticketAdminRoute.Use(middleware.AdminAuth())
 			{
-				ticketAdminRoute.GET("/", controller.GetAllTickets)
-				ticketAdminRoute.GET("/search", controller.SearchTickets)
-				ticketAdminRoute.PUT("/", controller.UpdateTicket)
-				ticketAdminRoute.DELETE("/:id", controller.DeleteTicket)
-				ticketAdminRoute.POST("/admin/:id/messages", controller.AdminAddTicketMessage)
+				ticketAdminRoute.GET("/", middleware.PermissionAuth(constant.PermissionTicketsRead), controller.GetAllTickets)
+				ticketAdminRoute.GET("/search", middleware.PermissionAuth(constant.PermissionTicketsRead), controller.SearchTickets)
+				ticketAdminRoute.PUT("/", middleware.PermissionAuth(constant.PermissionTicketsManage), controller.UpdateTicket)
+				ticketAdminRoute.DELETE("/:id", middleware.PermissionAuth(constant.PermissionTicketsManage), controller.DeleteTicket)
+				ticketAdminRoute.POST("/admin/:id/messages", middleware.PermissionAuth(constant.PermissionTicketsReply), controller.AdminAddTicketMessage)
 			}
 		}
 	}
@@ -56,6 +56,14 @@ func SetRelayRouter(router *gin.Engine) {
 		})
 	}
 
+	// 派生令牌签发与吊销，使用父令牌认证
+	derivedTokenRouter := router.Group("/v1/tokens/derived")
+	derivedTokenRouter.Use(middleware.CriticalRateLimit(), middleware.TokenAuth())
+	{
+		derivedTokenRouter.POST("", controller.CreateDerivedToken)
+		derivedTokenRouter.POST("/revoke", controller.RevokeDerivedTokens)
+	}
+
 	playgroundRouter := router.Group("/pg")
 	playgroundRouter.Use(middleware.SystemPerformanceCheck())
 	playgroundRouter.Use(middleware.UserAuth(), middleware.Distribute())
@@ -0,0 +1,33 @@
+package router
+
+import (
+	"github.com/Zer0Echo/uniapi/controller"
+	"github.com/Zer0Echo/uniapi/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetScimRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.BodyStorageCleanup())
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.ScimAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", controller.ScimServiceProviderConfig)
+		scimRouter.GET("/ResourceTypes", controller.ScimResourceTypes)
+
+		scimRouter.GET("/Users", controller.ScimListUsers)
+		scimRouter.POST("/Users", controller.ScimCreateUser)
+		scimRouter.GET("/Users/:id", controller.ScimGetUser)
+		scimRouter.PUT("/Users/:id", controller.ScimReplaceUser)
+		scimRouter.PATCH("/Users/:id", controller.ScimPatchUser)
+		scimRouter.DELETE("/Users/:id", controller.ScimDeleteUser)
+
+		scimRouter.GET("/Groups", controller.ScimListGroups)
+		scimRouter.POST("/Groups", controller.ScimCreateGroup)
+		scimRouter.GET("/Groups/:id", controller.ScimGetGroup)
+		scimRouter.PUT("/Groups/:id", controller.ScimReplaceGroup)
+		scimRouter.PATCH("/Groups/:id", controller.ScimPatchGroup)
+		scimRouter.DELETE("/Groups/:id", controller.ScimDeleteGroup)
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/model"
+)
+
+var auditLogExportHeader = []string{
+	"id", "created_at", "user_id", "username", "ip", "action", "target_type", "target_id",
+	"status_code", "success", "message", "before", "after", "diff",
+}
+
+func auditLogCSVRecord(log *model.AuditLog) []string {
+	return []string{
+		strconv.Itoa(log.Id), time.Unix(log.CreatedAt, 0).Format(time.RFC3339), strconv.Itoa(log.UserId), log.Username,
+		log.Ip, log.Action, log.TargetType, log.TargetId,
+		strconv.Itoa(log.StatusCode), strconv.FormatBool(log.Success), log.Message, log.Before, log.After, log.Diff,
+	}
+}
+
+// WriteAuditLogExport 按筛选条件将审计日志逐批写入 w，格式与消费日志导出一致（csv 或 jsonl）。返回导出的行数
+func WriteAuditLogExport(w io.Writer, format string, filter model.AuditLogFilter, flush func()) (int, error) {
+	if !IsValidLogExportFormat(format) {
+		return 0, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+	rows := 0
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == LogExportFormatCSV {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(auditLogExportHeader); err != nil {
+			return 0, err
+		}
+	} else {
+		encoder = json.NewEncoder(w)
+	}
+	err := model.StreamAuditLogs(filter, func(logs []*model.AuditLog) error {
+		for _, log := range logs {
+			if csvWriter != nil {
+				if err := csvWriter.Write(auditLogCSVRecord(log)); err != nil {
+					return err
+				}
+			} else if err := encoder.Encode(log); err != nil {
+				return err
+			}
+			rows++
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if flush != nil {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return rows, csvWriter.Error()
+	}
+	return rows, nil
+}
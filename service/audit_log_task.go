@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const auditLogCleanupInterval = 6 * time.Hour
+
+var auditLogCleanupOnce sync.Once
+
+// StartAuditLogCleanupTask 按审计日志保留天数定期清理过期记录，与消费日志的清理相互独立
+func StartAuditLogCleanupTask() {
+	auditLogCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("audit log cleanup task started: tick=%s", auditLogCleanupInterval))
+			ticker := time.NewTicker(auditLogCleanupInterval)
+			defer ticker.Stop()
+
+			runAuditLogCleanupOnce()
+			for range ticker.C {
+				runAuditLogCleanupOnce()
+			}
+		})
+	})
+}
+
+func runAuditLogCleanupOnce() {
+	retentionDays := system_setting.GetAuditLogSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	ctx := context.Background()
+	cutoff := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	deleted, err := model.DeleteAuditLogsBefore(cutoff)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("audit log cleanup failed: err=%v", err))
+		return
+	}
+	if deleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("audit log cleanup finished: deleted=%d", deleted))
+	}
+}
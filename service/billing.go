@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
 	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
 	"github.com/Zer0Echo/uniapi/types"
 	"github.com/gin-gonic/gin"
@@ -12,6 +13,7 @@ import (
 const (
 	BillingSourceWallet       = "wallet"
 	BillingSourceSubscription = "subscription"
+	BillingSourceOrganization = "organization"
 )
 
 // PreConsumeBilling 根据用户计费偏好创建 BillingSession 并执行预扣费。
@@ -25,6 +27,28 @@ func PreConsumeBilling(c *gin.Context, preConsumedQuota int, relayInfo *relaycom
 	return nil
 }
 
+// GetPayerQuota 返回本次请求付款方的剩余额度：项目令牌为组织余额，否则为用户余额。
+func GetPayerQuota(relayInfo *relaycommon.RelayInfo) (int, error) {
+	if relayInfo.OrgId != 0 {
+		org, err := model.GetOrganizationById(relayInfo.OrgId)
+		if err != nil {
+			return 0, err
+		}
+		// 项目令牌可用的额度同时受项目剩余预算限制
+		if relayInfo.ProjectId != 0 {
+			project, err := model.GetProjectById(relayInfo.ProjectId)
+			if err != nil {
+				return 0, err
+			}
+			if remain := project.RemainBudget(); remain >= 0 {
+				return min(org.Quota, remain), nil
+			}
+		}
+		return org.Quota, nil
+	}
+	return model.GetUserQuota(relayInfo.UserId, false)
+}
+
 // ---------------------------------------------------------------------------
 // SettleBilling — 后结算辅助函数
 // ---------------------------------------------------------------------------
@@ -58,8 +82,8 @@ func SettleBilling(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, actualQuo
 			return err
 		}
 
-		// 发送额度通知（订阅计费使用订阅剩余额度）
-		if actualQuota != 0 {
+		// 发送额度通知（订阅计费使用订阅剩余额度，组织钱包不发送个人额度通知）
+		if actualQuota != 0 && relayInfo.OrgId == 0 {
 			if relayInfo.BillingSource == BillingSourceSubscription {
 				checkAndSendSubscriptionQuotaNotify(relayInfo)
 			} else {
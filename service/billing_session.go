@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -43,7 +44,13 @@ func (s *BillingSession) Settle(actualQuota int) error {
 		return nil
 	}
 	delta := actualQuota - s.preConsumedQuota
-	if delta == 0 {
+	// 按 token 计量的模型额度需要用实际 token 数结算，即使额度差为 0
+	meteredByTokens := false
+	if sub, ok := s.funding.(*SubscriptionFunding); ok && sub.meteredByTokens() {
+		sub.actualTokens = int64(s.relayInfo.UsageTotalTokens)
+		meteredByTokens = true
+	}
+	if delta == 0 && !meteredByTokens {
 		s.settled = true
 		return nil
 	}
@@ -56,7 +63,7 @@ func (s *BillingSession) Settle(actualQuota int) error {
 	}
 	// 2) 调整令牌额度
 	var tokenErr error
-	if !s.relayInfo.IsPlayground {
+	if !s.relayInfo.IsPlayground && delta != 0 {
 		if delta > 0 {
 			tokenErr = model.DecreaseTokenQuota(s.relayInfo.TokenId, s.relayInfo.TokenKey, delta)
 		} else {
@@ -69,8 +76,12 @@ func (s *BillingSession) Settle(actualQuota int) error {
 		}
 	}
 	// 3) 更新 relayInfo 上的订阅 PostDelta（用于日志）
-	if s.funding.Source() == BillingSourceSubscription {
-		s.relayInfo.SubscriptionPostDelta += int64(delta)
+	if sub, ok := s.funding.(*SubscriptionFunding); ok {
+		if sub.AllowanceModel == "" {
+			s.relayInfo.SubscriptionPostDelta += int64(delta)
+		} else if meteredByTokens {
+			s.relayInfo.SubscriptionAllowanceConsumed = sub.actualTokens
+		}
 	}
 	s.settled = true
 	return tokenErr
@@ -129,7 +140,7 @@ func (s *BillingSession) needsRefundLocked() bool {
 		return true
 	}
 	// 订阅可能在 tokenConsumed=0 时仍预扣了额度
-	if sub, ok := s.funding.(*SubscriptionFunding); ok && sub.preConsumed > 0 {
+	if sub, ok := s.funding.(*SubscriptionFunding); ok && (sub.preConsumed > 0 || sub.AllowanceConsumed > 0) {
 		return true
 	}
 	return false
@@ -175,6 +186,13 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 			}
 			s.tokenConsumed = 0
 		}
+		if errors.Is(err, model.ErrProjectBudgetExceeded) {
+			return types.NewErrorWithStatusCode(fmt.Errorf("项目预算不足, 需要预扣费额度: %s", logger.FormatQuota(effectiveQuota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		// 模型额度用尽且不允许回退钱包，使用独立错误码避免触发钱包回退
+		if errors.Is(err, model.ErrSubscriptionAllowanceExhausted) {
+			return types.NewErrorWithStatusCode(fmt.Errorf("订阅套餐中该模型的额度已用尽: %s", err.Error()), types.ErrorCodeSubscriptionAllowanceExhausted, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "no active subscription") || strings.Contains(errMsg, "subscription quota insufficient") {
@@ -236,6 +254,9 @@ func (s *BillingSession) syncRelayInfo() {
 		info.SubscriptionAmountUsedAfterPreConsume = sub.AmountUsedAfter
 		info.SubscriptionPlanId = sub.PlanId
 		info.SubscriptionPlanTitle = sub.PlanTitle
+		info.SubscriptionAllowanceModel = sub.AllowanceModel
+		info.SubscriptionAllowanceMetric = sub.AllowanceMetric
+		info.SubscriptionAllowanceConsumed = sub.AllowanceConsumed
 	} else {
 		info.SubscriptionId = 0
 		info.SubscriptionPreConsumed = 0
@@ -252,6 +273,11 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return nil, types.NewError(fmt.Errorf("relayInfo is nil"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	// 项目令牌始终从组织钱包扣费，不走个人钱包与订阅
+	if relayInfo.OrgId != 0 {
+		return newOrganizationBillingSession(c, relayInfo, preConsumedQuota)
+	}
+
 	pref := common.NormalizeBillingPreference(relayInfo.UserSetting.BillingPreference)
 
 	// 钱包路径需要先检查用户额度
@@ -276,7 +302,7 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 
 		session := &BillingSession{
 			relayInfo: relayInfo,
-			funding:   &WalletFunding{userId: relayInfo.UserId},
+			funding:   &WalletFunding{requestId: relayInfo.RequestId, userId: relayInfo.UserId},
 		}
 		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
 			return nil, apiErr
@@ -292,10 +318,11 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		session := &BillingSession{
 			relayInfo: relayInfo,
 			funding: &SubscriptionFunding{
-				requestId: relayInfo.RequestId,
-				userId:    relayInfo.UserId,
-				modelName: relayInfo.OriginModelName,
-				amount:    subConsume,
+				requestId:       relayInfo.RequestId,
+				userId:          relayInfo.UserId,
+				modelName:       relayInfo.OriginModelName,
+				amount:          subConsume,
+				estimatedTokens: int64(relayInfo.GetEstimatePromptTokens()),
 			},
 		}
 		// 必须传 subConsume 而非 preConsumedQuota，保证 SubscriptionFunding.amount、
@@ -340,3 +367,90 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return session, nil
 	}
 }
+
+// newOrganizationBillingSession 组织持有有效订阅时优先使用订阅，订阅额度不足再回退组织钱包
+func newOrganizationBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preConsumedQuota int) (*BillingSession, *types.NewAPIError) {
+	hasSub, err := model.HasActiveOrganizationSubscription(relayInfo.OrgId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if hasSub {
+		session, apiErr := newOrganizationSubscriptionSession(c, relayInfo, preConsumedQuota)
+		if apiErr == nil || apiErr.GetErrorCode() != types.ErrorCodeInsufficientUserQuota {
+			return session, apiErr
+		}
+	}
+	if apiErr := checkOrganizationQuota(relayInfo, preConsumedQuota); apiErr != nil {
+		return nil, apiErr
+	}
+	session := &BillingSession{
+		relayInfo: relayInfo,
+		funding:   &OrganizationFunding{requestId: relayInfo.RequestId, orgId: relayInfo.OrgId, projectId: relayInfo.ProjectId},
+	}
+	if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+		return nil, apiErr
+	}
+	return session, nil
+}
+
+func newOrganizationSubscriptionSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preConsumedQuota int) (*BillingSession, *types.NewAPIError) {
+	subConsume := int64(preConsumedQuota)
+	if subConsume <= 0 {
+		subConsume = 1
+	}
+	if apiErr := checkProjectBudget(relayInfo, int(subConsume)); apiErr != nil {
+		return nil, apiErr
+	}
+	session := &BillingSession{
+		relayInfo: relayInfo,
+		funding: &SubscriptionFunding{
+			requestId:       relayInfo.RequestId,
+			userId:          relayInfo.UserId,
+			orgId:           relayInfo.OrgId,
+			projectId:       relayInfo.ProjectId,
+			modelName:       relayInfo.OriginModelName,
+			amount:          subConsume,
+			estimatedTokens: int64(relayInfo.GetEstimatePromptTokens()),
+		},
+	}
+	if apiErr := session.preConsume(c, int(subConsume)); apiErr != nil {
+		return nil, apiErr
+	}
+	return session, nil
+}
+
+// checkOrganizationQuota 检查组织余额与项目预算是否足以支付 quota
+func checkOrganizationQuota(relayInfo *relaycommon.RelayInfo, quota int) *types.NewAPIError {
+	org, err := model.GetOrganizationById(relayInfo.OrgId)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if org.Quota <= 0 || org.Quota-quota < 0 {
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("组织余额不足, 剩余额度: %s, 需要预扣费额度: %s", logger.FormatQuota(org.Quota), logger.FormatQuota(quota)),
+			types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+			types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+	}
+	if apiErr := checkProjectBudget(relayInfo, quota); apiErr != nil {
+		return apiErr
+	}
+	relayInfo.UserQuota = org.Quota
+	return nil
+}
+
+// checkProjectBudget 检查项目剩余预算是否足以支付 quota
+func checkProjectBudget(relayInfo *relaycommon.RelayInfo, quota int) *types.NewAPIError {
+	if relayInfo.ProjectId != 0 {
+		project, err := model.GetProjectById(relayInfo.ProjectId)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+		}
+		if remain := project.RemainBudget(); remain >= 0 && remain < max(quota, 1) {
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("项目预算不足, 剩余预算: %s, 需要预扣费额度: %s", logger.FormatQuota(remain), logger.FormatQuota(quota)),
+				types.ErrorCodeInsufficientUserQuota, http.StatusForbidden,
+				types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/types"
+)
+
+// channelBalanceForecastDays 估算消耗速度使用的余额历史天数
+const channelBalanceForecastDays = 7
+
+// GetChannelBalanceForecast 按最近的余额历史估算渠道的消耗速度与耗尽时间
+func GetChannelBalanceForecast(channelId int) model.ChannelBalanceForecast {
+	startTime := time.Now().AddDate(0, 0, -channelBalanceForecastDays).Unix()
+	history, err := model.GetChannelBalanceHistory(channelId, startTime)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get channel balance history: channel_id=%d, error=%v", channelId, err))
+		return model.ChannelBalanceForecast{}
+	}
+	return model.ForecastChannelBalance(history)
+}
+
+// CheckChannelBalance 余额低于禁用阈值（默认为 0）时自动禁用渠道，低于告警阈值时通知管理员
+func CheckChannelBalance(channel *model.Channel, balance float64) {
+	var setting dto.ChannelBalanceSettings
+	if s := channel.GetOtherSettings().Balance; s != nil {
+		setting = *s
+	}
+	if balance <= setting.DisableThreshold {
+		DisableChannel(*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, "", channel.GetAutoBan()), "余额不足")
+		return
+	}
+	if setting.AlertThreshold <= 0 || balance > setting.AlertThreshold {
+		return
+	}
+	subject := fmt.Sprintf("通道「%s」（#%d）余额不足", channel.Name, channel.Id)
+	content := fmt.Sprintf("通道「%s」（#%d）当前余额 $%.2f，低于告警阈值 $%.2f", channel.Name, channel.Id, balance, setting.AlertThreshold)
+	forecast := GetChannelBalanceForecast(channel.Id)
+	if forecast.BurnRate > 0 {
+		content += fmt.Sprintf("，近期平均每天消耗 $%.2f", forecast.BurnRate)
+	}
+	if forecast.ExhaustTime > 0 {
+		content += fmt.Sprintf("，预计 %s 耗尽", time.Unix(forecast.ExhaustTime, 0).Format("2006-01-02 15:04"))
+	}
+	NotifyRootUser(fmt.Sprintf("%s_%d", dto.NotifyTypeChannelBalance, channel.Id), subject, content)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/model"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+)
+
+// RecordChannelKeyConsume 多 Key 渠道记录本次请求所用 Key 消耗的 token 与额度，用于限额与最少使用模式
+func RecordChannelKeyConsume(relayInfo *relaycommon.RelayInfo, tokens int, quota int) {
+	if relayInfo.ChannelMeta == nil || !relayInfo.ChannelIsMultiKey {
+		return
+	}
+	model.RecordChannelKeyConsume(relayInfo.ChannelId, relayInfo.ApiKey, tokens, quota)
+}
+
+// CoolDownRateLimitedChannelKey 多 Key 渠道的上游返回 429 时暂停使用该 Key，优先使用上游的 Retry-After
+func CoolDownRateLimitedChannelKey(relayInfo *relaycommon.RelayInfo, resp *http.Response) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	if relayInfo.ChannelMeta == nil || !relayInfo.ChannelIsMultiKey {
+		return
+	}
+	model.CoolDownChannelKey(relayInfo.ChannelId, relayInfo.ApiKey, parseRetryAfter(resp.Header.Get("Retry-After")))
+}
+
+// parseRetryAfter 支持秒数与 HTTP 日期两种格式，无法解析时返回 0
+func parseRetryAfter(value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(seconds, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(int(time.Until(t).Seconds())+1, 0)
+	}
+	return 0
+}
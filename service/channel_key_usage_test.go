@@ -0,0 +1,34 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 0},
+		{value: "30", want: 30},
+		{value: " 5 ", want: 5},
+		{value: "0", want: 0},
+		{value: "-3", want: 0},
+		{value: "soon", want: 0},
+		{value: "1.5", want: 0},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), want: 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+
+	// HTTP 日期按剩余秒数向上取整
+	date := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 119 || got > 121 {
+		t.Fatalf("parseRetryAfter(%q) = %d, want about 120", date, got)
+	}
+}
@@ -88,7 +88,11 @@ func runCodexCredentialAutoRefreshOnce() {
 				continue
 			}
 
-			rawKey := strings.TrimSpace(ch.Key)
+			plainKey, err := ch.GetPlainKey()
+			if err != nil {
+				continue
+			}
+			rawKey := strings.TrimSpace(plainKey)
 			if rawKey == "" {
 				continue
 			}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/anknown/ahocorasick"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContentFilterActionTruncate = "truncate"
+	ContentFilterActionReplace  = "replace"
+
+	contentFilterMask = "**###**"
+)
+
+// ContentFilterResult 输出内容过滤结果，记录在消费日志的 other.content_filter 中
+type ContentFilterResult struct {
+	Action    string   `json:"action"`
+	Words     []string `json:"words"`
+	Truncated bool     `json:"truncated"`
+}
+
+// ApplyContentFilter 开启输出检查时包装响应写入器，检测上游返回的文本中的敏感词。
+// StopOnSensitiveEnabled 开启时截断输出并返回 content_filter 结束原因，否则替换敏感词；
+// 截断后仍会读完上游响应，按实际生成的 token 计费
+func ApplyContentFilter(c *gin.Context, info *relaycommon.RelayInfo) {
+	if !setting.ShouldCheckCompletionSensitive() {
+		return
+	}
+	switch info.RelayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatClaude, types.RelayFormatGemini, types.RelayFormatOpenAIResponses:
+	default:
+		return
+	}
+	filter := newContentFilter(setting.SensitiveWords, setting.StopOnSensitiveEnabled)
+	if filter == nil {
+		return
+	}
+	w := newContentFilterWriter(c.Writer, filter, info.RelayFormat)
+	c.Writer = w
+	common.SetContextKey(c, constant.ContextKeyContentFilter, w)
+}
+
+// FlushContentFilter 输出流式响应中为跨分片检测而暂存的文本
+func FlushContentFilter(c *gin.Context) {
+	if w, ok := common.GetContextKeyType[*contentFilterWriter](c, constant.ContextKeyContentFilter); ok && w != nil {
+		_ = w.flushHeld()
+	}
+}
+
+func getContentFilterResult(c *gin.Context) *ContentFilterResult {
+	if w, ok := common.GetContextKeyType[*contentFilterWriter](c, constant.ContextKeyContentFilter); ok && w != nil {
+		if len(w.filter.result.Words) > 0 {
+			return &w.filter.result
+		}
+	}
+	return nil
+}
+
+// contentFilter 按字段检测文本，流式响应中每个字段保留最长敏感词长度减一的尾部，与下一分片拼接后再检测
+type contentFilter struct {
+	machine  *goahocorasick.Machine
+	truncate bool
+	window   int
+	held     map[string]string
+	result   ContentFilterResult
+}
+
+func newContentFilter(words []string, truncate bool) *contentFilter {
+	machine := getOrBuildAC(words)
+	if machine == nil {
+		return nil
+	}
+	window := 0
+	for _, word := range words {
+		window = max(window, len([]rune(word))-1)
+	}
+	action := ContentFilterActionReplace
+	if truncate {
+		action = ContentFilterActionTruncate
+	}
+	return &contentFilter{
+		machine:  machine,
+		truncate: truncate,
+		window:   window,
+		held:     make(map[string]string),
+		result:   ContentFilterResult{Action: action, Words: []string{}},
+	}
+}
+
+// feed 检测字段 key 的增量文本，返回可以输出的部分；final 为 true 时不再保留尾部
+func (f *contentFilter) feed(key, text string, final bool) (string, bool) {
+	out, held, hit := f.scan(f.held[key]+text, !final)
+	if held == "" {
+		delete(f.held, key)
+	} else {
+		f.held[key] = held
+	}
+	return out, hit
+}
+
+// scan 替换或截断敏感词，hold 为 true 时返回尚不能确定的尾部
+func (f *contentFilter) scan(text string, hold bool) (out string, held string, hit bool) {
+	if text == "" {
+		return "", "", false
+	}
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	hits := f.machine.MultiPatternSearch(lower, false)
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Pos < hits[j].Pos })
+	var builder strings.Builder
+	last := 0
+	for _, term := range hits {
+		if term.Pos < last {
+			continue
+		}
+		f.record(string(term.Word))
+		builder.WriteString(string(runes[last:term.Pos]))
+		if f.truncate {
+			f.result.Truncated = true
+			return builder.String(), "", true
+		}
+		builder.WriteString(contentFilterMask)
+		last = term.Pos + len(term.Word)
+		hit = true
+	}
+	end := len(runes)
+	if hold {
+		end = max(last, len(runes)-f.window)
+	}
+	builder.WriteString(string(runes[last:end]))
+	return builder.String(), string(runes[end:]), hit
+}
+
+func (f *contentFilter) record(word string) {
+	for _, w := range f.result.Words {
+		if w == word {
+			return
+		}
+	}
+	f.result.Words = append(f.result.Words, word)
+}
+
+// contentFilterPaths 各格式响应中需要检测的文本字段，* 匹配数组下标
+func contentFilterPaths(format types.RelayFormat, stream bool) [][]string {
+	var paths []string
+	switch format {
+	case types.RelayFormatOpenAI:
+		if stream {
+			paths = []string{"choices.*.delta.content", "choices.*.delta.reasoning_content", "choices.*.text"}
+		} else {
+			paths = []string{"choices.*.message.content", "choices.*.message.reasoning_content", "choices.*.text"}
+		}
+	case types.RelayFormatClaude:
+		if stream {
+			paths = []string{"delta.text", "delta.thinking"}
+		} else {
+			paths = []string{"content.*.text", "content.*.thinking"}
+		}
+	case types.RelayFormatGemini:
+		paths = []string{"candidates.*.content.parts.*.text"}
+	case types.RelayFormatOpenAIResponses:
+		if stream {
+			paths = []string{"delta"}
+		} else {
+			paths = []string{"output.*.content.*.text"}
+		}
+	}
+	result := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		result = append(result, strings.Split(path, "."))
+	}
+	return result
+}
+
+// walkContentFilterText 遍历匹配 path 的字符串字段，fn 返回替换后的文本；key 为字段的完整路径
+func walkContentFilterText(value any, path []string, key string, fn func(key, text string) string) {
+	if len(path) == 0 {
+		return
+	}
+	last := len(path) == 1
+	switch v := value.(type) {
+	case map[string]any:
+		if path[0] == "*" {
+			return
+		}
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		childKey := joinContentFilterKey(key, path[0])
+		if last {
+			if text, ok := child.(string); ok {
+				v[path[0]] = fn(childKey, text)
+			}
+			return
+		}
+		walkContentFilterText(child, path[1:], childKey, fn)
+	case []any:
+		if path[0] != "*" {
+			return
+		}
+		for i, item := range v {
+			childKey := joinContentFilterKey(key, strconv.Itoa(i))
+			if last {
+				if text, ok := item.(string); ok {
+					v[i] = fn(childKey, text)
+				}
+				continue
+			}
+			walkContentFilterText(item, path[1:], childKey, fn)
+		}
+	}
+}
+
+func joinContentFilterKey(key, segment string) string {
+	if key == "" {
+		return segment
+	}
+	return key + "." + segment
+}
+
+// contentFilterIndex 返回字段路径 key 中第 n 个数组下标
+func contentFilterIndex(key string, n int) int {
+	for _, segment := range strings.Split(key, ".") {
+		if index, err := strconv.Atoi(segment); err == nil {
+			if n == 0 {
+				return index
+			}
+			n--
+		}
+	}
+	return -1
+}
+
+func contentFilterMap(value any, keys ...string) map[string]any {
+	for _, key := range keys {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	m, _ := value.(map[string]any)
+	return m
+}
+
+func contentFilterSlice(value any, key string) []any {
+	if m, ok := value.(map[string]any); ok {
+		s, _ := m[key].([]any)
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testContentFilterWords = []string{"badword", "敏感词", "Secret Plan"}
+
+// splitRunes 按字符下标将文本切分为多个分片
+func splitRunes(text string, cuts ...int) []string {
+	runes := []rune(text)
+	chunks := make([]string, 0, len(cuts)+1)
+	last := 0
+	for _, cut := range cuts {
+		chunks = append(chunks, string(runes[last:cut]))
+		last = cut
+	}
+	return append(chunks, string(runes[last:]))
+}
+
+func TestContentFilterFeedSlidingWindow(t *testing.T) {
+	texts := []string{
+		"this is a badword in the middle",
+		"BADWORD at start and badword twice",
+		"中文里的敏感词也要处理",
+		"the secret plan is badword",
+		"nothing to see here",
+		"bad",
+	}
+	for _, truncate := range []bool{false, true} {
+		for _, text := range texts {
+			want, _, wantHit := newContentFilter(testContentFilterWords, truncate).scan(text, false)
+			n := len([]rune(text))
+			// 在任意位置拆成两段或三段，拼接后的输出与整体检测一致
+			for i := 0; i <= n; i++ {
+				for j := i; j <= n; j += 3 {
+					filter := newContentFilter(testContentFilterWords, truncate)
+					chunks := splitRunes(text, i, j)
+					var got strings.Builder
+					hit := false
+					for k, chunk := range chunks {
+						out, chunkHit := filter.feed("choices.0.delta.content", chunk, k == len(chunks)-1)
+						got.WriteString(out)
+						if chunkHit {
+							hit = true
+							if truncate {
+								break
+							}
+						}
+					}
+					if got.String() != want || hit != wantHit {
+						t.Fatalf("truncate=%v chunks %q: got %q, %v, want %q, %v", truncate, chunks, got.String(), hit, want, wantHit)
+					}
+					if !truncate && len(filter.held) != 0 {
+						t.Fatalf("expected nothing held after final chunk, got %v", filter.held)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestContentFilterScan(t *testing.T) {
+	filter := newContentFilter(testContentFilterWords, false)
+	if filter.window != 10 {
+		t.Fatalf("window = %d, want longest word length minus one", filter.window)
+	}
+	out, held, hit := filter.scan("The SECRET PLAN uses a BadWord", false)
+	if out != "The **###** uses a **###**" || held != "" || !hit {
+		t.Fatalf("scan = %q, %q, %v", out, held, hit)
+	}
+	// 保留窗口长度的尾部，但不会保留已替换的部分
+	out, held, _ = filter.scan("say badword", true)
+	if out != "say **###**" || held != "" {
+		t.Fatalf("scan with hold = %q, %q", out, held)
+	}
+	out, held, _ = filter.scan("hello world, this is long", true)
+	if out != "hello world, th" || held != "is is long" {
+		t.Fatalf("scan with hold = %q, %q", out, held)
+	}
+	if filter.result.Action != ContentFilterActionReplace || strings.Join(filter.result.Words, ",") != "secret plan,badword" || filter.result.Truncated {
+		t.Fatalf("unexpected result %+v", filter.result)
+	}
+
+	truncating := newContentFilter(testContentFilterWords, true)
+	if out, _, hit = truncating.scan("keep this badword drop this badword", false); out != "keep this " || !hit || !truncating.result.Truncated {
+		t.Fatalf("truncate scan = %q, %v, %+v", out, hit, truncating.result)
+	}
+	if newContentFilter(nil, true) != nil || newContentFilter([]string{" "}, true) != nil {
+		t.Fatal("expected no filter without words")
+	}
+}
+
+type contentFilterTestEvent struct {
+	name string
+	data string
+}
+
+func newContentFilterTestWriter(t *testing.T, format types.RelayFormat, truncate bool, contentType string, status int) (*contentFilterWriter, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	w := newContentFilterWriter(c.Writer, newContentFilter(testContentFilterWords, truncate), format)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	return w, recorder
+}
+
+// writeContentFilterStream 按给定分片写入，返回解析后的 SSE 事件
+func writeContentFilterStream(t *testing.T, w *contentFilterWriter, recorder *httptest.ResponseRecorder, chunks ...string) []contentFilterTestEvent {
+	t.Helper()
+	for _, chunk := range chunks {
+		if n, err := w.WriteString(chunk); err != nil || n != len(chunk) {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	var events []contentFilterTestEvent
+	for _, raw := range strings.Split(recorder.Body.String(), "\n\n") {
+		// 跳过注释与心跳
+		if name, data, ok := parseContentFilterEvent([]byte(raw)); ok {
+			events = append(events, contentFilterTestEvent{name: name, data: data})
+		}
+	}
+	return events
+}
+
+// contentFilterTestText 拼接各事件中 path 字段的文本
+func contentFilterTestText(t *testing.T, format types.RelayFormat, events []contentFilterTestEvent) string {
+	t.Helper()
+	var text strings.Builder
+	for _, event := range events {
+		body, ok := decodeContentFilterJSON([]byte(event.data))
+		if !ok {
+			continue
+		}
+		for _, path := range contentFilterPaths(format, true) {
+			walkContentFilterText(body, path, "", func(_, s string) string {
+				text.WriteString(s)
+				return s
+			})
+		}
+	}
+	return text.String()
+}
+
+func openAIStreamChunk(content string) string {
+	return `data: {"id":"c1","choices":[{"index":0,"delta":{"content":"` + content + `"}}]}` + "\n\n"
+}
+
+func TestContentFilterWriterOpenAIStreamReplace(t *testing.T) {
+	w, recorder := newContentFilterTestWriter(t, types.RelayFormatOpenAI, false, "text/event-stream", http.StatusOK)
+	events := writeContentFilterStream(t, w, recorder,
+		openAIStreamChunk("This is a ba"),
+		// 事件跨多次写入
+		openAIStreamChunk("dword, ok")[:20], openAIStreamChunk("dword, ok")[20:],
+		": keep-alive\n\n",
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n",
+		"data: [DONE]\n\n",
+	)
+	if got := contentFilterTestText(t, types.RelayFormatOpenAI, events); got != "This is a **###**, ok" {
+		t.Fatalf("streamed text = %q", got)
+	}
+	if !strings.Contains(recorder.Body.String(), ": keep-alive\n\n") {
+		t.Fatal("expected comments to be passed through")
+	}
+	last := events[len(events)-2]
+	if !strings.Contains(last.data, `"finish_reason":"stop"`) || events[len(events)-1].data != "[DONE]" {
+		t.Fatalf("unexpected trailing events %+v", events[len(events)-2:])
+	}
+	if strings.Join(w.filter.result.Words, ",") != "badword" || w.filter.result.Truncated {
+		t.Fatalf("unexpected result %+v", w.filter.result)
+	}
+}
+
+func TestContentFilterWriterOpenAIStreamFlush(t *testing.T) {
+	w, recorder := newContentFilterTestWriter(t, types.RelayFormatOpenAI, false, "text/event-stream", http.StatusOK)
+	writeContentFilterStream(t, w, recorder, openAIStreamChunk("a short"))
+	if recorder.Body.Len() != 0 {
+		t.Fatalf("expected text within the window to be held, got %q", recorder.Body.String())
+	}
+	// 上游未发送结束标记时由 FlushContentFilter 输出暂存的文本
+	if err := w.flushHeld(); err != nil {
+		t.Fatalf("flushHeld: %v", err)
+	}
+	events := writeContentFilterStream(t, w, recorder)
+	if got := contentFilterTestText(t, types.RelayFormatOpenAI, events); got != "a short" {
+		t.Fatalf("flushed text = %q", got)
+	}
+}
+
+func TestContentFilterWriterOpenAIStreamTruncate(t *testing.T) {
+	w, recorder := newContentFilterTestWriter(t, types.RelayFormatOpenAI, true, "text/event-stream", http.StatusOK)
+	events := writeContentFilterStream(t, w, recorder,
+		openAIStreamChunk("Hello there bad"),
+		openAIStreamChunk("word and more"),
+		openAIStreamChunk(" even more text"),
+		`data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n",
+		`data: {"id":"c1","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":9,"total_tokens":12}}`+"\n\n",
+		"data: [DONE]\n\n",
+	)
+	if got := contentFilterTestText(t, types.RelayFormatOpenAI, events); got != "Hello there " {
+		t.Fatalf("streamed text = %q", got)
+	}
+	var finishReasons []string
+	for _, event := range events {
+		if strings.Contains(event.data, "finish_reason") {
+			finishReasons = append(finishReasons, event.data)
+		}
+	}
+	if len(finishReasons) != 1 || !strings.Contains(finishReasons[0], `"finish_reason":"content_filter"`) {
+		t.Fatalf("expected a single content_filter finish reason, got %v", finishReasons)
+	}
+	// 截断后仍保留用量与结束标记
+	if n := len(events); n < 2 || !strings.Contains(events[n-2].data, `"usage"`) || events[n-1].data != "[DONE]" {
+		t.Fatalf("expected usage and [DONE] to be kept, got %+v", events)
+	}
+	if !w.filter.result.Truncated {
+		t.Fatal("expected result to be marked as truncated")
+	}
+}
+
+func TestContentFilterWriterClaudeStreamTruncate(t *testing.T) {
+	w, recorder := newContentFilterTestWriter(t, types.RelayFormatClaude, true, "text/event-stream", http.StatusOK)
+	delta := func(text string) string {
+		return "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"" + text + "\"}}\n\n"
+	}
+	events := writeContentFilterStream(t, w, recorder,
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"m1\"}}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n",
+		delta("The 敏感"),
+		delta("词 and the rest"),
+		delta(" more"),
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":7}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	)
+	if got := contentFilterTestText(t, types.RelayFormatClaude, events); got != "The " {
+		t.Fatalf("streamed text = %q", got)
+	}
+	var names []string
+	for _, event := range events {
+		names = append(names, event.name)
+	}
+	want := "message_start,content_block_start,content_block_delta,content_block_stop,message_delta,message_stop"
+	if strings.Join(names, ",") != want {
+		t.Fatalf("events = %v, want %s", names, want)
+	}
+	if !strings.Contains(events[4].data, `"stop_reason":"refusal"`) || !strings.Contains(events[4].data, `"output_tokens":7`) {
+		t.Fatalf("unexpected message_delta %s", events[4].data)
+	}
+}
+
+func TestContentFilterWriterBody(t *testing.T) {
+	body := `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"keep BadWord then more"},"finish_reason":"stop"}]}`
+	tests := []struct {
+		name     string
+		format   types.RelayFormat
+		truncate bool
+		status   int
+		body     string
+		want     string
+	}{
+		{
+			name:   "openai replace",
+			format: types.RelayFormatOpenAI,
+			status: http.StatusOK,
+			body:   body,
+			want:   `{"choices":[{"finish_reason":"stop","index":0,"message":{"content":"keep **###** then more","role":"assistant"}}],"id":"c1"}`,
+		},
+		{
+			name:     "openai truncate",
+			format:   types.RelayFormatOpenAI,
+			truncate: true,
+			status:   http.StatusOK,
+			body:     body,
+			want:     `{"choices":[{"finish_reason":"content_filter","index":0,"message":{"content":"keep ","role":"assistant"}}],"id":"c1"}`,
+		},
+		{
+			name:     "claude truncate drops later blocks",
+			format:   types.RelayFormatClaude,
+			truncate: true,
+			status:   http.StatusOK,
+			body:     `{"content":[{"type":"text","text":"a secret plan"},{"type":"text","text":"b"}],"stop_reason":"end_turn"}`,
+			want:     `{"content":[{"text":"a ","type":"text"}],"stop_reason":"refusal"}`,
+		},
+		{
+			name:     "gemini truncate",
+			format:   types.RelayFormatGemini,
+			truncate: true,
+			status:   http.StatusOK,
+			body:     `{"candidates":[{"content":{"parts":[{"text":"ok"},{"text":"x badword"},{"text":"y"}]},"finishReason":"STOP"}]}`,
+			want:     `{"candidates":[{"content":{"parts":[{"text":"ok"},{"text":"x "}]},"finishReason":"SAFETY"}]}`,
+		},
+		{
+			name:   "clean body kept verbatim",
+			format: types.RelayFormatOpenAI,
+			status: http.StatusOK,
+			body:   `{"id":"c1","choices":[{"message":{"content":"fine"}}]}`,
+			want:   `{"id":"c1","choices":[{"message":{"content":"fine"}}]}`,
+		},
+		{
+			name:   "error response not filtered",
+			format: types.RelayFormatOpenAI,
+			status: http.StatusBadRequest,
+			body:   body,
+			want:   body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, recorder := newContentFilterTestWriter(t, tt.format, tt.truncate, "application/json", tt.status)
+			if _, err := w.Write([]byte(tt.body)); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if got := recorder.Body.String(); got != tt.want {
+				t.Fatalf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contentFilterWriter 在响应写回客户端前检测输出文本。
+// 流式响应按 SSE 事件处理，字段暂存的尾部在该字段不再出现时，复制最近一次包含该字段的事件输出；
+// 截断后按客户端格式补充结束事件，丢弃后续内容但保留用量信息
+type contentFilterWriter struct {
+	gin.ResponseWriter
+	filter *contentFilter
+	format types.RelayFormat
+
+	decided   bool
+	skip      bool
+	stream    bool
+	buf       []byte
+	truncated bool
+	templates map[string]contentFilterTemplate // 字段路径 -> 最近一次包含该字段的事件
+}
+
+type contentFilterTemplate struct {
+	name string
+	data []byte
+}
+
+func newContentFilterWriter(w gin.ResponseWriter, filter *contentFilter, format types.RelayFormat) *contentFilterWriter {
+	return &contentFilterWriter{
+		ResponseWriter: w,
+		filter:         filter,
+		format:         format,
+		templates:      make(map[string]contentFilterTemplate),
+	}
+}
+
+func (w *contentFilterWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *contentFilterWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		// 错误响应不检测
+		w.skip = w.Status() != http.StatusOK
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+		if !w.skip {
+			w.Header().Del("Content-Length")
+		}
+	}
+	if w.skip {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.stream {
+		if _, err := w.ResponseWriter.Write(w.filterBody(data)); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	w.buf = append(w.buf, data...)
+	for {
+		idx := bytes.Index(w.buf, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := w.buf[:idx+2]
+		w.buf = w.buf[idx+2:]
+		if err := w.writeEvent(event); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *contentFilterWriter) filterBody(data []byte) []byte {
+	body, ok := decodeContentFilterJSON(data)
+	if !ok {
+		return data
+	}
+	if !w.filterObject(w.format, body) {
+		return data
+	}
+	out, err := encodeContentFilterJSON(body)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// filterObject 检测非流式响应中的完整文本，截断时设置对应格式的结束原因
+func (w *contentFilterWriter) filterObject(format types.RelayFormat, body map[string]any) bool {
+	changed := false
+	var hits []string
+	for _, path := range contentFilterPaths(format, false) {
+		walkContentFilterText(body, path, "", func(key, text string) string {
+			out, _, hit := w.filter.scan(text, false)
+			if hit && w.filter.truncate {
+				hits = append(hits, key)
+			}
+			if out != text {
+				changed = true
+			}
+			return out
+		})
+	}
+	if len(hits) == 0 {
+		return changed
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if a, b := contentFilterIndex(hits[i], 0), contentFilterIndex(hits[j], 0); a != b {
+			return a < b
+		}
+		return contentFilterIndex(hits[i], 1) < contentFilterIndex(hits[j], 1)
+	})
+	switch format {
+	case types.RelayFormatOpenAI:
+		choices := contentFilterSlice(body, "choices")
+		for _, key := range hits {
+			if choice, ok := choices[contentFilterIndex(key, 0)].(map[string]any); ok {
+				choice["finish_reason"] = "content_filter"
+			}
+		}
+	case types.RelayFormatClaude:
+		content := contentFilterSlice(body, "content")
+		body["content"] = content[:contentFilterIndex(hits[0], 0)+1]
+		body["stop_reason"] = "refusal"
+	case types.RelayFormatGemini:
+		candidates := contentFilterSlice(body, "candidates")
+		for _, key := range hits {
+			truncateGeminiCandidate(candidates[contentFilterIndex(key, 0)], contentFilterIndex(key, 1))
+		}
+	case types.RelayFormatOpenAIResponses:
+		output := contentFilterSlice(body, "output")
+		outputIndex, contentIndex := contentFilterIndex(hits[0], 0), contentFilterIndex(hits[0], 1)
+		if item, ok := output[outputIndex].(map[string]any); ok {
+			item["content"] = contentFilterSlice(item, "content")[:contentIndex+1]
+		}
+		body["output"] = output[:outputIndex+1]
+		markResponsesContentFiltered(body)
+	}
+	return true
+}
+
+func truncateGeminiCandidate(candidate any, partIndex int) {
+	m, ok := candidate.(map[string]any)
+	if !ok {
+		return
+	}
+	if content := contentFilterMap(m, "content"); content != nil {
+		if parts := contentFilterSlice(content, "parts"); partIndex >= 0 && partIndex < len(parts) {
+			content["parts"] = parts[:partIndex+1]
+		}
+	}
+	m["finishReason"] = "SAFETY"
+}
+
+func markResponsesContentFiltered(response map[string]any) {
+	response["status"] = "incomplete"
+	response["incomplete_details"] = map[string]any{"reason": "content_filter"}
+}
+
+func (w *contentFilterWriter) writeEvent(raw []byte) error {
+	name, data, ok := parseContentFilterEvent(raw)
+	if !ok {
+		// 注释、心跳等没有数据的事件原样输出
+		_, err := w.ResponseWriter.Write(raw)
+		return err
+	}
+	event, ok := decodeContentFilterJSON([]byte(data))
+	if !ok {
+		// [DONE] 等结束标记前先输出暂存的文本
+		if err := w.flushHeld(); err != nil {
+			return err
+		}
+		_, err := w.ResponseWriter.Write(raw)
+		return err
+	}
+	if w.truncated {
+		return w.writeTruncatedEvent(name, event, raw)
+	}
+
+	eventType, _ := event["type"].(string)
+	paths := contentFilterPaths(w.format, true)
+	if w.format == types.RelayFormatOpenAIResponses && eventType != "response.output_text.delta" {
+		paths = nil
+	}
+	present := make(map[string]bool)
+	for _, path := range paths {
+		walkContentFilterText(event, path, "", func(key, text string) string {
+			present[key] = true
+			return text
+		})
+	}
+	if eventType != "ping" {
+		for _, key := range w.heldKeys() {
+			if !present[key] {
+				if err := w.emitHeld(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	final := contentFilterEventFinished(w.format, event)
+	changed := false
+	hitKey := ""
+	emptied := 0
+	for _, path := range paths {
+		walkContentFilterText(event, path, "", func(key, text string) string {
+			if hitKey != "" {
+				changed = changed || text != ""
+				return ""
+			}
+			out, hit := w.filter.feed(key, text, final)
+			if hit && w.filter.truncate {
+				hitKey = key
+			}
+			if _, held := w.filter.held[key]; held {
+				w.templates[key] = contentFilterTemplate{name: name, data: []byte(data)}
+			}
+			if out != text {
+				changed = true
+				if out == "" {
+					emptied++
+				}
+			}
+			return out
+		})
+	}
+	if emptied > 0 && emptied == len(present) && hitKey == "" && !final && event["usage"] == nil && event["usageMetadata"] == nil {
+		// 文本全部暂存在窗口中，等下一分片一起输出
+		return nil
+	}
+	if w.format == types.RelayFormatOpenAIResponses && paths == nil {
+		// 完整文本在增量事件中已检测过，这里只需保持与增量一致
+		changed = w.filterResponsesText(event) || changed
+	}
+	if hitKey != "" {
+		w.truncated = true
+		w.filter.held = make(map[string]string)
+		switch w.format {
+		case types.RelayFormatOpenAI:
+			if choice, ok := contentFilterSlice(event, "choices")[contentFilterIndex(hitKey, 0)].(map[string]any); ok {
+				choice["finish_reason"] = "content_filter"
+			}
+		case types.RelayFormatGemini:
+			truncateGeminiCandidate(contentFilterSlice(event, "candidates")[contentFilterIndex(hitKey, 0)], contentFilterIndex(hitKey, 1))
+		}
+	}
+	if changed || hitKey != "" {
+		if err := w.writeEventJSON(name, event); err != nil {
+			return err
+		}
+	} else if _, err := w.ResponseWriter.Write(raw); err != nil {
+		return err
+	}
+	if hitKey != "" && w.format == types.RelayFormatClaude {
+		return w.writeEventJSON("content_block_stop", map[string]any{"type": "content_block_stop", "index": event["index"]})
+	}
+	return nil
+}
+
+// writeTruncatedEvent 截断后丢弃内容事件，保留用量与结束事件
+func (w *contentFilterWriter) writeTruncatedEvent(name string, event map[string]any, raw []byte) error {
+	eventType, _ := event["type"].(string)
+	switch w.format {
+	case types.RelayFormatOpenAI:
+		if len(contentFilterSlice(event, "choices")) > 0 {
+			if event["usage"] == nil {
+				return nil
+			}
+			event["choices"] = []any{}
+			return w.writeEventJSON(name, event)
+		}
+	case types.RelayFormatClaude:
+		switch eventType {
+		case "content_block_start", "content_block_delta", "content_block_stop":
+			return nil
+		case "message_delta":
+			if delta := contentFilterMap(event, "delta"); delta != nil {
+				delta["stop_reason"] = "refusal"
+			}
+			return w.writeEventJSON(name, event)
+		}
+	case types.RelayFormatGemini:
+		if _, ok := event["candidates"]; ok {
+			if event["usageMetadata"] == nil {
+				return nil
+			}
+			delete(event, "candidates")
+			return w.writeEventJSON(name, event)
+		}
+	case types.RelayFormatOpenAIResponses:
+		switch eventType {
+		case "response.completed":
+			event["type"] = "response.incomplete"
+			if name != "" {
+				name = "response.incomplete"
+			}
+			if response := contentFilterMap(event, "response"); response != nil {
+				w.filterObject(types.RelayFormatOpenAIResponses, response)
+				markResponsesContentFiltered(response)
+			}
+			return w.writeEventJSON(name, event)
+		case "response.incomplete", "response.failed", "error":
+		default:
+			return nil
+		}
+	}
+	_, err := w.ResponseWriter.Write(raw)
+	return err
+}
+
+// filterResponsesText 替换 Responses 流中 done/completed 等事件携带的完整文本
+func (w *contentFilterWriter) filterResponsesText(value any) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if text, ok := item.(string); ok && key == "text" {
+				if out, _, _ := w.filter.scan(text, false); out != text {
+					v[key] = out
+					changed = true
+				}
+				continue
+			}
+			changed = w.filterResponsesText(item) || changed
+		}
+	case []any:
+		for _, item := range v {
+			changed = w.filterResponsesText(item) || changed
+		}
+	}
+	return changed
+}
+
+func (w *contentFilterWriter) heldKeys() []string {
+	keys := make([]string, 0, len(w.filter.held))
+	for key := range w.filter.held {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (w *contentFilterWriter) flushHeld() error {
+	if w.truncated {
+		return nil
+	}
+	for _, key := range w.heldKeys() {
+		if err := w.emitHeld(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitHeld 复制最近一次包含该字段的事件，只保留暂存的文本后输出
+func (w *contentFilterWriter) emitHeld(key string) error {
+	text := w.filter.held[key]
+	delete(w.filter.held, key)
+	template, ok := w.templates[key]
+	if !ok || text == "" {
+		return nil
+	}
+	event, ok := decodeContentFilterJSON(template.data)
+	if !ok {
+		return nil
+	}
+	for _, path := range contentFilterPaths(w.format, true) {
+		walkContentFilterText(event, path, "", func(k, _ string) string {
+			if k == key {
+				return text
+			}
+			return ""
+		})
+	}
+	delete(event, "usage")
+	delete(event, "usageMetadata")
+	return w.writeEventJSON(template.name, event)
+}
+
+func (w *contentFilterWriter) writeEventJSON(name string, event map[string]any) error {
+	data, err := encodeContentFilterJSON(event)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if name != "" {
+		buf.WriteString("event: " + name + "\n")
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	_, err = w.ResponseWriter.Write(buf.Bytes())
+	return err
+}
+
+// contentFilterEventFinished 事件已携带结束原因时不再保留尾部
+func contentFilterEventFinished(format types.RelayFormat, event map[string]any) bool {
+	var items []any
+	var field string
+	switch format {
+	case types.RelayFormatOpenAI:
+		items, field = contentFilterSlice(event, "choices"), "finish_reason"
+	case types.RelayFormatGemini:
+		items, field = contentFilterSlice(event, "candidates"), "finishReason"
+	}
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			if reason, _ := m[field].(string); reason != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseContentFilterEvent(raw []byte) (name string, data string, ok bool) {
+	var dataLines []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if value, found := strings.CutPrefix(line, "event:"); found {
+			name = strings.TrimSpace(value)
+		} else if value, found := strings.CutPrefix(line, "data:"); found {
+			dataLines = append(dataLines, strings.TrimPrefix(value, " "))
+		}
+	}
+	if len(dataLines) == 0 {
+		return "", "", false
+	}
+	return name, strings.Join(dataLines, "\n"), true
+}
+
+func decodeContentFilterJSON(data []byte) (map[string]any, bool) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, false
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value map[string]any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func encodeContentFilterJSON(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
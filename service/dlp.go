@@ -0,0 +1,346 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+)
+
+type dlpDetector struct {
+	name   string
+	regex  *regexp.Regexp
+	verify func(match string) bool
+}
+
+var dlpBuiltinDetectors = map[string]*dlpDetector{
+	operation_setting.DLPDetectorApiKey: {
+		name: operation_setting.DLPDetectorApiKey,
+		regex: regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_\-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abprs]-[A-Za-z0-9\-]{10,}|AIza[0-9A-Za-z_\-]{35}|glpat-[A-Za-z0-9_\-]{20,})` +
+			`|-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )?PRIVATE KEY-----`),
+	},
+	operation_setting.DLPDetectorEmail: {
+		name:  operation_setting.DLPDetectorEmail,
+		regex: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	operation_setting.DLPDetectorNationalId: {
+		name: operation_setting.DLPDetectorNationalId,
+		// 中国居民身份证号与美国 SSN
+		regex:  regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b|\b\d{3}-\d{2}-\d{4}\b`),
+		verify: verifyNationalId,
+	},
+	operation_setting.DLPDetectorCreditCard: {
+		name:   operation_setting.DLPDetectorCreditCard,
+		regex:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		verify: verifyCreditCard,
+	},
+	operation_setting.DLPDetectorPhone: {
+		name: operation_setting.DLPDetectorPhone,
+		regex: regexp.MustCompile(`(?:\+86[- ]?)?\b1[3-9]\d{9}\b` +
+			`|\+[1-9]\d{0,2}[- ]?\d{2,4}(?:[- ]?\d{2,4}){2,3}\b` +
+			`|\(?\b\d{3}\)?[-. ]\d{3}[-. ]\d{4}\b`),
+		verify: func(match string) bool {
+			digits := len(dlpDigits(match))
+			return digits >= 10 && digits <= 15
+		},
+	},
+	operation_setting.DLPDetectorIP: {
+		name: operation_setting.DLPDetectorIP,
+		regex: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b` +
+			`|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b|\b(?:[0-9A-Fa-f]{1,4}:){1,6}:(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*)?`),
+		verify: func(match string) bool {
+			return net.ParseIP(match) != nil
+		},
+	},
+}
+
+func dlpDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func verifyCreditCard(match string) bool {
+	digits := dlpDigits(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var idCardWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const idCardCheckCodes = "10X98765432"
+
+func verifyNationalId(match string) bool {
+	if strings.Contains(match, "-") {
+		// SSN：区号不能为 000、666 或 9xx，组号与序号不能全为 0
+		area, group, serial := match[0:3], match[4:6], match[7:11]
+		return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+	}
+	sum := 0
+	for i, weight := range idCardWeights {
+		sum += int(match[i]-'0') * weight
+	}
+	return strings.ToUpper(match[17:]) == string(idCardCheckCodes[sum%11])
+}
+
+var (
+	dlpCustomRegexCache sync.Map // pattern -> *regexp.Regexp，编译失败时为 nil
+)
+
+func getDLPCustomRegex(pattern string) *regexp.Regexp {
+	if cached, ok := dlpCustomRegexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		common.SysError("invalid dlp custom pattern " + pattern + ": " + err.Error())
+		re = nil
+	}
+	dlpCustomRegexCache.Store(pattern, re)
+	return re
+}
+
+// getDLPDetectors 按策略返回启用的检测器，内置检测器在前，保证重叠时优先匹配更具体的类型
+func getDLPDetectors(policy operation_setting.DLPPolicy) []*dlpDetector {
+	enabled := make(map[string]bool, len(policy.Detectors))
+	for _, name := range policy.Detectors {
+		enabled[name] = true
+	}
+	all := len(enabled) == 0
+	detectors := make([]*dlpDetector, 0, len(dlpBuiltinDetectors))
+	for _, name := range operation_setting.DLPBuiltinDetectors {
+		if all || enabled[name] {
+			detectors = append(detectors, dlpBuiltinDetectors[name])
+		}
+	}
+	for _, custom := range operation_setting.GetDLPSetting().CustomPatterns {
+		if custom.Name == "" || custom.Pattern == "" || !(all || enabled[custom.Name]) {
+			continue
+		}
+		if re := getDLPCustomRegex(custom.Pattern); re != nil {
+			detectors = append(detectors, &dlpDetector{name: custom.Name, regex: re})
+		}
+	}
+	return detectors
+}
+
+type dlpSpan struct {
+	start, end int
+	detector   string
+}
+
+// DLPMasker 检测一次请求中的敏感数据，mask 策略下记录原文与占位符的对应关系，用于在响应中还原
+type DLPMasker struct {
+	action    string
+	detectors []*dlpDetector
+
+	mu           sync.Mutex
+	findings     map[string]int
+	placeholders map[string]string // 原文 -> 占位符
+	originals    map[string]string // 占位符 -> 原文
+	counters     map[string]int
+	replacer     *strings.Replacer
+}
+
+func NewDLPMasker(policy operation_setting.DLPPolicy) *DLPMasker {
+	return &DLPMasker{
+		action:       policy.Action,
+		detectors:    getDLPDetectors(policy),
+		findings:     make(map[string]int),
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counters:     make(map[string]int),
+	}
+}
+
+func (m *DLPMasker) Action() string {
+	return m.action
+}
+
+// Findings 各检测器的命中次数
+func (m *DLPMasker) Findings() map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	findings := make(map[string]int, len(m.findings))
+	for name, count := range m.findings {
+		findings[name] = count
+	}
+	return findings
+}
+
+func (m *DLPMasker) HasFindings() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.findings) > 0
+}
+
+// HasMasked 是否有内容被替换为占位符
+func (m *DLPMasker) HasMasked() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.originals) > 0
+}
+
+func (m *DLPMasker) findSpans(text string) []dlpSpan {
+	var spans []dlpSpan
+	for _, detector := range m.detectors {
+		for _, loc := range detector.regex.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			if detector.verify != nil && !detector.verify(text[loc[0]:loc[1]]) {
+				continue
+			}
+			overlapped := false
+			for _, span := range spans {
+				if loc[0] < span.end && span.start < loc[1] {
+					overlapped = true
+					break
+				}
+			}
+			if !overlapped {
+				spans = append(spans, dlpSpan{start: loc[0], end: loc[1], detector: detector.name})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+func (m *DLPMasker) placeholderLocked(detector string, original string) string {
+	if placeholder, ok := m.placeholders[original]; ok {
+		return placeholder
+	}
+	m.counters[detector]++
+	name := strings.ToUpper(strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, detector))
+	placeholder := "[" + name + "_" + strconv.Itoa(m.counters[detector]) + "]"
+	m.placeholders[original] = placeholder
+	m.originals[placeholder] = original
+	m.replacer = nil
+	return placeholder
+}
+
+// Scan 检测文本并记录命中，mask 策略下返回替换占位符后的文本，其余策略原样返回
+func (m *DLPMasker) Scan(text string) string {
+	if text == "" || len(m.detectors) == 0 {
+		return text
+	}
+	spans := m.findSpans(text)
+	if len(spans) == 0 {
+		return text
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, span := range spans {
+		m.findings[span.detector]++
+	}
+	if m.action != operation_setting.DLPActionMask {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	last := 0
+	for _, span := range spans {
+		b.WriteString(text[last:span.start])
+		b.WriteString(m.placeholderLocked(span.detector, text[span.start:span.end]))
+		last = span.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (m *DLPMasker) getReplacer() *strings.Replacer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.replacer == nil {
+		pairs := make([]string, 0, len(m.originals)*2)
+		for placeholder, original := range m.originals {
+			pairs = append(pairs, placeholder, original)
+		}
+		m.replacer = strings.NewReplacer(pairs...)
+	}
+	return m.replacer
+}
+
+// Unmask 将文本中的占位符还原为原文
+func (m *DLPMasker) Unmask(text string) string {
+	if !strings.Contains(text, "[") {
+		return text
+	}
+	return m.getReplacer().Replace(text)
+}
+
+// UnmaskPartial 用于流式输出：还原占位符，并在文本以某个占位符的前缀结尾时保留该部分，等待后续分片拼接
+func (m *DLPMasker) UnmaskPartial(text string) (out string, pending string) {
+	text = m.Unmask(text)
+	idx := strings.LastIndexByte(text, '[')
+	if idx < 0 || strings.IndexByte(text[idx:], ']') >= 0 {
+		return text, ""
+	}
+	tail := text[idx:]
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for placeholder := range m.originals {
+		if strings.HasPrefix(placeholder, tail) {
+			return text[:idx], tail
+		}
+	}
+	return text, ""
+}
+
+// maskRaw 将原始请求体中出现的已识别原文替换为占位符，用于透传请求体的场景
+func (m *DLPMasker) maskRaw(body []byte) []byte {
+	m.mu.Lock()
+	pairs := make([]string, 0, len(m.placeholders)*2)
+	for original, placeholder := range m.placeholders {
+		pairs = append(pairs, dlpJSONEscape(original), placeholder)
+	}
+	m.mu.Unlock()
+	if len(pairs) == 0 {
+		return body
+	}
+	return []byte(strings.NewReplacer(pairs...).Replace(string(body)))
+}
+
+// dlpJSONEscape 返回字符串在 JSON 中的转义形式（不含引号），不转义 HTML 字符以匹配客户端原始请求体
+func dlpJSONEscape(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return s
+	}
+	escaped := strings.TrimSuffix(buf.String(), "\n")
+	return escaped[1 : len(escaped)-1]
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApplyDLPPolicy 按使用分组的 DLP 策略检测请求中的敏感数据：
+// block 拒绝请求，mask 将请求中的敏感数据替换为占位符并在响应中还原，flag 仅记录到日志
+func ApplyDLPPolicy(c *gin.Context, group string, request dto.Request) error {
+	policy, ok := operation_setting.GetDLPPolicy(group)
+	if !ok {
+		return nil
+	}
+	masker := NewDLPMasker(policy)
+	if !scanRequestDLP(request, masker) || !masker.HasFindings() {
+		return nil
+	}
+	findings := masker.Findings()
+	common.SetContextKey(c, constant.ContextKeyDLPAction, policy.Action)
+	common.SetContextKey(c, constant.ContextKeyDLPFindings, findings)
+	logger.LogWarn(c, fmt.Sprintf("dlp %s: sensitive data detected: %s", policy.Action, formatDLPFindings(findings)))
+
+	switch policy.Action {
+	case operation_setting.DLPActionBlock:
+		return fmt.Errorf("请求包含敏感数据（%s），已被拦截", formatDLPFindings(findings))
+	case operation_setting.DLPActionMask:
+		if !masker.HasMasked() {
+			return nil
+		}
+		// 透传请求体与重试时会重新读取原始请求体，需要一并替换
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return err
+		}
+		common.CleanupBodyStorage(c)
+		c.Set(common.KeyRequestBody, masker.maskRaw(body))
+		c.Writer = newDLPResponseWriter(c.Writer, masker)
+	}
+	return nil
+}
+
+func formatDLPFindings(findings map[string]int) string {
+	names := make([]string, 0, len(findings))
+	for name, count := range findings {
+		names = append(names, fmt.Sprintf("%s×%d", name, count))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// scanRequestDLP 遍历请求中用户可控的文本内容，不支持的请求类型返回 false
+func scanRequestDLP(request dto.Request, masker *DLPMasker) bool {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		r.Prompt = scanDLPValue(r.Prompt, masker)
+		r.Input = scanDLPValue(r.Input, masker)
+		for i := range r.Messages {
+			message := &r.Messages[i]
+			switch content := message.Content.(type) {
+			case string:
+				message.SetStringContent(masker.Scan(content))
+			case []dto.MediaContent:
+				for j := range content {
+					content[j].Text = masker.Scan(content[j].Text)
+				}
+				message.SetMediaContent(content)
+			case []any:
+				message.SetContent(scanDLPValue(content, masker))
+			}
+		}
+	case *dto.ClaudeRequest:
+		r.Prompt = masker.Scan(r.Prompt)
+		r.System = scanDLPValue(r.System, masker)
+		for i := range r.Messages {
+			r.Messages[i].Content = scanDLPValue(r.Messages[i].Content, masker)
+		}
+	case *dto.GeminiChatRequest:
+		scanGeminiRequestDLP(r, masker)
+	case *dto.OpenAIResponsesRequest:
+		r.Input = scanDLPRawMessage(r.Input, masker)
+		r.Instructions = scanDLPRawMessage(r.Instructions, masker)
+	default:
+		return false
+	}
+	return true
+}
+
+func scanGeminiRequestDLP(r *dto.GeminiChatRequest, masker *DLPMasker) {
+	for i := range r.Requests {
+		scanGeminiRequestDLP(&r.Requests[i], masker)
+	}
+	contents := make([]*dto.GeminiChatContent, 0, len(r.Contents)+1)
+	for i := range r.Contents {
+		contents = append(contents, &r.Contents[i])
+	}
+	if r.SystemInstructions != nil {
+		contents = append(contents, r.SystemInstructions)
+	}
+	for _, content := range contents {
+		for j := range content.Parts {
+			content.Parts[j].Text = masker.Scan(content.Parts[j].Text)
+		}
+	}
+}
+
+func scanDLPRawMessage(raw json.RawMessage, masker *DLPMasker) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var value any
+	if err := common.Unmarshal(raw, &value); err != nil {
+		return raw
+	}
+	if masker.Action() != operation_setting.DLPActionMask {
+		scanDLPValue(value, masker)
+		return raw
+	}
+	data, err := common.Marshal(scanDLPValue(value, masker))
+	if err != nil {
+		return raw
+	}
+	return data
+}
+
+// scanDLPValue 处理字符串、字符串数组以及 {"text": ...}/{"content": ...} 形式的内容块，不处理图片、文件等二进制内容
+func scanDLPValue(value any, masker *DLPMasker) any {
+	switch v := value.(type) {
+	case string:
+		return masker.Scan(v)
+	case []any:
+		for i, item := range v {
+			v[i] = scanDLPValue(item, masker)
+		}
+		return v
+	case map[string]any:
+		for _, key := range []string{"text", "content", "output"} {
+			if item, ok := v[key]; ok {
+				v[key] = scanDLPValue(item, masker)
+			}
+		}
+		return v
+	}
+	return value
+}
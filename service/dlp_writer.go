@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dlpResponseWriter 在响应写回客户端前将占位符还原为原文。
+// 流式响应按 SSE 行处理，占位符被拆分到多个分片时，按 JSON 字段路径暂存前缀并拼接到下一分片
+type dlpResponseWriter struct {
+	gin.ResponseWriter
+	masker *DLPMasker
+
+	decided bool
+	stream  bool
+	line    []byte
+	pending map[string]string // JSON 字段路径 -> 尚未输出的占位符前缀
+}
+
+func newDLPResponseWriter(w gin.ResponseWriter, masker *DLPMasker) *dlpResponseWriter {
+	return &dlpResponseWriter{
+		ResponseWriter: w,
+		masker:         masker,
+		pending:        make(map[string]string),
+	}
+}
+
+func (w *dlpResponseWriter) WriteHeader(code int) {
+	// 还原后响应体长度会变化
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *dlpResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *dlpResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+		w.Header().Del("Content-Length")
+	}
+	if !w.stream {
+		if _, err := w.ResponseWriter.Write(w.unmaskBody(data)); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	w.line = append(w.line, data...)
+	for {
+		idx := bytes.IndexByte(w.line, '\n')
+		if idx < 0 {
+			break
+		}
+		line := w.unmaskEventLine(w.line[:idx+1])
+		w.line = w.line[idx+1:]
+		if _, err := w.ResponseWriter.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *dlpResponseWriter) unmaskBody(data []byte) []byte {
+	if !bytes.Contains(data, []byte("[")) {
+		return data
+	}
+	text := string(data)
+	if strings.Contains(w.Header().Get("Content-Type"), "json") {
+		// JSON 中原文需要转义
+		w.masker.mu.Lock()
+		pairs := make([]string, 0, len(w.masker.originals)*2)
+		for placeholder, original := range w.masker.originals {
+			pairs = append(pairs, placeholder, dlpJSONEscape(original))
+		}
+		w.masker.mu.Unlock()
+		return []byte(strings.NewReplacer(pairs...).Replace(text))
+	}
+	return []byte(w.masker.Unmask(text))
+}
+
+func (w *dlpResponseWriter) unmaskEventLine(line []byte) []byte {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return line
+	}
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		return line
+	}
+	if len(w.pending) == 0 && !bytes.Contains(payload, []byte("[")) {
+		return line
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var event any
+	if err := decoder.Decode(&event); err != nil {
+		return line
+	}
+	event = w.unmaskEventValue(event, "")
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		return line
+	}
+	out := append([]byte("data: "), bytes.TrimSuffix(buf.Bytes(), []byte("\n"))...)
+	if bytes.HasSuffix(line, []byte("\r\n")) {
+		return append(out, '\r', '\n')
+	}
+	return append(out, '\n')
+}
+
+func (w *dlpResponseWriter) unmaskEventValue(value any, path string) any {
+	switch v := value.(type) {
+	case string:
+		out, pending := w.masker.UnmaskPartial(w.pending[path] + v)
+		if pending == "" {
+			delete(w.pending, path)
+		} else {
+			w.pending[path] = pending
+		}
+		return out
+	case []any:
+		for i, item := range v {
+			v[i] = w.unmaskEventValue(item, path+"."+strconv.Itoa(i))
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			v[key] = w.unmaskEventValue(item, path+"."+key)
+		}
+		return v
+	}
+	return value
+}
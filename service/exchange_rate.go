@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	exchangeRateTickInterval   = 10 * time.Minute
+	exchangeRateRequestTimeout = 30 * time.Second
+)
+
+var (
+	exchangeRateTaskOnce    sync.Once
+	exchangeRateTaskRunning atomic.Bool
+	exchangeRateLastUpdate  atomic.Int64
+)
+
+// exchangeRateResponse 兼容 open.er-api.com（base_code）与 exchangerate.host / frankfurter（base）等常见格式
+type exchangeRateResponse struct {
+	Base     string             `json:"base"`
+	BaseCode string             `json:"base_code"`
+	Rates    map[string]float64 `json:"rates"`
+}
+
+// FetchExchangeRates 从汇率源获取以 USD 为基准的汇率
+func FetchExchangeRates(ctx context.Context, sourceURL string) (map[string]float64, error) {
+	sourceURL = strings.TrimSpace(sourceURL)
+	if sourceURL == "" {
+		return nil, errors.New("未配置汇率源")
+	}
+	ctx, cancel := context.WithTimeout(ctx, exchangeRateRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("汇率源返回状态码 %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var data exchangeRateResponse
+	if err := common.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("解析汇率数据失败: %w", err)
+	}
+	base := data.BaseCode
+	if base == "" {
+		base = data.Base
+	}
+	if base != "" && model.NormalizeCurrency(base) != model.CurrencyUSD {
+		return nil, fmt.Errorf("汇率源基准货币为 %s，需为 USD", base)
+	}
+	if len(data.Rates) == 0 {
+		return nil, errors.New("汇率源未返回汇率数据")
+	}
+	rates := make(map[string]float64, len(data.Rates))
+	for code, rate := range data.Rates {
+		rates[model.NormalizeCurrency(code)] = rate
+	}
+	return rates, nil
+}
+
+// RefreshExchangeRates 拉取汇率并更新非手动覆盖的币种，返回更新数量
+func RefreshExchangeRates(ctx context.Context) (int, error) {
+	sourceURL := operation_setting.GetExchangeRateSetting().SourceURL
+	rates, err := FetchExchangeRates(ctx, sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := model.UpdateFetchedExchangeRates(rates, sourceURL)
+	if err != nil {
+		return updated, err
+	}
+	exchangeRateLastUpdate.Store(time.Now().Unix())
+	return updated, nil
+}
+
+func StartExchangeRateTask() {
+	exchangeRateTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("exchange rate task started: tick=%s", exchangeRateTickInterval))
+			ticker := time.NewTicker(exchangeRateTickInterval)
+			defer ticker.Stop()
+
+			runExchangeRateTaskOnce()
+			for range ticker.C {
+				runExchangeRateTaskOnce()
+			}
+		})
+	})
+}
+
+func runExchangeRateTaskOnce() {
+	setting := operation_setting.GetExchangeRateSetting()
+	if !setting.AutoUpdateEnabled {
+		return
+	}
+	interval := time.Duration(setting.UpdateIntervalMinutes) * time.Minute
+	if interval < exchangeRateTickInterval {
+		interval = exchangeRateTickInterval
+	}
+	if time.Since(time.Unix(exchangeRateLastUpdate.Load(), 0)) < interval {
+		return
+	}
+	if !exchangeRateTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer exchangeRateTaskRunning.Store(false)
+
+	ctx := context.Background()
+	updated, err := RefreshExchangeRates(ctx)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("exchange rate task failed: err=%v", err))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("exchange rate task finished: updated=%d", updated))
+}
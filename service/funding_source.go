@@ -1,8 +1,10 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/Zer0Echo/uniapi/common"
 	"github.com/Zer0Echo/uniapi/model"
 )
 
@@ -27,8 +29,17 @@ type FundingSource interface {
 // ---------------------------------------------------------------------------
 
 type WalletFunding struct {
-	userId   int
-	consumed int // 实际预扣的用户额度
+	requestId string
+	userId    int
+	consumed  int // 实际预扣的用户额度
+}
+
+func consumeLedgerRef(requestId string) model.LedgerRef {
+	return model.LedgerRef{Source: model.LedgerSourceConsume, ReferenceId: requestId}
+}
+
+func refundLedgerRef(requestId string) model.LedgerRef {
+	return model.LedgerRef{Source: model.LedgerSourceRefund, ReferenceId: requestId}
 }
 
 func (w *WalletFunding) Source() string { return BillingSourceWallet }
@@ -37,7 +48,7 @@ func (w *WalletFunding) PreConsume(amount int) error {
 	if amount <= 0 {
 		return nil
 	}
-	if err := model.DecreaseUserQuota(w.userId, amount); err != nil {
+	if err := model.DecreaseUserQuota(w.userId, amount, consumeLedgerRef(w.requestId)); err != nil {
 		return err
 	}
 	w.consumed = amount
@@ -49,9 +60,9 @@ func (w *WalletFunding) Settle(delta int) error {
 		return nil
 	}
 	if delta > 0 {
-		return model.DecreaseUserQuota(w.userId, delta)
+		return model.DecreaseUserQuota(w.userId, delta, consumeLedgerRef(w.requestId))
 	}
-	return model.IncreaseUserQuota(w.userId, -delta, false)
+	return model.IncreaseUserQuota(w.userId, -delta, false, refundLedgerRef(w.requestId))
 }
 
 func (w *WalletFunding) Refund() error {
@@ -60,7 +71,7 @@ func (w *WalletFunding) Refund() error {
 	}
 	// IncreaseUserQuota 是 quota += N 的非幂等操作，不能重试，否则会多退额度。
 	// 订阅的 RefundSubscriptionPreConsume 有 requestId 幂等保护所以可以重试。
-	return model.IncreaseUserQuota(w.userId, w.consumed, false)
+	return model.IncreaseUserQuota(w.userId, w.consumed, false, refundLedgerRef(w.requestId))
 }
 
 // ---------------------------------------------------------------------------
@@ -68,24 +79,38 @@ func (w *WalletFunding) Refund() error {
 // ---------------------------------------------------------------------------
 
 type SubscriptionFunding struct {
-	requestId      string
-	userId         int
-	modelName      string
-	amount         int64 // 预扣的订阅额度（subConsume）
-	subscriptionId int
-	preConsumed    int64
+	requestId       string
+	userId          int
+	orgId           int // 非 0 时使用组织持有的订阅
+	projectId       int
+	modelName       string
+	amount          int64 // 预扣的订阅额度（subConsume）
+	estimatedTokens int64 // 预估 token 数，用于按 token 计量的模型额度
+	subscriptionId  int
+	preConsumed     int64
+	actualTokens    int64 // 结算前由 BillingSession 设置的实际 token 数
+	projectUsed     int   // 已计入项目预算的额度，退款时撤销
 	// 以下字段在 PreConsume 成功后填充，供 RelayInfo 同步使用
-	AmountTotal     int64
-	AmountUsedAfter int64
-	PlanId          int
-	PlanTitle       string
+	AmountTotal       int64
+	AmountUsedAfter   int64
+	PlanId            int
+	PlanTitle         string
+	AllowanceModel    string // 命中的模型额度，为空表示从订阅总额度扣减
+	AllowanceMetric   string
+	AllowanceConsumed int64
 }
 
 func (s *SubscriptionFunding) Source() string { return BillingSourceSubscription }
 
 func (s *SubscriptionFunding) PreConsume(_ int) error {
 	// amount 参数被忽略，使用内部 s.amount（已在构造时根据 preConsumedQuota 计算）
-	res, err := model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount)
+	var res *model.SubscriptionPreConsumeResult
+	var err error
+	if s.orgId != 0 {
+		res, err = model.PreConsumeOrganizationSubscription(s.requestId, s.orgId, s.userId, s.modelName, s.amount, s.estimatedTokens)
+	} else {
+		res, err = model.PreConsumeUserSubscription(s.requestId, s.userId, s.modelName, 0, s.amount, s.estimatedTokens)
+	}
 	if err != nil {
 		return err
 	}
@@ -93,28 +118,132 @@ func (s *SubscriptionFunding) PreConsume(_ int) error {
 	s.preConsumed = res.PreConsumed
 	s.AmountTotal = res.AmountTotal
 	s.AmountUsedAfter = res.AmountUsedAfter
+	s.AllowanceModel = res.AllowanceModel
+	s.AllowanceMetric = res.AllowanceMetric
+	s.AllowanceConsumed = res.AllowanceConsumed
 	// 获取订阅计划信息
 	if planInfo, err := model.GetSubscriptionPlanInfoByUserSubscriptionId(res.UserSubscriptionId); err == nil && planInfo != nil {
 		s.PlanId = planInfo.PlanId
 		s.PlanTitle = planInfo.PlanTitle
 	}
+	return s.addProjectUsed(int(res.PreConsumed))
+}
+
+// addProjectUsed 组织订阅的消耗同样计入项目预算
+func (s *SubscriptionFunding) addProjectUsed(delta int) error {
+	if s.projectId == 0 || delta == 0 {
+		return nil
+	}
+	if err := model.UpdateProjectUsedQuota(s.projectId, delta); err != nil {
+		return err
+	}
+	s.projectUsed += delta
 	return nil
 }
 
 func (s *SubscriptionFunding) Settle(delta int) error {
+	// 命中模型额度时不占用订阅总额度，按请求计量的预扣即为最终用量
+	if s.AllowanceModel != "" {
+		if !s.meteredByTokens() {
+			return nil
+		}
+		return model.SettleSubscriptionAllowance(s.requestId, s.actualTokens)
+	}
 	if delta == 0 {
 		return nil
 	}
-	return model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta))
+	if err := model.PostConsumeUserSubscriptionDelta(s.subscriptionId, int64(delta)); err != nil {
+		return err
+	}
+	return s.addProjectUsed(delta)
+}
+
+func (s *SubscriptionFunding) meteredByTokens() bool {
+	return s.AllowanceModel != "" && s.AllowanceMetric == model.SubscriptionAllowanceMetricTokens
 }
 
 func (s *SubscriptionFunding) Refund() error {
-	if s.preConsumed <= 0 {
+	if s.preConsumed <= 0 && s.AllowanceConsumed <= 0 {
 		return nil
 	}
-	return refundWithRetry(func() error {
+	if err := refundWithRetry(func() error {
 		return model.RefundSubscriptionPreConsume(s.requestId)
-	})
+	}); err != nil {
+		return err
+	}
+	return s.addProjectUsed(-s.projectUsed)
+}
+
+// ---------------------------------------------------------------------------
+// OrganizationFunding — 组织钱包资金来源实现（项目令牌）
+// ---------------------------------------------------------------------------
+
+type OrganizationFunding struct {
+	requestId string
+	orgId     int
+	projectId int
+	consumed  int // 实际预扣的组织额度
+}
+
+func (o *OrganizationFunding) Source() string { return BillingSourceOrganization }
+
+func (o *OrganizationFunding) PreConsume(amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	// 先原子地预留项目预算，并发请求不会同时通过预算检查
+	if err := model.ReserveProjectBudget(o.projectId, amount); err != nil {
+		return err
+	}
+	if err := model.ConsumeOrganizationQuota(o.orgId, amount, consumeLedgerRef(o.requestId)); err != nil {
+		if rollbackErr := model.UpdateProjectUsedQuota(o.projectId, -amount); rollbackErr != nil {
+			common.SysLog(fmt.Sprintf("error rolling back project budget (projectId=%d, amount=%d): %s", o.projectId, amount, rollbackErr.Error()))
+		}
+		return err
+	}
+	o.consumed = amount
+	return nil
+}
+
+// Settle 补扣时同样受项目预算约束，超出剩余预算的部分不再扣费
+func (o *OrganizationFunding) Settle(delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	if delta < 0 {
+		if err := model.RefundOrganizationQuota(o.orgId, -delta, refundLedgerRef(o.requestId)); err != nil {
+			return err
+		}
+		return model.UpdateProjectUsedQuota(o.projectId, delta)
+	}
+	charge, err := model.ConsumeProjectBudget(o.projectId, delta)
+	if err != nil {
+		return err
+	}
+	if charge < delta {
+		common.SysLog(fmt.Sprintf("project budget exhausted on settlement, overage not billed (projectId=%d, requestId=%s, delta=%d, charged=%d)",
+			o.projectId, o.requestId, delta, charge))
+	}
+	if charge == 0 {
+		return nil
+	}
+	if err := model.ConsumeOrganizationQuota(o.orgId, charge, consumeLedgerRef(o.requestId)); err != nil {
+		if rollbackErr := model.UpdateProjectUsedQuota(o.projectId, -charge); rollbackErr != nil {
+			common.SysLog(fmt.Sprintf("error rolling back project budget (projectId=%d, amount=%d): %s", o.projectId, charge, rollbackErr.Error()))
+		}
+		return err
+	}
+	return nil
+}
+
+func (o *OrganizationFunding) Refund() error {
+	if o.consumed <= 0 {
+		return nil
+	}
+	if err := model.RefundOrganizationQuota(o.orgId, o.consumed, refundLedgerRef(o.requestId)); err != nil {
+		return err
+	}
+	return model.UpdateProjectUsedQuota(o.projectId, -o.consumed)
 }
 
 // refundWithRetry 尝试多次执行退款操作以提高成功率，只能用于基于事务的退款函数！！！！！！
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/model"
+	relaycommon "github.com/Zer0Echo/uniapi/relay/common"
+	"github.com/Zer0Echo/uniapi/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createTestOrganization(t *testing.T, quota int, budget int) (*model.Organization, *model.Project) {
+	t.Helper()
+	org := &model.Organization{Name: "org", Quota: quota, Status: 1}
+	if err := model.DB.Create(org).Error; err != nil {
+		t.Fatalf("failed to create organization: %v", err)
+	}
+	project := &model.Project{OrgId: org.Id, Name: "project", Budget: budget, Status: 1}
+	if err := model.DB.Create(project).Error; err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	return org, project
+}
+
+// assertOrganizationQuota 检查组织余额与项目已用额度
+func assertOrganizationQuota(t *testing.T, orgId int, projectId int, quota int, projectUsed int) {
+	t.Helper()
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		t.Fatalf("GetOrganizationById: %v", err)
+	}
+	project, err := model.GetProjectById(projectId)
+	if err != nil {
+		t.Fatalf("GetProjectById: %v", err)
+	}
+	if org.Quota != quota || project.UsedQuota != projectUsed {
+		t.Fatalf("organization quota=%d project used=%d, want %d and %d", org.Quota, project.UsedQuota, quota, projectUsed)
+	}
+}
+
+func newOrganizationRelayInfo(orgId int, projectId int) *relaycommon.RelayInfo {
+	// playground 请求不涉及令牌额度，只验证组织钱包与项目预算
+	return &relaycommon.RelayInfo{OrgId: orgId, ProjectId: projectId, RequestId: "req-org", IsPlayground: true}
+}
+
+func TestOrganizationFundingPreConsumeAndRefund(t *testing.T) {
+	org, project := createTestOrganization(t, 1000, 500)
+	funding := &OrganizationFunding{requestId: "req-1", orgId: org.Id, projectId: project.Id}
+
+	if err := funding.PreConsume(300); err != nil {
+		t.Fatalf("PreConsume: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 700, 300)
+	if err := funding.Refund(); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 1000, 0)
+}
+
+func TestOrganizationFundingPreConsumeExceedsBudget(t *testing.T) {
+	org, project := createTestOrganization(t, 1000, 200)
+	funding := &OrganizationFunding{requestId: "req-2", orgId: org.Id, projectId: project.Id}
+
+	if err := funding.PreConsume(150); err != nil {
+		t.Fatalf("PreConsume: %v", err)
+	}
+	// 并发请求通过了预检查，但预留时超出剩余预算，不扣组织余额
+	second := &OrganizationFunding{requestId: "req-3", orgId: org.Id, projectId: project.Id}
+	if err := second.PreConsume(100); !errors.Is(err, model.ErrProjectBudgetExceeded) {
+		t.Fatalf("PreConsume err = %v, want ErrProjectBudgetExceeded", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 850, 150)
+	if err := second.Refund(); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 850, 150)
+}
+
+func TestOrganizationFundingSettle(t *testing.T) {
+	org, project := createTestOrganization(t, 1000, 500)
+	funding := &OrganizationFunding{requestId: "req-4", orgId: org.Id, projectId: project.Id}
+	if err := funding.PreConsume(300); err != nil {
+		t.Fatalf("PreConsume: %v", err)
+	}
+	if err := funding.Settle(-100); err != nil {
+		t.Fatalf("Settle refund: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 800, 200)
+	// 补扣超出项目预算的部分不扣组织余额
+	if err := funding.Settle(400); err != nil {
+		t.Fatalf("Settle charge: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 500, 500)
+	if err := funding.Settle(100); err != nil {
+		t.Fatalf("Settle over budget: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 500, 500)
+}
+
+func TestNewOrganizationBillingSession(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	org, project := createTestOrganization(t, 1000, 300)
+
+	session, apiErr := NewBillingSession(c, newOrganizationRelayInfo(org.Id, project.Id), 200)
+	if apiErr != nil {
+		t.Fatalf("NewBillingSession: %v", apiErr)
+	}
+	if session.GetPreConsumedQuota() != 200 {
+		t.Fatalf("expected pre-consumed quota 200, got %d", session.GetPreConsumedQuota())
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 800, 200)
+
+	// 剩余预算不足时拒绝请求
+	_, apiErr = NewBillingSession(c, newOrganizationRelayInfo(org.Id, project.Id), 200)
+	if apiErr == nil || apiErr.GetErrorCode() != types.ErrorCodeInsufficientUserQuota {
+		t.Fatalf("expected project budget error, got %v", apiErr)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 800, 200)
+
+	// 结算时超出预算的部分不再扣费
+	if err := session.Settle(400); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 700, 300)
+}
+
+func TestNewOrganizationBillingSessionInsufficientQuota(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	org, project := createTestOrganization(t, 100, 0)
+
+	_, apiErr := NewBillingSession(c, newOrganizationRelayInfo(org.Id, project.Id), 200)
+	if apiErr == nil || apiErr.GetErrorCode() != types.ErrorCodeInsufficientUserQuota {
+		t.Fatalf("expected organization quota error, got %v", apiErr)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 100, 0)
+}
+
+func TestPostConsumeQuotaOrganization(t *testing.T) {
+	org, project := createTestOrganization(t, 1000, 500)
+	relayInfo := newOrganizationRelayInfo(org.Id, project.Id)
+
+	if err := PostConsumeQuota(relayInfo, 300, 0, false); err != nil {
+		t.Fatalf("PostConsumeQuota: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 700, 300)
+	if err := PostConsumeQuota(relayInfo, -100, 0, false); err != nil {
+		t.Fatalf("PostConsumeQuota refund: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 800, 200)
+	if err := PostConsumeQuota(relayInfo, 400, 0, false); err != nil {
+		t.Fatalf("PostConsumeQuota over budget: %v", err)
+	}
+	assertOrganizationQuota(t, org.Id, project.Id, 500, 500)
+}
+
+func TestGetPayerQuotaOrganization(t *testing.T) {
+	org, project := createTestOrganization(t, 1000, 300)
+	if err := model.UpdateProjectUsedQuota(project.Id, 100); err != nil {
+		t.Fatalf("UpdateProjectUsedQuota: %v", err)
+	}
+	// 项目令牌可用额度取组织余额与项目剩余预算中较小者
+	if quota, err := GetPayerQuota(newOrganizationRelayInfo(org.Id, project.Id)); err != nil || quota != 200 {
+		t.Fatalf("GetPayerQuota = %d, %v, want 200", quota, err)
+	}
+	_, unlimited := createTestOrganization(t, 1000, 0)
+	if quota, err := GetPayerQuota(newOrganizationRelayInfo(org.Id, unlimited.Id)); err != nil || quota != 1000 {
+		t.Fatalf("GetPayerQuota = %d, %v, want 1000", quota, err)
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrLDAPUserNotFound       = errors.New("LDAP 中不存在该用户")
+	ErrLDAPInvalidCredentials = errors.New("LDAP 用户名或密码错误")
+)
+
+// LDAPIdentity LDAP 认证通过的用户信息，Groups 为用户所属组的 DN
+type LDAPIdentity struct {
+	Username    string
+	DN          string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+func dialLDAP(settings *system_setting.LDAPSettings) (*ldap.Conn, error) {
+	timeout := time.Duration(settings.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	u, err := url.Parse(settings.URL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 LDAP 地址: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	conn, err := ldap.DialURL(settings.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+	if settings.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindLDAPServiceAccount 使用服务账号绑定，未配置时保持匿名
+func bindLDAPServiceAccount(conn *ldap.Conn, settings *system_setting.LDAPSettings) error {
+	if settings.BindDN == "" {
+		return nil
+	}
+	return conn.Bind(settings.BindDN, settings.BindPassword)
+}
+
+func ldapFilter(template string, replacements map[string]string) string {
+	for key, value := range replacements {
+		template = strings.ReplaceAll(template, "{"+key+"}", ldap.EscapeFilter(value))
+	}
+	return template
+}
+
+// LDAPAuthenticate 使用服务账号查找用户条目，再以用户 DN 与密码绑定校验，最后读取用户所属的组
+func LDAPAuthenticate(username string, password string) (*LDAPIdentity, error) {
+	settings := system_setting.GetLDAPSettings()
+	if !settings.Enabled || settings.URL == "" {
+		return nil, errors.New("管理员未开启 LDAP 登录")
+	}
+	// 空密码会被多数目录服务视为匿名绑定并返回成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	conn, err := dialLDAP(settings)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := bindLDAPServiceAccount(conn, settings); err != nil {
+		return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+	}
+	attributes := []string{settings.UsernameAttribute, settings.EmailAttribute, settings.DisplayNameAttribute}
+	if settings.GroupAttribute != "" {
+		attributes = append(attributes, settings.GroupAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		ldapFilter(settings.UserFilter, map[string]string{"username": username}),
+		attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	if result == nil || len(result.Entries) == 0 {
+		return nil, ErrLDAPUserNotFound
+	}
+	if len(result.Entries) > 1 {
+		return nil, errors.New("LDAP 中匹配到多个用户，请检查用户过滤条件")
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, err
+	}
+
+	identity := &LDAPIdentity{
+		Username:    entry.GetAttributeValue(settings.UsernameAttribute),
+		DN:          entry.DN,
+		Email:       entry.GetAttributeValue(settings.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(settings.DisplayNameAttribute),
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	if settings.GroupAttribute != "" {
+		identity.Groups = entry.GetAttributeValues(settings.GroupAttribute)
+	}
+	if settings.GroupBaseDN != "" && settings.GroupFilter != "" {
+		groups, err := searchLDAPGroups(conn, settings, identity)
+		if err != nil {
+			return nil, err
+		}
+		identity.Groups = append(identity.Groups, groups...)
+	}
+	return identity, nil
+}
+
+// searchLDAPGroups 适用于未启用 memberOf 的目录服务，按组条目上的成员属性反查
+func searchLDAPGroups(conn *ldap.Conn, settings *system_setting.LDAPSettings, identity *LDAPIdentity) ([]string, error) {
+	// 用户绑定后可能没有读取组的权限，切回服务账号
+	if err := bindLDAPServiceAccount(conn, settings); err != nil {
+		return nil, fmt.Errorf("LDAP 服务账号绑定失败: %w", err)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		settings.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		ldapFilter(settings.GroupFilter, map[string]string{"dn": identity.DN, "username": identity.Username}),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	ledgerReconcileTickInterval = 1 * time.Hour
+	// 单次对账最多在日志中展开的差异账户数
+	ledgerReconcileLogLimit = 20
+)
+
+var (
+	ledgerReconcileOnce    sync.Once
+	ledgerReconcileRunning atomic.Bool
+)
+
+func StartLedgerReconcileTask() {
+	ledgerReconcileOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ctx := context.Background()
+			logger.LogInfo(ctx, fmt.Sprintf("ledger reconcile task started: tick=%s", ledgerReconcileTickInterval))
+			ticker := time.NewTicker(ledgerReconcileTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				_, _ = RunLedgerReconcile()
+			}
+		})
+	})
+}
+
+// RunLedgerReconcile 执行一次账本对账，将存在差异的账户写入系统日志。
+// 开启批量更新时，尚未落库的余额变动也会短暂表现为差异。
+func RunLedgerReconcile() ([]model.LedgerDrift, error) {
+	if !ledgerReconcileRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("ledger reconcile is already running")
+	}
+	defer ledgerReconcileRunning.Store(false)
+
+	drifts, err := model.ReconcileLedger()
+	if err != nil {
+		common.SysError("ledger reconcile failed: " + err.Error())
+		return nil, err
+	}
+	if len(drifts) == 0 {
+		return drifts, nil
+	}
+	common.SysError(fmt.Sprintf("ledger reconcile found %d drifted accounts", len(drifts)))
+	for i, drift := range drifts {
+		if i >= ledgerReconcileLogLimit {
+			break
+		}
+		common.SysError(fmt.Sprintf("ledger drift: %s balance=%d ledger=%d drift=%d",
+			model.LedgerAccount(drift.AccountType, drift.AccountId), drift.Balance, drift.LedgerBalance, drift.Drift))
+	}
+	return drifts, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+)
+
+const (
+	LogExportFormatCSV   = "csv"
+	LogExportFormatJSONL = "jsonl"
+)
+
+// LogExportRow 导出的一行日志，展开了 Other 中常用于成本分摊的字段
+type LogExportRow struct {
+	Id                  int     `json:"id"`
+	CreatedAt           string  `json:"created_at"`
+	Type                int     `json:"type"`
+	UserId              int     `json:"user_id"`
+	Username            string  `json:"username"`
+	TokenId             int     `json:"token_id"`
+	TokenName           string  `json:"token_name"`
+	ModelName           string  `json:"model_name"`
+	Group               string  `json:"group"`
+	Quota               int     `json:"quota"`
+	Cost                float64 `json:"cost"`
+	PromptTokens        int     `json:"prompt_tokens"`
+	CompletionTokens    int     `json:"completion_tokens"`
+	CacheTokens         int     `json:"cache_tokens"`
+	CacheCreationTokens int     `json:"cache_creation_tokens"`
+	ReasoningTokens     int     `json:"reasoning_tokens"`
+	ModelRatio          float64 `json:"model_ratio"`
+	GroupRatio          float64 `json:"group_ratio"`
+	CompletionRatio     float64 `json:"completion_ratio"`
+	ModelPrice          float64 `json:"model_price"`
+	BillingSource       string  `json:"billing_source,omitempty"`
+	UseTime             int     `json:"use_time"`
+	IsStream            bool    `json:"is_stream"`
+	RequestId           string  `json:"request_id"`
+	OrgId               int     `json:"org_id"`
+	ProjectId           int     `json:"project_id"`
+	// 以下字段仅管理员导出包含
+	ChannelId   int    `json:"channel_id,omitempty"`
+	ChannelName string `json:"channel_name,omitempty"`
+	Ip          string `json:"ip,omitempty"`
+}
+
+var logExportUserHeader = []string{
+	"id", "created_at", "type", "user_id", "username", "token_id", "token_name", "model_name", "group",
+	"quota", "cost", "prompt_tokens", "completion_tokens", "cache_tokens", "cache_creation_tokens", "reasoning_tokens",
+	"model_ratio", "group_ratio", "completion_ratio", "model_price", "billing_source", "use_time", "is_stream",
+	"request_id", "org_id", "project_id",
+}
+
+var logExportAdminHeader = append(append([]string{}, logExportUserHeader...), "channel_id", "channel_name", "ip")
+
+func otherInt(other map[string]interface{}, key string) int {
+	if v, ok := other[key].(float64); ok {
+		return int(v)
+	}
+	return 0
+}
+
+func otherFloat(other map[string]interface{}, key string) float64 {
+	if v, ok := other[key].(float64); ok {
+		return v
+	}
+	return 0
+}
+
+func newLogExportRow(log *model.Log, admin bool) LogExportRow {
+	other, _ := common.StrToMap(log.Other)
+	row := LogExportRow{
+		Id:                  log.Id,
+		CreatedAt:           time.Unix(log.CreatedAt, 0).Format(time.RFC3339),
+		Type:                log.Type,
+		UserId:              log.UserId,
+		Username:            log.Username,
+		TokenId:             log.TokenId,
+		TokenName:           log.TokenName,
+		ModelName:           log.ModelName,
+		Group:               log.Group,
+		Quota:               log.Quota,
+		Cost:                float64(log.Quota) / common.QuotaPerUnit,
+		PromptTokens:        log.PromptTokens,
+		CompletionTokens:    log.CompletionTokens,
+		CacheTokens:         otherInt(other, "cache_tokens"),
+		CacheCreationTokens: otherInt(other, "cache_creation_tokens"),
+		ReasoningTokens:     otherInt(other, "reasoning_tokens"),
+		ModelRatio:          otherFloat(other, "model_ratio"),
+		GroupRatio:          otherFloat(other, "group_ratio"),
+		CompletionRatio:     otherFloat(other, "completion_ratio"),
+		ModelPrice:          otherFloat(other, "model_price"),
+		UseTime:             log.UseTime,
+		IsStream:            log.IsStream,
+		RequestId:           log.RequestId,
+		OrgId:               log.OrgId,
+		ProjectId:           log.ProjectId,
+	}
+	if source, ok := other["billing_source"].(string); ok {
+		row.BillingSource = source
+	}
+	// 用户分组专属倍率覆盖分组倍率时，以实际生效的倍率为准
+	if userGroupRatio := otherFloat(other, "user_group_ratio"); userGroupRatio > 0 {
+		row.GroupRatio = userGroupRatio
+	}
+	if admin {
+		row.ChannelId = log.ChannelId
+		row.ChannelName = log.ChannelName
+		row.Ip = log.Ip
+	}
+	return row
+}
+
+// csvText 以 = + - @ 等开头的文本会被表格软件当作公式执行，加单引号前缀按纯文本显示
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (row *LogExportRow) csvRecord(admin bool) []string {
+	record := []string{
+		strconv.Itoa(row.Id), row.CreatedAt, strconv.Itoa(row.Type), strconv.Itoa(row.UserId), csvText(row.Username),
+		strconv.Itoa(row.TokenId), csvText(row.TokenName), csvText(row.ModelName), csvText(row.Group),
+		strconv.Itoa(row.Quota), strconv.FormatFloat(row.Cost, 'f', 6, 64),
+		strconv.Itoa(row.PromptTokens), strconv.Itoa(row.CompletionTokens), strconv.Itoa(row.CacheTokens),
+		strconv.Itoa(row.CacheCreationTokens), strconv.Itoa(row.ReasoningTokens),
+		strconv.FormatFloat(row.ModelRatio, 'f', -1, 64), strconv.FormatFloat(row.GroupRatio, 'f', -1, 64),
+		strconv.FormatFloat(row.CompletionRatio, 'f', -1, 64), strconv.FormatFloat(row.ModelPrice, 'f', -1, 64),
+		csvText(row.BillingSource), strconv.Itoa(row.UseTime), strconv.FormatBool(row.IsStream),
+		csvText(row.RequestId), strconv.Itoa(row.OrgId), strconv.Itoa(row.ProjectId),
+	}
+	if admin {
+		record = append(record, strconv.Itoa(row.ChannelId), csvText(row.ChannelName), csvText(row.Ip))
+	}
+	return record
+}
+
+func IsValidLogExportFormat(format string) bool {
+	return format == LogExportFormatCSV || format == LogExportFormatJSONL
+}
+
+func LogExportContentType(format string) string {
+	if format == LogExportFormatJSONL {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// WriteLogExport 按筛选条件将日志逐批写入 w，flush 在每批写完后调用，用于 HTTP 流式响应。返回导出的行数
+func WriteLogExport(w io.Writer, format string, filter model.LogExportFilter, admin bool, flush func()) (int, error) {
+	if !IsValidLogExportFormat(format) {
+		return 0, fmt.Errorf("不支持的导出格式: %s", format)
+	}
+	rows := 0
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == LogExportFormatCSV {
+		csvWriter = csv.NewWriter(w)
+		header := logExportUserHeader
+		if admin {
+			header = logExportAdminHeader
+		}
+		if err := csvWriter.Write(header); err != nil {
+			return 0, err
+		}
+	} else {
+		encoder = json.NewEncoder(w)
+	}
+	err := model.StreamLogs(filter, admin, func(logs []*model.Log) error {
+		for _, log := range logs {
+			row := newLogExportRow(log, admin)
+			if csvWriter != nil {
+				if err := csvWriter.Write(row.csvRecord(admin)); err != nil {
+					return err
+				}
+			} else if err := encoder.Encode(row); err != nil {
+				return err
+			}
+			rows++
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		if flush != nil {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return rows, csvWriter.Error()
+	}
+	return rows, nil
+}
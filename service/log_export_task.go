@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	logExportTickInterval = 1 * time.Minute
+	// 日志为异步写入，导出窗口的结束时间向前留出余量，避免漏掉尚未落库的日志
+	logExportLag = 1 * time.Minute
+	// 首次导出时回溯的时间范围
+	logExportInitialWindow   = 24 * time.Hour
+	logExportUnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+var (
+	logExportOnce    sync.Once
+	logExportRunning atomic.Bool
+	logExportLastRun atomic.Int64 // 上次触发所在的分钟，防止同一分钟重复触发
+)
+
+func StartLogExportTask() {
+	logExportOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("log export task started: tick=%s", logExportTickInterval))
+			ticker := time.NewTicker(logExportTickInterval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				runLogExportTick(now)
+			}
+		})
+	})
+}
+
+func runLogExportTick(now time.Time) {
+	setting := system_setting.GetLogExportSetting()
+	if !setting.Enabled {
+		return
+	}
+	schedule, err := common.ParseCron(setting.Cron)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("log export cron is invalid: %v", err))
+		return
+	}
+	minute := now.Truncate(time.Minute).Unix()
+	if !schedule.Matches(now) || logExportLastRun.Swap(minute) == minute {
+		return
+	}
+	if _, err := RunScheduledLogExport(context.Background()); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("scheduled log export failed: %v", err))
+	}
+}
+
+// RunScheduledLogExport 导出上次成功导出之后产生的消费日志并写入配置的目标，记录执行结果
+func RunScheduledLogExport(ctx context.Context) (*model.LogExportRun, error) {
+	if !logExportRunning.CompareAndSwap(false, true) {
+		return nil, errors.New("log export is already running")
+	}
+	defer logExportRunning.Store(false)
+
+	setting := *system_setting.GetLogExportSetting()
+	format := setting.Format
+	if !IsValidLogExportFormat(format) {
+		format = LogExportFormatCSV
+	}
+	end := time.Now().Add(-logExportLag).Unix()
+	start := end - int64(logExportInitialWindow.Seconds())
+	last, err := model.GetLastSuccessfulLogExportRun()
+	if err != nil {
+		return nil, err
+	}
+	if last != nil {
+		start = last.EndTimestamp + 1
+	}
+	if start > end {
+		return nil, errors.New("no new logs to export")
+	}
+	run := &model.LogExportRun{
+		StartTimestamp: start,
+		EndTimestamp:   end,
+		Format:         format,
+		Target:         setting.Target,
+	}
+
+	rows, location, err := exportLogsToTarget(ctx, &setting, format, start, end)
+	run.Rows = rows
+	run.Location = location
+	run.Status = model.LogExportRunStatusSuccess
+	if err != nil {
+		run.Status = model.LogExportRunStatusFailed
+		run.Error = err.Error()
+	}
+	if insertErr := run.Insert(); insertErr != nil {
+		common.SysError("failed to record log export run: " + insertErr.Error())
+	}
+	if err != nil {
+		return run, err
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("log export finished: rows=%d, location=%s", rows, location))
+	return run, nil
+}
+
+func exportLogsToTarget(ctx context.Context, setting *system_setting.LogExportSetting, format string, start int64, end int64) (int, string, error) {
+	tmp, err := os.CreateTemp("", "log-export-*."+format)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	filter := model.LogExportFilter{
+		LogType:        model.LogTypeConsume,
+		StartTimestamp: start,
+		EndTimestamp:   end,
+	}
+	rows, err := WriteLogExport(tmp, format, filter, true, nil)
+	if err != nil {
+		return rows, "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return rows, "", err
+	}
+
+	name := fmt.Sprintf("logs-%s-%s.%s",
+		time.Unix(start, 0).Format("20060102150405"), time.Unix(end, 0).Format("20060102150405"), format)
+	switch setting.Target {
+	case system_setting.LogExportTargetS3:
+		location, err := uploadLogExportToS3(ctx, setting, path.Join(setting.S3Prefix, name), tmp, format)
+		return rows, location, err
+	case system_setting.LogExportTargetLocal, "":
+		location, err := saveLogExportToLocal(setting.LocalDir, name, tmp)
+		return rows, location, err
+	default:
+		return rows, "", fmt.Errorf("不支持的导出目标: %s", setting.Target)
+	}
+}
+
+func saveLogExportToLocal(dir string, name string, src io.Reader) (string, error) {
+	if dir == "" {
+		return "", errors.New("未配置本地导出目录")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, name)
+	dst, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return "", err
+	}
+	return target, dst.Close()
+}
+
+// uploadLogExportToS3 使用 SigV4 签名的 PUT 请求上传到 S3 兼容存储
+func uploadLogExportToS3(ctx context.Context, setting *system_setting.LogExportSetting, key string, file *os.File, format string) (string, error) {
+	if setting.S3Endpoint == "" || setting.S3Bucket == "" || setting.S3AccessKeyId == "" || setting.S3Secret == "" {
+		return "", errors.New("S3 导出配置不完整")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(setting.S3Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return "", fmt.Errorf("无效的 S3 endpoint: %s", setting.S3Endpoint)
+	}
+	key = strings.TrimLeft(key, "/")
+	objectURL := *endpoint
+	if setting.S3PathStyle {
+		objectURL.Path = endpoint.Path + "/" + setting.S3Bucket + "/" + key
+	} else {
+		objectURL.Host = setting.S3Bucket + "." + endpoint.Host
+		objectURL.Path = endpoint.Path + "/" + key
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), file)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", LogExportContentType(format))
+	req.Header.Set("X-Amz-Content-Sha256", logExportUnsignedPayload)
+	credentials := aws.Credentials{AccessKeyID: setting.S3AccessKeyId, SecretAccessKey: setting.S3Secret}
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, logExportUnsignedPayload, "s3", setting.S3Region, time.Now()); err != nil {
+		return "", err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("S3 上传失败: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+	return fmt.Sprintf("s3://%s/%s", setting.S3Bucket, key), nil
+}
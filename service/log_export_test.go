@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"gorm.io/gorm"
+)
+
+// createTestExportLogs 清空日志相关表并写入一条包含需要转义字段的消费日志和一条充值日志
+func createTestExportLogs(t *testing.T) []*model.Log {
+	t.Helper()
+	for _, m := range []any{&model.Log{}, &model.Channel{}, &model.LogExportRun{}} {
+		if err := model.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(m).Error; err != nil {
+			t.Fatalf("failed to reset table: %v", err)
+		}
+	}
+	channel := &model.Channel{Name: "=HYPERLINK(\"x\")", Key: "sk-test"}
+	if err := model.DB.Create(channel).Error; err != nil {
+		t.Fatalf("failed to create channel: %v", err)
+	}
+	logs := []*model.Log{
+		{
+			UserId: 1, Username: `alice,"a"`, Type: model.LogTypeConsume, CreatedAt: common.GetTimestamp() - 3600,
+			TokenName: "line1\nline2", ModelName: "gpt-4o", Group: "default", Quota: int(common.QuotaPerUnit) / 2,
+			PromptTokens: 10, CompletionTokens: 20, ChannelId: channel.Id, Ip: "127.0.0.1", RequestId: "req-1",
+			IsStream: true, UseTime: 3,
+			Other: `{"cache_tokens":4,"reasoning_tokens":5,"model_ratio":2.5,"group_ratio":1,"user_group_ratio":0.8,"billing_source":"subscription"}`,
+		},
+		{UserId: 1, Username: "alice", Type: model.LogTypeTopup, CreatedAt: common.GetTimestamp() - 3600, TokenName: "-1+1"},
+	}
+	for _, log := range logs {
+		if err := model.LOG_DB.Create(log).Error; err != nil {
+			t.Fatalf("failed to create log: %v", err)
+		}
+	}
+	return logs
+}
+
+func readTestCSV(t *testing.T, data []byte) []map[string]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, value := range record {
+			row[records[0][i]] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestWriteLogExportCSV(t *testing.T) {
+	logs := createTestExportLogs(t)
+
+	var buf bytes.Buffer
+	flushes := 0
+	rows, err := WriteLogExport(&buf, LogExportFormatCSV, model.LogExportFilter{}, false, func() { flushes++ })
+	if err != nil || rows != 2 || flushes != 1 {
+		t.Fatalf("WriteLogExport = %d, %v, flushes=%d", rows, err, flushes)
+	}
+	header, _ := csv.NewReader(bytes.NewReader(buf.Bytes())).Read()
+	if strings.Join(header, ",") != strings.Join(logExportUserHeader, ",") {
+		t.Fatalf("unexpected user header %v", header)
+	}
+	records := readTestCSV(t, buf.Bytes())
+	row := records[0]
+	// 逗号、引号与换行经 CSV 转义后可原样读回
+	if row["username"] != logs[0].Username || row["token_name"] != logs[0].TokenName {
+		t.Fatalf("unexpected escaped fields %q %q", row["username"], row["token_name"])
+	}
+	want := map[string]string{
+		"cost":             "0.500000",
+		"cache_tokens":     "4",
+		"reasoning_tokens": "5",
+		"model_ratio":      "2.5",
+		"group_ratio":      "0.8",
+		"billing_source":   "subscription",
+		"is_stream":        "true",
+		"request_id":       "req-1",
+	}
+	for key, value := range want {
+		if row[key] != value {
+			t.Errorf("%s = %q, want %q", key, row[key], value)
+		}
+	}
+	// 可能被当作公式的文本加单引号前缀
+	if records[1]["token_name"] != "'-1+1" {
+		t.Fatalf("expected formula-like cell to be prefixed, got %q", records[1]["token_name"])
+	}
+	if _, ok := row["channel_name"]; ok {
+		t.Fatal("user export should not include channel columns")
+	}
+
+	buf.Reset()
+	if _, err := WriteLogExport(&buf, LogExportFormatCSV, model.LogExportFilter{LogType: model.LogTypeConsume}, true, nil); err != nil {
+		t.Fatalf("WriteLogExport admin: %v", err)
+	}
+	records = readTestCSV(t, buf.Bytes())
+	if len(records) != 1 || records[0]["channel_name"] != `'=HYPERLINK("x")` || records[0]["ip"] != "127.0.0.1" {
+		t.Fatalf("unexpected admin rows %v", records)
+	}
+}
+
+func TestWriteLogExportJSONL(t *testing.T) {
+	logs := createTestExportLogs(t)
+
+	var buf bytes.Buffer
+	rows, err := WriteLogExport(&buf, LogExportFormatJSONL, model.LogExportFilter{LogType: model.LogTypeConsume}, false, nil)
+	if err != nil || rows != 1 {
+		t.Fatalf("WriteLogExport = %d, %v", rows, err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &raw); err != nil {
+		t.Fatalf("failed to parse jsonl: %v", err)
+	}
+	// JSONL 保留原始文本，不做公式前缀处理
+	if raw["username"] != logs[0].Username || raw["token_name"] != logs[0].TokenName || raw["cost"] != 0.5 {
+		t.Fatalf("unexpected jsonl row %v", raw)
+	}
+	for _, key := range []string{"channel_id", "channel_name", "ip"} {
+		if _, ok := raw[key]; ok {
+			t.Fatalf("user export should not include %s", key)
+		}
+	}
+
+	buf.Reset()
+	if rows, err := WriteLogExport(&buf, LogExportFormatJSONL, model.LogExportFilter{}, true, nil); err != nil || rows != 2 {
+		t.Fatalf("WriteLogExport admin = %d, %v", rows, err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var row LogExportRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("failed to parse jsonl line: %v", err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 jsonl lines, got %d", lines)
+	}
+
+	if _, err := WriteLogExport(&buf, "xlsx", model.LogExportFilter{}, true, nil); err == nil {
+		t.Fatal("expected unsupported format to be rejected")
+	}
+}
+
+func TestExportLogsToLocal(t *testing.T) {
+	logs := createTestExportLogs(t)
+	setting := &system_setting.LogExportSetting{Target: system_setting.LogExportTargetLocal, LocalDir: filepath.Join(t.TempDir(), "exports")}
+
+	// 定时导出只导出窗口内的消费日志
+	rows, location, err := exportLogsToTarget(context.Background(), setting, LogExportFormatCSV, logs[0].CreatedAt, logs[0].CreatedAt)
+	if err != nil || rows != 1 {
+		t.Fatalf("exportLogsToTarget = %d, %v", rows, err)
+	}
+	if filepath.Dir(location) != setting.LocalDir || !strings.HasSuffix(location, ".csv") {
+		t.Fatalf("unexpected location %s", location)
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		t.Fatalf("failed to read export: %v", err)
+	}
+	if records := readTestCSV(t, data); len(records) != 1 || records[0]["channel_name"] == "" {
+		t.Fatalf("unexpected exported rows %v", records)
+	}
+
+	if _, _, err := exportLogsToTarget(context.Background(), &system_setting.LogExportSetting{Target: system_setting.LogExportTargetLocal}, LogExportFormatCSV, 0, 0); err == nil {
+		t.Fatal("expected missing local dir to fail")
+	}
+	if _, _, err := exportLogsToTarget(context.Background(), &system_setting.LogExportSetting{Target: "ftp"}, LogExportFormatCSV, 0, 0); err == nil {
+		t.Fatal("expected unsupported target to fail")
+	}
+}
+
+func TestExportLogsToS3(t *testing.T) {
+	logs := createTestExportLogs(t)
+	if GetHttpClient() == nil {
+		InitHttpClient()
+	}
+	var gotPath, gotAuth, gotContentType string
+	var gotBody []byte
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotContentType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("denied"))
+	}))
+	defer server.Close()
+
+	setting := &system_setting.LogExportSetting{
+		Target:        system_setting.LogExportTargetS3,
+		S3Endpoint:    server.URL + "/",
+		S3Region:      "us-east-1",
+		S3Bucket:      "bucket",
+		S3Prefix:      "uniapi/logs",
+		S3AccessKeyId: "AKID",
+		S3Secret:      "secret",
+		S3PathStyle:   true,
+	}
+	rows, location, err := exportLogsToTarget(context.Background(), setting, LogExportFormatJSONL, logs[0].CreatedAt, logs[0].CreatedAt)
+	if err != nil || rows != 1 {
+		t.Fatalf("exportLogsToTarget = %d, %v", rows, err)
+	}
+	if !strings.HasPrefix(gotPath, "/bucket/uniapi/logs/logs-") || !strings.HasSuffix(gotPath, ".jsonl") {
+		t.Fatalf("unexpected object path %s", gotPath)
+	}
+	if location != "s3://bucket/"+strings.TrimPrefix(gotPath, "/bucket/") {
+		t.Fatalf("unexpected location %s for path %s", location, gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") || gotContentType != "application/x-ndjson" {
+		t.Fatalf("unexpected request headers auth=%q content-type=%q", gotAuth, gotContentType)
+	}
+	var row LogExportRow
+	if err := json.Unmarshal(bytes.TrimSpace(gotBody), &row); err != nil || row.RequestId != "req-1" {
+		t.Fatalf("unexpected uploaded body %s: %v", gotBody, err)
+	}
+
+	status = http.StatusForbidden
+	if _, _, err := exportLogsToTarget(context.Background(), setting, LogExportFormatJSONL, 0, 0); err == nil || !strings.Contains(err.Error(), "status=403") {
+		t.Fatalf("expected upload failure, got %v", err)
+	}
+	incomplete := *setting
+	incomplete.S3Secret = ""
+	if _, _, err := exportLogsToTarget(context.Background(), &incomplete, LogExportFormatJSONL, 0, 0); err == nil {
+		t.Fatal("expected incomplete S3 setting to fail")
+	}
+}
+
+func TestRunScheduledLogExport(t *testing.T) {
+	createTestExportLogs(t)
+	setting := system_setting.GetLogExportSetting()
+	old := *setting
+	t.Cleanup(func() { *setting = old })
+	setting.Target = system_setting.LogExportTargetLocal
+	setting.LocalDir = t.TempDir()
+	setting.Format = "unknown"
+
+	run, err := RunScheduledLogExport(context.Background())
+	if err != nil {
+		t.Fatalf("RunScheduledLogExport: %v", err)
+	}
+	// 无效格式回退为 CSV，首次导出回溯 24 小时
+	if run.Status != model.LogExportRunStatusSuccess || run.Format != LogExportFormatCSV || run.Rows != 1 {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if run.EndTimestamp-run.StartTimestamp != int64(logExportInitialWindow.Seconds()) {
+		t.Fatalf("unexpected first window %d-%d", run.StartTimestamp, run.EndTimestamp)
+	}
+	last, err := model.GetLastSuccessfulLogExportRun()
+	if err != nil || last == nil || last.Id != run.Id || last.Location != run.Location {
+		t.Fatalf("unexpected last run %+v, %v", last, err)
+	}
+
+	// 上次成功导出之后没有新的时间窗口时不执行
+	if again, err := RunScheduledLogExport(context.Background()); err == nil || again != nil {
+		t.Fatalf("expected no new logs, got %+v, %v", again, err)
+	}
+
+	// 导出失败时记录失败结果，窗口从最近一次成功导出之后开始
+	lastEnd := run.EndTimestamp - 3600
+	if err := model.DB.Model(run).Update("end_timestamp", lastEnd).Error; err != nil {
+		t.Fatalf("failed to move last run: %v", err)
+	}
+	setting.LocalDir = ""
+	failed, err := RunScheduledLogExport(context.Background())
+	if err == nil || failed == nil || failed.Status != model.LogExportRunStatusFailed || failed.Error == "" {
+		t.Fatalf("expected failed run, got %+v, %v", failed, err)
+	}
+	if failed.StartTimestamp != lastEnd+1 {
+		t.Fatalf("expected window to start at %d, got %d", lastEnd+1, failed.StartTimestamp)
+	}
+	if last, _ := model.GetLastSuccessfulLogExportRun(); last == nil || last.Id != run.Id {
+		t.Fatalf("failed run should not replace the last successful run, got %+v", last)
+	}
+}
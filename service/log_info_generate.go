@@ -72,11 +72,39 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
+	appendDLPInfo(ctx, other)
+	appendPromptGuardInfo(ctx, other)
+	appendContentFilterInfo(ctx, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
 	return other
 }
 
+// appendDLPInfo 记录 DLP 策略与各检测器命中次数，不记录命中的原文
+func appendDLPInfo(ctx *gin.Context, other map[string]interface{}) {
+	action := common.GetContextKeyString(ctx, constant.ContextKeyDLPAction)
+	if action == "" {
+		return
+	}
+	findings, _ := common.GetContextKey(ctx, constant.ContextKeyDLPFindings)
+	other["dlp"] = map[string]interface{}{
+		"action":   action,
+		"findings": findings,
+	}
+}
+
+func appendPromptGuardInfo(ctx *gin.Context, other map[string]interface{}) {
+	if result, ok := common.GetContextKeyType[*PromptGuardResult](ctx, constant.ContextKeyPromptGuardResult); ok && result != nil {
+		other["prompt_guard"] = result
+	}
+}
+
+func appendContentFilterInfo(ctx *gin.Context, other map[string]interface{}) {
+	if result := getContentFilterResult(ctx); result != nil {
+		other["content_filter"] = result
+	}
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -105,6 +133,14 @@ func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interf
 		if relayInfo.SubscriptionPlanTitle != "" {
 			other["subscription_plan_title"] = relayInfo.SubscriptionPlanTitle
 		}
+		// 命中模型额度时不占用订阅总额度，只记录额度用量
+		if relayInfo.SubscriptionAllowanceModel != "" {
+			other["subscription_allowance_model"] = relayInfo.SubscriptionAllowanceModel
+			other["subscription_allowance_metric"] = relayInfo.SubscriptionAllowanceMetric
+			other["subscription_allowance_consumed"] = relayInfo.SubscriptionAllowanceConsumed
+			other["wallet_quota_deducted"] = 0
+			return
+		}
 		// Compute "this request" subscription consumed + remaining
 		consumed := relayInfo.SubscriptionPreConsumed + relayInfo.SubscriptionPostDelta
 		usedFinal := relayInfo.SubscriptionAmountUsedAfterPreConsume + relayInfo.SubscriptionPostDelta
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用临时 SQLite 数据库运行 service 包中依赖数据库的测试
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	dir, err := os.MkdirTemp("", "uniapi-service-test")
+	if err != nil {
+		fmt.Println("failed to create test directory: " + err.Error())
+		os.Exit(1)
+	}
+	dsn := filepath.Join(dir, "test.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	model.DB = db
+	model.LOG_DB = db
+	if err = db.AutoMigrate(&model.User{}, &model.Log{}, &model.QuotaLedger{}, &model.Token{},
+		&model.Organization{}, &model.Project{}, &model.UserSubscription{}, &model.Channel{}, &model.LogExportRun{}); err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/Zer0Echo/uniapi/dto"
 	relayconstant "github.com/Zer0Echo/uniapi/relay/constant"
 	"github.com/Zer0Echo/uniapi/setting"
+	"github.com/Zer0Echo/uniapi/types"
 
 	"github.com/gin-gonic/gin"
 )
@@ -127,6 +129,15 @@ func CoverPlusActionToNormalAction(midjRequest *dto.MidjourneyRequest) *dto.Midj
 	} else if action == "Inpaint" {
 		midjRequest.Action = constant.MjActionInPaint
 		midjRequest.Index = 1
+	} else if strings.HasPrefix(action, "animate") {
+		// "MJ::JOB::animate_high::1::<hash>::SOLO"，由图片按钮生成视频
+		midjRequest.Action = constant.MjActionVideo
+		midjRequest.Index = 1
+		if len(splits) > 3 {
+			if index, err := strconv.Atoi(splits[3]); err == nil {
+				midjRequest.Index = index
+			}
+		}
 	} else {
 		return MidjourneyErrorWrapper(constant.MjRequestError, "unknown_action:"+customId)
 	}
@@ -180,6 +191,9 @@ func DoMidjourneyHttpRequest(c *gin.Context, timeout time.Duration, fullRequestU
 		if !setting.MjNotifyEnabled {
 			delete(mapResult, "notifyHook")
 		}
+		if err := normalizeMjImageInputs(c, mapResult); err != nil {
+			return MidjourneyErrorWithStatusCodeWrapper(constant.MjRequestError, "load_image_failed: "+err.Error(), http.StatusBadRequest), nullBytes, err
+		}
 		//req, err := http.NewRequest(c.Request.Method, fullRequestURL, requestBody)
 		// make new request with mapResult
 	}
@@ -246,6 +260,12 @@ func DoMidjourneyHttpRequest(c *gin.Context, timeout time.Duration, fullRequestU
 			if err2 != nil {
 				return MidjourneyErrorWithStatusCodeWrapper(constant.MjErrorUnknown, "unmarshal_response_body_failed", statusCode), responseBody, err
 			}
+			// 上传接口返回图片链接数组，转换为统一结构以便计费与记录
+			midjResponse = dto.MidjourneyResponse{
+				Code:        midjourneyUploadsResponse.Code,
+				Description: midjourneyUploadsResponse.Description,
+				Properties:  midjourneyUploadsResponse.Result,
+			}
 		}
 	}
 	//log.Printf("midjResponse: %v", midjResponse)
@@ -257,3 +277,45 @@ func DoMidjourneyHttpRequest(c *gin.Context, timeout time.Duration, fullRequestU
 		Response:   midjResponse,
 	}, responseBody, nil
 }
+
+// mjImageFields 需要以 base64 提交给 MJ Proxy 的图片字段
+var mjImageFields = []string{"base64", "sourceBase64", "targetBase64", "maskBase64"}
+
+// normalizeMjImageInputs 将请求中以 URL 形式提供的图片通过文件服务下载并转换为 data URI
+func normalizeMjImageInputs(c *gin.Context, mapResult map[string]interface{}) error {
+	convert := func(value string) (string, error) {
+		if !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+			return value, nil
+		}
+		base64Data, mimeType, err := GetBase64Data(c, types.NewURLFileSource(value), "midjourney")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("data:%s;base64,%s", mimeType, base64Data), nil
+	}
+	for _, field := range mjImageFields {
+		value, ok := mapResult[field].(string)
+		if !ok || value == "" {
+			continue
+		}
+		converted, err := convert(value)
+		if err != nil {
+			return err
+		}
+		mapResult[field] = converted
+	}
+	if images, ok := mapResult["base64Array"].([]interface{}); ok {
+		for i, image := range images {
+			value, ok := image.(string)
+			if !ok || value == "" {
+				continue
+			}
+			converted, err := convert(value)
+			if err != nil {
+				return err
+			}
+			images[i] = converted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/gin-gonic/gin"
+)
+
+// 最小的 1x1 PNG
+var testPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg==")
+
+func TestNormalizeMjImageInputs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(testPNG)
+	}))
+	defer server.Close()
+
+	fetchSetting := system_setting.GetFetchSetting()
+	oldProtection := fetchSetting.EnableSSRFProtection
+	fetchSetting.EnableSSRFProtection = false
+	t.Cleanup(func() { fetchSetting.EnableSSRFProtection = oldProtection })
+	if GetHttpClient() == nil {
+		InitHttpClient()
+	}
+	if constant.MaxFileDownloadMB == 0 {
+		constant.MaxFileDownloadMB = 64
+		t.Cleanup(func() { constant.MaxFileDownloadMB = 0 })
+	}
+
+	imageURL := server.URL + "/image.png"
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	mapResult := map[string]interface{}{
+		"prompt":       "a cat",
+		"base64":       imageURL,
+		"sourceBase64": "data:image/png;base64,AAAA",
+		"maskBase64":   "",
+		"targetBase64": 1,
+		"base64Array":  []interface{}{imageURL, "data:image/jpeg;base64,BBBB", 2},
+	}
+	if err := normalizeMjImageInputs(c, mapResult); err != nil {
+		t.Fatalf("normalizeMjImageInputs: %v", err)
+	}
+
+	if mapResult["base64"] != dataURI {
+		t.Fatalf("expected url to be converted, got %v", mapResult["base64"])
+	}
+	if mapResult["sourceBase64"] != "data:image/png;base64,AAAA" || mapResult["maskBase64"] != "" || mapResult["targetBase64"] != 1 {
+		t.Fatalf("expected non-url fields to be unchanged, got %v", mapResult)
+	}
+	if mapResult["prompt"] != "a cat" {
+		t.Fatalf("expected unrelated fields to be unchanged, got %v", mapResult["prompt"])
+	}
+	images := mapResult["base64Array"].([]interface{})
+	if images[0] != dataURI || images[1] != "data:image/jpeg;base64,BBBB" || images[2] != 2 {
+		t.Fatalf("unexpected base64Array %v", images)
+	}
+
+	failed := map[string]interface{}{"base64": server.URL + "/missing.png"}
+	if err := normalizeMjImageInputs(c, failed); err == nil {
+		t.Fatal("expected download failure to be returned")
+	}
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptGuardEngine 提示词注入检测引擎，Evaluate 返回 0~1 的可疑分数
+type PromptGuardEngine interface {
+	Name() string
+	Evaluate(c *gin.Context, group string, texts []string) (score float64, reason string, err error)
+}
+
+var (
+	promptGuardEngines   = map[string]PromptGuardEngine{}
+	promptGuardEnginesMu sync.RWMutex
+)
+
+// RegisterPromptGuardEngine 注册检测引擎，同名引擎会被覆盖
+func RegisterPromptGuardEngine(engine PromptGuardEngine) {
+	promptGuardEnginesMu.Lock()
+	defer promptGuardEnginesMu.Unlock()
+	promptGuardEngines[engine.Name()] = engine
+}
+
+func getPromptGuardEngine(name string) (PromptGuardEngine, bool) {
+	promptGuardEnginesMu.RLock()
+	defer promptGuardEnginesMu.RUnlock()
+	engine, ok := promptGuardEngines[name]
+	return engine, ok
+}
+
+func init() {
+	RegisterPromptGuardEngine(heuristicPromptGuard{})
+}
+
+// PromptGuardResult 检测结果，记录在消费日志的 other.prompt_guard 中
+type PromptGuardResult struct {
+	Engine      string  `json:"engine"`
+	Action      string  `json:"action"`
+	Score       float64 `json:"score"`
+	Threshold   float64 `json:"threshold"`
+	Flagged     bool    `json:"flagged"`
+	Reason      string  `json:"reason,omitempty"`
+	RoutedGroup string  `json:"routed_group,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// RunPromptGuard 按使用分组的策略检测请求中的用户与工具内容，未启用或没有可检测内容时返回 nil
+func RunPromptGuard(c *gin.Context, group string, request dto.Request) *PromptGuardResult {
+	policy, ok := operation_setting.GetPromptGuardPolicy(group)
+	if !ok {
+		return nil
+	}
+	texts := collectPromptGuardTexts(request)
+	if len(texts) == 0 {
+		return nil
+	}
+	result := &PromptGuardResult{
+		Engine:    policy.Engine,
+		Action:    policy.Action,
+		Threshold: policy.Threshold,
+	}
+	engine, ok := getPromptGuardEngine(policy.Engine)
+	if !ok {
+		result.Error = fmt.Sprintf("unknown prompt guard engine: %s", policy.Engine)
+		common.SetContextKey(c, constant.ContextKeyPromptGuardResult, result)
+		return result
+	}
+	score, reason, err := engine.Evaluate(c, group, truncatePromptGuardTexts(texts))
+	if err != nil {
+		result.Error = err.Error()
+		if !operation_setting.GetPromptGuardSetting().ClassifierFailOpen {
+			score = 1
+		}
+	}
+	result.Score = math.Round(score*1000) / 1000
+	result.Reason = reason
+	result.Flagged = score >= policy.Threshold
+	common.SetContextKey(c, constant.ContextKeyPromptGuardResult, result)
+	return result
+}
+
+func truncatePromptGuardTexts(texts []string) []string {
+	maxChars := operation_setting.GetPromptGuardSetting().MaxInputChars
+	if maxChars <= 0 {
+		return texts
+	}
+	truncated := make([]string, 0, len(texts))
+	remaining := maxChars
+	// 注入内容通常出现在最新的消息中，从后往前保留
+	for i := len(texts) - 1; i >= 0 && remaining > 0; i-- {
+		runes := []rune(texts[i])
+		if len(runes) > remaining {
+			runes = runes[len(runes)-remaining:]
+		}
+		remaining -= len(runes)
+		truncated = append([]string{string(runes)}, truncated...)
+	}
+	return truncated
+}
+
+// collectPromptGuardTexts 收集用户与工具角色的文本，不包含系统提示词与助手回复
+func collectPromptGuardTexts(request dto.Request) []string {
+	var texts []string
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		texts = collectPromptGuardValue(r.Prompt, texts)
+		for _, message := range r.Messages {
+			if message.Role == "user" || message.Role == "tool" || message.Role == "function" {
+				for _, content := range message.ParseContent() {
+					if content.Type == dto.ContentTypeText && content.Text != "" {
+						texts = append(texts, content.Text)
+					}
+				}
+			}
+		}
+	case *dto.ClaudeRequest:
+		if r.Prompt != "" {
+			texts = append(texts, r.Prompt)
+		}
+		for _, message := range r.Messages {
+			if message.Role == "user" {
+				texts = collectPromptGuardValue(message.Content, texts)
+			}
+		}
+	case *dto.GeminiChatRequest:
+		for _, content := range r.Contents {
+			if content.Role == "" || content.Role == "user" {
+				for _, part := range content.Parts {
+					if part.Text != "" {
+						texts = append(texts, part.Text)
+					}
+				}
+			}
+		}
+	case *dto.OpenAIResponsesRequest:
+		var input any
+		if len(r.Input) > 0 && common.Unmarshal(r.Input, &input) == nil {
+			switch v := input.(type) {
+			case string:
+				texts = append(texts, v)
+			case []any:
+				for _, item := range v {
+					itemMap, ok := item.(map[string]any)
+					if !ok {
+						continue
+					}
+					role, _ := itemMap["role"].(string)
+					itemType, _ := itemMap["type"].(string)
+					if role == "user" || itemType == "function_call_output" {
+						texts = collectPromptGuardValue(itemMap, texts)
+					}
+				}
+			}
+		}
+	}
+	return texts
+}
+
+func collectPromptGuardValue(value any, texts []string) []string {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			texts = append(texts, v)
+		}
+	case []any:
+		for _, item := range v {
+			texts = collectPromptGuardValue(item, texts)
+		}
+	case map[string]any:
+		for _, key := range []string{"text", "content", "output"} {
+			if item, ok := v[key]; ok {
+				texts = collectPromptGuardValue(item, texts)
+			}
+		}
+	}
+	return texts
+}
+
+type promptGuardRule struct {
+	regex  *regexp.Regexp
+	weight float64
+	name   string
+}
+
+var builtinPromptGuardRules = []promptGuardRule{
+	{regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,40}\b(previous|prior|above|earlier|all|system|your)\b.{0,20}\b(instructions?|prompts?|rules|directives|guidelines)`), 0.6, "override_instructions"},
+	{regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output|leak)\b.{0,40}\b(system prompt|system message|initial instructions|hidden instructions)`), 0.5, "reveal_system_prompt"},
+	{regexp.MustCompile(`(?i)\b(do anything now|DAN mode|developer mode|jailbreak|jailbroken|god mode)\b`), 0.45, "jailbreak_persona"},
+	{regexp.MustCompile(`(?i)\b(without|no|ignore)\b.{0,20}\b(restrictions|filters|censorship|safety guidelines|content policy)\b`), 0.35, "disable_safety"},
+	{regexp.MustCompile(`(?i)\b(you are now|from now on you|pretend (to be|you are)|act as if you)\b`), 0.2, "role_play"},
+	{regexp.MustCompile(`(?i)(<\|im_start\|>|<\|im_end\|>|<\|system\|>|\[/?INST\]|</?system>|^\s*system\s*:)`), 0.5, "special_tokens"},
+	{regexp.MustCompile(`(忽略|无视|忘记|忘掉).{0,10}(之前|以上|前面|先前|所有|系统).{0,6}(指令|指示|提示|规则|设定)`), 0.6, "override_instructions_zh"},
+	{regexp.MustCompile(`(输出|告诉我|显示|重复|泄露).{0,10}(系统提示词|系统提示|系统指令|初始指令)`), 0.5, "reveal_system_prompt_zh"},
+	{regexp.MustCompile(`(开发者模式|越狱|不受任何限制|没有任何限制|解除.{0,4}限制)`), 0.4, "jailbreak_zh"},
+}
+
+var promptGuardCustomRuleCache sync.Map // pattern -> *regexp.Regexp，编译失败时为 nil
+
+func getPromptGuardRules() []promptGuardRule {
+	rules := builtinPromptGuardRules
+	custom := operation_setting.GetPromptGuardSetting().HeuristicRules
+	if len(custom) == 0 {
+		return rules
+	}
+	rules = append([]promptGuardRule{}, rules...)
+	for _, rule := range custom {
+		if rule.Pattern == "" || rule.Weight <= 0 {
+			continue
+		}
+		var re *regexp.Regexp
+		if cached, ok := promptGuardCustomRuleCache.Load(rule.Pattern); ok {
+			re = cached.(*regexp.Regexp)
+		} else {
+			compiled, err := regexp.Compile("(?i)" + rule.Pattern)
+			if err != nil {
+				common.SysError("invalid prompt guard rule " + rule.Pattern + ": " + err.Error())
+			} else {
+				re = compiled
+			}
+			promptGuardCustomRuleCache.Store(rule.Pattern, re)
+		}
+		if re != nil {
+			rules = append(rules, promptGuardRule{regex: re, weight: math.Min(rule.Weight, 1), name: "custom"})
+		}
+	}
+	return rules
+}
+
+// heuristicPromptGuard 本地规则引擎，命中规则的分数按 1-Π(1-w) 叠加
+type heuristicPromptGuard struct{}
+
+func (heuristicPromptGuard) Name() string {
+	return operation_setting.PromptGuardEngineHeuristic
+}
+
+func (heuristicPromptGuard) Evaluate(c *gin.Context, group string, texts []string) (float64, string, error) {
+	remaining := 1.0
+	var matched []string
+	for _, rule := range getPromptGuardRules() {
+		for _, text := range texts {
+			if rule.regex.MatchString(text) {
+				remaining *= 1 - rule.weight
+				matched = append(matched, rule.name)
+				break
+			}
+		}
+	}
+	return 1 - remaining, strings.Join(matched, ","), nil
+}
+
+// ParsePromptGuardClassifierOutput 解析分类模型的输出，支持 {"score":..,"reason":..} 或单个数字
+func ParsePromptGuardClassifierOutput(output string) (float64, string, error) {
+	output = strings.TrimSpace(output)
+	if start, end := strings.Index(output, "{"), strings.LastIndex(output, "}"); start >= 0 && end > start {
+		var verdict struct {
+			Score  json.Number `json:"score"`
+			Reason string      `json:"reason"`
+		}
+		if err := common.Unmarshal([]byte(output[start:end+1]), &verdict); err == nil {
+			if score, err := verdict.Score.Float64(); err == nil {
+				return math.Max(0, math.Min(score, 1)), fmt.Sprintf("%.200s", verdict.Reason), nil
+			}
+		}
+	}
+	var score float64
+	if _, err := fmt.Sscanf(output, "%g", &score); err == nil {
+		return math.Max(0, math.Min(score, 1)), "", nil
+	}
+	return 0, "", fmt.Errorf("unexpected classifier output: %.200s", output)
+}
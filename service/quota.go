@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"strings"
 	"time"
 
 	"github.com/Zer0Echo/uniapi/common"
@@ -90,12 +89,12 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, err := GetPayerQuota(relayInfo)
 	if err != nil {
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
+	token, err := model.GetTokenByKeyHash(relayInfo.TokenKey, false)
 	if err != nil {
 		return err
 	}
@@ -211,6 +210,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordChannelKeyConsume(relayInfo, totalTokens, quota)
 	}
 
 	logModel := modelName
@@ -305,8 +305,10 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordChannelKeyConsume(relayInfo, totalTokens, quota)
 	}
 
+	relayInfo.UsageTotalTokens = totalTokens
 	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
@@ -411,8 +413,10 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 	} else {
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		RecordChannelKeyConsume(relayInfo, totalTokens, quota)
 	}
 
+	relayInfo.UsageTotalTokens = totalTokens
 	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
@@ -449,7 +453,7 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := model.GetTokenByKeyHash(relayInfo.TokenKey, false)
 	if err != nil {
 		return err
 	}
@@ -465,28 +469,39 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
-	// 1) Consume from wallet quota OR subscription item
+	// 1) Consume from wallet quota OR subscription item OR organization wallet
 	if relayInfo != nil && relayInfo.BillingSource == BillingSourceSubscription {
 		if relayInfo.SubscriptionId == 0 {
 			return errors.New("subscription id is missing")
 		}
 		delta := int64(quota)
-		if delta != 0 {
+		if delta != 0 && relayInfo.SubscriptionAllowanceModel == "" {
 			if err := model.PostConsumeUserSubscriptionDelta(relayInfo.SubscriptionId, delta); err != nil {
 				return err
 			}
 			relayInfo.SubscriptionPostDelta += delta
+			// 组织订阅的消耗同样计入项目预算
+			if relayInfo.ProjectId != 0 {
+				if err := model.UpdateProjectUsedQuota(relayInfo.ProjectId, quota); err != nil {
+					return err
+				}
+			}
+		}
+	} else if relayInfo != nil && relayInfo.OrgId != 0 {
+		funding := &OrganizationFunding{requestId: relayInfo.RequestId, orgId: relayInfo.OrgId, projectId: relayInfo.ProjectId}
+		if err := funding.Settle(quota); err != nil {
+			return err
 		}
 	} else {
 		// Wallet
 		if quota > 0 {
 			if model.UserHasActiveQuotaRecords(relayInfo.UserId) {
-				err = model.DecreaseUserQuotaWithRecords(relayInfo.UserId, quota)
+				err = model.DecreaseUserQuotaWithRecords(relayInfo.UserId, quota, consumeLedgerRef(relayInfo.RequestId))
 			} else {
-				err = model.DecreaseUserQuota(relayInfo.UserId, quota)
+				err = model.DecreaseUserQuota(relayInfo.UserId, quota, consumeLedgerRef(relayInfo.RequestId))
 			}
 		} else {
-			err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false)
+			err = model.IncreaseUserQuota(relayInfo.UserId, -quota, false, refundLedgerRef(relayInfo.RequestId))
 		}
 		if err != nil {
 			return err
@@ -504,7 +519,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if sendEmail {
+	if sendEmail && relayInfo.OrgId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -566,7 +581,8 @@ func checkAndSendSubscriptionQuotaNotify(relayInfo *relaycommon.RelayInfo) {
 		if relayInfo == nil {
 			return
 		}
-		if relayInfo.SubscriptionId == 0 || relayInfo.SubscriptionAmountTotal <= 0 {
+		// 命中模型额度的请求不占用订阅总额度
+		if relayInfo.SubscriptionId == 0 || relayInfo.SubscriptionAmountTotal <= 0 || relayInfo.SubscriptionAllowanceModel != "" {
 			return
 		}
 
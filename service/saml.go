@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/pkg/cachex"
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+
+	"github.com/crewjam/saml"
+	"github.com/samber/hot"
+)
+
+const (
+	samlRequestCacheNamespace = "new-api:saml_request:v1"
+	samlRequestTTL            = 10 * time.Minute
+	samlMetadataRefresh       = time.Hour
+)
+
+// SAMLIdentity 从断言中解析出的用户身份
+type SAMLIdentity struct {
+	SsoId       string
+	Email       string
+	DisplayName string
+	Groups      []string
+}
+
+var (
+	samlSPLock      sync.Mutex
+	samlSP          *saml.ServiceProvider
+	samlSPConfigKey string
+	samlSPBuiltAt   time.Time
+
+	samlRequestCache     *cachex.HybridCache[string]
+	samlRequestCacheOnce sync.Once
+)
+
+// getSAMLRequestCache 记录 SP 发起的 AuthnRequest ID，按 RelayState 索引。
+// 会话 Cookie 为 SameSite=Strict，IdP 跨站 POST 到 ACS 时不会携带，因此不能存放在会话中
+func getSAMLRequestCache() *cachex.HybridCache[string] {
+	samlRequestCacheOnce.Do(func() {
+		samlRequestCache = cachex.NewHybridCache[string](cachex.HybridCacheConfig[string]{
+			Namespace: cachex.Namespace(samlRequestCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.StringCodec{},
+			Memory: func() *hot.HotCache[string, string] {
+				return hot.NewHotCache[string, string](hot.LRU, 10_000).
+					WithTTL(samlRequestTTL).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return samlRequestCache
+}
+
+func samlBaseURL() (*url.URL, error) {
+	if system_setting.ServerAddress == "" {
+		return nil, errors.New("请先设置服务器地址")
+	}
+	return url.Parse(strings.TrimSuffix(system_setting.ServerAddress, "/"))
+}
+
+func fetchSAMLIdPMetadata(metadataURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 IdP 元数据失败，状态码 %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
+
+// parseSAMLIdPMetadata 解析 IdP 元数据，兼容 EntitiesDescriptor 包含多个实体的情况
+func parseSAMLIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("解析 IdP 元数据失败: %w", err)
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("IdP 元数据中没有 IDPSSODescriptor")
+}
+
+func parseSAMLKeyPair(certPEM string, keyPEM string) (crypto.Signer, *x509.Certificate, error) {
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析 SP 证书或私钥失败: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("不支持的 SP 私钥类型")
+	}
+	return signer, cert, nil
+}
+
+// getSAMLServiceProvider 按当前配置构建 SP，配置未变化时复用，远程元数据每小时刷新
+func getSAMLServiceProvider() (*saml.ServiceProvider, error) {
+	settings := system_setting.GetSAMLSettings()
+	if !settings.Enabled {
+		return nil, errors.New("管理员未开启 SAML 登录")
+	}
+	configKey := strings.Join([]string{
+		system_setting.ServerAddress, settings.EntityId, settings.IdPMetadataURL, settings.IdPMetadataXML,
+		settings.SPCertificate, settings.SPPrivateKey, fmt.Sprint(settings.AllowIdPInitiated),
+	}, "\x00")
+
+	samlSPLock.Lock()
+	defer samlSPLock.Unlock()
+	if samlSP != nil && samlSPConfigKey == configKey &&
+		(settings.IdPMetadataURL == "" || time.Since(samlSPBuiltAt) < samlMetadataRefresh) {
+		return samlSP, nil
+	}
+
+	baseURL, err := samlBaseURL()
+	if err != nil {
+		return nil, err
+	}
+	var metadata []byte
+	if settings.IdPMetadataURL != "" {
+		metadata, err = fetchSAMLIdPMetadata(settings.IdPMetadataURL)
+		if err != nil {
+			// 远程元数据刷新失败时继续使用上次的配置
+			if samlSP != nil && samlSPConfigKey == configKey {
+				common.SysError("failed to refresh SAML IdP metadata: " + err.Error())
+				return samlSP, nil
+			}
+			return nil, err
+		}
+	} else if settings.IdPMetadataXML != "" {
+		metadata = []byte(settings.IdPMetadataXML)
+	} else {
+		return nil, errors.New("请先配置 IdP 元数据")
+	}
+	idpMetadata, err := parseSAMLIdPMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:          settings.EntityId,
+		HTTPClient:        GetHttpClient(),
+		MetadataURL:       *baseURL.JoinPath("/api/saml/metadata"),
+		AcsURL:            *baseURL.JoinPath("/api/saml/acs"),
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		AllowIDPInitiated: settings.AllowIdPInitiated,
+	}
+	if settings.SPCertificate != "" && settings.SPPrivateKey != "" {
+		sp.Key, sp.Certificate, err = parseSAMLKeyPair(settings.SPCertificate, settings.SPPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		sp.SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+		if sp.Certificate.PublicKeyAlgorithm == x509.ECDSA {
+			sp.SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+		}
+	}
+	samlSP = sp
+	samlSPConfigKey = configKey
+	samlSPBuiltAt = time.Now()
+	return sp, nil
+}
+
+// GetSAMLMetadata 生成 SP 元数据
+func GetSAMLMetadata() ([]byte, error) {
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		return nil, err
+	}
+	data, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// MakeSAMLLoginRequest 生成 AuthnRequest，IdP 支持 HTTP-Redirect 时返回跳转地址，否则返回自动提交的 POST 表单
+func MakeSAMLLoginRequest() (redirectURL string, postForm []byte, err error) {
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		return "", nil, err
+	}
+	binding := saml.HTTPRedirectBinding
+	location := sp.GetSSOBindingLocation(binding)
+	if location == "" {
+		binding = saml.HTTPPostBinding
+		location = sp.GetSSOBindingLocation(binding)
+	}
+	if location == "" {
+		return "", nil, errors.New("IdP 元数据中没有可用的单点登录地址")
+	}
+	req, err := sp.MakeAuthenticationRequest(location, binding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", nil, err
+	}
+	relayState := common.GetRandomString(32)
+	if err := getSAMLRequestCache().SetWithTTL(relayState, req.ID, samlRequestTTL); err != nil {
+		return "", nil, err
+	}
+	if binding == saml.HTTPRedirectBinding {
+		u, err := req.Redirect(relayState, sp)
+		if err != nil {
+			return "", nil, err
+		}
+		return u.String(), nil, nil
+	}
+	return "", req.Post(relayState), nil
+}
+
+// ParseSAMLResponse 校验 ACS 收到的 SAMLResponse 并按属性映射解析用户身份。
+// RelayState 对应的请求 ID 只能使用一次；没有对应请求时仅在允许 IdP 发起登录时接受
+func ParseSAMLResponse(r *http.Request) (*SAMLIdentity, error) {
+	sp, err := getSAMLServiceProvider()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	var possibleRequestIDs []string
+	if relayState := r.Form.Get("RelayState"); relayState != "" {
+		cache := getSAMLRequestCache()
+		if requestID, found, _ := cache.Get(relayState); found && requestID != "" {
+			possibleRequestIDs = append(possibleRequestIDs, requestID)
+			_, _ = cache.DeleteMany([]string{relayState})
+		}
+	}
+	if len(possibleRequestIDs) == 0 && !sp.AllowIDPInitiated {
+		return nil, errors.New("SAML 登录请求已过期，请重新登录")
+	}
+	assertion, err := sp.ParseResponse(r, possibleRequestIDs)
+	if err != nil {
+		var invalidErr *saml.InvalidResponseError
+		if errors.As(err, &invalidErr) && invalidErr.PrivateErr != nil {
+			common.SysLog("SAML response rejected: " + invalidErr.PrivateErr.Error())
+		}
+		return nil, errors.New("SAML 响应校验失败")
+	}
+	return samlIdentityFromAssertion(assertion)
+}
+
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name != name && attr.FriendlyName != name {
+				continue
+			}
+			for _, v := range attr.Values {
+				if value := strings.TrimSpace(v.Value); value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func samlFirstAttribute(assertion *saml.Assertion, name string) string {
+	if values := samlAttributeValues(assertion, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func samlIdentityFromAssertion(assertion *saml.Assertion) (*SAMLIdentity, error) {
+	settings := system_setting.GetSAMLSettings()
+	identity := &SAMLIdentity{
+		Email:       samlFirstAttribute(assertion, settings.EmailAttribute),
+		DisplayName: samlFirstAttribute(assertion, settings.DisplayNameAttribute),
+		Groups:      samlAttributeValues(assertion, settings.GroupAttribute),
+	}
+	if settings.UsernameAttribute != "" {
+		identity.SsoId = samlFirstAttribute(assertion, settings.UsernameAttribute)
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.SsoId = strings.TrimSpace(assertion.Subject.NameID.Value)
+	}
+	if identity.SsoId == "" {
+		return nil, errors.New("SAML 断言中缺少用户标识")
+	}
+	return identity, nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/setting/system_setting"
+	"github.com/crewjam/saml"
+)
+
+type testSAMLServiceProviders struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p *testSAMLServiceProviders) GetServiceProvider(_ *http.Request, id string) (*saml.EntityDescriptor, error) {
+	if p.metadata == nil || p.metadata.EntityID != id {
+		return nil, os.ErrNotExist
+	}
+	return p.metadata, nil
+}
+
+// newTestSAMLIdP 创建使用自签名证书的测试 IdP，并将其元数据配置到 SAML 设置中
+func newTestSAMLIdP(t *testing.T) (*saml.IdentityProvider, *testSAMLServiceProviders) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	providers := &testSAMLServiceProviders{}
+	idp := &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: providers,
+	}
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatalf("failed to marshal idp metadata: %v", err)
+	}
+
+	settings := system_setting.GetSAMLSettings()
+	oldSettings := *settings
+	oldServerAddress := system_setting.ServerAddress
+	t.Cleanup(func() {
+		*settings = oldSettings
+		system_setting.ServerAddress = oldServerAddress
+	})
+	system_setting.ServerAddress = "https://gateway.example.com"
+	settings.Enabled = true
+	settings.IdPMetadataURL = ""
+	settings.IdPMetadataXML = string(metadata)
+	settings.EntityId = "https://gateway.example.com/api/saml/metadata"
+	settings.UsernameAttribute = ""
+	settings.EmailAttribute = "mail"
+	settings.DisplayNameAttribute = "cn"
+	settings.GroupAttribute = "eduPersonAffiliation"
+	settings.AllowIdPInitiated = false
+
+	spMetadata, err := GetSAMLMetadata()
+	if err != nil {
+		t.Fatalf("failed to build sp metadata: %v", err)
+	}
+	providers.metadata = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(spMetadata, providers.metadata); err != nil {
+		t.Fatalf("failed to parse sp metadata: %v", err)
+	}
+	return idp, providers
+}
+
+// testSAMLLogin 发起 SP 登录，由测试 IdP 签发断言，返回提交到 ACS 的表单
+func testSAMLLogin(t *testing.T, idp *saml.IdentityProvider, session *saml.Session) url.Values {
+	t.Helper()
+	redirectURL, _, err := MakeSAMLLoginRequest()
+	if err != nil {
+		t.Fatalf("MakeSAMLLoginRequest: %v", err)
+	}
+	if !strings.HasPrefix(redirectURL, idp.SSOURL.String()+"?") {
+		t.Fatalf("expected redirect to idp, got %s", redirectURL)
+	}
+	authnReq, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+	if err != nil {
+		t.Fatalf("NewIdpAuthnRequest: %v", err)
+	}
+	if err := authnReq.Validate(); err != nil {
+		t.Fatalf("idp rejected authn request: %v", err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(authnReq, session); err != nil {
+		t.Fatalf("MakeAssertion: %v", err)
+	}
+	form, err := authnReq.PostBinding()
+	if err != nil {
+		t.Fatalf("PostBinding: %v", err)
+	}
+	if form.URL != "https://gateway.example.com/api/saml/acs" {
+		t.Fatalf("unexpected acs url %s", form.URL)
+	}
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+func postSAMLResponse(form url.Values) (*SAMLIdentity, error) {
+	r := httptest.NewRequest(http.MethodPost, "https://gateway.example.com/api/saml/acs", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ParseSAMLResponse(r)
+}
+
+func TestParseSAMLResponseFromIdP(t *testing.T) {
+	idp, _ := newTestSAMLIdP(t)
+	session := &saml.Session{
+		ID:             "session-1",
+		NameID:         "alice-nameid",
+		NameIDFormat:   string(saml.PersistentNameIDFormat),
+		UserEmail:      "alice@example.com",
+		UserCommonName: "Alice",
+		Groups:         []string{"Engineering", "Admins"},
+	}
+
+	form := testSAMLLogin(t, idp, session)
+	identity, err := postSAMLResponse(form)
+	if err != nil {
+		t.Fatalf("ParseSAMLResponse: %v", err)
+	}
+	if identity.SsoId != "alice-nameid" || identity.Email != "alice@example.com" || identity.DisplayName != "Alice" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if strings.Join(identity.Groups, ",") != "Engineering,Admins" {
+		t.Fatalf("unexpected groups %v", identity.Groups)
+	}
+
+	// RelayState 对应的请求只能使用一次
+	if _, err := postSAMLResponse(form); err == nil {
+		t.Fatal("expected replayed response to be rejected")
+	}
+
+	// 按属性名称取用户标识
+	system_setting.GetSAMLSettings().UsernameAttribute = "urn:oid:0.9.2342.19200300.100.1.1"
+	session.UserName = "alice"
+	identity, err = postSAMLResponse(testSAMLLogin(t, idp, session))
+	if err != nil {
+		t.Fatalf("ParseSAMLResponse: %v", err)
+	}
+	if identity.SsoId != "alice" {
+		t.Fatalf("expected sso id from uid attribute, got %q", identity.SsoId)
+	}
+}
+
+func TestParseSAMLResponseRejectsInvalidResponses(t *testing.T) {
+	idp, _ := newTestSAMLIdP(t)
+	session := &saml.Session{ID: "session-2", NameID: "bob", UserEmail: "bob@example.com"}
+
+	// 篡改断言内容后签名校验失败
+	form := testSAMLLogin(t, idp, session)
+	raw, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	tampered := strings.Replace(string(raw), "bob@example.com", "eve@example.com", 1)
+	if tampered == string(raw) {
+		t.Fatal("expected response to contain the user email")
+	}
+	form.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(tampered)))
+	if _, err := postSAMLResponse(form); err == nil {
+		t.Fatal("expected tampered response to be rejected")
+	}
+
+	// 没有对应的登录请求时，仅在允许 IdP 发起登录时接受
+	form = testSAMLLogin(t, idp, session)
+	form.Set("RelayState", "unknown")
+	if _, err := postSAMLResponse(form); err == nil || !strings.Contains(err.Error(), "过期") {
+		t.Fatalf("expected unsolicited response to be rejected, got %v", err)
+	}
+
+	// 其他 IdP 签发的响应被拒绝
+	otherIdP, _ := newTestSAMLIdP(t)
+	form = testSAMLLogin(t, idp, session)
+	system_setting.GetSAMLSettings().IdPMetadataXML = mustMarshalSAMLMetadata(t, otherIdP)
+	if _, err := postSAMLResponse(form); err == nil {
+		t.Fatal("expected response signed by another idp to be rejected")
+	}
+}
+
+func mustMarshalSAMLMetadata(t *testing.T, idp *saml.IdentityProvider) string {
+	t.Helper()
+	data, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatalf("failed to marshal idp metadata: %v", err)
+	}
+	return string(data)
+}
+
+func TestSAMLIdentityFromAssertion(t *testing.T) {
+	settings := system_setting.GetSAMLSettings()
+	oldSettings := *settings
+	t.Cleanup(func() { *settings = oldSettings })
+	settings.EmailAttribute = "email"
+	settings.DisplayNameAttribute = "displayName"
+	settings.GroupAttribute = "groups"
+
+	assertion := func(nameID string, attrs ...saml.Attribute) *saml.Assertion {
+		a := &saml.Assertion{AttributeStatements: []saml.AttributeStatement{{Attributes: attrs}}}
+		if nameID != "" {
+			a.Subject = &saml.Subject{NameID: &saml.NameID{Value: nameID}}
+		}
+		return a
+	}
+	attr := func(name, friendlyName string, values ...string) saml.Attribute {
+		a := saml.Attribute{Name: name, FriendlyName: friendlyName}
+		for _, v := range values {
+			a.Values = append(a.Values, saml.AttributeValue{Value: v})
+		}
+		return a
+	}
+
+	tests := []struct {
+		name         string
+		usernameAttr string
+		assertion    *saml.Assertion
+		want         SAMLIdentity
+		wantErr      bool
+	}{
+		{
+			name: "name id and attributes by name",
+			assertion: assertion(" user-1 ",
+				attr("email", "", "u1@example.com"),
+				attr("displayName", "", "User One"),
+				attr("groups", "", "Engineering", " ", "Admins"),
+			),
+			want: SAMLIdentity{SsoId: "user-1", Email: "u1@example.com", DisplayName: "User One", Groups: []string{"Engineering", "Admins"}},
+		},
+		{
+			name: "attributes by friendly name",
+			assertion: assertion("user-2",
+				attr("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", "email", "u2@example.com"),
+			),
+			want: SAMLIdentity{SsoId: "user-2", Email: "u2@example.com"},
+		},
+		{
+			name: "groups across statements",
+			assertion: &saml.Assertion{
+				Subject: &saml.Subject{NameID: &saml.NameID{Value: "user-3"}},
+				AttributeStatements: []saml.AttributeStatement{
+					{Attributes: []saml.Attribute{attr("groups", "", "A")}},
+					{Attributes: []saml.Attribute{attr("groups", "", "B")}},
+				},
+			},
+			want: SAMLIdentity{SsoId: "user-3", Groups: []string{"A", "B"}},
+		},
+		{
+			name:         "username attribute overrides name id",
+			usernameAttr: "uid",
+			assertion:    assertion("transient-id", attr("urn:oid:0.9.2342.19200300.100.1.1", "uid", "alice")),
+			want:         SAMLIdentity{SsoId: "alice"},
+		},
+		{
+			name:         "missing username attribute",
+			usernameAttr: "uid",
+			assertion:    assertion("transient-id"),
+			wantErr:      true,
+		},
+		{
+			name:      "missing subject",
+			assertion: assertion("", attr("email", "", "u@example.com")),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings.UsernameAttribute = tt.usernameAttr
+			identity, err := samlIdentityFromAssertion(tt.assertion)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("samlIdentityFromAssertion: %v", err)
+			}
+			if identity.SsoId != tt.want.SsoId || identity.Email != tt.want.Email || identity.DisplayName != tt.want.DisplayName ||
+				strings.Join(identity.Groups, ",") != strings.Join(tt.want.Groups, ",") {
+				t.Fatalf("identity = %+v, want %+v", identity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+)
+
+const (
+	StatementFormatCSV = "csv"
+	StatementFormatPDF = "pdf"
+)
+
+// StatementTotals 账单金额汇总，支付金额按含税计算
+type StatementTotals struct {
+	PaidMoney float64
+	TaxRate   float64
+	TaxAmount float64
+	NetAmount float64
+}
+
+func GetStatementTotals(statement *model.Statement) StatementTotals {
+	totals := StatementTotals{
+		PaidMoney: statement.TopUpMoney + statement.SubscriptionMoney,
+		TaxRate:   operation_setting.GetStatementSetting().TaxRate,
+	}
+	if totals.TaxRate > 0 {
+		totals.TaxAmount = totals.PaidMoney * totals.TaxRate / (100 + totals.TaxRate)
+	}
+	totals.NetAmount = totals.PaidMoney - totals.TaxAmount
+	return totals
+}
+
+func formatStatementQuota(quota int) string {
+	return strconv.FormatFloat(float64(quota)/common.QuotaPerUnit, 'f', 6, 64)
+}
+
+func formatStatementMoney(money float64) string {
+	return strconv.FormatFloat(money, 'f', 2, 64)
+}
+
+func formatStatementTime(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+}
+
+func statementFileName(statement *model.Statement, format string) string {
+	return fmt.Sprintf("statement-%d-%s.%s", statement.UserId, statement.Period, format)
+}
+
+// statementRows 按分节生成账单内容，CSV 与 PDF 共用
+func statementRows(statement *model.Statement) [][]string {
+	setting := operation_setting.GetStatementSetting()
+	detail := statement.GetDetail()
+	totals := GetStatementTotals(statement)
+	username, _ := model.GetUsernameById(statement.UserId, false)
+
+	rows := [][]string{
+		{"Statement", statement.Period},
+		{"Period", formatStatementTime(statement.StartTime), formatStatementTime(statement.EndTime)},
+		{"Issued At", formatStatementTime(statement.UpdatedAt)},
+		{},
+		{"Issuer", setting.IssuerName},
+		{"Issuer Tax ID", setting.IssuerTaxId},
+		{"Issuer Address", setting.IssuerAddress},
+		{},
+		{"Customer", fmt.Sprintf("%s (#%d)", username, statement.UserId)},
+		{"Company", statement.Company},
+		{"Tax ID", statement.TaxId},
+		{"Address", statement.Address},
+		{},
+		{"Summary"},
+		{"Requests", strconv.Itoa(statement.RequestCount)},
+		{"Tokens", strconv.Itoa(statement.TokensUsed)},
+		{"Consumed (USD)", formatStatementQuota(statement.ConsumedQuota)},
+		{"Paid By Organization (USD)", formatStatementQuota(statement.OrganizationQuota)},
+		{"Top-up Quota (USD)", formatStatementQuota(statement.TopUpQuota)},
+		{"Top-up Payments", formatStatementMoney(statement.TopUpMoney)},
+		{"Subscription Payments", formatStatementMoney(statement.SubscriptionMoney)},
+		{"Total Paid", formatStatementMoney(totals.PaidMoney)},
+		{"Tax Rate (%)", strconv.FormatFloat(totals.TaxRate, 'f', -1, 64)},
+		{"Tax Included", formatStatementMoney(totals.TaxAmount)},
+		{"Net Amount", formatStatementMoney(totals.NetAmount)},
+	}
+
+	usageSection := func(title string, lines []model.StatementUsageLine) {
+		rows = append(rows, []string{}, []string{title}, []string{"Name", "Requests", "Tokens", "Amount (USD)"})
+		for _, line := range lines {
+			rows = append(rows, []string{line.Name, strconv.Itoa(line.Requests), strconv.Itoa(line.Tokens), formatStatementQuota(line.Quota)})
+		}
+	}
+	usageSection("Usage By Model", detail.Models)
+	usageSection("Usage By Token", detail.Tokens)
+	if len(detail.Projects) > 0 {
+		usageSection("Usage By Project", detail.Projects)
+	}
+
+	paymentSection := func(title string, lines []model.StatementPaymentLine) {
+		rows = append(rows, []string{}, []string{title}, []string{"Trade No", "Item", "Method", "Amount", "Completed At"})
+		for _, line := range lines {
+			item := line.Title
+			if item == "" && line.Quota > 0 {
+				item = "Top-up " + formatStatementQuota(line.Quota) + " USD"
+			}
+			rows = append(rows, []string{line.TradeNo, item, line.PaymentMethod, formatStatementMoney(line.Money), formatStatementTime(line.CompleteTime)})
+		}
+	}
+	paymentSection("Top-ups", detail.TopUps)
+	paymentSection("Subscriptions", detail.Subscriptions)
+	return rows
+}
+
+func RenderStatementCSV(statement *model.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	// 写入 BOM，便于 Excel 正确识别 UTF-8
+	buf.WriteString("\xEF\xBB\xBF")
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(statementRows(statement)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func RenderStatementPDF(statement *model.Statement) ([]byte, error) {
+	rows := statementRows(statement)
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		line := ""
+		for i, cell := range row {
+			if i == 0 {
+				line = cell
+				continue
+			}
+			// 首列按显示宽度对齐后用两个空格分隔其余列
+			line = pdfPadRight(line, 28)
+			if i > 1 {
+				line += "  "
+			}
+			line += cell
+		}
+		lines = append(lines, line)
+	}
+	return renderTextPDF(lines), nil
+}
+
+// RenderStatement 按格式渲染账单，返回文件内容、Content-Type 与文件名
+func RenderStatement(statement *model.Statement, format string) ([]byte, string, string, error) {
+	switch format {
+	case StatementFormatPDF:
+		data, err := RenderStatementPDF(statement)
+		return data, "application/pdf", statementFileName(statement, StatementFormatPDF), err
+	case StatementFormatCSV, "":
+		data, err := RenderStatementCSV(statement)
+		return data, "text/csv; charset=utf-8", statementFileName(statement, StatementFormatCSV), err
+	default:
+		return nil, "", "", fmt.Errorf("不支持的账单格式: %s", format)
+	}
+}
+
+// GenerateStatement 生成账单，notify 为 true 且开启通知时通知用户账单已生成
+func GenerateStatement(userId int, period string, notify bool) (*model.Statement, error) {
+	statement, err := model.GenerateStatement(userId, period)
+	if err != nil {
+		return nil, err
+	}
+	if notify && operation_setting.GetStatementSetting().NotifyEnabled {
+		notifyStatementReady(statement)
+	}
+	return statement, nil
+}
+
+func notifyStatementReady(statement *model.Statement) {
+	user, err := model.GetUserById(statement.UserId, false)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to get user %d for statement notify: %s", statement.UserId, err.Error()))
+		return
+	}
+	userSetting := user.GetSetting()
+	// 设置了账单邮箱时，账单通知固定发送到该邮箱
+	if userSetting.InvoiceEmail != "" {
+		userSetting.NotifyType = dto.NotifyTypeEmail
+		userSetting.NotificationEmail = userSetting.InvoiceEmail
+	}
+	content := "您 {{value}} 的账单已生成，本期消费 {{value}}，可在控制台下载 CSV 或 PDF 账单。"
+	err = NotifyUser(user.Id, user.Email, userSetting, dto.NewNotify(dto.NotifyTypeStatement, "月度账单已生成", content,
+		[]interface{}{statement.Period, "$" + formatStatementQuota(statement.ConsumedQuota)}))
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify statement to user %d: %s", user.Id, err.Error()))
+	}
+}
+
+// GenerateStatementsForPeriod 为周期内有消费或充值的所有用户生成账单，返回成功数量。
+// skipExisting 为 true 时跳过已有该周期账单的用户，定时任务重复执行时不会重复通知
+func GenerateStatementsForPeriod(period string, notify bool, skipExisting bool) (int, error) {
+	start, end, err := model.ParseStatementPeriod(period)
+	if err != nil {
+		return 0, err
+	}
+	userIds, err := model.GetStatementUserIds(start, end)
+	if err != nil {
+		return 0, err
+	}
+	generated := 0
+	for _, userId := range userIds {
+		if skipExisting {
+			if _, err := model.GetUserStatementByPeriod(userId, period); err == nil {
+				continue
+			}
+		}
+		if _, err := GenerateStatement(userId, period, notify); err != nil {
+			common.SysLog(fmt.Sprintf("failed to generate statement %s for user %d: %s", period, userId, err.Error()))
+			continue
+		}
+		generated++
+	}
+	return generated, nil
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Zer0Echo/uniapi/common"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	pdfPageWidth    = 595 // A4
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 9
+	pdfLineHeight   = 12
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	// 每行可用宽度，单位为 1/1000 字号，超出时折行
+	pdfLineWidth = (pdfPageWidth - 2*pdfMargin) * 1000 / pdfFontSize
+)
+
+// pdfCIDFont 账单 PDF 使用的 CID 字体，以便公司名、地址、套餐名等中文内容正常显示。
+// 配置 STATEMENT_PDF_FONT（TTF/OTF 字体文件路径）时以 Identity-H 编码嵌入该字体，TrueType 字体只嵌入用到的字形；
+// 未配置时使用阅读器内置的 Adobe-GB1 宋体（STSong-Light），按 UCS-2 编码不嵌入字体
+type pdfCIDFont struct {
+	font *sfnt.Font
+	data []byte
+	name string
+	cff  bool
+	// 本文档用到的字形宽度，生成 /W 数组
+	widths map[sfnt.GlyphIndex]int
+	buf    sfnt.Buffer
+}
+
+var (
+	statementFontOnce sync.Once
+	statementFontData []byte
+	statementFont     *sfnt.Font
+)
+
+// loadStatementFont 读取一次配置的字体文件，失败时记录日志并回退到内置字体
+func loadStatementFont() (*sfnt.Font, []byte) {
+	statementFontOnce.Do(func() {
+		path := strings.TrimSpace(common.GetEnvOrDefaultString("STATEMENT_PDF_FONT", ""))
+		if path == "" {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			common.SysError("load statement pdf font failed: " + err.Error())
+			return
+		}
+		f, err := sfnt.Parse(data)
+		if err != nil {
+			common.SysError("parse statement pdf font failed: " + err.Error())
+			return
+		}
+		statementFont, statementFontData = f, data
+	})
+	return statementFont, statementFontData
+}
+
+func newPDFCIDFont(f *sfnt.Font, data []byte) *pdfCIDFont {
+	if f == nil {
+		return &pdfCIDFont{}
+	}
+	font := &pdfCIDFont{font: f, data: data, widths: map[sfnt.GlyphIndex]int{}}
+	font.cff = bytes.HasPrefix(data, []byte("OTTO"))
+	font.name, _ = f.Name(&font.buf, sfnt.NameIDPostScript)
+	font.name = pdfFontName(font.name)
+	return font
+}
+
+// pdfFontName PDF 名称对象中只保留字母数字与连字符
+func pdfFontName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x80 && (r == '-' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "StatementFont"
+	}
+	return b.String()
+}
+
+// encode 将文本编码为十六进制字符串：嵌入字体为字形编号，内置字体为 UCS-2，无法显示的字符替换为 '?'
+func (f *pdfCIDFont) encode(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if f.font == nil {
+			if r > 0xffff {
+				r = '?'
+			}
+			b.WriteString(fmt.Sprintf("%04X", r))
+			continue
+		}
+		gid := f.glyphIndex(r)
+		if _, ok := f.widths[gid]; !ok {
+			f.widths[gid] = f.glyphWidth(gid)
+		}
+		b.WriteString(fmt.Sprintf("%04X", uint16(gid)))
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// glyphIndex 字符对应的字形编号，字体中没有的字符使用 '?'
+func (f *pdfCIDFont) glyphIndex(r rune) sfnt.GlyphIndex {
+	gid, err := f.font.GlyphIndex(&f.buf, r)
+	if err != nil || gid == 0 {
+		gid, _ = f.font.GlyphIndex(&f.buf, '?')
+	}
+	return gid
+}
+
+// runeWidth 字符的显示宽度，单位为 1/1000 字号；内置字体与 /W 数组一致，ASCII 为半宽，其余为全宽
+func (f *pdfCIDFont) runeWidth(r rune) int {
+	if f.font == nil {
+		if r < 0x7f || r > 0xffff {
+			return 500
+		}
+		return 1000
+	}
+	gid := f.glyphIndex(r)
+	if width, ok := f.widths[gid]; ok {
+		return width
+	}
+	return f.glyphWidth(gid)
+}
+
+// wrapLine 按显示宽度折行，优先在空格处断开，续行去掉行首空格
+func (f *pdfCIDFont) wrapLine(line string) []string {
+	var lines []string
+	for {
+		width, lastSpace, cut := 0, -1, -1
+		for i, r := range line {
+			width += f.runeWidth(r)
+			if width > pdfLineWidth {
+				cut = i
+				break
+			}
+			if r == ' ' && strings.TrimSpace(line[:i]) != "" {
+				lastSpace = i
+			}
+		}
+		if cut <= 0 {
+			return append(lines, line)
+		}
+		if lastSpace > 0 {
+			cut = lastSpace
+		}
+		lines = append(lines, strings.TrimRight(line[:cut], " "))
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+}
+
+// glyphWidth 字形宽度，单位为 1/1000 字号
+func (f *pdfCIDFont) glyphWidth(gid sfnt.GlyphIndex) int {
+	advance, err := f.font.GlyphAdvance(&f.buf, gid, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return 1000
+	}
+	return advance.Round()
+}
+
+// objects 生成字体相关的对象，first 为 Type0 字体的对象编号，其余对象依次编号
+func (f *pdfCIDFont) objects(first int) []string {
+	if f.font == nil {
+		return []string{
+			fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [%d 0 R] >>", first+1),
+			fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light "+
+				"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor %d 0 R /DW 1000 /W [1 95 500] >>", first+2),
+			"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+				"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+		}
+	}
+
+	gids := make([]int, 0, len(f.widths))
+	for gid := range f.widths {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+
+	// CFF 轮廓的 OpenType 字体暂不做子集，整体压缩后嵌入
+	name := f.name
+	subtype, fontFileKey := "CIDFontType2", "FontFile2"
+	fontFile := pdfStream(f.data, fmt.Sprintf("/Length1 %d", len(f.data)))
+	if f.cff {
+		subtype, fontFileKey = "CIDFontType0", "FontFile3"
+		fontFile = pdfStream(f.data, "/Subtype /OpenType")
+	} else if subset, err := subsetTrueType(f.data, f.widths); err != nil {
+		common.SysError("subset statement pdf font failed: " + err.Error())
+	} else {
+		// 子集字体名需加上六个大写字母的标签
+		name = pdfSubsetTag(gids) + "+" + f.name
+		fontFile = pdfStream(subset, fmt.Sprintf("/Length1 %d", len(subset)))
+	}
+
+	var w strings.Builder
+	for _, gid := range gids {
+		w.WriteString(fmt.Sprintf("%d [%d] ", gid, f.widths[sfnt.GlyphIndex(gid)]))
+	}
+
+	ppem := fixed.I(1000)
+	bounds, _ := f.font.Bounds(&f.buf, ppem, font.HintingNone)
+	metrics, _ := f.font.Metrics(&f.buf, ppem, font.HintingNone)
+	descriptor := fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 4 /FontBBox [%d %d %d %d] "+
+		"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /%s %d 0 R >>",
+		name, bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round(),
+		metrics.Ascent.Round(), -metrics.Descent.Round(), metrics.Ascent.Round(), fontFileKey, first+3)
+
+	cidFont := fmt.Sprintf("<< /Type /Font /Subtype /%s /BaseFont /%s "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 1000 /W [%s]",
+		subtype, name, first+2, strings.TrimSpace(w.String()))
+	if !f.cff {
+		cidFont += " /CIDToGIDMap /Identity"
+	}
+	cidFont += " >>"
+
+	return []string{
+		fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] >>", name, first+1),
+		cidFont,
+		descriptor,
+		fontFile,
+	}
+}
+
+// pdfSubsetTag 按用到的字形生成子集标签，相同字形集合得到相同标签
+func pdfSubsetTag(gids []int) string {
+	h := fnv.New32a()
+	for _, gid := range gids {
+		_, _ = h.Write([]byte{byte(gid >> 8), byte(gid)})
+	}
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = byte('A' + sum%26)
+		sum /= 26
+	}
+	return string(tag)
+}
+
+// pdfStream 以 FlateDecode 压缩生成流对象，extra 为字典中的其他条目
+func pdfStream(data []byte, extra string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	dict := fmt.Sprintf("/Filter /FlateDecode /Length %d", buf.Len())
+	if extra != "" {
+		dict += " " + extra
+	}
+	return fmt.Sprintf("<< %s >>\nstream\n%s\nendstream", dict, buf.Bytes())
+}
+
+// pdfTextWidth 文本的显示宽度，中日韩等全角字符按两个半角字符计，用于列对齐
+func pdfTextWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115f || r >= 0x2e80 && r <= 0xa4cf || r >= 0xac00 && r <= 0xd7a3 ||
+			r >= 0xf900 && r <= 0xfaff || r >= 0xfe30 && r <= 0xfe4f || r >= 0xff00 && r <= 0xff60 ||
+			r >= 0xffe0 && r <= 0xffe6 || r >= 0x20000) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// pdfPadRight 按显示宽度在右侧补齐空格
+func pdfPadRight(s string, width int) string {
+	if pad := width - pdfTextWidth(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// renderTextPDF 生成只包含文本行的最小 PDF 文档，按页自动分页
+func renderTextPDF(lines []string) []byte {
+	f, data := loadStatementFont()
+	return renderTextPDFWithFont(lines, newPDFCIDFont(f, data))
+}
+
+func renderTextPDFWithFont(lines []string, cidFont *pdfCIDFont) []byte {
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		wrapped = append(wrapped, cidFont.wrapLine(line)...)
+	}
+	lines = wrapped
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// 对象编号：1 目录，2 页面树，之后每页依次为页面对象与内容流，最后为字体对象
+	fontObj := 3 + 2*len(pages)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // 页面树在确定页数后填充
+	}
+	kids := make([]string, 0, len(pages))
+	for _, pageLines := range pages {
+		pageObj := len(objects) + 1
+		contentObj := pageObj + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj))
+
+		var content bytes.Buffer
+		content.WriteString(fmt.Sprintf("BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin))
+		for _, line := range pageLines {
+			if utf8.RuneCountInString(line) > 0 {
+				content.WriteString(cidFont.encode(line) + " Tj ")
+			}
+			content.WriteString("T*\n")
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, fontObj, contentObj),
+			pdfStream(content.Bytes(), ""),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+	objects = append(objects, cidFont.objects(fontObj)...)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, obj))
+	}
+	xrefOffset := buf.Len()
+	buf.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(objects)+1))
+	for _, offset := range offsets {
+		buf.WriteString(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	buf.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset))
+	return buf.Bytes()
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// 嵌入 CIDFontType2 只需要以下表，cmap、name、post 与排版相关的表都不需要
+var subsetTrueTypeTables = []string{"cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// 复合字形部件的标志位
+const (
+	glyfArgsAreWords    = 0x0001
+	glyfHaveScale       = 0x0008
+	glyfMoreComponents  = 0x0020
+	glyfHaveXYScale     = 0x0040
+	glyfHaveTwoByTwo    = 0x0080
+	headChecksumAdjust  = 8
+	headIndexToLocFmt   = 50
+	trueTypeChecksumSum = 0xB1B0AFBA
+)
+
+// subsetTrueType 只保留 used 中字形（及复合字形引用的部件）的轮廓，其余字形置空。
+// 字形编号保持不变，仍可使用 /CIDToGIDMap /Identity；中文字体的体积主要在 glyf 表，置空后通常只剩几十 KB
+func subsetTrueType(data []byte, used map[sfnt.GlyphIndex]int) ([]byte, error) {
+	tables, err := readTrueTypeTables(data)
+	if err != nil {
+		return nil, err
+	}
+	head, maxp, loca, glyf := tables["head"], tables["maxp"], tables["loca"], tables["glyf"]
+	if len(head) < 54 || len(maxp) < 6 || loca == nil || glyf == nil {
+		return nil, errors.New("font is missing required truetype tables")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:6]))
+	shortLoca := binary.BigEndian.Uint16(head[headIndexToLocFmt:]) == 0
+	offsets, err := readLoca(loca, numGlyphs, shortLoca, len(glyf))
+	if err != nil {
+		return nil, err
+	}
+
+	// .notdef 必须保留，复合字形引用的部件一并保留
+	keep := map[int]bool{0: true}
+	queue := []int{0}
+	for gid := range used {
+		if int(gid) < numGlyphs && !keep[int(gid)] {
+			keep[int(gid)] = true
+			queue = append(queue, int(gid))
+		}
+	}
+	for len(queue) > 0 {
+		gid := queue[0]
+		queue = queue[1:]
+		for _, component := range compositeComponents(glyf[offsets[gid]:offsets[gid+1]]) {
+			if component < numGlyphs && !keep[component] {
+				keep[component] = true
+				queue = append(queue, component)
+			}
+		}
+	}
+
+	var newGlyf []byte
+	newOffsets := make([]int, numGlyphs+1)
+	for gid := 0; gid < numGlyphs; gid++ {
+		newOffsets[gid] = len(newGlyf)
+		if keep[gid] {
+			newGlyf = append(newGlyf, glyf[offsets[gid]:offsets[gid+1]]...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	newOffsets[numGlyphs] = len(newGlyf)
+
+	var newLoca []byte
+	for _, offset := range newOffsets {
+		if shortLoca {
+			newLoca = binary.BigEndian.AppendUint16(newLoca, uint16(offset/2))
+		} else {
+			newLoca = binary.BigEndian.AppendUint32(newLoca, uint32(offset))
+		}
+	}
+
+	subset := map[string][]byte{"glyf": newGlyf, "loca": newLoca}
+	for _, tag := range subsetTrueTypeTables {
+		if _, ok := subset[tag]; !ok && tables[tag] != nil {
+			subset[tag] = append([]byte(nil), tables[tag]...)
+		}
+	}
+	return writeTrueType(subset), nil
+}
+
+// readTrueTypeTables 按表目录读取各表内容
+func readTrueTypeTables(data []byte) (map[string][]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("font data too short")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:6]))
+	if len(data) < 12+16*numTables {
+		return nil, errors.New("font table directory truncated")
+	}
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := data[12+16*i:]
+		offset := int(binary.BigEndian.Uint32(record[8:12]))
+		length := int(binary.BigEndian.Uint32(record[12:16]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, errors.New("font table out of range")
+		}
+		tables[string(record[:4])] = data[offset : offset+length]
+	}
+	return tables, nil
+}
+
+func readLoca(loca []byte, numGlyphs int, short bool, glyfLen int) ([]int, error) {
+	size := 4
+	if short {
+		size = 2
+	}
+	if len(loca) < (numGlyphs+1)*size {
+		return nil, errors.New("loca table truncated")
+	}
+	offsets := make([]int, numGlyphs+1)
+	for i := range offsets {
+		if short {
+			offsets[i] = int(binary.BigEndian.Uint16(loca[2*i:])) * 2
+		} else {
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		}
+		if offsets[i] > glyfLen || i > 0 && offsets[i] < offsets[i-1] {
+			return nil, errors.New("invalid loca offset")
+		}
+	}
+	return offsets, nil
+}
+
+// compositeComponents 返回复合字形引用的部件字形编号，简单字形返回空
+func compositeComponents(glyph []byte) []int {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+	var components []int
+	for pos := 10; pos+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[pos:])
+		components = append(components, int(binary.BigEndian.Uint16(glyph[pos+2:])))
+		pos += 4
+		if flags&glyfArgsAreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&glyfHaveScale != 0:
+			pos += 2
+		case flags&glyfHaveXYScale != 0:
+			pos += 4
+		case flags&glyfHaveTwoByTwo != 0:
+			pos += 8
+		}
+		if flags&glyfMoreComponents == 0 {
+			break
+		}
+	}
+	return components
+}
+
+// writeTrueType 按标签顺序写出表目录与四字节对齐的表数据，并重新计算校验和
+func writeTrueType(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	if head := tables["head"]; len(head) >= headChecksumAdjust+4 {
+		binary.BigEndian.PutUint32(head[headChecksumAdjust:], 0)
+	}
+
+	numTables := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+	out := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	out = binary.BigEndian.AppendUint16(out, uint16(numTables))
+	out = binary.BigEndian.AppendUint16(out, uint16(searchRange))
+	out = binary.BigEndian.AppendUint16(out, uint16(entrySelector))
+	out = binary.BigEndian.AppendUint16(out, uint16(numTables*16-searchRange))
+
+	offset := 12 + 16*numTables
+	var body []byte
+	headOffset := -1
+	for _, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset
+		}
+		out = append(out, tag...)
+		out = binary.BigEndian.AppendUint32(out, trueTypeChecksum(table))
+		out = binary.BigEndian.AppendUint32(out, uint32(offset))
+		out = binary.BigEndian.AppendUint32(out, uint32(len(table)))
+		body = append(body, table...)
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		offset = 12 + 16*numTables + len(body)
+	}
+	out = append(out, body...)
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+headChecksumAdjust:], trueTypeChecksumSum-trueTypeChecksum(out))
+	}
+	return out
+}
+
+func trueTypeChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
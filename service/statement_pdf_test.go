@@ -0,0 +1,209 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+var pdfStreamPattern = regexp.MustCompile(`(?s)<< ([^\n]*?)>>\nstream\n(.*?)\nendstream`)
+
+// pdfStreams 解压文档中所有 FlateDecode 流
+func pdfStreams(t *testing.T, pdf []byte) [][]byte {
+	t.Helper()
+	var streams [][]byte
+	for _, match := range pdfStreamPattern.FindAllSubmatch(pdf, -1) {
+		if !bytes.Contains(match[1], []byte("/Filter /FlateDecode")) {
+			t.Fatalf("stream is not compressed: %s", match[1])
+		}
+		r, err := zlib.NewReader(bytes.NewReader(match[2]))
+		if err != nil {
+			t.Fatalf("failed to inflate stream: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("failed to inflate stream: %v", err)
+		}
+		streams = append(streams, data)
+	}
+	return streams
+}
+
+func loadTestFont(t *testing.T) (*sfnt.Font, []byte) {
+	t.Helper()
+	const path = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Skip("test font not available: " + path)
+	}
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		t.Fatalf("failed to parse font: %v", err)
+	}
+	return parsed, data
+}
+
+func TestPDFBuiltinFontEncodesCJK(t *testing.T) {
+	f := newPDFCIDFont(nil, nil)
+	if got, want := f.encode("中文 A("), "<4E2D6587002000410028>"; got != want {
+		t.Fatalf("encode = %s, want %s", got, want)
+	}
+	if got := f.encode("😀"); got != "<003F>" {
+		t.Fatalf("expected non-BMP rune to be replaced, got %s", got)
+	}
+
+	data := renderTextPDFWithFont([]string{"公司 测试有限公司", "", "Total Paid  10.00"}, newPDFCIDFont(nil, nil))
+	for _, want := range []string{"%PDF-1.4", "/Type0", "/UniGB-UCS2-H", "/STSong-Light", "%%EOF"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("pdf missing %q", want)
+		}
+	}
+	// 内容流压缩后写入
+	streams := pdfStreams(t, data)
+	if len(streams) != 1 || !bytes.Contains(streams[0], []byte("<516C53F80020")) {
+		t.Fatalf("unexpected content streams %q", streams)
+	}
+}
+
+func TestPDFEmbeddedFontUsesIdentityH(t *testing.T) {
+	parsed, data := loadTestFont(t)
+	f := newPDFCIDFont(parsed, data)
+	encoded := f.encode("AB")
+	if encoded == "<00000000>" || len(encoded) != 10 {
+		t.Fatalf("unexpected glyph encoding %s", encoded)
+	}
+	if len(f.widths) != 2 {
+		t.Fatalf("expected 2 glyph widths, got %d", len(f.widths))
+	}
+
+	pdf := renderTextPDFWithFont([]string{"Statement 2026-01"}, newPDFCIDFont(parsed, data))
+	for _, want := range []string{"/Identity-H", "/CIDFontType2", "/FontFile2", "/CIDToGIDMap /Identity", "+DejaVuSans"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("pdf missing %q", want)
+		}
+	}
+	// 只嵌入用到的字形，文档远小于原字体
+	if len(pdf) > len(data)/10 {
+		t.Fatalf("expected subset font, pdf size %d, font size %d", len(pdf), len(data))
+	}
+	if streams := pdfStreams(t, pdf); len(streams) != 2 {
+		t.Fatalf("expected content and font streams, got %d", len(streams))
+	}
+}
+
+func TestSubsetTrueTypeKeepsUsedGlyphs(t *testing.T) {
+	parsed, data := loadTestFont(t)
+	f := newPDFCIDFont(parsed, data)
+	// Ä 在 DejaVu Sans 中为复合字形，其部件也需保留
+	f.encode("AÄ")
+	subset, err := subsetTrueType(data, f.widths)
+	if err != nil {
+		t.Fatalf("subsetTrueType: %v", err)
+	}
+	if trueTypeChecksum(subset) != trueTypeChecksumSum {
+		t.Fatal("unexpected font checksum")
+	}
+	original, _ := readTrueTypeTables(data)
+	tables, err := readTrueTypeTables(subset)
+	if err != nil {
+		t.Fatalf("readTrueTypeTables: %v", err)
+	}
+	for _, tag := range []string{"cmap", "name", "post", "GSUB"} {
+		if _, ok := tables[tag]; ok {
+			t.Errorf("expected table %q to be dropped", tag)
+		}
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:6]))
+	shortLoca := binary.BigEndian.Uint16(tables["head"][headIndexToLocFmt:]) == 0
+	offsets, err := readLoca(tables["loca"], numGlyphs, shortLoca, len(tables["glyf"]))
+	if err != nil {
+		t.Fatalf("readLoca: %v", err)
+	}
+	originalOffsets, _ := readLoca(original["loca"], numGlyphs, shortLoca, len(original["glyf"]))
+	glyph := func(offsets []int, glyf []byte, gid int) []byte { return glyf[offsets[gid]:offsets[gid+1]] }
+
+	kept := map[int]bool{0: true}
+	for gid := range f.widths {
+		kept[int(gid)] = true
+	}
+	composite := glyph(originalOffsets, original["glyf"], int(f.glyphIndex('Ä')))
+	components := compositeComponents(composite)
+	if len(components) == 0 {
+		t.Fatal("expected composite glyph components")
+	}
+	for _, component := range components {
+		kept[component] = true
+	}
+	for gid := 0; gid < numGlyphs; gid++ {
+		got := glyph(offsets, tables["glyf"], gid)
+		if !kept[gid] {
+			if len(got) != 0 {
+				t.Fatalf("expected glyph %d to be emptied", gid)
+			}
+			continue
+		}
+		if want := glyph(originalOffsets, original["glyf"], gid); !bytes.HasPrefix(got, want) {
+			t.Fatalf("glyph %d outline changed", gid)
+		}
+	}
+}
+
+func TestPDFWrapsLongLines(t *testing.T) {
+	f := newPDFCIDFont(nil, nil)
+	long := strings.TrimSpace(strings.Repeat("word ", 40))
+	lines := f.wrapLine(long)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, " ") || strings.HasSuffix(line, " ") {
+			t.Errorf("expected wrapped line to be trimmed at spaces, got %q", line)
+		}
+		if width := len(line) * 500; width > pdfLineWidth {
+			t.Errorf("line width %d exceeds %d", width, pdfLineWidth)
+		}
+	}
+	if strings.Join(lines, " ") != long {
+		t.Fatalf("wrapped text changed: %q", lines)
+	}
+	// 没有空格的中文按字符断开
+	cjk := f.wrapLine(strings.Repeat("中", 60))
+	if len(cjk) != 2 || len([]rune(cjk[0])) != pdfLineWidth/1000 {
+		t.Fatalf("unexpected cjk wrapping %q", cjk)
+	}
+	if got := f.wrapLine(""); len(got) != 1 || got[0] != "" {
+		t.Fatalf("expected empty line to be kept, got %q", got)
+	}
+
+	pdf := renderTextPDFWithFont([]string{long}, f)
+	if streams := pdfStreams(t, pdf); bytes.Count(streams[0], []byte(" Tj ")) != 2 {
+		t.Fatalf("expected wrapped line to render twice, got %q", streams[0])
+	}
+}
+
+func TestPDFPadRightUsesDisplayWidth(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+	}{
+		{"Company", 7},
+		{"公司", 4},
+		{"Ａ株式会社", 10},
+		{"abc한글", 7},
+	}
+	for _, tt := range tests {
+		if got := pdfTextWidth(tt.text); got != tt.width {
+			t.Errorf("pdfTextWidth(%q) = %d, want %d", tt.text, got, tt.width)
+		}
+		if padded := pdfPadRight(tt.text, 12); pdfTextWidth(padded) != 12 || !strings.HasPrefix(padded, tt.text) {
+			t.Errorf("pdfPadRight(%q) = %q", tt.text, padded)
+		}
+	}
+}
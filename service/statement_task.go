@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/logger"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const statementTickInterval = 1 * time.Hour
+
+var (
+	statementTaskOnce    sync.Once
+	statementTaskRunning atomic.Bool
+	// 本进程已完成自动出账的周期，避免每小时重复扫描
+	statementLastPeriod atomic.Value
+)
+
+func StartStatementTask() {
+	statementTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("statement task started: tick=%s", statementTickInterval))
+			ticker := time.NewTicker(statementTickInterval)
+			defer ticker.Stop()
+
+			runStatementTaskOnce()
+			for range ticker.C {
+				runStatementTaskOnce()
+			}
+		})
+	})
+}
+
+func runStatementTaskOnce() {
+	if !operation_setting.GetStatementSetting().AutoGenerateEnabled {
+		return
+	}
+	period := model.PreviousStatementPeriod(time.Now())
+	if last, ok := statementLastPeriod.Load().(string); ok && last == period {
+		return
+	}
+	if !statementTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer statementTaskRunning.Store(false)
+
+	ctx := context.Background()
+	generated, err := GenerateStatementsForPeriod(period, true, true)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("statement task failed: period=%s, err=%v", period, err))
+		return
+	}
+	statementLastPeriod.Store(period)
+	logger.LogInfo(ctx, fmt.Sprintf("statement task finished: period=%s, generated=%d", period, generated))
+}
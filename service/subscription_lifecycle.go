@@ -0,0 +1,38 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/dto"
+	"github.com/Zer0Echo/uniapi/model"
+	"github.com/Zer0Echo/uniapi/setting/operation_setting"
+)
+
+// NotifySubscriptionRenewalFailed 自动续费扣款失败时提醒用户更新支付方式
+func NotifySubscriptionRenewalFailed(sub *model.UserSubscription) {
+	if sub == nil || !operation_setting.GetSubscriptionSetting().DunningNotifyEnabled {
+		return
+	}
+	user, err := model.GetUserById(sub.UserId, false)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to get user %d for subscription renewal notify: %s", sub.UserId, err.Error()))
+		return
+	}
+	planTitle := fmt.Sprintf("#%d", sub.PlanId)
+	if plan, err := model.GetSubscriptionPlanById(sub.PlanId); err == nil {
+		planTitle = plan.Title
+	}
+	// 宽限期从到期时间起算，到期前扣款失败时提示的是预计的降级时间
+	deadline := sub.GraceEndTime
+	if deadline <= 0 {
+		deadline = sub.EndTime + operation_setting.GetSubscriptionSetting().GracePeriodSeconds()
+	}
+	content := "您的订阅套餐 {{value}} 自动续费扣款失败（第 {{value}} 次），请及时更新支付方式。若在 {{value}} 前仍未续费成功，订阅权益将失效。"
+	err = NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyTypeSubscription, "订阅续费失败", content,
+		[]interface{}{planTitle, sub.RenewalFailedCount, time.Unix(deadline, 0).Format("2006-01-02 15:04")}))
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify subscription renewal failure to user %d: %s", user.Id, err.Error()))
+	}
+}
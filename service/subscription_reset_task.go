@@ -53,6 +53,7 @@ func runSubscriptionQuotaResetOnce() {
 	ctx := context.Background()
 	totalReset := 0
 	totalExpired := 0
+	totalDowngraded := 0
 	for {
 		n, err := model.ExpireDueSubscriptions(subscriptionResetBatchSize)
 		if err != nil {
@@ -67,6 +68,20 @@ func runSubscriptionQuotaResetOnce() {
 			break
 		}
 	}
+	for {
+		n, err := model.DowngradeGraceEndedSubscriptions(subscriptionResetBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("subscription grace downgrade task failed: %v", err))
+			return
+		}
+		if n == 0 {
+			break
+		}
+		totalDowngraded += n
+		if n < subscriptionResetBatchSize {
+			break
+		}
+	}
 	for {
 		n, err := model.ResetDueSubscriptions(subscriptionResetBatchSize)
 		if err != nil {
@@ -87,7 +102,7 @@ func runSubscriptionQuotaResetOnce() {
 			subscriptionCleanupLast.Store(time.Now().Unix())
 		}
 	}
-	if common.DebugEnabled && (totalReset > 0 || totalExpired > 0) {
-		logger.LogDebug(ctx, "subscription maintenance: reset_count=%d, expired_count=%d", totalReset, totalExpired)
+	if common.DebugEnabled && (totalReset > 0 || totalExpired > 0 || totalDowngraded > 0) {
+		logger.LogDebug(ctx, "subscription maintenance: reset_count=%d, expired_count=%d, grace_downgraded_count=%d", totalReset, totalExpired, totalDowngraded)
 	}
 }
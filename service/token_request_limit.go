@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckTokenRequestLimits 按令牌配置校验请求形态：输出 tokens 上限、预估输入 tokens 上限、是否允许工具与联网搜索
+func CheckTokenRequestLimits(c *gin.Context, request dto.Request, promptTokens int) error {
+	maxOutputTokens := common.GetContextKeyInt(c, constant.ContextKeyTokenMaxOutputTokens)
+	if maxOutputTokens > 0 {
+		requested, ok := requestMaxOutputTokens(request)
+		if ok && requested == 0 {
+			return fmt.Errorf("该令牌要求请求指定不超过 %d 的最大输出 tokens", maxOutputTokens)
+		}
+		if requested > maxOutputTokens {
+			return fmt.Errorf("请求的最大输出 tokens %d 超过令牌上限 %d", requested, maxOutputTokens)
+		}
+	}
+	maxInputTokens := common.GetContextKeyInt(c, constant.ContextKeyTokenMaxInputTokens)
+	if maxInputTokens > 0 && promptTokens > maxInputTokens {
+		return fmt.Errorf("请求的输入 tokens 约 %d，超过令牌上限 %d", promptTokens, maxInputTokens)
+	}
+	disableTools := common.GetContextKeyBool(c, constant.ContextKeyTokenDisableTools)
+	disableWebSearch := common.GetContextKeyBool(c, constant.ContextKeyTokenDisableWebSearch)
+	if !disableTools && !disableWebSearch {
+		return nil
+	}
+	usesTools, usesWebSearch := requestToolUsage(request)
+	if disableTools && usesTools {
+		return fmt.Errorf("该令牌不允许使用工具调用")
+	}
+	if disableWebSearch && usesWebSearch {
+		return fmt.Errorf("该令牌不允许使用联网搜索")
+	}
+	return nil
+}
+
+// requestMaxOutputTokens 返回请求指定的最大输出 tokens（未指定为 0），ok 为 false 表示该类请求没有输出 tokens 参数
+func requestMaxOutputTokens(request dto.Request) (tokens int, ok bool) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		return int(r.GetMaxTokens()), true
+	case *dto.OpenAIResponsesRequest:
+		return int(r.MaxOutputTokens), true
+	case *dto.ClaudeRequest:
+		if r.MaxTokens == 0 {
+			return int(r.MaxTokensToSample), true
+		}
+		return int(r.MaxTokens), true
+	case *dto.GeminiChatRequest:
+		return int(r.GenerationConfig.MaxOutputTokens), true
+	}
+	return 0, false
+}
+
+// requestToolUsage 判断请求是否携带函数工具以及是否启用联网搜索
+func requestToolUsage(request dto.Request) (usesTools bool, usesWebSearch bool) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		for _, tool := range r.Tools {
+			if isWebSearchToolType(tool.Type) {
+				usesWebSearch = true
+			} else {
+				usesTools = true
+			}
+		}
+		if len(r.Functions) > 0 && string(r.Functions) != "null" {
+			usesTools = true
+		}
+		if r.WebSearchOptions != nil || (len(r.WebSearch) > 0 && string(r.WebSearch) != "null") {
+			usesWebSearch = true
+		}
+	case *dto.OpenAIResponsesRequest:
+		var tools []map[string]any
+		if len(r.Tools) > 0 && common.Unmarshal(r.Tools, &tools) == nil {
+			for _, tool := range tools {
+				toolType, _ := tool["type"].(string)
+				if isWebSearchToolType(toolType) {
+					usesWebSearch = true
+				} else {
+					usesTools = true
+				}
+			}
+		}
+	case *dto.ClaudeRequest:
+		for _, tool := range r.GetTools() {
+			var toolType string
+			switch t := tool.(type) {
+			case map[string]any:
+				toolType, _ = t["type"].(string)
+			case *dto.ClaudeWebSearchTool, dto.ClaudeWebSearchTool:
+				toolType = "web_search"
+			}
+			if isWebSearchToolType(toolType) {
+				usesWebSearch = true
+			} else {
+				usesTools = true
+			}
+		}
+	case *dto.GeminiChatRequest:
+		for _, tool := range r.GetTools() {
+			if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+				usesWebSearch = true
+			}
+			if tool.FunctionDeclarations != nil || tool.CodeExecution != nil {
+				usesTools = true
+			}
+		}
+	}
+	return usesTools, usesWebSearch
+}
+
+func isWebSearchToolType(toolType string) bool {
+	return strings.HasPrefix(toolType, "web_search")
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/constant"
+	"github.com/Zer0Echo/uniapi/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenRequestLimits struct {
+	maxOutputTokens  int
+	maxInputTokens   int
+	disableTools     bool
+	disableWebSearch bool
+}
+
+func parseLimitTestRequest[T any](t *testing.T, body string) *T {
+	t.Helper()
+	var request T
+	if err := common.Unmarshal([]byte(body), &request); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	return &request
+}
+
+func TestCheckTokenRequestLimits(t *testing.T) {
+	chat := func(body string) dto.Request { return parseLimitTestRequest[dto.GeneralOpenAIRequest](t, body) }
+	responses := func(body string) dto.Request { return parseLimitTestRequest[dto.OpenAIResponsesRequest](t, body) }
+	claude := func(body string) dto.Request { return parseLimitTestRequest[dto.ClaudeRequest](t, body) }
+	gemini := func(body string) dto.Request { return parseLimitTestRequest[dto.GeminiChatRequest](t, body) }
+	tests := []struct {
+		name         string
+		limits       tokenRequestLimits
+		request      dto.Request
+		promptTokens int
+		wantErr      bool
+	}{
+		{name: "no limits", request: chat(`{"tools":[{"type":"function"}]}`), promptTokens: 100000},
+		// 最大输出 tokens
+		{name: "chat max tokens within", limits: tokenRequestLimits{maxOutputTokens: 100}, request: chat(`{"max_tokens":100}`)},
+		{name: "chat max tokens exceeded", limits: tokenRequestLimits{maxOutputTokens: 100}, request: chat(`{"max_tokens":101}`), wantErr: true},
+		{name: "chat max completion tokens preferred", limits: tokenRequestLimits{maxOutputTokens: 100}, request: chat(`{"max_tokens":50,"max_completion_tokens":200}`), wantErr: true},
+		{name: "chat max tokens missing", limits: tokenRequestLimits{maxOutputTokens: 100}, request: chat(`{}`), wantErr: true},
+		{name: "responses max output exceeded", limits: tokenRequestLimits{maxOutputTokens: 100}, request: responses(`{"max_output_tokens":500}`), wantErr: true},
+		{name: "claude max tokens within", limits: tokenRequestLimits{maxOutputTokens: 100}, request: claude(`{"max_tokens":80}`)},
+		{name: "claude max tokens to sample exceeded", limits: tokenRequestLimits{maxOutputTokens: 100}, request: claude(`{"max_tokens_to_sample":150}`), wantErr: true},
+		{name: "gemini max output exceeded", limits: tokenRequestLimits{maxOutputTokens: 100}, request: gemini(`{"generationConfig":{"maxOutputTokens":150}}`), wantErr: true},
+		// 没有输出 tokens 参数的请求不受限制
+		{name: "embedding without output tokens", limits: tokenRequestLimits{maxOutputTokens: 100}, request: &dto.EmbeddingRequest{}},
+		// 预估输入 tokens
+		{name: "input tokens within", limits: tokenRequestLimits{maxInputTokens: 1000}, request: chat(`{}`), promptTokens: 1000},
+		{name: "input tokens exceeded", limits: tokenRequestLimits{maxInputTokens: 1000}, request: chat(`{}`), promptTokens: 1001, wantErr: true},
+		// 工具调用
+		{name: "chat tools disabled", limits: tokenRequestLimits{disableTools: true}, request: chat(`{"tools":[{"type":"function","function":{"name":"f"}}]}`), wantErr: true},
+		{name: "chat functions disabled", limits: tokenRequestLimits{disableTools: true}, request: chat(`{"functions":[{"name":"f"}]}`), wantErr: true},
+		{name: "chat web search allowed when only tools disabled", limits: tokenRequestLimits{disableTools: true}, request: chat(`{"web_search_options":{}}`)},
+		{name: "responses tools disabled", limits: tokenRequestLimits{disableTools: true}, request: responses(`{"tools":[{"type":"function","name":"f"}]}`), wantErr: true},
+		{name: "claude tools disabled", limits: tokenRequestLimits{disableTools: true}, request: claude(`{"max_tokens":10,"tools":[{"name":"f","input_schema":{}}]}`), wantErr: true},
+		{name: "gemini function declarations disabled", limits: tokenRequestLimits{disableTools: true}, request: gemini(`{"tools":[{"functionDeclarations":[{"name":"f"}]}]}`), wantErr: true},
+		{name: "gemini code execution disabled", limits: tokenRequestLimits{disableTools: true}, request: gemini(`{"tools":[{"codeExecution":{}}]}`), wantErr: true},
+		// 联网搜索
+		{name: "chat web search options disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: chat(`{"web_search_options":{}}`), wantErr: true},
+		{name: "chat web search tool disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: chat(`{"tools":[{"type":"web_search_preview"}]}`), wantErr: true},
+		{name: "chat function allowed when only web search disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: chat(`{"tools":[{"type":"function"}]}`)},
+		{name: "responses web search disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: responses(`{"tools":[{"type":"web_search"}]}`), wantErr: true},
+		{name: "claude web search disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: claude(`{"max_tokens":10,"tools":[{"type":"web_search_20250305","name":"web_search"}]}`), wantErr: true},
+		{name: "gemini google search disabled", limits: tokenRequestLimits{disableWebSearch: true}, request: gemini(`{"tools":[{"googleSearch":{}}]}`), wantErr: true},
+		{name: "gemini without tools", limits: tokenRequestLimits{disableTools: true, disableWebSearch: true}, request: gemini(`{}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			common.SetContextKey(c, constant.ContextKeyTokenMaxOutputTokens, tt.limits.maxOutputTokens)
+			common.SetContextKey(c, constant.ContextKeyTokenMaxInputTokens, tt.limits.maxInputTokens)
+			common.SetContextKey(c, constant.ContextKeyTokenDisableTools, tt.limits.disableTools)
+			common.SetContextKey(c, constant.ContextKeyTokenDisableWebSearch, tt.limits.disableWebSearch)
+			err := CheckTokenRequestLimits(c, tt.request, tt.promptTokens)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckTokenRequestLimits err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,77 @@
 package setting
 
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Zer0Echo/uniapi/common"
+)
+
 var MjNotifyEnabled = false
 var MjAccountFilterEnabled = false
 var MjModeClearEnabled = false
 var MjForwardUrlEnabled = true
 var MjActionCheckSuccessEnabled = true
+
+// MjModeRatio 按生成速度模式（/mj-relax、/mj-fast、/mj-turbo 或 prompt 中的 --relax 等参数）的价格倍率，
+// 模型价格中单独配置了 mj_<action>_<mode> 的操作不再乘以倍率
+var MjModeRatio = map[string]float64{
+	"relax": 1,
+	"fast":  1,
+	"turbo": 1,
+}
+
+var mjPriceMutex sync.RWMutex
+
+func MjModeRatio2JSONString() string {
+	mjPriceMutex.RLock()
+	defer mjPriceMutex.RUnlock()
+	jsonBytes, err := json.Marshal(MjModeRatio)
+	if err != nil {
+		common.SysLog("error marshalling mj mode ratio: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateMjModeRatioByJSONString(jsonStr string) error {
+	ratios := make(map[string]float64)
+	if err := json.Unmarshal([]byte(jsonStr), &ratios); err != nil {
+		return err
+	}
+	mjPriceMutex.Lock()
+	defer mjPriceMutex.Unlock()
+	MjModeRatio = ratios
+	return nil
+}
+
+// GetMjModeRatio 返回生成速度模式的价格倍率，未配置的模式倍率为 1
+func GetMjModeRatio(mode string) float64 {
+	if mode == "" {
+		return 1
+	}
+	mjPriceMutex.RLock()
+	defer mjPriceMutex.RUnlock()
+	ratio, ok := MjModeRatio[mode]
+	if !ok || ratio <= 0 {
+		return 1
+	}
+	return ratio
+}
+
+// ParseMjMode 从路径前缀（如 mj-fast）或 prompt 参数中解析生成速度模式
+func ParseMjMode(pathMode string, prompt string) string {
+	modes := []string{"turbo", "fast", "relax"}
+	pathMode = strings.TrimPrefix(strings.ToLower(pathMode), "mj-")
+	for _, mode := range modes {
+		if pathMode == mode {
+			return mode
+		}
+	}
+	for _, mode := range modes {
+		if strings.Contains(prompt, "--"+mode) {
+			return mode
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package operation_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+const (
+	DLPActionOff   = "off"
+	DLPActionFlag  = "flag"  // 仅在日志中记录命中情况
+	DLPActionMask  = "mask"  // 发往上游前替换为占位符，响应中还原
+	DLPActionBlock = "block" // 直接拒绝请求
+)
+
+// 内置检测器
+const (
+	DLPDetectorEmail      = "email"
+	DLPDetectorPhone      = "phone"
+	DLPDetectorCreditCard = "credit_card"
+	DLPDetectorNationalId = "national_id"
+	DLPDetectorApiKey     = "api_key"
+	DLPDetectorIP         = "ip"
+)
+
+var DLPBuiltinDetectors = []string{
+	DLPDetectorApiKey,
+	DLPDetectorEmail,
+	DLPDetectorCreditCard,
+	DLPDetectorNationalId,
+	DLPDetectorPhone,
+	DLPDetectorIP,
+}
+
+type DLPCustomPattern struct {
+	Name    string `json:"name"`    // 作为检测器名称与占位符前缀
+	Pattern string `json:"pattern"` // Go 正则表达式
+}
+
+type DLPPolicy struct {
+	Action    string   `json:"action"`
+	Detectors []string `json:"detectors"` // 为空表示启用全部内置检测器与自定义规则
+}
+
+type DLPSetting struct {
+	Enabled        bool                 `json:"enabled"`
+	DefaultPolicy  DLPPolicy            `json:"default_policy"`
+	GroupPolicies  map[string]DLPPolicy `json:"group_policies"` // 按使用分组覆盖默认策略
+	CustomPatterns []DLPCustomPattern   `json:"custom_patterns"`
+}
+
+var dlpSetting = DLPSetting{
+	Enabled: false,
+	DefaultPolicy: DLPPolicy{
+		Action:    DLPActionFlag,
+		Detectors: []string{},
+	},
+	GroupPolicies:  map[string]DLPPolicy{},
+	CustomPatterns: []DLPCustomPattern{},
+}
+
+func init() {
+	config.GlobalConfig.Register("dlp_setting", &dlpSetting)
+}
+
+func GetDLPSetting() *DLPSetting {
+	return &dlpSetting
+}
+
+// GetDLPPolicy 返回分组生效的策略，未开启或策略为 off 时 ok 为 false
+func GetDLPPolicy(group string) (policy DLPPolicy, ok bool) {
+	if !dlpSetting.Enabled {
+		return DLPPolicy{}, false
+	}
+	policy = dlpSetting.DefaultPolicy
+	if groupPolicy, exists := dlpSetting.GroupPolicies[group]; exists {
+		policy = groupPolicy
+	}
+	switch policy.Action {
+	case DLPActionFlag, DLPActionMask, DLPActionBlock:
+		return policy, true
+	}
+	return DLPPolicy{}, false
+}
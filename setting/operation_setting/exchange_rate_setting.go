@@ -0,0 +1,26 @@
+package operation_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+// ExchangeRateSetting 汇率自动更新配置，汇率均以 1 USD = X 表示
+type ExchangeRateSetting struct {
+	AutoUpdateEnabled     bool   `json:"auto_update_enabled"`     // 定时从汇率源更新（手动覆盖的币种不更新）
+	SourceURL             string `json:"source_url"`              // 汇率源，返回包含 rates 字段、以 USD 为基准的 JSON
+	UpdateIntervalMinutes int    `json:"update_interval_minutes"` // 更新间隔（分钟）
+}
+
+// 默认配置
+var exchangeRateSetting = ExchangeRateSetting{
+	AutoUpdateEnabled:     false,
+	SourceURL:             "https://open.er-api.com/v6/latest/USD",
+	UpdateIntervalMinutes: 720,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("exchange_rate_setting", &exchangeRateSetting)
+}
+
+func GetExchangeRateSetting() *ExchangeRateSetting {
+	return &exchangeRateSetting
+}
@@ -5,6 +5,9 @@ import "github.com/Zer0Echo/uniapi/setting/config"
 type PaymentSetting struct {
 	AmountOptions  []int           `json:"amount_options"`
 	AmountDiscount map[int]float64 `json:"amount_discount"` // 充值金额对应的折扣，例如 100 元 0.9 表示 100 元充值享受 9 折优惠
+	// 首次充值赠送：按入账额度的比例赠送，例如 0.1 表示额外赠送 10%，0 表示关闭
+	FirstTopUpBonusRate float64 `json:"first_topup_bonus_rate"`
+	FirstTopUpBonusMax  float64 `json:"first_topup_bonus_max"` // 首充赠送上限（美元），0 表示不限
 }
 
 // 默认配置
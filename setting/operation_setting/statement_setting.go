@@ -0,0 +1,29 @@
+package operation_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+// StatementSetting 月度账单配置
+type StatementSetting struct {
+	AutoGenerateEnabled bool    `json:"auto_generate_enabled"` // 每月初自动为上月有消费或充值的用户生成账单
+	NotifyEnabled       bool    `json:"notify_enabled"`        // 账单生成后通知用户
+	IssuerName          string  `json:"issuer_name"`           // 开票方名称
+	IssuerTaxId         string  `json:"issuer_tax_id"`         // 开票方税号
+	IssuerAddress       string  `json:"issuer_address"`        // 开票方地址
+	TaxRate             float64 `json:"tax_rate"`              // 税率（百分比），账单金额按含税计算
+}
+
+// 默认配置
+var statementSetting = StatementSetting{
+	AutoGenerateEnabled: false,
+	NotifyEnabled:       true,
+	TaxRate:             0,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("statement_setting", &statementSetting)
+}
+
+func GetStatementSetting() *StatementSetting {
+	return &statementSetting
+}
@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+// SubscriptionSetting 订阅生命周期配置
+type SubscriptionSetting struct {
+	GracePeriodHours     int  `json:"grace_period_hours"`     // 自动续费订阅到期后保留升级分组的宽限期（小时），0 表示到期立即降级
+	DunningNotifyEnabled bool `json:"dunning_notify_enabled"` // 续费扣款失败时通知用户
+	PlanChangeEnabled    bool `json:"plan_change_enabled"`    // 允许用户自助升级或降级套餐，差价按剩余时间折算
+}
+
+// 默认配置
+var subscriptionSetting = SubscriptionSetting{
+	GracePeriodHours:     72,
+	DunningNotifyEnabled: true,
+	PlanChangeEnabled:    true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("subscription_setting", &subscriptionSetting)
+}
+
+func GetSubscriptionSetting() *SubscriptionSetting {
+	return &subscriptionSetting
+}
+
+// GracePeriodSeconds 宽限期秒数
+func (s *SubscriptionSetting) GracePeriodSeconds() int64 {
+	if s.GracePeriodHours <= 0 {
+		return 0
+	}
+	return int64(s.GracePeriodHours) * 3600
+}
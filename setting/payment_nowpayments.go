@@ -0,0 +1,6 @@
+package setting
+
+var NowPaymentsApiKey = ""
+var NowPaymentsIpnSecret = ""
+var NowPaymentsSandbox = false
+var NowPaymentsPriceCurrency = "usd"
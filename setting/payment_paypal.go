@@ -0,0 +1,7 @@
+package setting
+
+var PayPalClientId = ""
+var PayPalClientSecret = ""
+var PayPalWebhookId = ""
+var PayPalSandbox = false
+var PayPalCurrency = "USD"
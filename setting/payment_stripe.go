@@ -6,3 +6,6 @@ var StripePriceId = ""
 var StripeUnitPrice = 8.0
 var StripeMinTopUp = 1
 var StripePromotionCodesEnabled = false
+
+// StripeCurrencies 充值价格（StripePriceId）上配置了 currency_options 的其他货币，逗号分隔
+var StripeCurrencies = ""
@@ -0,0 +1,129 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/common"
+	"github.com/Zer0Echo/uniapi/types"
+)
+
+// VideoPrice 视频模型按秒计费配置，价格单位与 ModelPrice 一致（美元）
+type VideoPrice struct {
+	// 各分辨率档位每秒价格，如 {"480p": 0.05, "720p": 0.1, "1080p": 0.2}
+	PerSecond map[string]float64 `json:"per_second"`
+	// 开启音频时的价格倍率，<= 0 视为 1
+	AudioRatio float64 `json:"audio_ratio,omitempty"`
+	// 请求未指定时长时用于预扣的默认秒数
+	DefaultSeconds float64 `json:"default_seconds,omitempty"`
+	// 请求未指定分辨率时使用的档位
+	DefaultResolution string `json:"default_resolution,omitempty"`
+}
+
+// VideoPriceBreakdown 记录一次视频计费的明细，写入任务与日志
+type VideoPriceBreakdown struct {
+	Seconds         float64 `json:"seconds"`
+	Resolution      string  `json:"resolution"`
+	Audio           bool    `json:"audio"`
+	PricePerSecond  float64 `json:"price_per_second"`
+	AudioRatio      float64 `json:"audio_ratio"`
+	GroupRatio      float64 `json:"group_ratio"`
+	Price           float64 `json:"price"`
+	Quota           int     `json:"quota"`
+	PreConsumeQuota int     `json:"pre_consume_quota,omitempty"`
+	Settled         bool    `json:"settled,omitempty"`
+}
+
+var defaultVideoPrice = map[string]VideoPrice{}
+
+var videoPriceMap = types.NewRWMap[string, VideoPrice]()
+
+func VideoPrice2JSONString() string {
+	return videoPriceMap.MarshalJSONString()
+}
+
+func UpdateVideoPriceByJSONString(jsonStr string) error {
+	return types.LoadFromJsonStringWithCallback(videoPriceMap, jsonStr, InvalidateExposedDataCache)
+}
+
+func GetVideoPriceCopy() map[string]VideoPrice {
+	return videoPriceMap.ReadAll()
+}
+
+// GetVideoPrice 返回模型的按秒计费配置，未配置时返回 false
+func GetVideoPrice(name string) (VideoPrice, bool) {
+	price, ok := videoPriceMap.Get(FormatMatchingModelName(name))
+	if !ok || len(price.PerSecond) == 0 {
+		return VideoPrice{}, false
+	}
+	return price, true
+}
+
+// NormalizeVideoResolution 将 "1280x720"、"720P"、"720" 等写法统一为 "720p" 档位
+func NormalizeVideoResolution(resolution string) string {
+	resolution = strings.ToLower(strings.TrimSpace(resolution))
+	if resolution == "" {
+		return ""
+	}
+	if w, h, found := strings.Cut(resolution, "x"); found {
+		width, err1 := strconv.Atoi(strings.TrimSpace(w))
+		height, err2 := strconv.Atoi(strings.TrimSpace(h))
+		if err1 != nil || err2 != nil {
+			return resolution
+		}
+		return strconv.Itoa(min(width, height)) + "p"
+	}
+	if strings.HasSuffix(resolution, "p") || strings.HasSuffix(resolution, "k") {
+		return resolution
+	}
+	if _, err := strconv.Atoi(resolution); err == nil {
+		return resolution + "p"
+	}
+	return resolution
+}
+
+// Calculate 计算指定时长、分辨率与音频开关下的价格（不含分组倍率）
+func (p VideoPrice) Calculate(seconds float64, resolution string, audio bool) (VideoPriceBreakdown, error) {
+	breakdown := VideoPriceBreakdown{
+		Seconds:    seconds,
+		Resolution: NormalizeVideoResolution(resolution),
+		Audio:      audio,
+		AudioRatio: 1,
+	}
+	if breakdown.Seconds <= 0 {
+		breakdown.Seconds = p.DefaultSeconds
+	}
+	if breakdown.Seconds <= 0 {
+		return breakdown, fmt.Errorf("video duration is unknown")
+	}
+	if breakdown.Resolution == "" {
+		breakdown.Resolution = NormalizeVideoResolution(p.DefaultResolution)
+	}
+	perSecond, ok := p.PerSecond[breakdown.Resolution]
+	if !ok {
+		return breakdown, fmt.Errorf("resolution %s is not priced", breakdown.Resolution)
+	}
+	breakdown.PricePerSecond = perSecond
+	if audio && p.AudioRatio > 0 {
+		breakdown.AudioRatio = p.AudioRatio
+	}
+	breakdown.Price = breakdown.Seconds * perSecond * breakdown.AudioRatio
+	return breakdown, nil
+}
+
+// ToQuota 按分组倍率换算为额度并写入明细
+func (b *VideoPriceBreakdown) ToQuota(groupRatio float64) int {
+	b.GroupRatio = groupRatio
+	b.Quota = int(b.Price * groupRatio * common.QuotaPerUnit)
+	return b.Quota
+}
+
+func (b *VideoPriceBreakdown) String() string {
+	audio := "关"
+	if b.Audio {
+		audio = "开"
+	}
+	return fmt.Sprintf("时长 %.2fs，分辨率 %s，音频 %s，单价 $%.4f/s，音频倍率 %.2f，分组倍率 %.2f",
+		b.Seconds, b.Resolution, audio, b.PricePerSecond, b.AudioRatio, b.GroupRatio)
+}
@@ -0,0 +1,37 @@
+package ratio_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeVideoResolution(t *testing.T) {
+	require.Equal(t, "720p", NormalizeVideoResolution("1280x720"))
+	require.Equal(t, "720p", NormalizeVideoResolution("720x1280"))
+	require.Equal(t, "1080p", NormalizeVideoResolution("1080P"))
+	require.Equal(t, "480p", NormalizeVideoResolution("480"))
+	require.Equal(t, "", NormalizeVideoResolution(" "))
+}
+
+func TestVideoPriceCalculate(t *testing.T) {
+	price := VideoPrice{
+		PerSecond:         map[string]float64{"720p": 0.1, "1080p": 0.2},
+		AudioRatio:        1.5,
+		DefaultSeconds:    5,
+		DefaultResolution: "720p",
+	}
+
+	breakdown, err := price.Calculate(8, "1920x1080", true)
+	require.NoError(t, err)
+	require.Equal(t, "1080p", breakdown.Resolution)
+	require.InDelta(t, 8*0.2*1.5, breakdown.Price, 1e-9)
+
+	breakdown, err = price.Calculate(0, "", false)
+	require.NoError(t, err)
+	require.Equal(t, "720p", breakdown.Resolution)
+	require.InDelta(t, 5*0.1, breakdown.Price, 1e-9)
+
+	_, err = price.Calculate(4, "4k", false)
+	require.Error(t, err)
+}
@@ -0,0 +1,23 @@
+package system_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+// AuditLogSetting 管理操作审计配置，保留期与消费日志相互独立
+type AuditLogSetting struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retention_days"` // 超过保留天数的审计记录会被自动清理，0 表示永久保留
+}
+
+var auditLogSetting = AuditLogSetting{
+	Enabled:       true,
+	RetentionDays: 365,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audit_log_setting", &auditLogSetting)
+}
+
+func GetAuditLogSetting() *AuditLogSetting {
+	return &auditLogSetting
+}
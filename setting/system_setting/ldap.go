@@ -0,0 +1,100 @@
+package system_setting
+
+import (
+	"strings"
+
+	"github.com/Zer0Echo/uniapi/setting/config"
+)
+
+type LDAPSettings struct {
+	Enabled              bool              `json:"enabled"`
+	URL                  string            `json:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS             bool              `json:"start_tls"`
+	InsecureSkipVerify   bool              `json:"insecure_skip_verify"`
+	BindDN               string            `json:"bind_dn"` // 用于查找用户的服务账号，为空时匿名查找
+	BindPassword         string            `json:"bind_password"`
+	BaseDN               string            `json:"base_dn"`
+	UserFilter           string            `json:"user_filter"` // {username} 会被替换为转义后的登录名
+	UsernameAttribute    string            `json:"username_attribute"`
+	EmailAttribute       string            `json:"email_attribute"`
+	DisplayNameAttribute string            `json:"display_name_attribute"`
+	GroupAttribute       string            `json:"group_attribute"`  // 用户条目上的组属性，如 memberOf
+	GroupBaseDN          string            `json:"group_base_dn"`    // 配置后额外按 GroupFilter 查找用户所属的组
+	GroupFilter          string            `json:"group_filter"`     // {dn} 与 {username} 会被替换为转义后的值
+	GroupMappings        []SSOGroupMapping `json:"group_mappings"`   // 按顺序匹配，组名可填写完整 DN 或 CN
+	DefaultGroup         string            `json:"default_group"`    // 没有匹配的组时使用，为空表示不修改用户分组
+	AdminGroups          []string          `json:"admin_groups"`     // 配置后每次登录按成员关系设置管理员或普通用户，不影响超级管理员
+	AutoCreateUser       bool              `json:"auto_create_user"` // 首次登录时自动创建用户
+	TimeoutSeconds       int               `json:"timeout_seconds"`
+}
+
+var defaultLDAPSettings = LDAPSettings{
+	UserFilter:           "(|(uid={username})(sAMAccountName={username}))",
+	UsernameAttribute:    "uid",
+	EmailAttribute:       "mail",
+	DisplayNameAttribute: "displayName",
+	GroupAttribute:       "memberOf",
+	GroupFilter:          "(|(member={dn})(uniqueMember={dn})(memberUid={username}))",
+	GroupMappings:        []SSOGroupMapping{},
+	AdminGroups:          []string{},
+	AutoCreateUser:       true,
+	TimeoutSeconds:       10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("ldap", &defaultLDAPSettings)
+}
+
+func GetLDAPSettings() *LDAPSettings {
+	return &defaultLDAPSettings
+}
+
+// ldapGroupMatches 组名不区分大小写，可匹配完整 DN 或其首个 RDN 的值（通常为 CN）
+func ldapGroupMatches(groupDN string, name string) bool {
+	if name == "" {
+		return false
+	}
+	if strings.EqualFold(groupDN, name) {
+		return true
+	}
+	rdn, _, _ := strings.Cut(groupDN, ",")
+	if _, value, ok := strings.Cut(rdn, "="); ok {
+		return strings.EqualFold(strings.TrimSpace(value), name)
+	}
+	return false
+}
+
+func ldapInGroup(groups []string, name string) bool {
+	for _, group := range groups {
+		if ldapGroupMatches(group, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveLDAPGroup 按组映射计算网关分组，返回空表示不修改
+func ResolveLDAPGroup(groups []string) string {
+	settings := GetLDAPSettings()
+	for _, mapping := range settings.GroupMappings {
+		if mapping.Group != "" && ldapInGroup(groups, mapping.IdPGroup) {
+			return mapping.Group
+		}
+	}
+	return settings.DefaultGroup
+}
+
+// ResolveLDAPAdmin 未配置管理员组时返回 ok=false，表示不修改用户角色
+func ResolveLDAPAdmin(groups []string) (isAdmin bool, ok bool) {
+	settings := GetLDAPSettings()
+	if len(settings.AdminGroups) == 0 {
+		return false, false
+	}
+	for _, name := range settings.AdminGroups {
+		if ldapInGroup(groups, name) {
+			return true, true
+		}
+	}
+	return false, true
+}
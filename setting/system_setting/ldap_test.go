@@ -0,0 +1,71 @@
+package system_setting
+
+import "testing"
+
+func TestResolveLDAPGroup(t *testing.T) {
+	settings := GetLDAPSettings()
+	oldMappings, oldDefault := settings.GroupMappings, settings.DefaultGroup
+	t.Cleanup(func() { settings.GroupMappings, settings.DefaultGroup = oldMappings, oldDefault })
+	settings.GroupMappings = []SSOGroupMapping{
+		{IdPGroup: "cn=Admins,ou=groups,dc=example,dc=com", Group: "svip"},
+		{IdPGroup: "engineering", Group: "vip"},
+		{IdPGroup: "ignored", Group: ""},
+		{IdPGroup: "", Group: "empty"},
+	}
+
+	tests := []struct {
+		name         string
+		groups       []string
+		defaultGroup string
+		want         string
+	}{
+		{name: "full dn", groups: []string{"CN=Admins,OU=Groups,DC=example,DC=com"}, want: "svip"},
+		{name: "cn value case insensitive", groups: []string{"cn=Engineering,ou=groups,dc=example,dc=com"}, want: "vip"},
+		{name: "plain group name", groups: []string{"ENGINEERING"}, want: "vip"},
+		{name: "cn with spaces", groups: []string{"cn= Engineering ,ou=groups"}, want: "vip"},
+		{name: "first mapping wins", groups: []string{"cn=engineering,dc=example", "cn=Admins,ou=groups,dc=example,dc=com"}, want: "svip"},
+		{name: "other rdn does not match", groups: []string{"cn=qa,ou=engineering,dc=example"}, defaultGroup: "default", want: "default"},
+		{name: "mapping without target group is skipped", groups: []string{"cn=ignored"}, defaultGroup: "default", want: "default"},
+		{name: "no match without default", groups: []string{"cn=sales"}, want: ""},
+		{name: "no groups", defaultGroup: "default", want: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings.DefaultGroup = tt.defaultGroup
+			if got := ResolveLDAPGroup(tt.groups); got != tt.want {
+				t.Fatalf("ResolveLDAPGroup(%v) = %q, want %q", tt.groups, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLDAPAdmin(t *testing.T) {
+	settings := GetLDAPSettings()
+	oldAdminGroups := settings.AdminGroups
+	t.Cleanup(func() { settings.AdminGroups = oldAdminGroups })
+
+	tests := []struct {
+		name        string
+		adminGroups []string
+		groups      []string
+		wantAdmin   bool
+		wantOk      bool
+	}{
+		{name: "no admin groups configured", groups: []string{"cn=admins"}},
+		{name: "member by cn", adminGroups: []string{"Admins"}, groups: []string{"cn=admins,ou=groups,dc=example"}, wantAdmin: true, wantOk: true},
+		{name: "member by dn", adminGroups: []string{"cn=ops,dc=example"}, groups: []string{"CN=Ops,DC=Example"}, wantAdmin: true, wantOk: true},
+		{name: "any admin group", adminGroups: []string{"admins", "ops"}, groups: []string{"cn=ops"}, wantAdmin: true, wantOk: true},
+		{name: "not a member", adminGroups: []string{"admins"}, groups: []string{"cn=engineering"}, wantOk: true},
+		{name: "no groups", adminGroups: []string{"admins"}, wantOk: true},
+		{name: "empty admin group name never matches", adminGroups: []string{""}, groups: []string{""}, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings.AdminGroups = tt.adminGroups
+			isAdmin, ok := ResolveLDAPAdmin(tt.groups)
+			if isAdmin != tt.wantAdmin || ok != tt.wantOk {
+				t.Fatalf("ResolveLDAPAdmin(%v) = %v, %v, want %v, %v", tt.groups, isAdmin, ok, tt.wantAdmin, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package system_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+const (
+	LogExportTargetLocal = "local"
+	LogExportTargetS3    = "s3"
+)
+
+// LogExportSetting 定时导出消费日志配置
+type LogExportSetting struct {
+	Enabled bool   `json:"enabled"`
+	Cron    string `json:"cron"`   // 5 段 cron 表达式，每次导出上次导出之后的日志
+	Format  string `json:"format"` // csv 或 jsonl
+	Target  string `json:"target"` // local 或 s3
+	// 本地目录
+	LocalDir string `json:"local_dir"`
+	// S3 兼容存储
+	S3Endpoint    string `json:"s3_endpoint"` // 例如 https://s3.us-east-1.amazonaws.com 或 MinIO 地址
+	S3Region      string `json:"s3_region"`
+	S3Bucket      string `json:"s3_bucket"`
+	S3Prefix      string `json:"s3_prefix"`
+	S3AccessKeyId string `json:"s3_access_key_id"`
+	S3Secret      string `json:"s3_secret"`
+	S3PathStyle   bool   `json:"s3_path_style"` // 使用 endpoint/bucket/key 形式的地址，MinIO 等需要开启
+}
+
+var logExportSetting = LogExportSetting{
+	Enabled:     false,
+	Cron:        "0 1 * * *",
+	Format:      "csv",
+	Target:      LogExportTargetLocal,
+	LocalDir:    "./exports",
+	S3Region:    "us-east-1",
+	S3PathStyle: true,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("log_export_setting", &logExportSetting)
+}
+
+func GetLogExportSetting() *LogExportSetting {
+	return &logExportSetting
+}
@@ -0,0 +1,56 @@
+package system_setting
+
+import (
+	"slices"
+
+	"github.com/Zer0Echo/uniapi/setting/config"
+)
+
+// SSOGroupMapping 将身份提供方的组映射为网关分组
+type SSOGroupMapping struct {
+	IdPGroup string `json:"idp_group"`
+	Group    string `json:"group"`
+}
+
+type SAMLSettings struct {
+	Enabled              bool              `json:"enabled"`
+	IdPMetadataURL       string            `json:"idp_metadata_url"`
+	IdPMetadataXML       string            `json:"idp_metadata_xml"` // 未配置元数据地址时使用
+	EntityId             string            `json:"entity_id"`        // 为空时使用 SP 元数据地址
+	SPCertificate        string            `json:"sp_certificate"`   // PEM 格式，配置后对 AuthnRequest 签名
+	SPPrivateKey         string            `json:"sp_private_key"`
+	UsernameAttribute    string            `json:"username_attribute"` // 为空时使用 NameID
+	EmailAttribute       string            `json:"email_attribute"`
+	DisplayNameAttribute string            `json:"display_name_attribute"`
+	GroupAttribute       string            `json:"group_attribute"`
+	AllowIdPInitiated    bool              `json:"allow_idp_initiated"`
+	GroupMappings        []SSOGroupMapping `json:"group_mappings"` // 按顺序匹配，先匹配者优先
+	DefaultGroup         string            `json:"default_group"`  // 没有匹配的组时使用，为空表示不修改用户分组
+}
+
+var defaultSAMLSettings = SAMLSettings{
+	EmailAttribute:       "email",
+	DisplayNameAttribute: "displayName",
+	GroupAttribute:       "groups",
+	GroupMappings:        []SSOGroupMapping{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("saml", &defaultSAMLSettings)
+}
+
+func GetSAMLSettings() *SAMLSettings {
+	return &defaultSAMLSettings
+}
+
+// ResolveSSOGroup 按组映射计算网关分组，SAML 登录与 SCIM 同步共用，返回空表示不修改
+func ResolveSSOGroup(idpGroups []string) string {
+	settings := GetSAMLSettings()
+	for _, mapping := range settings.GroupMappings {
+		if mapping.Group != "" && slices.Contains(idpGroups, mapping.IdPGroup) {
+			return mapping.Group
+		}
+	}
+	return settings.DefaultGroup
+}
@@ -0,0 +1,20 @@
+package system_setting
+
+import "github.com/Zer0Echo/uniapi/setting/config"
+
+// SCIMSettings SCIM 2.0 用户同步配置，组映射复用 SAML 的配置
+type SCIMSettings struct {
+	Enabled     bool   `json:"enabled"`
+	BearerToken string `json:"bearer_token"`
+}
+
+var defaultSCIMSettings = SCIMSettings{}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
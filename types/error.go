@@ -41,6 +41,9 @@ const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
 	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
+	ErrorCodeTokenRequestLimit      ErrorCode = "token_request_limit"
+	ErrorCodeSensitiveDataDetected  ErrorCode = "sensitive_data_detected"
+	ErrorCodePromptInjectionBlocked ErrorCode = "prompt_injection_blocked"
 
 	// new api error
 	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
@@ -53,6 +56,7 @@ const (
 
 	// channel error
 	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
+	ErrorCodeChannelKeysUnavailable       ErrorCode = "channel:keys_unavailable"
 	ErrorCodeChannelParamOverrideInvalid  ErrorCode = "channel:param_override_invalid"
 	ErrorCodeChannelHeaderOverrideInvalid ErrorCode = "channel:header_override_invalid"
 	ErrorCodeChannelModelMappedError      ErrorCode = "channel:model_mapped_error"
@@ -83,8 +87,9 @@ const (
 	ErrorCodeUpdateDataError ErrorCode = "update_data_error"
 
 	// quota error
-	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
-	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeInsufficientUserQuota          ErrorCode = "insufficient_user_quota"
+	ErrorCodePreConsumeTokenQuotaFailed     ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeSubscriptionAllowanceExhausted ErrorCode = "subscription_allowance_exhausted"
 )
 
 type NewAPIError struct {
@@ -225,10 +225,32 @@ const RegisterForm = () => {
           `/api/user/register?turnstile=${turnstileToken}`,
           inputs,
         );
-        const { success, message } = res.data;
+        const { success, message, data } = res.data;
         if (success) {
-          navigate('/login');
           showSuccess('注册成功！');
+          // 初始令牌的密钥只在注册时返回一次
+          if (data?.default_token?.key) {
+            Modal.info({
+              title: t('初始令牌'),
+              content: (
+                <div>
+                  <Text>
+                    {t('请立即复制并妥善保存，关闭后将无法再次查看')}
+                  </Text>
+                  <Text
+                    copyable
+                    code
+                    style={{ display: 'block', marginTop: 8 }}
+                  >
+                    sk-{data.default_token.key}
+                  </Text>
+                </div>
+              ),
+              onOk: () => navigate('/login'),
+            });
+          } else {
+            navigate('/login');
+          }
         } else {
           showError(message);
         }
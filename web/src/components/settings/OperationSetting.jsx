@@ -59,6 +59,8 @@ const OperationSetting = () => {
     /* 敏感词设置 */
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
+    StopOnSensitiveEnabled: false,
     SensitiveWords: '',
 
     /* 日志设置 */
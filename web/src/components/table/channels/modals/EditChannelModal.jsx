@@ -582,6 +582,11 @@ const EditChannelModal = (props) => {
         const modeVal = chInfo.multi_key_mode || 'random';
         setMultiKeyMode(modeVal);
         data.multi_key_mode = modeVal;
+        const budget = chInfo.multi_key_budget || {};
+        data.key_budget_rpm = budget.rpm || 0;
+        data.key_budget_tpm = budget.tpm || 0;
+        data.key_budget_daily_quota = budget.daily_quota || 0;
+        data.key_budget_cooldown_seconds = budget.cooldown_seconds || 0;
       } else {
         setBatch(false);
         setMultiToSingle(false);
@@ -635,6 +640,15 @@ const EditChannelModal = (props) => {
           data.allow_safety_identifier =
             parsedSettings.allow_safety_identifier || false;
           data.claude_beta_query = parsedSettings.claude_beta_query || false;
+          // 读取余额告警设置，管理密钥不会返回明文
+          const balanceSettings = parsedSettings.balance || {};
+          data.balance_alert_threshold = balanceSettings.alert_threshold || 0;
+          data.balance_disable_threshold =
+            balanceSettings.disable_threshold || 0;
+          data.balance_monthly_budget = balanceSettings.monthly_budget || 0;
+          data.balance_account_id = balanceSettings.account_id || '';
+          data.balance_admin_key = '';
+          data.balance_admin_key_set = balanceSettings.admin_key_set === true;
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
@@ -1403,6 +1417,24 @@ const EditChannelModal = (props) => {
       }
     }
 
+    // 余额告警与查询设置，管理密钥留空时保持原值
+    const balanceSettings = {
+      alert_threshold: localInputs.balance_alert_threshold || 0,
+      disable_threshold: localInputs.balance_disable_threshold || 0,
+      monthly_budget: localInputs.balance_monthly_budget || 0,
+      account_id: localInputs.balance_account_id || '',
+    };
+    if (localInputs.balance_admin_key) {
+      balanceSettings.admin_key = localInputs.balance_admin_key;
+    } else if (localInputs.balance_admin_key_set) {
+      balanceSettings.admin_key_set = true;
+    }
+    if (Object.values(balanceSettings).some(Boolean)) {
+      settings.balance = balanceSettings;
+    } else {
+      delete settings.balance;
+    }
+
     localInputs.settings = JSON.stringify(settings);
 
     // 清理不需要发送到后端的字段
@@ -1422,6 +1454,27 @@ const EditChannelModal = (props) => {
     delete localInputs.disable_store;
     delete localInputs.allow_safety_identifier;
     delete localInputs.claude_beta_query;
+    // 清理余额告警设置的临时字段
+    delete localInputs.balance_alert_threshold;
+    delete localInputs.balance_disable_threshold;
+    delete localInputs.balance_monthly_budget;
+    delete localInputs.balance_account_id;
+    delete localInputs.balance_admin_key;
+    delete localInputs.balance_admin_key_set;
+
+    // 多密钥渠道每个 Key 的默认限额
+    if (isEdit && isMultiKeyChannel) {
+      localInputs.multi_key_budget = {
+        rpm: localInputs.key_budget_rpm || 0,
+        tpm: localInputs.key_budget_tpm || 0,
+        daily_quota: localInputs.key_budget_daily_quota || 0,
+        cooldown_seconds: localInputs.key_budget_cooldown_seconds || 0,
+      };
+    }
+    delete localInputs.key_budget_rpm;
+    delete localInputs.key_budget_tpm;
+    delete localInputs.key_budget_daily_quota;
+    delete localInputs.key_budget_cooldown_seconds;
 
     let res;
     localInputs.auto_ban = localInputs.auto_ban ? 1 : 0;
@@ -2375,6 +2428,8 @@ const EditChannelModal = (props) => {
                           optionList={[
                             { label: t('随机'), value: 'random' },
                             { label: t('轮询'), value: 'polling' },
+                            { label: t('最少使用'), value: 'least_used' },
+                            { label: t('用尽优先'), value: 'fill_first' },
                           ]}
                           style={{ width: '100%' }}
                           value={inputs.multi_key_mode || 'random'}
@@ -2392,6 +2447,67 @@ const EditChannelModal = (props) => {
                             className='!rounded-lg mt-2'
                           />
                         )}
+                        {isEdit && isMultiKeyChannel && (
+                          <Row gutter={12}>
+                            <Col span={6}>
+                              <Form.InputNumber
+                                field='key_budget_rpm'
+                                label={t('单 Key RPM')}
+                                min={0}
+                                onNumberChange={(value) =>
+                                  handleInputChange('key_budget_rpm', value)
+                                }
+                                style={{ width: '100%' }}
+                              />
+                            </Col>
+                            <Col span={6}>
+                              <Form.InputNumber
+                                field='key_budget_tpm'
+                                label={t('单 Key TPM')}
+                                min={0}
+                                onNumberChange={(value) =>
+                                  handleInputChange('key_budget_tpm', value)
+                                }
+                                style={{ width: '100%' }}
+                              />
+                            </Col>
+                            <Col span={6}>
+                              <Form.InputNumber
+                                field='key_budget_daily_quota'
+                                label={t('单 Key 每日额度')}
+                                min={0}
+                                onNumberChange={(value) =>
+                                  handleInputChange(
+                                    'key_budget_daily_quota',
+                                    value,
+                                  )
+                                }
+                                style={{ width: '100%' }}
+                              />
+                            </Col>
+                            <Col span={6}>
+                              <Form.InputNumber
+                                field='key_budget_cooldown_seconds'
+                                label={t('429 冷却秒数')}
+                                min={0}
+                                onNumberChange={(value) =>
+                                  handleInputChange(
+                                    'key_budget_cooldown_seconds',
+                                    value,
+                                  )
+                                }
+                                style={{ width: '100%' }}
+                              />
+                            </Col>
+                            <Col span={24}>
+                              <Text type='tertiary' size='small'>
+                                {t(
+                                  '0 表示不限制；超出限额或被上游限流的 Key 会暂时跳过，全部不可用时切换到其他渠道',
+                                )}
+                              </Text>
+                            </Col>
+                          </Row>
+                        )}
                       </>
                     )}
 
@@ -3428,6 +3544,78 @@ const EditChannelModal = (props) => {
                         '如果用户请求中包含系统提示词，则使用此设置拼接到用户的系统提示词前面',
                       )}
                     />
+
+                    <Row gutter={12}>
+                      <Col span={8}>
+                        <Form.InputNumber
+                          field='balance_alert_threshold'
+                          label={t('余额告警阈值')}
+                          prefix='$'
+                          min={0}
+                          onNumberChange={(value) =>
+                            handleInputChange('balance_alert_threshold', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                      <Col span={8}>
+                        <Form.InputNumber
+                          field='balance_disable_threshold'
+                          label={t('余额禁用阈值')}
+                          prefix='$'
+                          onNumberChange={(value) =>
+                            handleInputChange(
+                              'balance_disable_threshold',
+                              value,
+                            )
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                      <Col span={8}>
+                        <Form.InputNumber
+                          field='balance_monthly_budget'
+                          label={t('每月预算')}
+                          prefix='$'
+                          min={0}
+                          onNumberChange={(value) =>
+                            handleInputChange('balance_monthly_budget', value)
+                          }
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+                    </Row>
+                    <Text type='tertiary' size='small'>
+                      {t(
+                        '定时更新余额时，低于告警阈值通知管理员，低于禁用阈值自动禁用渠道（需开启自动禁用）；只能查询用量的接口按每月预算减去本月消耗计算余额',
+                      )}
+                    </Text>
+                    <Form.Input
+                      field='balance_admin_key'
+                      label={t('余额查询管理密钥')}
+                      mode='password'
+                      placeholder={
+                        inputs.balance_admin_key_set
+                          ? t('已设置，留空保持不变')
+                          : t(
+                              'OpenAI / Anthropic Admin Key，火山引擎、阿里云填写 AK|SK',
+                            )
+                      }
+                      onChange={(value) =>
+                        handleInputChange('balance_admin_key', value)
+                      }
+                      showClear
+                    />
+                    {inputs.type === 48 && (
+                      <Form.Input
+                        field='balance_account_id'
+                        label={t('xAI Team ID')}
+                        onChange={(value) =>
+                          handleInputChange('balance_account_id', value)
+                        }
+                        showClear
+                      />
+                    )}
                   </Card>
                 </div>
               </div>
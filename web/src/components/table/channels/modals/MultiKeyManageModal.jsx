@@ -406,6 +406,24 @@ const MultiKeyManageModal = ({ visible, onCancel, channel, onRefresh }) => {
         );
       },
     },
+    {
+      title: t('今日用量'),
+      dataIndex: 'usage',
+      render: (usage) => {
+        if (!usage || !usage.daily_requests) {
+          return <Text type='quaternary'>-</Text>;
+        }
+        return (
+          <Tooltip
+            content={`${t('累计')}: ${usage.total_requests} / ${usage.total_tokens} tokens`}
+          >
+            <Text style={{ fontSize: '12px' }}>
+              {usage.daily_requests} / {usage.daily_tokens} tokens
+            </Text>
+          </Tooltip>
+        );
+      },
+    },
     {
       title: t('操作'),
       key: 'action',
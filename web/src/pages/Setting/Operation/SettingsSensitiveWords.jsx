@@ -34,6 +34,8 @@ export default function SettingsSensitiveWords(props) {
   const [inputs, setInputs] = useState({
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
+    StopOnSensitiveEnabled: false,
     SensitiveWords: '',
   });
   const refForm = useRef();
@@ -125,6 +127,37 @@ export default function SettingsSensitiveWords(props) {
                   }
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'CheckSensitiveOnCompletionEnabled'}
+                  label={t('启用输出内容检查')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CheckSensitiveOnCompletionEnabled: value,
+                    })
+                  }
+                />
+              </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'StopOnSensitiveEnabled'}
+                  label={t('输出命中屏蔽词时截断')}
+                  extraText={t('关闭时仅替换输出中的屏蔽词')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      StopOnSensitiveEnabled: value,
+                    })
+                  }
+                />
+              </Col>
             </Row>
             <Row>
               <Col xs={24} sm={12} md={8} lg={8} xl={8}>